@@ -0,0 +1,58 @@
+package grpcserver
+
+import (
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/patent-dev/bulk-file-loader/api/generated/bulkloaderv1"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+)
+
+func convertFile(f *database.File) *pb.File {
+	result := &pb.File{
+		Id:               f.ID,
+		DeliveryId:       f.DeliveryID,
+		ProductId:        f.ProductID,
+		SourceId:         f.SourceID,
+		FileName:         f.FileName,
+		FileSize:         f.FileSize,
+		ExpectedChecksum: f.ExpectedChecksum,
+		Skipped:          f.Skipped,
+		Status:           f.Status,
+		ErrorMessage:     f.ErrorMessage,
+	}
+	if f.ReleasedAt != nil {
+		result.ReleasedAt = timestamppb.New(*f.ReleasedAt)
+	}
+	return result
+}
+
+func convertEvent(e *hooks.Event) *pb.Event {
+	result := &pb.Event{
+		Type:      e.Type,
+		Timestamp: timestamppb.New(e.Timestamp),
+		Source:    e.Source,
+	}
+	if e.Product != nil {
+		result.Product = &pb.EventProduct{Id: e.Product.ID, Name: e.Product.Name}
+	}
+	if e.Delivery != nil {
+		result.Delivery = &pb.EventDelivery{Id: e.Delivery.ID, Name: e.Delivery.Name}
+	}
+	if e.File != nil {
+		result.File = &pb.EventFile{
+			Id:       e.File.ID,
+			Name:     e.File.Name,
+			Size:     e.File.Size,
+			Checksum: e.File.Checksum,
+			Path:     e.File.Path,
+		}
+	}
+	for _, a := range e.Alerts {
+		result.Alerts = append(result.Alerts, &pb.EventAlert{Type: a.Type, Message: a.Message, Severity: a.Severity})
+	}
+	if e.Error != nil {
+		result.Error = &pb.EventError{Code: e.Error.Code, Message: e.Error.Message}
+	}
+	return result
+}
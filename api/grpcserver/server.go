@@ -0,0 +1,230 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/patent-dev/bulk-file-loader/api/generated/bulkloaderv1"
+	"github.com/patent-dev/bulk-file-loader/internal/auth"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/downloader"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+)
+
+const (
+	apiKeyMetadata  = "x-api-key"
+	defaultLimit    = 50
+	maxLimit        = 200
+	defaultInterval = time.Second
+	subscribeBuffer = 64
+)
+
+// Server implements the BulkLoader gRPC service
+type Server struct {
+	pb.UnimplementedBulkLoaderServer
+
+	db         *database.DB
+	auth       *auth.Service
+	downloader *downloader.Downloader
+	hooks      *hooks.Manager
+}
+
+// New creates a new gRPC service implementation
+func New(db *database.DB, authService *auth.Service, dl *downloader.Downloader, hooksManager *hooks.Manager) *Server {
+	return &Server{
+		db:         db,
+		auth:       authService,
+		downloader: dl,
+		hooks:      hooksManager,
+	}
+}
+
+// NewGRPCServer creates a grpc.Server with API key authentication and the
+// BulkLoader service registered
+func (s *Server) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.UnaryInterceptor(s.unaryAuth),
+		grpc.StreamInterceptor(s.streamAuth),
+	)
+	server := grpc.NewServer(opts...)
+	pb.RegisterBulkLoaderServer(server, s)
+	return server
+}
+
+// authenticate checks the API key grants the scope the method needs:
+// Download triggers downloads, the other methods read
+func (s *Server) authenticate(ctx context.Context, fullMethod string) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing metadata")
+	}
+	keys := md.Get(apiKeyMetadata)
+	if len(keys) == 0 {
+		return status.Error(codes.Unauthenticated, "invalid API key")
+	}
+	scope := auth.ScopeRead
+	if fullMethod == pb.BulkLoader_Download_FullMethodName {
+		scope = auth.ScopeDownloads
+	}
+	switch err := s.auth.AuthenticateAPIKey(keys[0], scope); {
+	case errors.Is(err, auth.ErrReadOnly):
+		return status.Error(codes.PermissionDenied, "server is in read-only mode")
+	case errors.Is(err, auth.ErrMissingScope):
+		return status.Error(codes.PermissionDenied, "API key lacks the "+scope+" scope")
+	case err != nil:
+		return status.Error(codes.Unauthenticated, "invalid API key")
+	}
+	return nil
+}
+
+func (s *Server) unaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.authenticate(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamAuth(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authenticate(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// ListFiles returns files matching the request filters
+func (s *Server) ListFiles(_ context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
+	query := s.db.DB.Model(&database.File{}).Where("archived_at IS NULL")
+	if req.SourceId != "" {
+		query = query.Where("source_id = ?", req.SourceId)
+	}
+	if req.ProductId != "" {
+		query = query.Where("product_id = ?", req.ProductId)
+	}
+	if req.Status != "" {
+		query = query.Where("status = ?", req.Status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	var files []database.File
+	if err := query.Offset(int(req.Offset)).Limit(limit).Order("created_at DESC").Find(&files).Error; err != nil {
+		return nil, status.Error(codes.Internal, "failed to list files")
+	}
+
+	result := make([]*pb.File, 0, len(files))
+	for i := range files {
+		result = append(result, convertFile(&files[i]))
+	}
+
+	return &pb.ListFilesResponse{Files: result, Total: total}, nil
+}
+
+// Download starts a background download of the requested file
+func (s *Server) Download(_ context.Context, req *pb.DownloadRequest) (*pb.DownloadResponse, error) {
+	var count int64
+	s.db.Model(&database.File{}).Where("id = ?", req.FileId).Count(&count)
+	if count == 0 {
+		return nil, status.Error(codes.NotFound, "file not found")
+	}
+	if s.downloader.IsActive(req.FileId) {
+		return nil, status.Error(codes.AlreadyExists, downloader.ErrDownloadInProgress.Error())
+	}
+
+	go func(fileID string) {
+		if err := s.downloader.Download(context.Background(), fileID); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Download failed", "fileID", fileID, "error", err)
+		}
+	}(req.FileId)
+
+	return &pb.DownloadResponse{FileId: req.FileId}, nil
+}
+
+// StreamProgress sends the progress of active downloads at a fixed interval
+func (s *Server) StreamProgress(req *pb.StreamProgressRequest, stream grpc.ServerStreamingServer[pb.ProgressUpdate]) error {
+	interval := defaultInterval
+	if req.IntervalMs > 0 {
+		interval = time.Duration(req.IntervalMs) * time.Millisecond
+	}
+
+	filter := make(map[string]bool, len(req.FileIds))
+	for _, id := range req.FileIds {
+		filter[id] = true
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+			update := &pb.ProgressUpdate{}
+			for _, p := range s.downloader.ActiveDownloads() {
+				if len(filter) > 0 && !filter[p.FileID] {
+					continue
+				}
+				update.Downloads = append(update.Downloads, &pb.DownloadProgress{
+					FileId:       p.FileID,
+					FileName:     p.FileName,
+					BytesWritten: p.BytesWritten,
+					TotalBytes:   p.TotalBytes,
+					Speed:        p.Speed,
+					StartedAt:    timestamppb.New(p.StartedAt),
+				})
+			}
+			if err := stream.Send(update); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Subscribe streams hook events to the client until it disconnects
+func (s *Server) Subscribe(req *pb.SubscribeRequest, stream grpc.ServerStreamingServer[pb.Event]) error {
+	types := make(map[string]bool, len(req.EventTypes))
+	for _, t := range req.EventTypes {
+		if t == "*" {
+			types = nil
+			break
+		}
+		types[t] = true
+	}
+
+	events, unsubscribe := s.hooks.Subscribe(subscribeBuffer)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if len(types) > 0 && !types[event.Type] {
+				continue
+			}
+			if err := stream.Send(convertEvent(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
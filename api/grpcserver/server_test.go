@@ -0,0 +1,199 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	pb "github.com/patent-dev/bulk-file-loader/api/generated/bulkloaderv1"
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/auth"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/downloader"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+const testPassphrase = "testpassphrase123"
+
+func setupTestServer(t *testing.T) (pb.BulkLoaderClient, *database.DB, *hooks.Manager) {
+	t.Helper()
+
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gormDB.AutoMigrate(
+		&database.Source{},
+		&database.Product{},
+		&database.Delivery{},
+		&database.File{},
+		&database.DownloadEntry{},
+		&database.Webhook{},
+		&database.Setting{},
+		&database.APIKey{},
+		&database.AuditEntry{},
+	)
+
+	db := &database.DB{DB: gormDB}
+	cfg := &config.Config{
+		DataDir:         t.TempDir(),
+		MaxConcurrent:   2,
+		DownloadTimeout: 60,
+		Passphrase:      testPassphrase,
+	}
+
+	authService := auth.New(db, cfg)
+	registry := sources.NewRegistry(db, cfg)
+	hooksManager := hooks.New(db)
+	dl := downloader.New(db, registry, hooksManager, cfg)
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := New(db, authService, dl, hooksManager).NewGRPCServer()
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewBulkLoaderClient(conn), db, hooksManager
+}
+
+func authContext() context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), apiKeyMetadata, testPassphrase)
+}
+
+func TestUnauthenticated(t *testing.T) {
+	client, _, _ := setupTestServer(t)
+
+	_, err := client.ListFiles(context.Background(), &pb.ListFilesRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ListFiles without API key code = %v, want Unauthenticated", status.Code(err))
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), apiKeyMetadata, "wrong")
+	_, err = client.ListFiles(ctx, &pb.ListFilesRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ListFiles with wrong API key code = %v, want Unauthenticated", status.Code(err))
+	}
+}
+
+func TestStandaloneAPIKey(t *testing.T) {
+	client, db, _ := setupTestServer(t)
+
+	key, _, err := auth.New(db, &config.Config{Passphrase: testPassphrase}).CreateAPIKey("CI", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), apiKeyMetadata, key)
+	if _, err := client.ListFiles(ctx, &pb.ListFilesRequest{}); err != nil {
+		t.Errorf("ListFiles with standalone API key: %v", err)
+	}
+
+	key, _, err = auth.New(db, &config.Config{Passphrase: testPassphrase}).CreateAPIKey("dashboard", []string{auth.ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = metadata.AppendToOutgoingContext(context.Background(), apiKeyMetadata, key)
+	if _, err := client.ListFiles(ctx, &pb.ListFilesRequest{}); err != nil {
+		t.Errorf("ListFiles with read-only API key: %v", err)
+	}
+	_, err = client.Download(ctx, &pb.DownloadRequest{FileId: "missing"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Download with read-only API key: err = %v, want PermissionDenied", err)
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	client, db, _ := setupTestServer(t)
+
+	db.Create(&database.File{ID: "f1", DeliveryID: "d1", ProductID: "p1", SourceID: "s1", FileName: "a.zip", FileSize: 100})
+	db.Create(&database.File{ID: "f2", DeliveryID: "d1", ProductID: "p2", SourceID: "s1", FileName: "b.zip", Skipped: true, Status: database.FileStatusSkipped})
+
+	resp, err := client.ListFiles(authContext(), &pb.ListFilesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 2 || len(resp.Files) != 2 {
+		t.Errorf("ListFiles returned %d files (total %d), want 2", len(resp.Files), resp.Total)
+	}
+
+	resp, err = client.ListFiles(authContext(), &pb.ListFilesRequest{ProductId: "p1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Files) != 1 || resp.Files[0].Id != "f1" {
+		t.Errorf("ListFiles by product = %v, want [f1]", resp.Files)
+	}
+	if resp.Files[0].Status != database.FileStatusAvailable {
+		t.Errorf("Status = %q, want %q", resp.Files[0].Status, database.FileStatusAvailable)
+	}
+
+	resp, err = client.ListFiles(authContext(), &pb.ListFilesRequest{Status: database.FileStatusSkipped})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Files) != 1 || resp.Files[0].Id != "f2" {
+		t.Errorf("ListFiles by status = %v, want [f2]", resp.Files)
+	}
+}
+
+func TestDownloadNotFound(t *testing.T) {
+	client, _, _ := setupTestServer(t)
+
+	_, err := client.Download(authContext(), &pb.DownloadRequest{FileId: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Download code = %v, want NotFound", status.Code(err))
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	client, _, hooksManager := setupTestServer(t)
+
+	ctx, cancel := context.WithTimeout(authContext(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Subscribe(ctx, &pb.SubscribeRequest{EventTypes: []string{hooks.EventSyncCompleted}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep emitting until the subscription is registered on the server side
+	go func() {
+		for ctx.Err() == nil {
+			hooksManager.Emit(context.Background(), hooks.NewEvent(hooks.EventSyncFailed, "s1"))
+			hooksManager.Emit(context.Background(), hooks.NewEvent(hooks.EventSyncCompleted, "s1").WithProduct("p1", "Product"))
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != hooks.EventSyncCompleted {
+		t.Errorf("Event type = %q, want %q", event.Type, hooks.EventSyncCompleted)
+	}
+	if event.Product == nil || event.Product.Id != "p1" {
+		t.Errorf("Event product = %v, want p1", event.Product)
+	}
+}
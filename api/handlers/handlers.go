@@ -1,21 +1,48 @@
 package handlers
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	openapi_types "github.com/oapi-codegen/runtime/types"
+
 	"github.com/patent-dev/bulk-file-loader/api/generated"
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/audit"
 	"github.com/patent-dev/bulk-file-loader/internal/auth"
+	"github.com/patent-dev/bulk-file-loader/internal/blackout"
+	"github.com/patent-dev/bulk-file-loader/internal/buildinfo"
 	"github.com/patent-dev/bulk-file-loader/internal/database"
 	"github.com/patent-dev/bulk-file-loader/internal/downloader"
 	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+	"github.com/patent-dev/bulk-file-loader/internal/nats"
+	"github.com/patent-dev/bulk-file-loader/internal/oidc"
+	"github.com/patent-dev/bulk-file-loader/internal/pipeline"
+	"github.com/patent-dev/bulk-file-loader/internal/reload"
 	"github.com/patent-dev/bulk-file-loader/internal/scheduler"
 	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/standby"
+	"github.com/patent-dev/bulk-file-loader/internal/telemetry"
+	"github.com/patent-dev/bulk-file-loader/internal/validate"
 )
 
 var startTime = time.Now()
@@ -27,6 +54,25 @@ type Handler struct {
 	downloader *downloader.Downloader
 	scheduler  *scheduler.Scheduler
 	hooks      *hooks.Manager
+	buildInfo  buildinfo.Info
+	telemetry  *telemetry.Reporter
+	reloader   *reload.Reloader
+	standby    *standby.Replica
+	audit      *audit.Log
+	// importRoots are the directories ImportFiles may import from and
+	// GetFileContent may serve imported files from
+	importRoots []string
+	// restoreLimit is the largest backup RestoreBackup reads, compressed
+	// and decompressed
+	restoreLimit int64
+
+	// Progress of full source syncs, by source ID
+	sourceSyncsMu sync.Mutex
+	sourceSyncs   map[string]*generated.SourceSync
+
+	// Progress of the running or last import
+	importMu  sync.Mutex
+	importJob *generated.ImportJob
 }
 
 func New(
@@ -44,9 +90,50 @@ func New(
 		downloader: dl,
 		scheduler:  sched,
 		hooks:      hooksManager,
+
+		restoreLimit: 1 << 30,
+		sourceSyncs:  make(map[string]*generated.SourceSync),
 	}
 }
 
+// SetBuildInfo sets the build information reported by GetBuildInfo
+func (h *Handler) SetBuildInfo(info buildinfo.Info) {
+	h.buildInfo = info
+}
+
+// SetTelemetry sets the reporter whose payload GetTelemetryPreview shows
+func (h *Handler) SetTelemetry(reporter *telemetry.Reporter) {
+	h.telemetry = reporter
+}
+
+// SetReloader sets the reloader used by ReloadConfig
+func (h *Handler) SetReloader(reloader *reload.Reloader) {
+	h.reloader = reloader
+}
+
+// SetStandby sets the replica reported by GetStandbyStatus and promoted by
+// PromoteStandby
+func (h *Handler) SetStandby(replica *standby.Replica) {
+	h.standby = replica
+}
+
+// SetAudit sets the credential audit log listed by ListCredentialAudit and
+// written by GetState
+func (h *Handler) SetAudit(log *audit.Log) {
+	h.audit = log
+}
+
+// SetImportRoots sets the directories files may be imported from through the
+// API; without any, ImportFiles is refused
+func (h *Handler) SetImportRoots(roots []string) {
+	h.importRoots = roots
+}
+
+// SetRestoreLimit sets the largest backup, in bytes, RestoreBackup accepts
+func (h *Handler) SetRestoreLimit(limit int64) {
+	h.restoreLimit = limit
+}
+
 // Helper functions
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -59,8 +146,18 @@ func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, generated.Error{Message: message})
 }
 
+// maxRequestBody limits the JSON bodies of API requests
+const maxRequestBody = 4 << 20
+
 func decodeJSON(r *http.Request, v interface{}) error {
-	return json.NewDecoder(r.Body).Decode(v)
+	return json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestBody)).Decode(v)
+}
+
+// clearWriteDeadline lifts the server's WriteTimeout for a response streaming
+// bulk files, which takes as long as the client needs to receive them
+func clearWriteDeadline(w http.ResponseWriter) {
+	// Writers without deadlines, like test recorders, have nothing to clear
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
 }
 
 // Auth handlers
@@ -73,6 +170,9 @@ func (h *Handler) GetAuthStatus(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, generated.AuthStatus{
 		Configured:    h.auth.IsConfigured(),
 		Authenticated: authenticated,
+		Oidc:          h.auth.OIDCEnabled(),
+		LoginDisabled: h.auth.LoginDisabled(),
+		ReadOnly:      h.auth.ReadOnly(),
 	})
 }
 
@@ -110,6 +210,10 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.auth.Login(w, req.Passphrase); err != nil {
+		if errors.Is(err, auth.ErrLoginDisabled) {
+			writeError(w, http.StatusForbidden, "Passphrase login is disabled")
+			return
+		}
 		writeError(w, http.StatusUnauthorized, "Invalid passphrase")
 		return
 	}
@@ -118,10 +222,122 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
-	h.auth.Logout(w)
+	h.auth.Logout(w, r)
 	w.WriteHeader(http.StatusOK)
 }
 
+// OidcLogin redirects the browser to the OIDC provider
+func (h *Handler) OidcLogin(w http.ResponseWriter, r *http.Request) {
+	if !h.auth.OIDCEnabled() {
+		writeError(w, http.StatusNotFound, "OIDC login not configured")
+		return
+	}
+	authURL, err := h.auth.StartOIDCLogin(w, r)
+	if err != nil {
+		slog.Error("Failed to start OIDC login", "error", err)
+		writeError(w, http.StatusBadGateway, "OIDC provider unavailable")
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OidcCallback completes an OIDC login and sends the browser back to the UI,
+// which shows login_error if it failed
+func (h *Handler) OidcCallback(w http.ResponseWriter, r *http.Request, params generated.OidcCallbackParams) {
+	if err := h.auth.FinishOIDCLogin(w, r); err != nil {
+		slog.Warn("OIDC login failed", "error", err)
+		message := "Login failed"
+		switch {
+		case errors.Is(err, auth.ErrNoRole):
+			message = "Your account has no role for this application"
+		case errors.Is(err, oidc.ErrUnknownState):
+			message = "Login expired, please try again"
+		}
+		http.Redirect(w, r, "/?login_error="+url.QueryEscape(message), http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// API key handlers. Keys can't manage keys, so a leaked key can't be used to
+// create others or to revoke the owner's.
+
+func (h *Handler) ListApiKeys(w http.ResponseWriter, r *http.Request) {
+	if auth.APIKeyFromContext(r.Context()) != nil {
+		writeError(w, http.StatusForbidden, "API keys cannot manage API keys")
+		return
+	}
+	keys, err := h.auth.ListAPIKeys()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list API keys")
+		return
+	}
+
+	result := make([]generated.ApiKey, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, convertAPIKey(k))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) CreateApiKey(w http.ResponseWriter, r *http.Request) {
+	if auth.APIKeyFromContext(r.Context()) != nil {
+		writeError(w, http.StatusForbidden, "API keys cannot manage API keys")
+		return
+	}
+	var req generated.CreateApiKeyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	var scopes []string
+	if req.Scopes != nil {
+		scopes = *req.Scopes
+	}
+	if err := auth.ValidateScopes(scopes); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key, record, err := h.auth.CreateAPIKey(req.Name, scopes)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+	created := generated.CreatedApiKey{
+		Id:        int(record.ID),
+		Name:      record.Name,
+		Prefix:    record.Prefix,
+		Key:       key,
+		CreatedAt: record.CreatedAt,
+	}
+	if len(scopes) > 0 {
+		created.Scopes = &scopes
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) RevokeApiKey(w http.ResponseWriter, r *http.Request, id int) {
+	if auth.APIKeyFromContext(r.Context()) != nil {
+		writeError(w, http.StatusForbidden, "API keys cannot manage API keys")
+		return
+	}
+	if err := h.auth.RevokeAPIKey(uint(id)); err != nil {
+		if errors.Is(err, auth.ErrAPIKeyNotFound) {
+			writeError(w, http.StatusNotFound, "API key not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Source handlers
 
 func (h *Handler) ListSources(w http.ResponseWriter, r *http.Request) {
@@ -133,24 +349,7 @@ func (h *Handler) ListSources(w http.ResponseWriter, r *http.Request) {
 
 	result := make([]generated.Source, 0, len(sourceInfos))
 	for _, si := range sourceInfos {
-		source := generated.Source{
-			Id:             si.ID,
-			Name:           si.Name,
-			Enabled:        si.Enabled,
-			HasCredentials: si.HasCredentials,
-			LastSyncAt:     si.LastSyncAt,
-		}
-		for _, cf := range si.CredentialFields {
-			helpText := cf.HelpText
-			source.CredentialFields = append(source.CredentialFields, generated.CredentialField{
-				Key:      cf.Key,
-				Label:    cf.Label,
-				Type:     generated.CredentialFieldType(cf.Type),
-				Required: cf.Required,
-				HelpText: &helpText,
-			})
-		}
-		result = append(result, source)
+		result = append(result, convertSource(si))
 	}
 
 	writeJSON(w, http.StatusOK, result)
@@ -163,25 +362,62 @@ func (h *Handler) GetSource(w http.ResponseWriter, r *http.Request, id string) {
 		return
 	}
 
+	writeJSON(w, http.StatusOK, convertSource(*si))
+}
+
+func convertSource(si sources.SourceInfo) generated.Source {
 	source := generated.Source{
 		Id:             si.ID,
 		Name:           si.Name,
 		Enabled:        si.Enabled,
 		HasCredentials: si.HasCredentials,
 		LastSyncAt:     si.LastSyncAt,
+
+		CredentialsExpireAt: si.CredentialsExpireAt,
 	}
+	setSourceOptions(&source, si)
 	for _, cf := range si.CredentialFields {
-		helpText := cf.HelpText
-		source.CredentialFields = append(source.CredentialFields, generated.CredentialField{
-			Key:      cf.Key,
-			Label:    cf.Label,
-			Type:     generated.CredentialFieldType(cf.Type),
-			Required: cf.Required,
-			HelpText: &helpText,
-		})
+		source.CredentialFields = append(source.CredentialFields, convertCredentialField(cf))
+	}
+	return source
+}
+
+// setSourceOptions adds the base URL, the extra header names and the default
+// schedule to a source
+func setSourceOptions(source *generated.Source, si sources.SourceInfo) {
+	if si.DefaultSchedule != "" {
+		source.DefaultSchedule = &si.DefaultSchedule
+	}
+	if si.BaseURL != "" {
+		source.BaseUrl = &si.BaseURL
 	}
+	if len(si.HeaderNames) > 0 {
+		source.HeaderNames = &si.HeaderNames
+	}
+}
 
-	writeJSON(w, http.StatusOK, source)
+func convertCredentialField(cf sources.CredentialField) generated.CredentialField {
+	helpText := cf.HelpText
+	field := generated.CredentialField{
+		Key:      cf.Key,
+		Label:    cf.Label,
+		Type:     generated.CredentialFieldType(cf.Type),
+		Required: cf.Required,
+		HelpText: &helpText,
+	}
+	if cf.ExpiresAfterDays > 0 {
+		field.ExpiresAfterDays = &cf.ExpiresAfterDays
+	}
+	if cf.OAuth2 != nil {
+		field.Oauth2 = &generated.OAuth2Config{
+			TokenUrl:    cf.OAuth2.TokenURL,
+			ClientIdKey: cf.OAuth2.ClientIDKey,
+		}
+		if len(cf.OAuth2.Scopes) > 0 {
+			field.Oauth2.Scopes = &cf.OAuth2.Scopes
+		}
+	}
+	return field
 }
 
 func (h *Handler) UpdateSource(w http.ResponseWriter, r *http.Request, id string) {
@@ -195,12 +431,33 @@ func (h *Handler) UpdateSource(w http.ResponseWriter, r *http.Request, id string
 	if req.Enabled != nil {
 		enabled = *req.Enabled
 	}
+	if req.DefaultSchedule != nil && *req.DefaultSchedule != "" {
+		if err := scheduler.ValidateSchedule(*req.DefaultSchedule); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid default schedule: "+err.Error())
+			return
+		}
+	}
 
 	var creds map[string]string
 	if req.Credentials != nil {
 		creds = *req.Credentials
 	}
 
+	// Options go first so credentials are validated against the new base URL
+	if req.Options != nil {
+		var opts sources.Options
+		if req.Options.BaseUrl != nil {
+			opts.BaseURL = *req.Options.BaseUrl
+		}
+		if req.Options.Headers != nil {
+			opts.Headers = *req.Options.Headers
+		}
+		if err := h.registry.UpdateOptions(id, opts, h.auth); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
 	// Validate credentials before enabling with new credentials
 	if enabled && creds != nil {
 		adapter, ok := h.registry.Get(id)
@@ -214,42 +471,233 @@ func (h *Handler) UpdateSource(w http.ResponseWriter, r *http.Request, id string
 		}
 	}
 
-	if err := h.registry.UpdateSource(id, enabled, creds, h.auth); err != nil {
+	if err := h.registry.UpdateSource(r.Context(), id, enabled, creds, h.auth); err != nil {
 		slog.Error("Failed to update source", "source", id, "error", err)
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if req.CredentialsExpireAt != nil {
+		if err := h.registry.SetCredentialsExpiry(id, req.CredentialsExpireAt); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.DefaultSchedule != nil {
+		if err := h.registry.SetDefaultSchedule(id, *req.DefaultSchedule); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 
 	// When enabling, sync products synchronously so they appear immediately
 	// Files are synced in background since that takes longer
 	if enabled {
-		h.syncProductsOnly(id)
-		go h.syncProductFiles(id)
+		if _, started := h.startSourceSync(id); started && h.syncProductsOnly(id) {
+			go h.syncProductFiles(id)
+		}
 	}
 
 	h.GetSource(w, r, id)
 }
 
-// syncProductsOnly fetches and saves products synchronously (no files)
-func (h *Handler) syncProductsOnly(sourceID string) {
+func (h *Handler) SyncSource(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := h.registry.Get(id); !ok {
+		writeError(w, http.StatusNotFound, "Source not found")
+		return
+	}
+
+	status, started := h.startSourceSync(id)
+	if !started {
+		writeError(w, http.StatusConflict, "Source sync already running")
+		return
+	}
+	go func() {
+		if h.syncProductsOnly(id) {
+			h.syncProductFiles(id)
+		}
+	}()
+
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func (h *Handler) GetSourceSync(w http.ResponseWriter, r *http.Request, id string) {
+	h.sourceSyncsMu.Lock()
+	status, ok := h.sourceSyncs[id]
+	var result generated.SourceSync
+	if ok {
+		result = *status
+	}
+	h.sourceSyncsMu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "No sync for this source")
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) GetSourceSyncStatus(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := h.registry.Get(id); !ok {
+		writeError(w, http.StatusNotFound, "Source not found")
+		return
+	}
+
+	result := generated.SourceSyncProgress{
+		SourceId:     id,
+		ProductSyncs: []generated.ProductSyncProgress{},
+	}
+	h.sourceSyncsMu.Lock()
+	if status, ok := h.sourceSyncs[id]; ok {
+		sourceSync := *status
+		result.SourceSync = &sourceSync
+	}
+	h.sourceSyncsMu.Unlock()
+
+	for _, p := range h.scheduler.ActiveSyncs() {
+		if p.SourceID == id {
+			result.ProductSyncs = append(result.ProductSyncs, convertSyncProgress(p))
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// syncProgress returns the progress of every source with a running full sync
+// or product sync, ordered by source ID
+func (h *Handler) syncProgress() []generated.SourceSyncProgress {
+	bySource := make(map[string]*generated.SourceSyncProgress)
+	progress := func(sourceID string) *generated.SourceSyncProgress {
+		p, ok := bySource[sourceID]
+		if !ok {
+			p = &generated.SourceSyncProgress{SourceId: sourceID, ProductSyncs: []generated.ProductSyncProgress{}}
+			bySource[sourceID] = p
+		}
+		return p
+	}
+
+	h.sourceSyncsMu.Lock()
+	for id, status := range h.sourceSyncs {
+		if status.Status == generated.SourceSyncStatusRunning {
+			sourceSync := *status
+			progress(id).SourceSync = &sourceSync
+		}
+	}
+	h.sourceSyncsMu.Unlock()
+
+	for _, p := range h.scheduler.ActiveSyncs() {
+		sp := progress(p.SourceID)
+		sp.ProductSyncs = append(sp.ProductSyncs, convertSyncProgress(p))
+	}
+
+	result := make([]generated.SourceSyncProgress, 0, len(bySource))
+	for _, p := range bySource {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].SourceId < result[j].SourceId })
+	return result
+}
+
+func convertSyncProgress(p scheduler.SyncProgress) generated.ProductSyncProgress {
+	return generated.ProductSyncProgress{
+		ProductId:           p.ProductID,
+		Trigger:             p.Trigger,
+		DeliveriesTotal:     p.DeliveriesTotal,
+		DeliveriesProcessed: p.DeliveriesProcessed,
+		FilesDiscovered:     p.FilesDiscovered,
+		StartedAt:           p.StartedAt,
+	}
+}
+
+// startSourceSync records the start of a full source sync. It returns false
+// with the running sync if one is already in progress.
+func (h *Handler) startSourceSync(sourceID string) (generated.SourceSync, bool) {
+	h.sourceSyncsMu.Lock()
+	defer h.sourceSyncsMu.Unlock()
+
+	if status, ok := h.sourceSyncs[sourceID]; ok && status.Status == generated.SourceSyncStatusRunning {
+		return *status, false
+	}
+	status := &generated.SourceSync{
+		SourceId:  sourceID,
+		Status:    generated.SourceSyncStatusRunning,
+		Phase:     generated.Products,
+		StartedAt: time.Now(),
+	}
+	h.sourceSyncs[sourceID] = status
+	return *status, true
+}
+
+// updateSourceSync applies update to the progress of a source sync
+func (h *Handler) updateSourceSync(sourceID string, update func(*generated.SourceSync)) {
+	h.sourceSyncsMu.Lock()
+	defer h.sourceSyncsMu.Unlock()
+
+	if status, ok := h.sourceSyncs[sourceID]; ok {
+		update(status)
+	}
+}
+
+// finishSourceSync marks a source sync as completed, or failed if err is set
+func (h *Handler) finishSourceSync(sourceID string, err error) {
+	h.updateSourceSync(sourceID, func(s *generated.SourceSync) {
+		now := time.Now()
+		s.CompletedAt = &now
+		s.Status = generated.SourceSyncStatusCompleted
+		if err != nil {
+			msg := err.Error()
+			s.ErrorMessage = &msg
+			s.Status = generated.SourceSyncStatusFailed
+		}
+	})
+}
+
+// syncProductsOnly fetches and saves products synchronously (no files).
+// It reports whether the file sync should follow.
+func (h *Handler) syncProductsOnly(sourceID string) bool {
 	ctx := context.Background()
 	slog.Info("Syncing products", "source", sourceID)
 
 	adapter, ok := h.registry.Get(sourceID)
 	if !ok {
 		slog.Error("Adapter not found", "source", sourceID)
-		return
+		h.finishSourceSync(sourceID, errors.New("adapter not found"))
+		return false
 	}
 
 	products, err := adapter.FetchProducts(ctx)
 	if err != nil {
 		slog.Error("Failed to fetch products", "source", sourceID, "error", err)
-		return
+		h.finishSourceSync(sourceID, err)
+		return false
+	}
+
+	var defaultSchedule string
+	if si, err := h.registry.GetSource(sourceID); err == nil {
+		defaultSchedule = si.DefaultSchedule
 	}
 
 	slog.Info("Found products", "source", sourceID, "count", len(products))
 	for _, p := range products {
+		// Product IDs end up in download paths
+		if err := sources.CheckName(p.ExternalID); err != nil {
+			slog.Warn("Skipping product", "source", sourceID, "error", err)
+			continue
+		}
 		productID := fmt.Sprintf("%s:%s", sourceID, p.ExternalID)
+
+		// Known products keep their schedule and auto-download settings, and
+		// deleted ones stay deleted
+		var existing database.Product
+		if err := h.db.Unscoped().First(&existing, "id = ?", productID).Error; err == nil {
+			err := h.db.Model(&existing).Updates(map[string]interface{}{
+				"name":        p.Name,
+				"description": p.Description,
+			}).Error
+			if err != nil {
+				slog.Error("Failed to update product", "productID", productID, "error", err)
+			}
+			continue
+		}
+
 		product := database.Product{
 			ID:               productID,
 			SourceID:         sourceID,
@@ -258,10 +706,14 @@ func (h *Handler) syncProductsOnly(sourceID string) {
 			Description:      p.Description,
 			CheckWindowStart: p.CheckSchedule,
 		}
-		if err := h.db.Save(&product).Error; err != nil {
+		if defaultSchedule != "" {
+			product.CheckWindowStart = defaultSchedule
+		}
+		if err := h.db.Create(&product).Error; err != nil {
 			slog.Error("Failed to save product", "productID", productID, "error", err)
 		}
 	}
+	return true
 }
 
 // syncProductFiles syncs deliveries and files for all products of a source (background)
@@ -271,21 +723,33 @@ func (h *Handler) syncProductFiles(sourceID string) {
 
 	adapter, ok := h.registry.Get(sourceID)
 	if !ok {
+		h.finishSourceSync(sourceID, errors.New("adapter not found"))
 		return
 	}
 
 	var products []database.Product
 	if err := h.db.Where("source_id = ?", sourceID).Find(&products).Error; err != nil {
 		slog.Error("Failed to get products", "source", sourceID, "error", err)
+		h.finishSourceSync(sourceID, err)
 		return
 	}
+	h.updateSourceSync(sourceID, func(s *generated.SourceSync) {
+		s.Phase = generated.Files
+		s.ProductsTotal = len(products)
+	})
 
 	for _, p := range products {
 		h.syncProductDeliveriesAndFiles(ctx, adapter, sourceID, p.ID, p.ExternalID)
+		h.updateSourceSync(sourceID, func(s *generated.SourceSync) {
+			s.ProductsSynced++
+		})
 	}
+	h.finishSourceSync(sourceID, nil)
 	slog.Info("File sync completed", "source", sourceID)
 }
 
+// syncProductDeliveriesAndFiles saves the deliveries and files of a product,
+// counting each delivery towards the progress of the source sync
 func (h *Handler) syncProductDeliveriesAndFiles(ctx context.Context, adapter sources.Adapter, sourceID, productID, externalProductID string) {
 	deliveries, err := adapter.FetchDeliveries(ctx, externalProductID)
 	if err != nil {
@@ -295,56 +759,84 @@ func (h *Handler) syncProductDeliveriesAndFiles(ctx context.Context, adapter sou
 
 	totalFiles := 0
 	for _, d := range deliveries {
-		deliveryID := fmt.Sprintf("%s:%s", productID, d.ExternalID)
-		delivery := database.Delivery{
-			ID:          deliveryID,
-			ProductID:   productID,
-			ExternalID:  d.ExternalID,
-			Name:        d.Name,
-			PublishedAt: &d.PublishedAt,
-			ExpiresAt:   d.ExpiresAt,
-		}
-		if err := h.db.Save(&delivery).Error; err != nil {
-			slog.Error("Failed to save delivery", "deliveryID", deliveryID, "error", err)
-			continue
-		}
+		files := h.syncDeliveryFiles(ctx, adapter, sourceID, productID, externalProductID, d)
+		totalFiles += files
+		h.updateSourceSync(sourceID, func(s *generated.SourceSync) {
+			s.DeliveriesSynced++
+			s.FilesSynced += files
+		})
+	}
+	slog.Debug("Synced files", "product", productID, "count", totalFiles)
+}
 
-		files, err := adapter.FetchFiles(ctx, externalProductID, d.ExternalID)
-		if err != nil {
-			slog.Error("Failed to fetch files", "deliveryID", deliveryID, "error", err)
+// syncDeliveryFiles saves a delivery and its files and returns the number of
+// files saved
+func (h *Handler) syncDeliveryFiles(ctx context.Context, adapter sources.Adapter, sourceID, productID, externalProductID string, d sources.DeliveryInfo) int {
+	deliveryID := fmt.Sprintf("%s:%s", productID, d.ExternalID)
+	delivery := database.Delivery{
+		ID:          deliveryID,
+		ProductID:   productID,
+		ExternalID:  d.ExternalID,
+		Name:        d.Name,
+		PublishedAt: &d.PublishedAt,
+		ExpiresAt:   d.ExpiresAt,
+	}
+	// Saving would undelete a deleted delivery or file. The archive flag and
+	// the file status are omitted so saving keeps them.
+	if h.db.IsDeleted(&database.Delivery{}, deliveryID) {
+		return 0
+	}
+	if err := h.db.Omit("archived_at").Save(&delivery).Error; err != nil {
+		slog.Error("Failed to save delivery", "deliveryID", deliveryID, "error", err)
+		return 0
+	}
+
+	files, err := adapter.FetchFiles(ctx, externalProductID, d.ExternalID)
+	if err != nil {
+		slog.Error("Failed to fetch files", "deliveryID", deliveryID, "error", err)
+		return 0
+	}
+
+	saved := 0
+	for _, f := range files {
+		fileID := fmt.Sprintf("%s:%s", deliveryID, f.ExternalID)
+		if h.db.IsDeleted(&database.File{}, fileID) {
 			continue
 		}
-
-		for _, f := range files {
-			fileID := fmt.Sprintf("%s:%s", deliveryID, f.ExternalID)
-			file := database.File{
-				ID:                fileID,
-				DeliveryID:        deliveryID,
-				ProductID:         productID,
-				SourceID:          sourceID,
-				ExternalID:        f.ExternalID,
-				FileName:          f.FileName,
-				FileSize:          f.FileSize,
-				ExpectedChecksum:  f.Checksum,
-				ChecksumAlgorithm: f.ChecksumAlgorithm,
-				DownloadURI:       f.DownloadURI,
-				ReleasedAt:        &f.ReleasedAt,
-			}
-			if err := h.db.Save(&file).Error; err != nil {
-				slog.Error("Failed to save file", "fileID", fileID, "error", err)
-				continue
-			}
-			totalFiles++
+		file := database.File{
+			ID:                fileID,
+			DeliveryID:        deliveryID,
+			ProductID:         productID,
+			SourceID:          sourceID,
+			ExternalID:        f.ExternalID,
+			FileName:          f.FileName,
+			FileSize:          f.FileSize,
+			ExpectedChecksum:  f.Checksum,
+			ChecksumAlgorithm: f.ChecksumAlgorithm,
+			DownloadURI:       f.DownloadURI,
+			ReleasedAt:        &f.ReleasedAt,
+		}
+		if err := h.db.Omit("archived_at", "expired", "status", "error_message").Save(&file).Error; err != nil {
+			slog.Error("Failed to save file", "fileID", fileID, "error", err)
+			continue
 		}
+		saved++
 	}
-	slog.Debug("Synced files", "product", productID, "count", totalFiles)
+	return saved
 }
 
 func (h *Handler) downloadPendingFiles(productID string) {
+	var product database.Product
+	if err := h.db.First(&product, "id = ?", productID).Error; err != nil {
+		return
+	}
 	var files []database.File
-	h.db.Where("product_id = ? AND skipped = ?", productID, false).Find(&files)
+	h.db.Where("product_id = ? AND skipped = ? AND expired = ? AND archived_at IS NULL", productID, false, false).Find(&files)
 
 	for _, file := range files {
+		if !product.AutoDownloads(file.FileSize) {
+			continue
+		}
 		var entry database.DownloadEntry
 		err := h.db.Where("file_id = ? AND status = ?", file.ID, database.DownloadStatusCompleted).First(&entry).Error
 		if err == nil {
@@ -379,12 +871,39 @@ func (h *Handler) TestSourceCredentials(w http.ResponseWriter, r *http.Request,
 func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request, params generated.ListProductsParams) {
 	var products []database.Product
 	query := h.db.DB
+	deleted := params.Deleted != nil && *params.Deleted
 
 	if params.SourceId != nil {
 		query = query.Where("source_id = ?", *params.SourceId)
 	}
+	if deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if params.IncludeHidden == nil || !*params.IncludeHidden {
+		query = query.Where("hidden = ?", false)
+	}
+	if params.Favorite != nil {
+		query = query.Where("favorite = ?", *params.Favorite)
+	}
+
+	if err := query.Order("favorite DESC, name ASC").Find(&products).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list products")
+		return
+	}
+	// Tags are stored as JSON, so they're matched here rather than in SQL
+	if params.Tag != nil {
+		products = slices.DeleteFunc(products, func(p database.Product) bool {
+			return !p.HasTags(*params.Tag)
+		})
+	}
 
-	if err := query.Order("name ASC").Find(&products).Error; err != nil {
+	ids := make([]string, 0, len(products))
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+	counts, err := h.db.ProductFileCounts(ids, deleted)
+	if err != nil {
+		slog.Error("Failed to count product files", "error", err)
 		writeError(w, http.StatusInternalServerError, "Failed to list products")
 		return
 	}
@@ -392,30 +911,10 @@ func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request, params ge
 	result := make([]generated.Product, 0, len(products))
 	for _, p := range products {
 		product := convertProduct(p)
-
-		// Add file counts
-		var totalFiles, downloadedFiles, failedFiles int64
-		h.db.Model(&database.File{}).Where("product_id = ?", p.ID).Count(&totalFiles)
-		h.db.Model(&database.DownloadEntry{}).
-			Joins("JOIN files ON files.id = download_entries.file_id").
-			Where("files.product_id = ? AND download_entries.status = ?", p.ID, "completed").
-			Distinct("file_id").Count(&downloadedFiles)
-		// Count files where the most recent download entry is "failed"
-		h.db.Raw(`
-			SELECT COUNT(DISTINCT de.file_id) FROM download_entries de
-			JOIN files f ON f.id = de.file_id
-			WHERE f.product_id = ?
-			AND de.status = 'failed'
-			AND de.id = (SELECT MAX(de2.id) FROM download_entries de2 WHERE de2.file_id = de.file_id)
-		`, p.ID).Scan(&failedFiles)
-
-		tf := int(totalFiles)
-		df := int(downloadedFiles)
-		ff := int(failedFiles)
-		product.TotalFiles = &tf
-		product.DownloadedFiles = &df
-		product.FailedFiles = &ff
-
+		c := counts[p.ID]
+		product.TotalFiles = &c.Total
+		product.DownloadedFiles = &c.Downloaded
+		product.FailedFiles = &c.Failed
 		result = append(result, product)
 	}
 
@@ -424,7 +923,8 @@ func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request, params ge
 
 func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request, id string) {
 	var product database.Product
-	if err := h.db.Preload("Deliveries.Files").First(&product, "id = ?", id).Error; err != nil {
+	if err := h.db.Preload("Deliveries", "archived_at IS NULL").
+		Preload("Deliveries.Files", "archived_at IS NULL").First(&product, "id = ?", id).Error; err != nil {
 		writeError(w, http.StatusNotFound, "Product not found")
 		return
 	}
@@ -439,9 +939,24 @@ func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request, id string)
 		Description:      p.Description,
 		CheckWindowStart: p.CheckWindowStart,
 		LastCheckedAt:    p.LastCheckedAt,
+		LastSyncedAt:     p.LastSyncedAt,
+		SyncFailures:     p.SyncFailures,
+		SyncDisabledAt:   p.SyncDisabledAt,
+		SyncWatermark:    p.SyncWatermark,
 		TotalFiles:       p.TotalFiles,
 		DownloadedFiles:  p.DownloadedFiles,
 		FailedFiles:      p.FailedFiles,
+		Hidden:           p.Hidden,
+		Favorite:         p.Favorite,
+		Tags:             p.Tags,
+		Validators:       p.Validators,
+		Pipeline:         p.Pipeline,
+		StorageQuota:     p.StorageQuota,
+		QuotaAction:      p.QuotaAction,
+		IncludePatterns:  p.IncludePatterns,
+		ExcludePatterns:  p.ExcludePatterns,
+		ReleasedAfter:    p.ReleasedAfter,
+		SkipFiltered:     p.SkipFiltered,
 	}
 
 	deliveries := make([]generated.Delivery, 0, len(product.Deliveries))
@@ -453,405 +968,2671 @@ func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request, id string)
 	writeJSON(w, http.StatusOK, result)
 }
 
-func (h *Handler) SyncProduct(w http.ResponseWriter, r *http.Request, id string) {
-	if err := h.scheduler.SyncNow(r.Context(), id); err != nil {
+func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request, id string) {
+	fileIDs, err := h.db.DeleteProduct(id)
+	if errors.Is(err, database.ErrNotFound) {
 		writeError(w, http.StatusNotFound, "Product not found")
 		return
 	}
+	if err != nil {
+		slog.Error("Failed to delete product", "productID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to delete product")
+		return
+	}
 
-	w.WriteHeader(http.StatusAccepted)
-}
-
-// File handlers
-
-func (h *Handler) ListFiles(w http.ResponseWriter, r *http.Request, params generated.ListFilesParams) {
-	var files []database.File
-	var total int64
+	h.scheduler.UnscheduleProduct(id)
+	for _, fileID := range fileIDs {
+		if h.downloader.IsActive(fileID) {
+			h.downloader.Cancel(fileID)
+		}
+	}
 
-	query := h.db.DB.Model(&database.File{})
+	slog.Info("Product deleted", "productID", id, "files", len(fileIDs))
+	w.WriteHeader(http.StatusOK)
+}
 
-	if params.SourceId != nil {
-		query = query.Where("source_id = ?", *params.SourceId)
+func (h *Handler) UndeleteProduct(w http.ResponseWriter, r *http.Request, id string) {
+	product, err := h.db.UndeleteProduct(id)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "No deleted product found")
+		return
 	}
-	if params.ProductId != nil {
-		query = query.Where("product_id = ?", *params.ProductId)
+	if err != nil {
+		slog.Error("Failed to undelete product", "productID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to undelete product")
+		return
 	}
 
-	query.Count(&total)
-
-	offset := 0
-	limit := 50
-	if params.Offset != nil {
-		offset = *params.Offset
-	}
-	if params.Limit != nil {
-		limit = *params.Limit
+	if err := h.scheduler.ScheduleProduct(product); err != nil {
+		slog.Warn("Failed to schedule undeleted product", "productID", id, "error", err)
 	}
 
-	if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&files).Error; err != nil {
+	slog.Info("Product undeleted", "productID", id)
+	writeJSON(w, http.StatusOK, convertProduct(*product))
+}
+
+func (h *Handler) HideProduct(w http.ResponseWriter, r *http.Request, id string) {
+	h.setProductFlag(w, id, "hidden", true)
+}
+
+func (h *Handler) UnhideProduct(w http.ResponseWriter, r *http.Request, id string) {
+	h.setProductFlag(w, id, "hidden", false)
+}
+
+func (h *Handler) FavoriteProduct(w http.ResponseWriter, r *http.Request, id string) {
+	h.setProductFlag(w, id, "favorite", true)
+}
+
+func (h *Handler) UnfavoriteProduct(w http.ResponseWriter, r *http.Request, id string) {
+	h.setProductFlag(w, id, "favorite", false)
+}
+
+// setProductFlag sets the hidden or favorite column of a product
+func (h *Handler) setProductFlag(w http.ResponseWriter, id, column string, value bool) {
+	result := h.db.Model(&database.Product{}).Where("id = ?", id).Update(column, value)
+	if result.Error != nil {
+		slog.Error("Failed to update product", "productID", id, "error", result.Error)
+		writeError(w, http.StatusInternalServerError, "Failed to update product")
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	slog.Info("Product updated", "productID", id, column, value)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) SetProductTags(w http.ResponseWriter, r *http.Request, id string) {
+	var req generated.SetProductTagsJSONRequestBody
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	product, err := h.db.SetProductTags(id, req.Tags)
+	if errors.Is(err, database.ErrInvalidTag) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to set product tags", "productID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to update product")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, convertProduct(*product))
+}
+
+func (h *Handler) SetProductFilters(w http.ResponseWriter, r *http.Request, id string) {
+	var req generated.SetProductFiltersJSONRequestBody
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	var include, exclude []string
+	if req.IncludePatterns != nil {
+		include = *req.IncludePatterns
+	}
+	if req.ExcludePatterns != nil {
+		exclude = *req.ExcludePatterns
+	}
+	if err := database.CheckPatterns(append(slices.Clone(include), exclude...)); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var releasedAfter *time.Time
+	if req.ReleasedAfter != nil {
+		releasedAfter = &req.ReleasedAfter.Time
+	}
+
+	product, err := h.db.SetProductFilters(id, include, exclude, releasedAfter, req.SkipFiltered != nil && *req.SkipFiltered)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to set product filters", "productID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to update product")
+		return
+	}
+
+	slog.Info("Product filters updated", "productID", id, "include", include, "exclude", exclude, "releasedAfter", releasedAfter)
+	writeJSON(w, http.StatusOK, convertProduct(*product))
+}
+
+func (h *Handler) SetProductPipeline(w http.ResponseWriter, r *http.Request, id string) {
+	var req generated.SetProductPipelineJSONRequestBody
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	// The API schema mirrors pipeline.Step
+	data, err := json.Marshal(req.Steps)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	steps, err := pipeline.Parse(string(data))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := h.downloader.CheckPipeline(steps); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stored := ""
+	if len(steps) > 0 {
+		data, _ := json.Marshal(steps)
+		stored = string(data)
+	}
+	product, err := h.db.SetProductPipeline(id, stored)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to set product pipeline", "productID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to update product")
+		return
+	}
+
+	slog.Info("Product pipeline updated", "productID", id, "steps", len(steps))
+	writeJSON(w, http.StatusOK, convertProduct(*product))
+}
+
+func (h *Handler) SetProductQuota(w http.ResponseWriter, r *http.Request, id string) {
+	var req generated.SetProductQuotaJSONRequestBody
+	if err := decodeJSON(r, &req); err != nil || req.StorageQuota < 0 {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	action := database.QuotaDefer
+	if req.Action != nil {
+		action = string(*req.Action)
+	}
+	if action != database.QuotaDefer && action != database.QuotaSkip {
+		writeError(w, http.StatusBadRequest, "Invalid quota action, expected defer or skip")
+		return
+	}
+	if req.StorageQuota == 0 {
+		action = ""
+	}
+
+	product, err := h.db.SetProductQuota(id, req.StorageQuota, action)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to set product quota", "productID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to update product")
+		return
+	}
+
+	slog.Info("Product storage quota updated", "productID", id, "quota", req.StorageQuota, "action", action)
+	writeJSON(w, http.StatusOK, convertProduct(*product))
+}
+
+func (h *Handler) SetProductValidation(w http.ResponseWriter, r *http.Request, id string) {
+	var req generated.SetProductValidationJSONRequestBody
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validate.Check(req.Validators); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	product, err := h.db.SetProductValidators(id, req.Validators)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to set product validators", "productID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to update product")
+		return
+	}
+
+	slog.Info("Product validators updated", "productID", id, "validators", req.Validators)
+	writeJSON(w, http.StatusOK, convertProduct(*product))
+}
+
+func (h *Handler) SyncProduct(w http.ResponseWriter, r *http.Request, id string) {
+	if err := h.scheduler.SyncNow(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Delivery handlers
+
+func (h *Handler) GetDelivery(w http.ResponseWriter, r *http.Request, id string) {
+	var delivery database.Delivery
+	if err := h.db.Preload("Files").Preload("Files.Tags").Preload("Files.Metadata").
+		First(&delivery, "id = ?", id).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Delivery not found")
+		return
+	}
+	slices.SortFunc(delivery.Files, func(a, b database.File) int {
+		return strings.Compare(a.FileName, b.FileName)
+	})
+
+	d := convertDelivery(delivery)
+	result := generated.DeliveryWithFiles{
+		Id:           d.Id,
+		ProductId:    d.ProductId,
+		Name:         d.Name,
+		ExternalId:   d.ExternalId,
+		PublishedAt:  d.PublishedAt,
+		ExpiresAt:    d.ExpiresAt,
+		Expiring:     d.Expiring,
+		ArchivedAt:   delivery.ArchivedAt,
+		StatusCounts: make(map[string]int),
+	}
+
+	files := make([]generated.File, 0, len(delivery.Files))
+	for _, f := range delivery.Files {
+		files = append(files, convertFile(f))
+		result.TotalSize += f.FileSize
+		result.StatusCounts[f.Status]++
+	}
+	result.Files = &files
+	result.Status = deliveryStatus(result.StatusCounts, len(delivery.Files))
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetDeliveryArchive streams the downloaded files of a delivery as a ZIP
+// archive. The files are stored without compression, since most are
+// compressed already.
+func (h *Handler) GetDeliveryArchive(w http.ResponseWriter, r *http.Request, id string) {
+	var delivery database.Delivery
+	if err := h.db.Preload("Files").First(&delivery, "id = ?", id).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Delivery not found")
+		return
+	}
+
+	type archiveFile struct {
+		name string
+		path string
+	}
+	var files []archiveFile
+	for _, f := range delivery.Files {
+		path := h.downloadedPath(f.ID)
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, archiveFile{name: archiveEntryName(f.FileName, path), path: path})
+	}
+	if len(files) == 0 {
+		writeError(w, http.StatusNotFound, "No downloaded files in delivery")
+		return
+	}
+	slices.SortFunc(files, func(a, b archiveFile) int { return strings.Compare(a.name, b.name) })
+	// Files of the same name would overwrite each other when extracted
+	used := make(map[string]bool, len(files))
+	for i := range files {
+		files[i].name = uniqueEntryName(files[i].name, used)
+	}
+
+	name := delivery.Name
+	if name == "" {
+		name = delivery.ID
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	w.Header().Set("Cache-Control", "no-store")
+	clearWriteDeadline(w)
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		if err := addToZip(zw, f.name, f.path); err != nil {
+			// The response has started, so the client only sees a truncated archive
+			slog.Error("Failed to stream delivery archive", "deliveryID", id, "file", f.name, "error", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		slog.Error("Failed to finish delivery archive", "deliveryID", id, "error", err)
+	}
+}
+
+// archiveEntryName returns the base name of a source-supplied file name, so
+// entries can't point outside the directory the archive is extracted to. It
+// falls back to the stored file's name.
+func archiveEntryName(name, stored string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || !filepath.IsLocal(name) {
+		return filepath.Base(stored)
+	}
+	return name
+}
+
+// uniqueEntryName suffixes a name already in used, e.g. a.zip becomes
+// a (2).zip, and records it
+func uniqueEntryName(name string, used map[string]bool) string {
+	unique := name
+	ext := path.Ext(name)
+	for n := 2; used[strings.ToLower(unique)]; n++ {
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
+
+func addToZip(zw *zip.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Store
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+// deliveryStatus sums up the file status counts of a delivery. Skipped files
+// don't count towards it.
+func deliveryStatus(counts map[string]int, total int) generated.DeliveryWithFilesStatus {
+	wanted := total - counts[database.FileStatusSkipped]
+	downloaded := counts[database.FileStatusDownloaded]
+	switch {
+	case counts[database.FileStatusDownloading] > 0:
+		return generated.DeliveryWithFilesStatusDownloading
+	case counts[database.FileStatusFailed] > 0 || counts[database.FileStatusInvalid] > 0:
+		return generated.DeliveryWithFilesStatusFailed
+	case downloaded > 0 && downloaded == wanted:
+		return generated.DeliveryWithFilesStatusDownloaded
+	case downloaded > 0:
+		return generated.DeliveryWithFilesStatusPartial
+	}
+	return generated.DeliveryWithFilesStatusAvailable
+}
+
+func (h *Handler) DownloadDelivery(w http.ResponseWriter, r *http.Request, id string) {
+	if err := h.db.First(&database.Delivery{}, "id = ?", id).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Delivery not found")
+		return
+	}
+
+	var files []database.File
+	err := h.db.Where("delivery_id = ? AND skipped = ? AND status NOT IN ?", id, false,
+		[]string{database.FileStatusDownloaded, database.FileStatusDownloading, database.FileStatusExpired}).Find(&files).Error
+	if err != nil {
+		slog.Error("Failed to list delivery files", "deliveryID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to list delivery files")
+		return
+	}
+
+	started := 0
+	for _, file := range files {
+		if h.downloader.IsActive(file.ID) {
+			continue
+		}
+		go func(f database.File) {
+			if err := h.downloader.Download(context.Background(), f.ID); err != nil {
+				slog.Error("Delivery download failed", "file", f.FileName, "error", err)
+			}
+		}(file)
+		started++
+	}
+
+	slog.Info("Delivery download started", "deliveryID", id, "files", started)
+	writeJSON(w, http.StatusAccepted, generated.DeliveryActionResponse{Files: started})
+}
+
+func (h *Handler) SkipDelivery(w http.ResponseWriter, r *http.Request, id string) {
+	h.setDeliverySkipped(w, id, true)
+}
+
+func (h *Handler) UnskipDelivery(w http.ResponseWriter, r *http.Request, id string) {
+	h.setDeliverySkipped(w, id, false)
+}
+
+// setDeliverySkipped sets the skipped flag on all files of a delivery
+func (h *Handler) setDeliverySkipped(w http.ResponseWriter, id string, skipped bool) {
+	if err := h.db.First(&database.Delivery{}, "id = ?", id).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Delivery not found")
+		return
+	}
+
+	var fileIDs []string
+	if err := h.db.Model(&database.File{}).Where("delivery_id = ?", id).Pluck("id", &fileIDs).Error; err != nil {
+		slog.Error("Failed to list delivery files", "deliveryID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to update delivery")
+		return
+	}
+	if len(fileIDs) > 0 {
+		if err := h.db.Model(&database.File{}).Where("id IN ?", fileIDs).Update("skipped", skipped).Error; err != nil {
+			slog.Error("Failed to update delivery files", "deliveryID", id, "error", err)
+			writeError(w, http.StatusInternalServerError, "Failed to update delivery")
+			return
+		}
+		if err := h.db.UpdateFileStatus(fileIDs...); err != nil {
+			slog.Error("Failed to update file status", "deliveryID", id, "error", err)
+		}
+	}
+
+	slog.Info("Delivery updated", "deliveryID", id, "skipped", skipped, "files", len(fileIDs))
+	writeJSON(w, http.StatusOK, generated.DeliveryActionResponse{Files: len(fileIDs)})
+}
+
+// File handlers
+
+func (h *Handler) ListFiles(w http.ResponseWriter, r *http.Request, params generated.ListFilesParams) {
+	var files []database.File
+	var total int64
+
+	query := h.db.DB.Model(&database.File{})
+
+	if params.SourceId != nil {
+		query = query.Where("source_id = ?", *params.SourceId)
+	}
+	if params.ProductId != nil {
+		query = query.Where("product_id = ?", *params.ProductId)
+	}
+	if params.Deleted != nil && *params.Deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if params.Archived != nil && *params.Archived {
+		query = query.Where("archived_at IS NOT NULL")
+	} else {
+		query = query.Where("archived_at IS NULL")
+	}
+	if params.Status != nil {
+		query = query.Where("status = ?", string(*params.Status))
+	}
+	if params.Tag != nil {
+		tags, err := database.NormalizeTags(*params.Tag)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, tag := range tags {
+			query = query.Where("id IN (?)", h.db.Model(&database.FileTag{}).Select("file_id").
+				Where(&database.FileTag{Tag: tag}))
+		}
+	}
+	if params.Meta != nil {
+		for _, entry := range *params.Meta {
+			key, value, ok := strings.Cut(entry, "=")
+			if !ok || key == "" {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid meta filter %q, want key=value", entry))
+				return
+			}
+			query = query.Where("id IN (?)", h.db.Model(&database.FileMetadata{}).Select("file_id").
+				Where(map[string]interface{}{"key": key, "value": value}))
+		}
+	}
+
+	query.Count(&total)
+
+	offset := 0
+	limit := 50
+	if params.Offset != nil {
+		offset = *params.Offset
+	}
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	err := query.Preload("Tags").Preload("Metadata").
+		Offset(offset).Limit(limit).Order("created_at DESC").Find(&files).Error
+	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to list files")
 		return
 	}
 
 	result := make([]generated.File, 0, len(files))
 	for _, f := range files {
-		result = append(result, convertFile(f, h.db))
+		result = append(result, convertFile(f))
+	}
+
+	writeJSON(w, http.StatusOK, generated.FileListResponse{
+		Files: result,
+		Total: int(total),
+	})
+}
+
+func (h *Handler) GetFile(w http.ResponseWriter, r *http.Request, id string) {
+	var file database.File
+	if err := h.db.Preload("DownloadEntries").Preload("Tags").Preload("Metadata").
+		First(&file, "id = ?", id).Error; err != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	f := convertFile(file)
+	result := generated.FileWithHistory{
+		Id:               f.Id,
+		FileName:         f.FileName,
+		FileSize:         f.FileSize,
+		Status:           generated.FileWithHistoryStatus(f.Status),
+		ErrorMessage:     f.ErrorMessage,
+		DeliveryId:       f.DeliveryId,
+		ProductId:        f.ProductId,
+		SourceId:         f.SourceId,
+		ExpectedChecksum: f.ExpectedChecksum,
+		ReleasedAt:       f.ReleasedAt,
+		Skipped:          f.Skipped,
+		ArchivedAt:       f.ArchivedAt,
+		Tags:             f.Tags,
+		Metadata:         f.Metadata,
+	}
+
+	history := make([]generated.DownloadEntry, 0, len(file.DownloadEntries))
+	for _, e := range file.DownloadEntries {
+		history = append(history, convertDownloadEntry(e))
+	}
+	result.DownloadHistory = &history
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) GetFileContent(w http.ResponseWriter, r *http.Request, id string) {
+	var file database.File
+	if err := h.db.First(&file, "id = ?", id).Error; err != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	path := h.downloadedPath(id)
+	if path == "" {
+		writeError(w, http.StatusNotFound, "File not downloaded")
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Failed to open downloaded file", "path", path, "error", err)
+		}
+		writeError(w, http.StatusNotFound, "Downloaded file not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		writeError(w, http.StatusNotFound, "Downloaded file not found")
+		return
+	}
+
+	name := file.FileName
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	clearWriteDeadline(w)
+	// ServeContent handles range and conditional requests
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// downloadedPath returns where the file's latest completed download was
+// stored, or "" if it wasn't downloaded. Paths outside the downloads
+// directory and the import roots, where the history may point after a
+// relocation or a bad import, aren't served either.
+func (h *Handler) downloadedPath(fileID string) string {
+	var entry database.DownloadEntry
+	if err := h.db.Where("file_id = ? AND status = ?", fileID, database.DownloadStatusCompleted).
+		Order("completed_at DESC").First(&entry).Error; err != nil {
+		return ""
+	}
+	if !config.PathWithin(entry.LocalPath, append([]string{h.downloader.DownloadsPath()}, h.importRoots...)) {
+		slog.Warn("Download outside the downloads directory not served", "fileID", fileID, "path", entry.LocalPath)
+		return ""
+	}
+	return entry.LocalPath
+}
+
+func (h *Handler) DeleteFile(w http.ResponseWriter, r *http.Request, id string, params generated.DeleteFileParams) {
+	catalog := params.Catalog != nil && *params.Catalog
+
+	// Find the most recent completed download entry
+	var entry database.DownloadEntry
+	if err := h.db.Where("file_id = ? AND status = ?", id, "completed").Order("completed_at DESC").First(&entry).Error; err != nil {
+		if !catalog {
+			writeError(w, http.StatusNotFound, "No downloaded file found")
+			return
+		}
+		h.deleteFromCatalog(w, id)
+		return
+	}
+
+	// Delete the file from disk, unless another file is stored there too, as
+	// in the content-addressable layout
+	var shared int64
+	h.db.Model(&database.DownloadEntry{}).Where("status = ? AND local_path = ? AND file_id <> ?",
+		database.DownloadStatusCompleted, entry.LocalPath, id).Count(&shared)
+	if entry.LocalPath != "" && shared == 0 {
+		if err := os.Remove(entry.LocalPath); err != nil && !os.IsNotExist(err) {
+			slog.Error("Failed to delete file", "path", entry.LocalPath, "error", err)
+			writeError(w, http.StatusInternalServerError, "Failed to delete file")
+			return
+		}
+	}
+
+	// Update download entry status to deleted
+	h.db.Model(&entry).Update("status", "deleted")
+	h.updateFileStatus(id)
+	var file database.File
+	if err := h.db.Select("source_id", "product_id").First(&file, "id = ?", id).Error; err == nil {
+		h.downloader.UpdateLatest(file.SourceID, file.ProductID)
+	}
+
+	slog.Info("File deleted", "fileID", id, "path", entry.LocalPath)
+	if catalog {
+		h.deleteFromCatalog(w, id)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteFromCatalog soft-deletes a file record, stopping its download
+func (h *Handler) deleteFromCatalog(w http.ResponseWriter, id string) {
+	if err := h.db.DeleteFile(id); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "File not found")
+			return
+		}
+		slog.Error("Failed to delete file from catalog", "fileID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to delete file")
+		return
+	}
+	if h.downloader.IsActive(id) {
+		h.downloader.Cancel(id)
+	}
+
+	slog.Info("File deleted from catalog", "fileID", id)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) UndeleteFile(w http.ResponseWriter, r *http.Request, id string) {
+	err := h.db.UndeleteFile(id)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "No deleted file found")
+		return
+	}
+	if errors.Is(err, database.ErrProductDeleted) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to undelete file", "fileID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to undelete file")
+		return
+	}
+
+	slog.Info("File undeleted", "fileID", id)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) DownloadFile(w http.ResponseWriter, r *http.Request, id string) {
+	go func() {
+		ctx := context.Background()
+		h.downloader.Download(ctx, id)
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) CancelDownload(w http.ResponseWriter, r *http.Request, id string) {
+	if err := h.downloader.Cancel(id); err != nil {
+		writeError(w, http.StatusNotFound, "Download not found or not in progress")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) SetFileTags(w http.ResponseWriter, r *http.Request, id string) {
+	var req generated.SetFileTagsJSONRequestBody
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	h.writeLabeledFile(w, id, h.db.SetFileTags(id, req.Tags))
+}
+
+func (h *Handler) SetFileMetadata(w http.ResponseWriter, r *http.Request, id string) {
+	var req generated.SetFileMetadataJSONRequestBody
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	h.writeLabeledFile(w, id, h.db.SetFileMetadata(id, req.Metadata))
+}
+
+// writeLabeledFile responds to a tags or metadata update with the file
+func (h *Handler) writeLabeledFile(w http.ResponseWriter, id string, err error) {
+	if errors.Is(err, database.ErrInvalidTag) || errors.Is(err, database.ErrInvalidMetadata) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to update file", "fileID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to update file")
+		return
+	}
+
+	var file database.File
+	if err := h.db.Preload("Tags").Preload("Metadata").First(&file, "id = ?", id).Error; err != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, convertFile(file))
+}
+
+// updateFileStatus refreshes the file's status column after its latest
+// download entry or skipped flag changed
+func (h *Handler) updateFileStatus(id string) {
+	if err := h.db.UpdateFileStatus(id); err != nil {
+		slog.Error("Failed to update file status", "fileID", id, "error", err)
+	}
+}
+
+func (h *Handler) SkipFile(w http.ResponseWriter, r *http.Request, id string) {
+	if err := h.db.Model(&database.File{}).Where("id = ?", id).Update("skipped", true).Error; err != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	h.updateFileStatus(id)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) UnskipFile(w http.ResponseWriter, r *http.Request, id string) {
+	if err := h.db.Model(&database.File{}).Where("id = ?", id).Update("skipped", false).Error; err != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	h.updateFileStatus(id)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) ListStorage(w http.ResponseWriter, r *http.Request, params generated.ListStorageParams) {
+	rel := ""
+	if params.Path != nil {
+		// Cleaning the rooted path drops any ".." leading out of the
+		// downloads directory
+		rel = strings.TrimPrefix(path.Clean("/"+*params.Path), "/")
+	}
+	root := h.downloader.DownloadsPath()
+	dir := filepath.Join(root, filepath.FromSlash(rel))
+
+	result := generated.StorageListing{Path: rel, Entries: []generated.StorageEntry{}}
+	stats, err := h.db.DedupStats()
+	if err != nil {
+		slog.Error("Failed to count deduplicated files", "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to list storage")
+		return
+	}
+	result.Dedup = generated.StorageDedup{Files: stats.Files, SavedBytes: stats.SavedBytes}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) && rel == "" {
+			// Nothing downloaded yet
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+		writeError(w, http.StatusNotFound, "Directory not found")
+		return
+	}
+
+	paths := make([]string, 0, len(dirEntries))
+	for _, e := range dirEntries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		entry := generated.StorageEntry{
+			Name:       e.Name(),
+			Path:       path.Join(rel, e.Name()),
+			Directory:  e.IsDir(),
+			ModifiedAt: info.ModTime(),
+		}
+		if !e.IsDir() {
+			size := info.Size()
+			entry.Size = &size
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+
+	// Link stored files to the catalog files they were downloaded for
+	if len(paths) > 0 {
+		var entries []database.DownloadEntry
+		h.db.Select("file_id", "local_path").
+			Where("status = ? AND local_path IN ?", database.DownloadStatusCompleted, paths).
+			Order("id").Find(&entries)
+		fileIDs := make(map[string]string, len(entries))
+		for _, e := range entries {
+			fileIDs[filepath.Base(e.LocalPath)] = e.FileID
+		}
+		for i, e := range result.Entries {
+			if id, ok := fileIDs[e.Name]; ok && !e.Directory {
+				result.Entries[i].FileId = &id
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Download handlers
+
+func (h *Handler) ListDownloads(w http.ResponseWriter, r *http.Request, params generated.ListDownloadsParams) {
+	var entries []database.DownloadEntry
+	var total int64
+
+	query := h.db.DB.Model(&database.DownloadEntry{})
+
+	if params.Status != nil {
+		query = query.Where("status = ?", *params.Status)
+	}
+
+	query.Count(&total)
+
+	offset := 0
+	limit := 50
+	if params.Offset != nil {
+		offset = *params.Offset
+	}
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&entries).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list downloads")
+		return
+	}
+
+	result := make([]generated.DownloadEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, convertDownloadEntry(e))
+	}
+
+	writeJSON(w, http.StatusOK, generated.DownloadListResponse{
+		Downloads: result,
+		Total:     int(total),
+	})
+}
+
+const (
+	defaultStreamInterval = time.Second
+	minStreamInterval     = 250 * time.Millisecond
+	maxStreamInterval     = time.Minute
+	streamKeepAlive       = 15 * time.Second
+)
+
+func (h *Handler) StreamActiveDownloads(w http.ResponseWriter, r *http.Request, params generated.StreamActiveDownloadsParams) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx/traefik buffering
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+	// The stream stays open as long as the client listens
+	clearWriteDeadline(w)
+
+	interval := defaultStreamInterval
+	if params.Interval != nil {
+		interval = min(max(time.Duration(*params.Interval)*time.Millisecond, minStreamInterval), maxStreamInterval)
+	}
+	delta := params.Delta != nil && *params.Delta
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var tracker *progressDelta
+	if delta {
+		tracker = newProgressDelta()
+	}
+	lastSent := time.Now()
+	lastSync := []byte("[]")
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			// Sync progress goes out as named events, which clients only
+			// listening for download progress ignore
+			if data, _ := json.Marshal(h.syncProgress()); !bytes.Equal(data, lastSync) {
+				fmt.Fprintf(w, "event: sync\ndata: %s\n\n", data)
+				flusher.Flush()
+				lastSent = time.Now()
+				lastSync = data
+			}
+
+			downloads := h.downloader.ActiveDownloads()
+
+			var payload any = downloads
+			if tracker != nil {
+				d, changed := tracker.next(downloads)
+				if !changed {
+					// Comment lines keep proxies from closing an idle stream
+					if time.Since(lastSent) >= streamKeepAlive {
+						fmt.Fprint(w, ": keep-alive\n\n")
+						flusher.Flush()
+						lastSent = time.Now()
+					}
+					continue
+				}
+				payload = d
+			}
+
+			data, _ := json.Marshal(payload)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+			lastSent = time.Now()
+		}
+	}
+}
+
+// progressDeltaEvent is the payload of a delta-encoded SSE event
+type progressDeltaEvent struct {
+	Reset   bool                          `json:"reset"`
+	Updated []downloader.DownloadProgress `json:"updated"`
+	Removed []string                      `json:"removed"`
+}
+
+// progressDelta computes the changes between consecutive progress snapshots
+type progressDelta struct {
+	sent    bool
+	entries map[string]downloader.DownloadProgress
+}
+
+func newProgressDelta() *progressDelta {
+	return &progressDelta{entries: make(map[string]downloader.DownloadProgress)}
+}
+
+// next returns the delta to the previous snapshot and whether anything changed.
+// The first call always reports a reset with all active downloads.
+func (p *progressDelta) next(downloads []downloader.DownloadProgress) (progressDeltaEvent, bool) {
+	delta := progressDeltaEvent{
+		Reset:   !p.sent,
+		Updated: []downloader.DownloadProgress{},
+		Removed: []string{},
+	}
+
+	current := make(map[string]downloader.DownloadProgress, len(downloads))
+	for _, d := range downloads {
+		current[d.FileID] = d
+		if prev, ok := p.entries[d.FileID]; ok && prev == d {
+			continue
+		}
+		delta.Updated = append(delta.Updated, d)
+	}
+	for id := range p.entries {
+		if _, ok := current[id]; !ok {
+			delta.Removed = append(delta.Removed, id)
+		}
+	}
+	sort.Strings(delta.Removed)
+
+	changed := delta.Reset || len(delta.Updated) > 0 || len(delta.Removed) > 0
+	p.entries = current
+	p.sent = true
+	return delta, changed
+}
+
+// Schedule handlers
+
+func (h *Handler) ListQuarantine(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.db.ListQuarantine()
+	if err != nil {
+		slog.Error("Failed to list quarantine", "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to list quarantine")
+		return
+	}
+
+	result := make([]generated.QuarantinedFile, 0, len(entries))
+	for _, q := range entries {
+		result = append(result, h.convertQuarantinedFile(q))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) GetQuarantinedFile(w http.ResponseWriter, r *http.Request, id int) {
+	q, err := h.db.GetQuarantined(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Quarantined file not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.convertQuarantinedFile(*q))
+}
+
+func (h *Handler) GetQuarantinedFileContent(w http.ResponseWriter, r *http.Request, id int) {
+	q, err := h.db.GetQuarantined(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Quarantined file not found")
+		return
+	}
+	f, err := os.Open(h.downloader.QuarantinePath(q))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Quarantined file not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		writeError(w, http.StatusNotFound, "Quarantined file not found")
+		return
+	}
+
+	name := filepath.Base(q.Path)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	clearWriteDeadline(w)
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+func (h *Handler) ReleaseQuarantinedFile(w http.ResponseWriter, r *http.Request, id int) {
+	err := h.downloader.Release(uint(id))
+	switch {
+	case errors.Is(err, database.ErrNotFound), errors.Is(err, downloader.ErrFileNotFound):
+		writeError(w, http.StatusNotFound, "Quarantined file not found")
+		return
+	case errors.Is(err, downloader.ErrDownloadInProgress):
+		writeError(w, http.StatusConflict, "File is being downloaded")
+		return
+	case err != nil:
+		slog.Error("Failed to release quarantined file", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to release file")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) PurgeQuarantinedFile(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.downloader.Purge(uint(id)); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "Quarantined file not found")
+			return
+		}
+		slog.Error("Failed to purge quarantined file", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to purge file")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	var products []database.Product
+	if err := h.db.Find(&products).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get schedule")
+		return
+	}
+
+	result := make([]generated.ProductSchedule, 0, len(products))
+	for _, p := range products {
+		schedule := generated.ProductSchedule{
+			ProductId:      p.ID,
+			ProductName:    p.Name,
+			AutoDownload:   p.AutoDownload,
+			SyncDisabledAt: p.SyncDisabledAt,
+		}
+		if p.CheckWindowStart != "" {
+			schedule.CheckWindowStart = &p.CheckWindowStart
+		}
+		if p.CheckWindowEnd != "" {
+			schedule.CheckWindowEnd = &p.CheckWindowEnd
+		}
+		if p.DownloadWindow != "" {
+			schedule.DownloadWindow = &p.DownloadWindow
+		}
+		setScheduleOptions(&schedule, &p)
+		if nextRun := h.scheduler.GetNextRun(p.ID); nextRun != nil {
+			schedule.NextRun = nextRun
+		}
+		result = append(result, schedule)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) UpdateProductSchedule(w http.ResponseWriter, r *http.Request, productID string) {
+	var req generated.UpdateScheduleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var product database.Product
+	if err := h.db.First(&product, "id = ?", productID).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	wasAutoDownload := product.AutoDownload
+	wasLatestOnly := product.LatestOnly
+
+	if req.AutoDownload != nil {
+		product.AutoDownload = *req.AutoDownload
+	}
+	if req.CheckWindowStart != nil {
+		product.CheckWindowStart = *req.CheckWindowStart
+	}
+	if req.CheckWindowEnd != nil {
+		product.CheckWindowEnd = *req.CheckWindowEnd
+	}
+	if req.DownloadWindow != nil {
+		if _, err := blackout.Parse(*req.DownloadWindow); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid download window: "+err.Error())
+			return
+		}
+		product.DownloadWindow = strings.TrimSpace(*req.DownloadWindow)
+	}
+	if req.LatestOnly != nil {
+		product.LatestOnly = *req.LatestOnly
+	}
+	if req.MinAutoDownloadSize != nil {
+		product.MinAutoDownloadSize = *req.MinAutoDownloadSize
+	}
+	if req.MaxAutoDownloadSize != nil {
+		product.MaxAutoDownloadSize = *req.MaxAutoDownloadSize
+	}
+	if product.MinAutoDownloadSize < 0 || product.MaxAutoDownloadSize < 0 ||
+		(product.MaxAutoDownloadSize > 0 && product.MinAutoDownloadSize > product.MaxAutoDownloadSize) {
+		writeError(w, http.StatusBadRequest, "Invalid auto-download size bounds")
+		return
+	}
+	// Updating the schedule resumes one suspended after repeated failures
+	product.SyncFailures = 0
+	product.SyncDisabledAt = nil
+
+	// Validate schedule before saving
+	if err := h.scheduler.ScheduleProduct(&product); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid schedule: "+err.Error())
+		return
+	}
+
+	if err := h.db.Save(&product).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update schedule")
+		return
+	}
+
+	// Tracking only the latest delivery skips the older ones right away
+	if product.LatestOnly && !wasLatestOnly {
+		if _, err := h.db.SkipOlderDeliveries(product.ID); err != nil {
+			slog.Error("Failed to skip older deliveries", "productID", product.ID, "error", err)
+		}
+	}
+
+	// If auto-download was just enabled, trigger immediate download of pending files
+	if product.AutoDownload && !wasAutoDownload {
+		go h.downloadPendingFiles(product.ID)
+	}
+
+	schedule := generated.ProductSchedule{
+		ProductId:    product.ID,
+		ProductName:  product.Name,
+		AutoDownload: product.AutoDownload,
+	}
+	if product.CheckWindowStart != "" {
+		schedule.CheckWindowStart = &product.CheckWindowStart
+	}
+	if product.CheckWindowEnd != "" {
+		schedule.CheckWindowEnd = &product.CheckWindowEnd
+	}
+	if product.DownloadWindow != "" {
+		schedule.DownloadWindow = &product.DownloadWindow
+	}
+	setScheduleOptions(&schedule, &product)
+	if nextRun := h.scheduler.GetNextRun(product.ID); nextRun != nil {
+		schedule.NextRun = nextRun
+	}
+
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+// setScheduleOptions adds the product's latest delivery mode and
+// auto-download size bounds to its schedule
+func setScheduleOptions(schedule *generated.ProductSchedule, product *database.Product) {
+	schedule.LatestOnly = &product.LatestOnly
+	if product.MinAutoDownloadSize > 0 {
+		schedule.MinAutoDownloadSize = &product.MinAutoDownloadSize
+	}
+	if product.MaxAutoDownloadSize > 0 {
+		schedule.MaxAutoDownloadSize = &product.MaxAutoDownloadSize
+	}
+}
+
+func (h *Handler) ValidateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req generated.ValidateScheduleRequest
+	if err := decodeJSON(r, &req); err != nil || req.Expression == "" {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	count := 5
+	if req.Count != nil && *req.Count > 0 {
+		count = min(*req.Count, 50)
+	}
+
+	// The scheduler runs in the server's local time
+	now := time.Now()
+	timezone, _ := now.Zone()
+	if name := now.Location().String(); name != "Local" {
+		timezone = name
+	}
+
+	result := generated.ScheduleValidation{Valid: true, Timezone: timezone, NextRuns: []time.Time{}}
+	runs, err := scheduler.NextRuns(req.Expression, now, count)
+	if err != nil {
+		msg := err.Error()
+		result.Valid = false
+		result.Error = &msg
+	} else {
+		result.NextRuns = runs
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) ListSyncRuns(w http.ResponseWriter, r *http.Request, params generated.ListSyncRunsParams) {
+	query := h.db.Model(&database.SyncRun{})
+	if params.ProductId != nil {
+		query = query.Where("product_id = ?", *params.ProductId)
+	}
+	if params.Status != nil {
+		query = query.Where("status = ?", *params.Status)
+	}
+
+	limit := 50
+	if params.Limit != nil && *params.Limit > 0 {
+		limit = min(*params.Limit, 200)
+	}
+
+	var runs []database.SyncRun
+	if err := query.Order("id DESC").Limit(limit).Find(&runs).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list sync runs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, convertSyncRuns(runs))
+}
+
+func (h *Handler) GetProductPending(w http.ResponseWriter, r *http.Request, id string) {
+	var count int64
+	h.db.Model(&database.Product{}).Where("id = ?", id).Count(&count)
+	if count == 0 {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	pending, err := h.db.PendingDownloads(id)
+	if err != nil {
+		slog.Error("Failed to count pending downloads", "productID", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to count pending downloads")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, generated.PendingDownloads{
+		Files:            pending.Files,
+		Bytes:            pending.Bytes,
+		UnknownSizeFiles: pending.UnknownSize,
+	})
+}
+
+func (h *Handler) ListProductSyncs(w http.ResponseWriter, r *http.Request, id string, params generated.ListProductSyncsParams) {
+	var count int64
+	h.db.Model(&database.Product{}).Where("id = ?", id).Count(&count)
+	if count == 0 {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	limit := 50
+	if params.Limit != nil && *params.Limit > 0 {
+		limit = min(*params.Limit, 200)
+	}
+	offset := 0
+	if params.Offset != nil && *params.Offset > 0 {
+		offset = *params.Offset
+	}
+
+	var runs []database.SyncRun
+	err := h.db.Where("product_id = ?", id).Order("id DESC").Offset(offset).Limit(limit).Find(&runs).Error
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list sync runs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, convertSyncRuns(runs))
+}
+
+func convertSyncRuns(runs []database.SyncRun) []generated.SyncRun {
+	result := make([]generated.SyncRun, 0, len(runs))
+	for _, run := range runs {
+		item := generated.SyncRun{
+			Id:          int(run.ID),
+			ProductId:   run.ProductID,
+			SourceId:    run.SourceID,
+			Trigger:     generated.SyncRunTrigger(run.Trigger),
+			Attempt:     run.Attempt,
+			Status:      generated.SyncRunStatus(run.Status),
+			NewFiles:    run.NewFiles,
+			StartedAt:   run.StartedAt,
+			CompletedAt: run.CompletedAt,
+			NextRetryAt: run.NextRetryAt,
+		}
+		if run.ErrorMessage != "" {
+			item.ErrorMessage = &run.ErrorMessage
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// Webhook handlers
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.hooks.ListWebhooks()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list webhooks")
+		return
+	}
+
+	result := make([]generated.Webhook, 0, len(webhooks))
+	for _, wh := range webhooks {
+		result = append(result, convertWebhook(wh))
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req generated.CreateWebhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Template != nil && *req.Template != "" {
+		if _, err := hooks.ParseTemplate(*req.Template); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.DigestMinutes != nil && *req.DigestMinutes < 0 {
+		writeError(w, http.StatusBadRequest, "digestMinutes must not be negative")
+		return
+	}
+
+	webhook, err := h.hooks.CreateWebhook(req.Name, req.Url, req.Events)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+	if req.Secret != nil && *req.Secret != "" {
+		if err := h.hooks.SetWebhookSecret(webhook.ID, *req.Secret); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to create webhook")
+			return
+		}
+	}
+	if req.Template != nil && *req.Template != "" {
+		if err := h.hooks.SetWebhookTemplate(webhook.ID, *req.Template); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to create webhook")
+			return
+		}
+	}
+	if req.DigestMinutes != nil && *req.DigestMinutes > 0 {
+		if err := h.hooks.SetWebhookDigest(webhook.ID, *req.DigestMinutes); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to create webhook")
+			return
+		}
+	}
+	if req.SourceIds != nil || req.ProductIds != nil {
+		var sourceIDs, productIDs []string
+		if req.SourceIds != nil {
+			sourceIDs = *req.SourceIds
+		}
+		if req.ProductIds != nil {
+			productIDs = *req.ProductIds
+		}
+		if err := h.hooks.SetWebhookFilters(webhook.ID, sourceIDs, productIDs); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to create webhook")
+			return
+		}
+	}
+	if webhook, err = h.hooks.GetWebhook(webhook.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, convertWebhook(*webhook))
+}
+
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request, id int) {
+	var req generated.UpdateWebhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	webhook, err := h.hooks.GetWebhook(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	if req.Template != nil && *req.Template != "" {
+		if _, err := hooks.ParseTemplate(*req.Template); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.DigestMinutes != nil && *req.DigestMinutes < 0 {
+		writeError(w, http.StatusBadRequest, "digestMinutes must not be negative")
+		return
+	}
+
+	name := webhook.Name
+	url := webhook.URL
+	events := hooks.ParseEvents(webhook.Events)
+	enabled := webhook.Enabled
+
+	if req.Name != nil {
+		name = *req.Name
+	}
+	if req.Url != nil {
+		url = *req.Url
+	}
+	if req.Events != nil {
+		events = *req.Events
+	}
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	if err := h.hooks.UpdateWebhook(uint(id), name, url, events, enabled); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update webhook")
+		return
+	}
+	if req.Secret != nil {
+		if err := h.hooks.SetWebhookSecret(uint(id), *req.Secret); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update webhook")
+			return
+		}
+	}
+	if req.Template != nil {
+		if err := h.hooks.SetWebhookTemplate(uint(id), *req.Template); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update webhook")
+			return
+		}
+	}
+	if req.DigestMinutes != nil {
+		if err := h.hooks.SetWebhookDigest(uint(id), *req.DigestMinutes); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update webhook")
+			return
+		}
+	}
+	if req.SourceIds != nil || req.ProductIds != nil {
+		sourceIDs := hooks.ParseIDs(webhook.Sources)
+		if req.SourceIds != nil {
+			sourceIDs = *req.SourceIds
+		}
+		productIDs := hooks.ParseIDs(webhook.Products)
+		if req.ProductIds != nil {
+			productIDs = *req.ProductIds
+		}
+		if err := h.hooks.SetWebhookFilters(uint(id), sourceIDs, productIDs); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update webhook")
+			return
+		}
+	}
+
+	updated, _ := h.hooks.GetWebhook(uint(id))
+	writeJSON(w, http.StatusOK, convertWebhook(*updated))
+}
+
+func (h *Handler) ListWebhookDeadLetters(w http.ResponseWriter, r *http.Request, params generated.ListWebhookDeadLettersParams) {
+	var webhookID uint
+	if params.WebhookId != nil {
+		webhookID = uint(*params.WebhookId)
+	}
+	letters, err := h.hooks.ListDeadLetters(webhookID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list dead letters")
+		return
+	}
+
+	result := make([]generated.WebhookDeadLetter, 0, len(letters))
+	for _, l := range letters {
+		result = append(result, convertDeadLetter(l))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) DeleteWebhookDeadLetter(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.hooks.DeleteDeadLetter(uint(id)); err != nil {
+		if errors.Is(err, hooks.ErrDeadLetterNotFound) {
+			writeError(w, http.StatusNotFound, "Dead letter not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete dead letter")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ReplayWebhookDeadLetter(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.hooks.ReplayDeadLetter(r.Context(), uint(id)); err != nil {
+		if errors.Is(err, hooks.ErrDeadLetterNotFound) {
+			writeError(w, http.StatusNotFound, "Dead letter not found")
+			return
+		}
+		writeError(w, http.StatusBadGateway, "Delivery failed: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.hooks.DeleteWebhook(uint(id)); err != nil {
+		writeError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ReplayWebhookEvents(w http.ResponseWriter, r *http.Request, id int) {
+	var req generated.ReplayEventsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	filter := hooks.ReplayFilter{Since: req.Since}
+	if req.Types != nil {
+		filter.Types = *req.Types
+	}
+	if req.Until != nil {
+		if !req.Until.After(req.Since) {
+			writeError(w, http.StatusBadRequest, "until must be after since")
+			return
+		}
+		filter.Until = *req.Until
+	}
+
+	count, err := h.hooks.ReplayEvents(uint(id), filter)
+	if err != nil {
+		if errors.Is(err, hooks.ErrWebhookNotFound) {
+			writeError(w, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to replay events")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, generated.ReplayEventsResponse{Events: count})
+}
+
+// Event log handlers
+
+func (h *Handler) ListEvents(w http.ResponseWriter, r *http.Request, params generated.ListEventsParams) {
+	var eventType string
+	if params.Type != nil {
+		eventType = *params.Type
+	}
+	var since time.Time
+	if params.Since != nil {
+		since = *params.Since
+	}
+	limit := 100
+	if params.Limit != nil && *params.Limit > 0 {
+		limit = min(*params.Limit, 1000)
+	}
+
+	events, err := h.hooks.ListEvents(eventType, since, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list events")
+		return
+	}
+
+	result := make([]generated.EventLogEntry, 0, len(events))
+	for _, e := range events {
+		result = append(result, convertEvent(e))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Credential audit handlers
+
+func (h *Handler) ListCredentialAudit(w http.ResponseWriter, r *http.Request, params generated.ListCredentialAuditParams) {
+	if h.audit == nil {
+		writeJSON(w, http.StatusOK, []generated.CredentialAuditEntry{})
+		return
+	}
+	var sourceID string
+	if params.Source != nil {
+		sourceID = *params.Source
+	}
+	var since time.Time
+	if params.Since != nil {
+		since = *params.Since
+	}
+	limit := 100
+	if params.Limit != nil && *params.Limit > 0 {
+		limit = min(*params.Limit, 1000)
+	}
+
+	entries, err := h.audit.List(sourceID, since, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list credential accesses")
+		return
+	}
+
+	result := make([]generated.CredentialAuditEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, convertAuditEntry(e))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Chat notifier handlers
+
+func (h *Handler) ListChatNotifiers(w http.ResponseWriter, r *http.Request) {
+	notifiers, err := h.hooks.ListChatNotifiers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list chat notifiers")
+		return
+	}
+
+	result := make([]generated.ChatNotifier, 0, len(notifiers))
+	for _, n := range notifiers {
+		result = append(result, convertChatNotifier(n))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) CreateChatNotifier(w http.ResponseWriter, r *http.Request) {
+	var req generated.CreateChatNotifierRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	notifier := &database.ChatNotifier{
+		Name:       req.Name,
+		Platform:   req.Platform,
+		WebhookURL: req.WebhookUrl,
+		Events:     hooks.EncodeList(req.Events),
+		Enabled:    true,
+	}
+	if req.SourceIds != nil {
+		notifier.Sources = hooks.EncodeList(*req.SourceIds)
+	}
+	if req.ProductIds != nil {
+		notifier.Products = hooks.EncodeList(*req.ProductIds)
+	}
+	if err := hooks.ValidateChatNotifier(notifier); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.hooks.CreateChatNotifier(notifier); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create chat notifier")
+		return
+	}
+	writeJSON(w, http.StatusCreated, convertChatNotifier(*notifier))
+}
+
+func (h *Handler) UpdateChatNotifier(w http.ResponseWriter, r *http.Request, id int) {
+	var req generated.UpdateChatNotifierRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	notifier, err := h.hooks.GetChatNotifier(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Chat notifier not found")
+		return
+	}
+
+	if req.Name != nil {
+		notifier.Name = *req.Name
+	}
+	if req.WebhookUrl != nil {
+		notifier.WebhookURL = *req.WebhookUrl
+	}
+	if req.Events != nil {
+		notifier.Events = hooks.EncodeList(*req.Events)
+	}
+	if req.SourceIds != nil {
+		notifier.Sources = hooks.EncodeList(*req.SourceIds)
+	}
+	if req.ProductIds != nil {
+		notifier.Products = hooks.EncodeList(*req.ProductIds)
+	}
+	if req.Enabled != nil {
+		notifier.Enabled = *req.Enabled
+	}
+	if err := hooks.ValidateChatNotifier(notifier); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.hooks.UpdateChatNotifier(notifier); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update chat notifier")
+		return
+	}
+	writeJSON(w, http.StatusOK, convertChatNotifier(*notifier))
+}
+
+func (h *Handler) DeleteChatNotifier(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.hooks.DeleteChatNotifier(uint(id)); err != nil {
+		if errors.Is(err, hooks.ErrChatNotifierNotFound) {
+			writeError(w, http.StatusNotFound, "Chat notifier not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete chat notifier")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Email notifier handlers
+
+func (h *Handler) ListEmailNotifiers(w http.ResponseWriter, r *http.Request) {
+	notifiers, err := h.hooks.ListEmailNotifiers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list email notifiers")
+		return
+	}
+
+	result := make([]generated.EmailNotifier, 0, len(notifiers))
+	for _, n := range notifiers {
+		result = append(result, convertEmailNotifier(n))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) CreateEmailNotifier(w http.ResponseWriter, r *http.Request) {
+	var req generated.CreateEmailNotifierRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	notifier := &database.EmailNotifier{
+		Name:       req.Name,
+		Recipients: encodeEmails(req.Recipients),
+		Enabled:    true,
+	}
+	if req.Events != nil {
+		notifier.Events = hooks.EncodeList(*req.Events)
+	}
+	if req.SourceIds != nil {
+		notifier.Sources = hooks.EncodeList(*req.SourceIds)
+	}
+	if req.ProductIds != nil {
+		notifier.Products = hooks.EncodeList(*req.ProductIds)
+	}
+	if req.DigestMinutes != nil {
+		notifier.DigestMinutes = *req.DigestMinutes
+	}
+	if err := h.hooks.ValidateEmailNotifier(notifier); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.hooks.CreateEmailNotifier(notifier); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create email notifier")
+		return
+	}
+	writeJSON(w, http.StatusCreated, convertEmailNotifier(*notifier))
+}
+
+func (h *Handler) UpdateEmailNotifier(w http.ResponseWriter, r *http.Request, id int) {
+	var req generated.UpdateEmailNotifierRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	notifier, err := h.hooks.GetEmailNotifier(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Email notifier not found")
+		return
+	}
+
+	if req.Name != nil {
+		notifier.Name = *req.Name
+	}
+	if req.Recipients != nil {
+		notifier.Recipients = encodeEmails(*req.Recipients)
+	}
+	if req.Events != nil {
+		notifier.Events = hooks.EncodeList(*req.Events)
+	}
+	if req.SourceIds != nil {
+		notifier.Sources = hooks.EncodeList(*req.SourceIds)
+	}
+	if req.ProductIds != nil {
+		notifier.Products = hooks.EncodeList(*req.ProductIds)
+	}
+	if req.DigestMinutes != nil {
+		notifier.DigestMinutes = *req.DigestMinutes
+	}
+	if req.Enabled != nil {
+		notifier.Enabled = *req.Enabled
+	}
+	if err := h.hooks.ValidateEmailNotifier(notifier); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.hooks.UpdateEmailNotifier(notifier); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update email notifier")
+		return
+	}
+	writeJSON(w, http.StatusOK, convertEmailNotifier(*notifier))
+}
+
+func (h *Handler) DeleteEmailNotifier(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.hooks.DeleteEmailNotifier(uint(id)); err != nil {
+		if errors.Is(err, hooks.ErrEmailNotifierNotFound) {
+			writeError(w, http.StatusNotFound, "Email notifier not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete email notifier")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func encodeEmails(emails []openapi_types.Email) string {
+	values := make([]string, len(emails))
+	for i, e := range emails {
+		values[i] = string(e)
+	}
+	return hooks.EncodeList(values)
+}
+
+// NATS publisher handlers
+
+func (h *Handler) ListNatsPublishers(w http.ResponseWriter, r *http.Request) {
+	publishers, err := h.hooks.ListNatsPublishers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list NATS publishers")
+		return
+	}
+
+	result := make([]generated.NatsPublisher, 0, len(publishers))
+	for _, p := range publishers {
+		result = append(result, convertNatsPublisher(p))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) CreateNatsPublisher(w http.ResponseWriter, r *http.Request) {
+	var req generated.CreateNatsPublisherRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	publisher := &database.NatsPublisher{
+		Name:    req.Name,
+		URL:     req.Url,
+		Subject: req.Subject,
+		Events:  hooks.EncodeList([]string{"*"}),
+		Enabled: true,
+	}
+	if req.JetStream != nil {
+		publisher.JetStream = *req.JetStream
+	}
+	if req.Events != nil {
+		publisher.Events = hooks.EncodeList(*req.Events)
+	}
+	if req.SourceIds != nil {
+		publisher.Sources = hooks.EncodeList(*req.SourceIds)
+	}
+	if req.ProductIds != nil {
+		publisher.Products = hooks.EncodeList(*req.ProductIds)
+	}
+	if err := hooks.ValidateNatsPublisher(publisher); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// Filter by status if provided (done after conversion since status is derived)
-	if params.Status != nil {
-		filtered := make([]generated.File, 0)
-		for _, f := range result {
-			if string(f.Status) == string(*params.Status) {
-				filtered = append(filtered, f)
-			}
-		}
-		result = filtered
+	if err := h.hooks.CreateNatsPublisher(publisher); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create NATS publisher")
+		return
 	}
-
-	writeJSON(w, http.StatusOK, generated.FileListResponse{
-		Files: result,
-		Total: int(total),
-	})
+	writeJSON(w, http.StatusCreated, convertNatsPublisher(*publisher))
 }
 
-func (h *Handler) GetFile(w http.ResponseWriter, r *http.Request, id string) {
-	var file database.File
-	if err := h.db.Preload("DownloadEntries").First(&file, "id = ?", id).Error; err != nil {
-		writeError(w, http.StatusNotFound, "File not found")
+func (h *Handler) UpdateNatsPublisher(w http.ResponseWriter, r *http.Request, id int) {
+	var req generated.UpdateNatsPublisherRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	f := convertFile(file, h.db)
-	result := generated.FileWithHistory{
-		Id:               f.Id,
-		FileName:         f.FileName,
-		FileSize:         f.FileSize,
-		Status:           generated.FileWithHistoryStatus(f.Status),
-		ErrorMessage:     f.ErrorMessage,
-		DeliveryId:       f.DeliveryId,
-		ProductId:        f.ProductId,
-		SourceId:         f.SourceId,
-		ExpectedChecksum: f.ExpectedChecksum,
-		ReleasedAt:       f.ReleasedAt,
-		Skipped:          f.Skipped,
+	publisher, err := h.hooks.GetNatsPublisher(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "NATS publisher not found")
+		return
 	}
 
-	history := make([]generated.DownloadEntry, 0, len(file.DownloadEntries))
-	for _, e := range file.DownloadEntries {
-		history = append(history, convertDownloadEntry(e))
+	if req.Name != nil {
+		publisher.Name = *req.Name
+	}
+	if req.Url != nil {
+		publisher.URL = *req.Url
+	}
+	if req.Subject != nil {
+		publisher.Subject = *req.Subject
+	}
+	if req.JetStream != nil {
+		publisher.JetStream = *req.JetStream
+	}
+	if req.Events != nil {
+		publisher.Events = hooks.EncodeList(*req.Events)
+	}
+	if req.SourceIds != nil {
+		publisher.Sources = hooks.EncodeList(*req.SourceIds)
+	}
+	if req.ProductIds != nil {
+		publisher.Products = hooks.EncodeList(*req.ProductIds)
+	}
+	if req.Enabled != nil {
+		publisher.Enabled = *req.Enabled
+	}
+	if err := hooks.ValidateNatsPublisher(publisher); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	result.DownloadHistory = &history
-
-	writeJSON(w, http.StatusOK, result)
-}
 
-func (h *Handler) DeleteFile(w http.ResponseWriter, r *http.Request, id string) {
-	// Find the most recent completed download entry
-	var entry database.DownloadEntry
-	if err := h.db.Where("file_id = ? AND status = ?", id, "completed").Order("completed_at DESC").First(&entry).Error; err != nil {
-		writeError(w, http.StatusNotFound, "No downloaded file found")
+	if err := h.hooks.UpdateNatsPublisher(publisher); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update NATS publisher")
 		return
 	}
+	writeJSON(w, http.StatusOK, convertNatsPublisher(*publisher))
+}
 
-	// Delete the file from disk
-	if entry.LocalPath != "" {
-		if err := os.Remove(entry.LocalPath); err != nil && !os.IsNotExist(err) {
-			slog.Error("Failed to delete file", "path", entry.LocalPath, "error", err)
-			writeError(w, http.StatusInternalServerError, "Failed to delete file")
+func (h *Handler) DeleteNatsPublisher(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.hooks.DeleteNatsPublisher(uint(id)); err != nil {
+		if errors.Is(err, hooks.ErrNatsPublisherNotFound) {
+			writeError(w, http.StatusNotFound, "NATS publisher not found")
 			return
 		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete NATS publisher")
+		return
 	}
-
-	// Update download entry status to deleted
-	h.db.Model(&entry).Update("status", "deleted")
-
-	slog.Info("File deleted", "fileID", id, "path", entry.LocalPath)
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) DownloadFile(w http.ResponseWriter, r *http.Request, id string) {
-	go func() {
-		ctx := context.Background()
-		h.downloader.Download(ctx, id)
-	}()
-
-	w.WriteHeader(http.StatusAccepted)
-}
+// Slack notifier handlers
 
-func (h *Handler) CancelDownload(w http.ResponseWriter, r *http.Request, id string) {
-	if err := h.downloader.Cancel(id); err != nil {
-		writeError(w, http.StatusNotFound, "Download not found or not in progress")
+func (h *Handler) ListSlackNotifiers(w http.ResponseWriter, r *http.Request) {
+	notifiers, err := h.hooks.ListSlackNotifiers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list Slack notifiers")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	result := make([]generated.SlackNotifier, 0, len(notifiers))
+	for _, n := range notifiers {
+		result = append(result, convertSlackNotifier(n))
+	}
+	writeJSON(w, http.StatusOK, result)
 }
 
-func (h *Handler) SkipFile(w http.ResponseWriter, r *http.Request, id string) {
-	if err := h.db.Model(&database.File{}).Where("id = ?", id).Update("skipped", true).Error; err != nil {
-		writeError(w, http.StatusNotFound, "File not found")
+func (h *Handler) CreateSlackNotifier(w http.ResponseWriter, r *http.Request) {
+	var req generated.CreateSlackNotifierRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-}
-
-func (h *Handler) UnskipFile(w http.ResponseWriter, r *http.Request, id string) {
-	if err := h.db.Model(&database.File{}).Where("id = ?", id).Update("skipped", false).Error; err != nil {
-		writeError(w, http.StatusNotFound, "File not found")
+	notifier := &database.SlackNotifier{
+		Name:    req.Name,
+		Events:  hooks.EncodeList(req.Events),
+		Enabled: true,
+	}
+	if req.WebhookUrl != nil {
+		notifier.WebhookURL = *req.WebhookUrl
+	}
+	if req.BotToken != nil {
+		notifier.BotToken = *req.BotToken
+	}
+	if req.Channel != nil {
+		notifier.Channel = *req.Channel
+	}
+	if req.SourceIds != nil {
+		notifier.Sources = hooks.EncodeList(*req.SourceIds)
+	}
+	if req.ProductIds != nil {
+		notifier.Products = hooks.EncodeList(*req.ProductIds)
+	}
+	if req.Template != nil {
+		notifier.Template = *req.Template
+	}
+	if err := hooks.ValidateSlackNotifier(notifier); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	if err := h.hooks.CreateSlackNotifier(notifier); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create Slack notifier")
+		return
+	}
+	writeJSON(w, http.StatusCreated, convertSlackNotifier(*notifier))
 }
 
-// Download handlers
+func (h *Handler) UpdateSlackNotifier(w http.ResponseWriter, r *http.Request, id int) {
+	var req generated.UpdateSlackNotifierRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
 
-func (h *Handler) ListDownloads(w http.ResponseWriter, r *http.Request, params generated.ListDownloadsParams) {
-	var entries []database.DownloadEntry
-	var total int64
+	notifier, err := h.hooks.GetSlackNotifier(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Slack notifier not found")
+		return
+	}
 
-	query := h.db.DB.Model(&database.DownloadEntry{})
+	if req.Name != nil {
+		notifier.Name = *req.Name
+	}
+	if req.WebhookUrl != nil {
+		notifier.WebhookURL = *req.WebhookUrl
+	}
+	if req.BotToken != nil {
+		notifier.BotToken = *req.BotToken
+	}
+	if req.Channel != nil {
+		notifier.Channel = *req.Channel
+	}
+	if req.Events != nil {
+		notifier.Events = hooks.EncodeList(*req.Events)
+	}
+	if req.SourceIds != nil {
+		notifier.Sources = hooks.EncodeList(*req.SourceIds)
+	}
+	if req.ProductIds != nil {
+		notifier.Products = hooks.EncodeList(*req.ProductIds)
+	}
+	if req.Template != nil {
+		notifier.Template = *req.Template
+	}
+	if req.Enabled != nil {
+		notifier.Enabled = *req.Enabled
+	}
+	if err := hooks.ValidateSlackNotifier(notifier); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if params.Status != nil {
-		query = query.Where("status = ?", *params.Status)
+	if err := h.hooks.UpdateSlackNotifier(notifier); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update Slack notifier")
+		return
 	}
+	writeJSON(w, http.StatusOK, convertSlackNotifier(*notifier))
+}
 
-	query.Count(&total)
+func (h *Handler) DeleteSlackNotifier(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.hooks.DeleteSlackNotifier(uint(id)); err != nil {
+		if errors.Is(err, hooks.ErrSlackNotifierNotFound) {
+			writeError(w, http.StatusNotFound, "Slack notifier not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete Slack notifier")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	offset := 0
-	limit := 50
-	if params.Offset != nil {
-		offset = *params.Offset
+// Catalog handlers
+
+func (h *Handler) ListCatalogSnapshots(w http.ResponseWriter, r *http.Request, params generated.ListCatalogSnapshotsParams) {
+	query := h.db.Model(&database.CatalogSnapshot{})
+	if params.SourceId != nil {
+		query = query.Where("source_id = ?", *params.SourceId)
 	}
-	if params.Limit != nil {
-		limit = *params.Limit
+	if params.ProductId != nil {
+		query = query.Where("product_id = ?", *params.ProductId)
 	}
 
-	if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&entries).Error; err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to list downloads")
+	var snapshots []database.CatalogSnapshot
+	if err := query.Omit("file_ids").Order("snapshot_date DESC, product_id").Find(&snapshots).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list catalog snapshots")
 		return
 	}
 
-	result := make([]generated.DownloadEntry, 0, len(entries))
-	for _, e := range entries {
-		result = append(result, convertDownloadEntry(e))
+	result := make([]generated.CatalogSnapshot, 0, len(snapshots))
+	for _, s := range snapshots {
+		date, _ := time.Parse(database.SnapshotDateFormat, s.SnapshotDate)
+		result = append(result, generated.CatalogSnapshot{
+			ProductId: s.ProductID,
+			SourceId:  s.SourceID,
+			Date:      openapi_types.Date{Time: date},
+			FileCount: s.FileCount,
+			TotalSize: s.TotalSize,
+		})
 	}
 
-	writeJSON(w, http.StatusOK, generated.DownloadListResponse{
-		Downloads: result,
-		Total:     int(total),
-	})
+	writeJSON(w, http.StatusOK, result)
 }
 
-func (h *Handler) StreamActiveDownloads(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx/traefik buffering
-
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		writeError(w, http.StatusInternalServerError, "Streaming not supported")
+func (h *Handler) GetCatalogDiff(w http.ResponseWriter, r *http.Request, params generated.GetCatalogDiffParams) {
+	if params.To.Before(params.From.Time) {
+		writeError(w, http.StatusBadRequest, "'to' must not be before 'from'")
 		return
 	}
 
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-r.Context().Done():
-			return
-		case <-ticker.C:
-			downloads := h.downloader.ActiveDownloads()
-			data, _ := json.Marshal(downloads)
-			fmt.Fprintf(w, "data: %s\n\n", data)
-			flusher.Flush()
-		}
+	query := h.db.Model(&database.Product{}).
+		Where("id IN (?)", h.db.Model(&database.CatalogSnapshot{}).Select("product_id"))
+	if params.SourceId != nil {
+		query = query.Where("source_id = ?", *params.SourceId)
+	}
+	if params.ProductId != nil {
+		query = query.Where("id = ?", *params.ProductId)
 	}
-}
-
-// Schedule handlers
 
-func (h *Handler) GetSchedule(w http.ResponseWriter, r *http.Request) {
 	var products []database.Product
-	if err := h.db.Find(&products).Error; err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to get schedule")
+	if err := query.Order("id").Find(&products).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load products")
 		return
 	}
 
-	result := make([]generated.ProductSchedule, 0, len(products))
+	result := generated.CatalogDiff{
+		From:     params.From,
+		To:       params.To,
+		Products: []generated.CatalogProductDiff{},
+	}
 	for _, p := range products {
-		schedule := generated.ProductSchedule{
-			ProductId:    p.ID,
-			ProductName:  p.Name,
-			AutoDownload: p.AutoDownload,
+		fromSnapshot, err := h.db.CatalogSnapshotAt(p.ID, params.From.Time)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to load catalog snapshot")
+			return
 		}
-		if p.CheckWindowStart != "" {
-			schedule.CheckWindowStart = &p.CheckWindowStart
+		toSnapshot, err := h.db.CatalogSnapshotAt(p.ID, params.To.Time)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to load catalog snapshot")
+			return
 		}
-		if p.CheckWindowEnd != "" {
-			schedule.CheckWindowEnd = &p.CheckWindowEnd
+
+		diff := generated.CatalogProductDiff{
+			ProductId:   p.ID,
+			ProductName: p.Name,
+			SourceId:    p.SourceID,
 		}
-		if nextRun := h.scheduler.GetNextRun(p.ID); nextRun != nil {
-			schedule.NextRun = nextRun
+		var before, after []string
+		if fromSnapshot != nil {
+			before = fromSnapshot.Files()
+			diff.FromSnapshot = snapshotDate(fromSnapshot)
 		}
-		result = append(result, schedule)
+		if toSnapshot != nil {
+			after = toSnapshot.Files()
+			diff.ToSnapshot = snapshotDate(toSnapshot)
+		}
+		diff.FromCount = len(before)
+		diff.ToCount = len(after)
+
+		added, removed := diffIDs(before, after)
+		diff.Added = h.catalogFiles(added)
+		diff.Removed = h.catalogFiles(removed)
+
+		result.TotalAdded += len(added)
+		result.TotalRemoved += len(removed)
+		result.Products = append(result.Products, diff)
 	}
 
 	writeJSON(w, http.StatusOK, result)
 }
 
-func (h *Handler) UpdateProductSchedule(w http.ResponseWriter, r *http.Request, productID string) {
-	var req generated.UpdateScheduleRequest
-	if err := decodeJSON(r, &req); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
-		return
+func snapshotDate(s *database.CatalogSnapshot) *openapi_types.Date {
+	date, err := time.Parse(database.SnapshotDateFormat, s.SnapshotDate)
+	if err != nil {
+		return nil
 	}
+	return &openapi_types.Date{Time: date}
+}
 
-	var product database.Product
-	if err := h.db.First(&product, "id = ?", productID).Error; err != nil {
-		writeError(w, http.StatusNotFound, "Product not found")
-		return
+// diffIDs returns the IDs only in after (added) and only in before (removed)
+func diffIDs(before, after []string) (added, removed []string) {
+	inBefore := make(map[string]bool, len(before))
+	for _, id := range before {
+		inBefore[id] = true
+	}
+	inAfter := make(map[string]bool, len(after))
+	for _, id := range after {
+		inAfter[id] = true
+		if !inBefore[id] {
+			added = append(added, id)
+		}
+	}
+	for _, id := range before {
+		if !inAfter[id] {
+			removed = append(removed, id)
+		}
 	}
+	return added, removed
+}
 
-	wasAutoDownload := product.AutoDownload
+const catalogLookupChunk = 500
 
-	if req.AutoDownload != nil {
-		product.AutoDownload = *req.AutoDownload
+// catalogFiles resolves file names for catalog file IDs
+func (h *Handler) catalogFiles(ids []string) []generated.CatalogFile {
+	result := make([]generated.CatalogFile, 0, len(ids))
+	if len(ids) == 0 {
+		return result
 	}
-	if req.CheckWindowStart != nil {
-		product.CheckWindowStart = *req.CheckWindowStart
+
+	// Look up names in chunks to stay below database parameter limits
+	names := make(map[string]string, len(ids))
+	for start := 0; start < len(ids); start += catalogLookupChunk {
+		end := min(start+catalogLookupChunk, len(ids))
+		var files []database.File
+		h.db.Select("id", "file_name").Where("id IN ?", ids[start:end]).Find(&files)
+		for _, f := range files {
+			names[f.ID] = f.FileName
+		}
 	}
-	if req.CheckWindowEnd != nil {
-		product.CheckWindowEnd = *req.CheckWindowEnd
+
+	for _, id := range ids {
+		file := generated.CatalogFile{Id: id}
+		if name, ok := names[id]; ok {
+			file.FileName = &name
+		}
+		result = append(result, file)
+	}
+	return result
+}
+
+// System handlers
+
+func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	uptime := time.Since(startTime).String()
+	version := buildinfo.Version
+
+	writeJSON(w, http.StatusOK, generated.HealthResponse{
+		Status:  "healthy",
+		Uptime:  &uptime,
+		Version: &version,
+	})
+}
+
+func (h *Handler) GetBuildInfo(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, h.buildInfo.OpenMetrics())
+		return
+	}
+
+	skew := h.buildInfo.Skew()
+	if skew == nil {
+		skew = []string{}
 	}
+	writeJSON(w, http.StatusOK, generated.BuildInfo{
+		Version:      h.buildInfo.Version,
+		ApiVersion:   h.buildInfo.APIVersion,
+		GoVersion:    h.buildInfo.GoVersion,
+		UiVersion:    h.buildInfo.UIVersion,
+		UiApiVersion: h.buildInfo.UIAPIVersion,
+		UiHash:       h.buildInfo.UIHash,
+		Skew:         skew,
+	})
+}
 
-	// Validate schedule before saving
-	if err := h.scheduler.ScheduleProduct(&product); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid schedule: "+err.Error())
+func (h *Handler) GetTelemetryPreview(w http.ResponseWriter, r *http.Request) {
+	if h.telemetry == nil {
+		writeError(w, http.StatusServiceUnavailable, "Telemetry not available")
 		return
 	}
 
-	if err := h.db.Save(&product).Error; err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to update schedule")
+	payload, err := h.telemetry.Payload()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to build telemetry payload")
 		return
 	}
 
-	// If auto-download was just enabled, trigger immediate download of pending files
-	if product.AutoDownload && !wasAutoDownload {
-		go h.downloadPendingFiles(product.ID)
+	endpoint := h.telemetry.Endpoint()
+	writeJSON(w, http.StatusOK, generated.TelemetryPreview{
+		Enabled:  h.telemetry.Enabled(),
+		Endpoint: &endpoint,
+		Payload: generated.TelemetryPayload{
+			InstanceId:           payload.InstanceID,
+			Version:              payload.Version,
+			Os:                   payload.OS,
+			Arch:                 payload.Arch,
+			DbDriver:             payload.DBDriver,
+			EnabledSources:       payload.EnabledSources,
+			EnabledPlugins:       payload.EnabledPlugins,
+			Products:             payload.Products,
+			AutoDownloadProducts: payload.AutoDownloadProducts,
+			Files:                payload.Files,
+			CompletedDownloads:   payload.CompletedDownloads,
+			Webhooks:             payload.Webhooks,
+		},
+	})
+}
+
+func (h *Handler) ImportFiles(w http.ResponseWriter, r *http.Request) {
+	var req generated.ImportRequest
+	if err := decodeJSON(r, &req); err != nil || req.Path == "" {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
 	}
 
-	schedule := generated.ProductSchedule{
-		ProductId:    product.ID,
-		ProductName:  product.Name,
-		AutoDownload: product.AutoDownload,
+	path, err := database.CheckImportPath(req.Path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	if product.CheckWindowStart != "" {
-		schedule.CheckWindowStart = &product.CheckWindowStart
+	// Imported files can be fetched through the API, so only directories the
+	// operator allowed are taken
+	if !config.PathWithin(path, h.importRoots) {
+		writeError(w, http.StatusForbidden, "Import path is not below BULK_LOADER_IMPORT_ROOTS")
+		return
 	}
-	if nextRun := h.scheduler.GetNextRun(product.ID); nextRun != nil {
-		schedule.NextRun = nextRun
+	opts := database.ImportOptions{
+		Verify: req.Verify != nil && *req.Verify,
+		DryRun: req.DryRun != nil && *req.DryRun,
+		Progress: func(files int) {
+			h.updateImport(func(job *generated.ImportJob) { job.FilesExamined = files })
+		},
 	}
 
-	writeJSON(w, http.StatusOK, schedule)
+	h.importMu.Lock()
+	if h.importJob != nil && h.importJob.Status == generated.ImportJobStatusRunning {
+		h.importMu.Unlock()
+		writeError(w, http.StatusConflict, "Import already running")
+		return
+	}
+	h.importJob = &generated.ImportJob{
+		Path:      path,
+		Verify:    opts.Verify,
+		DryRun:    opts.DryRun,
+		Status:    generated.ImportJobStatusRunning,
+		StartedAt: time.Now(),
+	}
+	job := *h.importJob
+	h.importMu.Unlock()
+
+	// Walking and hashing terabytes outlasts any request
+	go h.runImport(path, opts)
+
+	writeJSON(w, http.StatusAccepted, job)
 }
 
-// Webhook handlers
+func (h *Handler) GetImportJob(w http.ResponseWriter, r *http.Request) {
+	h.importMu.Lock()
+	var job generated.ImportJob
+	ok := h.importJob != nil
+	if ok {
+		job = *h.importJob
+	}
+	h.importMu.Unlock()
 
-func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
-	webhooks, err := h.hooks.ListWebhooks()
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to list webhooks")
+	if !ok {
+		writeError(w, http.StatusNotFound, "No import ran yet")
 		return
 	}
+	writeJSON(w, http.StatusOK, job)
+}
 
-	result := make([]generated.Webhook, 0, len(webhooks))
-	for _, wh := range webhooks {
-		result = append(result, convertWebhook(wh))
+// runImport runs an import started by ImportFiles and records its report
+func (h *Handler) runImport(path string, opts database.ImportOptions) {
+	report, err := h.db.ImportFiles(path, opts, time.Now())
+	if err != nil {
+		slog.Error("Failed to import files", "path", path, "error", err)
+	} else if !opts.DryRun && len(report.Imported) > 0 {
+		slog.Info("Imported files", "path", path, "count", len(report.Imported))
 	}
 
-	writeJSON(w, http.StatusOK, result)
+	h.updateImport(func(job *generated.ImportJob) {
+		now := time.Now()
+		job.CompletedAt = &now
+		if err != nil {
+			msg := err.Error()
+			job.ErrorMessage = &msg
+			job.Status = generated.ImportJobStatusFailed
+			return
+		}
+		job.Status = generated.ImportJobStatusCompleted
+		job.Report = &generated.ImportReport{
+			Imported:   convertStoredFiles(report.Imported),
+			Skipped:    convertStoredFiles(report.Skipped),
+			Mismatched: report.Mismatched,
+			Ambiguous:  report.Ambiguous,
+			Unmatched:  report.Unmatched,
+			DryRun:     report.DryRun,
+		}
+	})
 }
 
-func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
-	var req generated.CreateWebhookRequest
-	if err := decodeJSON(r, &req); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
+// updateImport applies update to the progress of the current import
+func (h *Handler) updateImport(update func(*generated.ImportJob)) {
+	h.importMu.Lock()
+	defer h.importMu.Unlock()
+
+	if h.importJob != nil {
+		update(h.importJob)
+	}
+}
+
+func (h *Handler) GetReconcileReport(w http.ResponseWriter, r *http.Request) {
+	report := h.scheduler.LastReconcile()
+	if report == nil {
+		writeError(w, http.StatusNotFound, "No reconciliation ran yet")
 		return
 	}
+	writeJSON(w, http.StatusOK, convertReconcileReport(report))
+}
 
-	webhook, err := h.hooks.CreateWebhook(req.Name, req.Url, req.Events)
+func (h *Handler) Reconcile(w http.ResponseWriter, r *http.Request, params generated.ReconcileParams) {
+	fix := params.Fix != nil && *params.Fix
+	report, err := h.scheduler.Reconcile(fix)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to create webhook")
+		slog.Error("Failed to reconcile downloads directory", "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to reconcile downloads directory")
 		return
 	}
-
-	writeJSON(w, http.StatusCreated, convertWebhook(*webhook))
+	writeJSON(w, http.StatusOK, convertReconcileReport(report))
 }
 
-func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request, id int) {
-	var req generated.UpdateWebhookRequest
-	if err := decodeJSON(r, &req); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
+func (h *Handler) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	if h.reloader == nil {
+		writeError(w, http.StatusServiceUnavailable, "Reload not available")
 		return
 	}
 
-	webhook, err := h.hooks.GetWebhook(uint(id))
+	result, err := h.reloader.Reload()
 	if err != nil {
-		writeError(w, http.StatusNotFound, "Webhook not found")
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	name := webhook.Name
-	url := webhook.URL
-	events := hooks.ParseEvents(webhook.Events)
-	enabled := webhook.Enabled
-
-	if req.Name != nil {
-		name = *req.Name
+	restartRequired := result.RestartRequired
+	if restartRequired == nil {
+		restartRequired = []string{}
 	}
-	if req.Url != nil {
-		url = *req.Url
+	writeJSON(w, http.StatusOK, generated.ReloadResponse{
+		MaxConcurrent:      result.MaxConcurrent,
+		DownloadTimeout:    result.DownloadTimeout,
+		PostProcessWorkers: result.PostProcessWorkers,
+		Schedules:          result.Schedules,
+		RestartRequired:    restartRequired,
+	})
+}
+
+func (h *Handler) GetState(w http.ResponseWriter, r *http.Request) {
+	state, err := h.db.ExportState()
+	if err != nil {
+		slog.Error("Failed to export state", "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to export state")
+		return
 	}
-	if req.Events != nil {
-		events = *req.Events
+	if h.audit != nil {
+		for _, source := range state.Sources {
+			if len(source.CredentialsEnc) > 0 {
+				h.audit.AuditCredentials(r.Context(), source.ID, sources.CredentialsExported)
+			}
+		}
 	}
-	if req.Enabled != nil {
-		enabled = *req.Enabled
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	clearWriteDeadline(w)
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		json.NewEncoder(w).Encode(state)
+		return
 	}
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	defer gz.Close()
+	json.NewEncoder(gz).Encode(state)
+}
 
-	if err := h.hooks.UpdateWebhook(uint(id), name, url, events, enabled); err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to update webhook")
+func (h *Handler) CreateBackup(w http.ResponseWriter, r *http.Request, params generated.CreateBackupParams) {
+	scope := database.BackupFull
+	if params.Scope != nil {
+		scope = string(*params.Scope)
+	}
+	if !database.ValidBackupScope(scope) {
+		writeError(w, http.StatusBadRequest, "Unknown backup scope")
 		return
 	}
+	if h.audit != nil {
+		var sourceList []database.Source
+		h.db.Unscoped().Find(&sourceList)
+		for _, source := range sourceList {
+			if len(source.CredentialsEnc) > 0 {
+				h.audit.AuditCredentials(r.Context(), source.ID, sources.CredentialsExported)
+			}
+		}
+	}
 
-	updated, _ := h.hooks.GetWebhook(uint(id))
-	writeJSON(w, http.StatusOK, convertWebhook(*updated))
+	createdAt := time.Now().UTC()
+	filename := fmt.Sprintf("bulk-file-loader-%s-%s.json.gz", scope, createdAt.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	clearWriteDeadline(w)
+	gz := gzip.NewWriter(w)
+	if err := h.db.WriteBackup(gz, scope, createdAt); err != nil {
+		// The archive is cut short, so clients see it as corrupt
+		slog.Error("Failed to create backup", "error", err)
+		return
+	}
+	gz.Close()
 }
 
-func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request, id int) {
-	if err := h.hooks.DeleteWebhook(uint(id)); err != nil {
-		writeError(w, http.StatusNotFound, "Webhook not found")
+func (h *Handler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	if active := h.downloader.ActiveDownloads(); len(active) > 0 {
+		writeError(w, http.StatusConflict, fmt.Sprintf("%d downloads are running; cancel them first", len(active)))
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	// Accept the archive as downloaded or already decompressed, up to the
+	// restore limit either way
+	body := bufio.NewReader(http.MaxBytesReader(w, r.Body, h.restoreLimit))
+	var reader io.Reader = body
+	if magic, _ := body.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid backup: "+err.Error())
+			return
+		}
+		defer gz.Close()
+		reader = http.MaxBytesReader(w, gz, h.restoreLimit)
+	}
+	var backup database.Backup
+	if err := json.NewDecoder(reader).Decode(&backup); err != nil {
+		if tooLarge := new(http.MaxBytesError); errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Backup exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, "Invalid backup: "+err.Error())
+		return
+	}
+
+	rows, err := h.db.RestoreBackup(&backup)
+	if errors.Is(err, database.ErrInvalidBackup) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to restore backup", "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to restore backup")
+		return
+	}
+	slog.Info("Restored backup", "scope", backup.Scope, "createdAt", backup.CreatedAt, "rows", rows)
+
+	// The restored settings carry the encryption salt of the backed up host
+	h.auth.ReloadEncryptionKey()
+	h.scheduler.Reload()
+	writeJSON(w, http.StatusOK, generated.RestoreResponse{Scope: backup.Scope, Rows: rows})
 }
 
-// System handlers
+func (h *Handler) GetStandbyStatus(w http.ResponseWriter, r *http.Request) {
+	if h.standby == nil {
+		writeJSON(w, http.StatusOK, generated.StandbyStatus{Role: generated.StandbyStatusRolePrimary})
+		return
+	}
+	writeJSON(w, http.StatusOK, convertStandbyStatus(h.standby.Status()))
+}
 
-func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	uptime := time.Since(startTime).String()
-	version := "0.1.0"
+func (h *Handler) PromoteStandby(w http.ResponseWriter, r *http.Request) {
+	if h.standby == nil {
+		writeError(w, http.StatusConflict, standby.ErrNotStandby.Error())
+		return
+	}
 
-	writeJSON(w, http.StatusOK, generated.HealthResponse{
-		Status:  "healthy",
-		Uptime:  &uptime,
-		Version: &version,
-	})
+	status, err := h.standby.Promote()
+	if errors.Is(err, standby.ErrNotStandby) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, convertStandbyStatus(status))
 }
 
 func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
@@ -869,7 +3650,7 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 	h.db.Model(&database.File{}).
 		Joins("JOIN products ON products.id = files.product_id").
 		Where("products.auto_download = ?", true).
-		Where("files.skipped = ?", false).
+		Where("files.skipped = ? AND files.expired = ? AND files.archived_at IS NULL", false, false).
 		Where("files.id NOT IN (SELECT DISTINCT file_id FROM download_entries)").
 		Count(&pendingFiles)
 
@@ -890,8 +3671,100 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+// likeEscaper escapes LIKE wildcards with '!', which all supported databases
+// accept as an ESCAPE character
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request, params generated.SearchParams) {
+	q := strings.ToLower(strings.TrimSpace(params.Q))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "Search query is required")
+		return
+	}
+	limit := defaultSearchLimit
+	if params.Limit != nil && *params.Limit > 0 {
+		limit = min(*params.Limit, maxSearchLimit)
+	}
+	pattern := "%" + likeEscaper.Replace(q) + "%"
+	matches := "(LOWER(id) LIKE ? ESCAPE '!' OR LOWER(%s) LIKE ? ESCAPE '!')"
+
+	result := generated.SearchResponse{
+		Sources:    []generated.Source{},
+		Products:   []generated.Product{},
+		Deliveries: []generated.Delivery{},
+		Files:      []generated.File{},
+	}
+
+	// Sources are few and come from the registry, so they're matched here
+	sourceInfos, err := h.registry.ListSources()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to search")
+		return
+	}
+	for _, si := range sourceInfos {
+		if len(result.Sources) == limit {
+			break
+		}
+		if strings.Contains(strings.ToLower(si.ID), q) || strings.Contains(strings.ToLower(si.Name), q) {
+			result.Sources = append(result.Sources, convertSource(si))
+		}
+	}
+
+	var products []database.Product
+	var deliveries []database.Delivery
+	var files []database.File
+	err = errors.Join(
+		h.db.Where(fmt.Sprintf(matches, "name"), pattern, pattern).Where("hidden = ?", false).
+			Order("name").Limit(limit).Find(&products).Error,
+		h.db.Where(fmt.Sprintf(matches, "name"), pattern, pattern).Where("archived_at IS NULL").
+			Order("name").Limit(limit).Find(&deliveries).Error,
+		h.db.Where(fmt.Sprintf(matches, "file_name"), pattern, pattern).Where("archived_at IS NULL").
+			Preload("Tags").Preload("Metadata").Order("file_name").Limit(limit).Find(&files).Error,
+	)
+	if err != nil {
+		slog.Error("Search failed", "query", q, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to search")
+		return
+	}
+	for _, p := range products {
+		result.Products = append(result.Products, convertProduct(p))
+	}
+	for _, d := range deliveries {
+		result.Deliveries = append(result.Deliveries, convertDelivery(d))
+	}
+	for _, f := range files {
+		result.Files = append(result.Files, convertFile(f))
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
 // Conversion helpers
 
+func convertStandbyStatus(s standby.Status) generated.StandbyStatus {
+	status := generated.StandbyStatus{
+		Role:       generated.StandbyStatusRole(s.Role),
+		LastSyncAt: s.LastSyncAt,
+		PromotedAt: s.PromotedAt,
+		Syncs:      s.Syncs,
+		Files:      s.Files,
+	}
+	if s.PrimaryURL != "" {
+		status.PrimaryUrl = &s.PrimaryURL
+		interval := int(s.Interval.Seconds())
+		status.IntervalSeconds = &interval
+	}
+	if s.LastError != "" {
+		status.LastError = &s.LastError
+	}
+	return status
+}
+
 func convertProduct(p database.Product) generated.Product {
 	result := generated.Product{
 		Id:           p.ID,
@@ -911,6 +3784,40 @@ func convertProduct(p database.Product) generated.Product {
 	if p.LastCheckedAt != nil {
 		result.LastCheckedAt = p.LastCheckedAt
 	}
+	result.LastSyncedAt = p.LastSyncedAt
+	result.SyncFailures = &p.SyncFailures
+	result.SyncDisabledAt = p.SyncDisabledAt
+	result.SyncWatermark = p.SyncWatermark
+	if p.DeletedAt.Valid {
+		result.DeletedAt = &p.DeletedAt.Time
+	}
+	result.Hidden = &p.Hidden
+	result.Favorite = &p.Favorite
+	if tags := p.TagList(); len(tags) > 0 {
+		result.Tags = &tags
+	}
+	if validators := p.ValidatorList(); len(validators) > 0 {
+		result.Validators = &validators
+	}
+	var steps []generated.PipelineStep
+	if json.Unmarshal([]byte(p.Pipeline), &steps) == nil && len(steps) > 0 {
+		result.Pipeline = &steps
+	}
+	if p.StorageQuota > 0 {
+		action := generated.QuotaAction(p.QuotaAction)
+		result.StorageQuota = &p.StorageQuota
+		result.QuotaAction = &action
+	}
+	if include := p.IncludeList(); len(include) > 0 {
+		result.IncludePatterns = &include
+	}
+	if exclude := p.ExcludeList(); len(exclude) > 0 {
+		result.ExcludePatterns = &exclude
+	}
+	if p.ReleasedAfter != nil {
+		result.ReleasedAfter = &openapi_types.Date{Time: *p.ReleasedAfter}
+	}
+	result.SkipFiltered = &p.SkipFiltered
 	return result
 }
 
@@ -929,19 +3836,22 @@ func convertDelivery(d database.Delivery) generated.Delivery {
 	if d.ExpiresAt != nil {
 		result.ExpiresAt = d.ExpiresAt
 	}
+	if d.ExpiryRemindedAt != nil {
+		expiring := true
+		result.Expiring = &expiring
+	}
 	return result
 }
 
-func convertFile(f database.File, db *database.DB) generated.File {
-	status, errorMsg := deriveFileStatusAndError(f, db)
+func convertFile(f database.File) generated.File {
 	result := generated.File{
 		Id:       f.ID,
 		FileName: f.FileName,
 		FileSize: &f.FileSize,
-		Status:   generated.FileStatus(status),
+		Status:   generated.FileStatus(f.Status),
 	}
-	if errorMsg != "" {
-		result.ErrorMessage = &errorMsg
+	if f.ErrorMessage != "" {
+		result.ErrorMessage = &f.ErrorMessage
 	}
 	if f.DeliveryID != "" {
 		result.DeliveryId = &f.DeliveryID
@@ -959,37 +3869,63 @@ func convertFile(f database.File, db *database.DB) generated.File {
 		result.ReleasedAt = f.ReleasedAt
 	}
 	result.Skipped = &f.Skipped
+	if f.DeletedAt.Valid {
+		result.DeletedAt = &f.DeletedAt.Time
+	}
+	result.ArchivedAt = f.ArchivedAt
+	if len(f.Tags) > 0 {
+		tags := make([]string, 0, len(f.Tags))
+		for _, t := range f.Tags {
+			tags = append(tags, t.Tag)
+		}
+		result.Tags = &tags
+	}
+	if len(f.Metadata) > 0 {
+		metadata := make(map[string]string, len(f.Metadata))
+		for _, m := range f.Metadata {
+			metadata[m.Key] = m.Value
+		}
+		result.Metadata = &metadata
+	}
 	return result
 }
 
-func deriveFileStatusAndError(f database.File, db *database.DB) (string, string) {
-	// Check latest download entry
-	var entry database.DownloadEntry
-	err := db.Where("file_id = ?", f.ID).Order("created_at DESC").First(&entry).Error
-	if err == nil {
-		switch entry.Status {
-		case database.DownloadStatusDownloading:
-			return "downloading", ""
-		case database.DownloadStatusCompleted:
-			// Check if file exists on disk
-			if entry.LocalPath != "" {
-				if _, err := os.Stat(entry.LocalPath); err == nil {
-					return "downloaded", ""
-				}
-			}
-			return "deleted", ""
-		case database.DownloadStatusFailed:
-			return "failed", entry.ErrorMessage
-		case database.DownloadStatusCancelled:
-			return "cancelled", ""
-		}
+func convertStoredFiles(files []database.StoredFile) []generated.StoredFile {
+	result := make([]generated.StoredFile, 0, len(files))
+	for _, f := range files {
+		result = append(result, generated.StoredFile{FileId: f.FileID, Path: f.Path})
 	}
+	return result
+}
 
-	if f.Skipped {
-		return "skipped", ""
+func convertReconcileReport(r *database.ReconcileReport) generated.ReconcileReport {
+	return generated.ReconcileReport{
+		CheckedAt: r.CheckedAt,
+		Missing:   convertStoredFiles(r.Missing),
+		Modified:  convertStoredFiles(r.Modified),
+		Orphaned:  r.Orphaned,
+		Fixed:     r.Fixed,
 	}
+}
 
-	return "available", ""
+func (h *Handler) convertQuarantinedFile(q database.QuarantinedFile) generated.QuarantinedFile {
+	path := h.downloader.QuarantinePath(&q)
+	result := generated.QuarantinedFile{
+		Id:        int(q.ID),
+		FileId:    q.FileID,
+		FileName:  q.File.FileName,
+		SourceId:  q.File.SourceID,
+		ProductId: q.File.ProductID,
+		Reason:    generated.QuarantinedFileReason(q.Reason),
+		Message:   q.Message,
+		Size:      q.Size,
+		Path:      &path,
+		CreatedAt: q.CreatedAt,
+	}
+	if q.Checksum != "" {
+		result.Checksum = &q.Checksum
+	}
+	return result
 }
 
 func convertDownloadEntry(e database.DownloadEntry) generated.DownloadEntry {
@@ -1010,6 +3946,9 @@ func convertDownloadEntry(e database.DownloadEntry) generated.DownloadEntry {
 	if e.LocalChecksum != "" {
 		result.LocalChecksum = &e.LocalChecksum
 	}
+	if e.DuplicateOf != "" {
+		result.DuplicateOf = &e.DuplicateOf
+	}
 	if e.ErrorMessage != "" {
 		result.ErrorMessage = &e.ErrorMessage
 	}
@@ -1022,13 +3961,183 @@ func convertDownloadEntry(e database.DownloadEntry) generated.DownloadEntry {
 	return result
 }
 
+func convertDeadLetter(l database.WebhookDeadLetter) generated.WebhookDeadLetter {
+	result := generated.WebhookDeadLetter{
+		Id:            int(l.ID),
+		WebhookId:     int(l.WebhookID),
+		Event:         l.Event,
+		Attempts:      l.Attempts,
+		LastError:     l.LastError,
+		CreatedAt:     l.CreatedAt,
+		LastAttemptAt: l.UpdatedAt,
+	}
+	json.Unmarshal(l.Payload, &result.Payload)
+	return result
+}
+
+func convertEvent(e database.Event) generated.EventLogEntry {
+	result := generated.EventLogEntry{
+		Id:        int(e.ID),
+		Type:      e.Type,
+		Source:    e.Source,
+		CreatedAt: e.CreatedAt,
+	}
+	json.Unmarshal(e.Payload, &result.Event)
+	return result
+}
+
+func convertAuditEntry(e database.AuditEntry) generated.CredentialAuditEntry {
+	return generated.CredentialAuditEntry{
+		Id:        int(e.ID),
+		Source:    e.Source,
+		Action:    generated.CredentialAuditEntryAction(e.Action),
+		Actor:     e.Actor,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+func convertChatNotifier(n database.ChatNotifier) generated.ChatNotifier {
+	events := hooks.ParseEvents(n.Events)
+	if events == nil {
+		events = []string{}
+	}
+	result := generated.ChatNotifier{
+		Id:        int(n.ID),
+		Name:      n.Name,
+		Platform:  n.Platform,
+		Events:    events,
+		Enabled:   n.Enabled,
+		CreatedAt: &n.CreatedAt,
+	}
+	if sources := hooks.ParseIDs(n.Sources); len(sources) > 0 {
+		result.SourceIds = &sources
+	}
+	if products := hooks.ParseIDs(n.Products); len(products) > 0 {
+		result.ProductIds = &products
+	}
+	return result
+}
+
+func convertAPIKey(k database.APIKey) generated.ApiKey {
+	result := generated.ApiKey{
+		Id:         int(k.ID),
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		CreatedAt:  k.CreatedAt,
+		LastUsedAt: k.LastUsedAt,
+	}
+	if scopes := auth.ParseScopes(k.Scopes); len(scopes) > 0 {
+		result.Scopes = &scopes
+	}
+	return result
+}
+
+func convertEmailNotifier(n database.EmailNotifier) generated.EmailNotifier {
+	recipients := []openapi_types.Email{}
+	for _, r := range hooks.ParseIDs(n.Recipients) {
+		recipients = append(recipients, openapi_types.Email(r))
+	}
+	events := hooks.ParseEvents(n.Events)
+	if events == nil {
+		events = []string{}
+	}
+	result := generated.EmailNotifier{
+		Id:            int(n.ID),
+		Name:          n.Name,
+		Recipients:    recipients,
+		Events:        events,
+		DigestMinutes: n.DigestMinutes,
+		Enabled:       n.Enabled,
+		CreatedAt:     &n.CreatedAt,
+	}
+	if sources := hooks.ParseIDs(n.Sources); len(sources) > 0 {
+		result.SourceIds = &sources
+	}
+	if products := hooks.ParseIDs(n.Products); len(products) > 0 {
+		result.ProductIds = &products
+	}
+	return result
+}
+
+// convertNatsPublisher returns the publisher with the credentials removed
+// from its URL
+func convertNatsPublisher(p database.NatsPublisher) generated.NatsPublisher {
+	events := hooks.ParseEvents(p.Events)
+	if events == nil {
+		events = []string{}
+	}
+	result := generated.NatsPublisher{
+		Id:        int(p.ID),
+		Name:      p.Name,
+		Url:       nats.Redact(p.URL),
+		Subject:   p.Subject,
+		JetStream: p.JetStream,
+		Events:    events,
+		Enabled:   p.Enabled,
+		CreatedAt: &p.CreatedAt,
+	}
+	if sources := hooks.ParseIDs(p.Sources); len(sources) > 0 {
+		result.SourceIds = &sources
+	}
+	if products := hooks.ParseIDs(p.Products); len(products) > 0 {
+		result.ProductIds = &products
+	}
+	return result
+}
+
+func convertSlackNotifier(n database.SlackNotifier) generated.SlackNotifier {
+	mode := "webhook"
+	if n.WebhookURL == "" {
+		mode = "bot"
+	}
+	events := hooks.ParseEvents(n.Events)
+	if events == nil {
+		events = []string{}
+	}
+	result := generated.SlackNotifier{
+		Id:        int(n.ID),
+		Name:      n.Name,
+		Mode:      mode,
+		Events:    events,
+		Enabled:   n.Enabled,
+		CreatedAt: &n.CreatedAt,
+	}
+	if n.Channel != "" {
+		result.Channel = &n.Channel
+	}
+	if sources := hooks.ParseIDs(n.Sources); len(sources) > 0 {
+		result.SourceIds = &sources
+	}
+	if products := hooks.ParseIDs(n.Products); len(products) > 0 {
+		result.ProductIds = &products
+	}
+	if n.Template != "" {
+		result.Template = &n.Template
+	}
+	return result
+}
+
 func convertWebhook(wh database.Webhook) generated.Webhook {
-	return generated.Webhook{
+	result := generated.Webhook{
 		Id:        int(wh.ID),
 		Name:      wh.Name,
 		Url:       wh.URL,
 		Events:    hooks.ParseEvents(wh.Events),
 		Enabled:   wh.Enabled,
+		Signed:    wh.Secret != "",
 		CreatedAt: &wh.CreatedAt,
 	}
+	if sources := hooks.ParseIDs(wh.Sources); len(sources) > 0 {
+		result.SourceIds = &sources
+	}
+	if products := hooks.ParseIDs(wh.Products); len(products) > 0 {
+		result.ProductIds = &products
+	}
+	if wh.Template != "" {
+		result.Template = &wh.Template
+	}
+	if wh.DigestMinutes > 0 {
+		result.DigestMinutes = &wh.DigestMinutes
+	}
+	return result
 }
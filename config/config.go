@@ -1,65 +1,544 @@
 package config
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+
+	"github.com/patent-dev/bulk-file-loader/internal/blackout"
+)
+
+// Storage layouts of the downloads directory
+const (
+	// LayoutProduct stores files as <source>/<product>/<file name>
+	LayoutProduct = "product"
+	// LayoutCAS stores files once per content as blobs/sha256/<hash>
+	LayoutCAS = "cas"
 )
 
 type Config struct {
-	Passphrase      string
-	DBDriver        string
-	DBDSN           string
-	DataDir         string
-	Port            int
-	MaxConcurrent   int
-	DownloadTimeout int
-	DevMode         bool
-	ViteProxy       string
+	Passphrase string
+	DBDriver   string
+	DBDSN      string
+	DataDir    string
+	// DownloadsDir is where files are downloaded to, by default the
+	// downloads directory in DataDir
+	DownloadsDir string
+	// ListenAddr is the host or IP the HTTP and gRPC servers bind to; empty
+	// binds all interfaces
+	ListenAddr string
+	// Port is the HTTP port; 0 disables TCP when SocketPath is set
+	Port int
+	// SocketPath is an optional unix domain socket to serve on
+	SocketPath    string
+	SocketMode    os.FileMode
+	GRPCPort      int
+	MaxConcurrent int
+	// DownloadTimeout applies to files of unknown size; other downloads get
+	// DownloadMinTimeout plus their size at DownloadMinThroughput (KB/s),
+	// capped at DownloadMaxTimeout
+	DownloadTimeout       int
+	DownloadMinTimeout    int
+	DownloadMaxTimeout    int
+	DownloadMinThroughput int
+	// ShutdownDrain is how long shutdown waits for active downloads in
+	// seconds before checkpointing them for the next start
+	ShutdownDrain int
+	// PostProcessWorkers bounds extraction and post-processing separately
+	// from downloads; PostProcessNice is the niceness of its processes
+	PostProcessWorkers int
+	PostProcessNice    int
+	// PipelineCommands are the executables pipeline transform steps may run;
+	// without any, transform steps are refused
+	PipelineCommands []string
+	// PipelineDirs are the directories, besides the default extraction
+	// directory, pipeline extract and upload steps may write below
+	PipelineDirs []string
+	SyncRetries  int
+	// SyncRetryDelay is the delay before the first sync retry in seconds
+	SyncRetryDelay int
+	// CredentialReminderDays is how many days before source credentials
+	// expire the credentials.expiring event is emitted
+	CredentialReminderDays int
+	// DeliveryReminderDays is how many days before a delivery expires the
+	// delivery.expiring event is emitted if files are still to be downloaded
+	DeliveryReminderDays int
+	// ScheduleJitter is the maximum delay in seconds added to scheduled syncs
+	ScheduleJitter int
+	DevMode        bool
+	ViteProxy      string
+	Telemetry      bool
+	TelemetryURL   string
+	// SourceProxies maps source IDs to a proxy URL or "direct"
+	SourceProxies map[string]string
+	// Blackout holds the periods in which scheduled syncs are deferred and
+	// no downloads start
+	Blackout blackout.Schedule
+	// DownloadWindow holds the periods outside of which no downloads start,
+	// for products without a window of their own; empty allows any time
+	DownloadWindow blackout.Schedule
+	// MaxConcurrentSyncs bounds how many product syncs run at once
+	MaxConcurrentSyncs int
+	// SyncFailureLimit is after how many consecutive failed syncs a product's
+	// schedule is suspended; 0 never suspends it
+	SyncFailureLimit int
+	// WebhookRetries is how often a failed webhook or notifier delivery is
+	// retried; webhook deliveries are then kept as dead letters.
+	// WebhookRetryDelay is the first delay in seconds
+	WebhookRetries    int
+	WebhookRetryDelay int
+	// EventRetentionDays is how long emitted events are kept in the event
+	// log; 0 keeps them forever
+	EventRetentionDays int
+	// DownloadRetentionDays is how long failed, cancelled and superseded
+	// download entries are kept; 0 keeps them forever
+	DownloadRetentionDays int
+	// ArchiveAfterDays is the age after which deliveries and their files are
+	// archived and left out of listings; 0 never archives them
+	ArchiveAfterDays int
+	// ArchiveExpired archives the files of expired deliveries that were never
+	// downloaded instead of only marking them expired
+	ArchiveExpired bool
+	// ReconcileFix lets the daily reconciliation mark downloads missing on
+	// disk as deleted and remove orphaned files instead of only reporting them
+	ReconcileFix bool
+	// LatestLinks keeps a latest directory in each product directory with
+	// links to the files of the newest fully downloaded delivery
+	LatestLinks bool
+	// Dedup hard links downloads identical to a file already stored instead
+	// of keeping another copy
+	Dedup bool
+	// StorageLayout is LayoutProduct or LayoutCAS
+	StorageLayout string
+	// StorageQuotaGB bounds the storage taken by downloads; once reached, new
+	// downloads pause until space is freed. 0 disables the quota.
+	StorageQuotaGB int
+	// PluginDir holds executables implementing additional sources
+	PluginDir string
+	// ImportRoots are the directories, and those below them, the API may
+	// import files from; without any, API imports are refused
+	ImportRoots []string
+	// RestoreLimitMB bounds the size of a backup the API restores, both
+	// compressed and decompressed
+	RestoreLimitMB int
+	// GRPCPlugins are the addresses of source plugins served over gRPC
+	GRPCPlugins []string
+	// StandbyPrimary is the URL of the primary to replicate; setting it
+	// starts the instance as a warm standby
+	StandbyPrimary string
+	// StandbyInterval is the replication interval in seconds
+	StandbyInterval int
+	TLSCertFile     string
+	TLSKeyFile      string
+	// ACMEDomains enables automatic certificates for these host names
+	ACMEDomains  []string
+	ACMEEmail    string
+	ACMECacheDir string
+	// SMTPHost enables email notifiers; port 465 uses implicit TLS, other
+	// ports STARTTLS when the server offers it
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	// KafkaBrokers enables publishing all events to KafkaTopic
+	KafkaBrokers  []string
+	KafkaTopic    string
+	KafkaUsername string
+	KafkaPassword string
+	KafkaTLS      bool
+
+	// NATSURL enables publishing all events below NATSSubject
+	NATSURL       string
+	NATSSubject   string
+	NATSJetStream bool
+
+	// SQSQueueURL and SNSTopicARN enable publishing all events to AWS. The
+	// credentials default to the standard AWS_* variables.
+	SQSQueueURL        string
+	SNSTopicARN        string
+	AWSRegion          string
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	AWSSessionToken    string
+	AWSEndpoint        string
+
+	// AMQPURL enables publishing all events to AMQPExchange
+	AMQPURL      string
+	AMQPExchange string
+
+	// OIDCIssuer enables login through an OpenID Connect provider
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+	OIDCGroupsClaim  string
+	// OIDCRoles maps groups to roles as group=role pairs; empty makes every
+	// user an admin
+	OIDCRoles string
+
+	// ProxyAuthHeader enables authentication by a reverse proxy that passes
+	// the user in this header; it is trusted from ProxyAuthTrusted only
+	ProxyAuthHeader  string
+	ProxyAuthTrusted []string
+	ProxyAuthRole    string
+	// DisableLogin turns off passphrase login
+	DisableLogin bool
+	// ReadOnly restricts all API clients to reading
+	ReadOnly bool
 }
 
+// Load reads the configuration from the environment and, if
+// BULK_LOADER_CONFIG_FILE is set, from that file. Environment variables take
+// precedence over values in the file.
 func Load() (*Config, error) {
+	file, err := readConfigFile(os.Getenv("BULK_LOADER_CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+
 	cfg := &Config{
-		Passphrase:      os.Getenv("BULK_LOADER_PASSPHRASE"),
-		DBDriver:        getEnvOrDefault("BULK_LOADER_DB_DRIVER", "sqlite"),
-		DBDSN:           os.Getenv("BULK_LOADER_DB_DSN"),
-		DataDir:         getEnvOrDefault("BULK_LOADER_DATA_DIR", "./data"),
-		Port:            getEnvIntOrDefault("BULK_LOADER_PORT", 8080),
-		MaxConcurrent:   getEnvIntOrDefault("BULK_LOADER_MAX_CONCURRENT", 3),
-		DownloadTimeout: getEnvIntOrDefault("BULK_LOADER_DOWNLOAD_TIMEOUT", 3600),
-		DevMode:         os.Getenv("BULK_LOADER_DEV_MODE") == "true",
-		ViteProxy:       os.Getenv("BULK_LOADER_VITE_PROXY"),
+		Passphrase:             getEnv(file, "BULK_LOADER_PASSPHRASE"),
+		DBDriver:               getEnvOrDefault(file, "BULK_LOADER_DB_DRIVER", "sqlite"),
+		DBDSN:                  getEnv(file, "BULK_LOADER_DB_DSN"),
+		DataDir:                getEnvOrDefault(file, "BULK_LOADER_DATA_DIR", "./data"),
+		Port:                   getEnvIntOrDefault(file, "BULK_LOADER_PORT", 8080),
+		ListenAddr:             getEnv(file, "BULK_LOADER_LISTEN_ADDR"),
+		SocketPath:             getEnv(file, "BULK_LOADER_SOCKET"),
+		GRPCPort:               getEnvIntOrDefault(file, "BULK_LOADER_GRPC_PORT", 0),
+		MaxConcurrent:          getEnvIntOrDefault(file, "BULK_LOADER_MAX_CONCURRENT", 3),
+		DownloadTimeout:        getEnvIntOrDefault(file, "BULK_LOADER_DOWNLOAD_TIMEOUT", 3600),
+		DownloadMinTimeout:     getEnvIntOrDefault(file, "BULK_LOADER_DOWNLOAD_MIN_TIMEOUT", 600),
+		DownloadMaxTimeout:     getEnvIntOrDefault(file, "BULK_LOADER_DOWNLOAD_MAX_TIMEOUT", 172800),
+		DownloadMinThroughput:  getEnvIntOrDefault(file, "BULK_LOADER_DOWNLOAD_MIN_THROUGHPUT", 1024),
+		ShutdownDrain:          getEnvIntOrDefault(file, "BULK_LOADER_SHUTDOWN_DRAIN", 0),
+		PostProcessWorkers:     getEnvIntOrDefault(file, "BULK_LOADER_POSTPROCESS_WORKERS", 1),
+		PostProcessNice:        getEnvIntOrDefault(file, "BULK_LOADER_POSTPROCESS_NICE", 10),
+		PipelineCommands:       splitList(getEnv(file, "BULK_LOADER_PIPELINE_COMMANDS")),
+		PipelineDirs:           splitList(getEnv(file, "BULK_LOADER_PIPELINE_DIRS")),
+		SyncRetries:            getEnvIntOrDefault(file, "BULK_LOADER_SYNC_RETRIES", 5),
+		SyncRetryDelay:         getEnvIntOrDefault(file, "BULK_LOADER_SYNC_RETRY_DELAY", 60),
+		CredentialReminderDays: getEnvIntOrDefault(file, "BULK_LOADER_CREDENTIAL_REMINDER_DAYS", 14),
+		DeliveryReminderDays:   getEnvIntOrDefault(file, "BULK_LOADER_DELIVERY_REMINDER_DAYS", 7),
+		ScheduleJitter:         getEnvIntOrDefault(file, "BULK_LOADER_SCHEDULE_JITTER", 300),
+		MaxConcurrentSyncs:     getEnvIntOrDefault(file, "BULK_LOADER_MAX_CONCURRENT_SYNCS", 4),
+		SyncFailureLimit:       getEnvIntOrDefault(file, "BULK_LOADER_SYNC_FAILURE_LIMIT", 10),
+		WebhookRetries:         getEnvIntOrDefault(file, "BULK_LOADER_WEBHOOK_RETRIES", 3),
+		WebhookRetryDelay:      getEnvIntOrDefault(file, "BULK_LOADER_WEBHOOK_RETRY_DELAY", 10),
+		EventRetentionDays:     getEnvIntOrDefault(file, "BULK_LOADER_EVENT_RETENTION_DAYS", 90),
+		DownloadRetentionDays:  getEnvIntOrDefault(file, "BULK_LOADER_DOWNLOAD_RETENTION_DAYS", 90),
+		ArchiveAfterDays:       getEnvIntOrDefault(file, "BULK_LOADER_ARCHIVE_AFTER_DAYS", 0),
+		ArchiveExpired:         getEnv(file, "BULK_LOADER_ARCHIVE_EXPIRED") == "true",
+		ReconcileFix:           getEnv(file, "BULK_LOADER_RECONCILE_FIX") == "true",
+		LatestLinks:            getEnv(file, "BULK_LOADER_LATEST_LINKS") == "true",
+		Dedup:                  getEnv(file, "BULK_LOADER_DEDUP") == "true",
+		StorageLayout:          getEnvOrDefault(file, "BULK_LOADER_STORAGE_LAYOUT", LayoutProduct),
+		StorageQuotaGB:         getEnvIntOrDefault(file, "BULK_LOADER_STORAGE_QUOTA_GB", 0),
+		DevMode:                getEnv(file, "BULK_LOADER_DEV_MODE") == "true",
+		ViteProxy:              getEnv(file, "BULK_LOADER_VITE_PROXY"),
+		Telemetry:              getEnv(file, "BULK_LOADER_TELEMETRY") == "true",
+		TelemetryURL:           getEnv(file, "BULK_LOADER_TELEMETRY_URL"),
+		PluginDir:              getEnv(file, "BULK_LOADER_PLUGIN_DIR"),
+		ImportRoots:            splitList(getEnv(file, "BULK_LOADER_IMPORT_ROOTS")),
+		RestoreLimitMB:         getEnvIntOrDefault(file, "BULK_LOADER_RESTORE_LIMIT_MB", 1024),
+		GRPCPlugins:            splitList(getEnv(file, "BULK_LOADER_GRPC_PLUGINS")),
+		StandbyPrimary:         getEnv(file, "BULK_LOADER_STANDBY_PRIMARY"),
+		StandbyInterval:        getEnvIntOrDefault(file, "BULK_LOADER_STANDBY_INTERVAL", 300),
+		TLSCertFile:            getEnv(file, "BULK_LOADER_TLS_CERT"),
+		TLSKeyFile:             getEnv(file, "BULK_LOADER_TLS_KEY"),
+		ACMEDomains:            splitList(getEnv(file, "BULK_LOADER_ACME_DOMAINS")),
+		ACMEEmail:              getEnv(file, "BULK_LOADER_ACME_EMAIL"),
+		SMTPHost:               getEnv(file, "BULK_LOADER_SMTP_HOST"),
+		SMTPPort:               getEnvIntOrDefault(file, "BULK_LOADER_SMTP_PORT", 587),
+		SMTPUsername:           getEnv(file, "BULK_LOADER_SMTP_USERNAME"),
+		SMTPPassword:           getEnv(file, "BULK_LOADER_SMTP_PASSWORD"),
+		SMTPFrom:               getEnv(file, "BULK_LOADER_SMTP_FROM"),
+		KafkaBrokers:           splitList(getEnv(file, "BULK_LOADER_KAFKA_BROKERS")),
+		KafkaTopic:             getEnvOrDefault(file, "BULK_LOADER_KAFKA_TOPIC", "bulk-loader-events"),
+		KafkaUsername:          getEnv(file, "BULK_LOADER_KAFKA_USERNAME"),
+		KafkaPassword:          getEnv(file, "BULK_LOADER_KAFKA_PASSWORD"),
+		KafkaTLS:               getEnv(file, "BULK_LOADER_KAFKA_TLS") == "true",
+		NATSURL:                getEnv(file, "BULK_LOADER_NATS_URL"),
+		NATSSubject:            getEnvOrDefault(file, "BULK_LOADER_NATS_SUBJECT", "bulk-loader"),
+		NATSJetStream:          getEnv(file, "BULK_LOADER_NATS_JETSTREAM") == "true",
+		SQSQueueURL:            getEnv(file, "BULK_LOADER_SQS_QUEUE_URL"),
+		SNSTopicARN:            getEnv(file, "BULK_LOADER_SNS_TOPIC_ARN"),
+		AWSRegion:              getEnvOrDefault(file, "BULK_LOADER_AWS_REGION", os.Getenv("AWS_REGION")),
+		AWSAccessKeyID:         getEnvOrDefault(file, "BULK_LOADER_AWS_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID")),
+		AWSSecretAccessKey:     getEnvOrDefault(file, "BULK_LOADER_AWS_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		AWSSessionToken:        getEnvOrDefault(file, "BULK_LOADER_AWS_SESSION_TOKEN", os.Getenv("AWS_SESSION_TOKEN")),
+		AWSEndpoint:            getEnv(file, "BULK_LOADER_AWS_ENDPOINT"),
+		AMQPURL:                getEnv(file, "BULK_LOADER_AMQP_URL"),
+		AMQPExchange:           getEnvOrDefault(file, "BULK_LOADER_AMQP_EXCHANGE", "bulk-loader"),
+		OIDCIssuer:             getEnv(file, "BULK_LOADER_OIDC_ISSUER"),
+		OIDCClientID:           getEnv(file, "BULK_LOADER_OIDC_CLIENT_ID"),
+		OIDCClientSecret:       getEnv(file, "BULK_LOADER_OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:        getEnv(file, "BULK_LOADER_OIDC_REDIRECT_URL"),
+		OIDCScopes:             splitList(getEnvOrDefault(file, "BULK_LOADER_OIDC_SCOPES", "profile,email")),
+		OIDCGroupsClaim:        getEnvOrDefault(file, "BULK_LOADER_OIDC_GROUPS_CLAIM", "groups"),
+		OIDCRoles:              getEnv(file, "BULK_LOADER_OIDC_ROLES"),
+		ProxyAuthHeader:        getEnv(file, "BULK_LOADER_PROXY_AUTH_HEADER"),
+		ProxyAuthTrusted:       splitList(getEnvOrDefault(file, "BULK_LOADER_PROXY_AUTH_TRUSTED", "127.0.0.1,::1")),
+		ProxyAuthRole:          getEnvOrDefault(file, "BULK_LOADER_PROXY_AUTH_ROLE", "admin"),
+		DisableLogin:           getEnv(file, "BULK_LOADER_DISABLE_LOGIN") == "true",
+		ReadOnly:               getEnv(file, "BULK_LOADER_READ_ONLY") == "true",
+	}
+	cfg.ACMECacheDir = getEnvOrDefault(file, "BULK_LOADER_ACME_CACHE_DIR", filepath.Join(cfg.DataDir, "acme"))
+	cfg.DownloadsDir = getEnv(file, "BULK_LOADER_DOWNLOADS_DIR")
+
+	if err := cfg.validateTLS(); err != nil {
+		return nil, err
+	}
+
+	socketMode, err := parseFileMode(getEnvOrDefault(file, "BULK_LOADER_SOCKET_MODE", "0660"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BULK_LOADER_SOCKET_MODE: %w", err)
+	}
+	cfg.SocketMode = socketMode
+
+	proxies, err := parseSourceProxies(getEnv(file, "BULK_LOADER_SOURCE_PROXIES"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.SourceProxies = proxies
+
+	cfg.Blackout, err = blackout.Parse(getEnv(file, "BULK_LOADER_BLACKOUT"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BULK_LOADER_BLACKOUT: %w", err)
+	}
+	cfg.DownloadWindow, err = blackout.Parse(getEnv(file, "BULK_LOADER_DOWNLOAD_WINDOW"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BULK_LOADER_DOWNLOAD_WINDOW: %w", err)
+	}
+
+	if cfg.PostProcessWorkers < 1 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_POSTPROCESS_WORKERS: %d", cfg.PostProcessWorkers)
+	}
+
+	if cfg.MaxConcurrentSyncs < 1 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_MAX_CONCURRENT_SYNCS: %d", cfg.MaxConcurrentSyncs)
+	}
+
+	if cfg.StorageLayout != LayoutProduct && cfg.StorageLayout != LayoutCAS {
+		return nil, fmt.Errorf("invalid BULK_LOADER_STORAGE_LAYOUT %q, expected %s or %s", cfg.StorageLayout, LayoutProduct, LayoutCAS)
 	}
 
 	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
 		return nil, fmt.Errorf("create data directory: %w", err)
 	}
 
-	if err := os.MkdirAll(filepath.Join(cfg.DataDir, "downloads"), 0755); err != nil {
+	if err := os.MkdirAll(cfg.DownloadsPath(), 0755); err != nil {
 		return nil, fmt.Errorf("create downloads directory: %w", err)
 	}
 
 	return cfg, nil
 }
 
+// TLSEnabled reports whether the server should serve HTTPS
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" || len(c.ACMEDomains) > 0
+}
+
+func (c *Config) validateTLS() error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("BULK_LOADER_TLS_CERT and BULK_LOADER_TLS_KEY must be set together")
+	}
+	if c.TLSCertFile != "" && len(c.ACMEDomains) > 0 {
+		return fmt.Errorf("BULK_LOADER_TLS_CERT and BULK_LOADER_ACME_DOMAINS are mutually exclusive")
+	}
+	return nil
+}
+
+// HTTPAddr returns the TCP address of the HTTP server
+func (c *Config) HTTPAddr() string {
+	return net.JoinHostPort(c.ListenAddr, strconv.Itoa(c.Port))
+}
+
+// GRPCAddr returns the TCP address of the gRPC server
+func (c *Config) GRPCAddr() string {
+	return net.JoinHostPort(c.ListenAddr, strconv.Itoa(c.GRPCPort))
+}
+
 func (c *Config) DatabasePath() string {
 	return filepath.Join(c.DataDir, "bulk-loader.db")
 }
 
 func (c *Config) DownloadsPath() string {
+	if c.DownloadsDir != "" {
+		return c.DownloadsDir
+	}
 	return filepath.Join(c.DataDir, "downloads")
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
+// PathWithin reports whether path, with symlinks resolved, is one of roots or
+// below one. The part of path that doesn't exist yet is taken as it is.
+func PathWithin(path string, roots []string) bool {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return false
+	}
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		resolvedRoot, err := resolvePath(root)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(resolvedRoot, resolved); err == nil && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePath returns the absolute path with the symlinks of its longest
+// existing prefix resolved
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		parent := filepath.Dir(path)
+		if !errors.Is(err, fs.ErrNotExist) || parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// readConfigFile parses a file of KEY=VALUE lines. Blank lines and lines
+// starting with # are ignored, and values may be wrapped in quotes.
+func readConfigFile(path string) (map[string]string, error) {
+	values := make(map[string]string)
+	if path == "" {
+		return values, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open config file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("config file %s line %d: expected KEY=VALUE", path, lineNum)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	return values, nil
+}
+
+// SetFileValue sets a key in a config file read by Load, replacing the line
+// that sets it or appending one. Other lines are kept as they are.
+func SetFileValue(path, key, value string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	line := key + "=" + value
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+	replaced := false
+	for i, l := range lines {
+		k, _, ok := strings.Cut(strings.TrimSpace(l), "=")
+		if ok && strings.TrimSpace(k) == key {
+			lines[i] = line
+			replaced = true
+		}
+	}
+	if !replaced {
+		lines = append(lines, line)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("write config file: %w", err)
+	}
+	return nil
+}
+
+// parseSourceProxies parses a comma-separated list of source=proxy pairs
+func parseSourceProxies(value string) (map[string]string, error) {
+	proxies := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, proxy, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(id) == "" || strings.TrimSpace(proxy) == "" {
+			return nil, fmt.Errorf("invalid BULK_LOADER_SOURCE_PROXIES entry %q, expected source=proxy", pair)
+		}
+		proxies[strings.TrimSpace(id)] = strings.TrimSpace(proxy)
+	}
+	return proxies, nil
+}
+
+// parseFileMode parses an octal permission string such as "0660"
+func parseFileMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("%q is not an octal permission mode", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// splitList splits a comma-separated value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnv(file map[string]string, key string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
 	}
+	return file[key]
+}
+
+func getEnvOrDefault(file map[string]string, key, defaultValue string) string {
+	if v := getEnv(file, key); v != "" {
+		return v
+	}
 	return defaultValue
 }
 
-func getEnvIntOrDefault(key string, defaultValue int) int {
-	if v := os.Getenv(key); v != "" {
+func getEnvIntOrDefault(file map[string]string, key string, defaultValue int) int {
+	if v := getEnv(file, key); v != "" {
 		if i, err := strconv.Atoi(v); err == nil {
 			return i
 		}
@@ -130,6 +130,36 @@ func TestDownloadsPath(t *testing.T) {
 	if cfg.DownloadsPath() != expected {
 		t.Errorf("DownloadsPath() = %q, want %q", cfg.DownloadsPath(), expected)
 	}
+
+	cfg.DownloadsDir = "/mnt/downloads"
+	if cfg.DownloadsPath() != "/mnt/downloads" {
+		t.Errorf("DownloadsPath() = %q, want /mnt/downloads", cfg.DownloadsPath())
+	}
+}
+
+func TestPathWithin(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	os.MkdirAll(filepath.Join(root, "sub"), 0755)
+	os.Mkdir(filepath.Join(dir, "other"), 0755)
+	os.Symlink(filepath.Join(dir, "other"), filepath.Join(root, "escape"))
+
+	for path, want := range map[string]bool{
+		root:                                   true,
+		filepath.Join(root, "sub"):             true,
+		filepath.Join(root, "sub", "new", "a"): true,
+		filepath.Join(root, "..", "other"):     false,
+		filepath.Join(root, "escape"):          false,
+		filepath.Join(root, "escape", "new"):   false,
+		filepath.Join(dir, "rootless"):         false,
+	} {
+		if got := PathWithin(path, []string{root}); got != want {
+			t.Errorf("PathWithin(%s) = %v, want %v", path, got, want)
+		}
+	}
+	if PathWithin(root, nil) {
+		t.Error("PathWithin() without roots = true")
+	}
 }
 
 func TestLoadCreatesDirectories(t *testing.T) {
@@ -153,3 +183,199 @@ func TestLoadCreatesDirectories(t *testing.T) {
 		t.Error("downloads directory was not created")
 	}
 }
+
+func TestLoadConfigFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "bulk-loader.env")
+	content := `# Bulk loader settings
+BULK_LOADER_MAX_CONCURRENT=7
+BULK_LOADER_DOWNLOAD_TIMEOUT="120"
+
+BULK_LOADER_PORT=9100
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("BULK_LOADER_CONFIG_FILE", path)
+	os.Setenv("BULK_LOADER_DATA_DIR", tmpDir)
+	os.Setenv("BULK_LOADER_PORT", "9000")
+	defer os.Unsetenv("BULK_LOADER_CONFIG_FILE")
+	defer os.Unsetenv("BULK_LOADER_DATA_DIR")
+	defer os.Unsetenv("BULK_LOADER_PORT")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.MaxConcurrent != 7 {
+		t.Errorf("MaxConcurrent = %d, want 7", cfg.MaxConcurrent)
+	}
+	if cfg.DownloadTimeout != 120 {
+		t.Errorf("DownloadTimeout = %d, want 120", cfg.DownloadTimeout)
+	}
+	if cfg.Port != 9000 {
+		t.Errorf("Port = %d, want 9000 (environment overrides file)", cfg.Port)
+	}
+}
+
+func TestSetFileValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bulk-loader.env")
+	os.WriteFile(path, []byte("# data\nBULK_LOADER_DATA_DIR=/old\nBULK_LOADER_PORT=9090\n"), 0600)
+
+	if err := SetFileValue(path, "BULK_LOADER_DATA_DIR", "/new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetFileValue(path, "BULK_LOADER_DOWNLOADS_DIR", "/mnt/downloads"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	want := "# data\nBULK_LOADER_DATA_DIR=/new\nBULK_LOADER_PORT=9090\nBULK_LOADER_DOWNLOADS_DIR=/mnt/downloads\n"
+	if string(data) != want {
+		t.Errorf("config file = %q, want %q", data, want)
+	}
+}
+
+func TestLoadInvalidConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bulk-loader.env")
+	os.WriteFile(path, []byte("not a setting\n"), 0644)
+
+	os.Setenv("BULK_LOADER_CONFIG_FILE", path)
+	defer os.Unsetenv("BULK_LOADER_CONFIG_FILE")
+
+	if _, err := Load(); err == nil {
+		t.Error("Load() should fail for a malformed config file")
+	}
+}
+
+func TestLoadInvalidBlackout(t *testing.T) {
+	os.Setenv("BULK_LOADER_DATA_DIR", t.TempDir())
+	os.Setenv("BULK_LOADER_BLACKOUT", "weekdays 08:00-18:00")
+	defer os.Unsetenv("BULK_LOADER_DATA_DIR")
+	defer os.Unsetenv("BULK_LOADER_BLACKOUT")
+
+	if _, err := Load(); err == nil {
+		t.Error("Load() should fail for an invalid blackout period")
+	}
+}
+
+func TestLoadInvalidDownloadWindow(t *testing.T) {
+	t.Setenv("BULK_LOADER_DATA_DIR", t.TempDir())
+	t.Setenv("BULK_LOADER_DOWNLOAD_WINDOW", "22:00")
+
+	if _, err := Load(); err == nil {
+		t.Error("Load() should fail for an invalid download window")
+	}
+}
+
+func TestLoadInvalidStorageLayout(t *testing.T) {
+	t.Setenv("BULK_LOADER_DATA_DIR", t.TempDir())
+	t.Setenv("BULK_LOADER_STORAGE_LAYOUT", "flat")
+
+	if _, err := Load(); err == nil {
+		t.Error("Load() should fail for an unknown storage layout")
+	}
+}
+
+func TestLoadInvalidPostProcessWorkers(t *testing.T) {
+	t.Setenv("BULK_LOADER_DATA_DIR", t.TempDir())
+	t.Setenv("BULK_LOADER_POSTPROCESS_WORKERS", "0")
+
+	if _, err := Load(); err == nil {
+		t.Error("Load() should fail for no post-processing workers")
+	}
+}
+
+func TestLoadInvalidMaxConcurrentSyncs(t *testing.T) {
+	t.Setenv("BULK_LOADER_DATA_DIR", t.TempDir())
+	t.Setenv("BULK_LOADER_MAX_CONCURRENT_SYNCS", "0")
+
+	if _, err := Load(); err == nil {
+		t.Error("Load() should fail for no sync slots")
+	}
+}
+
+func TestParseSourceProxies(t *testing.T) {
+	proxies, err := parseSourceProxies("epo=http://proxy:3128, uspto=direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxies["epo"] != "http://proxy:3128" || proxies["uspto"] != "direct" {
+		t.Errorf("parseSourceProxies() = %v", proxies)
+	}
+
+	if _, err := parseSourceProxies("epo"); err == nil {
+		t.Error("parseSourceProxies() should reject an entry without '='")
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.Setenv("BULK_LOADER_DATA_DIR", tmpDir)
+	os.Setenv("BULK_LOADER_ACME_DOMAINS", "bulk.example.com, files.example.com")
+	defer os.Unsetenv("BULK_LOADER_DATA_DIR")
+	defer os.Unsetenv("BULK_LOADER_ACME_DOMAINS")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.TLSEnabled() {
+		t.Error("TLSEnabled() should be true with ACME domains")
+	}
+	if len(cfg.ACMEDomains) != 2 || cfg.ACMEDomains[1] != "files.example.com" {
+		t.Errorf("ACMEDomains = %v", cfg.ACMEDomains)
+	}
+	if cfg.ACMECacheDir != filepath.Join(tmpDir, "acme") {
+		t.Errorf("ACMECacheDir = %q, want %q", cfg.ACMECacheDir, filepath.Join(tmpDir, "acme"))
+	}
+
+	os.Setenv("BULK_LOADER_TLS_CERT", "cert.pem")
+	defer os.Unsetenv("BULK_LOADER_TLS_CERT")
+	if _, err := Load(); err == nil {
+		t.Error("Load() should fail with a certificate but no key")
+	}
+
+	os.Setenv("BULK_LOADER_TLS_KEY", "key.pem")
+	defer os.Unsetenv("BULK_LOADER_TLS_KEY")
+	if _, err := Load(); err == nil {
+		t.Error("Load() should fail with both a certificate and ACME domains")
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	mode, err := parseFileMode("0660")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != 0660 {
+		t.Errorf("parseFileMode() = %v, want 0660", mode)
+	}
+
+	for _, value := range []string{"rw-rw----", "0999", "1777"} {
+		if _, err := parseFileMode(value); err == nil {
+			t.Errorf("parseFileMode(%q) should fail", value)
+		}
+	}
+}
+
+func TestListenAddresses(t *testing.T) {
+	cfg := &Config{Port: 8080, GRPCPort: 9090}
+	if cfg.HTTPAddr() != ":8080" {
+		t.Errorf("HTTPAddr() = %q, want :8080", cfg.HTTPAddr())
+	}
+
+	cfg.ListenAddr = "127.0.0.1"
+	if cfg.HTTPAddr() != "127.0.0.1:8080" {
+		t.Errorf("HTTPAddr() = %q, want 127.0.0.1:8080", cfg.HTTPAddr())
+	}
+	if cfg.GRPCAddr() != "127.0.0.1:9090" {
+		t.Errorf("GRPCAddr() = %q, want 127.0.0.1:9090", cfg.GRPCAddr())
+	}
+
+	cfg.ListenAddr = "::1"
+	if cfg.HTTPAddr() != "[::1]:8080" {
+		t.Errorf("HTTPAddr() = %q, want [::1]:8080", cfg.HTTPAddr())
+	}
+}
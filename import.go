@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// runImport implements the "import" command, which records files already on
+// disk as downloaded; see database.ImportFiles
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var opts database.ImportOptions
+	fs.BoolVar(&opts.Verify, "verify", false, "Check files against the expected checksums")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Only report what would be imported")
+	verbose := fs.Bool("v", false, "List mismatched and ambiguous files")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: bulk-file-loader import [-verify] [-dry-run] [-v] <directory>")
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	db, err := database.New(cfg)
+	if err != nil {
+		slog.Error("Failed to initialize database", "error", err)
+		os.Exit(1)
+	}
+
+	report, err := db.ImportFiles(fs.Arg(0), opts, time.Now())
+	if err != nil {
+		slog.Error("Failed to import files", "error", err)
+		os.Exit(1)
+	}
+
+	if *verbose {
+		for _, path := range report.Mismatched {
+			fmt.Println("Mismatched", path)
+		}
+		for _, path := range report.Ambiguous {
+			fmt.Println("Ambiguous", path)
+		}
+	}
+	verb := "Imported"
+	if opts.DryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d files; %d already downloaded, %d mismatched, %d ambiguous, %d unmatched\n", verb,
+		len(report.Imported), len(report.Skipped), len(report.Mismatched), len(report.Ambiguous), report.Unmatched)
+}
@@ -0,0 +1,192 @@
+package amqp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+// Frame types
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+	frameEnd       = 0xCE
+)
+
+// Classes and methods the publisher sends or receives, as class<<16 | method
+const (
+	connectionStart   = 10<<16 | 10
+	connectionStartOk = 10<<16 | 11
+	connectionTune    = 10<<16 | 30
+	connectionTuneOk  = 10<<16 | 31
+	connectionOpen    = 10<<16 | 40
+	connectionOpenOk  = 10<<16 | 41
+	connectionClose   = 10<<16 | 50
+	connectionCloseOk = 10<<16 | 51
+	channelOpen       = 20<<16 | 10
+	channelOpenOk     = 20<<16 | 11
+	channelClose      = 20<<16 | 40
+	channelCloseOk    = 20<<16 | 41
+	exchangeDeclare   = 40<<16 | 10
+	exchangeDeclareOk = 40<<16 | 11
+	basicPublish      = 60<<16 | 40
+	basicAck          = 60<<16 | 80
+	basicNack         = 60<<16 | 120
+	confirmSelect     = 85<<16 | 10
+	confirmSelectOk   = 85<<16 | 11
+)
+
+const (
+	classBasic = 60
+	// maxFrameSize is the largest frame the publisher accepts and proposes
+	maxFrameSize = 128 << 10
+	// frameOverhead is the size of a frame's header and end marker
+	frameOverhead      = 8
+	replySuccess       = 200
+	replyAccessRefused = 403
+)
+
+var errShortFrame = errors.New("amqp: truncated frame")
+
+// Error is a connection or channel exception raised by the broker, e.g. 403
+// ACCESS_REFUSED or 404 NOT_FOUND
+type Error struct {
+	Code uint16
+	Text string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("amqp: %d %s", e.Code, e.Text)
+}
+
+// Retriable reports whether the operation may succeed when repeated, e.g.
+// after the broker restarted
+func (e *Error) Retriable() bool {
+	switch e.Code {
+	case 320, 405, 506, 541: // connection forced, resource locked, resource error, internal error
+		return true
+	}
+	return false
+}
+
+// encoder builds a frame payload
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) octet(v uint8)     { e.b = append(e.b, v) }
+func (e *encoder) short(v uint16)    { e.b = binary.BigEndian.AppendUint16(e.b, v) }
+func (e *encoder) long(v uint32)     { e.b = binary.BigEndian.AppendUint32(e.b, v) }
+func (e *encoder) longlong(v uint64) { e.b = binary.BigEndian.AppendUint64(e.b, v) }
+func (e *encoder) method(id uint32)  { e.long(id) }
+
+// shortstr writes a short string, truncated to 255 bytes
+func (e *encoder) shortstr(s string) {
+	s = s[:min(len(s), 255)]
+	e.octet(uint8(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) longstr(s string) {
+	e.long(uint32(len(s)))
+	e.b = append(e.b, s...)
+}
+
+// table writes a field table of string values
+func (e *encoder) table(fields map[string]string) {
+	var t encoder
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		t.shortstr(name)
+		t.octet('S')
+		t.longstr(fields[name])
+	}
+	e.long(uint32(len(t.b)))
+	e.b = append(e.b, t.b...)
+}
+
+// decoder reads a frame payload. The first short read is kept in err and
+// makes all further reads return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errShortFrame
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) octet() uint8 {
+	if v := d.take(1); v != nil {
+		return v[0]
+	}
+	return 0
+}
+
+func (d *decoder) short() uint16 {
+	if v := d.take(2); v != nil {
+		return binary.BigEndian.Uint16(v)
+	}
+	return 0
+}
+
+func (d *decoder) long() uint32 {
+	if v := d.take(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (d *decoder) longlong() uint64 {
+	if v := d.take(8); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+func (d *decoder) shortstr() string { return string(d.take(int(d.octet()))) }
+
+// writeFrame writes a frame with the given payload
+func writeFrame(w io.Writer, frameType uint8, channel uint16, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+frameOverhead)
+	frame = append(frame, frameType)
+	frame = binary.BigEndian.AppendUint16(frame, channel)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	frame = append(frame, frameEnd)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads a frame, refusing payloads beyond maxSize
+func readFrame(r io.Reader, maxSize uint32) (uint8, uint16, []byte, error) {
+	var header [7]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[3:])
+	if size > maxSize {
+		return 0, 0, nil, fmt.Errorf("amqp: frame of %d bytes exceeds the maximum of %d", size, maxSize)
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	if payload[size] != frameEnd {
+		return 0, 0, nil, errors.New("amqp: malformed frame")
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:]), payload[:size], nil
+}
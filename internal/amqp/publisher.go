@@ -0,0 +1,368 @@
+// Package amqp is a minimal AMQP 0-9-1 publisher for RabbitMQ and compatible
+// brokers. Messages are published to a durable topic exchange and confirmed
+// by the broker.
+package amqp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	requestTimeout = 30 * time.Second
+	clientName     = "bulk-file-loader"
+	// channelID is the only channel the publisher opens
+	channelID = 1
+)
+
+// ErrNacked is returned when the broker could not store a message
+var ErrNacked = errors.New("amqp: message rejected by the broker")
+
+// ParseURL checks a broker URL: amqp://[user:password@]host[:port][/vhost],
+// or amqps:// for TLS
+func ParseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "amqp" && u.Scheme != "amqps") || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid AMQP URL %q, want amqp://host:port/vhost or amqps://host:port/vhost", Redact(rawURL))
+	}
+	return u, nil
+}
+
+// Redact removes credentials from a broker URL
+func Redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	return u.String()
+}
+
+// Publisher publishes messages over a single connection, which is opened on
+// the first message and again after errors. It is safe for concurrent use;
+// messages are sent one at a time.
+type Publisher struct {
+	url      *url.URL
+	exchange string
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+// NewPublisher creates a publisher to the given exchange, which is declared
+// as a durable topic exchange if it doesn't exist
+func NewPublisher(rawURL, exchange string) (*Publisher, error) {
+	u, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if exchange == "" {
+		return nil, errors.New("amqp: exchange required")
+	}
+	return &Publisher{url: u, exchange: exchange}, nil
+}
+
+// Publish sends a persistent message and waits until the broker confirmed it
+func (p *Publisher) Publish(ctx context.Context, routingKey, contentType string, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		c, err := dial(ctx, p.url, p.exchange)
+		if err != nil {
+			return err
+		}
+		p.conn = c
+	}
+	if err := p.conn.publish(ctx, p.exchange, routingKey, contentType, body); err != nil {
+		// The broker closes the channel on errors; start over on the next message
+		p.conn.Close()
+		p.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection to the broker
+func (p *Publisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		p.conn.close()
+		p.conn = nil
+	}
+}
+
+// conn is a connection with an open channel in confirm mode
+type conn struct {
+	net.Conn
+	r           *bufio.Reader
+	frameMax    uint32
+	deliveryTag uint64
+}
+
+// dial connects, authenticates with PLAIN, opens the channel and declares the
+// exchange
+func dial(ctx context.Context, u *url.URL, exchange string) (*conn, error) {
+	port := u.Port()
+	if port == "" {
+		port = "5672"
+		if u.Scheme == "amqps" {
+			port = "5671"
+		}
+	}
+	var dialer net.Dialer
+	raw, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "amqps" {
+		tlsConn := tls.Client(raw, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			raw.Close()
+			return nil, err
+		}
+		raw = tlsConn
+	}
+
+	c := &conn{Conn: raw, r: bufio.NewReader(raw), frameMax: maxFrameSize}
+	if err := c.open(ctx, u, exchange); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *conn) open(ctx context.Context, u *url.URL, exchange string) error {
+	defer c.watch(ctx)()
+	if _, err := io.WriteString(c, "AMQP\x00\x00\x09\x01"); err != nil {
+		return err
+	}
+	if _, err := c.expect(connectionStart); err != nil {
+		return err
+	}
+
+	username, password := "guest", "guest"
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	var m encoder
+	m.method(connectionStartOk)
+	m.table(map[string]string{"product": clientName, "platform": "Go"})
+	m.shortstr("PLAIN")
+	m.longstr("\x00" + username + "\x00" + password)
+	m.shortstr("en_US")
+	if err := c.send(0, m.b); err != nil {
+		return err
+	}
+
+	// Brokers close the connection on failed authentication, some of them
+	// without a reason
+	d, err := c.expect(connectionTune)
+	if errors.Is(err, io.EOF) {
+		return &Error{Code: replyAccessRefused, Text: "authentication failed"}
+	}
+	if err != nil {
+		return err
+	}
+	channelMax := d.short()
+	if frameMax := d.long(); frameMax != 0 && frameMax < c.frameMax {
+		c.frameMax = frameMax
+	}
+	m = encoder{}
+	m.method(connectionTuneOk)
+	m.short(channelMax)
+	m.long(c.frameMax)
+	m.short(0) // no heartbeats; broken connections fail the next publish
+	if err := c.send(0, m.b); err != nil {
+		return err
+	}
+
+	vhost := "/"
+	if path := u.Path; len(path) > 1 {
+		vhost = path[1:]
+	}
+	m = encoder{}
+	m.method(connectionOpen)
+	m.shortstr(vhost)
+	m.shortstr("")
+	m.octet(0)
+	if err := c.call(0, m.b, connectionOpenOk); err != nil {
+		return err
+	}
+
+	m = encoder{}
+	m.method(channelOpen)
+	m.shortstr("")
+	if err := c.call(channelID, m.b, channelOpenOk); err != nil {
+		return err
+	}
+
+	m = encoder{}
+	m.method(confirmSelect)
+	m.octet(0)
+	if err := c.call(channelID, m.b, confirmSelectOk); err != nil {
+		return err
+	}
+
+	m = encoder{}
+	m.method(exchangeDeclare)
+	m.short(0)
+	m.shortstr(exchange)
+	m.shortstr("topic")
+	m.octet(1 << 1) // durable
+	m.table(nil)
+	return c.call(channelID, m.b, exchangeDeclareOk)
+}
+
+// publish sends the message in a method, a header and body frames, then
+// waits for the confirmation
+func (c *conn) publish(ctx context.Context, exchange, routingKey, contentType string, body []byte) error {
+	defer c.watch(ctx)()
+
+	var frames bytes.Buffer
+	var m encoder
+	m.method(basicPublish)
+	m.short(0)
+	m.shortstr(exchange)
+	m.shortstr(routingKey)
+	m.octet(0) // neither mandatory nor immediate
+	writeFrame(&frames, frameMethod, channelID, m.b)
+
+	var h encoder
+	h.short(classBasic)
+	h.short(0) // weight
+	h.longlong(uint64(len(body)))
+	h.short(1<<15 | 1<<12 | 1<<6 | 1<<3) // content type, delivery mode, timestamp, app ID
+	h.shortstr(contentType)
+	h.octet(2) // persistent
+	h.longlong(uint64(time.Now().Unix()))
+	h.shortstr(clientName)
+	writeFrame(&frames, frameHeader, channelID, h.b)
+
+	chunk := int(c.frameMax - frameOverhead)
+	for len(body) > 0 {
+		n := min(len(body), chunk)
+		writeFrame(&frames, frameBody, channelID, body[:n])
+		body = body[n:]
+	}
+	if _, err := c.Write(frames.Bytes()); err != nil {
+		return err
+	}
+	c.deliveryTag++
+
+	for {
+		method, d, err := c.readMethod()
+		if err != nil {
+			return err
+		}
+		switch method {
+		case basicAck, basicNack:
+			tag := d.longlong()
+			multiple := d.octet()&1 != 0
+			if tag != c.deliveryTag && !(multiple && tag > c.deliveryTag) {
+				continue
+			}
+			if method == basicNack {
+				return ErrNacked
+			}
+			return nil
+		}
+	}
+}
+
+// watch applies the context's deadline, or the request timeout, to the
+// connection and interrupts it when the context is cancelled
+func (c *conn) watch(ctx context.Context) (stop func() bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(requestTimeout)
+	}
+	c.SetDeadline(deadline)
+	return context.AfterFunc(ctx, func() { c.SetDeadline(time.Now()) })
+}
+
+func (c *conn) send(channel uint16, payload []byte) error {
+	return writeFrame(c, frameMethod, channel, payload)
+}
+
+// call sends a method and waits for its reply
+func (c *conn) call(channel uint16, payload []byte, reply uint32) error {
+	if err := c.send(channel, payload); err != nil {
+		return err
+	}
+	_, err := c.expect(reply)
+	return err
+}
+
+// expect reads the next method, which must be the given one
+func (c *conn) expect(want uint32) (*decoder, error) {
+	method, d, err := c.readMethod()
+	if err != nil {
+		return nil, err
+	}
+	if method != want {
+		return nil, fmt.Errorf("amqp: unexpected method %d.%d, want %d.%d", method>>16, method&0xffff, want>>16, want&0xffff)
+	}
+	return d, nil
+}
+
+// readMethod reads the next method frame, skipping heartbeats. Connection
+// and channel exceptions are acknowledged and returned as errors.
+func (c *conn) readMethod() (uint32, *decoder, error) {
+	for {
+		frameType, channel, payload, err := readFrame(c.r, maxFrameSize)
+		if err != nil {
+			return 0, nil, err
+		}
+		if frameType == frameHeartbeat {
+			continue
+		}
+		if frameType != frameMethod {
+			return 0, nil, fmt.Errorf("amqp: unexpected frame type %d", frameType)
+		}
+		d := &decoder{b: payload}
+		method := d.long()
+		if d.err != nil {
+			return 0, nil, d.err
+		}
+
+		switch method {
+		case connectionClose, channelClose:
+			code := d.short()
+			text := d.shortstr()
+			closeOk := uint32(connectionCloseOk)
+			if method == channelClose {
+				closeOk = channelCloseOk
+			}
+			var m encoder
+			m.method(closeOk)
+			c.send(channel, m.b)
+			return 0, nil, &Error{Code: code, Text: text}
+		}
+		return method, d, nil
+	}
+}
+
+// close closes the connection gracefully, without waiting for the broker
+func (c *conn) close() {
+	c.SetDeadline(time.Now().Add(time.Second))
+	var m encoder
+	m.method(connectionClose)
+	m.short(replySuccess)
+	m.shortstr("")
+	m.short(0)
+	m.short(0)
+	c.send(0, m.b)
+	c.Close()
+}
@@ -0,0 +1,205 @@
+package amqp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// message is a message received by the fake broker
+type message struct {
+	exchange   string
+	routingKey string
+	body       string
+}
+
+// fakeBroker accepts guest:secret, limits frames to 4096 bytes so larger
+// bodies are split, and nacks messages routed to "nack". Declaring the
+// exchange "direct" fails as if it existed with another type.
+func fakeBroker(t *testing.T) (string, <-chan message) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan message, 10)
+	serve := func(c net.Conn) {
+		defer c.Close()
+		r := bufio.NewReader(c)
+		var deliveryTag uint64
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(r, header); err != nil || string(header) != "AMQP\x00\x00\x09\x01" {
+			return
+		}
+		reply := func(channel uint16, build func(*encoder)) {
+			var m encoder
+			build(&m)
+			writeFrame(c, frameMethod, channel, m.b)
+		}
+		read := func() (uint8, *decoder) {
+			frameType, _, payload, err := readFrame(r, maxFrameSize)
+			if err != nil {
+				return 0, nil
+			}
+			return frameType, &decoder{b: payload}
+		}
+
+		reply(0, func(m *encoder) {
+			m.method(connectionStart)
+			m.octet(0)
+			m.octet(9)
+			m.table(map[string]string{"product": "fake"})
+			m.longstr("PLAIN AMQPLAIN")
+			m.longstr("en_US")
+		})
+		for {
+			frameType, d := read()
+			if d == nil {
+				return
+			}
+			if frameType != frameMethod {
+				t.Errorf("unexpected frame type %d", frameType)
+				return
+			}
+			switch method := d.long(); method {
+			case connectionStartOk:
+				d.take(int(d.long())) // client properties
+				d.shortstr()          // mechanism
+				if response := string(d.take(int(d.long()))); response != "\x00guest\x00secret" {
+					return
+				}
+				reply(0, func(m *encoder) {
+					m.method(connectionTune)
+					m.short(2047)
+					m.long(4096)
+					m.short(60)
+				})
+			case connectionTuneOk:
+			case connectionOpen:
+				if vhost := d.shortstr(); vhost != "events" {
+					t.Errorf("vhost = %q, want events", vhost)
+				}
+				reply(0, func(m *encoder) { m.method(connectionOpenOk); m.shortstr("") })
+			case channelOpen:
+				reply(channelID, func(m *encoder) { m.method(channelOpenOk); m.longstr("") })
+			case confirmSelect:
+				reply(channelID, func(m *encoder) { m.method(confirmSelectOk) })
+			case exchangeDeclare:
+				d.short()
+				if name := d.shortstr(); name == "direct" {
+					reply(channelID, func(m *encoder) {
+						m.method(channelClose)
+						m.short(406)
+						m.shortstr("PRECONDITION_FAILED - inequivalent arg 'type'")
+						m.short(40)
+						m.short(10)
+					})
+					continue
+				}
+				reply(channelID, func(m *encoder) { m.method(exchangeDeclareOk) })
+			case basicPublish:
+				d.short()
+				msg := message{exchange: d.shortstr(), routingKey: d.shortstr()}
+				_, h := read()
+				h.short()
+				h.short()
+				size := h.longlong()
+				var body strings.Builder
+				for uint64(body.Len()) < size {
+					_, b := read()
+					if len(b.b) > 4096-frameOverhead {
+						t.Errorf("body frame of %d bytes exceeds the negotiated maximum", len(b.b))
+					}
+					body.Write(b.b)
+				}
+				msg.body = body.String()
+				messages <- msg
+				ack := uint32(basicAck)
+				if msg.routingKey == "nack" {
+					ack = basicNack
+				}
+				deliveryTag++
+				reply(channelID, func(m *encoder) { m.method(ack); m.longlong(deliveryTag); m.octet(0) })
+			case channelCloseOk, connectionClose:
+				return
+			}
+		}
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(c)
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+func TestPublish(t *testing.T) {
+	addr, messages := fakeBroker(t)
+	publisher, err := NewPublisher("amqp://guest:secret@"+addr+"/events", "bulk-loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+
+	large := strings.Repeat("x", 10000)
+	for _, body := range []string{`{"event":"download.completed"}`, large} {
+		if err := publisher.Publish(context.Background(), "download.completed", "application/json", []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+		got := <-messages
+		if got.exchange != "bulk-loader" || got.routingKey != "download.completed" || got.body != body {
+			t.Errorf("broker received %.80v", got)
+		}
+	}
+
+	if err := publisher.Publish(context.Background(), "nack", "application/json", []byte("{}")); !errors.Is(err, ErrNacked) {
+		t.Errorf("nacked publish: err = %v, want ErrNacked", err)
+	}
+	<-messages
+	// The publisher reconnects after errors
+	if err := publisher.Publish(context.Background(), "download.failed", "application/json", []byte("{}")); err != nil {
+		t.Errorf("publish after nack: %v", err)
+	}
+}
+
+func TestPublishErrors(t *testing.T) {
+	addr, _ := fakeBroker(t)
+
+	publisher, _ := NewPublisher("amqp://guest:wrong@"+addr+"/events", "bulk-loader")
+	err := publisher.Publish(context.Background(), "download.completed", "application/json", []byte("{}"))
+	var amqpErr *Error
+	if !errors.As(err, &amqpErr) || amqpErr.Code != 403 || amqpErr.Retriable() {
+		t.Errorf("wrong password: err = %v, want a permanent 403", err)
+	}
+
+	publisher, _ = NewPublisher("amqp://guest:secret@"+addr+"/events", "direct")
+	err = publisher.Publish(context.Background(), "download.completed", "application/json", []byte("{}"))
+	if !errors.As(err, &amqpErr) || amqpErr.Code != 406 || amqpErr.Retriable() {
+		t.Errorf("exchange of another type: err = %v, want a permanent 406", err)
+	}
+
+	for _, invalid := range []string{"http://localhost", "amqp://", "localhost:5672"} {
+		if _, err := NewPublisher(invalid, "bulk-loader"); err == nil {
+			t.Errorf("NewPublisher accepted %q", invalid)
+		}
+	}
+}
+
+func TestReadFrameLimit(t *testing.T) {
+	// A peer that isn't an AMQP broker, e.g. an HTTP server, announces a
+	// frame of gigabytes
+	r := strings.NewReader("HTTP/1.1 400 Bad Request\r\n\r\n")
+	if _, _, _, err := readFrame(r, maxFrameSize); err == nil || !strings.Contains(err.Error(), "exceeds the maximum") {
+		t.Errorf("readFrame() error = %v, want the frame refused", err)
+	}
+}
@@ -0,0 +1,60 @@
+// Package audit records who accessed source credentials and when, for
+// traceability of secret usage. Entries are kept until deleted by hand and
+// may also be sent as credentials.accessed events.
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/auth"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+)
+
+// Log records credential accesses in the database and emits them as events
+type Log struct {
+	db    *database.DB
+	hooks *hooks.Manager
+}
+
+// New creates a credential audit log; hooksManager may be nil
+func New(db *database.DB, hooksManager *hooks.Manager) *Log {
+	return &Log{db: db, hooks: hooksManager}
+}
+
+// AuditCredentials records an access to a source's credentials by the actor
+// that authenticated the request in ctx
+func (l *Log) AuditCredentials(ctx context.Context, sourceID, action string) {
+	actor := auth.Actor(ctx)
+	entry := &database.AuditEntry{
+		Source:    sourceID,
+		Action:    action,
+		Actor:     actor,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := l.db.Create(entry).Error; err != nil {
+		slog.Error("Failed to record credential access", "error", err, "source", sourceID, "action", action)
+	}
+	slog.Info("Credentials accessed", "source", sourceID, "action", action, "actor", actor)
+
+	if l.hooks != nil {
+		// Deliveries outlive the request that caused the access
+		l.hooks.Emit(context.WithoutCancel(ctx), hooks.NewEvent(hooks.EventCredentialsAccessed, sourceID).WithAudit(action, actor))
+	}
+}
+
+// List returns audit entries, newest first. An empty source lists all
+// sources and a zero since lists entries of any age.
+func (l *Log) List(sourceID string, since time.Time, limit int) ([]database.AuditEntry, error) {
+	query := l.db.Order("created_at DESC, id DESC").Limit(limit)
+	if sourceID != "" {
+		query = query.Where("source = ?", sourceID)
+	}
+	if !since.IsZero() {
+		query = query.Where("created_at >= ?", since.UTC())
+	}
+	var entries []database.AuditEntry
+	return entries, query.Find(&entries).Error
+}
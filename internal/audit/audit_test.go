@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+)
+
+func setupTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gormDB.AutoMigrate(&database.AuditEntry{}, &database.Event{})
+	return &database.DB{DB: gormDB}
+}
+
+func TestAuditCredentials(t *testing.T) {
+	db := setupTestDB(t)
+	manager := hooks.New(db)
+	events, unsubscribe := manager.Subscribe(10)
+	defer unsubscribe()
+	log := New(db, manager)
+
+	log.AuditCredentials(context.Background(), "epo", "decrypted")
+	log.AuditCredentials(context.Background(), "uspto", "updated")
+
+	entries, err := log.List("", time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Source != "uspto" || entries[1].Actor != "system" {
+		t.Errorf("List = %+v, want both entries, newest first, by system", entries)
+	}
+	if entries, _ := log.List("epo", time.Time{}, 10); len(entries) != 1 || entries[0].Action != "decrypted" {
+		t.Errorf("List(epo) = %+v, want the decrypted entry", entries)
+	}
+
+	event := <-events
+	if event.Type != hooks.EventCredentialsAccessed || event.Source != "epo" ||
+		event.Audit == nil || event.Audit.Action != "decrypted" || event.Audit.Actor != "system" {
+		t.Errorf("event = %+v, want credentials.accessed for epo", event)
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+const (
+	// apiKeyPrefix tells standalone API keys apart from the passphrase
+	apiKeyPrefix = "blk_"
+	// apiKeyDisplayLength is how much of a key is kept to identify it
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+	// lastUsedInterval limits how often a key's last use is written
+	lastUsedInterval = time.Minute
+)
+
+const contextAPIKey = contextKey("apiKey")
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// CreateAPIKey generates a random API key restricted to the given scopes;
+// without scopes it has full access. The key is only returned here; the
+// database keeps its SHA-256 hash.
+func (s *Service) CreateAPIKey(name string, scopes []string) (string, *database.APIKey, error) {
+	if err := ValidateScopes(scopes); err != nil {
+		return "", nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	record := &database.APIKey{
+		Name:   name,
+		Prefix: key[:apiKeyDisplayLength],
+		Hash:   hashAPIKey(key),
+		Scopes: encodeScopes(scopes),
+	}
+	if err := s.db.Create(record).Error; err != nil {
+		return "", nil, err
+	}
+	return key, record, nil
+}
+
+func (s *Service) ListAPIKeys() ([]database.APIKey, error) {
+	var keys []database.APIKey
+	return keys, s.db.Order("id").Find(&keys).Error
+}
+
+// RevokeAPIKey deletes a key; requests using it are rejected from then on
+func (s *Service) RevokeAPIKey(id uint) error {
+	result := s.db.Delete(&database.APIKey{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// lookupAPIKey returns the stored key matching a standalone API key, or nil
+func (s *Service) lookupAPIKey(key string) *database.APIKey {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil
+	}
+	var record database.APIKey
+	if err := s.db.Where("hash = ?", hashAPIKey(key)).First(&record).Error; err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= lastUsedInterval {
+		record.LastUsedAt = &now
+		if err := s.db.Model(&record).Update("last_used_at", now).Error; err != nil {
+			slog.Warn("Failed to record API key use", "error", err, "apiKey", record.Prefix)
+		}
+	}
+	return &record
+}
+
+// APIKeyFromContext returns the standalone API key a request was
+// authenticated with, or nil for the passphrase and sessions
+func APIKeyFromContext(ctx context.Context) *database.APIKey {
+	key, _ := ctx.Value(contextAPIKey).(*database.APIKey)
+	return key
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
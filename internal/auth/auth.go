@@ -6,10 +6,12 @@ import (
 	"encoding/base64"
 	"errors"
 	"net/http"
+	"net/netip"
 	"time"
 
 	"github.com/patent-dev/bulk-file-loader/config"
 	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/oidc"
 )
 
 type contextKey string
@@ -19,12 +21,22 @@ const (
 	cookieMaxAge   = 24 * 60 * 60
 	apiKeyHeader   = "X-API-Key"
 	contextUserKey = contextKey("authenticated")
+	contextActor   = contextKey("actor")
+)
+
+// Actors recorded in the audit log besides named users and API keys
+const (
+	actorPassphrase = "passphrase"
+	actorSystem     = "system"
 )
 
 var (
 	ErrNotConfigured     = errors.New("passphrase not configured")
 	ErrInvalidPassword   = errors.New("invalid passphrase")
 	ErrAlreadyConfigured = errors.New("passphrase already configured")
+	ErrInvalidAPIKey     = errors.New("invalid API key")
+	ErrMissingScope      = errors.New("API key lacks the scope")
+	ErrReadOnly          = errors.New("server is in read-only mode")
 )
 
 type Service struct {
@@ -34,6 +46,15 @@ type Service struct {
 	encryptionSalt         []byte
 	onCredentialsReady     func()
 	credentialsReadyCalled bool
+	sessions               *sessionStore
+	oidc                   *oidc.Provider
+	oidcConfig             OIDCConfig
+	loginDisabled          bool
+	proxyHeader            string
+	trustedProxies         []netip.Prefix
+	trustUnixProxy         bool
+	proxyScopes            []string
+	readOnly               bool
 }
 
 func (s *Service) cookieSecure() bool {
@@ -49,7 +70,7 @@ func (s *Service) OnCredentialsReady(callback func()) {
 }
 
 func New(db *database.DB, cfg *config.Config) *Service {
-	s := &Service{db: db, cfg: cfg}
+	s := &Service{db: db, cfg: cfg, sessions: newSessionStore()}
 	if cfg.Passphrase != "" {
 		_ = s.setupFromEnv()
 	}
@@ -113,6 +134,21 @@ func (s *Service) loadEncryptionKeyFromPassphrase(passphrase string) error {
 	return nil
 }
 
+// ReloadEncryptionKey derives the credential key again after the settings it
+// depends on were replaced, e.g. by a standby restore. Without a configured
+// passphrase the key is cleared until the next login, and sessions end as
+// the passphrase may have changed.
+func (s *Service) ReloadEncryptionKey() {
+	s.sessions.clear()
+	s.encryptionKey = nil
+	s.encryptionSalt = nil
+	s.credentialsReadyCalled = false
+	if s.loadEncryptionKey() == nil && s.onCredentialsReady != nil {
+		s.credentialsReadyCalled = true
+		s.onCredentialsReady()
+	}
+}
+
 func (s *Service) IsConfigured() bool {
 	return s.db.HasSetting(database.SettingPassphraseHash)
 }
@@ -168,23 +204,40 @@ func (s *Service) Validate(passphrase string) bool {
 	return VerifyPassphrase(passphrase, salt, storedHash)
 }
 
+// Login validates the passphrase, unlocks credential decryption and sets a
+// cookie with a random session token; the passphrase never leaves the server.
 func (s *Service) Login(w http.ResponseWriter, passphrase string) error {
-	if !s.Validate(passphrase) {
+	if s.loginDisabled {
+		return ErrLoginDisabled
+	}
+	if !s.authenticatePassphrase(passphrase) {
 		return ErrInvalidPassword
 	}
+	token, err := s.sessions.create(cookieMaxAge*time.Second, nil, actorPassphrase)
+	if err != nil {
+		return err
+	}
+	s.setSessionCookie(w, token)
+	return nil
+}
+
+func (s *Service) setSessionCookie(w http.ResponseWriter, token string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     cookieName,
-		Value:    base64.StdEncoding.EncodeToString([]byte(passphrase)),
+		Value:    token,
 		Path:     "/",
 		HttpOnly: true,
 		Secure:   s.cookieSecure(),
 		SameSite: http.SameSiteLaxMode,
 		MaxAge:   cookieMaxAge,
 	})
-	return nil
 }
 
-func (s *Service) Logout(w http.ResponseWriter) {
+// Logout ends the request's session and clears its cookie
+func (s *Service) Logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(cookieName); err == nil {
+		s.sessions.delete(cookie.Value)
+	}
 	http.SetCookie(w, &http.Cookie{
 		Name:     cookieName,
 		Value:    "",
@@ -199,37 +252,92 @@ func (s *Service) Logout(w http.ResponseWriter) {
 
 func (s *Service) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Public routes that don't require authentication
 		path := r.URL.Path
-		if path == "/api/health" || path == "/api/auth/status" || path == "/api/auth/setup" || path == "/api/auth/login" {
+		// A backup changes nothing, so it stays available in read-only mode
+		if s.readOnly && path != "/api/auth/login" && path != "/api/system/backup" && !allows(readOnlyScopes, r.Method, path) {
+			http.Error(w, "Server is in read-only mode", http.StatusForbidden)
+			return
+		}
+
+		// Public routes that don't require authentication
+		if path == "/api/health" || path == "/api/auth/status" || path == "/api/auth/setup" || path == "/api/auth/login" ||
+			path == "/api/auth/oidc/login" || path == "/api/auth/oidc/callback" {
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		if user := s.proxyUser(r); user != "" {
+			if !allows(s.proxyScopes, r.Method, path) {
+				http.Error(w, "Your role doesn't allow this request", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, authenticated(r, "proxy:"+user))
+			return
+		}
+
 		if apiKey := r.Header.Get(apiKeyHeader); apiKey != "" {
-			if s.Validate(apiKey) {
-				s.ensureEncryptionKey(apiKey)
-				ctx := context.WithValue(r.Context(), contextUserKey, true)
-				next.ServeHTTP(w, r.WithContext(ctx))
+			if key := s.lookupAPIKey(apiKey); key != nil {
+				if !allows(ParseScopes(key.Scopes), r.Method, path) {
+					http.Error(w, "API key lacks the scope for this request", http.StatusForbidden)
+					return
+				}
+				r = authenticated(r, "api-key:"+key.Name)
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextAPIKey, key)))
+				return
+			}
+			if s.authenticatePassphrase(apiKey) {
+				next.ServeHTTP(w, authenticated(r, actorPassphrase))
 				return
 			}
 		}
 
-		cookie, err := r.Cookie(cookieName)
-		if err == nil {
-			passphrase, err := base64.StdEncoding.DecodeString(cookie.Value)
-			if err == nil && s.Validate(string(passphrase)) {
-				s.ensureEncryptionKey(string(passphrase))
-				ctx := context.WithValue(r.Context(), contextUserKey, true)
-				next.ServeHTTP(w, r.WithContext(ctx))
+		if cookie, err := r.Cookie(cookieName); err == nil {
+			sess, ok := s.sessions.get(cookie.Value)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !allows(sess.scopes, r.Method, path) {
+				http.Error(w, "Your role doesn't allow this request", http.StatusForbidden)
 				return
 			}
+			next.ServeHTTP(w, authenticated(r, sess.actor))
+			return
 		}
 
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 	})
 }
 
+// AuthenticateAPIKey validates an API key for non-HTTP transports (e.g. gRPC),
+// either a standalone key granted the scope or the passphrase, like the HTTP
+// middleware.
+func (s *Service) AuthenticateAPIKey(apiKey, scope string) error {
+	if s.readOnly && scope != ScopeRead {
+		return ErrReadOnly
+	}
+	if key := s.lookupAPIKey(apiKey); key != nil {
+		if !hasScope(ParseScopes(key.Scopes), scope) {
+			return ErrMissingScope
+		}
+		return nil
+	}
+	if !s.authenticatePassphrase(apiKey) {
+		return ErrInvalidAPIKey
+	}
+	return nil
+}
+
+// authenticatePassphrase validates the passphrase sent as API key and unlocks
+// credential decryption on first use. Standalone keys never unlock it.
+func (s *Service) authenticatePassphrase(passphrase string) bool {
+	if !s.Validate(passphrase) {
+		return false
+	}
+	s.ensureEncryptionKey(passphrase)
+	return true
+}
+
 func (s *Service) ensureEncryptionKey(passphrase string) {
 	if s.encryptionKey == nil {
 		if err := s.loadEncryptionKeyFromPassphrase(passphrase); err == nil {
@@ -241,23 +349,39 @@ func (s *Service) ensureEncryptionKey(passphrase string) {
 	}
 }
 
+// authenticated marks the request as authenticated by the actor
+func authenticated(r *http.Request, actor string) *http.Request {
+	ctx := context.WithValue(r.Context(), contextUserKey, true)
+	return r.WithContext(context.WithValue(ctx, contextActor, actor))
+}
+
+// Actor returns who authenticated the request, e.g. api-key:ci or
+// oidc:ada@example.com, or "system" for work the server does on its own
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(contextActor).(string); ok && actor != "" {
+		return actor
+	}
+	return actorSystem
+}
+
 func IsAuthenticated(ctx context.Context) bool {
 	auth, ok := ctx.Value(contextUserKey).(bool)
 	return ok && auth
 }
 
 func (s *Service) CheckAuthentication(r *http.Request) bool {
-	if apiKey := r.Header.Get(apiKeyHeader); apiKey != "" && s.Validate(apiKey) {
+	if s.proxyUser(r) != "" {
+		return true
+	}
+	if apiKey := r.Header.Get(apiKeyHeader); apiKey != "" && (s.lookupAPIKey(apiKey) != nil || s.Validate(apiKey)) {
 		return true
 	}
 	cookie, err := r.Cookie(cookieName)
-	if err == nil {
-		passphrase, err := base64.StdEncoding.DecodeString(cookie.Value)
-		if err == nil && s.Validate(string(passphrase)) {
-			return true
-		}
+	if err != nil {
+		return false
 	}
-	return false
+	_, ok := s.sessions.get(cookie.Value)
+	return ok
 }
 
 func (s *Service) EncryptCredentials(plaintext []byte) ([]byte, error) {
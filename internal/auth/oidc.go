@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/oidc"
+)
+
+// Roles of users signing in with OIDC, granted by the groups of their ID
+// token, or through an authenticating proxy
+const (
+	// RoleAdmin has full access, like the passphrase
+	RoleAdmin = "admin"
+	// RoleOperator may read and trigger downloads
+	RoleOperator = "operator"
+	// RoleViewer may only read
+	RoleViewer = "viewer"
+)
+
+// roles lists the roles from lowest to highest
+var roles = []string{RoleViewer, RoleOperator, RoleAdmin}
+
+// roleScopes are the scopes of each role's sessions
+var roleScopes = map[string][]string{
+	RoleViewer:   {ScopeRead},
+	RoleOperator: {ScopeRead, ScopeDownloads},
+	RoleAdmin:    nil,
+}
+
+const (
+	oidcStateCookie = "bulk_loader_oidc"
+	// oidcStateMaxAge matches how long the provider keeps a login pending
+	oidcStateMaxAge = 10 * 60
+)
+
+var (
+	ErrOIDCNotConfigured = errors.New("OIDC login not configured")
+	// ErrNoRole is returned for OIDC users without a group mapped to a role
+	ErrNoRole = errors.New("no role granted to the user")
+)
+
+// OIDCConfig enables login through an OpenID Connect provider
+type OIDCConfig struct {
+	oidc.Config
+	// GroupsClaim is the ID token claim listing the user's groups; dots
+	// address nested claims
+	GroupsClaim string
+	// Roles maps groups to roles. Without mapping every user of the
+	// provider who may sign in to the client is an admin.
+	Roles map[string]string
+}
+
+// ParseRoles parses a group to role mapping such as
+// "loader-admins=admin,analysts=viewer"
+func ParseRoles(s string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(entry, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" {
+			return nil, fmt.Errorf("invalid role mapping %q, want group=role", entry)
+		}
+		if !slices.Contains(roles, role) {
+			return nil, fmt.Errorf("unknown role %q, want admin, operator or viewer", role)
+		}
+		mapping[group] = role
+	}
+	return mapping, nil
+}
+
+// SetOIDC enables OIDC login; an empty issuer leaves it disabled
+func (s *Service) SetOIDC(cfg OIDCConfig) error {
+	if cfg.Issuer == "" {
+		return nil
+	}
+	provider, err := oidc.New(cfg.Config)
+	if err != nil {
+		return err
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	s.oidc = provider
+	s.oidcConfig = cfg
+	return nil
+}
+
+// OIDCEnabled reports whether users can sign in through the OIDC provider
+func (s *Service) OIDCEnabled() bool {
+	return s.oidc != nil
+}
+
+// StartOIDCLogin returns the provider URL to redirect the browser to, and
+// binds the login to the browser with a cookie
+func (s *Service) StartOIDCLogin(w http.ResponseWriter, r *http.Request) (string, error) {
+	if s.oidc == nil {
+		return "", ErrOIDCNotConfigured
+	}
+	authURL, state, err := s.oidc.AuthURL(r.Context())
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		HttpOnly: true,
+		Secure:   s.cookieSecure(),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   oidcStateMaxAge,
+	})
+	return authURL, nil
+}
+
+// FinishOIDCLogin handles the provider's callback: it verifies the user's ID
+// token and starts a session with the scopes of the user's role
+func (s *Service) FinishOIDCLogin(w http.ResponseWriter, r *http.Request) error {
+	if s.oidc == nil {
+		return ErrOIDCNotConfigured
+	}
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		return fmt.Errorf("provider refused the login: %s %s", errCode, query.Get("error_description"))
+	}
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		return oidc.ErrUnknownState
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc", MaxAge: -1})
+
+	claims, err := s.oidc.Exchange(r.Context(), state, query.Get("code"))
+	if err != nil {
+		return err
+	}
+	role := s.roleFor(claims)
+	if role == "" {
+		slog.Warn("OIDC login without role", "user", claims.Name(), "groups", claims.Strings(s.oidcConfig.GroupsClaim))
+		return ErrNoRole
+	}
+
+	token, err := s.sessions.create(cookieMaxAge*time.Second, roleScopes[role], "oidc:"+claims.Name())
+	if err != nil {
+		return err
+	}
+	s.setSessionCookie(w, token)
+	slog.Info("OIDC login", "user", claims.Name(), "role", role)
+	return nil
+}
+
+// roleFor returns the highest role the user's groups are mapped to
+func (s *Service) roleFor(claims oidc.Claims) string {
+	if len(s.oidcConfig.Roles) == 0 {
+		return RoleAdmin
+	}
+	best := -1
+	for _, group := range claims.Strings(s.oidcConfig.GroupsClaim) {
+		if role, ok := s.oidcConfig.Roles[group]; ok {
+			best = max(best, slices.Index(roles, role))
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return roles[best]
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/patent-dev/bulk-file-loader/internal/oidc"
+)
+
+func TestRoleFor(t *testing.T) {
+	roles, err := ParseRoles("loader-admins=admin, analysts=viewer,ops=operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{oidcConfig: OIDCConfig{GroupsClaim: "groups", Roles: roles}}
+
+	tests := []struct {
+		groups []any
+		want   string
+	}{
+		{[]any{"analysts"}, RoleViewer},
+		{[]any{"analysts", "ops"}, RoleOperator},
+		{[]any{"ops", "loader-admins", "analysts"}, RoleAdmin},
+		{[]any{"staff"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := s.roleFor(oidc.Claims{"groups": tt.groups}); got != tt.want {
+			t.Errorf("roleFor(%v) = %q, want %q", tt.groups, got, tt.want)
+		}
+	}
+
+	s.oidcConfig.Roles = nil
+	if got := s.roleFor(oidc.Claims{}); got != RoleAdmin {
+		t.Errorf("roleFor without mapping = %q, want %q", got, RoleAdmin)
+	}
+
+	for _, invalid := range []string{"admins", "=admin", "admins=root"} {
+		if _, err := ParseRoles(invalid); err == nil {
+			t.Errorf("ParseRoles(%q) accepted an invalid mapping", invalid)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// trustedUnix trusts connections over the unix socket, which have no address
+const trustedUnix = "unix"
+
+var ErrLoginDisabled = errors.New("passphrase login disabled")
+
+// ProxyAuthConfig configures authentication by a reverse proxy such as
+// oauth2-proxy or Authelia, which signs users in and passes the user name in
+// a header
+type ProxyAuthConfig struct {
+	// Header carries the authenticated user, e.g. X-Forwarded-User; empty
+	// disables proxy authentication
+	Header string
+	// Trusted lists the IPs and CIDR ranges the proxy connects from, and
+	// "unix" for the unix socket. The header is ignored on other connections.
+	Trusted []string
+	// Role is granted to proxy users: admin (the default), operator or
+	// viewer
+	Role string
+	// DisableLogin turns off passphrase login, e.g. when the proxy is the only
+	// way in
+	DisableLogin bool
+}
+
+// SetProxyAuth enables authentication by a trusted reverse proxy and turns off
+// passphrase login if configured
+func (s *Service) SetProxyAuth(cfg ProxyAuthConfig) error {
+	if cfg.DisableLogin && s.cfg.Passphrase == "" {
+		return errors.New("disabling the passphrase login requires BULK_LOADER_PASSPHRASE, which unlocks the credentials")
+	}
+	s.loginDisabled = cfg.DisableLogin
+	if cfg.Header == "" {
+		return nil
+	}
+	if cfg.Role == "" {
+		cfg.Role = RoleAdmin
+	}
+	if !slices.Contains(roles, cfg.Role) {
+		return fmt.Errorf("unknown proxy user role %q, want admin, operator or viewer", cfg.Role)
+	}
+
+	var trusted []netip.Prefix
+	trustUnix := false
+	for _, entry := range cfg.Trusted {
+		if entry == trustedUnix {
+			trustUnix = true
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return fmt.Errorf("invalid trusted proxy %q, want an IP, a CIDR range or unix", entry)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+	if len(trusted) == 0 && !trustUnix {
+		return errors.New("proxy authentication requires trusted proxies")
+	}
+	s.proxyHeader = http.CanonicalHeaderKey(cfg.Header)
+	s.trustedProxies = trusted
+	s.trustUnixProxy = trustUnix
+	s.proxyScopes = roleScopes[cfg.Role]
+	return nil
+}
+
+// LoginDisabled reports whether passphrase login is turned off
+func (s *Service) LoginDisabled() bool {
+	return s.loginDisabled
+}
+
+// proxyUser returns the user the trusted proxy authenticated, or "" if the
+// request didn't come through it
+func (s *Service) proxyUser(r *http.Request) string {
+	if s.proxyHeader == "" {
+		return ""
+	}
+	user := strings.TrimSpace(r.Header.Get(s.proxyHeader))
+	if user == "" || !s.fromTrustedProxy(r.RemoteAddr) {
+		return ""
+	}
+	return user
+}
+
+func (s *Service) fromTrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		// Connections over the unix socket have no IP address
+		return s.trustUnixProxy
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
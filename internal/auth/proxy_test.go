@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+)
+
+func TestProxyAuth(t *testing.T) {
+	s := &Service{cfg: &config.Config{}, sessions: newSessionStore()}
+	if err := s.SetProxyAuth(ProxyAuthConfig{Header: "X-Forwarded-User", Trusted: []string{"10.0.0.0/8", "::1", "unix"}}); err != nil {
+		t.Fatal(err)
+	}
+	protected := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		remoteAddr, user string
+		want             int
+	}{
+		{"10.1.2.3:41000", "ada", http.StatusOK},
+		{"[::1]:41000", "ada", http.StatusOK},
+		{"@", "ada", http.StatusOK}, // unix socket
+		{"10.1.2.3:41000", "", http.StatusUnauthorized},
+		{"192.168.1.5:41000", "ada", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/files", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.user != "" {
+			req.Header.Set("X-Forwarded-User", tt.user)
+		}
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("request from %s as %q status = %d, want %d", tt.remoteAddr, tt.user, w.Code, tt.want)
+		}
+	}
+
+	if err := s.SetProxyAuth(ProxyAuthConfig{Header: "X-Forwarded-User", Trusted: []string{"10.0.0.0/8"}, Role: RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+	for method, want := range map[string]int{http.MethodGet: http.StatusOK, http.MethodDelete: http.StatusForbidden} {
+		req := httptest.NewRequest(method, "/api/files/f1", nil)
+		req.RemoteAddr = "10.1.2.3:41000"
+		req.Header.Set("X-Forwarded-User", "ada")
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("viewer %s status = %d, want %d", method, w.Code, want)
+		}
+	}
+
+	for _, invalid := range []ProxyAuthConfig{
+		{Header: "X-Forwarded-User", Trusted: []string{"proxy.example.com"}},
+		{Header: "X-Forwarded-User", Trusted: []string{"10.0.0.0/8"}, Role: "root"},
+		{Header: "X-Forwarded-User"},
+		{DisableLogin: true},
+	} {
+		if err := s.SetProxyAuth(invalid); err == nil {
+			t.Errorf("SetProxyAuth(%+v) accepted an invalid configuration", invalid)
+		}
+	}
+}
+
+func TestDisableLogin(t *testing.T) {
+	s := &Service{cfg: &config.Config{Passphrase: "testpassphrase123"}, sessions: newSessionStore()}
+	if err := s.SetProxyAuth(ProxyAuthConfig{DisableLogin: true}); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	if err := s.Login(w, "testpassphrase123"); !errors.Is(err, ErrLoginDisabled) {
+		t.Errorf("Login err = %v, want ErrLoginDisabled", err)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("disabled login should not set a session cookie")
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// API key scopes. A key without scopes may do everything except managing API
+// keys; scoped keys can't export the state or back up and restore either.
+const (
+	// ScopeRead allows GET requests
+	ScopeRead = "read"
+	// ScopeDownloads allows triggering and cancelling downloads and syncs
+	ScopeDownloads = "downloads"
+	// ScopeWebhooks allows managing webhooks and notifiers
+	ScopeWebhooks = "webhooks"
+)
+
+// Scopes lists the valid scopes
+var Scopes = []string{ScopeRead, ScopeDownloads, ScopeWebhooks}
+
+// readOnlyScopes restrict all requests in read-only mode
+var readOnlyScopes = []string{ScopeRead}
+
+// SetReadOnly restricts every client, whatever its credentials, to reading.
+// Scheduled syncs and downloads continue.
+func (s *Service) SetReadOnly(readOnly bool) {
+	s.readOnly = readOnly
+}
+
+// ReadOnly reports whether the server is in read-only mode
+func (s *Service) ReadOnly() bool {
+	return s.readOnly
+}
+
+// ValidateScopes checks all scopes are known
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("unknown scope %q, want one of %s", scope, strings.Join(Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+// ParseScopes decodes the scopes stored with a key
+func ParseScopes(encoded string) []string {
+	var scopes []string
+	if encoded != "" {
+		json.Unmarshal([]byte(encoded), &scopes)
+	}
+	return scopes
+}
+
+func encodeScopes(scopes []string) string {
+	if len(scopes) == 0 {
+		return ""
+	}
+	encoded, _ := json.Marshal(scopes)
+	return string(encoded)
+}
+
+// hasScope reports whether the scopes grant the scope; no scopes grant all
+func hasScope(scopes []string, scope string) bool {
+	return len(scopes) == 0 || slices.Contains(scopes, scope)
+}
+
+// allows reports whether an API key or session with the scopes may make an
+// API request
+func allows(scopes []string, method, path string) bool {
+	switch path {
+	case "/api/auth/logout":
+		return true
+	case "/api/system/state", "/api/system/backup", "/api/system/restore":
+		// The state export and backups contain the encrypted credentials
+		return len(scopes) == 0
+	}
+	if len(scopes) == 0 {
+		return true
+	}
+	if hasScope(scopes, ScopeRead) && (method == http.MethodGet || method == http.MethodHead || path == "/api/schedule/validate") {
+		return true
+	}
+	if hasScope(scopes, ScopeDownloads) && isDownloadTrigger(method, path) {
+		return true
+	}
+	return hasScope(scopes, ScopeWebhooks) && (path == "/api/hooks" || strings.HasPrefix(path, "/api/hooks/"))
+}
+
+// isDownloadTrigger reports whether a request starts or cancels a download or
+// a sync
+func isDownloadTrigger(method, path string) bool {
+	parts := strings.Split(strings.TrimPrefix(path, "/api/"), "/")
+	if method != http.MethodPost || len(parts) != 3 {
+		return false
+	}
+	switch parts[0] {
+	case "files":
+		return parts[2] == "download" || parts[2] == "cancel"
+	case "products", "sources":
+		return parts[2] == "sync"
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		scopes       []string
+		method, path string
+		want         bool
+	}{
+		{nil, http.MethodPut, "/api/sources/epo", true},
+		{nil, http.MethodGet, "/api/system/state", true},
+		{[]string{ScopeRead}, http.MethodGet, "/api/files", true},
+		{[]string{ScopeRead}, http.MethodGet, "/api/system/state", false},
+		{[]string{ScopeWebhooks}, http.MethodPost, "/api/system/backup", false},
+		{[]string{ScopeRead}, http.MethodPut, "/api/sources/epo", false},
+		{[]string{ScopeDownloads}, http.MethodPost, "/api/products/epo:docdb/sync", true},
+		{[]string{ScopeDownloads}, http.MethodDelete, "/api/files/f1", false},
+		{[]string{ScopeWebhooks}, http.MethodPost, "/api/hooks/slack", true},
+	}
+	for _, tt := range tests {
+		if got := allows(tt.scopes, tt.method, tt.path); got != tt.want {
+			t.Errorf("allows(%v, %s %s) = %v, want %v", tt.scopes, tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	s := &Service{cfg: &config.Config{}, sessions: newSessionStore()}
+	if err := s.SetProxyAuth(ProxyAuthConfig{Header: "X-Forwarded-User", Trusted: []string{"10.0.0.0/8"}}); err != nil {
+		t.Fatal(err)
+	}
+	s.SetReadOnly(true)
+	protected := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/files", http.StatusOK},
+		{http.MethodPost, "/api/schedule/validate", http.StatusOK},
+		{http.MethodPost, "/api/auth/logout", http.StatusOK},
+		{http.MethodPost, "/api/files/f1/download", http.StatusForbidden},
+		{http.MethodPut, "/api/sources/epo/credentials", http.StatusForbidden},
+		{http.MethodDelete, "/api/hooks/webhooks/1", http.StatusForbidden},
+		{http.MethodPost, "/api/auth/setup", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.RemoteAddr = "10.0.0.1:41000"
+		req.Header.Set("X-Forwarded-User", "admin")
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+
+	if err := s.AuthenticateAPIKey("anything", ScopeDownloads); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("AuthenticateAPIKey for downloads err = %v, want ErrReadOnly", err)
+	}
+}
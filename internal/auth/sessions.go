@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// session is a logged in browser. Passphrase logins have full access; OIDC
+// logins are restricted to the scopes of the user's role.
+type session struct {
+	expires time.Time
+	scopes  []string
+	// actor identifies the user in the audit log
+	actor string
+}
+
+// sessionStore keeps the sessions of logged in browsers in memory, by the
+// SHA-256 hash of their token. Sessions end on restart, where logging in again
+// also unlocks the credentials unless the passphrase is configured.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]session)}
+}
+
+// create issues a random token valid for the given duration
+func (st *sessionStore) create(ttl time.Duration, scopes []string, actor string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	for hash, sess := range st.sessions {
+		if now.After(sess.expires) {
+			delete(st.sessions, hash)
+		}
+	}
+	st.sessions[hashAPIKey(token)] = session{expires: now.Add(ttl), scopes: scopes, actor: actor}
+	return token, nil
+}
+
+// get returns the unexpired session of the token
+func (st *sessionStore) get(token string) (session, bool) {
+	if token == "" {
+		return session{}, false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sess, ok := st.sessions[hashAPIKey(token)]
+	if !ok || time.Now().After(sess.expires) {
+		return session{}, false
+	}
+	return sess, true
+}
+
+func (st *sessionStore) delete(token string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.sessions, hashAPIKey(token))
+}
+
+// clear ends all sessions
+func (st *sessionStore) clear() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	clear(st.sessions)
+}
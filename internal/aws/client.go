@@ -0,0 +1,280 @@
+// Package aws sends messages to Amazon SQS queues and SNS topics over their
+// query APIs, signed with Signature Version 4.
+package aws
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRegion  = "us-east-1"
+	requestTimeout = 30 * time.Second
+	sqsVersion     = "2012-11-05"
+	snsVersion     = "2010-03-31"
+)
+
+// Config holds the credentials and where to send requests
+type Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials
+	SessionToken string
+	// Region is used when it can't be taken from the queue URL or topic ARN
+	Region string
+	// Endpoint replaces the AWS endpoints, e.g. for LocalStack
+	Endpoint string
+}
+
+// Error is an error response of SQS or SNS
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("aws: status %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Retriable reports whether the request may succeed when sent again, e.g.
+// after throttling
+func (e *Error) Retriable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || strings.Contains(e.Code, "Throttl")
+}
+
+// Message is a message with string attributes, which SNS subscription filter
+// policies and SQS consumers can select on
+type Message struct {
+	Body       string
+	Attributes map[string]string
+	// GroupID orders messages of FIFO queues and topics; it is ignored for
+	// standard ones
+	GroupID string
+}
+
+// Client is a minimal SQS and SNS client. It is safe for concurrent use.
+type Client struct {
+	cfg        Config
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+func NewClient(cfg Config) *Client {
+	return &Client{cfg: cfg, httpClient: &http.Client{Timeout: requestTimeout}, now: time.Now}
+}
+
+// ParseQueueURL checks an SQS queue URL and returns the queue's region, if
+// the URL contains one
+func ParseQueueURL(queueURL string) (string, error) {
+	u, err := url.Parse(queueURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Count(strings.Trim(u.Path, "/"), "/") != 1 {
+		return "", fmt.Errorf("invalid SQS queue URL %q, want https://sqs.<region>.amazonaws.com/<account>/<queue>", queueURL)
+	}
+	if host, ok := strings.CutPrefix(u.Hostname(), "sqs."); ok {
+		if region, _, ok := strings.Cut(host, "."); ok {
+			return region, nil
+		}
+	}
+	return "", nil
+}
+
+// ParseTopicARN checks an SNS topic ARN and returns the topic's region
+func ParseTopicARN(arn string) (string, error) {
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" || parts[3] == "" || parts[5] == "" {
+		return "", fmt.Errorf("invalid SNS topic ARN %q, want arn:aws:sns:<region>:<account>:<topic>", arn)
+	}
+	return parts[3], nil
+}
+
+// SendMessage sends a message to an SQS queue
+func (c *Client) SendMessage(ctx context.Context, queueURL string, msg Message) error {
+	region, err := ParseQueueURL(queueURL)
+	if err != nil {
+		return err
+	}
+	form := url.Values{
+		"Action":      {"SendMessage"},
+		"Version":     {sqsVersion},
+		"MessageBody": {msg.Body},
+	}
+	addAttributes(form, "MessageAttribute", msg.Attributes)
+	if strings.HasSuffix(queueURL, ".fifo") {
+		addFIFO(form, msg)
+	}
+
+	endpoint := queueURL
+	if c.cfg.Endpoint != "" {
+		// The queue is addressed by the path of its URL
+		u, _ := url.Parse(queueURL)
+		endpoint = strings.TrimSuffix(c.cfg.Endpoint, "/") + u.Path
+	}
+	return c.post(ctx, "sqs", region, endpoint, form)
+}
+
+// Publish publishes a message to an SNS topic
+func (c *Client) Publish(ctx context.Context, topicARN string, msg Message) error {
+	region, err := ParseTopicARN(topicARN)
+	if err != nil {
+		return err
+	}
+	form := url.Values{
+		"Action":   {"Publish"},
+		"Version":  {snsVersion},
+		"TopicArn": {topicARN},
+		"Message":  {msg.Body},
+	}
+	addAttributes(form, "MessageAttributes.entry", msg.Attributes)
+	if strings.HasSuffix(topicARN, ".fifo") {
+		addFIFO(form, msg)
+	}
+
+	endpoint := "https://sns." + region + ".amazonaws.com/"
+	if c.cfg.Endpoint != "" {
+		endpoint = strings.TrimSuffix(c.cfg.Endpoint, "/") + "/"
+	}
+	return c.post(ctx, "sns", region, endpoint, form)
+}
+
+// addAttributes adds string message attributes, sorted by name; SQS and SNS
+// differ only in the prefix
+func addAttributes(form url.Values, prefix string, attributes map[string]string) {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		p := prefix + "." + strconv.Itoa(i+1)
+		form.Set(p+".Name", name)
+		form.Set(p+".Value.DataType", "String")
+		form.Set(p+".Value.StringValue", attributes[name])
+	}
+}
+
+// addFIFO sets the message group and deduplicates identical bodies, so FIFO
+// queues and topics work without content-based deduplication
+func addFIFO(form url.Values, msg Message) {
+	groupID := msg.GroupID
+	if groupID == "" {
+		groupID = "default"
+	}
+	form.Set("MessageGroupId", groupID)
+	form.Set("MessageDeduplicationId", hashHex(msg.Body))
+}
+
+func (c *Client) post(ctx context.Context, service, region, endpoint string, form url.Values) error {
+	if region == "" {
+		region = c.cfg.Region
+	}
+	if region == "" {
+		region = defaultRegion
+	}
+	body := form.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if c.cfg.AccessKeyID != "" {
+		c.sign(req, service, region, body)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil
+	}
+	var errResp struct {
+		Error struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&errResp)
+	return &Error{StatusCode: resp.StatusCode, Code: errResp.Error.Code, Message: errResp.Error.Message}
+}
+
+// sign adds a Signature Version 4 authorization header
+func (c *Client) sign(req *http.Request, service, region, body string) {
+	t := c.now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hashHex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
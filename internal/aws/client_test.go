@@ -0,0 +1,139 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSign uses the get-vanilla example of the AWS Signature Version 4 test
+// suite
+func TestSign(t *testing.T) {
+	c := NewClient(Config{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"})
+	c.now = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	c.sign(req, "service", "us-east-1", "")
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+}
+
+// request is a request received by the fake service
+type request struct {
+	path          string
+	authorization string
+	form          url.Values
+}
+
+func fakeService(t *testing.T, status int, body string) (string, <-chan request) {
+	t.Helper()
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		requests <- request{r.URL.Path, r.Header.Get("Authorization"), r.PostForm}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, requests
+}
+
+func TestSendMessage(t *testing.T) {
+	endpoint, requests := fakeService(t, http.StatusOK, "<SendMessageResponse/>")
+	c := NewClient(Config{AccessKeyID: "AKID", SecretAccessKey: "secret", Endpoint: endpoint})
+
+	msg := Message{Body: `{"event":"file.downloaded"}`, Attributes: map[string]string{"source": "epo", "event": "file.downloaded"}, GroupID: "epo"}
+	if err := c.SendMessage(context.Background(), "https://sqs.eu-west-1.amazonaws.com/123456789012/events.fifo", msg); err != nil {
+		t.Fatal(err)
+	}
+	got := <-requests
+	if got.path != "/123456789012/events.fifo" {
+		t.Errorf("path = %q", got.path)
+	}
+	if !strings.Contains(got.authorization, "/eu-west-1/sqs/aws4_request") {
+		t.Errorf("Authorization = %q, want an eu-west-1 sqs scope", got.authorization)
+	}
+	want := map[string]string{
+		"Action":                               "SendMessage",
+		"MessageBody":                          msg.Body,
+		"MessageAttribute.1.Name":              "event",
+		"MessageAttribute.1.Value.DataType":    "String",
+		"MessageAttribute.2.Name":              "source",
+		"MessageAttribute.2.Value.StringValue": "epo",
+		"MessageGroupId":                       "epo",
+		"MessageDeduplicationId":               hashHex(msg.Body),
+	}
+	for name, value := range want {
+		if got.form.Get(name) != value {
+			t.Errorf("%s = %q, want %q", name, got.form.Get(name), value)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	endpoint, requests := fakeService(t, http.StatusOK, "<PublishResponse/>")
+	c := NewClient(Config{AccessKeyID: "AKID", SecretAccessKey: "secret", Endpoint: endpoint})
+
+	msg := Message{Body: "{}", Attributes: map[string]string{"event": "file.downloaded"}}
+	if err := c.Publish(context.Background(), "arn:aws:sns:us-west-2:123456789012:events", msg); err != nil {
+		t.Fatal(err)
+	}
+	got := <-requests
+	if !strings.Contains(got.authorization, "/us-west-2/sns/aws4_request") {
+		t.Errorf("Authorization = %q, want a us-west-2 sns scope", got.authorization)
+	}
+	if got.form.Get("TopicArn") != "arn:aws:sns:us-west-2:123456789012:events" ||
+		got.form.Get("MessageAttributes.entry.1.Value.StringValue") != "file.downloaded" ||
+		got.form.Has("MessageGroupId") {
+		t.Errorf("form = %v", got.form)
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	tests := []struct {
+		status    int
+		code      string
+		retriable bool
+	}{
+		{http.StatusForbidden, "AuthorizationError", false},
+		{http.StatusBadRequest, "Throttling", true},
+		{http.StatusInternalServerError, "InternalError", true},
+	}
+	for _, tt := range tests {
+		endpoint, _ := fakeService(t, tt.status, "<ErrorResponse><Error><Type>Sender</Type><Code>"+tt.code+"</Code><Message>denied</Message></Error></ErrorResponse>")
+		c := NewClient(Config{Endpoint: endpoint})
+		err := c.Publish(context.Background(), "arn:aws:sns:us-east-1:123456789012:events", Message{Body: "{}"})
+		var awsErr *Error
+		if !errors.As(err, &awsErr) || awsErr.Code != tt.code || awsErr.Retriable() != tt.retriable {
+			t.Errorf("%s: err = %v, want retriable %v", tt.code, err, tt.retriable)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if region, err := ParseQueueURL("https://sqs.eu-central-1.amazonaws.com/123456789012/events"); err != nil || region != "eu-central-1" {
+		t.Errorf("ParseQueueURL = %q, %v", region, err)
+	}
+	if region, err := ParseQueueURL("http://localhost:4566/000000000000/events"); err != nil || region != "" {
+		t.Errorf("ParseQueueURL of an emulator URL = %q, %v", region, err)
+	}
+	for _, invalid := range []string{"sqs.eu-central-1.amazonaws.com/1/events", "https://sqs.eu-central-1.amazonaws.com/events"} {
+		if _, err := ParseQueueURL(invalid); err == nil {
+			t.Errorf("ParseQueueURL accepted %q", invalid)
+		}
+	}
+	for _, invalid := range []string{"arn:aws:sqs:us-east-1:1:events", "events", "arn:aws:sns::1:events"} {
+		if _, err := ParseTopicARN(invalid); err == nil {
+			t.Errorf("ParseTopicARN accepted %q", invalid)
+		}
+	}
+}
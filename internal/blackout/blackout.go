@@ -0,0 +1,181 @@
+// Package blackout describes recurring periods, such as weekday business
+// hours, during which no scheduled syncs run and no downloads start. The same
+// periods describe download windows, outside of which no downloads start.
+package blackout
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Period is a daily time range on some weekdays. A range ending before it
+// starts runs past midnight into the next day.
+type Period struct {
+	Days  [7]bool // indexed by time.Weekday
+	Start int     // minutes after midnight
+	End   int
+}
+
+// Schedule is a set of periods; the zero value has none
+type Schedule []Period
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Parse parses a comma-separated list of periods such as
+// "Mon-Fri 08:00-18:00,Sat 22:00-02:00". The days are a single day or a
+// range and may be omitted for every day.
+func Parse(value string) (Schedule, error) {
+	var schedule Schedule
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		period, err := parsePeriod(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid period %q: %w", entry, err)
+		}
+		schedule = append(schedule, period)
+	}
+	return schedule, nil
+}
+
+func parsePeriod(entry string) (Period, error) {
+	var p Period
+	fields := strings.Fields(entry)
+	switch len(fields) {
+	case 1:
+		for i := range p.Days {
+			p.Days[i] = true
+		}
+	case 2:
+		first, last, isRange := strings.Cut(fields[0], "-")
+		from, ok := weekdays[strings.ToLower(first)]
+		if !ok {
+			return p, fmt.Errorf("unknown day %q", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdays[strings.ToLower(last)]; !ok {
+				return p, fmt.Errorf("unknown day %q", last)
+			}
+		}
+		// Ranges may wrap around the week, e.g. Fri-Mon
+		for d := from; ; d = (d + 1) % 7 {
+			p.Days[d] = true
+			if d == to {
+				break
+			}
+		}
+	default:
+		return p, fmt.Errorf("expected [days] HH:MM-HH:MM")
+	}
+
+	start, end, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return p, fmt.Errorf("expected a time range HH:MM-HH:MM")
+	}
+	var err error
+	if p.Start, err = parseClock(start); err != nil {
+		return p, err
+	}
+	if p.End, err = parseClock(end); err != nil {
+		return p, err
+	}
+	if p.Start == p.End {
+		return p, fmt.Errorf("empty time range")
+	}
+	return p, nil
+}
+
+// parseClock parses HH:MM into minutes after midnight; 24:00 is midnight at
+// the end of the day
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		if value == "24:00" {
+			return 24 * 60, nil
+		}
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// End reports whether t falls into a blackout period and, if so, when the
+// blackout ends. Overlapping and adjoining periods count as one.
+func (s Schedule) End(t time.Time) (time.Time, bool) {
+	end, ok := s.periodEnd(t)
+	if !ok {
+		return time.Time{}, false
+	}
+	// A week of chained periods is as far as a blackout can reach
+	for i := 0; i < 7*len(s); i++ {
+		next, ok := s.periodEnd(end)
+		if !ok {
+			break
+		}
+		end = next
+	}
+	return end, true
+}
+
+// Contains reports whether t falls into one of the periods
+func (s Schedule) Contains(t time.Time) bool {
+	_, ok := s.periodEnd(t)
+	return ok
+}
+
+// Next returns the earliest start of a period after t, false for an empty
+// schedule
+func (s Schedule) Next(t time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+	for _, p := range s {
+		// Every period starts at least once a week
+		for i := 0; i <= 7; i++ {
+			day := t.AddDate(0, 0, i)
+			if !p.Days[day.Weekday()] {
+				continue
+			}
+			y, m, d := day.Date()
+			start := time.Date(y, m, d, 0, p.Start, 0, 0, t.Location())
+			if start.After(t) {
+				if !found || start.Before(next) {
+					next = start
+					found = true
+				}
+				break
+			}
+		}
+	}
+	return next, found
+}
+
+// periodEnd returns the latest end of the periods containing t
+func (s Schedule) periodEnd(t time.Time) (time.Time, bool) {
+	var end time.Time
+	found := false
+	for _, p := range s {
+		// A period containing t started today or, past midnight, yesterday
+		for _, day := range []time.Time{t.AddDate(0, 0, -1), t} {
+			if !p.Days[day.Weekday()] {
+				continue
+			}
+			y, m, d := day.Date()
+			start := time.Date(y, m, d, 0, p.Start, 0, 0, t.Location())
+			stop := time.Date(y, m, d, 0, p.End, 0, 0, t.Location())
+			if p.End < p.Start {
+				stop = stop.AddDate(0, 0, 1)
+			}
+			if !t.Before(start) && t.Before(stop) && stop.After(end) {
+				end = stop
+				found = true
+			}
+		}
+	}
+	return end, found
+}
@@ -0,0 +1,104 @@
+package blackout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	schedule, err := Parse("Mon-Fri 08:00-18:00, Sat 22:00-02:00,12:00-12:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedule) != 3 {
+		t.Fatalf("Parse() = %d periods, want 3", len(schedule))
+	}
+	if !schedule[0].Days[time.Monday] || !schedule[0].Days[time.Friday] || schedule[0].Days[time.Saturday] {
+		t.Errorf("Mon-Fri days = %v", schedule[0].Days)
+	}
+	if schedule[1].Start != 22*60 || schedule[1].End != 2*60 {
+		t.Errorf("Sat period = %+v, want 22:00-02:00", schedule[1])
+	}
+
+	if wrapped, _ := Parse("Fri-Mon 00:00-24:00"); !wrapped[0].Days[time.Sunday] || wrapped[0].Days[time.Wednesday] {
+		t.Errorf("Fri-Mon days = %v", wrapped[0].Days)
+	}
+	if empty, err := Parse(""); err != nil || len(empty) != 0 {
+		t.Errorf("Parse(\"\") = %v, %v, want no periods", empty, err)
+	}
+	for _, invalid := range []string{"Mon-Fri", "Mo 08:00-18:00", "08:00", "25:00-26:00", "08:00-08:00", "Mon Tue 08:00-09:00"} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("Parse(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestEnd(t *testing.T) {
+	schedule, err := Parse("Mon-Fri 08:00-18:00,Fri 17:00-23:00,Sat 22:00-02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 3, day, hour, minute, 0, 0, time.UTC) // March 3rd is a Monday
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		end  time.Time
+		ok   bool
+	}{
+		{"before business hours", at(3, 7, 59), time.Time{}, false},
+		{"business hours", at(3, 9, 0), at(3, 18, 0), true},
+		{"end is exclusive", at(3, 18, 0), time.Time{}, false},
+		{"overlapping periods", at(7, 9, 0), at(7, 23, 0), true},
+		{"past midnight", at(9, 1, 0), at(9, 2, 0), true},
+		{"weekend", at(9, 12, 0), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		end, ok := schedule.End(tt.t)
+		if ok != tt.ok || !end.Equal(tt.end) {
+			t.Errorf("%s: End(%v) = %v, %v, want %v, %v", tt.name, tt.t, end, ok, tt.end, tt.ok)
+		}
+	}
+
+	if _, ok := Schedule(nil).End(at(3, 9, 0)); ok {
+		t.Error("an empty schedule should never be in blackout")
+	}
+}
+
+func TestNext(t *testing.T) {
+	window, err := Parse("22:00-06:00,Sat 10:00-12:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 3, day, hour, minute, 0, 0, time.UTC) // March 3rd is a Monday
+	}
+
+	tests := []struct {
+		name     string
+		t        time.Time
+		next     time.Time
+		contains bool
+	}{
+		{"during the day", at(3, 12, 0), at(3, 22, 0), false},
+		{"inside the window", at(3, 23, 0), at(4, 22, 0), true},
+		{"past midnight", at(4, 5, 59), at(4, 22, 0), true},
+		{"window closed", at(4, 6, 0), at(4, 22, 0), false},
+		{"earlier period", at(8, 9, 0), at(8, 10, 0), false},
+	}
+	for _, tt := range tests {
+		next, ok := window.Next(tt.t)
+		if !ok || !next.Equal(tt.next) {
+			t.Errorf("%s: Next(%v) = %v, %v, want %v", tt.name, tt.t, next, ok, tt.next)
+		}
+		if got := window.Contains(tt.t); got != tt.contains {
+			t.Errorf("%s: Contains(%v) = %v, want %v", tt.name, tt.t, got, tt.contains)
+		}
+	}
+
+	if _, ok := Schedule(nil).Next(at(3, 9, 0)); ok {
+		t.Error("an empty schedule has no next period")
+	}
+}
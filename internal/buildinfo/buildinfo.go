@@ -0,0 +1,134 @@
+package buildinfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Version is the server version, overridden at build time with
+// -ldflags "-X github.com/patent-dev/bulk-file-loader/internal/buildinfo.Version=..."
+var Version = "0.1.0"
+
+// UIManifest is the file written by the UI build next to index.html
+const UIManifest = "build-info.json"
+
+// Info describes the running server and the embedded web UI
+type Info struct {
+	Version    string `json:"version"`
+	APIVersion string `json:"apiVersion"`
+	GoVersion  string `json:"goVersion"`
+	// UIVersion and UIAPIVersion come from the UI build manifest and are
+	// empty if the embedded assets have none
+	UIVersion    string `json:"uiVersion"`
+	UIAPIVersion string `json:"uiApiVersion"`
+	// UIHash is a SHA-256 over the paths and contents of all embedded assets
+	UIHash string `json:"uiHash"`
+}
+
+type uiManifest struct {
+	Version    string `json:"version"`
+	APIVersion string `json:"apiVersion"`
+}
+
+// Load collects build information, reading the UI manifest from and hashing
+// the embedded web assets
+func Load(assets fs.FS, apiVersion string) (Info, error) {
+	info := Info{
+		Version:    Version,
+		APIVersion: apiVersion,
+		GoVersion:  runtime.Version(),
+	}
+
+	if data, err := fs.ReadFile(assets, UIManifest); err == nil {
+		var m uiManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return info, fmt.Errorf("parse %s: %w", UIManifest, err)
+		}
+		info.UIVersion = m.Version
+		info.UIAPIVersion = m.APIVersion
+	}
+
+	hash, err := hashAssets(assets)
+	if err != nil {
+		return info, fmt.Errorf("hash web assets: %w", err)
+	}
+	info.UIHash = hash
+
+	return info, nil
+}
+
+// Skew returns a description of every mismatch between the server and the
+// embedded UI, or nil if they belong together
+func (i Info) Skew() []string {
+	if i.UIVersion == "" && i.UIAPIVersion == "" {
+		return []string{"embedded UI has no " + UIManifest}
+	}
+
+	var problems []string
+	if i.UIAPIVersion != i.APIVersion {
+		problems = append(problems, fmt.Sprintf("UI was built for API %s, server provides API %s", i.UIAPIVersion, i.APIVersion))
+	}
+	if i.UIVersion != i.Version {
+		problems = append(problems, fmt.Sprintf("UI version %s does not match server version %s", i.UIVersion, i.Version))
+	}
+	return problems
+}
+
+// OpenMetrics renders the build information in the OpenMetrics text format
+func (i Info) OpenMetrics() string {
+	skew := 0
+	if len(i.Skew()) > 0 {
+		skew = 1
+	}
+
+	var b strings.Builder
+	b.WriteString("# TYPE bulk_loader_build_info gauge\n")
+	b.WriteString("# HELP bulk_loader_build_info Server and embedded UI build information.\n")
+	fmt.Fprintf(&b, "bulk_loader_build_info{version=%q,api_version=%q,go_version=%q,ui_version=%q,ui_api_version=%q,ui_hash=%q} 1\n",
+		i.Version, i.APIVersion, i.GoVersion, i.UIVersion, i.UIAPIVersion, i.UIHash)
+	b.WriteString("# TYPE bulk_loader_ui_skew gauge\n")
+	b.WriteString("# HELP bulk_loader_ui_skew Whether the embedded UI does not match the server build.\n")
+	fmt.Fprintf(&b, "bulk_loader_ui_skew %d\n", skew)
+	b.WriteString("# EOF\n")
+	return b.String()
+}
+
+func hashAssets(assets fs.FS) (string, error) {
+	var paths []string
+	err := fs.WalkDir(assets, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, path := range paths {
+		f, err := assets.Open(path)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, path)
+		h.Write([]byte{0})
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
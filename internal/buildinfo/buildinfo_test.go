@@ -0,0 +1,73 @@
+package buildinfo
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	assets := fstest.MapFS{
+		"index.html":    {Data: []byte("<html></html>")},
+		"assets/app.js": {Data: []byte("console.log(1)")},
+		UIManifest:      {Data: []byte(`{"version":"` + Version + `","apiVersion":"1.0.0"}`)},
+	}
+
+	info, err := Load(assets, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UIVersion != Version || info.UIAPIVersion != "1.0.0" {
+		t.Errorf("UI version = %q/%q, want %q/1.0.0", info.UIVersion, info.UIAPIVersion, Version)
+	}
+	if len(info.UIHash) != 64 {
+		t.Errorf("UIHash = %q, want hex SHA-256", info.UIHash)
+	}
+	if skew := info.Skew(); skew != nil {
+		t.Errorf("Skew() = %v, want none", skew)
+	}
+
+	assets["assets/app.js"] = &fstest.MapFile{Data: []byte("console.log(2)")}
+	changed, err := Load(assets, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.UIHash == info.UIHash {
+		t.Error("UIHash should change when an asset changes")
+	}
+}
+
+func TestSkew(t *testing.T) {
+	tests := []struct {
+		name string
+		info Info
+		want int
+	}{
+		{"matching", Info{Version: "1.2.0", APIVersion: "1.0.0", UIVersion: "1.2.0", UIAPIVersion: "1.0.0"}, 0},
+		{"no manifest", Info{Version: "1.2.0", APIVersion: "1.0.0"}, 1},
+		{"api mismatch", Info{Version: "1.2.0", APIVersion: "2.0.0", UIVersion: "1.2.0", UIAPIVersion: "1.0.0"}, 1},
+		{"both mismatch", Info{Version: "1.3.0", APIVersion: "2.0.0", UIVersion: "1.2.0", UIAPIVersion: "1.0.0"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.Skew(); len(got) != tt.want {
+				t.Errorf("Skew() = %v, want %d problems", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenMetrics(t *testing.T) {
+	info := Info{Version: "1.2.0", APIVersion: "1.0.0", GoVersion: "go1.25", UIVersion: "1.2.0", UIAPIVersion: "1.0.0", UIHash: "abc"}
+	out := info.OpenMetrics()
+
+	if !strings.Contains(out, `bulk_loader_build_info{version="1.2.0",api_version="1.0.0",go_version="go1.25",ui_version="1.2.0",ui_api_version="1.0.0",ui_hash="abc"} 1`) {
+		t.Errorf("OpenMetrics() missing build_info sample:\n%s", out)
+	}
+	if !strings.Contains(out, "bulk_loader_ui_skew 0\n") {
+		t.Errorf("OpenMetrics() missing skew sample:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Error("OpenMetrics() must end with # EOF")
+	}
+}
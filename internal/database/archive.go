@@ -0,0 +1,91 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ArchiveDeliveries flags deliveries published before the given time, or
+// created before it if their publication time is unknown, together with their
+// files as archived. Archived records stay in place, so syncs don't add them
+// again, but are left out of listings, counts and automatic downloads. It
+// returns the number of files archived.
+func (db *DB) ArchiveDeliveries(before time.Time) (int64, error) {
+	var archived int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		old := tx.Model(&Delivery{}).Select("id").
+			Where("archived_at IS NULL AND COALESCE(published_at, created_at) < ?", before)
+		result := tx.Model(&File{}).Where("archived_at IS NULL AND delivery_id IN (?)", old).
+			Update("archived_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		archived = result.RowsAffected
+		return tx.Model(&Delivery{}).Where("archived_at IS NULL AND COALESCE(published_at, created_at) < ?", before).
+			Update("archived_at", now).Error
+	})
+	return archived, err
+}
+
+// ExpireDeliveries flags the files of deliveries that expired before the given
+// time as expired if they were never downloaded, and also archives them if
+// archive is set. Skipped files are left alone. It returns the number of files
+// flagged.
+func (db *DB) ExpireDeliveries(now time.Time, archive bool) (int64, error) {
+	var fileIDs []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Model(&Delivery{}).Select("id").
+			Where("expires_at IS NOT NULL AND expires_at <= ?", now)
+		err := tx.Model(&File{}).
+			Where("expired = ? AND skipped = ? AND archived_at IS NULL AND status IN ? AND delivery_id IN (?)", false, false,
+				[]string{FileStatusAvailable, FileStatusFailed, FileStatusInvalid, FileStatusCancelled}, expired).
+			Pluck("id", &fileIDs).Error
+		if err != nil || len(fileIDs) == 0 {
+			return err
+		}
+		updates := map[string]interface{}{"expired": true}
+		if archive {
+			updates["archived_at"] = now
+		}
+		if err := tx.Model(&File{}).Where("id IN ?", fileIDs).Updates(updates).Error; err != nil {
+			return err
+		}
+		return updateFileStatus(tx, fileIDs)
+	})
+	return int64(len(fileIDs)), err
+}
+
+// SkipOlderDeliveries marks the files of the product's deliveries other than
+// the newest one as skipped, for products tracking only their latest
+// delivery. Files downloaded or being downloaded are left alone. It returns
+// the number of files skipped.
+func (db *DB) SkipOlderDeliveries(productID string) (int64, error) {
+	var latest Delivery
+	err := db.Where("product_id = ? AND archived_at IS NULL", productID).
+		Order("COALESCE(published_at, created_at) DESC, created_at DESC").First(&latest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var fileIDs []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&File{}).
+			Where("product_id = ? AND delivery_id <> ? AND skipped = ? AND archived_at IS NULL AND status NOT IN ?", productID, latest.ID, false,
+				[]string{FileStatusDownloaded, FileStatusDownloading}).
+			Pluck("id", &fileIDs).Error
+		if err != nil || len(fileIDs) == 0 {
+			return err
+		}
+		if err := tx.Model(&File{}).Where("id IN ?", fileIDs).Update("skipped", true).Error; err != nil {
+			return err
+		}
+		return updateFileStatus(tx, fileIDs)
+	})
+	return int64(len(fileIDs)), err
+}
@@ -0,0 +1,265 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Backup scopes
+const (
+	// BackupFull covers every table
+	BackupFull = "full"
+	// BackupConfig covers sources, settings, API keys, webhooks and
+	// notifiers, but not the catalog, download history or logs
+	BackupConfig = "config"
+)
+
+// backupFormat is the version of the backup layout
+const backupFormat = 1
+
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// Backup is a portable copy of the database. Rows are kept as JSON by table,
+// so a backup of a SQLite database restores into PostgreSQL or MySQL.
+// Credentials stay encrypted; restoring them requires the same passphrase.
+type Backup struct {
+	Format    int                        `json:"format"`
+	Scope     string                     `json:"scope"`
+	CreatedAt time.Time                  `json:"createdAt"`
+	Tables    map[string]json.RawMessage `json:"tables"`
+}
+
+type backupTable struct {
+	name   string
+	model  any
+	config bool
+}
+
+// backupTables lists the tables in the order they are restored
+var backupTables = []backupTable{
+	{"sources", &Source{}, true},
+	{"settings", &Setting{}, true},
+	{"api_keys", &APIKey{}, true},
+	{"webhooks", &Webhook{}, true},
+	{"slack_notifiers", &SlackNotifier{}, true},
+	{"email_notifiers", &EmailNotifier{}, true},
+	{"chat_notifiers", &ChatNotifier{}, true},
+	{"nats_publishers", &NatsPublisher{}, true},
+	{"products", &Product{}, false},
+	{"deliveries", &Delivery{}, false},
+	{"files", &File{}, false},
+	{"file_tags", &FileTag{}, false},
+	{"file_metadata", &FileMetadata{}, false},
+	{"download_entries", &DownloadEntry{}, false},
+	{"quarantined_files", &QuarantinedFile{}, false},
+	{"catalog_snapshots", &CatalogSnapshot{}, false},
+	{"sync_runs", &SyncRun{}, false},
+	{"webhook_dead_letters", &WebhookDeadLetter{}, false},
+	{"events", &Event{}, false},
+	{"audit_entries", &AuditEntry{}, false},
+}
+
+// in reports whether the table belongs to a backup of the scope
+func (t backupTable) in(scope string) bool {
+	return scope == BackupFull || t.config
+}
+
+// CreateBackup returns a backup of the scope, held in memory
+func (db *DB) CreateBackup(scope string) (*Backup, error) {
+	var buf bytes.Buffer
+	if err := db.WriteBackup(&buf, scope, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	backup := &Backup{}
+	if err := json.Unmarshal(buf.Bytes(), backup); err != nil {
+		return nil, fmt.Errorf("create backup: %w", err)
+	}
+	return backup, nil
+}
+
+// WriteBackup writes a backup of the scope to w as JSON. The tables are read
+// in a single transaction so the copy is consistent, and rows are written as
+// they are read, so large catalogs aren't held in memory. Soft-deleted records
+// are included; local settings such as the telemetry instance ID are left out.
+func (db *DB) WriteBackup(w io.Writer, scope string, createdAt time.Time) error {
+	if !ValidBackupScope(scope) {
+		return fmt.Errorf("unknown backup scope %q, want full or config", scope)
+	}
+	created, _ := json.Marshal(createdAt)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := fmt.Fprintf(w, `{"format":%d,"scope":%q,"createdAt":%s,"tables":{`, backupFormat, scope, created); err != nil {
+			return err
+		}
+		first := true
+		for _, table := range backupTables {
+			if !table.in(scope) {
+				continue
+			}
+			if !first {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+			if err := writeTable(tx, w, table); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "}}\n")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("create backup: %w", err)
+	}
+	return nil
+}
+
+// writeTable writes a table's rows as a JSON array, one row at a time
+func writeTable(tx *gorm.DB, w io.Writer, table backupTable) error {
+	query := tx.Unscoped().Model(table.model).Omit(clause.Associations)
+	if table.name == "settings" {
+		query = query.Where("key NOT IN ?", localSettings)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if _, err := fmt.Fprintf(w, "%q:[", table.name); err != nil {
+		return err
+	}
+	rowType := reflect.TypeOf(table.model).Elem()
+	for i := 0; rows.Next(); i++ {
+		row := reflect.New(rowType).Interface()
+		if err := tx.ScanRows(rows, row); err != nil {
+			return err
+		}
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			data = append([]byte(","), data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "]")
+	return err
+}
+
+// ValidBackupScope reports whether scope is a known backup scope
+func ValidBackupScope(scope string) bool {
+	return scope == BackupFull || scope == BackupConfig
+}
+
+// RestoreBackup replaces the tables of the backup's scope with its rows and
+// returns how many rows were restored. Tables outside the scope are kept.
+func (db *DB) RestoreBackup(backup *Backup) (int, error) {
+	if backup.Format != backupFormat {
+		return 0, fmt.Errorf("%w: unsupported format %d", ErrInvalidBackup, backup.Format)
+	}
+	if !ValidBackupScope(backup.Scope) {
+		return 0, fmt.Errorf("%w: unknown scope %q", ErrInvalidBackup, backup.Scope)
+	}
+
+	// Decode everything before touching the database
+	decoded := make([]reflect.Value, len(backupTables))
+	for i, table := range backupTables {
+		if !table.in(backup.Scope) {
+			continue
+		}
+		rows := reflect.New(reflect.SliceOf(reflect.TypeOf(table.model).Elem()))
+		if data, ok := backup.Tables[table.name]; ok {
+			if err := json.Unmarshal(data, rows.Interface()); err != nil {
+				return 0, fmt.Errorf("%w: table %s: %v", ErrInvalidBackup, table.name, err)
+			}
+		}
+		decoded[i] = rows.Elem()
+	}
+
+	restored := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		all := tx.Unscoped().Session(&gorm.Session{AllowGlobalUpdate: true})
+		for i := len(backupTables) - 1; i >= 0; i-- {
+			table := backupTables[i]
+			if !table.in(backup.Scope) {
+				continue
+			}
+			query := all
+			if table.name == "settings" {
+				query = tx.Where("key NOT IN ?", localSettings)
+			}
+			if err := query.Delete(table.model).Error; err != nil {
+				return err
+			}
+		}
+
+		for i, table := range backupTables {
+			rows := decoded[i]
+			if rows.IsValid() && table.name == "settings" {
+				rows = withoutLocalSettings(rows.Interface().([]Setting))
+			}
+			if !rows.IsValid() || rows.Len() == 0 {
+				continue
+			}
+			disabled := disabledIDs(rows)
+			if err := tx.Omit(clause.Associations).CreateInBatches(rows.Interface(), 500).Error; err != nil {
+				return fmt.Errorf("restore %s: %w", table.name, err)
+			}
+			if len(disabled) > 0 {
+				if err := tx.Model(table.model).Where("id IN ?", disabled).Update("enabled", false).Error; err != nil {
+					return err
+				}
+			}
+			restored += rows.Len()
+		}
+		var serial []string
+		for _, table := range backupTables {
+			id, ok := reflect.TypeOf(table.model).Elem().FieldByName("ID")
+			if ok && table.in(backup.Scope) && id.Type.Kind() == reflect.Uint {
+				serial = append(serial, table.name)
+			}
+		}
+		return resetSequences(tx, serial)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("restore backup: %w", err)
+	}
+	return restored, nil
+}
+
+func withoutLocalSettings(settings []Setting) reflect.Value {
+	settings = slices.DeleteFunc(slices.Clone(settings), func(s Setting) bool {
+		return isLocalSetting(s.Key)
+	})
+	return reflect.ValueOf(settings)
+}
+
+// disabledIDs returns the IDs of the rows whose Enabled is false, which GORM
+// replaces with the column default on insert, also in the inserted rows
+func disabledIDs(rows reflect.Value) []any {
+	var ids []any
+	for i := range rows.Len() {
+		row := rows.Index(i)
+		enabled := row.FieldByName("Enabled")
+		if enabled.IsValid() && !enabled.Bool() {
+			ids = append(ids, row.FieldByName("ID").Interface())
+		}
+	}
+	return ids
+}
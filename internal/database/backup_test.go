@@ -0,0 +1,80 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	old := setupTestDB(t)
+	old.Create(&Source{ID: "epo", Name: "EPO", Enabled: true, CredentialsEnc: []byte("secret")})
+	old.Create(&Product{ID: "p1", SourceID: "epo"})
+	old.Create(&File{ID: "f1", ProductID: "p1", SourceID: "epo", FileName: "a.zip"})
+	old.Create(&SlackNotifier{Name: "ops", Events: `["*"]`})
+	old.Model(&SlackNotifier{}).Where("name = ?", "ops").Update("enabled", false)
+	old.Create(&APIKey{Name: "ci", Prefix: "bfl_abc", Hash: "h"})
+	old.SetSetting(SettingEncryptionSalt, "salt")
+	old.SetSetting(SettingTelemetryID, "old-id")
+
+	backup, err := old.CreateBackup(BackupFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The archive is sent as JSON
+	data, _ := json.Marshal(backup)
+	backup = &Backup{}
+	if err := json.Unmarshal(data, backup); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := setupTestDB(t)
+	restored.Create(&Source{ID: "stale"})
+	restored.SetSetting(SettingTelemetryID, "new-id")
+	if _, err := restored.RestoreBackup(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	var sources []Source
+	restored.Find(&sources)
+	if len(sources) != 1 || sources[0].ID != "epo" || string(sources[0].CredentialsEnc) != "secret" {
+		t.Errorf("sources after restore = %+v, want only epo with credentials", sources)
+	}
+	var notifier SlackNotifier
+	restored.First(&notifier)
+	if notifier.Name != "ops" || notifier.Enabled {
+		t.Errorf("notifier = %+v, want the disabled ops notifier", notifier)
+	}
+	var file File
+	if err := restored.First(&file, "id = ?", "f1").Error; err != nil {
+		t.Errorf("file f1 not restored: %v", err)
+	}
+	if id, _ := restored.GetSetting(SettingTelemetryID); id != "new-id" {
+		t.Errorf("telemetry ID = %q, want the instance's own", id)
+	}
+	if salt, _ := restored.GetSetting(SettingEncryptionSalt); salt != "salt" {
+		t.Errorf("encryption salt = %q, want salt", salt)
+	}
+
+	// A configuration backup leaves the catalog alone
+	config, err := old.CreateBackup(BackupConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.Tables["files"]; ok {
+		t.Error("configuration backup should not contain files")
+	}
+	restored.Create(&File{ID: "f2", FileName: "b.zip"})
+	if _, err := restored.RestoreBackup(config); err != nil {
+		t.Fatal(err)
+	}
+	var files int64
+	restored.Model(&File{}).Count(&files)
+	if files != 2 {
+		t.Errorf("files after configuration restore = %d, want 2", files)
+	}
+
+	if _, err := restored.RestoreBackup(&Backup{Format: 99, Scope: BackupFull}); !errors.Is(err, ErrInvalidBackup) {
+		t.Errorf("unknown format err = %v, want ErrInvalidBackup", err)
+	}
+}
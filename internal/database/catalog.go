@@ -0,0 +1,58 @@
+package database
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// SnapshotDateFormat is the layout of CatalogSnapshot.SnapshotDate
+const SnapshotDateFormat = "2006-01-02"
+
+// SaveCatalogSnapshot stores the files a product's catalog lists at the given
+// time, replacing an earlier snapshot of the same day
+func (db *DB) SaveCatalogSnapshot(productID, sourceID string, fileIDs []string, totalSize int64, at time.Time) error {
+	ids := append([]string(nil), fileIDs...)
+	sort.Strings(ids)
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	snapshot := &CatalogSnapshot{
+		ProductID:    productID,
+		SourceID:     sourceID,
+		SnapshotDate: at.UTC().Format(SnapshotDateFormat),
+		FileCount:    len(ids),
+		TotalSize:    totalSize,
+		FileIDs:      string(data),
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "snapshot_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"source_id", "file_count", "total_size", "file_ids", "updated_at"}),
+	}).Create(snapshot).Error
+}
+
+// CatalogSnapshotAt returns the latest snapshot of a product taken on or
+// before the given day, or nil if there is none
+func (db *DB) CatalogSnapshotAt(productID string, day time.Time) (*CatalogSnapshot, error) {
+	var snapshot CatalogSnapshot
+	result := db.Where("product_id = ? AND snapshot_date <= ?", productID, day.UTC().Format(SnapshotDateFormat)).
+		Order("snapshot_date DESC").Limit(1).Find(&snapshot)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &snapshot, nil
+}
+
+// Files returns the IDs of the files in the snapshot
+func (s *CatalogSnapshot) Files() []string {
+	var ids []string
+	json.Unmarshal([]byte(s.FileIDs), &ids)
+	return ids
+}
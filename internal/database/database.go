@@ -16,7 +16,30 @@ type DB struct {
 	*gorm.DB
 }
 
+// New connects to the database, brings its schema up to date and fails
+// downloads interrupted by a restart
 func New(cfg *config.Config) (*DB, error) {
+	d, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runMigrations(d.DB); err != nil {
+		return nil, fmt.Errorf("run migrations: %w", err)
+	}
+
+	if count := d.FailInterruptedDownloads("interrupted by restart"); count > 0 {
+		slog.Info("Cleaned up stale downloads", "count", count)
+	}
+
+	slog.Info("Database connected", "driver", cfg.DBDriver)
+
+	return d, nil
+}
+
+// Open connects to the database without changing it, for commands that
+// inspect or roll back its schema
+func Open(cfg *config.Config) (*DB, error) {
 	var dialector gorm.Dialector
 
 	switch cfg.DBDriver {
@@ -47,36 +70,50 @@ func New(cfg *config.Config) (*DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
-
-	if err := runMigrations(db); err != nil {
-		return nil, fmt.Errorf("run migrations: %w", err)
-	}
-
-	result := db.Model(&DownloadEntry{}).
-		Where("status = ?", DownloadStatusDownloading).
-		Updates(map[string]interface{}{
-			"status":        DownloadStatusFailed,
-			"error_message": "interrupted by restart",
-		})
-	if result.RowsAffected > 0 {
-		slog.Info("Cleaned up stale downloads", "count", result.RowsAffected)
-	}
-
-	slog.Info("Database connected", "driver", cfg.DBDriver)
-
 	return &DB{DB: db}, nil
 }
 
+// models are the tables AutoMigrate creates and extends
+var models = []any{
+	&Source{},
+	&Product{},
+	&Delivery{},
+	&File{},
+	&FileTag{},
+	&FileMetadata{},
+	&DownloadEntry{},
+	&QuarantinedFile{},
+	&Webhook{},
+	&Setting{},
+	&CatalogSnapshot{},
+	&SyncRun{},
+	&WebhookDeadLetter{},
+	&SlackNotifier{},
+	&EmailNotifier{},
+	&ChatNotifier{},
+	&Event{},
+	&NatsPublisher{},
+	&APIKey{},
+	&AuditEntry{},
+}
+
+// runMigrations brings the schema up to date. On an existing database the
+// versioned migrations run first, against the schema they were written for,
+// so a rename moves a column before AutoMigrate would add it empty; then
+// AutoMigrate adds the tables and columns of the current models. A new
+// database gets the current schema right away, see initSchema.
 func runMigrations(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&Source{},
-		&Product{},
-		&Delivery{},
-		&File{},
-		&DownloadEntry{},
-		&Webhook{},
-		&Setting{},
-	)
+	return migrate(db, migrations)
+}
+
+func migrate(db *gorm.DB, list []Migration) error {
+	if !db.Migrator().HasTable(&Source{}) {
+		return initSchema(db, list)
+	}
+	if err := applyMigrations(db, list); err != nil {
+		return err
+	}
+	return db.AutoMigrate(models...)
 }
 
 func (db *DB) GetSetting(key string) (string, error) {
@@ -1,7 +1,12 @@
 package database
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -188,6 +193,337 @@ func TestFileWithDownloadEntries(t *testing.T) {
 	}
 }
 
+func TestUpdateFileStatus(t *testing.T) {
+	db := setupTestDB(t)
+	db.Create(&File{ID: "f1"})
+	db.Create(&File{ID: "f2", Skipped: true})
+	old := time.Now().AddDate(0, 0, -60)
+	db.Create(&DownloadEntry{FileID: "f1", Status: DownloadStatusFailed, ErrorMessage: "timeout", CreatedAt: old})
+	if err := db.UpdateFileStatus("f1", "f2", "missing"); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := func() map[string]string {
+		var files []File
+		db.Order("id").Find(&files)
+		got := make(map[string]string)
+		for _, f := range files {
+			got[f.ID] = f.Status + ":" + f.ErrorMessage
+		}
+		return got
+	}
+	if got := statuses(); got["f1"] != "failed:timeout" || got["f2"] != "skipped:" {
+		t.Errorf("statuses = %v, want f1 failed and f2 skipped", got)
+	}
+
+	// Pruning the latest entry makes the file available again
+	if _, err := db.PruneDownloadEntries(time.Now().AddDate(0, 0, -30)); err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(); got["f1"] != "available:" {
+		t.Errorf("status after pruning = %q, want available", got["f1"])
+	}
+}
+
+func TestProductFileCounts(t *testing.T) {
+	db := setupTestDB(t)
+	for _, id := range []string{"f1", "f2", "f3", "f4"} {
+		db.Create(&File{ID: id, ProductID: "p1"})
+	}
+	db.Create(&File{ID: "g1", ProductID: "p2"})
+	db.Create(&DownloadEntry{FileID: "f1", Status: DownloadStatusCompleted})
+	db.Create(&DownloadEntry{FileID: "f1", Status: DownloadStatusCompleted})
+	// Downloaded once, then a retry failed
+	db.Create(&DownloadEntry{FileID: "f2", Status: DownloadStatusCompleted})
+	db.Create(&DownloadEntry{FileID: "f2", Status: DownloadStatusFailed})
+	// A failure followed by a success doesn't count as failed
+	db.Create(&DownloadEntry{FileID: "f3", Status: DownloadStatusFailed})
+	db.Create(&DownloadEntry{FileID: "f3", Status: DownloadStatusCompleted})
+	db.DeleteFile("f4")
+
+	counts, err := db.ProductFileCounts([]string{"p1", "p3"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FileCounts{ProductID: "p1", Total: 3, Downloaded: 3, Failed: 1}
+	if counts["p1"] != want || len(counts) != 1 {
+		t.Errorf("ProductFileCounts = %+v, want %+v only", counts, want)
+	}
+	if counts, _ := db.ProductFileCounts([]string{"p1"}, true); counts["p1"].Total != 4 {
+		t.Errorf("ProductFileCounts with deleted = %+v, want 4 files", counts["p1"])
+	}
+}
+
+func TestArchiveDeliveries(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Now()
+	old := now.AddDate(-1, 0, 0)
+	db.Create(&Delivery{ID: "d1", ProductID: "p1", PublishedAt: &old})
+	db.Create(&Delivery{ID: "d2", ProductID: "p1", PublishedAt: &now})
+	// Without a publication time the creation time counts
+	db.Create(&Delivery{ID: "d3", ProductID: "p1", CreatedAt: old})
+	for _, f := range []File{{ID: "f1", DeliveryID: "d1"}, {ID: "f2", DeliveryID: "d1"}, {ID: "f3", DeliveryID: "d2"}, {ID: "f4", DeliveryID: "d3"}} {
+		db.Create(&f)
+	}
+
+	archived, err := db.ArchiveDeliveries(now.AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archived != 3 {
+		t.Errorf("ArchiveDeliveries() = %d, want 3", archived)
+	}
+	var deliveries []Delivery
+	db.Where("archived_at IS NOT NULL").Order("id").Find(&deliveries)
+	if len(deliveries) != 2 || deliveries[0].ID != "d1" || deliveries[1].ID != "d3" {
+		t.Errorf("archived deliveries = %+v, want d1 and d3", deliveries)
+	}
+
+	if archived, _ := db.ArchiveDeliveries(now.AddDate(0, 0, -30)); archived != 0 {
+		t.Errorf("ArchiveDeliveries() again = %d, want 0", archived)
+	}
+}
+
+func TestExpireDeliveries(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Now()
+	past := now.AddDate(0, 0, -1)
+	future := now.AddDate(0, 0, 1)
+	db.Create(&Delivery{ID: "d1", ProductID: "p1", ExpiresAt: &past})
+	db.Create(&Delivery{ID: "d2", ProductID: "p1", ExpiresAt: &future})
+	db.Create(&File{ID: "f1", DeliveryID: "d1"})
+	db.Create(&File{ID: "f2", DeliveryID: "d1", Status: FileStatusDownloaded})
+	db.Create(&File{ID: "f3", DeliveryID: "d1", Skipped: true, Status: FileStatusSkipped})
+	db.Create(&File{ID: "f4", DeliveryID: "d1", Status: FileStatusFailed})
+	db.Create(&File{ID: "f5", DeliveryID: "d2"})
+	db.Create(&DownloadEntry{FileID: "f4", Status: DownloadStatusFailed, ErrorMessage: "gone"})
+
+	expired, err := db.ExpireDeliveries(now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 2 {
+		t.Errorf("ExpireDeliveries() = %d, want 2", expired)
+	}
+	var files []File
+	db.Where("status = ?", FileStatusExpired).Order("id").Find(&files)
+	if len(files) != 2 || files[0].ID != "f1" || files[1].ID != "f4" || files[1].ErrorMessage != "" || files[0].ArchivedAt != nil {
+		t.Errorf("expired files = %+v, want f1 and f4, not archived", files)
+	}
+
+	// Later download entries don't make the file available again
+	db.Create(&DownloadEntry{FileID: "f1", Status: DownloadStatusFailed})
+	db.UpdateFileStatus("f1")
+	var file File
+	db.First(&file, "id = ?", "f1")
+	if file.Status != FileStatusExpired {
+		t.Errorf("status after failed retry = %q, want expired", file.Status)
+	}
+
+	// With archiving the files of later expiring deliveries are archived too
+	if expired, _ := db.ExpireDeliveries(now.AddDate(0, 0, 2), true); expired != 1 {
+		t.Errorf("ExpireDeliveries() with archive = %d, want 1", expired)
+	}
+	var archived File
+	db.First(&archived, "id = ?", "f5")
+	if !archived.Expired || archived.ArchivedAt == nil {
+		t.Errorf("f5 = expired %v, archived at %v; want expired and archived", archived.Expired, archived.ArchivedAt)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	db := setupTestDB(t)
+	root := t.TempDir()
+	dir := filepath.Join(root, "s1", "p1")
+	os.MkdirAll(dir, 0755)
+	completed := time.Now().Add(-time.Hour)
+	store := func(fileID, name, content string) {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0644)
+		os.Chtimes(path, completed, completed)
+		db.Create(&File{ID: fileID, SourceID: "s1", ProductID: "p1", FileName: name})
+		db.Create(&DownloadEntry{FileID: fileID, Status: DownloadStatusCompleted, LocalPath: path,
+			Progress: int64(len(content)), CompletedAt: &completed})
+	}
+	store("f1", "ok.zip", "data")
+	store("f2", "gone.zip", "data")
+	store("f3", "changed.zip", "data")
+	os.Remove(filepath.Join(dir, "gone.zip"))
+	os.WriteFile(filepath.Join(dir, "changed.zip"), []byte("other data"), 0644)
+	os.WriteFile(filepath.Join(dir, "stray.zip"), nil, 0644)
+	os.Chtimes(filepath.Join(dir, "stray.zip"), completed, completed)
+	// The temp file of a running download isn't orphaned
+	db.Create(&File{ID: "f4", SourceID: "s1", ProductID: "p1", FileName: "new.zip", Status: FileStatusDownloading})
+	os.WriteFile(filepath.Join(dir, "new.zip.tmp"), nil, 0644)
+	// Nor is a download just moved into place, or the link of an active one
+	os.WriteFile(filepath.Join(dir, "done.zip"), nil, 0644)
+	db.Create(&File{ID: "f5", SourceID: "s1", ProductID: "p1", FileName: "same.zip", Status: FileStatusAvailable})
+	os.WriteFile(filepath.Join(dir, "same.zip.link"), nil, 0644)
+	os.Chtimes(filepath.Join(dir, "same.zip.link"), completed, completed)
+	db.UpdateFileStatus("f1", "f2", "f3")
+
+	report, err := db.Reconcile(root, false, time.Now(), []string{"f5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Missing) != 1 || report.Missing[0].FileID != "f2" {
+		t.Errorf("Missing = %+v, want f2", report.Missing)
+	}
+	if len(report.Modified) != 1 || report.Modified[0].FileID != "f3" {
+		t.Errorf("Modified = %+v, want f3", report.Modified)
+	}
+	if len(report.Orphaned) != 1 || report.Orphaned[0] != "s1/p1/stray.zip" {
+		t.Errorf("Orphaned = %v, want s1/p1/stray.zip", report.Orphaned)
+	}
+
+	if _, err := db.Reconcile(root, true, time.Now(), []string{"f5"}); err != nil {
+		t.Fatal(err)
+	}
+	var file File
+	db.First(&file, "id = ?", "f2")
+	if file.Status != FileStatusAvailable {
+		t.Errorf("f2 status after fix = %q, want available", file.Status)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "stray.zip")); !os.IsNotExist(err) {
+		t.Error("stray.zip not removed by fix")
+	}
+	report, _ = db.Reconcile(root, false, time.Now(), []string{"f5"})
+	if len(report.Missing) != 0 || len(report.Orphaned) != 0 {
+		t.Errorf("report after fix = %+v, want nothing missing or orphaned", report)
+	}
+
+	// A downloads directory that doesn't exist yet has nothing to report
+	if _, err := os.Stat(filepath.Join(dir, "done.zip")); err != nil {
+		t.Errorf("recent file removed by fix: %v", err)
+	}
+	report, _ = db.Reconcile(root, false, time.Now().Add(time.Hour), nil)
+	if len(report.Orphaned) != 2 {
+		t.Errorf("Orphaned later = %v, want done.zip and same.zip.link", report.Orphaned)
+	}
+
+	if _, err := db.Reconcile(filepath.Join(root, "none"), false, time.Now(), nil); err != nil {
+		t.Errorf("Reconcile() without directory: %v", err)
+	}
+}
+
+func TestImportFiles(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	write := func(rel, content string) string {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+		return path
+	}
+	// md5 of "abc"
+	db.Create(&File{ID: "f1", SourceID: "s1", ProductID: "p1", FileName: "a.zip", FileSize: 3,
+		ExpectedChecksum: "900150983cd24fb0d6963f7d28e17f72", ChecksumAlgorithm: "MD5"})
+	db.Create(&File{ID: "f2", SourceID: "s1", ProductID: "p1", FileName: "dup.zip", FileSize: 1})
+	db.Create(&File{ID: "f3", SourceID: "s1", ProductID: "p2", FileName: "dup.zip", FileSize: 1})
+	db.Create(&File{ID: "f4", SourceID: "s1", ProductID: "p1", FileName: "big.zip", FileSize: 100})
+	db.Create(&File{ID: "f5", SourceID: "s1", ProductID: "p1", FileName: "done.zip", FileSize: 3, Status: FileStatusDownloaded})
+	// A file of unknown size matches no file of its name
+	db.Create(&File{ID: "f6", SourceID: "s1", ProductID: "p1", FileName: "unsized.zip"})
+	a := write("old/a.zip", "abc")
+	dup := write("old/s1/p2/dup.zip", "x")
+	write("old/flat/dup.zip", "x")
+	big := write("old/big.zip", "abc")
+	write("old/done.zip", "abc")
+	write("old/unknown.zip", "abc")
+	unsized := write("old/unsized.zip", "abc")
+
+	report, err := db.ImportFiles(filepath.Join(dir, "old"), ImportOptions{DryRun: true}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Imported) != 2 || report.Imported[0].FileID != "f1" || report.Imported[1].FileID != "f3" ||
+		report.Imported[1].Path != dup {
+		t.Errorf("Imported = %+v, want f1 and f3 from s1/p2", report.Imported)
+	}
+	if len(report.Ambiguous) != 1 || !slices.Equal(report.Mismatched, []string{big, unsized}) ||
+		len(report.Skipped) != 1 || report.Unmatched != 1 {
+		t.Errorf("report = %+v, want 1 ambiguous, big.zip and unsized.zip mismatched, 1 skipped, 1 unmatched", report)
+	}
+	var count int64
+	db.Model(&DownloadEntry{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("dry run recorded %d download entries", count)
+	}
+
+	// A wrong checksum keeps the file from being imported
+	db.Model(&File{}).Where("id = ?", "f1").Update("expected_checksum", "md5:0000")
+	report, err = db.ImportFiles(filepath.Join(dir, "old"), ImportOptions{Verify: true}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Imported) != 1 || report.Imported[0].FileID != "f3" || len(report.Mismatched) != 3 {
+		t.Errorf("verified report = %+v, want only f3 imported and a.zip mismatched", report)
+	}
+	var file File
+	db.First(&file, "id = ?", "f3")
+	if file.Status != FileStatusDownloaded {
+		t.Errorf("f3 status = %q, want downloaded", file.Status)
+	}
+	var entry DownloadEntry
+	db.First(&entry, "file_id = ?", "f3")
+	if entry.Status != DownloadStatusCompleted || entry.LocalPath != dup || entry.LocalChecksum == "" {
+		t.Errorf("f3 entry = %+v, want completed at %s with checksum", entry, dup)
+	}
+
+	report, _ = db.ImportFiles(filepath.Join(dir, "old"), ImportOptions{}, time.Now())
+	if len(report.Imported) != 1 || report.Imported[0].Path != a {
+		t.Errorf("third import = %+v, want only a.zip", report.Imported)
+	}
+
+	if _, err := db.ImportFiles(filepath.Join(dir, "none"), ImportOptions{}, time.Now()); !errors.Is(err, ErrImportPath) {
+		t.Errorf("ImportFiles() missing directory error = %v, want ErrImportPath", err)
+	}
+}
+
+func TestRelocateDownloads(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	oldRoot, newRoot := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+	os.MkdirAll(filepath.Join(newRoot, "s1"), 0755)
+	os.WriteFile(filepath.Join(newRoot, "s1", "a.zip"), nil, 0644)
+	db.Create(&File{ID: "f1", SourceID: "s1", FileName: "a.zip", Status: FileStatusDeleted})
+	db.Create(&File{ID: "f2", SourceID: "s1", FileName: "b.zip"})
+	db.Create(&DownloadEntry{FileID: "f1", Status: DownloadStatusCompleted, LocalPath: filepath.Join(oldRoot, "s1", "a.zip")})
+	db.Create(&DownloadEntry{FileID: "f2", Status: DownloadStatusCompleted, LocalPath: filepath.Join(oldRoot, "s1", "b.zip")})
+	db.Create(&DownloadEntry{FileID: "f2", Status: DownloadStatusFailed, LocalPath: filepath.Join(dir, "other", "b.zip")})
+
+	// b.zip didn't arrive, so nothing changes
+	result, err := db.RelocateDownloads(oldRoot, newRoot, false)
+	if !errors.Is(err, ErrRelocateMissing) || len(result.Missing) != 1 {
+		t.Fatalf("RelocateDownloads() = %+v, %v, want b.zip missing", result, err)
+	}
+	var entry DownloadEntry
+	db.First(&entry, "file_id = ?", "f1")
+	if entry.LocalPath != filepath.Join(oldRoot, "s1", "a.zip") {
+		t.Errorf("path after failed relocation = %q, want unchanged", entry.LocalPath)
+	}
+
+	result, err = db.RelocateDownloads(oldRoot+string(filepath.Separator), newRoot, true)
+	if err != nil || result.Updated != 2 {
+		t.Fatalf("RelocateDownloads(force) = %+v, %v, want 2 updated", result, err)
+	}
+	var relocated DownloadEntry
+	db.First(&relocated, "file_id = ?", "f1")
+	if relocated.LocalPath != filepath.Join(newRoot, "s1", "a.zip") {
+		t.Errorf("f1 path = %q, want under %s", relocated.LocalPath, newRoot)
+	}
+	var file File
+	db.First(&file, "id = ?", "f1")
+	if file.Status != FileStatusDownloaded {
+		t.Errorf("f1 status = %q, want downloaded", file.Status)
+	}
+	var other DownloadEntry
+	db.Where("file_id = ? AND status = ?", "f2", DownloadStatusFailed).First(&other)
+	if other.LocalPath != filepath.Join(dir, "other", "b.zip") {
+		t.Errorf("path outside the old root = %q, want unchanged", other.LocalPath)
+	}
+}
+
 func TestWebhookCRUD(t *testing.T) {
 	db := setupTestDB(t)
 
@@ -214,3 +550,38 @@ func TestWebhookCRUD(t *testing.T) {
 		t.Errorf("URL = %q, want https://example.com/hook", retrieved.URL)
 	}
 }
+
+func TestCatalogSnapshots(t *testing.T) {
+	db := setupTestDB(t)
+
+	jan := time.Date(2025, 1, 15, 8, 0, 0, 0, time.UTC)
+	if err := db.SaveCatalogSnapshot("p1", "s1", []string{"b", "a"}, 30, jan); err != nil {
+		t.Fatal(err)
+	}
+	// A second snapshot on the same day replaces the first
+	if err := db.SaveCatalogSnapshot("p1", "s1", []string{"a", "b", "c"}, 60, jan.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	db.Model(&CatalogSnapshot{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Snapshot count = %d, want 1", count)
+	}
+
+	snapshot, err := db.CatalogSnapshotAt("p1", jan.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot == nil || snapshot.FileCount != 3 || len(snapshot.Files()) != 3 {
+		t.Errorf("CatalogSnapshotAt() = %+v, want 3 files", snapshot)
+	}
+
+	snapshot, err = db.CatalogSnapshotAt("p1", jan.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot != nil {
+		t.Errorf("CatalogSnapshotAt() before first snapshot = %+v, want nil", snapshot)
+	}
+}
@@ -0,0 +1,243 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// File statuses as exposed by the API, derived from the latest download entry
+// and stored in the status column
+const (
+	FileStatusAvailable   = "available"
+	FileStatusDownloading = "downloading"
+	FileStatusDownloaded  = "downloaded"
+	FileStatusFailed      = "failed"
+	FileStatusSkipped     = "skipped"
+	FileStatusDeleted     = "deleted"
+	FileStatusCancelled   = "cancelled"
+	FileStatusExpired     = "expired"
+	FileStatusInvalid     = "invalid"
+)
+
+// UpdateFileStatus derives the status of the files from their latest
+// download entries and stores it with the error message of a failed
+// download. It's called whenever a download entry or the skipped flag
+// changes, so listings can filter on the status column.
+func (db *DB) UpdateFileStatus(fileIDs ...string) error {
+	return updateFileStatus(db.DB, fileIDs)
+}
+
+func updateFileStatus(tx *gorm.DB, fileIDs []string) error {
+	for _, id := range fileIDs {
+		var file File
+		if err := tx.Unscoped().Select("id", "skipped", "expired").First(&file, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+		var latest *DownloadEntry
+		var entry DownloadEntry
+		err := tx.Where("file_id = ?", id).Order("created_at DESC, id DESC").First(&entry).Error
+		if err == nil {
+			latest = &entry
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		status, errorMessage := DeriveFileStatus(&file, latest)
+		err = tx.Unscoped().Model(&File{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"status":        status,
+			"error_message": errorMessage,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeriveFileStatus derives the status of a file from its latest download
+// entry, nil if it has none, and returns the error message of a failed
+// download. Files of an expired delivery that were never downloaded are
+// expired.
+func DeriveFileStatus(f *File, latest *DownloadEntry) (string, string) {
+	if f.Expired && (latest == nil || latest.Status != DownloadStatusDownloading && latest.Status != DownloadStatusCompleted) {
+		return FileStatusExpired, ""
+	}
+	if latest != nil {
+		switch latest.Status {
+		case DownloadStatusDownloading:
+			return FileStatusDownloading, ""
+		case DownloadStatusCompleted:
+			// Check if file exists on disk
+			if latest.LocalPath != "" {
+				if _, err := os.Stat(latest.LocalPath); err == nil {
+					return FileStatusDownloaded, ""
+				}
+			}
+			return FileStatusDeleted, ""
+		case DownloadStatusFailed, DownloadStatusInterrupted:
+			return FileStatusFailed, latest.ErrorMessage
+		case DownloadStatusInvalid:
+			return FileStatusInvalid, latest.ErrorMessage
+		case DownloadStatusCancelled:
+			return FileStatusCancelled, ""
+		}
+	}
+
+	if f.Skipped {
+		return FileStatusSkipped, ""
+	}
+
+	return FileStatusAvailable, ""
+}
+
+// PruneDownloadEntries deletes failed, cancelled and superseded completed
+// download entries created before the given time and returns how many were
+// deleted. The latest completed entry of each file is kept, since it records
+// where the file was stored.
+func (db *DB) PruneDownloadEntries(before time.Time) (int64, error) {
+	latest := db.Model(&DownloadEntry{}).Select("MAX(id) AS id").
+		Where("status = ?", DownloadStatusCompleted).Group("file_id")
+	// MySQL can't select from the table it deletes from, except through a
+	// derived table
+	keep := db.Table("(?) AS latest", latest).Select("id")
+	prunable := func() *gorm.DB {
+		return db.Where("status IN ? AND created_at < ?",
+			[]string{DownloadStatusFailed, DownloadStatusCancelled, DownloadStatusCompleted}, before).
+			Where("id NOT IN (?)", keep)
+	}
+
+	// A file's latest entry may be pruned, which changes its status
+	var fileIDs []string
+	if err := prunable().Model(&DownloadEntry{}).Distinct().Pluck("file_id", &fileIDs).Error; err != nil {
+		return 0, err
+	}
+	result := prunable().Delete(&DownloadEntry{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, db.UpdateFileStatus(fileIDs...)
+}
+
+// DedupStats summarizes the downloads deduplicated by hard links
+type DedupStats struct {
+	Files      int64
+	SavedBytes int64
+}
+
+// DedupStats counts the downloaded files linked to an identical file's
+// download and the bytes they would take otherwise
+func (db *DB) DedupStats() (DedupStats, error) {
+	latest := db.Model(&DownloadEntry{}).Select("MAX(id)").
+		Where("status = ?", DownloadStatusCompleted).Group("file_id")
+	var stats DedupStats
+	err := db.Model(&DownloadEntry{}).Select("COUNT(*) AS files, COALESCE(SUM(progress), 0) AS saved_bytes").
+		Where("id IN (?) AND duplicate_of <> ''", latest).Scan(&stats).Error
+	return stats, err
+}
+
+// StorageUsage sums up the bytes taken by downloaded and quarantined files.
+// Files stored once for several downloads, as hard links or blobs, count
+// once.
+func (db *DB) StorageUsage() (int64, error) {
+	return db.storageUsage("")
+}
+
+// ProductStorageUsage sums up the bytes taken by the product's downloaded and
+// quarantined files, like StorageUsage
+func (db *DB) ProductStorageUsage(productID string) (int64, error) {
+	return db.storageUsage(productID)
+}
+
+func (db *DB) storageUsage(productID string) (int64, error) {
+	stored := db.Model(&DownloadEntry{}).Select("MAX(progress) AS size").
+		Where("status = ? AND duplicate_of = '' AND local_path <> ''", DownloadStatusCompleted)
+	quarantine := db.Model(&QuarantinedFile{})
+	if productID != "" {
+		files := db.Unscoped().Model(&File{}).Select("id").Where("product_id = ?", productID)
+		stored = stored.Where("file_id IN (?)", files)
+		quarantine = quarantine.Where("file_id IN (?)", files)
+	}
+	var downloaded, quarantined int64
+	if err := db.Table("(?) AS stored", stored.Group("local_path")).Select("COALESCE(SUM(size), 0)").Scan(&downloaded).Error; err != nil {
+		return 0, err
+	}
+	if err := quarantine.Select("COALESCE(SUM(size), 0)").Scan(&quarantined).Error; err != nil {
+		return 0, err
+	}
+	return downloaded + quarantined, nil
+}
+
+// PendingDownloads summarizes the files of a product not downloaded yet
+type PendingDownloads struct {
+	Files int64
+	Bytes int64
+	// UnknownSize counts the files whose source doesn't announce a size,
+	// which Bytes leaves out
+	UnknownSize int64
+}
+
+// PendingDownloads counts the product's files that have no completed
+// download and aren't skipped, expired or archived, and sums up their sizes:
+// what downloading everything left would take
+func (db *DB) PendingDownloads(productID string) (PendingDownloads, error) {
+	downloaded := db.Model(&DownloadEntry{}).Select("file_id").
+		Where("status = ?", DownloadStatusCompleted)
+	var pending PendingDownloads
+	err := db.Model(&File{}).
+		Select("COUNT(*) AS files, COALESCE(SUM(file_size), 0) AS bytes, "+
+			"SUM(CASE WHEN file_size = 0 THEN 1 ELSE 0 END) AS unknown_size").
+		Where("product_id = ? AND skipped = ? AND expired = ? AND archived_at IS NULL AND id NOT IN (?)",
+			productID, false, false, downloaded).
+		Scan(&pending).Error
+	return pending, err
+}
+
+// FileCounts summarizes the files of a product
+type FileCounts struct {
+	ProductID  string
+	Total      int
+	Downloaded int
+	Failed     int
+}
+
+// ProductFileCounts counts the files of the products in a single grouped
+// query: all files, those downloaded at least once and those whose latest
+// download failed. Deleted files are only counted if deleted is set, for
+// listing deleted products. Archived files are never counted.
+func (db *DB) ProductFileCounts(productIDs []string, deleted bool) (map[string]FileCounts, error) {
+	counts := make(map[string]FileCounts, len(productIDs))
+	if len(productIDs) == 0 {
+		return counts, nil
+	}
+
+	downloaded := db.Model(&DownloadEntry{}).Select("DISTINCT file_id").
+		Where("status = ?", DownloadStatusCompleted)
+	latest := db.Model(&DownloadEntry{}).Select("file_id, MAX(id) AS id").Group("file_id")
+	query := db.Model(&File{})
+	if deleted {
+		query = query.Unscoped()
+	}
+	var rows []FileCounts
+	err := query.
+		Select("files.product_id AS product_id, COUNT(*) AS total, COUNT(downloaded.file_id) AS downloaded, "+
+			"SUM(CASE WHEN latest_entry.status IN ? THEN 1 ELSE 0 END) AS failed",
+			[]string{DownloadStatusFailed, DownloadStatusInvalid}).
+		Joins("LEFT JOIN (?) AS downloaded ON downloaded.file_id = files.id", downloaded).
+		Joins("LEFT JOIN (?) AS latest ON latest.file_id = files.id", latest).
+		Joins("LEFT JOIN download_entries AS latest_entry ON latest_entry.id = latest.id").
+		Where("files.product_id IN ? AND files.archived_at IS NULL", productIDs).
+		Group("files.product_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.ProductID] = row
+	}
+	return counts, nil
+}
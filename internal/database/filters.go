@@ -0,0 +1,116 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidPattern is returned for a malformed file name pattern
+var ErrInvalidPattern = errors.New("invalid pattern")
+
+// CheckPatterns reports whether the file name patterns are valid globs, see
+// path.Match
+func CheckPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" {
+			return fmt.Errorf("%w: empty pattern", ErrInvalidPattern)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("%w %q", ErrInvalidPattern, p)
+		}
+	}
+	return nil
+}
+
+// IncludeList returns the file name patterns of the product's include filter
+func (p *Product) IncludeList() []string {
+	var patterns []string
+	json.Unmarshal([]byte(p.IncludePatterns), &patterns)
+	return patterns
+}
+
+// ExcludeList returns the file name patterns of the product's exclude filter
+func (p *Product) ExcludeList() []string {
+	var patterns []string
+	json.Unmarshal([]byte(p.ExcludePatterns), &patterns)
+	return patterns
+}
+
+// MatchesFilters reports whether a file name passes the product's filters:
+// it matches an include pattern, if there are any, and no exclude pattern.
+// Patterns match case-insensitively.
+func (p *Product) MatchesFilters(name string) bool {
+	include, exclude := p.IncludeList(), p.ExcludeList()
+	return (len(include) == 0 || matchAny(include, name)) && !matchAny(exclude, name)
+}
+
+// ReleasedInRange reports whether a file released at t passes the product's
+// cutoff date: it must be released on or after it. Files without a release
+// date pass.
+func (p *Product) ReleasedInRange(t time.Time) bool {
+	return p.ReleasedAfter == nil || t.IsZero() || !t.Before(*p.ReleasedAfter)
+}
+
+func matchAny(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AutoDownloads reports whether a file of the size is downloaded
+// automatically: it must be within the product's size bounds. With a bound
+// set, files of unknown size wait for a manual download too.
+func (p *Product) AutoDownloads(size int64) bool {
+	if p.MinAutoDownloadSize <= 0 && p.MaxAutoDownloadSize <= 0 {
+		return true
+	}
+	if size <= 0 {
+		return false
+	}
+	return size >= p.MinAutoDownloadSize && (p.MaxAutoDownloadSize <= 0 || size <= p.MaxAutoDownloadSize)
+}
+
+// SetProductFilters replaces the product's file name filters and cutoff
+// date, nil for none. skip records files left out by them as skipped instead
+// of leaving them out of the catalog.
+func (db *DB) SetProductFilters(id string, include, exclude []string, releasedAfter *time.Time, skip bool) (*Product, error) {
+	var product Product
+	if err := db.First(&product, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	product.IncludePatterns = encodePatterns(include)
+	product.ExcludePatterns = encodePatterns(exclude)
+	product.ReleasedAfter = releasedAfter
+	product.SkipFiltered = skip
+	err := db.Model(&product).Updates(map[string]any{
+		"include_patterns": product.IncludePatterns,
+		"exclude_patterns": product.ExcludePatterns,
+		"released_after":   releasedAfter,
+		"skip_filtered":    skip,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func encodePatterns(patterns []string) string {
+	if len(patterns) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(patterns)
+	return string(b)
+}
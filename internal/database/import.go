@@ -0,0 +1,247 @@
+package database
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrImportPath is returned by ImportFiles for a path that isn't a directory
+var ErrImportPath = errors.New("import path is not a directory")
+
+// ImportOptions controls ImportFiles
+type ImportOptions struct {
+	// Verify hashes each candidate and requires it to match the file's
+	// expected checksum, where the source provides one
+	Verify bool
+	// DryRun reports what would be imported without recording anything
+	DryRun bool
+	// Progress, if set, is called with the number of files examined so far
+	Progress func(files int)
+}
+
+// ImportReport lists what ImportFiles found
+type ImportReport struct {
+	// Imported are the files recorded as downloaded
+	Imported []StoredFile `json:"imported"`
+	// Skipped are files on disk matching files already downloaded
+	Skipped []StoredFile `json:"skipped"`
+	// Mismatched are paths whose name matches a file but whose size or
+	// checksum doesn't
+	Mismatched []string `json:"mismatched"`
+	// Ambiguous are paths matching several files equally well
+	Ambiguous []string `json:"ambiguous"`
+	// Unmatched counts the files whose name matches no file
+	Unmatched int  `json:"unmatched"`
+	DryRun    bool `json:"dryRun"`
+}
+
+// ImportFiles records files already on disk under dir, e.g. downloaded by
+// another tool, as completed downloads so they aren't downloaded again.
+// Files are matched by name and size; with several candidates, the one whose
+// source and product IDs match the parent directories, as in the downloads
+// directory, wins. The files stay where they are.
+func (db *DB) ImportFiles(dir string, opts ImportOptions, now time.Time) (*ImportReport, error) {
+	dir, err := CheckImportPath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File
+	if err := db.Select("id", "source_id", "product_id", "file_name", "file_size", "expected_checksum",
+		"checksum_algorithm", "status").Find(&files).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string][]File)
+	for _, f := range files {
+		byName[f.FileName] = append(byName[f.FileName], f)
+	}
+
+	report := &ImportReport{
+		Imported:   []StoredFile{},
+		Skipped:    []StoredFile{},
+		Mismatched: []string{},
+		Ambiguous:  []string{},
+		DryRun:     opts.DryRun,
+	}
+	seen := make(map[string]bool)
+	var entries []DownloadEntry
+	examined := 0
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		examined++
+		if opts.Progress != nil {
+			defer opts.Progress(examined)
+		}
+		named := byName[d.Name()]
+		if len(named) == 0 {
+			report.Unmatched++
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		// Files of unknown size don't match, or any file of their name would
+		var candidates []File
+		for _, f := range named {
+			if f.FileSize == info.Size() {
+				candidates = append(candidates, f)
+			}
+		}
+		if len(candidates) > 1 {
+			var placed []File
+			for _, f := range candidates {
+				if strings.HasSuffix(path, string(filepath.Separator)+filepath.Join(f.SourceID, f.ProductID, f.FileName)) {
+					placed = append(placed, f)
+				}
+			}
+			if len(placed) > 0 {
+				candidates = placed
+			}
+		}
+
+		var checksum string
+		if opts.Verify && len(candidates) > 0 {
+			algorithms := []string{"sha256"}
+			for _, f := range candidates {
+				algorithms = append(algorithms, strings.ToLower(f.ChecksumAlgorithm))
+			}
+			sums, err := hashFile(path, algorithms)
+			if err != nil {
+				return err
+			}
+			checksum = "sha256:" + sums["sha256"]
+			var verified []File
+			for _, f := range candidates {
+				if ChecksumMatches(f, sums) {
+					verified = append(verified, f)
+				}
+			}
+			candidates = verified
+		}
+
+		switch {
+		case len(candidates) == 0:
+			report.Mismatched = append(report.Mismatched, path)
+			return nil
+		case len(candidates) > 1:
+			report.Ambiguous = append(report.Ambiguous, path)
+			return nil
+		}
+		file := candidates[0]
+		if seen[file.ID] || file.Status == FileStatusDownloaded || file.Status == FileStatusDownloading {
+			report.Skipped = append(report.Skipped, StoredFile{FileID: file.ID, Path: path})
+			return nil
+		}
+		seen[file.ID] = true
+		report.Imported = append(report.Imported, StoredFile{FileID: file.ID, Path: path})
+		entries = append(entries, DownloadEntry{
+			FileID:        file.ID,
+			Status:        DownloadStatusCompleted,
+			Progress:      info.Size(),
+			TotalBytes:    info.Size(),
+			LocalPath:     path,
+			LocalChecksum: checksum,
+			StartedAt:     &now,
+			CompletedAt:   &now,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun || len(entries) == 0 {
+		return report, nil
+	}
+	if err := insertAll(db.DB, entries); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.FileID)
+	}
+	if err := db.UpdateFileStatus(ids...); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// CheckImportPath returns the absolute path of an import directory, or
+// ErrImportPath if it isn't one
+func CheckImportPath(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%w: %s", ErrImportPath, dir)
+	}
+	return dir, nil
+}
+
+// hashFile returns the hex digests of the file for the supported algorithms
+// among algorithms
+func hashFile(path string, algorithms []string) (map[string]string, error) {
+	hashers := make(map[string]hash.Hash)
+	for _, algorithm := range algorithms {
+		switch algorithm {
+		case "md5":
+			hashers[algorithm] = md5.New()
+		case "sha1":
+			hashers[algorithm] = sha1.New()
+		case "sha256":
+			hashers[algorithm] = sha256.New()
+		}
+	}
+	writers := make([]io.Writer, 0, len(hashers))
+	for _, h := range hashers {
+		writers = append(writers, h)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string, len(hashers))
+	for algorithm, h := range hashers {
+		sums[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, nil
+}
+
+// ChecksumMatches reports whether the digests, keyed by lowercase algorithm,
+// match the file's expected checksum. Files without one, or with an
+// algorithm missing from the digests, match.
+func ChecksumMatches(f File, sums map[string]string) bool {
+	if f.ExpectedChecksum == "" {
+		return true
+	}
+	sum, ok := sums[strings.ToLower(f.ChecksumAlgorithm)]
+	if !ok {
+		return true
+	}
+	_, expected, found := strings.Cut(f.ExpectedChecksum, ":")
+	if !found {
+		expected = f.ExpectedChecksum
+	}
+	return strings.EqualFold(expected, sum)
+}
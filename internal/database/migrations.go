@@ -0,0 +1,270 @@
+package database
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is a versioned schema change AutoMigrate can't make, such as a
+// column rename, a data backfill or an index drop. Each migration runs once,
+// in a transaction, before AutoMigrate adds the columns of the current
+// models, so it sees the schema of the version it was written for and
+// declares the columns it needs as they were then. New databases skip the
+// migrations, see initSchema.
+//
+// This follows gormigrate (ID, Up and Down, an initial schema for new
+// databases) without the dependency, and unlike it lists pending migrations
+// without applying them, for "migrate status".
+type Migration struct {
+	// ID orders the migrations and is recorded once applied, e.g.
+	// 20250301_rename_product_window
+	ID   string
+	Up   func(tx *gorm.DB) error
+	Down func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	ID        string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migrations lists the versioned migrations, oldest first. New ones are
+// appended with an ID sorting after the last.
+var migrations = []Migration{
+	{
+		// Status derivation reads a file's latest download entry; pending and
+		// file listings filter by product or source
+		ID:   "20261016_file_query_indexes",
+		Up:   createIndexes(fileQueryIndexes),
+		Down: dropIndexes(fileQueryIndexes),
+	},
+	{
+		// Fills in the status column for files downloaded before it was added
+		ID: "20261017_file_status",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []string{"Expired", "Status", "ErrorMessage"} {
+				if tx.Migrator().HasColumn(&fileStatusColumns{}, column) {
+					continue
+				}
+				if err := tx.Migrator().AddColumn(&fileStatusColumns{}, column); err != nil {
+					return err
+				}
+			}
+			var fileIDs []string
+			if err := tx.Model(&DownloadEntry{}).Distinct().Pluck("file_id", &fileIDs).Error; err != nil {
+				return err
+			}
+			err := tx.Unscoped().Model(&File{}).Where("skipped = ?", true).
+				Update("status", FileStatusSkipped).Error
+			if err != nil {
+				return err
+			}
+			return updateFileStatus(tx, fileIDs)
+		},
+		// The column stays, and filling it in again is harmless
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+}
+
+// fileStatusColumns are the files columns 20261017_file_status fills in
+type fileStatusColumns struct {
+	Expired      bool   `gorm:"default:false"`
+	Status       string `gorm:"default:available"`
+	ErrorMessage string
+}
+
+func (fileStatusColumns) TableName() string {
+	return "files"
+}
+
+// initSchema creates the current schema on a new database: the tables of the
+// models and what migrations add beyond them, like the file query indexes.
+// The migrations are recorded as applied, as there is nothing to migrate; a
+// migration adding to the schema must add it here too.
+func initSchema(db *gorm.DB, list []Migration) error {
+	if err := validateMigrations(list); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(append(slices.Clone(models), &SchemaMigration{})...); err != nil {
+		return err
+	}
+	if err := createIndexes(fileQueryIndexes)(db); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, m := range list {
+		if err := db.Create(&SchemaMigration{ID: m.ID, AppliedAt: now}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// index is a composite index created by a migration rather than from model
+// tags, so databases created before it get it too
+type index struct {
+	name    string
+	model   any
+	table   string
+	columns string
+}
+
+var fileQueryIndexes = []index{
+	{"idx_download_entries_file_created", &DownloadEntry{}, "download_entries", "file_id, created_at"},
+	{"idx_files_product_skipped", &File{}, "files", "product_id, skipped"},
+	{"idx_files_source_created", &File{}, "files", "source_id, created_at"},
+}
+
+func createIndexes(indexes []index) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, idx := range indexes {
+			if tx.Migrator().HasIndex(idx.model, idx.name) {
+				continue
+			}
+			if err := tx.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", idx.name, idx.table, idx.columns)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func dropIndexes(indexes []index) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, idx := range indexes {
+			if !tx.Migrator().HasIndex(idx.model, idx.name) {
+				continue
+			}
+			if err := tx.Migrator().DropIndex(idx.model, idx.name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// applyMigrations runs the migrations not yet recorded in schema_migrations
+func applyMigrations(db *gorm.DB, list []Migration) error {
+	if err := validateMigrations(list); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	for _, id := range applied {
+		if !slices.ContainsFunc(list, func(m Migration) bool { return m.ID == id }) {
+			slog.Warn("Database has a migration unknown to this version", "migration", id)
+		}
+	}
+
+	for _, m := range list {
+		if slices.Contains(applied, m.ID) {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{ID: m.ID, AppliedAt: time.Now().UTC()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", m.ID, err)
+		}
+		slog.Info("Applied migration", "migration", m.ID)
+	}
+	return nil
+}
+
+// RollbackMigrations reverts the last steps applied migrations, newest first,
+// and returns their IDs
+func (db *DB) RollbackMigrations(steps int) ([]string, error) {
+	return rollbackMigrations(db.DB, migrations, steps)
+}
+
+func rollbackMigrations(db *gorm.DB, list []Migration, steps int) ([]string, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	var reverted []string
+	for i := len(applied) - 1; i >= 0 && len(reverted) < steps; i-- {
+		id := applied[i]
+		idx := slices.IndexFunc(list, func(m Migration) bool { return m.ID == id })
+		if idx < 0 {
+			return reverted, fmt.Errorf("migration %s is unknown to this version", id)
+		}
+		m := list[idx]
+		if m.Down == nil {
+			return reverted, fmt.Errorf("migration %s can't be rolled back", id)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{ID: id}).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("roll back migration %s: %w", id, err)
+		}
+		reverted = append(reverted, id)
+	}
+	return reverted, nil
+}
+
+// AppliedMigrations returns the IDs of the applied migrations, oldest first
+func (db *DB) AppliedMigrations() ([]string, error) {
+	return appliedMigrations(db.DB)
+}
+
+// PendingMigrations returns the IDs of the migrations not applied yet,
+// oldest first, without applying them
+func (db *DB) PendingMigrations() ([]string, error) {
+	applied, err := appliedMigrations(db.DB)
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, m := range migrations {
+		if !slices.Contains(applied, m.ID) {
+			pending = append(pending, m.ID)
+		}
+	}
+	return pending, nil
+}
+
+// appliedMigrations returns the IDs of the applied migrations, oldest first;
+// none before the first migration ran
+func appliedMigrations(db *gorm.DB) ([]string, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return nil, nil
+	}
+	var ids []string
+	err := db.Model(&SchemaMigration{}).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// validateMigrations checks that the IDs are set, unique and in order
+func validateMigrations(list []Migration) error {
+	for i, m := range list {
+		if m.ID == "" || m.Up == nil {
+			return fmt.Errorf("migration %d needs an ID and an Up function", i)
+		}
+		if i > 0 && m.ID <= list[i-1].ID {
+			return fmt.Errorf("migration %s must sort after %s", m.ID, list[i-1].ID)
+		}
+	}
+	return nil
+}
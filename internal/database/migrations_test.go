@@ -0,0 +1,201 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// forgetMigrations clears the record of the built-in migrations, so tests see
+// only their own
+func forgetMigrations(t *testing.T, db *DB) {
+	t.Helper()
+	if err := db.Where("1 = 1").Delete(&SchemaMigration{}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	db := setupTestDB(t)
+	forgetMigrations(t, db)
+	db.Create(&Setting{Key: "old_key", Value: "v"})
+
+	renamed := 0
+	list := []Migration{
+		{
+			ID: "20250101_rename_setting",
+			Up: func(tx *gorm.DB) error {
+				renamed++
+				return tx.Model(&Setting{}).Where("key = ?", "old_key").Update("key", "new_key").Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Model(&Setting{}).Where("key = ?", "new_key").Update("key", "old_key").Error
+			},
+		},
+		{
+			ID: "20250102_drop_index",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().DropIndex(&Event{}, "idx_events_type")
+			},
+		},
+	}
+	for range 2 {
+		if err := applyMigrations(db.DB, list); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if renamed != 1 {
+		t.Errorf("migration ran %d times, want once", renamed)
+	}
+	if !db.HasSetting("new_key") || db.Migrator().HasIndex(&Event{}, "idx_events_type") {
+		t.Error("migrations were not applied")
+	}
+	if applied, _ := db.AppliedMigrations(); !slices.Equal(applied, []string{"20250101_rename_setting", "20250102_drop_index"}) {
+		t.Errorf("AppliedMigrations = %v", applied)
+	}
+
+	// The index drop has no Down, so the rename can't be reached
+	if reverted, err := rollbackMigrations(db.DB, list, 2); err == nil || len(reverted) != 0 {
+		t.Errorf("rollback past a migration without Down = %v, %v", reverted, err)
+	}
+	list[1].Down = func(tx *gorm.DB) error {
+		return tx.Migrator().CreateIndex(&Event{}, "Type")
+	}
+	reverted, err := rollbackMigrations(db.DB, list, 2)
+	if err != nil || !slices.Equal(reverted, []string{"20250102_drop_index", "20250101_rename_setting"}) {
+		t.Fatalf("rollback = %v, %v", reverted, err)
+	}
+	if !db.HasSetting("old_key") || !db.Migrator().HasIndex(&Event{}, "idx_events_type") {
+		t.Error("migrations were not rolled back")
+	}
+}
+
+// Tables as an early version created them, before the migrations
+type (
+	oldFile struct {
+		ID        string `gorm:"primaryKey"`
+		ProductID string
+		SourceID  string
+		FileName  string
+		Skipped   bool
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+	oldDownloadEntry struct {
+		ID        uint `gorm:"primaryKey"`
+		FileID    string
+		Status    string
+		CreatedAt time.Time
+	}
+	oldSetting struct {
+		Key string `gorm:"primaryKey"`
+		Val string
+	}
+)
+
+func (oldFile) TableName() string          { return "files" }
+func (oldDownloadEntry) TableName() string { return "download_entries" }
+func (oldSetting) TableName() string       { return "settings" }
+
+func TestMigrationsRunBeforeAutoMigrate(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gormDB.AutoMigrate(&Source{}, &oldFile{}, &oldDownloadEntry{}, &oldSetting{}); err != nil {
+		t.Fatal(err)
+	}
+	gormDB.Create(&oldFile{ID: "f1", ProductID: "p1", FileName: "a.zip"})
+	gormDB.Create(&oldDownloadEntry{FileID: "f1", Status: DownloadStatusFailed})
+	gormDB.Create(&oldSetting{Key: "k", Val: "v"})
+	db := &DB{DB: gormDB}
+
+	// Listing pending migrations leaves the database as it is
+	if pending, err := db.PendingMigrations(); err != nil || len(pending) != len(migrations) {
+		t.Errorf("PendingMigrations = %v, %v, want all", pending, err)
+	}
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		t.Error("PendingMigrations created schema_migrations")
+	}
+
+	// A rename runs before AutoMigrate would add the new column empty
+	list := append(slices.Clone(migrations), Migration{
+		ID: "20991231_rename_setting_value",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().RenameColumn(&oldSetting{}, "val", "value")
+		},
+	})
+	if err := migrate(gormDB, list); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := db.GetSetting("k"); value != "v" {
+		t.Errorf("renamed setting = %q, want v", value)
+	}
+	var file File
+	db.First(&file, "id = ?", "f1")
+	if file.Status != FileStatusFailed {
+		t.Errorf("f1 status = %q, want the backfilled %q", file.Status, FileStatusFailed)
+	}
+}
+
+func TestNewDatabaseRecordsMigrations(t *testing.T) {
+	db := setupTestDB(t)
+	if pending, err := db.PendingMigrations(); err != nil || len(pending) != 0 {
+		t.Errorf("PendingMigrations = %v, %v, want none on a new database", pending, err)
+	}
+}
+
+func TestFailedMigrationIsNotRecorded(t *testing.T) {
+	db := setupTestDB(t)
+	forgetMigrations(t, db)
+	list := []Migration{{
+		ID: "20250101_fails",
+		Up: func(tx *gorm.DB) error {
+			tx.Create(&Setting{Key: "partial", Value: "v"})
+			return errors.New("boom")
+		},
+	}}
+	if err := applyMigrations(db.DB, list); err == nil {
+		t.Fatal("applyMigrations should return the migration's error")
+	}
+	if applied, _ := db.AppliedMigrations(); len(applied) != 0 || db.HasSetting("partial") {
+		t.Errorf("failed migration left applied = %v and its changes", applied)
+	}
+
+	for _, invalid := range [][]Migration{
+		{{ID: "b", Up: list[0].Up}, {ID: "a", Up: list[0].Up}},
+		{{ID: "a", Up: list[0].Up}, {ID: "a", Up: list[0].Up}},
+		{{ID: "a"}},
+	} {
+		if err := applyMigrations(db.DB, invalid); err == nil {
+			t.Errorf("applyMigrations accepted %v", invalid)
+		}
+	}
+}
+
+func TestFileQueryIndexes(t *testing.T) {
+	db := setupTestDB(t)
+	for _, idx := range fileQueryIndexes {
+		if !db.Migrator().HasIndex(idx.model, idx.name) {
+			t.Errorf("index %s is missing", idx.name)
+		}
+	}
+
+	// Roll back the later migrations too
+	steps := len(migrations) - slices.IndexFunc(migrations, func(m Migration) bool {
+		return m.ID == "20261016_file_query_indexes"
+	})
+	if _, err := db.RollbackMigrations(steps); err != nil {
+		t.Fatal(err)
+	}
+	for _, idx := range fileQueryIndexes {
+		if db.Migrator().HasIndex(idx.model, idx.name) {
+			t.Errorf("index %s was not dropped", idx.name)
+		}
+	}
+}
@@ -1,15 +1,30 @@
 package database
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Source struct {
 	ID             string `gorm:"primaryKey"`
 	Name           string
 	Enabled        bool `gorm:"default:false"`
 	CredentialsEnc []byte
-	LastSyncAt     *time.Time
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	// OptionsEnc holds the encrypted base URL override and extra headers
+	OptionsEnc []byte
+	// CredentialsExpireAt is when the stored credentials stop working, from
+	// the lifetimes the adapter declares or as entered by the user
+	CredentialsExpireAt *time.Time
+	// CredentialsRemindedAt is set once credentials.expiring has been emitted
+	// for the current expiry date
+	CredentialsRemindedAt *time.Time
+	// DefaultSchedule replaces the adapter's check schedule for newly
+	// discovered products
+	DefaultSchedule string
+	LastSyncAt      *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
 
 type Product struct {
@@ -21,9 +36,57 @@ type Product struct {
 	AutoDownload     bool `gorm:"default:false"`
 	CheckWindowStart string
 	CheckWindowEnd   string
-	LastCheckedAt    *time.Time
-	CreatedAt        time.Time
-	UpdatedAt        time.Time
+	// DownloadWindow holds the periods in which the product's downloads may
+	// start, overriding the global window, e.g. "22:00-06:00"
+	DownloadWindow string
+	LastCheckedAt  *time.Time
+	// LastSyncedAt is when the last sync without errors finished; a missed
+	// scheduled run since then is caught up on startup
+	LastSyncedAt *time.Time
+	// SyncFailures counts consecutive failed syncs; once it reaches the
+	// failure limit, scheduled syncs stop and SyncDisabledAt is set
+	SyncFailures   int
+	SyncDisabledAt *time.Time
+	// SyncWatermark is the publication time of the newest delivery seen by
+	// the last complete sync; scheduled syncs skip older deliveries
+	SyncWatermark *time.Time
+	// Hidden leaves the product out of product listings without affecting
+	// its schedule or downloads
+	Hidden bool `gorm:"default:false"`
+	// Favorite products are listed first
+	Favorite bool   `gorm:"default:false"`
+	Tags     string // JSON array of tags, see SetProductTags
+	// Validators is a JSON array of the checks downloaded files must pass,
+	// see SetProductValidators
+	Validators string
+	// Pipeline is a JSON array of post-processing steps run on completed
+	// downloads, see the pipeline package
+	Pipeline string
+	// StorageQuota bounds the bytes the product's downloads may take up, 0
+	// for no bound; QuotaAction says what happens to files that would exceed
+	// it, see SetProductQuota
+	StorageQuota int64
+	QuotaAction  string
+	// IncludePatterns and ExcludePatterns are JSON arrays of file name globs
+	// and ReleasedAfter a cutoff date applied to new files during syncs;
+	// SkipFiltered records the files they leave out as skipped instead of
+	// ignoring them. See SetProductFilters.
+	IncludePatterns string
+	ExcludePatterns string
+	ReleasedAfter   *time.Time
+	SkipFiltered    bool `gorm:"default:false"`
+	// MinAutoDownloadSize and MaxAutoDownloadSize bound the size in bytes of
+	// the files downloaded automatically, 0 for no bound; see AutoDownloads
+	MinAutoDownloadSize int64
+	MaxAutoDownloadSize int64
+	// LatestOnly tracks only the newest delivery: when a sync finds a new
+	// one, the files of older deliveries are skipped, see SkipOlderDeliveries
+	LatestOnly bool `gorm:"default:false"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	// DeletedAt soft-deletes the product together with its deliveries and
+	// files; see DeleteProduct
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 
 	Source     Source     `gorm:"foreignKey:SourceID"`
 	Deliveries []Delivery `gorm:"foreignKey:ProductID"`
@@ -36,7 +99,14 @@ type Delivery struct {
 	Name        string
 	PublishedAt *time.Time
 	ExpiresAt   *time.Time
-	CreatedAt   time.Time
+	// ExpiryRemindedAt is set once delivery.expiring has been emitted and
+	// cleared when the delivery's files are downloaded
+	ExpiryRemindedAt *time.Time
+	// ArchivedAt is set once the delivery is older than the archive age; see
+	// ArchiveDeliveries
+	ArchivedAt *time.Time `gorm:"index"`
+	CreatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
 
 	Product Product `gorm:"foreignKey:ProductID"`
 	Files   []File  `gorm:"foreignKey:DeliveryID"`
@@ -55,11 +125,45 @@ type File struct {
 	DownloadURI       string
 	ReleasedAt        *time.Time
 	Skipped           bool `gorm:"default:false"`
-	CreatedAt         time.Time
-	UpdatedAt         time.Time
+	// Expired is set once the delivery expired before the file was
+	// downloaded; see ExpireDeliveries
+	Expired bool `gorm:"default:false"`
+	// Status and ErrorMessage mirror the latest download entry, see
+	// UpdateFileStatus
+	Status       string `gorm:"index;default:available"`
+	ErrorMessage string
+	// ArchivedAt is set with the delivery's; archived files are left out of
+	// listings and automatic downloads
+	ArchivedAt *time.Time `gorm:"index"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
 
 	Delivery        Delivery        `gorm:"foreignKey:DeliveryID"`
 	DownloadEntries []DownloadEntry `gorm:"foreignKey:FileID"`
+	Tags            []FileTag       `gorm:"foreignKey:FileID"`
+	Metadata        []FileMetadata  `gorm:"foreignKey:FileID"`
+}
+
+// FileTag marks a file for downstream pipelines, e.g. ingested or bad. Unlike
+// product tags, file tags have their own table so listings can filter on them
+// in SQL.
+type FileTag struct {
+	FileID    string `gorm:"primaryKey"`
+	Tag       string `gorm:"primaryKey;index"`
+	CreatedAt time.Time
+}
+
+// FileMetadata is a key/value pair set on a file through the API
+type FileMetadata struct {
+	FileID    string `gorm:"primaryKey"`
+	Key       string `gorm:"primaryKey"`
+	Value     string
+	CreatedAt time.Time
+}
+
+func (FileMetadata) TableName() string {
+	return "file_metadata"
 }
 
 type DownloadEntry struct {
@@ -70,10 +174,13 @@ type DownloadEntry struct {
 	TotalBytes    int64
 	LocalPath     string
 	LocalChecksum string
-	ErrorMessage  string
-	StartedAt     *time.Time
-	CompletedAt   *time.Time
-	CreatedAt     time.Time
+	// DuplicateOf is the file whose identical download LocalPath is hard
+	// linked to, if deduplicated
+	DuplicateOf  string
+	ErrorMessage string
+	StartedAt    *time.Time
+	CompletedAt  *time.Time
+	CreatedAt    time.Time
 
 	File File `gorm:"foreignKey:FileID"`
 }
@@ -84,19 +191,210 @@ const (
 	DownloadStatusCompleted   = "completed"
 	DownloadStatusFailed      = "failed"
 	DownloadStatusCancelled   = "cancelled"
+	// DownloadStatusInterrupted marks a download stopped by a shutdown that
+	// is resumed on the next start
+	DownloadStatusInterrupted = "interrupted"
+	// DownloadStatusPaused marks an auto-download waiting for its product's
+	// check window to open
+	DownloadStatusPaused = "paused"
+	// DownloadStatusInvalid marks a download that failed its checksum or
+	// validation; the file is moved to quarantine for inspection
+	DownloadStatusInvalid = "invalid"
+)
+
+// QuarantinedFile is a download that failed its checksum or validation,
+// kept in the quarantine directory until it is released or purged
+type QuarantinedFile struct {
+	ID              uint   `gorm:"primaryKey"`
+	FileID          string `gorm:"index"`
+	DownloadEntryID uint
+	// Path is relative to the quarantine directory
+	Path     string
+	Reason   string
+	Message  string
+	Size     int64
+	Checksum string
+	// CreatedAt is when the file was quarantined
+	CreatedAt time.Time
+
+	File File `gorm:"foreignKey:FileID"`
+}
+
+// Reasons for quarantining a file
+const (
+	QuarantineChecksum   = "checksum"
+	QuarantineValidation = "validation"
+)
+
+// SyncRun records one attempt to sync a product's catalog
+type SyncRun struct {
+	ID           uint   `gorm:"primaryKey"`
+	ProductID    string `gorm:"index"`
+	SourceID     string
+	Trigger      string
+	Attempt      int
+	Status       string
+	NewFiles     int
+	ErrorMessage string
+	StartedAt    time.Time `gorm:"index"`
+	CompletedAt  *time.Time
+	NextRetryAt  *time.Time
+}
+
+const (
+	SyncTriggerScheduled = "scheduled"
+	SyncTriggerManual    = "manual"
+	SyncTriggerRetry     = "retry"
+	SyncTriggerOnce      = "once"
+	SyncTriggerCatchUp   = "catch-up"
 )
 
+const (
+	SyncStatusRunning   = "running"
+	SyncStatusCompleted = "completed"
+	SyncStatusFailed    = "failed"
+)
+
+// CatalogSnapshot records which files a product's catalog listed on a given
+// day. There is at most one snapshot per product and day.
+type CatalogSnapshot struct {
+	ID           uint   `gorm:"primaryKey"`
+	ProductID    string `gorm:"uniqueIndex:idx_catalog_snapshot_day"`
+	SourceID     string `gorm:"index"`
+	SnapshotDate string `gorm:"uniqueIndex:idx_catalog_snapshot_day"` // YYYY-MM-DD
+	FileCount    int
+	TotalSize    int64
+	FileIDs      string // JSON array
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
 type Webhook struct {
 	ID        uint `gorm:"primaryKey"`
 	Name      string
 	URL       string
 	Events    string
+	Sources   string // JSON array of source IDs; empty matches all
+	Products  string // JSON array of product IDs; empty matches all
 	Headers   []byte
-	Enabled   bool `gorm:"default:true"`
+	Secret    string // signs payloads; empty sends them unsigned
+	Template  string // text/template rendering the payload; empty sends the event JSON
+	Enabled   bool   `gorm:"default:true"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// DigestMinutes batches events into one payload sent every DigestMinutes;
+	// 0 sends each event right away
+	DigestMinutes int
+}
+
+// WebhookDeadLetter is a webhook delivery that still failed after all
+// retries, kept so it can be inspected and replayed
+type WebhookDeadLetter struct {
+	ID        uint `gorm:"primaryKey"`
+	WebhookID uint `gorm:"index"`
+	Event     string
+	Payload   []byte
+	Attempts  int
+	LastError string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// Event is an emitted hooks event, recorded so it can be replayed
+type Event struct {
+	ID        uint   `gorm:"primaryKey"`
+	Type      string `gorm:"index"`
+	Source    string
+	Payload   []byte    // the event as JSON
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// SlackNotifier posts a message to Slack for matching events, through an
+// incoming webhook or with a bot token to a channel
+type SlackNotifier struct {
+	ID         uint `gorm:"primaryKey"`
+	Name       string
+	WebhookURL string // incoming webhook URL; takes precedence over BotToken
+	BotToken   string // posts to Channel with chat.postMessage
+	Channel    string
+	Events     string
+	Sources    string // JSON array of source IDs; empty matches all
+	Products   string // JSON array of product IDs; empty matches all
+	Template   string // text/template rendering the message; empty uses the default
+	Enabled    bool   `gorm:"default:true"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// ChatNotifier posts a message card for matching events to a Discord or
+// Microsoft Teams webhook
+type ChatNotifier struct {
+	ID         uint `gorm:"primaryKey"`
+	Name       string
+	Platform   string // "discord" or "teams"
+	WebhookURL string
+	Events     string
+	Sources    string // JSON array of source IDs; empty matches all
+	Products   string // JSON array of product IDs; empty matches all
+	Enabled    bool   `gorm:"default:true"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// EmailNotifier mails matching events to its recipients, one mail per event
+// or collected into a digest
+type EmailNotifier struct {
+	ID            uint `gorm:"primaryKey"`
+	Name          string
+	Recipients    string // JSON array of addresses
+	Events        string
+	Sources       string // JSON array of source IDs; empty matches all
+	Products      string // JSON array of product IDs; empty matches all
+	DigestMinutes int    // 0 mails each event; otherwise events are mailed together
+	Enabled       bool   `gorm:"default:true"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// NatsPublisher publishes matching events to NATS subjects below Subject,
+// e.g. Subject.download.completed
+type NatsPublisher struct {
+	ID        uint `gorm:"primaryKey"`
+	Name      string
+	URL       string // nats:// or tls:// server URL, with credentials
+	Subject   string
+	JetStream bool // wait for a JetStream stream to store each event
+	Events    string
+	Sources   string // JSON array of source IDs; empty matches all
+	Products  string // JSON array of product IDs; empty matches all
+	Enabled   bool   `gorm:"default:true"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// APIKey authenticates automation without the passphrase. Only a hash of
+// the key is stored; Prefix, its first characters, identifies it in listings.
+type APIKey struct {
+	ID         uint `gorm:"primaryKey"`
+	Name       string
+	Prefix     string
+	Hash       string `gorm:"uniqueIndex"`
+	Scopes     string // JSON array of scopes; empty grants full access
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// AuditEntry records an access to a source's credentials. Unlike events, audit
+// entries are never pruned.
+type AuditEntry struct {
+	ID        uint      `gorm:"primaryKey"`
+	Source    string    `gorm:"index"`
+	Action    string    // decrypted, updated, tested or exported
+	Actor     string    // who caused the access, e.g. api-key:ci or system
+	CreatedAt time.Time `gorm:"index"`
+}
+
 type Setting struct {
 	Key   string `gorm:"primaryKey"`
 	Value string
@@ -106,4 +404,5 @@ const (
 	SettingPassphraseHash = "passphrase_hash"
 	SettingPassphraseSalt = "passphrase_salt"
 	SettingEncryptionSalt = "encryption_salt"
+	SettingTelemetryID    = "telemetry_instance_id"
 )
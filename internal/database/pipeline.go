@@ -0,0 +1,24 @@
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// SetProductPipeline replaces the post-processing steps run on the product's
+// completed downloads, given as a JSON array; empty removes them
+func (db *DB) SetProductPipeline(id, pipeline string) (*Product, error) {
+	var product Product
+	if err := db.First(&product, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	product.Pipeline = pipeline
+	if err := db.Model(&product).Update("pipeline", pipeline).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
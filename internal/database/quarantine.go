@@ -0,0 +1,33 @@
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// QuarantineDir is the directory under the downloads directory holding
+// quarantined files, on the same filesystem so moving them is cheap
+const QuarantineDir = ".quarantine"
+
+// ListQuarantine returns the quarantined files, newest first, with their files
+func (db *DB) ListQuarantine() ([]QuarantinedFile, error) {
+	var entries []QuarantinedFile
+	err := db.Preload("File", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		Order("id DESC").Find(&entries).Error
+	return entries, err
+}
+
+// GetQuarantined returns a quarantined file with its file
+func (db *DB) GetQuarantined(id uint) (*QuarantinedFile, error) {
+	var entry QuarantinedFile
+	err := db.Preload("File", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		First(&entry, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
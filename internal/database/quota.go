@@ -0,0 +1,33 @@
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// What happens to a file whose download would exceed its product's storage
+// quota
+const (
+	// QuotaDefer lets the download wait until enough space is freed
+	QuotaDefer = "defer"
+	// QuotaSkip marks the file as skipped
+	QuotaSkip = "skip"
+)
+
+// SetProductQuota sets how many bytes the product's downloads may take up, 0
+// for no bound, and what happens to files that would exceed it
+func (db *DB) SetProductQuota(id string, quota int64, action string) (*Product, error) {
+	var product Product
+	if err := db.First(&product, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	product.StorageQuota, product.QuotaAction = quota, action
+	if err := db.Model(&product).Updates(map[string]any{"storage_quota": quota, "quota_action": action}).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// mtimeSlack allows for filesystems that store modification times coarsely
+const mtimeSlack = 2 * time.Second
+
+// orphanGrace is how long a file is left alone after it was modified, as a
+// download is moved into place before it's recorded as completed
+const orphanGrace = 15 * time.Minute
+
+// StoredFile is a downloaded file found changed by Reconcile
+type StoredFile struct {
+	FileID string `json:"fileId"`
+	Path   string `json:"path"`
+}
+
+// ReconcileReport lists where the download history and the downloads
+// directory disagree
+type ReconcileReport struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	// Missing are downloaded files no longer on disk
+	Missing []StoredFile `json:"missing"`
+	// Modified are downloaded files whose size or modification time changed
+	// after the download
+	Modified []StoredFile `json:"modified"`
+	// Orphaned are files under the downloads directory, relative to it, that
+	// no download entry points to
+	Orphaned []string `json:"orphaned"`
+	// Fixed is set if missing downloads were marked deleted and orphaned
+	// files removed
+	Fixed bool `json:"fixed"`
+}
+
+// Reconcile compares the completed downloads with the files under root. With
+// fix set, the downloads of missing files are marked deleted, like deleting
+// them through the API, so they can be downloaded again, and orphaned files
+// are removed. Modified files are only reported. Files modified within
+// orphanGrace of now, and those of the active downloads, aren't orphaned.
+func (db *DB) Reconcile(root string, fix bool, now time.Time, active []string) (*ReconcileReport, error) {
+	report := &ReconcileReport{
+		CheckedAt: now,
+		Missing:   []StoredFile{},
+		Modified:  []StoredFile{},
+		Orphaned:  []string{},
+		Fixed:     fix,
+	}
+
+	latest := db.Model(&DownloadEntry{}).Select("MAX(id)").
+		Where("status = ?", DownloadStatusCompleted).Group("file_id")
+	var entries []DownloadEntry
+	if err := db.Where("id IN (?) AND local_path <> ''", latest).Order("file_id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, e := range entries {
+		info, err := os.Stat(e.LocalPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			report.Missing = append(report.Missing, StoredFile{FileID: e.FileID, Path: e.LocalPath})
+			missing = append(missing, e.FileID)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if (e.Progress > 0 && info.Size() != e.Progress) ||
+			(e.CompletedAt != nil && info.ModTime().After(e.CompletedAt.Add(mtimeSlack))) {
+			report.Modified = append(report.Modified, StoredFile{FileID: e.FileID, Path: e.LocalPath})
+		}
+	}
+
+	// Any completed download counts as a reference, not only the latest, and
+	// so do quarantined files
+	var paths []string
+	if err := db.Model(&DownloadEntry{}).Where("status = ?", DownloadStatusCompleted).
+		Distinct().Pluck("local_path", &paths).Error; err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		referenced[filepath.Clean(p)] = true
+	}
+	var quarantined []string
+	if err := db.Model(&QuarantinedFile{}).Pluck("path", &quarantined).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range quarantined {
+		referenced[filepath.Join(root, QuarantineDir, p)] = true
+	}
+	// Downloads in progress write to a temp file next to the target, or in
+	// the blobs directory of the content-addressable layout, and identical
+	// ones are linked through a temp file
+	var downloading []File
+	query := db.Where("status = ?", FileStatusDownloading)
+	if len(active) > 0 {
+		query = query.Or("id IN ?", active)
+	}
+	if err := query.Find(&downloading).Error; err != nil {
+		return nil, err
+	}
+	for _, f := range downloading {
+		target := filepath.Join(root, f.SourceID, f.ProductID, f.FileName)
+		referenced[target] = true
+		referenced[target+".tmp"] = true
+		referenced[target+".link"] = true
+		referenced[filepath.Join(root, "blobs", "tmp", f.ID+".tmp")] = true
+	}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == root {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || referenced[filepath.Clean(path)] {
+			return nil
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(now.Add(-orphanGrace)) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		report.Orphaned = append(report.Orphaned, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !fix {
+		return report, nil
+	}
+	if len(missing) > 0 {
+		err := db.Model(&DownloadEntry{}).Where("file_id IN ? AND status = ?", missing, DownloadStatusCompleted).
+			Update("status", "deleted").Error
+		if err != nil {
+			return nil, err
+		}
+		if err := db.UpdateFileStatus(missing...); err != nil {
+			return nil, err
+		}
+	}
+	for _, rel := range report.Orphaned {
+		if err := os.Remove(filepath.Join(root, filepath.FromSlash(rel))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrRelocateMissing is returned by RelocateDownloads when downloaded files
+// aren't found at their new paths
+var ErrRelocateMissing = errors.New("downloaded files missing at the new location")
+
+// RelocateResult describes the download paths RelocateDownloads rewrote
+type RelocateResult struct {
+	// Updated counts the download entries whose path was rewritten
+	Updated int
+	// Missing are the new paths of completed downloads that don't exist
+	Missing []string
+}
+
+// RelocateDownloads rewrites the paths of download entries under oldRoot to
+// the same paths under newRoot, after the files were moved there. Unless
+// force is set, nothing is changed if completed downloads are missing at the
+// new paths; the result then lists them with ErrRelocateMissing. Relative
+// paths are resolved against the working directory, as the downloader does.
+func (db *DB) RelocateDownloads(oldRoot, newRoot string, force bool) (*RelocateResult, error) {
+	oldAbs, err := filepath.Abs(oldRoot)
+	if err != nil {
+		return nil, err
+	}
+	result := &RelocateResult{Missing: []string{}}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var entries []DownloadEntry
+		if err := tx.Select("id", "file_id", "status", "local_path").
+			Where("local_path <> ''").Find(&entries).Error; err != nil {
+			return err
+		}
+
+		var fileIDs []string
+		for _, e := range entries {
+			path, err := filepath.Abs(e.LocalPath)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(oldAbs, path)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			newPath := filepath.Join(newRoot, rel)
+			if e.Status == DownloadStatusCompleted {
+				if _, err := os.Stat(newPath); err != nil {
+					result.Missing = append(result.Missing, newPath)
+				}
+			}
+			if err := tx.Model(&DownloadEntry{}).Where("id = ?", e.ID).Update("local_path", newPath).Error; err != nil {
+				return err
+			}
+			result.Updated++
+			fileIDs = append(fileIDs, e.FileID)
+		}
+		if len(result.Missing) > 0 && !force {
+			return ErrRelocateMissing
+		}
+		slices.Sort(fileIDs)
+		return updateFileStatus(tx, slices.Compact(fileIDs))
+	})
+	if errors.Is(err, ErrRelocateMissing) {
+		result.Updated = 0
+		return result, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
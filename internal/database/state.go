@@ -0,0 +1,184 @@
+package database
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// State is a copy of every table, used to replicate a primary instance to a
+// standby
+type State struct {
+	ExportedAt       time.Time
+	Sources          []Source
+	Products         []Product
+	Deliveries       []Delivery
+	Files            []File
+	FileTags         []FileTag
+	FileMetadata     []FileMetadata
+	DownloadEntries  []DownloadEntry
+	Webhooks         []Webhook
+	Settings         []Setting
+	CatalogSnapshots []CatalogSnapshot
+	SyncRuns         []SyncRun
+}
+
+// localSettings are instance-specific and never replicated
+var localSettings = []string{SettingTelemetryID}
+
+// ExportState reads all tables in a single transaction so the copy is
+// consistent
+func (db *DB) ExportState() (*State, error) {
+	state := &State{ExportedAt: time.Now().UTC()}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, dest := range []any{
+			&state.Sources,
+			&state.Products,
+			&state.Deliveries,
+			&state.Files,
+			&state.FileTags,
+			&state.FileMetadata,
+			&state.DownloadEntries,
+			&state.Webhooks,
+			&state.CatalogSnapshots,
+			&state.SyncRuns,
+		} {
+			// Soft-deleted records are copied so they can still be undeleted
+			if err := tx.Unscoped().Find(dest).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("key NOT IN ?", localSettings).Find(&state.Settings).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("export state: %w", err)
+	}
+	return state, nil
+}
+
+// RestoreState replaces the contents of all tables with state. Local settings
+// such as the telemetry instance ID are kept.
+func (db *DB) RestoreState(state *State) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		all := tx.Unscoped().Session(&gorm.Session{AllowGlobalUpdate: true})
+		for _, model := range []any{
+			&SyncRun{},
+			&CatalogSnapshot{},
+			&DownloadEntry{},
+			&FileMetadata{},
+			&FileTag{},
+			&File{},
+			&Delivery{},
+			&Product{},
+			&Source{},
+			&Webhook{},
+		} {
+			if err := all.Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("key NOT IN ?", localSettings).Delete(&Setting{}).Error; err != nil {
+			return err
+		}
+
+		// GORM replaces a false Enabled with its column default on insert
+		var disabled []uint
+		for _, webhook := range state.Webhooks {
+			if !webhook.Enabled {
+				disabled = append(disabled, webhook.ID)
+			}
+		}
+
+		var settings []Setting
+		for _, setting := range state.Settings {
+			if !isLocalSetting(setting.Key) {
+				settings = append(settings, setting)
+			}
+		}
+
+		for _, insert := range []func(*gorm.DB) error{
+			func(tx *gorm.DB) error { return insertAll(tx, state.Sources) },
+			func(tx *gorm.DB) error { return insertAll(tx, state.Products) },
+			func(tx *gorm.DB) error { return insertAll(tx, state.Deliveries) },
+			func(tx *gorm.DB) error { return insertAll(tx, state.Files) },
+			func(tx *gorm.DB) error { return insertAll(tx, state.FileTags) },
+			func(tx *gorm.DB) error { return insertAll(tx, state.FileMetadata) },
+			func(tx *gorm.DB) error { return insertAll(tx, state.DownloadEntries) },
+			func(tx *gorm.DB) error { return insertAll(tx, state.Webhooks) },
+			func(tx *gorm.DB) error { return insertAll(tx, settings) },
+			func(tx *gorm.DB) error { return insertAll(tx, state.CatalogSnapshots) },
+			func(tx *gorm.DB) error { return insertAll(tx, state.SyncRuns) },
+		} {
+			if err := insert(tx); err != nil {
+				return err
+			}
+		}
+
+		if len(disabled) > 0 {
+			if err := tx.Model(&Webhook{}).Where("id IN ?", disabled).Update("enabled", false).Error; err != nil {
+				return err
+			}
+		}
+
+		return resetSequences(tx, []string{"download_entries", "webhooks", "catalog_snapshots", "sync_runs"})
+	})
+	if err != nil {
+		return fmt.Errorf("restore state: %w", err)
+	}
+	return nil
+}
+
+// FailInterruptedDownloads marks downloads that were in progress when the
+// process stopped (or when a standby was promoted) as failed
+func (db *DB) FailInterruptedDownloads(reason string) int64 {
+	var fileIDs []string
+	db.Model(&DownloadEntry{}).Where("status = ?", DownloadStatusDownloading).
+		Distinct().Pluck("file_id", &fileIDs)
+	result := db.Model(&DownloadEntry{}).
+		Where("status = ?", DownloadStatusDownloading).
+		Updates(map[string]interface{}{
+			"status":        DownloadStatusFailed,
+			"error_message": reason,
+		})
+	if err := db.UpdateFileStatus(fileIDs...); err != nil {
+		slog.Error("Failed to update file status", "error", err)
+	}
+	return result.RowsAffected
+}
+
+// insertAll inserts a copy of rows in batches without their associations, so
+// defaults GORM fills in don't leak back into the caller's state
+func insertAll[T any](tx *gorm.DB, rows []T) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	rows = append([]T(nil), rows...)
+	return tx.Omit(clause.Associations).CreateInBatches(rows, 500).Error
+}
+
+func isLocalSetting(key string) bool {
+	for _, local := range localSettings {
+		if key == local {
+			return true
+		}
+	}
+	return false
+}
+
+// resetSequences moves postgres ID sequences past the restored rows. SQLite
+// and MySQL do this automatically when IDs are inserted explicitly.
+func resetSequences(tx *gorm.DB, tables []string) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, table := range tables {
+		sql := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE((SELECT MAX(id) FROM %[1]s), 0) + 1, false)", table)
+		if err := tx.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExportRestoreState(t *testing.T) {
+	primary := setupTestDB(t)
+	now := time.Now()
+	primary.Create(&Source{ID: "epo", Name: "EPO", Enabled: true, CredentialsEnc: []byte("secret")})
+	primary.Create(&Product{ID: "p1", SourceID: "epo", AutoDownload: true})
+	primary.Create(&Delivery{ID: "d1", ProductID: "p1"})
+	primary.Create(&File{ID: "f1", DeliveryID: "d1", ProductID: "p1", SourceID: "epo", FileName: "a.zip"})
+	primary.Create(&DownloadEntry{FileID: "f1", Status: DownloadStatusCompleted, CompletedAt: &now})
+	primary.Create(&Webhook{Name: "hook", URL: "http://example.com", Events: `["*"]`})
+	primary.Model(&Webhook{}).Where("name = ?", "hook").Update("enabled", false)
+	primary.SetSetting(SettingEncryptionSalt, "salt")
+	primary.SetSetting(SettingTelemetryID, "primary-id")
+
+	state, err := primary.ExportState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range state.Settings {
+		if s.Key == SettingTelemetryID {
+			t.Error("ExportState() should not include the telemetry instance ID")
+		}
+	}
+
+	standby := setupTestDB(t)
+	standby.Create(&Source{ID: "stale"})
+	standby.SetSetting(SettingTelemetryID, "standby-id")
+
+	if err := standby.RestoreState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	var sources []Source
+	standby.Find(&sources)
+	if len(sources) != 1 || sources[0].ID != "epo" || string(sources[0].CredentialsEnc) != "secret" {
+		t.Errorf("sources after restore = %+v, want only epo with credentials", sources)
+	}
+	var file File
+	if err := standby.First(&file, "id = ?", "f1").Error; err != nil {
+		t.Errorf("file f1 not restored: %v", err)
+	}
+	var webhook Webhook
+	standby.First(&webhook)
+	if webhook.Enabled {
+		t.Error("disabled webhook was restored as enabled")
+	}
+	if salt, _ := standby.GetSetting(SettingEncryptionSalt); salt != "salt" {
+		t.Errorf("encryption salt = %q, want salt", salt)
+	}
+	if id, _ := standby.GetSetting(SettingTelemetryID); id != "standby-id" {
+		t.Errorf("telemetry ID = %q, want the standby's own", id)
+	}
+
+	// Restoring twice must not conflict with the rows of the first restore
+	if err := standby.RestoreState(state); err != nil {
+		t.Fatalf("second RestoreState() = %v", err)
+	}
+	webhook = Webhook{}
+	standby.First(&webhook)
+	if webhook.Enabled {
+		t.Error("disabled webhook was enabled by the second restore")
+	}
+	standby.Create(&DownloadEntry{FileID: "f1", Status: DownloadStatusPending})
+	var count int64
+	standby.Model(&DownloadEntry{}).Count(&count)
+	if count != 2 {
+		t.Errorf("download entries = %d, want 2", count)
+	}
+}
+
+func TestFailInterruptedDownloads(t *testing.T) {
+	db := setupTestDB(t)
+	db.Create(&DownloadEntry{FileID: "f1", Status: DownloadStatusDownloading})
+	db.Create(&DownloadEntry{FileID: "f2", Status: DownloadStatusCompleted})
+
+	if count := db.FailInterruptedDownloads("interrupted by failover"); count != 1 {
+		t.Errorf("FailInterruptedDownloads() = %d, want 1", count)
+	}
+	var entry DownloadEntry
+	db.First(&entry, "file_id = ?", "f1")
+	if entry.Status != DownloadStatusFailed || entry.ErrorMessage != "interrupted by failover" {
+		t.Errorf("entry = %+v, want failed with reason", entry)
+	}
+}
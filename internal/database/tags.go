@@ -0,0 +1,140 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidTag is returned for a tag that isn't a short lowercase word
+var ErrInvalidTag = errors.New("invalid tag")
+
+// ErrInvalidMetadata is returned for a file metadata key or value that
+// isn't accepted
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+var (
+	tagPattern         = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,49}$`)
+	metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+)
+
+const maxMetadataValue = 1024
+
+// NormalizeTags lowercases, sorts and deduplicates tags, and checks that
+// each is a short word
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("%w %q: use up to 50 lowercase letters, digits, '.', '_' and '-'", ErrInvalidTag, tag)
+		}
+		normalized = append(normalized, tag)
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
+
+// TagList returns the product's tags
+func (p *Product) TagList() []string {
+	var tags []string
+	json.Unmarshal([]byte(p.Tags), &tags)
+	return tags
+}
+
+// HasTags reports whether the product carries all the tags
+func (p *Product) HasTags(tags []string) bool {
+	own := p.TagList()
+	for _, tag := range tags {
+		if !slices.Contains(own, strings.ToLower(tag)) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetProductTags replaces the tags of a product. Tags are lowercased and
+// sorted, and duplicates are dropped.
+func (db *DB) SetProductTags(id string, tags []string) (*Product, error) {
+	normalized, err := NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	var product Product
+	if err := db.First(&product, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	product.Tags = ""
+	if len(normalized) > 0 {
+		b, _ := json.Marshal(normalized)
+		product.Tags = string(b)
+	}
+	if err := db.Model(&product).Update("tags", product.Tags).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// SetFileTags replaces the tags of a file, normalized like product tags
+func (db *DB) SetFileTags(fileID string, tags []string) error {
+	normalized, err := NormalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := fileExists(tx, fileID); err != nil {
+			return err
+		}
+		if err := tx.Where("file_id = ?", fileID).Delete(&FileTag{}).Error; err != nil {
+			return err
+		}
+		rows := make([]FileTag, 0, len(normalized))
+		for _, tag := range normalized {
+			rows = append(rows, FileTag{FileID: fileID, Tag: tag})
+		}
+		return insertAll(tx, rows)
+	})
+}
+
+// SetFileMetadata replaces the metadata of a file
+func (db *DB) SetFileMetadata(fileID string, metadata map[string]string) error {
+	rows := make([]FileMetadata, 0, len(metadata))
+	for key, value := range metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: key %q must be up to 64 letters, digits, '.', '_' and '-'", ErrInvalidMetadata, key)
+		}
+		if len(value) > maxMetadataValue {
+			return fmt.Errorf("%w: value of %q exceeds %d bytes", ErrInvalidMetadata, key, maxMetadataValue)
+		}
+		rows = append(rows, FileMetadata{FileID: fileID, Key: key, Value: value})
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := fileExists(tx, fileID); err != nil {
+			return err
+		}
+		if err := tx.Where("file_id = ?", fileID).Delete(&FileMetadata{}).Error; err != nil {
+			return err
+		}
+		return insertAll(tx, rows)
+	})
+}
+
+func fileExists(tx *gorm.DB, fileID string) error {
+	var count int64
+	if err := tx.Model(&File{}).Where("id = ?", fileID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is returned when there is no record to change
+	ErrNotFound = errors.New("not found")
+	// ErrProductDeleted is returned when undeleting a file of a deleted product
+	ErrProductDeleted = errors.New("the file's product is deleted; undelete the product first")
+)
+
+// DeleteProduct soft-deletes a product with its deliveries and files. They all
+// get the same deletion time, so UndeleteProduct can tell them apart from
+// files deleted earlier. It returns the IDs of the deleted files.
+func (db *DB) DeleteProduct(id string) ([]string, error) {
+	var fileIDs []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&Product{}).Where("id = ?", id).Update("deleted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if err := tx.Model(&File{}).Where("product_id = ?", id).Pluck("id", &fileIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&File{}).Where("product_id = ?", id).Update("deleted_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Delivery{}).Where("product_id = ?", id).Update("deleted_at", now).Error
+	})
+	return fileIDs, err
+}
+
+// UndeleteProduct restores a deleted product with the deliveries and files
+// deleted along with it
+func (db *DB) UndeleteProduct(id string) (*Product, error) {
+	var product Product
+	err := db.Transaction(func(tx *gorm.DB) error {
+		tx = tx.Unscoped().Session(&gorm.Session{})
+		if err := tx.Where("id = ? AND deleted_at IS NOT NULL", id).First(&product).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+		deletedAt := tx.Model(&Product{}).Select("deleted_at").Where("id = ?", id)
+		for _, model := range []any{&File{}, &Delivery{}} {
+			err := tx.Model(model).Where("product_id = ? AND deleted_at = (?)", id, deletedAt).
+				Update("deleted_at", nil).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&product).Update("deleted_at", nil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// DeleteFile soft-deletes a file from the catalog
+func (db *DB) DeleteFile(id string) error {
+	result := db.Where("id = ?", id).Delete(&File{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UndeleteFile restores a file deleted from the catalog. Files of a deleted
+// product are restored with the product.
+func (db *DB) UndeleteFile(id string) error {
+	var file File
+	if err := db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&file).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if db.IsDeleted(&Product{}, file.ProductID) {
+		return ErrProductDeleted
+	}
+	return db.Unscoped().Model(&file).Update("deleted_at", nil).Error
+}
+
+// IsDeleted reports whether the record of the model with the ID was
+// soft-deleted. Syncs use it to leave deleted records alone.
+func (db *DB) IsDeleted(model any, id string) bool {
+	var count int64
+	db.Unscoped().Model(model).Where("id = ? AND deleted_at IS NOT NULL", id).Count(&count)
+	return count > 0
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestDeleteAndUndeleteProduct(t *testing.T) {
+	db := setupTestDB(t)
+	db.Create(&Product{ID: "p1", SourceID: "epo", Name: "DOCDB"})
+	db.Create(&Delivery{ID: "d1", ProductID: "p1"})
+	db.Create(&File{ID: "f1", DeliveryID: "d1", ProductID: "p1"})
+	db.Create(&File{ID: "f2", DeliveryID: "d1", ProductID: "p1"})
+
+	// f2 was deleted on its own before the product
+	if err := db.DeleteFile("f2"); err != nil {
+		t.Fatal(err)
+	}
+
+	fileIDs, err := db.DeleteProduct("p1")
+	if err != nil || !slices.Equal(fileIDs, []string{"f1"}) {
+		t.Fatalf("DeleteProduct = %v, %v, want f1", fileIDs, err)
+	}
+	var count int64
+	db.Model(&File{}).Count(&count)
+	if count != 0 || !db.IsDeleted(&Product{}, "p1") || !db.IsDeleted(&Delivery{}, "d1") {
+		t.Errorf("product, delivery or %d files still visible", count)
+	}
+	if _, err := db.DeleteProduct("p1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting a deleted product = %v, want ErrNotFound", err)
+	}
+	if err := db.UndeleteFile("f1"); !errors.Is(err, ErrProductDeleted) {
+		t.Errorf("UndeleteFile of a deleted product's file = %v, want ErrProductDeleted", err)
+	}
+
+	product, err := db.UndeleteProduct("p1")
+	if err != nil || product.ID != "p1" {
+		t.Fatalf("UndeleteProduct = %v, %v", product, err)
+	}
+	if db.IsDeleted(&Product{}, "p1") || db.IsDeleted(&Delivery{}, "d1") || db.IsDeleted(&File{}, "f1") {
+		t.Error("product, delivery and f1 should be restored")
+	}
+	if !db.IsDeleted(&File{}, "f2") {
+		t.Error("f2 was deleted separately and should stay deleted")
+	}
+	if err := db.UndeleteFile("f2"); err != nil || db.IsDeleted(&File{}, "f2") {
+		t.Errorf("UndeleteFile(f2) = %v", err)
+	}
+	if _, err := db.UndeleteProduct("p1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("undeleting a product that isn't deleted = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ValidatorList returns the checks the product's downloaded files must pass
+func (p *Product) ValidatorList() []string {
+	var validators []string
+	json.Unmarshal([]byte(p.Validators), &validators)
+	return validators
+}
+
+// SetProductValidators replaces the checks the product's downloaded files
+// must pass; see the validate package for the syntax
+func (db *DB) SetProductValidators(id string, validators []string) (*Product, error) {
+	var product Product
+	if err := db.First(&product, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	product.Validators = ""
+	if len(validators) > 0 {
+		b, _ := json.Marshal(validators)
+		product.Validators = string(b)
+	}
+	if err := db.Model(&product).Update("validators", product.Validators).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
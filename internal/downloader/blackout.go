@@ -0,0 +1,141 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/blackout"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// blackoutRecheck bounds each wait for a blackout to end or a download window
+// to open, so a reloaded configuration or changed product window takes effect
+const blackoutRecheck = time.Minute
+
+// SetBlackout sets the periods in which no downloads start. Running
+// downloads continue; queued ones wait for the period to end.
+func (d *Downloader) SetBlackout(schedule blackout.Schedule) {
+	d.limitsMu.Lock()
+	defer d.limitsMu.Unlock()
+	d.blackout = schedule
+}
+
+// SetDownloadWindow sets the periods outside of which no downloads start, for
+// products without a window of their own. Running downloads continue; queued
+// ones wait for the window to open.
+func (d *Downloader) SetDownloadWindow(schedule blackout.Schedule) {
+	d.limitsMu.Lock()
+	defer d.limitsMu.Unlock()
+	d.window = schedule
+}
+
+// SetDeferClosed sets whether downloads that can't start, in a blackout,
+// outside the download window or over a storage quota, are paused with
+// ErrDownloadDeferred right away instead of waiting. Single runs under an
+// external scheduler use it so they don't block; ResumePaused picks the
+// downloads up again.
+func (d *Downloader) SetDeferClosed(deferClosed bool) {
+	d.limitsMu.Lock()
+	defer d.limitsMu.Unlock()
+	d.deferClosed = deferClosed
+}
+
+// closedUntil reports why the file's download can't start at t, empty if it
+// can, and until when: the end of a blackout, the next check of the storage
+// quotas or the next opening of the product's download window, or the global
+// one
+func (d *Downloader) closedUntil(t time.Time, file *database.File) (time.Time, string) {
+	d.limitsMu.RLock()
+	outage, window := d.blackout, d.window
+	d.limitsMu.RUnlock()
+
+	if end, ok := outage.End(t); ok {
+		return end, "blackout"
+	}
+	if d.quotaExceeded() {
+		return t.Add(blackoutRecheck), "storage quota"
+	}
+	var product database.Product
+	d.db.Select("id", "download_window", "storage_quota").First(&product, "id = ?", file.ProductID)
+	if d.productQuotaExceeded(&product, file) {
+		return t.Add(blackoutRecheck), "product quota"
+	}
+	if productWindow := productWindow(&product); productWindow != nil {
+		window = productWindow
+	}
+	if len(window) == 0 || window.Contains(t) {
+		return time.Time{}, ""
+	}
+	next, _ := window.Next(t)
+	return next, "download window"
+}
+
+// productWindow returns the product's own download window, nil if it has none
+func productWindow(product *database.Product) blackout.Schedule {
+	if product.DownloadWindow == "" {
+		return nil
+	}
+	window, err := blackout.Parse(product.DownloadWindow)
+	if err != nil {
+		slog.Error("Invalid download window", "productID", product.ID, "error", err)
+		return nil
+	}
+	return window
+}
+
+// acquire takes a download slot outside blackout periods and inside the
+// download window. Waiting for a slot may reach past either, so they are
+// checked again once the slot is taken.
+func (d *Downloader) acquire(ctx context.Context, file *database.File, semaphore chan struct{}) error {
+	for {
+		if err := d.waitOpen(ctx, file); err != nil {
+			return err
+		}
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if _, reason := d.closedUntil(time.Now(), file); reason == "" {
+			return nil
+		}
+		<-semaphore
+	}
+}
+
+// waitOpen returns once no blackout period is active and the download window
+// is open
+func (d *Downloader) waitOpen(ctx context.Context, file *database.File) error {
+	until, reason := d.closedUntil(time.Now(), file)
+	if reason == "" {
+		return nil
+	}
+	d.limitsMu.RLock()
+	deferClosed := d.deferClosed
+	d.limitsMu.RUnlock()
+	if deferClosed {
+		slog.Info("Download deferred", "fileID", file.ID, "reason", reason, "until", until)
+		return fmt.Errorf("%w: %s", ErrDownloadDeferred, reason)
+	}
+	slog.Info("Download waiting", "fileID", file.ID, "reason", reason, "until", until)
+
+	for reason != "" {
+		timer := time.NewTimer(min(time.Until(until), blackoutRecheck))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		until, reason = d.closedUntil(time.Now(), file)
+		// The quota or its action may have changed while waiting
+		if reason == "product quota" {
+			if err := d.skipOverQuota(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
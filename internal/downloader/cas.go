@@ -0,0 +1,52 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// blobsDir holds the files of the content-addressable layout
+const blobsDir = "blobs"
+
+func (d *Downloader) casLayout() bool {
+	return d.cfg.StorageLayout == config.LayoutCAS
+}
+
+// BlobPath returns where the content-addressable layout under root stores
+// content with the hex SHA-256 digest. Two levels of subdirectories keep
+// directories small in very large archives.
+func BlobPath(root, digest string) string {
+	return filepath.Join(root, blobsDir, "sha256", digest[:2], digest[2:4], digest)
+}
+
+// tempPath returns the file a download is written to before it is complete
+func (d *Downloader) tempPath(file *database.File) string {
+	if d.casLayout() {
+		return filepath.Join(d.cfg.DownloadsPath(), blobsDir, "tmp", file.ID+".tmp")
+	}
+	return d.getDownloadPath(file) + ".tmp"
+}
+
+// storeBlob moves a completed download to its blob. If the blob is already
+// stored, the download is dropped and the ID of a file stored in it is
+// returned as well.
+func (d *Downloader) storeBlob(fileID, tempPath, digest string) (string, string, error) {
+	path := BlobPath(d.cfg.DownloadsPath(), digest)
+	if _, err := os.Stat(path); err == nil {
+		os.Remove(tempPath)
+		var stored database.DownloadEntry
+		d.db.Select("file_id").Where("status = ? AND local_path = ? AND file_id <> ?",
+			database.DownloadStatusCompleted, path, fileID).First(&stored)
+		return path, stored.FileID, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", "", err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return "", "", err
+	}
+	return path, "", nil
+}
@@ -0,0 +1,100 @@
+package downloader
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// dedupCandidates bounds the stored downloads checked for an identical file
+const dedupCandidates = 10
+
+// SetDedup sets whether downloads identical to a stored file are hard linked
+// to it instead of kept as another copy
+func (d *Downloader) SetDedup(enabled bool) {
+	d.limitsMu.Lock()
+	defer d.limitsMu.Unlock()
+	d.dedup = enabled
+}
+
+func (d *Downloader) dedupEnabled() bool {
+	d.limitsMu.RLock()
+	defer d.limitsMu.RUnlock()
+	return d.dedup
+}
+
+// findStored returns the completed download of another file with the same
+// expected checksum and size that is still on disk, so the file needn't be
+// transferred again. The content-addressable layout always deduplicates.
+func (d *Downloader) findStored(file *database.File) *database.DownloadEntry {
+	if !d.dedupEnabled() && !d.casLayout() || file.ExpectedChecksum == "" || file.FileSize <= 0 {
+		return nil
+	}
+	var entries []database.DownloadEntry
+	err := d.db.Joins("JOIN files ON files.id = download_entries.file_id").
+		Where("download_entries.status = ? AND download_entries.file_id <> ?", database.DownloadStatusCompleted, file.ID).
+		Where("files.expected_checksum = ? AND files.checksum_algorithm = ? AND files.file_size = ?",
+			file.ExpectedChecksum, file.ChecksumAlgorithm, file.FileSize).
+		Order("download_entries.id DESC").Limit(dedupCandidates).Find(&entries).Error
+	if err != nil {
+		slog.Error("Failed to look up identical downloads", "fileID", file.ID, "error", err)
+		return nil
+	}
+	for i, e := range entries {
+		if info, err := os.Stat(e.LocalPath); err == nil && info.Size() == file.FileSize {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// linkIdentical replaces a downloaded file with a hard link to an identical
+// file stored before and returns that file's ID, or "" if there is none
+func (d *Downloader) linkIdentical(fileID, path, checksum string) string {
+	if !d.dedupEnabled() {
+		return ""
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	var entries []database.DownloadEntry
+	err = d.db.Where("status = ? AND file_id <> ? AND local_checksum = ?",
+		database.DownloadStatusCompleted, fileID, checksum).
+		Order("id DESC").Limit(dedupCandidates).Find(&entries).Error
+	if err != nil {
+		slog.Error("Failed to look up identical downloads", "fileID", fileID, "error", err)
+		return ""
+	}
+	for _, e := range entries {
+		stored, err := os.Stat(e.LocalPath)
+		if err != nil || stored.Size() != info.Size() {
+			continue
+		}
+		if os.SameFile(stored, info) {
+			return e.FileID
+		}
+		if err := linkFile(e.LocalPath, path); err != nil {
+			// Links can't cross filesystems; keep the copy
+			slog.Debug("Failed to link identical download", "fileID", fileID, "path", e.LocalPath, "error", err)
+			return ""
+		}
+		return e.FileID
+	}
+	return ""
+}
+
+// linkFile replaces target with a hard link to source
+func linkFile(source, target string) error {
+	tmp := target + ".link"
+	os.Remove(tmp)
+	if err := os.Link(source, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
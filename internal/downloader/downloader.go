@@ -10,21 +10,37 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/blackout"
 	"github.com/patent-dev/bulk-file-loader/internal/database"
 	"github.com/patent-dev/bulk-file-loader/internal/hooks"
 	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/workpool"
 )
 
 var (
 	ErrDownloadInProgress = errors.New("download already in progress")
 	ErrFileNotFound       = errors.New("file not found")
 	ErrSourceNotFound     = errors.New("source not found")
+	ErrShuttingDown       = errors.New("downloader is shutting down")
+	// ErrWindowClosed is the cancel cause of auto-downloads that run into the
+	// end of their product's check window
+	ErrWindowClosed = errors.New("check window closed")
+	// ErrDownloadDeferred is returned for downloads paused instead of
+	// waiting, see SetDeferClosed
+	ErrDownloadDeferred = errors.New("download deferred")
 )
 
+// interruptedMessage is recorded on downloads checkpointed by Drain
+const interruptedMessage = "interrupted by shutdown"
+
+// pausedMessage is recorded on downloads waiting for the check window to open
+const pausedMessage = "paused until the check window opens"
+
 // Downloader manages file downloads
 type Downloader struct {
 	db       *database.DB
@@ -32,25 +48,75 @@ type Downloader struct {
 	hooks    *hooks.Manager
 	cfg      *config.Config
 
+	limitsMu  sync.RWMutex
 	semaphore chan struct{}
-	progress  *ProgressTracker
-	active    sync.Map // fileID -> cancelFunc
+	timeouts  TimeoutPolicy
+	blackout  blackout.Schedule
+	// window is the global download window, see blackout.go
+	window blackout.Schedule
+	// deferClosed pauses downloads that can't start instead of waiting
+	deferClosed bool
+	// quota bounds the bytes stored, see quota.go
+	quota int64
+	// latestLinks enables UpdateLatest
+	latestLinks bool
+	latestMu    sync.Mutex
+	// dedup enables linking identical downloads, see dedup.go
+	dedup bool
+	// postProcess runs validation, see validate.go
+	postProcess *workpool.Pool
+
+	// quotaMu guards the cached storage usage, see quota.go
+	quotaMu        sync.Mutex
+	usage          int64
+	usageCheckedAt time.Time
+	overQuota      bool
+
+	progress *ProgressTracker
+	active   sync.Map // fileID -> context.CancelCauseFunc
+	// pipelines holds the running pipelines, see pipeline.go
+	pipelines sync.Map // fileID -> context.CancelCauseFunc
+
+	// drainMu orders Download's running.Add before Drain's running.Wait
+	drainMu      sync.RWMutex
+	running      sync.WaitGroup
+	shuttingDown bool
 }
 
 // New creates a new downloader
 func New(db *database.DB, registry *sources.Registry, hooks *hooks.Manager, cfg *config.Config) *Downloader {
 	return &Downloader{
-		db:        db,
-		registry:  registry,
-		hooks:     hooks,
-		cfg:       cfg,
-		semaphore: make(chan struct{}, cfg.MaxConcurrent),
-		progress:  NewProgressTracker(),
+		db:          db,
+		registry:    registry,
+		hooks:       hooks,
+		cfg:         cfg,
+		semaphore:   make(chan struct{}, cfg.MaxConcurrent),
+		timeouts:    NewTimeoutPolicy(cfg),
+		blackout:    cfg.Blackout,
+		window:      cfg.DownloadWindow,
+		quota:       int64(cfg.StorageQuotaGB) << 30,
+		latestLinks: cfg.LatestLinks,
+		dedup:       cfg.Dedup,
+		progress:    NewProgressTracker(),
 	}
 }
 
 // Download starts downloading a file
 func (d *Downloader) Download(ctx context.Context, fileID string) error {
+	d.drainMu.RLock()
+	if d.shuttingDown {
+		d.drainMu.RUnlock()
+		return ErrShuttingDown
+	}
+	d.running.Add(1)
+	d.drainMu.RUnlock()
+	defer d.running.Done()
+
+	return d.download(ctx, fileID)
+}
+
+// download runs a download that is already counted in running
+func (d *Downloader) download(ctx context.Context, fileID string) error {
 	// Check if already downloading
 	if _, exists := d.active.Load(fileID); exists {
 		return ErrDownloadInProgress
@@ -68,23 +134,48 @@ func (d *Downloader) Download(ctx context.Context, fileID string) error {
 		return ErrSourceNotFound
 	}
 
-	// Create cancellable context
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(d.cfg.DownloadTimeout)*time.Second)
+	if err := d.skipOverQuota(&file); err != nil {
+		return err
+	}
+
+	// Limits are captured once so a reconfiguration doesn't affect this download
+	semaphore, timeouts := d.limits()
+	timeout := timeouts.For(file.FileSize)
+
+	// Create cancellable context; the cause tells a user cancel from a shutdown
+	ctx, cancel := context.WithCancelCause(ctx)
 
 	// Store cancel func
 	d.active.Store(fileID, cancel)
 	defer func() {
 		d.active.Delete(fileID)
-		cancel()
+		cancel(nil)
 	}()
 
-	// Acquire semaphore
-	select {
-	case d.semaphore <- struct{}{}:
-		defer func() { <-d.semaphore }()
-	case <-ctx.Done():
-		return ctx.Err()
+	// Acquire semaphore outside blackout periods and inside the download window
+	if err := d.acquire(ctx, &file, semaphore); err != nil {
+		switch cause := context.Cause(ctx); {
+		case errors.Is(cause, ErrShuttingDown):
+			// Queued downloads are checkpointed too so they resume on next start
+			d.db.Create(&database.DownloadEntry{
+				FileID:       fileID,
+				Status:       database.DownloadStatusInterrupted,
+				ErrorMessage: interruptedMessage,
+			})
+			d.updateFileStatus(fileID)
+		case errors.Is(cause, ErrWindowClosed):
+			d.MarkPaused(fileID)
+			return ErrWindowClosed
+		case errors.Is(err, ErrDownloadDeferred):
+			d.MarkPaused(fileID)
+		}
+		return err
 	}
+	defer func() { <-semaphore }()
+
+	// The timeout covers the transfer, not the time spent queued
+	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	defer cancelTimeout()
 
 	// Create download entry
 	now := time.Now()
@@ -96,18 +187,37 @@ func (d *Downloader) Download(ctx context.Context, fileID string) error {
 	if err := d.db.Create(entry).Error; err != nil {
 		return fmt.Errorf("failed to create download entry: %w", err)
 	}
+	d.updateFileStatus(fileID)
 
 	// Emit download started event
 	d.emitEvent(hooks.EventDownloadStarted, &file, nil)
 
 	// Prepare download path
 	downloadPath := d.getDownloadPath(&file)
-	if err := os.MkdirAll(filepath.Dir(downloadPath), 0755); err != nil {
+	tempPath := d.tempPath(&file)
+	if err := os.MkdirAll(filepath.Dir(tempPath), 0755); err != nil {
 		return d.handleError(entry, &file, "FILESYSTEM_ERROR", "Failed to create directory", err)
 	}
 
+	// A stored file with the same checksum saves the transfer
+	if stored := d.findStored(&file); stored != nil {
+		// Blobs are shared as they are, other layouts get a link
+		path, err := stored.LocalPath, error(nil)
+		if !d.casLayout() {
+			path, err = downloadPath, linkFile(stored.LocalPath, downloadPath)
+		}
+		if err == nil {
+			entry.Progress = file.FileSize
+			entry.TotalBytes = file.FileSize
+			entry.DuplicateOf = stored.FileID
+			slog.Info("Linked identical download", "fileID", fileID, "duplicateOf", stored.FileID)
+			return d.complete(entry, &file, path, stored.LocalChecksum)
+		}
+		// Links can't cross filesystems; download another copy
+		slog.Debug("Failed to link identical download", "fileID", fileID, "path", stored.LocalPath, "error", err)
+	}
+
 	// Create temp file
-	tempPath := downloadPath + ".tmp"
 	tempFile, err := os.Create(tempPath)
 	if err != nil {
 		return d.handleError(entry, &file, "FILESYSTEM_ERROR", "Failed to create temp file", err)
@@ -117,9 +227,13 @@ func (d *Downloader) Download(ctx context.Context, fileID string) error {
 	d.progress.Start(fileID, file.FileName, file.FileSize)
 	defer d.progress.Complete(fileID)
 
-	// Create hash writer for checksum
+	// Create hash writers for the local checksum and the expected one
 	hasher := sha256.New()
 	writer := io.MultiWriter(tempFile, hasher)
+	expected := checksumHasher(file.ChecksumAlgorithm)
+	if expected != nil {
+		writer = io.MultiWriter(tempFile, hasher, expected)
+	}
 
 	// Download file
 	fileInfo := sources.FileInfo{
@@ -142,24 +256,68 @@ func (d *Downloader) Download(ctx context.Context, fileID string) error {
 
 	tempFile.Close()
 
+	// Checksum and validation failures are quarantined. Validation runs
+	// before the file is moved into place, so a cancel or shutdown meanwhile
+	// is handled like one during the transfer.
+	digest := hex.EncodeToString(hasher.Sum(nil))
+	sums := map[string]string{"sha256": digest}
+	if expected != nil {
+		sums[strings.ToLower(file.ChecksumAlgorithm)] = hex.EncodeToString(expected.Sum(nil))
+	}
+	var mismatch, invalid error
+	if err == nil {
+		mismatch = verifyChecksum(&file, sums)
+	}
+	if err == nil && mismatch == nil {
+		invalid = d.validate(ctx, &file, tempPath)
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}
+
 	if err != nil {
 		os.Remove(tempPath)
+		if errors.Is(context.Cause(ctx), ErrShuttingDown) {
+			return d.handleInterrupted(entry, &file)
+		}
+		if errors.Is(context.Cause(ctx), ErrWindowClosed) {
+			return d.handlePaused(entry, &file)
+		}
 		if ctx.Err() == context.Canceled {
 			return d.handleCancelled(entry, &file)
 		}
 		return d.handleError(entry, &file, "DOWNLOAD_ERROR", "Download failed", err)
 	}
 
+	localChecksum := "sha256:" + digest
+	if mismatch != nil {
+		return d.quarantine(entry, &file, tempPath, localChecksum, database.QuarantineChecksum, mismatch)
+	}
+	if invalid != nil {
+		return d.quarantine(entry, &file, tempPath, localChecksum, database.QuarantineValidation, invalid)
+	}
+
+	if d.casLayout() {
+		downloadPath, entry.DuplicateOf, err = d.storeBlob(fileID, tempPath, digest)
+		if err != nil {
+			os.Remove(tempPath)
+			return d.handleError(entry, &file, "FILESYSTEM_ERROR", "Failed to move file", err)
+		}
+		return d.complete(entry, &file, downloadPath, localChecksum)
+	}
+
 	// Move temp file to final location
 	if err := os.Rename(tempPath, downloadPath); err != nil {
 		os.Remove(tempPath)
 		return d.handleError(entry, &file, "FILESYSTEM_ERROR", "Failed to move file", err)
 	}
+	entry.DuplicateOf = d.linkIdentical(fileID, downloadPath, localChecksum)
 
-	// Calculate checksum
-	localChecksum := "sha256:" + hex.EncodeToString(hasher.Sum(nil))
+	return d.complete(entry, &file, downloadPath, localChecksum)
+}
 
-	// Update download entry
+// complete records a finished download
+func (d *Downloader) complete(entry *database.DownloadEntry, file *database.File, downloadPath, localChecksum string) error {
 	completedAt := time.Now()
 	entry.Status = database.DownloadStatusCompleted
 	entry.LocalPath = downloadPath
@@ -168,27 +326,193 @@ func (d *Downloader) Download(ctx context.Context, fileID string) error {
 	if err := d.db.Save(entry).Error; err != nil {
 		slog.Error("Failed to update download entry", "error", err)
 	}
+	d.updateFileStatus(file.ID)
+	d.UpdateLatest(file.SourceID, file.ProductID)
+	d.resetUsage()
 
-	d.emitCompletedEvent(&file, downloadPath, localChecksum, nil)
+	d.emitCompletedEvent(file, downloadPath, localChecksum, nil)
 
-	slog.Info("Download completed", "fileID", fileID, "path", downloadPath)
+	slog.Info("Download completed", "fileID", file.ID, "path", downloadPath)
+	d.startPipeline(file, downloadPath)
 	return nil
 }
 
+// Reconfigure changes the concurrency limit and timeouts for downloads
+// started afterwards. Active downloads keep running with their previous limits.
+func (d *Downloader) Reconfigure(maxConcurrent int, timeouts TimeoutPolicy) {
+	d.limitsMu.Lock()
+	defer d.limitsMu.Unlock()
+
+	if maxConcurrent != cap(d.semaphore) {
+		d.semaphore = make(chan struct{}, maxConcurrent)
+	}
+	d.timeouts = timeouts
+}
+
+func (d *Downloader) limits() (chan struct{}, TimeoutPolicy) {
+	d.limitsMu.RLock()
+	defer d.limitsMu.RUnlock()
+	return d.semaphore, d.timeouts
+}
+
 // Cancel cancels an in-progress download
 func (d *Downloader) Cancel(fileID string) error {
 	if cancelFunc, ok := d.active.Load(fileID); ok {
-		cancelFunc.(context.CancelFunc)()
+		cancelFunc.(context.CancelCauseFunc)(nil)
 		return nil
 	}
 	return ErrFileNotFound
 }
 
+// Drain stops accepting new downloads and waits for active and queued ones,
+// and their pipelines, to finish. Downloads still running when ctx is done
+// are cancelled and recorded as interrupted so ResumeInterrupted restarts
+// them on the next start; pipelines are cancelled. It returns the number of
+// interrupted downloads.
+func (d *Downloader) Drain(ctx context.Context) int {
+	d.drainMu.Lock()
+	d.shuttingDown = true
+	d.drainMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return 0
+	case <-ctx.Done():
+	}
+
+	interrupted := 0
+	d.active.Range(func(_, cancelFunc any) bool {
+		cancelFunc.(context.CancelCauseFunc)(ErrShuttingDown)
+		interrupted++
+		return true
+	})
+	d.pipelines.Range(func(_, cancelFunc any) bool {
+		cancelFunc.(context.CancelCauseFunc)(ErrShuttingDown)
+		return true
+	})
+	<-done
+	return interrupted
+}
+
+// ResumeInterrupted starts the downloads that Drain interrupted during the
+// previous shutdown and returns how many were restarted. Downloads start from
+// the beginning.
+func (d *Downloader) ResumeInterrupted() int {
+	var entries []database.DownloadEntry
+	if err := d.db.Where("status = ?", database.DownloadStatusInterrupted).Find(&entries).Error; err != nil {
+		slog.Error("Failed to load interrupted downloads", "error", err)
+		return 0
+	}
+	if len(entries) == 0 {
+		return 0
+	}
+
+	// Keep the entries as history but don't resume them again
+	d.db.Model(&database.DownloadEntry{}).
+		Where("status = ?", database.DownloadStatusInterrupted).
+		Updates(map[string]interface{}{
+			"status":        database.DownloadStatusFailed,
+			"error_message": interruptedMessage + ", resumed on restart",
+		})
+	for _, entry := range entries {
+		d.updateFileStatus(entry.FileID)
+	}
+
+	resumed := make(map[string]bool)
+	for _, entry := range entries {
+		if resumed[entry.FileID] {
+			continue
+		}
+		resumed[entry.FileID] = true
+
+		// Count the download as running before it starts so Drain waits for it
+		d.drainMu.RLock()
+		d.running.Add(1)
+		d.drainMu.RUnlock()
+		go func(fileID string) {
+			defer d.running.Done()
+			if err := d.download(context.Background(), fileID); err != nil && !errors.Is(err, context.Canceled) {
+				slog.Error("Resumed download failed", "fileID", fileID, "error", err)
+			}
+		}(entry.FileID)
+	}
+	slog.Info("Resuming interrupted downloads", "count", len(resumed))
+	return len(resumed)
+}
+
+// MarkPaused records a download that waits for the product's check window
+// to open. ResumePaused picks it up again.
+func (d *Downloader) MarkPaused(fileID string) error {
+	err := d.db.Create(&database.DownloadEntry{
+		FileID:       fileID,
+		Status:       database.DownloadStatusPaused,
+		ErrorMessage: pausedMessage,
+	}).Error
+	if err != nil {
+		return err
+	}
+	d.updateFileStatus(fileID)
+	return nil
+}
+
+// ResumePaused returns the IDs of the product's paused downloads for the
+// caller to start again. The paused entries are kept as history.
+func (d *Downloader) ResumePaused(productID string) []string {
+	paused := d.db.Where("status = ? AND file_id IN (?)", database.DownloadStatusPaused,
+		d.db.Model(&database.File{}).Select("id").Where("product_id = ?", productID))
+
+	var fileIDs []string
+	if err := paused.Model(&database.DownloadEntry{}).Distinct().Pluck("file_id", &fileIDs).Error; err != nil {
+		slog.Error("Failed to load paused downloads", "productID", productID, "error", err)
+		return nil
+	}
+	if len(fileIDs) == 0 {
+		return nil
+	}
+
+	d.db.Model(&database.DownloadEntry{}).
+		Where("status = ? AND file_id IN ?", database.DownloadStatusPaused, fileIDs).
+		Updates(map[string]interface{}{
+			"status":        database.DownloadStatusFailed,
+			"error_message": pausedMessage + ", resumed",
+		})
+	d.updateFileStatus(fileIDs...)
+	slog.Info("Resuming paused downloads", "productID", productID, "count", len(fileIDs))
+	return fileIDs
+}
+
+// IsActive reports whether a download for the file is queued or running
+func (d *Downloader) IsActive(fileID string) bool {
+	_, ok := d.active.Load(fileID)
+	return ok
+}
+
+// ActiveIDs returns the IDs of the files with a queued or running download
+func (d *Downloader) ActiveIDs() []string {
+	var ids []string
+	d.active.Range(func(key, _ any) bool {
+		ids = append(ids, key.(string))
+		return true
+	})
+	return ids
+}
+
 // ActiveDownloads returns progress for all active downloads
 func (d *Downloader) ActiveDownloads() []DownloadProgress {
 	return d.progress.GetAll()
 }
 
+// DownloadsPath returns the directory downloads are stored under
+func (d *Downloader) DownloadsPath() string {
+	return d.cfg.DownloadsPath()
+}
+
 // GetProgress returns progress for a specific download
 func (d *Downloader) GetProgress(fileID string) *DownloadProgress {
 	return d.progress.Get(fileID)
@@ -208,6 +532,7 @@ func (d *Downloader) handleError(entry *database.DownloadEntry, file *database.F
 	entry.Status = database.DownloadStatusFailed
 	entry.ErrorMessage = fmt.Sprintf("%s: %v", message, err)
 	d.db.Save(entry)
+	d.updateFileStatus(entry.FileID)
 
 	event := hooks.NewEvent(hooks.EventDownloadFailed, file.SourceID).
 		WithFile(file.ID, file.FileName, file.FileSize, "", "").
@@ -220,6 +545,7 @@ func (d *Downloader) handleError(entry *database.DownloadEntry, file *database.F
 func (d *Downloader) handleCancelled(entry *database.DownloadEntry, file *database.File) error {
 	entry.Status = database.DownloadStatusCancelled
 	d.db.Save(entry)
+	d.updateFileStatus(entry.FileID)
 
 	event := hooks.NewEvent(hooks.EventDownloadCancelled, file.SourceID).
 		WithFile(file.ID, file.FileName, file.FileSize, "", "")
@@ -228,6 +554,38 @@ func (d *Downloader) handleCancelled(entry *database.DownloadEntry, file *databa
 	return context.Canceled
 }
 
+// handleInterrupted records a download cancelled by Drain. No event is
+// emitted since the download resumes on the next start.
+func (d *Downloader) handleInterrupted(entry *database.DownloadEntry, file *database.File) error {
+	entry.Status = database.DownloadStatusInterrupted
+	entry.ErrorMessage = interruptedMessage
+	d.db.Save(entry)
+	d.updateFileStatus(entry.FileID)
+
+	slog.Info("Download interrupted by shutdown", "fileID", file.ID, "progress", entry.Progress)
+	return ErrShuttingDown
+}
+
+// handlePaused records a download stopped at the end of the check window. No
+// event is emitted since the download resumes when the window opens again.
+func (d *Downloader) handlePaused(entry *database.DownloadEntry, file *database.File) error {
+	entry.Status = database.DownloadStatusPaused
+	entry.ErrorMessage = pausedMessage
+	d.db.Save(entry)
+	d.updateFileStatus(entry.FileID)
+
+	slog.Info("Download paused by check window", "fileID", file.ID, "progress", entry.Progress)
+	return ErrWindowClosed
+}
+
+// updateFileStatus refreshes the status column of files whose latest
+// download entry changed
+func (d *Downloader) updateFileStatus(fileIDs ...string) {
+	if err := d.db.UpdateFileStatus(fileIDs...); err != nil {
+		slog.Error("Failed to update file status", "fileIDs", fileIDs, "error", err)
+	}
+}
+
 func (d *Downloader) emitEvent(eventType string, file *database.File, alerts []hooks.Alert) {
 	event := hooks.NewEvent(eventType, file.SourceID).
 		WithFile(file.ID, file.FileName, file.FileSize, "", "")
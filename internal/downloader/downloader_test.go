@@ -2,15 +2,20 @@ package downloader
 
 import (
 	"context"
+	"errors"
 	"io"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/blackout"
 	"github.com/patent-dev/bulk-file-loader/internal/database"
 	"github.com/patent-dev/bulk-file-loader/internal/hooks"
 	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/workpool"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -59,6 +64,7 @@ func setupTestEnv(t *testing.T) (*database.DB, *sources.Registry, *hooks.Manager
 		&database.Delivery{},
 		&database.File{},
 		&database.DownloadEntry{},
+		&database.QuarantinedFile{},
 		&database.Webhook{},
 	)
 
@@ -86,6 +92,21 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestReconfigure(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+
+	downloader := New(db, registry, hooksManager, cfg)
+	downloader.Reconfigure(5, TimeoutPolicy{Default: 30 * time.Second})
+
+	semaphore, timeouts := downloader.limits()
+	if cap(semaphore) != 5 {
+		t.Errorf("semaphore capacity = %d, want 5", cap(semaphore))
+	}
+	if timeouts.For(0) != 30*time.Second {
+		t.Errorf("timeout = %v, want 30s", timeouts.For(0))
+	}
+}
+
 func TestDownloadFileNotFound(t *testing.T) {
 	db, registry, hooksManager, cfg := setupTestEnv(t)
 	downloader := New(db, registry, hooksManager, cfg)
@@ -247,3 +268,618 @@ func TestGetProgress(t *testing.T) {
 		t.Error("GetProgress for nonexistent file should return nil")
 	}
 }
+
+func createMockFile(db *database.DB) {
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "prod", SourceID: "mock", Name: "Product"})
+	db.Create(&database.Delivery{ID: "del", ProductID: "prod", Name: "Delivery"})
+	db.Create(&database.File{
+		ID:         "file-1",
+		DeliveryID: "del",
+		ProductID:  "prod",
+		SourceID:   "mock",
+		FileName:   "test.txt",
+		FileSize:   100,
+	})
+}
+
+func TestDrainWaitsForDownloads(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	downloader := New(db, registry, hooksManager, cfg)
+
+	registry.Register(&mockAdapter{
+		downloadFunc: func(ctx context.Context, file sources.FileInfo, w io.Writer, progress sources.ProgressFunc) error {
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte("test content"))
+			return nil
+		},
+	})
+	createMockFile(db)
+
+	go downloader.Download(context.Background(), "file-1")
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if interrupted := downloader.Drain(ctx); interrupted != 0 {
+		t.Errorf("Drain() = %d interrupted, want 0", interrupted)
+	}
+
+	var entry database.DownloadEntry
+	db.First(&entry, "file_id = ?", "file-1")
+	if entry.Status != database.DownloadStatusCompleted {
+		t.Errorf("status after drain = %q, want completed", entry.Status)
+	}
+
+	if err := downloader.Download(context.Background(), "file-1"); err != ErrShuttingDown {
+		t.Errorf("Download() after drain = %v, want ErrShuttingDown", err)
+	}
+}
+
+func TestDrainInterruptsAndResumes(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	downloader := New(db, registry, hooksManager, cfg)
+
+	registry.Register(&mockAdapter{
+		downloadFunc: func(ctx context.Context, file sources.FileInfo, w io.Writer, progress sources.ProgressFunc) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	createMockFile(db)
+
+	go downloader.Download(context.Background(), "file-1")
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if interrupted := downloader.Drain(ctx); interrupted != 1 {
+		t.Errorf("Drain() = %d interrupted, want 1", interrupted)
+	}
+
+	var entry database.DownloadEntry
+	db.First(&entry, "file_id = ?", "file-1")
+	if entry.Status != database.DownloadStatusInterrupted {
+		t.Fatalf("status after drain deadline = %q, want interrupted", entry.Status)
+	}
+
+	// A new downloader, as after a restart, resumes the checkpointed download
+	registry.Register(&mockAdapter{})
+	restarted := New(db, registry, hooksManager, cfg)
+	if resumed := restarted.ResumeInterrupted(); resumed != 1 {
+		t.Fatalf("ResumeInterrupted() = %d, want 1", resumed)
+	}
+	restarted.Drain(context.Background())
+
+	var entries []database.DownloadEntry
+	db.Order("id").Find(&entries, "file_id = ?", "file-1")
+	if len(entries) != 2 || entries[0].Status != database.DownloadStatusFailed || entries[1].Status != database.DownloadStatusCompleted {
+		t.Errorf("entries after resume = %+v, want failed history and a completed download", entries)
+	}
+	if restarted.ResumeInterrupted() != 0 {
+		t.Error("ResumeInterrupted() should not resume the same download twice")
+	}
+}
+
+func TestWindowClosePausesAndResumes(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	downloader := New(db, registry, hooksManager, cfg)
+
+	registry.Register(&mockAdapter{
+		downloadFunc: func(ctx context.Context, file sources.FileInfo, w io.Writer, progress sources.ProgressFunc) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	createMockFile(db)
+
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 20*time.Millisecond, ErrWindowClosed)
+	defer cancel()
+	if err := downloader.Download(ctx, "file-1"); err != ErrWindowClosed {
+		t.Fatalf("Download() = %v, want ErrWindowClosed", err)
+	}
+
+	var entry database.DownloadEntry
+	db.First(&entry, "file_id = ?", "file-1")
+	if entry.Status != database.DownloadStatusPaused {
+		t.Fatalf("status after window close = %q, want paused", entry.Status)
+	}
+
+	if got := downloader.ResumePaused("other"); len(got) != 0 {
+		t.Errorf("ResumePaused() for another product = %v, want none", got)
+	}
+	if got := downloader.ResumePaused("prod"); len(got) != 1 || got[0] != "file-1" {
+		t.Fatalf("ResumePaused() = %v, want file-1", got)
+	}
+	if got := downloader.ResumePaused("prod"); len(got) != 0 {
+		t.Errorf("ResumePaused() should not resume the same download twice, got %v", got)
+	}
+}
+
+func TestBlackoutDefersDownloads(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	allDay, err := blackout.Parse("00:00-24:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Blackout = allDay
+	downloader := New(db, registry, hooksManager, cfg)
+	registry.Register(&mockAdapter{})
+	createMockFile(db)
+
+	done := make(chan error, 1)
+	go func() { done <- downloader.Download(context.Background(), "file-1") }()
+	time.Sleep(20 * time.Millisecond)
+
+	if !downloader.IsActive("file-1") {
+		t.Fatal("download should be queued during the blackout")
+	}
+	var count int64
+	db.Model(&database.DownloadEntry{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d download entries during the blackout, want none", count)
+	}
+
+	downloader.Cancel("file-1")
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Download() cancelled during the blackout = %v, want context.Canceled", err)
+	}
+
+	downloader.SetBlackout(nil)
+	if err := downloader.Download(context.Background(), "file-1"); err != nil {
+		t.Errorf("Download() after the blackout = %v", err)
+	}
+}
+
+func TestDownloadWindowDefersDownloads(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	// A window opening in two hours is closed now
+	start := time.Now().Add(2 * time.Hour)
+	window, err := blackout.Parse(start.Format("15:04") + "-" + start.Add(time.Hour).Format("15:04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DownloadWindow = window
+	downloader := New(db, registry, hooksManager, cfg)
+	registry.Register(&mockAdapter{})
+	createMockFile(db)
+
+	done := make(chan error, 1)
+	go func() { done <- downloader.Download(context.Background(), "file-1") }()
+	time.Sleep(20 * time.Millisecond)
+
+	if !downloader.IsActive("file-1") {
+		t.Fatal("download should be queued outside the download window")
+	}
+	var count int64
+	db.Model(&database.DownloadEntry{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d download entries outside the download window, want none", count)
+	}
+	downloader.Cancel("file-1")
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Download() cancelled outside the window = %v, want context.Canceled", err)
+	}
+
+	// The product's own window overrides the global one
+	db.Model(&database.Product{}).Where("id = ?", "prod").Update("download_window", "00:00-24:00")
+	if err := downloader.Download(context.Background(), "file-1"); err != nil {
+		t.Errorf("Download() inside the product window = %v", err)
+	}
+}
+
+func TestStorageQuota(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	downloader := New(db, registry, hooksManager, cfg)
+	downloader.SetStorageQuota(10)
+	registry.Register(&mockAdapter{})
+	createMockFile(db)
+	db.Create(&database.File{ID: "file-2", DeliveryID: "del", ProductID: "prod", SourceID: "mock", FileName: "test2.txt"})
+	events, unsubscribe := hooksManager.Subscribe(10)
+	defer unsubscribe()
+
+	// The quota is only reached by the first download
+	if err := downloader.Download(context.Background(), "file-1"); err != nil {
+		t.Fatalf("Download() below the quota = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- downloader.Download(context.Background(), "file-2") }()
+	exceeded := false
+	for !exceeded {
+		select {
+		case e := <-events:
+			exceeded = e.Type == hooks.EventStorageQuotaExceeded
+		case <-time.After(time.Second):
+			t.Fatal("no storage.quota_exceeded event")
+		}
+	}
+	if !downloader.IsActive("file-2") {
+		t.Fatal("download should be queued over the quota")
+	}
+	downloader.Cancel("file-2")
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Download() cancelled over the quota = %v, want context.Canceled", err)
+	}
+
+	// Deleting the first download frees the space once the usage is summed
+	// up again
+	db.Model(&database.DownloadEntry{}).Where("file_id = ?", "file-1").Update("status", "deleted")
+	downloader.resetUsage()
+	if err := downloader.Download(context.Background(), "file-2"); err != nil {
+		t.Errorf("Download() after freeing space = %v", err)
+	}
+}
+
+func TestProductStorageQuota(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	downloader := New(db, registry, hooksManager, cfg)
+	registry.Register(&mockAdapter{})
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "prod", SourceID: "mock", Name: "Images", StorageQuota: 20, QuotaAction: database.QuotaSkip})
+	for _, id := range []string{"f1", "f2", "f3"} {
+		db.Create(&database.File{ID: id, ProductID: "prod", SourceID: "mock", FileName: id + ".txt", FileSize: 12})
+	}
+
+	if err := downloader.Download(context.Background(), "f1"); err != nil {
+		t.Fatalf("Download() below the product quota = %v", err)
+	}
+	if err := downloader.Download(context.Background(), "f2"); !errors.Is(err, ErrProductQuotaExceeded) {
+		t.Errorf("Download() over the product quota = %v, want ErrProductQuotaExceeded", err)
+	}
+	var file database.File
+	db.First(&file, "id = ?", "f2")
+	if !file.Skipped {
+		t.Error("file over the product quota should be skipped")
+	}
+
+	// Deferred files wait for space instead
+	db.Model(&database.Product{}).Where("id = ?", "prod").Update("quota_action", database.QuotaDefer)
+	done := make(chan error, 1)
+	go func() { done <- downloader.Download(context.Background(), "f3") }()
+	time.Sleep(20 * time.Millisecond)
+	if !downloader.IsActive("f3") {
+		t.Fatal("download should be queued over the product quota")
+	}
+	downloader.Cancel("f3")
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Download() cancelled over the product quota = %v, want context.Canceled", err)
+	}
+	var deferred database.File
+	db.First(&deferred, "id = ?", "f3")
+	if deferred.ID == "" || deferred.Skipped {
+		t.Error("deferred file should not be skipped")
+	}
+
+	// A file larger than the quota never fits, so it isn't deferred
+	db.Create(&database.File{ID: "f4", ProductID: "prod", SourceID: "mock", FileName: "f4.txt", FileSize: 21})
+	if err := downloader.Download(context.Background(), "f4"); !errors.Is(err, ErrProductQuotaExceeded) {
+		t.Errorf("Download() larger than the product quota = %v, want ErrProductQuotaExceeded", err)
+	}
+	db.First(&file, "id = ?", "f4")
+	if !file.Skipped {
+		t.Error("file larger than the product quota should be skipped")
+	}
+}
+
+func TestUpdateLatest(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	cfg.LatestLinks = true
+	downloader := New(db, registry, hooksManager, cfg)
+	registry.Register(&mockAdapter{})
+
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "prod", SourceID: "mock", Name: "Product"})
+	older, newer := time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour)
+	db.Create(&database.Delivery{ID: "d1", ProductID: "prod", PublishedAt: &older})
+	db.Create(&database.Delivery{ID: "d2", ProductID: "prod", PublishedAt: &newer})
+	for _, f := range []database.File{
+		{ID: "f1", DeliveryID: "d1", FileName: "week1.zip"},
+		{ID: "f2", DeliveryID: "d2", FileName: "week2-a.zip"},
+		{ID: "f3", DeliveryID: "d2", FileName: "week2-b.zip"},
+	} {
+		f.ProductID, f.SourceID = "prod", "mock"
+		db.Create(&f)
+	}
+	latest := filepath.Join(cfg.DownloadsPath(), "mock", "prod", latestDir)
+	links := func() []string {
+		entries, _ := os.ReadDir(latest)
+		var names []string
+		for _, e := range entries {
+			if _, err := os.Stat(filepath.Join(latest, e.Name())); err != nil {
+				t.Errorf("link %s is broken: %v", e.Name(), err)
+			}
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	for _, id := range []string{"f1", "f2"} {
+		if err := downloader.Download(context.Background(), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// d2 is only partly downloaded
+	if names := links(); len(names) != 1 || names[0] != "week1.zip" {
+		t.Errorf("latest = %v, want week1.zip", names)
+	}
+
+	if err := downloader.Download(context.Background(), "f3"); err != nil {
+		t.Fatal(err)
+	}
+	if names := links(); len(names) != 2 || names[0] != "week2-a.zip" || names[1] != "week2-b.zip" {
+		t.Errorf("latest = %v, want the files of d2", names)
+	}
+
+	// Without any complete delivery the directory goes away
+	db.Model(&database.File{}).Where("id IN ?", []string{"f1", "f3"}).Update("status", database.FileStatusDeleted)
+	downloader.UpdateLatest("mock", "prod")
+	if _, err := os.Lstat(latest); !os.IsNotExist(err) {
+		t.Errorf("latest directory still exists: %v", err)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	cfg.Dedup = true
+	downloader := New(db, registry, hooksManager, cfg)
+	var transfers int
+	registry.Register(&mockAdapter{
+		downloadFunc: func(ctx context.Context, file sources.FileInfo, w io.Writer, progress sources.ProgressFunc) error {
+			transfers++
+			// Same name, same content
+			w.Write([]byte("content of " + file.FileName))
+			progress(16, 16)
+			return nil
+		},
+	})
+
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	for _, f := range []database.File{
+		{ID: "f1", ProductID: "p1", FileName: "a.zip"},
+		{ID: "f2", ProductID: "p2", FileName: "a.zip"},
+		{ID: "f3", ProductID: "p1", FileName: "b.zip", FileSize: 16, ExpectedChecksum: "394a7fcff019b1a9ad0e0d80a6996823", ChecksumAlgorithm: "md5"},
+		{ID: "f4", ProductID: "p2", FileName: "b.zip", FileSize: 16, ExpectedChecksum: "394a7fcff019b1a9ad0e0d80a6996823", ChecksumAlgorithm: "md5"},
+	} {
+		f.SourceID = "mock"
+		db.Create(&f)
+	}
+	for _, id := range []string{"f1", "f2", "f3", "f4"} {
+		if err := downloader.Download(context.Background(), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// f2 is linked after its transfer, f4 without one
+	if transfers != 3 {
+		t.Errorf("transfers = %d, want 3", transfers)
+	}
+	for id, original := range map[string]string{"f2": "f1", "f4": "f3"} {
+		var entry, stored database.DownloadEntry
+		db.First(&entry, "file_id = ?", id)
+		db.First(&stored, "file_id = ?", original)
+		if entry.Status != database.DownloadStatusCompleted || entry.DuplicateOf != original {
+			t.Errorf("%s entry = %+v, want completed duplicate of %s", id, entry, original)
+		}
+		a, _ := os.Stat(entry.LocalPath)
+		b, _ := os.Stat(stored.LocalPath)
+		if a == nil || b == nil || !os.SameFile(a, b) {
+			t.Errorf("%s is not linked to %s", entry.LocalPath, stored.LocalPath)
+		}
+	}
+
+	stats, err := db.DedupStats()
+	if err != nil || stats.Files != 2 || stats.SavedBytes != 32 {
+		t.Errorf("DedupStats() = %+v, %v, want 2 files, 32 bytes", stats, err)
+	}
+}
+
+func TestCASLayout(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	cfg.StorageLayout = config.LayoutCAS
+	downloader := New(db, registry, hooksManager, cfg)
+	registry.Register(&mockAdapter{})
+
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.File{ID: "f1", SourceID: "mock", ProductID: "p1", FileName: "a.zip"})
+	db.Create(&database.File{ID: "f2", SourceID: "mock", ProductID: "p2", FileName: "b.zip"})
+	for _, id := range []string{"f1", "f2"} {
+		if err := downloader.Download(context.Background(), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// sha256 of "test content"
+	digest := "6ae8a75555209fd6c44157c0aed8016e763ff435a19cf186f76863140143ff72"
+	blob := BlobPath(cfg.DownloadsPath(), digest)
+	var first, second database.DownloadEntry
+	db.First(&first, "file_id = ?", "f1")
+	db.First(&second, "file_id = ?", "f2")
+	if first.LocalPath != blob || second.LocalPath != blob {
+		t.Errorf("paths = %s, %s, want both %s", first.LocalPath, second.LocalPath, blob)
+	}
+	if second.DuplicateOf != "f1" || first.DuplicateOf != "" {
+		t.Errorf("DuplicateOf = %q, %q, want f2 to be a duplicate of f1", first.DuplicateOf, second.DuplicateOf)
+	}
+	if data, err := os.ReadFile(blob); err != nil || string(data) != "test content" {
+		t.Errorf("blob = %q, %v, want test content", data, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(cfg.DownloadsPath(), blobsDir, "tmp")); len(entries) != 0 {
+		t.Errorf("temp files left: %v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.DownloadsPath(), "mock")); !os.IsNotExist(err) {
+		t.Errorf("product directory created in the content-addressable layout: %v", err)
+	}
+}
+
+func TestValidationFailure(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	downloader := New(db, registry, hooksManager, cfg)
+	downloader.SetPostProcess(workpool.New(1, 0))
+	registry.Register(&mockAdapter{})
+	events, unsubscribe := hooksManager.Subscribe(10)
+	defer unsubscribe()
+
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", Name: "P1"})
+	db.Create(&database.File{ID: "f1", SourceID: "mock", ProductID: "p1", FileName: "a.zip"})
+	if _, err := db.SetProductValidators("p1", []string{"zip"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// "test content" isn't a ZIP archive
+	if err := downloader.Download(context.Background(), "f1"); err == nil {
+		t.Fatal("expected validation to fail")
+	}
+
+	var entry database.DownloadEntry
+	db.First(&entry, "file_id = ?", "f1")
+	if entry.Status != database.DownloadStatusInvalid || entry.ErrorMessage == "" {
+		t.Errorf("entry = %+v, want invalid with an error message", entry)
+	}
+	var quarantined database.QuarantinedFile
+	db.First(&quarantined, "file_id = ?", "f1")
+	if quarantined.Reason != database.QuarantineValidation {
+		t.Errorf("quarantined = %+v, want a validation failure", quarantined)
+	}
+	if _, err := os.Stat(downloader.QuarantinePath(&quarantined)); err != nil {
+		t.Errorf("invalid file not quarantined: %v", err)
+	}
+	var file database.File
+	db.First(&file, "id = ?", "f1")
+	if file.Status != database.FileStatusInvalid {
+		t.Errorf("file status = %q, want %q", file.Status, database.FileStatusInvalid)
+	}
+
+	var found bool
+	for len(events) > 0 {
+		event := <-events
+		if event.Type == hooks.EventDownloadInvalid {
+			found = len(event.Alerts) == 1 && event.Error != nil
+		}
+	}
+	if !found {
+		t.Error("expected a download.invalid event with an alert")
+	}
+
+	// Without validators the same content completes
+	if _, err := db.SetProductValidators("p1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloader.Download(context.Background(), "f1"); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&file, "id = ?", "f1")
+	if file.Status != database.FileStatusDownloaded {
+		t.Errorf("file status = %q, want %q", file.Status, database.FileStatusDownloaded)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	out := t.TempDir()
+	cfg.PipelineDirs = []string{out}
+	downloader := New(db, registry, hooksManager, cfg)
+	registry.Register(&mockAdapter{})
+	events, unsubscribe := hooksManager.Subscribe(10)
+	defer unsubscribe()
+
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", Name: "P1",
+		Pipeline: `[{"type":"upload","dir":"` + out + `"},{"type":"notify","message":"done"}]`})
+	db.Create(&database.Product{ID: "p2", SourceID: "mock", Name: "P2",
+		Pipeline: `[{"type":"extract"},{"type":"notify"}]`})
+	db.Create(&database.File{ID: "f1", SourceID: "mock", ProductID: "p1", FileName: "a.txt"})
+	db.Create(&database.File{ID: "f2", SourceID: "mock", ProductID: "p2", FileName: "b.zip"})
+	for _, id := range []string{"f1", "f2"} {
+		if err := downloader.Download(context.Background(), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Drain waits for the pipelines
+	downloader.Drain(context.Background())
+
+	if data, err := os.ReadFile(filepath.Join(out, "a.txt")); err != nil || string(data) != "test content" {
+		t.Errorf("uploaded file = %q, %v", data, err)
+	}
+	processed, failed := 0, 0
+	for len(events) > 0 {
+		switch event := <-events; event.Type {
+		case hooks.EventFileProcessed:
+			processed++
+		case hooks.EventPipelineFailed:
+			// "test content" isn't a ZIP archive
+			failed++
+			if event.File == nil || event.File.ID != "f2" {
+				t.Errorf("pipeline.failed for %+v, want f2", event.File)
+			}
+		}
+	}
+	if processed != 1 || failed != 1 {
+		t.Errorf("events = %d processed, %d failed, want 1 each", processed, failed)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	db, registry, hooksManager, cfg := setupTestEnv(t)
+	downloader := New(db, registry, hooksManager, cfg)
+	registry.Register(&mockAdapter{})
+	events, unsubscribe := hooksManager.Subscribe(10)
+	defer unsubscribe()
+
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	for _, id := range []string{"f1", "f2"} {
+		db.Create(&database.File{ID: id, SourceID: "mock", ProductID: "p1", FileName: id + ".zip",
+			ExpectedChecksum: "md5:00000000000000000000000000000000", ChecksumAlgorithm: "md5"})
+		if err := downloader.Download(context.Background(), id); !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("Download(%s) error = %v, want ErrChecksumMismatch", id, err)
+		}
+	}
+
+	entries, err := db.ListQuarantine()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("ListQuarantine() = %d entries, %v, want 2", len(entries), err)
+	}
+	var mismatches int
+	for len(events) > 0 {
+		if event := <-events; event.Type == hooks.EventChecksumMismatch {
+			mismatches++
+		}
+	}
+	if mismatches != 2 {
+		t.Errorf("checksum.mismatch events = %d, want 2", mismatches)
+	}
+
+	// Releasing accepts the file as downloaded
+	released := entries[1]
+	if released.FileID != "f1" || released.Reason != database.QuarantineChecksum || released.Size != 12 {
+		t.Fatalf("quarantined = %+v, want f1 with a checksum mismatch", released)
+	}
+	if err := downloader.Release(released.ID); err != nil {
+		t.Fatal(err)
+	}
+	var file database.File
+	db.First(&file, "id = ?", "f1")
+	if file.Status != database.FileStatusDownloaded {
+		t.Errorf("released file status = %q, want %q", file.Status, database.FileStatusDownloaded)
+	}
+	if data, err := os.ReadFile(downloader.getDownloadPath(&file)); err != nil || string(data) != "test content" {
+		t.Errorf("released file = %q, %v", data, err)
+	}
+
+	// Purging deletes the file
+	purged := entries[0]
+	path := downloader.QuarantinePath(&purged)
+	if err := downloader.Purge(purged.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("purged file still exists: %v", err)
+	}
+	if entries, _ := db.ListQuarantine(); len(entries) != 0 {
+		t.Errorf("ListQuarantine() after release and purge = %d entries, want 0", len(entries))
+	}
+	if err := downloader.Purge(purged.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Purge of a purged file error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,131 @@
+package downloader
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// latestDir is the directory in each product directory that links to the
+// files of the newest fully downloaded delivery
+const latestDir = "latest"
+
+// SetLatestLinks sets whether UpdateLatest maintains the latest directories
+func (d *Downloader) SetLatestLinks(enabled bool) {
+	d.limitsMu.Lock()
+	defer d.limitsMu.Unlock()
+	d.latestLinks = enabled
+}
+
+// UpdateLatest points the product's latest directory at the files of its
+// newest delivery whose files, except skipped ones, are all downloaded. The
+// directory is rebuilt next to the old one and swapped in, so it is only
+// missing for a moment. It does nothing unless enabled with SetLatestLinks.
+func (d *Downloader) UpdateLatest(sourceID, productID string) {
+	d.limitsMu.RLock()
+	enabled := d.latestLinks
+	d.limitsMu.RUnlock()
+	if !enabled {
+		return
+	}
+
+	d.latestMu.Lock()
+	defer d.latestMu.Unlock()
+	if err := d.updateLatest(sourceID, productID); err != nil {
+		slog.Error("Failed to update latest links", "productID", productID, "error", err)
+	}
+}
+
+func (d *Downloader) updateLatest(sourceID, productID string) error {
+	paths, err := d.latestPaths(productID)
+	if err != nil {
+		return err
+	}
+
+	productDir, err := filepath.Abs(filepath.Join(d.cfg.DownloadsPath(), sourceID, productID))
+	if err != nil {
+		return err
+	}
+	latest := filepath.Join(productDir, latestDir)
+	if len(paths) == 0 {
+		return os.RemoveAll(latest)
+	}
+	next := filepath.Join(productDir, "."+latestDir+".new")
+	if err := os.RemoveAll(next); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(next, 0755); err != nil {
+		return err
+	}
+	for name, path := range paths {
+		// Relative targets keep working when the downloads directory moves
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		target, err := filepath.Rel(latest, path)
+		if err != nil {
+			target = path
+		}
+		if err := os.Symlink(target, filepath.Join(next, name)); err != nil {
+			os.RemoveAll(next)
+			return err
+		}
+	}
+
+	old := filepath.Join(productDir, "."+latestDir+".old")
+	os.RemoveAll(old)
+	if err := os.Rename(latest, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(next, latest); err != nil {
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// latestPaths returns the downloaded files of the product's newest complete
+// delivery by name, nil if no delivery is complete
+func (d *Downloader) latestPaths(productID string) (map[string]string, error) {
+	var deliveries []database.Delivery
+	if err := d.db.Where("product_id = ?", productID).
+		Order("published_at IS NULL, published_at DESC, created_at DESC").Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	for _, delivery := range deliveries {
+		var files []database.File
+		if err := d.db.Select("id", "file_name", "status").
+			Where("delivery_id = ? AND skipped = ?", delivery.ID, false).Find(&files).Error; err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			continue
+		}
+		complete := true
+		ids := make([]string, 0, len(files))
+		names := make(map[string]string, len(files))
+		for _, f := range files {
+			complete = complete && f.Status == database.FileStatusDownloaded
+			ids = append(ids, f.ID)
+			names[f.ID] = f.FileName
+		}
+		if !complete {
+			continue
+		}
+
+		var entries []database.DownloadEntry
+		if err := d.db.Where("file_id IN ? AND status = ?", ids, database.DownloadStatusCompleted).
+			Order("completed_at").Find(&entries).Error; err != nil {
+			return nil, err
+		}
+		paths := make(map[string]string, len(entries))
+		for _, e := range entries {
+			// Blobs are named by checksum, so links take the file name
+			paths[names[e.FileID]] = e.LocalPath
+		}
+		return paths, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+	"github.com/patent-dev/bulk-file-loader/internal/pipeline"
+)
+
+// extractedDir is where extract steps unpack archives by default, kept out of
+// the downloads directory so reconciliation doesn't report the entries
+const extractedDir = "extracted"
+
+// workDir is where transform steps run when nothing was extracted
+const workDir = "work"
+
+// CheckPipeline reports whether steps are valid and use only the directories
+// and transform commands the operator allowed
+func (d *Downloader) CheckPipeline(steps []pipeline.Step) error {
+	if err := pipeline.Check(steps); err != nil {
+		return err
+	}
+	if err := pipeline.CheckDirs(steps, d.pipelineDirs()); err != nil {
+		return err
+	}
+	return pipeline.CheckCommands(steps, d.cfg.PipelineCommands)
+}
+
+// pipelineDirs returns the directories extract and upload steps may use
+func (d *Downloader) pipelineDirs() []string {
+	return append([]string{filepath.Join(d.cfg.DataDir, extractedDir)}, d.cfg.PipelineDirs...)
+}
+
+// startPipeline runs the product's pipeline on a completed download in the
+// background. It must be called from a download, which keeps Drain waiting
+// for the pipeline too.
+func (d *Downloader) startPipeline(file *database.File, path string) {
+	var product database.Product
+	if err := d.db.Select("pipeline").First(&product, "id = ?", file.ProductID).Error; err != nil || product.Pipeline == "" {
+		return
+	}
+	steps, err := pipeline.Parse(product.Pipeline)
+	if err != nil {
+		slog.Error("Invalid pipeline", "productID", file.ProductID, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	if _, running := d.pipelines.LoadOrStore(file.ID, cancel); running {
+		cancel(nil)
+		slog.Warn("Pipeline already running, skipping", "fileID", file.ID)
+		return
+	}
+	job := pipeline.Job{
+		FileID:     file.ID,
+		ProductID:  file.ProductID,
+		Path:       path,
+		Name:       file.FileName,
+		ExtractDir: filepath.Join(d.cfg.DataDir, extractedDir, file.SourceID, file.ProductID),
+		WorkDir:    filepath.Join(d.cfg.DataDir, workDir, file.SourceID, file.ProductID, file.ID),
+	}
+	d.limitsMu.RLock()
+	pool := d.postProcess
+	d.limitsMu.RUnlock()
+	env := pipeline.Env{
+		Pool:     pool,
+		Commands: d.cfg.PipelineCommands,
+		Dirs:     d.pipelineDirs(),
+		Notify: func(ctx context.Context, job pipeline.Job, message string, files []string) {
+			event := hooks.NewEvent(hooks.EventFileProcessed, file.SourceID).
+				WithFile(file.ID, file.FileName, file.FileSize, "", path)
+			if message != "" {
+				event.WithAlert("pipeline", message, "info")
+			}
+			d.hooks.Emit(ctx, event)
+		},
+	}
+
+	d.running.Add(1)
+	go func() {
+		defer d.running.Done()
+		defer func() {
+			d.pipelines.Delete(file.ID)
+			cancel(nil)
+		}()
+
+		run := func(ctx context.Context) error { return pipeline.Run(ctx, steps, job, env) }
+		if pool != nil {
+			err = pool.Run(ctx, run)
+		} else {
+			err = run(ctx)
+		}
+		switch {
+		case err == nil:
+			slog.Info("Pipeline completed", "fileID", file.ID, "steps", len(steps))
+		case errors.Is(context.Cause(ctx), ErrShuttingDown):
+			slog.Warn("Pipeline interrupted by shutdown", "fileID", file.ID)
+		default:
+			slog.Error("Pipeline failed", "fileID", file.ID, "error", err)
+			event := hooks.NewEvent(hooks.EventPipelineFailed, file.SourceID).
+				WithFile(file.ID, file.FileName, file.FileSize, "", path).
+				WithError("PIPELINE_FAILED", err.Error()).
+				WithAlert("pipeline", err.Error(), "error")
+			d.hooks.Emit(context.Background(), event)
+		}
+	}()
+}
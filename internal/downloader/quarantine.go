@@ -0,0 +1,185 @@
+package downloader
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+)
+
+// ErrChecksumMismatch is the cause of quarantining a download whose checksum
+// differs from the one the source announced
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// checksumHasher returns a hash for the file's expected checksum, nil if the
+// algorithm is sha256, which every download computes, or unsupported
+func checksumHasher(algorithm string) hash.Hash {
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	}
+	return nil
+}
+
+// verifyChecksum compares the digests, keyed by algorithm, with the file's
+// expected checksum
+func verifyChecksum(file *database.File, sums map[string]string) error {
+	if database.ChecksumMatches(*file, sums) {
+		return nil
+	}
+	return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch,
+		file.ExpectedChecksum, sums[strings.ToLower(file.ChecksumAlgorithm)])
+}
+
+func (d *Downloader) quarantineRoot() string {
+	return filepath.Join(d.cfg.DownloadsPath(), database.QuarantineDir)
+}
+
+// QuarantinePath returns where a quarantined file is stored
+func (d *Downloader) QuarantinePath(q *database.QuarantinedFile) string {
+	return filepath.Join(d.quarantineRoot(), q.Path)
+}
+
+// quarantine records a download that failed its checksum or validation and
+// moves the file from tempPath into the quarantine directory, where it can
+// be inspected, released or purged
+func (d *Downloader) quarantine(entry *database.DownloadEntry, file *database.File, tempPath, localChecksum, reason string, cause error) error {
+	message, eventType, code := "Validation failed", hooks.EventDownloadInvalid, "VALIDATION_FAILED"
+	if reason == database.QuarantineChecksum {
+		message, eventType, code = "Checksum mismatch", hooks.EventChecksumMismatch, "CHECKSUM_MISMATCH"
+	}
+
+	// Each download gets its own directory so the file keeps its name
+	record := &database.QuarantinedFile{
+		FileID:          file.ID,
+		DownloadEntryID: entry.ID,
+		Path:            filepath.Join(strconv.FormatUint(uint64(entry.ID), 10), file.FileName),
+		Reason:          reason,
+		Message:         cause.Error(),
+		Checksum:        localChecksum,
+	}
+	path := d.QuarantinePath(record)
+	if info, err := os.Stat(tempPath); err == nil {
+		record.Size = info.Size()
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		slog.Error("Failed to quarantine file", "fileID", file.ID, "error", err)
+		os.Remove(tempPath)
+		path = ""
+	} else if err := d.db.Create(record).Error; err != nil {
+		slog.Error("Failed to record quarantined file", "fileID", file.ID, "error", err)
+	}
+
+	completedAt := time.Now()
+	entry.Status = database.DownloadStatusInvalid
+	entry.ErrorMessage = fmt.Sprintf("%s: %v", message, cause)
+	entry.LocalChecksum = localChecksum
+	entry.CompletedAt = &completedAt
+	if err := d.db.Save(entry).Error; err != nil {
+		slog.Error("Failed to update download entry", "error", err)
+	}
+	d.updateFileStatus(file.ID)
+
+	event := hooks.NewEvent(eventType, file.SourceID).
+		WithFile(file.ID, file.FileName, file.FileSize, localChecksum, path).
+		WithError(code, entry.ErrorMessage).
+		WithAlert(reason, entry.ErrorMessage, "error")
+	d.hooks.Emit(context.Background(), event)
+
+	slog.Warn("Download quarantined", "fileID", file.ID, "path", path, "reason", reason, "error", cause)
+	return fmt.Errorf("%s: %w", message, cause)
+}
+
+// Release moves a quarantined file to where it would have been stored and
+// records it as downloaded, for files an operator accepts despite the
+// failed check
+func (d *Downloader) Release(id uint) error {
+	d.drainMu.RLock()
+	if d.shuttingDown {
+		d.drainMu.RUnlock()
+		return ErrShuttingDown
+	}
+	d.running.Add(1)
+	d.drainMu.RUnlock()
+	defer d.running.Done()
+
+	q, err := d.db.GetQuarantined(id)
+	if err != nil {
+		return err
+	}
+	if q.File.ID == "" {
+		return ErrFileNotFound
+	}
+	if _, exists := d.active.Load(q.FileID); exists {
+		return ErrDownloadInProgress
+	}
+	file := q.File
+	source := d.QuarantinePath(q)
+
+	var path, duplicateOf string
+	if d.casLayout() {
+		path, duplicateOf, err = d.storeBlob(file.ID, source, strings.TrimPrefix(q.Checksum, "sha256:"))
+	} else {
+		path = d.getDownloadPath(&file)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = os.Rename(source, path)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+	os.Remove(filepath.Dir(source))
+	if err := d.db.Delete(q).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entry := &database.DownloadEntry{
+		FileID:      file.ID,
+		Status:      database.DownloadStatusDownloading,
+		Progress:    q.Size,
+		TotalBytes:  q.Size,
+		DuplicateOf: duplicateOf,
+		StartedAt:   &now,
+	}
+	if err := d.db.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to create download entry: %w", err)
+	}
+	slog.Info("Released quarantined file", "id", id, "fileID", file.ID)
+	return d.complete(entry, &file, path, q.Checksum)
+}
+
+// Purge deletes a quarantined file
+func (d *Downloader) Purge(id uint) error {
+	q, err := d.db.GetQuarantined(id)
+	if err != nil {
+		return err
+	}
+	path := d.QuarantinePath(q)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	os.Remove(filepath.Dir(path))
+	if err := d.db.Delete(q).Error; err != nil {
+		return err
+	}
+	slog.Info("Purged quarantined file", "id", id, "fileID", q.FileID)
+	return nil
+}
@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+)
+
+// ErrProductQuotaExceeded is returned for a file skipped because its download
+// would exceed its product's storage quota
+var ErrProductQuotaExceeded = errors.New("product storage quota exceeded")
+
+// usageTTL bounds how long the summed up storage usage is reused, so queued
+// downloads don't each query it
+const usageTTL = 10 * time.Second
+
+// SetStorageQuota sets how many bytes downloads may take up; 0 disables the
+// quota. Once reached, running downloads continue and new ones wait until
+// space is freed.
+func (d *Downloader) SetStorageQuota(bytes int64) {
+	d.limitsMu.Lock()
+	d.quota = bytes
+	d.limitsMu.Unlock()
+	d.resetUsage()
+}
+
+// resetUsage makes the next quota check sum up the storage usage again
+func (d *Downloader) resetUsage() {
+	d.quotaMu.Lock()
+	defer d.quotaMu.Unlock()
+	d.usageCheckedAt = time.Time{}
+}
+
+// quotaExceeded reports whether the stored files reach the storage quota,
+// emitting storage.quota_exceeded when they first do
+func (d *Downloader) quotaExceeded() bool {
+	d.limitsMu.RLock()
+	quota := d.quota
+	d.limitsMu.RUnlock()
+
+	d.quotaMu.Lock()
+	if quota <= 0 {
+		d.overQuota = false
+		d.quotaMu.Unlock()
+		return false
+	}
+	if time.Since(d.usageCheckedAt) >= usageTTL {
+		usage, err := d.db.StorageUsage()
+		if err != nil {
+			d.quotaMu.Unlock()
+			// Downloads aren't held back by a failing query
+			slog.Error("Failed to sum up storage usage", "error", err)
+			return false
+		}
+		d.usage, d.usageCheckedAt = usage, time.Now()
+	}
+	usage, exceeded, crossed := d.usage, d.usage >= quota, d.usage >= quota != d.overQuota
+	d.overQuota = exceeded
+	d.quotaMu.Unlock()
+
+	switch {
+	case crossed && exceeded:
+		message := fmt.Sprintf("Downloads use %d of %d bytes, new downloads are paused", usage, quota)
+		slog.Warn("Storage quota exceeded, downloads paused", "usage", usage, "quota", quota)
+		event := hooks.NewEvent(hooks.EventStorageQuotaExceeded, "").
+			WithAlert("storage_quota", message, "warning")
+		d.hooks.Emit(context.Background(), event)
+	case crossed:
+		slog.Info("Storage below quota, downloads resume", "usage", usage, "quota", quota)
+	}
+	return exceeded
+}
+
+// productQuotaExceeded reports whether downloading the file would take the
+// product's stored files past its storage quota
+func (d *Downloader) productQuotaExceeded(product *database.Product, file *database.File) bool {
+	if product.StorageQuota <= 0 {
+		return false
+	}
+	usage, err := d.db.ProductStorageUsage(product.ID)
+	if err != nil {
+		slog.Error("Failed to sum up product storage usage", "productID", product.ID, "error", err)
+		return false
+	}
+	return usage+file.FileSize > product.StorageQuota
+}
+
+// skipOverQuota marks the file as skipped if its product skips files that
+// would exceed its storage quota and this one does, or if the file alone
+// exceeds the quota, which deferring would wait for forever
+func (d *Downloader) skipOverQuota(file *database.File) error {
+	var product database.Product
+	if err := d.db.Select("id", "storage_quota", "quota_action").First(&product, "id = ?", file.ProductID).Error; err != nil {
+		return nil
+	}
+	tooLarge := product.StorageQuota > 0 && file.FileSize > product.StorageQuota
+	if !tooLarge && (product.QuotaAction != database.QuotaSkip || !d.productQuotaExceeded(&product, file)) {
+		return nil
+	}
+	if err := d.db.Model(&database.File{}).Where("id = ?", file.ID).Update("skipped", true).Error; err != nil {
+		return err
+	}
+	d.updateFileStatus(file.ID)
+	slog.Warn("File skipped, product storage quota exceeded", "fileID", file.ID, "productID", file.ProductID, "quota", product.StorageQuota)
+	return ErrProductQuotaExceeded
+}
@@ -0,0 +1,52 @@
+package downloader
+
+import (
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+)
+
+// maxTimeout bounds size-based deadlines when no Max is configured; a zero
+// timeout would mean no deadline at all
+const maxTimeout = time.Duration(1 << 62)
+
+// TimeoutPolicy derives the deadline of a download from the file size
+type TimeoutPolicy struct {
+	// Default applies to files of unknown size, or to all files if
+	// MinThroughput is not set
+	Default time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	// MinThroughput is the slowest transfer rate in bytes per second that
+	// still completes within the deadline
+	MinThroughput int64
+}
+
+// NewTimeoutPolicy builds the timeout policy from the configuration
+func NewTimeoutPolicy(cfg *config.Config) TimeoutPolicy {
+	return TimeoutPolicy{
+		Default:       time.Duration(cfg.DownloadTimeout) * time.Second,
+		Min:           time.Duration(cfg.DownloadMinTimeout) * time.Second,
+		Max:           time.Duration(cfg.DownloadMaxTimeout) * time.Second,
+		MinThroughput: int64(cfg.DownloadMinThroughput) * 1024,
+	}
+}
+
+// For returns the deadline for a file of the given size: Min plus the time
+// the file takes at MinThroughput, capped at Max, or at maxTimeout without
+// one
+func (p TimeoutPolicy) For(size int64) time.Duration {
+	if size <= 0 || p.MinThroughput <= 0 {
+		return p.Default
+	}
+
+	timeout := maxTimeout
+	// Guard against overflow for absurd sizes before applying the cap
+	if seconds := size / p.MinThroughput; seconds < int64((maxTimeout-p.Min)/time.Second) {
+		timeout = p.Min + time.Duration(seconds)*time.Second
+	}
+	if p.Max > 0 && timeout > p.Max {
+		timeout = p.Max
+	}
+	return timeout
+}
@@ -0,0 +1,50 @@
+package downloader
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTimeoutPolicy(t *testing.T) {
+	policy := TimeoutPolicy{
+		Default:       time.Hour,
+		Min:           10 * time.Minute,
+		Max:           48 * time.Hour,
+		MinThroughput: 1024 * 1024,
+	}
+
+	tests := []struct {
+		name string
+		size int64
+		want time.Duration
+	}{
+		{"unknown size", 0, time.Hour},
+		{"small file", 10 * 1024 * 1024, 10*time.Minute + 10*time.Second},
+		{"100 GB", 100 * 1024 * 1024 * 1024, 10*time.Minute + 102400*time.Second},
+		{"capped", 1024 * 1024 * 1024 * 1024, 48 * time.Hour},
+		{"overflow", 1 << 62, 48 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := policy.For(tt.size); got != tt.want {
+			t.Errorf("%s: For(%d) = %v, want %v", tt.name, tt.size, got, tt.want)
+		}
+	}
+
+	uncapped := policy
+	uncapped.Max = 0
+	for _, size := range []int64{1 << 62, math.MaxInt64} {
+		if got := uncapped.For(size); got != maxTimeout {
+			t.Errorf("without Max For(%d) = %v, want %v", size, got, maxTimeout)
+		}
+	}
+	slowest := TimeoutPolicy{Min: time.Minute, MinThroughput: 1}
+	if got := slowest.For(math.MaxInt64); got != maxTimeout {
+		t.Errorf("at 1 B/s For(MaxInt64) = %v, want %v", got, maxTimeout)
+	}
+
+	fixed := TimeoutPolicy{Default: time.Hour}
+	if got := fixed.For(100 * 1024 * 1024 * 1024); got != time.Hour {
+		t.Errorf("without throughput For() = %v, want the default", got)
+	}
+}
@@ -0,0 +1,40 @@
+package downloader
+
+import (
+	"context"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/validate"
+	"github.com/patent-dev/bulk-file-loader/internal/workpool"
+)
+
+// SetPostProcess sets the pool validation runs in, so checking large archives
+// doesn't hold download slots. Without one, validation runs directly.
+func (d *Downloader) SetPostProcess(pool *workpool.Pool) {
+	d.limitsMu.Lock()
+	defer d.limitsMu.Unlock()
+	d.postProcess = pool
+}
+
+// validate runs the product's validators on the downloaded file at path
+func (d *Downloader) validate(ctx context.Context, file *database.File, path string) error {
+	var product database.Product
+	if err := d.db.Select("validators").First(&product, "id = ?", file.ProductID).Error; err != nil {
+		return nil
+	}
+	specs := product.ValidatorList()
+	if len(specs) == 0 {
+		return nil
+	}
+
+	run := func(ctx context.Context) error {
+		return validate.File(ctx, path, file.FileName, specs)
+	}
+	d.limitsMu.RLock()
+	pool := d.postProcess
+	d.limitsMu.RUnlock()
+	if pool == nil {
+		return run(ctx)
+	}
+	return pool.Run(ctx, run)
+}
@@ -0,0 +1,45 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/patent-dev/bulk-file-loader/internal/amqp"
+)
+
+// AMQPPublisher publishes every event as JSON to an AMQP topic exchange, such
+// as one of RabbitMQ, with the event type as routing key
+type AMQPPublisher struct {
+	publisher *amqp.Publisher
+}
+
+func NewAMQPPublisher(rawURL, exchange string) (*AMQPPublisher, error) {
+	publisher, err := amqp.NewPublisher(rawURL, exchange)
+	if err != nil {
+		return nil, err
+	}
+	return &AMQPPublisher{publisher: publisher}, nil
+}
+
+func (p *AMQPPublisher) Name() string { return "amqp" }
+
+// Targets returns the exchange, subscribed to all events
+func (p *AMQPPublisher) Targets() ([]Target, error) {
+	return []Target{{Subscription: Subscription{Events: `["*"]`}}}, nil
+}
+
+// Deliver publishes the event. Broker exceptions that retrying won't fix,
+// such as refused access, are permanent.
+func (p *AMQPPublisher) Deliver(ctx context.Context, target Target, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return Permanent(err)
+	}
+	err = p.publisher.Publish(ctx, event.Type, "application/json", body)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && !amqpErr.Retriable() {
+		return Permanent(err)
+	}
+	return err
+}
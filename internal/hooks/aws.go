@@ -0,0 +1,88 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/patent-dev/bulk-file-loader/internal/aws"
+)
+
+// SQSPublisher sends every event as JSON to an SQS queue
+type SQSPublisher struct {
+	client   *aws.Client
+	queueURL string
+}
+
+func NewSQSPublisher(client *aws.Client, queueURL string) *SQSPublisher {
+	return &SQSPublisher{client: client, queueURL: queueURL}
+}
+
+func (p *SQSPublisher) Name() string { return "sqs" }
+
+// Targets returns the queue, subscribed to all events
+func (p *SQSPublisher) Targets() ([]Target, error) {
+	return []Target{{Subscription: Subscription{Events: `["*"]`}, Config: p.queueURL}}, nil
+}
+
+func (p *SQSPublisher) Deliver(ctx context.Context, target Target, event *Event) error {
+	msg, err := awsMessage(event)
+	if err != nil {
+		return err
+	}
+	return awsError(p.client.SendMessage(ctx, p.queueURL, msg))
+}
+
+// SNSPublisher publishes every event as JSON to an SNS topic
+type SNSPublisher struct {
+	client   *aws.Client
+	topicARN string
+}
+
+func NewSNSPublisher(client *aws.Client, topicARN string) *SNSPublisher {
+	return &SNSPublisher{client: client, topicARN: topicARN}
+}
+
+func (p *SNSPublisher) Name() string { return "sns" }
+
+// Targets returns the topic, subscribed to all events
+func (p *SNSPublisher) Targets() ([]Target, error) {
+	return []Target{{Subscription: Subscription{Events: `["*"]`}, Config: p.topicARN}}, nil
+}
+
+func (p *SNSPublisher) Deliver(ctx context.Context, target Target, event *Event) error {
+	msg, err := awsMessage(event)
+	if err != nil {
+		return err
+	}
+	return awsError(p.client.Publish(ctx, p.topicARN, msg))
+}
+
+// awsMessage encodes the event with its type, source and product as message
+// attributes, for SNS filter policies. FIFO queues and topics order events
+// per source.
+func awsMessage(event *Event) (aws.Message, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return aws.Message{}, Permanent(err)
+	}
+	// Attribute values must not be empty
+	attributes := map[string]string{"event": event.Type}
+	if event.Source != "" {
+		attributes["source"] = event.Source
+	}
+	if event.Product != nil {
+		attributes["product"] = event.Product.ID
+	}
+	return aws.Message{Body: string(body), Attributes: attributes, GroupID: event.Source}, nil
+}
+
+// awsError makes errors that retrying won't fix, such as denied access,
+// permanent
+func awsError(err error) error {
+	var awsErr *aws.Error
+	if errors.As(err, &awsErr) && !awsErr.Retriable() {
+		return Permanent(err)
+	}
+	return err
+}
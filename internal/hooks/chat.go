@@ -0,0 +1,262 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// Chat platforms of chat notifiers
+const (
+	ChatDiscord = "discord"
+	ChatTeams   = "teams"
+)
+
+// ErrChatNotifierNotFound is returned for unknown chat notifier IDs
+var ErrChatNotifierNotFound = errors.New("chat notifier not found")
+
+// ValidateChatNotifier checks the platform is supported and the webhook URL
+// is an absolute http(s) URL
+func ValidateChatNotifier(n *database.ChatNotifier) error {
+	if n.Platform != ChatDiscord && n.Platform != ChatTeams {
+		return fmt.Errorf("unsupported platform %q, want %q or %q", n.Platform, ChatDiscord, ChatTeams)
+	}
+	u, err := url.Parse(n.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhookUrl must be an http(s) URL")
+	}
+	return nil
+}
+
+func (m *Manager) ListChatNotifiers() ([]database.ChatNotifier, error) {
+	var notifiers []database.ChatNotifier
+	return notifiers, m.db.Find(&notifiers).Error
+}
+
+func (m *Manager) GetChatNotifier(id uint) (*database.ChatNotifier, error) {
+	var notifier database.ChatNotifier
+	if err := m.db.First(&notifier, id).Error; err != nil {
+		return nil, ErrChatNotifierNotFound
+	}
+	return &notifier, nil
+}
+
+func (m *Manager) CreateChatNotifier(n *database.ChatNotifier) error {
+	if err := ValidateChatNotifier(n); err != nil {
+		return err
+	}
+	return m.db.Create(n).Error
+}
+
+func (m *Manager) UpdateChatNotifier(n *database.ChatNotifier) error {
+	if err := ValidateChatNotifier(n); err != nil {
+		return err
+	}
+	return m.db.Save(n).Error
+}
+
+func (m *Manager) DeleteChatNotifier(id uint) error {
+	result := m.db.Delete(&database.ChatNotifier{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrChatNotifierNotFound
+	}
+	return nil
+}
+
+// chatNotifier posts events to Discord and Teams webhooks
+type chatNotifier struct {
+	m *Manager
+}
+
+func (c chatNotifier) Name() string { return "chat" }
+
+func (c chatNotifier) Targets() ([]Target, error) {
+	var notifiers []database.ChatNotifier
+	if err := c.m.db.Where("enabled = ?", true).Find(&notifiers).Error; err != nil {
+		return nil, err
+	}
+	targets := make([]Target, len(notifiers))
+	for i, n := range notifiers {
+		targets[i] = Target{
+			ID:           n.ID,
+			Subscription: Subscription{Events: n.Events, Sources: n.Sources, Products: n.Products},
+			Config:       n,
+		}
+	}
+	return targets, nil
+}
+
+// Deliver posts the event's message card for the notifier's platform
+func (c chatNotifier) Deliver(ctx context.Context, target Target, event *Event) error {
+	n := target.Config.(database.ChatNotifier)
+	var message any
+	switch n.Platform {
+	case ChatDiscord:
+		message = discordMessage(event)
+	case ChatTeams:
+		message = teamsMessage(event)
+	default:
+		return Permanent(fmt.Errorf("unsupported platform %q", n.Platform))
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BulkFileLoader/1.0")
+
+	resp, err := c.m.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// eventSeverity classifies an event as "error", "warning" or "info" by its
+// type, error and alerts
+func eventSeverity(e *Event) string {
+	if e.Error != nil {
+		return "error"
+	}
+	switch e.Type {
+	case EventDownloadFailed, EventDownloadInvalid, EventPipelineFailed, EventChecksumMismatch, EventSyncFailed:
+		return "error"
+	case EventCredentialsExpiring, EventDeliveryExpiring, EventStorageQuotaExceeded:
+		return "warning"
+	}
+	severity := "info"
+	for _, a := range e.Alerts {
+		if a.Severity == "error" {
+			return "error"
+		}
+		if a.Severity == "warning" {
+			severity = "warning"
+		}
+	}
+	return severity
+}
+
+// eventFact is a labelled detail of an event shown on message cards
+type eventFact struct {
+	Name  string
+	Value string
+}
+
+func eventFacts(e *Event) []eventFact {
+	facts := []eventFact{{"Source", e.Source}}
+	if e.Product != nil {
+		facts = append(facts, eventFact{"Product", e.Product.Name})
+	}
+	if e.Delivery != nil {
+		facts = append(facts, eventFact{"Delivery", e.Delivery.Name})
+	}
+	if e.File != nil {
+		facts = append(facts, eventFact{"File", e.File.Name})
+		if e.File.Size > 0 {
+			facts = append(facts, eventFact{"Size", strconv.FormatInt(e.File.Size, 10) + " bytes"})
+		}
+	}
+	if e.Error != nil {
+		facts = append(facts, eventFact{"Error", e.Error.Code + ": " + e.Error.Message})
+	}
+	return facts
+}
+
+func alertText(e *Event) string {
+	messages := make([]string, len(e.Alerts))
+	for i, a := range e.Alerts {
+		messages[i] = a.Message
+	}
+	return strings.Join(messages, "\n")
+}
+
+// discordColors are embed colors by severity
+var discordColors = map[string]int{
+	"info":    0x2eb67d,
+	"warning": 0xecb22e,
+	"error":   0xe01e5a,
+}
+
+// discordMessage renders the event as a Discord webhook message with one
+// embed
+func discordMessage(e *Event) map[string]any {
+	fields := []map[string]any{}
+	for _, f := range eventFacts(e) {
+		fields = append(fields, map[string]any{"name": f.Name, "value": f.Value, "inline": f.Name != "Error"})
+	}
+	embed := map[string]any{
+		"title":     e.Type,
+		"color":     discordColors[eventSeverity(e)],
+		"timestamp": e.Timestamp,
+		"fields":    fields,
+	}
+	if text := alertText(e); text != "" {
+		embed["description"] = text
+	}
+	return map[string]any{
+		"username": "Bulk File Loader",
+		"embeds":   []any{embed},
+	}
+}
+
+// teamsColors are Adaptive Card text colors by severity
+var teamsColors = map[string]string{
+	"info":    "Good",
+	"warning": "Warning",
+	"error":   "Attention",
+}
+
+// teamsMessage renders the event as an Adaptive Card, as accepted by Teams
+// incoming webhooks and workflows
+func teamsMessage(e *Event) map[string]any {
+	facts := []map[string]any{}
+	for _, f := range eventFacts(e) {
+		facts = append(facts, map[string]any{"title": f.Name, "value": f.Value})
+	}
+	body := []any{
+		map[string]any{
+			"type":   "TextBlock",
+			"text":   e.Type,
+			"size":   "Medium",
+			"weight": "Bolder",
+			"color":  teamsColors[eventSeverity(e)],
+		},
+		map[string]any{"type": "FactSet", "facts": facts},
+	}
+	if text := alertText(e); text != "" {
+		body = append(body, map[string]any{"type": "TextBlock", "text": text, "wrap": true})
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []any{map[string]any{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}
+}
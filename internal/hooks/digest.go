@@ -0,0 +1,131 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// EventDigest is the event type of batched webhook payloads
+const EventDigest = "digest"
+
+// Digest is the payload of a digest webhook: the events collected since the
+// last one, oldest first
+type Digest struct {
+	Type      string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	Events    []*Event  `json:"events"`
+}
+
+// SetWebhookDigest batches the webhook's events into one payload sent every
+// minutes; 0 sends each event right away
+func (m *Manager) SetWebhookDigest(id uint, minutes int) error {
+	if minutes < 0 {
+		return errors.New("digestMinutes must not be negative")
+	}
+	return m.db.Model(&database.Webhook{}).Where("id = ?", id).Update("digest_minutes", minutes).Error
+}
+
+func (m *Manager) addToWebhookDigest(webhook database.Webhook, event *Event) {
+	m.webhookDigestMu.Lock()
+	defer m.webhookDigestMu.Unlock()
+
+	if m.webhookDigests == nil {
+		m.webhookDigests = make(map[uint]*digest)
+	}
+	d, ok := m.webhookDigests[webhook.ID]
+	if !ok {
+		d = &digest{}
+		id := webhook.ID
+		d.timer = time.AfterFunc(time.Duration(webhook.DigestMinutes)*time.Minute, func() {
+			m.deliveries.Add(1)
+			defer m.deliveries.Done()
+			m.flushWebhookDigest(id)
+		})
+		m.webhookDigests[webhook.ID] = d
+	}
+	d.events = append(d.events, event)
+}
+
+// flushWebhookDigest sends the collected events of a webhook with its current
+// settings, retried like single events
+func (m *Manager) flushWebhookDigest(id uint) {
+	m.webhookDigestMu.Lock()
+	d, ok := m.webhookDigests[id]
+	delete(m.webhookDigests, id)
+	m.webhookDigestMu.Unlock()
+	if !ok {
+		return
+	}
+
+	webhook, err := m.GetWebhook(id)
+	if err != nil {
+		return
+	}
+	digest := &Digest{Type: EventDigest, Timestamp: time.Now().UTC(), Events: d.events}
+	payload, err := renderDigest(*webhook, digest)
+	if err != nil {
+		slog.Error("Failed to render webhook digest", "error", err, "webhookID", id)
+		return
+	}
+	target := Target{ID: webhook.ID, Config: *webhook}
+	m.deliver(context.Background(), digestNotifier{m, payload}, target, &Event{Type: EventDigest, Timestamp: digest.Timestamp})
+}
+
+// flushWebhookDigests sends all pending webhook digests right away
+func (m *Manager) flushWebhookDigests() {
+	m.webhookDigestMu.Lock()
+	var ids []uint
+	for id, d := range m.webhookDigests {
+		if d.timer.Stop() {
+			ids = append(ids, id)
+		}
+	}
+	m.webhookDigestMu.Unlock()
+
+	for _, id := range ids {
+		m.flushWebhookDigest(id)
+	}
+}
+
+// renderDigest returns the body sent to a digest webhook. Its template, if
+// any, is executed with the Digest, e.g. {{len .Events}}.
+func renderDigest(webhook database.Webhook, digest *Digest) ([]byte, error) {
+	if webhook.Template == "" {
+		return json.Marshal(digest)
+	}
+	tmpl, err := ParseTemplate(webhook.Template)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, digest); err != nil {
+		return nil, fmt.Errorf("render payload template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// digestNotifier sends a rendered digest to its webhook, so digests get the
+// retries and dead letters of single events
+type digestNotifier struct {
+	m       *Manager
+	payload []byte
+}
+
+func (n digestNotifier) Name() string { return "webhook" }
+
+func (n digestNotifier) Targets() ([]Target, error) { return nil, nil }
+
+func (n digestNotifier) Deliver(ctx context.Context, target Target, event *Event) error {
+	return n.m.send(ctx, target.Config.(database.Webhook), n.payload)
+}
+
+func (n digestNotifier) DeadLetter(target Target, event *Event, attempts int, err error) {
+	n.m.storeDeadLetter(target.ID, EventDigest, n.payload, attempts, err)
+}
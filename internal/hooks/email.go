@@ -0,0 +1,351 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// DefaultEmailEvents are mailed by email notifiers created without events
+var DefaultEmailEvents = []string{EventDownloadFailed, EventDownloadInvalid, EventChecksumMismatch, EventCredentialsExpiring}
+
+// ErrEmailNotifierNotFound is returned for unknown email notifier IDs
+var ErrEmailNotifierNotFound = errors.New("email notifier not found")
+
+// SMTPConfig is the mail server email notifiers send through. Port 465 uses
+// implicit TLS; on other ports STARTTLS is used when the server offers it.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// sendMail delivers a message through the SMTP server; replaced in tests
+var sendMail = smtpSend
+
+// digest collects events of a digest notifier until its timer fires
+type digest struct {
+	events []*Event
+	timer  *time.Timer
+}
+
+// SetSMTP sets the mail server; without a host email notifiers can't be
+// created and existing ones send nothing
+func (m *Manager) SetSMTP(cfg SMTPConfig) {
+	m.emailMu.Lock()
+	defer m.emailMu.Unlock()
+	m.smtp = cfg
+}
+
+func (m *Manager) smtpConfig() SMTPConfig {
+	m.emailMu.Lock()
+	defer m.emailMu.Unlock()
+	return m.smtp
+}
+
+// ValidateEmailNotifier checks SMTP is configured and the notifier has valid
+// recipients and digest interval
+func (m *Manager) ValidateEmailNotifier(n *database.EmailNotifier) error {
+	if m.smtpConfig().Host == "" {
+		return errors.New("SMTP is not configured, set BULK_LOADER_SMTP_HOST")
+	}
+	recipients := ParseIDs(n.Recipients)
+	if len(recipients) == 0 {
+		return errors.New("at least one recipient is required")
+	}
+	for _, r := range recipients {
+		if _, err := mail.ParseAddress(r); err != nil {
+			return fmt.Errorf("invalid recipient %q", r)
+		}
+	}
+	if n.DigestMinutes < 0 {
+		return errors.New("digestMinutes must not be negative")
+	}
+	return nil
+}
+
+func (m *Manager) ListEmailNotifiers() ([]database.EmailNotifier, error) {
+	var notifiers []database.EmailNotifier
+	return notifiers, m.db.Find(&notifiers).Error
+}
+
+func (m *Manager) GetEmailNotifier(id uint) (*database.EmailNotifier, error) {
+	var notifier database.EmailNotifier
+	if err := m.db.First(&notifier, id).Error; err != nil {
+		return nil, ErrEmailNotifierNotFound
+	}
+	return &notifier, nil
+}
+
+// CreateEmailNotifier stores a notifier; without events it mails
+// DefaultEmailEvents
+func (m *Manager) CreateEmailNotifier(n *database.EmailNotifier) error {
+	if err := m.ValidateEmailNotifier(n); err != nil {
+		return err
+	}
+	if len(ParseEvents(n.Events)) == 0 {
+		n.Events = EncodeList(DefaultEmailEvents)
+	}
+	return m.db.Create(n).Error
+}
+
+func (m *Manager) UpdateEmailNotifier(n *database.EmailNotifier) error {
+	if err := m.ValidateEmailNotifier(n); err != nil {
+		return err
+	}
+	return m.db.Save(n).Error
+}
+
+// DeleteEmailNotifier removes a notifier; a pending digest is discarded
+func (m *Manager) DeleteEmailNotifier(id uint) error {
+	result := m.db.Delete(&database.EmailNotifier{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEmailNotifierNotFound
+	}
+
+	m.emailMu.Lock()
+	if d, ok := m.digests[id]; ok {
+		d.timer.Stop()
+		delete(m.digests, id)
+	}
+	m.emailMu.Unlock()
+	return nil
+}
+
+// emailNotifier mails events, or collects them into digests
+type emailNotifier struct {
+	m *Manager
+}
+
+func (e emailNotifier) Name() string { return "email" }
+
+// Targets returns the enabled email notifiers; none while SMTP isn't
+// configured
+func (e emailNotifier) Targets() ([]Target, error) {
+	if e.m.smtpConfig().Host == "" {
+		return nil, nil
+	}
+	var notifiers []database.EmailNotifier
+	if err := e.m.db.Where("enabled = ?", true).Find(&notifiers).Error; err != nil {
+		return nil, err
+	}
+	targets := make([]Target, len(notifiers))
+	for i, n := range notifiers {
+		targets[i] = Target{
+			ID:           n.ID,
+			Subscription: Subscription{Events: n.Events, Sources: n.Sources, Products: n.Products},
+			Config:       n,
+		}
+	}
+	return targets, nil
+}
+
+// Deliver mails the event, or adds it to the notifier's digest
+func (e emailNotifier) Deliver(ctx context.Context, target Target, event *Event) error {
+	n := target.Config.(database.EmailNotifier)
+	if n.DigestMinutes > 0 {
+		e.m.addToDigest(n, event)
+		return nil
+	}
+	return e.m.mailEvents(n, []*Event{event})
+}
+
+func (m *Manager) addToDigest(notifier database.EmailNotifier, event *Event) {
+	m.emailMu.Lock()
+	defer m.emailMu.Unlock()
+
+	if m.digests == nil {
+		m.digests = make(map[uint]*digest)
+	}
+	d, ok := m.digests[notifier.ID]
+	if !ok {
+		d = &digest{}
+		id := notifier.ID
+		d.timer = time.AfterFunc(time.Duration(notifier.DigestMinutes)*time.Minute, func() {
+			m.flushDigest(id)
+		})
+		m.digests[notifier.ID] = d
+	}
+	d.events = append(d.events, event)
+}
+
+// flushDigest mails the collected events of a notifier with its current
+// recipients
+func (m *Manager) flushDigest(id uint) {
+	m.emailMu.Lock()
+	d, ok := m.digests[id]
+	delete(m.digests, id)
+	m.emailMu.Unlock()
+	if !ok {
+		return
+	}
+
+	notifier, err := m.GetEmailNotifier(id)
+	if err != nil {
+		return
+	}
+	if err := m.mailEvents(*notifier, d.events); err != nil {
+		slog.Error("Email digest failed", "error", err, "notifierID", id, "events", len(d.events))
+	}
+}
+
+// FlushDigests sends all pending email and webhook digests right away, e.g.
+// at the end of a one-shot run
+func (m *Manager) FlushDigests() {
+	m.flushWebhookDigests()
+
+	m.emailMu.Lock()
+	var ids []uint
+	for id, d := range m.digests {
+		if d.timer.Stop() {
+			ids = append(ids, id)
+		}
+	}
+	m.emailMu.Unlock()
+
+	for _, id := range ids {
+		m.flushDigest(id)
+	}
+}
+
+// mailEvents sends one mail listing the events. Rejections by the server
+// (5xx replies) are permanent.
+func (m *Manager) mailEvents(notifier database.EmailNotifier, events []*Event) error {
+	cfg := m.smtpConfig()
+	recipients := ParseIDs(notifier.Recipients)
+	msg := composeMail(cfg.From, recipients, events)
+	err := sendMail(cfg, recipients, msg)
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
+
+// composeMail builds a plain text mail listing the events
+func composeMail(from string, to []string, events []*Event) []byte {
+	subject := fmt.Sprintf("[Bulk File Loader] %d events", len(events))
+	if len(events) == 1 {
+		subject = "[Bulk File Loader] " + describeEvent(events[0])
+	}
+
+	var body strings.Builder
+	for _, e := range events {
+		fmt.Fprintf(&body, "%s  %s\r\n", e.Timestamp.Format("2006-01-02 15:04:05 MST"), describeEvent(e))
+		for _, a := range e.Alerts {
+			fmt.Fprintf(&body, "    %s: %s\r\n", a.Severity, a.Message)
+		}
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(body.String())
+	return msg.Bytes()
+}
+
+// describeEvent summarizes an event in one line, e.g.
+// "download.failed epo / EBD / EBD_2024_01.zip (TIMEOUT: timed out)"
+func describeEvent(e *Event) string {
+	parts := []string{e.Source}
+	if e.Product != nil {
+		parts = append(parts, e.Product.Name)
+	}
+	if e.Delivery != nil {
+		parts = append(parts, e.Delivery.Name)
+	}
+	if e.File != nil {
+		parts = append(parts, e.File.Name)
+	}
+	line := e.Type + " " + strings.Join(parts, " / ")
+	if e.Error != nil {
+		line += fmt.Sprintf(" (%s: %s)", e.Error.Code, e.Error.Message)
+	}
+	return line
+}
+
+func smtpSend(cfg SMTPConfig, to []string, msg []byte) error {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", cfg.From, err)
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+	var conn net.Conn
+	if cfg.Port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && cfg.Port != 465 {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		addr, err := mail.ParseAddress(rcpt)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", rcpt, err)
+		}
+		if err := c.Rcpt(addr.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,155 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// pruneInterval is how often recording an event also deletes expired ones
+const pruneInterval = time.Hour
+
+// ErrWebhookNotFound is returned for unknown webhook IDs
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// ReplayFilter selects recorded events to replay
+type ReplayFilter struct {
+	// Types limits the replay to these event types; empty replays all
+	Types []string
+	Since time.Time
+	// Until is the end of the period; zero replays up to now
+	Until time.Time
+}
+
+// record stores an emitted event in the event log
+func (m *Manager) record(event *Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to marshal event", "error", err, "event", event.Type)
+		return
+	}
+	entry := &database.Event{
+		Type:      event.Type,
+		Source:    event.Source,
+		Payload:   payload,
+		CreatedAt: event.Timestamp,
+	}
+	if err := m.db.Create(entry).Error; err != nil {
+		slog.Error("Failed to record event", "error", err, "event", event.Type)
+	}
+	m.pruneExpired(time.Now())
+}
+
+// SetEventRetention sets how long recorded events are kept; 0 keeps them
+// forever
+func (m *Manager) SetEventRetention(retention time.Duration) {
+	m.eventMu.Lock()
+	defer m.eventMu.Unlock()
+	m.eventRetention = retention
+}
+
+// pruneExpired deletes events older than the retention, at most once per
+// pruneInterval
+func (m *Manager) pruneExpired(now time.Time) {
+	m.eventMu.Lock()
+	retention := m.eventRetention
+	due := retention > 0 && now.Sub(m.lastPrune) >= pruneInterval
+	if due {
+		m.lastPrune = now
+	}
+	m.eventMu.Unlock()
+	if !due {
+		return
+	}
+
+	deleted, err := m.PruneEvents(now.Add(-retention))
+	if err != nil {
+		slog.Error("Failed to prune event log", "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Info("Pruned event log", "deleted", deleted)
+	}
+}
+
+// PruneEvents deletes events recorded before the given time and returns how
+// many were deleted
+func (m *Manager) PruneEvents(before time.Time) (int64, error) {
+	result := m.db.Where("created_at < ?", before.UTC()).Delete(&database.Event{})
+	return result.RowsAffected, result.Error
+}
+
+// ListEvents returns recorded events, newest first. An empty type lists all
+// types and a zero since lists events of any age.
+func (m *Manager) ListEvents(eventType string, since time.Time, limit int) ([]database.Event, error) {
+	query := m.db.Order("created_at DESC, id DESC").Limit(limit)
+	if eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+	if !since.IsZero() {
+		query = query.Where("created_at >= ?", since.UTC())
+	}
+	var events []database.Event
+	return events, query.Find(&events).Error
+}
+
+// ReplayEvents sends recorded events of the given period to a webhook again,
+// oldest first, e.g. after the receiver was down. Only events the webhook is
+// subscribed to are sent. Deliveries run in the background with the usual
+// retries; the number of events queued is returned.
+func (m *Manager) ReplayEvents(webhookID uint, filter ReplayFilter) (int, error) {
+	webhook, err := m.GetWebhook(webhookID)
+	if err != nil {
+		return 0, ErrWebhookNotFound
+	}
+
+	// Events are recorded in UTC
+	query := m.db.Where("created_at >= ?", filter.Since.UTC()).Order("created_at, id")
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until.UTC())
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("type IN ?", filter.Types)
+	}
+	var entries []database.Event
+	if err := query.Find(&entries).Error; err != nil {
+		return 0, err
+	}
+
+	target := Target{
+		ID:           webhook.ID,
+		Subscription: Subscription{Events: webhook.Events, Sources: webhook.Sources, Products: webhook.Products},
+		Config:       *webhook,
+	}
+	var events []*Event
+	for _, entry := range entries {
+		var event Event
+		if err := json.Unmarshal(entry.Payload, &event); err != nil {
+			slog.Warn("Skipping unreadable recorded event", "error", err, "eventID", entry.ID)
+			continue
+		}
+		if target.Subscription.Matches(&event) {
+			events = append(events, &event)
+		}
+	}
+
+	slog.Info("Replaying events", "webhookID", webhookID, "events", len(events))
+	m.deliveries.Add(1)
+	go func() {
+		defer m.deliveries.Done()
+		notifier := webhookNotifier{m}
+		for _, event := range events {
+			select {
+			case <-m.stop:
+				return
+			default:
+			}
+			m.deliver(context.Background(), notifier, target, event)
+		}
+	}()
+	return len(events), nil
+}
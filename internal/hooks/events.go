@@ -3,14 +3,29 @@ package hooks
 import "time"
 
 const (
-	EventFileAvailable     = "file.available"
-	EventDownloadStarted   = "download.started"
-	EventDownloadCompleted = "download.completed"
-	EventDownloadFailed    = "download.failed"
-	EventDownloadCancelled = "download.cancelled"
-	EventChecksumMismatch  = "checksum.mismatch"
-	EventSyncCompleted     = "sync.completed"
-	EventSyncFailed        = "sync.failed"
+	EventFileAvailable       = "file.available"
+	EventDownloadStarted     = "download.started"
+	EventDownloadCompleted   = "download.completed"
+	EventDownloadFailed      = "download.failed"
+	EventDownloadCancelled   = "download.cancelled"
+	EventChecksumMismatch    = "checksum.mismatch"
+	EventSyncCompleted       = "sync.completed"
+	EventSyncFailed          = "sync.failed"
+	EventCredentialsExpiring = "credentials.expiring"
+	EventDeliveryExpiring    = "delivery.expiring"
+	// EventDownloadInvalid is sent when a downloaded file fails its
+	// product's validators
+	EventDownloadInvalid = "download.invalid"
+	// EventFileProcessed is sent by a notify step of a product's pipeline,
+	// EventPipelineFailed when a step fails
+	EventFileProcessed  = "file.processed"
+	EventPipelineFailed = "pipeline.failed"
+	// EventStorageQuotaExceeded is sent when the stored downloads reach the
+	// storage quota and new downloads pause
+	EventStorageQuotaExceeded = "storage.quota_exceeded"
+	// EventCredentialsAccessed is only sent to subscribers that list it; the
+	// "*" wildcard doesn't include it
+	EventCredentialsAccessed = "credentials.accessed"
 )
 
 // Event represents a hook event
@@ -23,6 +38,7 @@ type Event struct {
 	File      *File     `json:"file,omitempty"`
 	Alerts    []Alert   `json:"alerts,omitempty"`
 	Error     *Error    `json:"error,omitempty"`
+	Audit     *Audit    `json:"audit,omitempty"`
 }
 
 // Product info for event payload
@@ -59,6 +75,12 @@ type Error struct {
 	Message string `json:"message"`
 }
 
+// Audit describes an access to source credentials in the event payload
+type Audit struct {
+	Action string `json:"action"`
+	Actor  string `json:"actor"`
+}
+
 // NewEvent creates a new event with the current timestamp
 func NewEvent(eventType, source string) *Event {
 	return &Event{
@@ -108,3 +130,9 @@ func (e *Event) WithError(code, message string) *Event {
 	e.Error = &Error{Code: code, Message: message}
 	return e
 }
+
+// WithAudit sets the credential access info
+func (e *Event) WithAudit(action, actor string) *Event {
+	e.Audit = &Audit{Action: action, Actor: actor}
+	return e
+}
@@ -3,75 +3,188 @@ package hooks
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/patent-dev/bulk-file-loader/internal/database"
 )
 
+// SignatureHeader carries the HMAC-SHA256 of the payload for webhooks with a
+// secret, as "sha256=<hex>"
+const SignatureHeader = "X-BulkLoader-Signature"
+
 type Manager struct {
 	db         *database.DB
 	httpClient *http.Client
+
+	subscribers map[chan *Event]struct{}
+	subMu       sync.RWMutex
+
+	notifierMu sync.RWMutex
+	notifiers  []Notifier
+
+	retryMu    sync.RWMutex
+	retries    int
+	retryDelay time.Duration
+
+	emailMu sync.Mutex
+	smtp    SMTPConfig
+	digests map[uint]*digest
+
+	webhookDigestMu sync.Mutex
+	webhookDigests  map[uint]*digest
+
+	natsMu sync.Mutex
+	nats   NATSConfig
+
+	eventMu        sync.Mutex
+	eventRetention time.Duration
+	lastPrune      time.Time
+
+	deliveries sync.WaitGroup
+	stop       chan struct{}
+	stopOnce   sync.Once
 }
 
+// New creates a manager delivering events to webhooks, Slack, Discord,
+// Teams, email and NATS; further transports are added with Register
 func New(db *database.DB) *Manager {
-	return &Manager{
-		db:         db,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+	m := &Manager{
+		db:          db,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		subscribers: make(map[chan *Event]struct{}),
+		retries:     defaultRetries,
+		retryDelay:  defaultRetryDelay,
+		stop:        make(chan struct{}),
 	}
+	m.Register(webhookNotifier{m})
+	m.Register(slackNotifier{m})
+	m.Register(chatNotifier{m})
+	m.Register(emailNotifier{m})
+	m.Register(natsNotifier{m})
+	return m
 }
 
+// Emit records the event in the event log, publishes it to in-process
+// subscribers and delivers it to all subscribed notification targets
 func (m *Manager) Emit(ctx context.Context, event *Event) {
-	webhooks, err := m.getWebhooksForEvent(event.Type)
-	if err != nil {
-		slog.Error("Failed to get webhooks", "error", err)
-		return
+	m.record(event)
+	m.publish(event)
+	m.notify(ctx, event)
+}
+
+// Wait blocks until all in-flight webhook deliveries have finished,
+// including their retries
+func (m *Manager) Wait() {
+	m.deliveries.Wait()
+}
+
+// Stop ends pending retries, storing their deliveries as dead letters, sends
+// pending digests and waits for in-flight deliveries to finish
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	m.FlushDigests()
+	m.deliveries.Wait()
+}
+
+// Subscribe registers an in-process listener that receives every emitted event.
+// Events are dropped for subscribers whose buffer is full. The returned
+// function unsubscribes and closes the channel.
+func (m *Manager) Subscribe(buffer int) (<-chan *Event, func()) {
+	ch := make(chan *Event, buffer)
+
+	m.subMu.Lock()
+	m.subscribers[ch] = struct{}{}
+	m.subMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			m.subMu.Lock()
+			delete(m.subscribers, ch)
+			m.subMu.Unlock()
+			close(ch)
+		})
 	}
-	for _, webhook := range webhooks {
-		go m.deliverWebhook(ctx, webhook, event)
+}
+
+func (m *Manager) publish(event *Event) {
+	m.subMu.RLock()
+	defer m.subMu.RUnlock()
+	for ch := range m.subscribers {
+		select {
+		case ch <- event:
+		default:
+			slog.Warn("Dropping event for slow subscriber", "event", event.Type)
+		}
 	}
 }
 
-func (m *Manager) getWebhooksForEvent(eventType string) ([]database.Webhook, error) {
+// webhookNotifier delivers events to the configured webhooks and keeps
+// failed deliveries as dead letters
+type webhookNotifier struct {
+	m *Manager
+}
+
+func (n webhookNotifier) Name() string { return "webhook" }
+
+func (n webhookNotifier) Targets() ([]Target, error) {
 	var webhooks []database.Webhook
-	if err := m.db.Where("enabled = ?", true).Find(&webhooks).Error; err != nil {
+	if err := n.m.db.Where("enabled = ?", true).Find(&webhooks).Error; err != nil {
 		return nil, err
 	}
-
-	var matching []database.Webhook
-	for _, wh := range webhooks {
-		var events []string
-		if json.Unmarshal([]byte(wh.Events), &events) != nil {
-			continue
-		}
-		for _, e := range events {
-			if e == eventType || e == "*" {
-				matching = append(matching, wh)
-				break
-			}
+	targets := make([]Target, len(webhooks))
+	for i, wh := range webhooks {
+		targets[i] = Target{
+			ID:           wh.ID,
+			Subscription: Subscription{Events: wh.Events, Sources: wh.Sources, Products: wh.Products},
+			Config:       wh,
 		}
 	}
-	return matching, nil
+	return targets, nil
 }
 
-func (m *Manager) deliverWebhook(ctx context.Context, webhook database.Webhook, event *Event) {
-	payload, err := json.Marshal(event)
+// Deliver sends the event to the webhook, or adds it to the webhook's digest
+func (n webhookNotifier) Deliver(ctx context.Context, target Target, event *Event) error {
+	webhook := target.Config.(database.Webhook)
+	if webhook.DigestMinutes > 0 {
+		n.m.addToWebhookDigest(webhook, event)
+		return nil
+	}
+	payload, err := renderPayload(webhook, event)
 	if err != nil {
-		slog.Error("Failed to marshal event", "error", err, "webhookID", webhook.ID)
+		return Permanent(err)
+	}
+	return n.m.send(ctx, webhook, payload)
+}
+
+func (n webhookNotifier) DeadLetter(target Target, event *Event, attempts int, err error) {
+	payload, renderErr := renderPayload(target.Config.(database.Webhook), event)
+	if renderErr != nil {
 		return
 	}
+	n.m.storeDeadLetter(target.ID, event.Type, payload, attempts, err)
+}
 
+// send posts a payload to the webhook once
+func (m *Manager) send(ctx context.Context, webhook database.Webhook, payload []byte) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
 	if err != nil {
-		slog.Error("Failed to create request", "error", err, "webhookID", webhook.ID)
-		return
+		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "BulkFileLoader/1.0")
+	if webhook.Secret != "" {
+		req.Header.Set(SignatureHeader, Signature(webhook.Secret, payload))
+	}
 
 	if len(webhook.Headers) > 0 {
 		var headers map[string]string
@@ -84,14 +197,14 @@ func (m *Manager) deliverWebhook(ctx context.Context, webhook database.Webhook,
 
 	resp, err := m.httpClient.Do(req)
 	if err != nil {
-		slog.Error("Webhook delivery failed", "error", err, "webhookID", webhook.ID)
-		return
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		slog.Warn("Webhook error", "status", resp.StatusCode, "webhookID", webhook.ID)
+		return &StatusError{StatusCode: resp.StatusCode}
 	}
+	return nil
 }
 
 func (m *Manager) CreateWebhook(name, url string, events []string) (*database.Webhook, error) {
@@ -124,8 +237,54 @@ func (m *Manager) UpdateWebhook(id uint, name, url string, events []string, enab
 	}).Error
 }
 
+// SetWebhookFilters limits a webhook to events of the given sources and
+// products; an empty list matches all
+func (m *Manager) SetWebhookFilters(id uint, sourceIDs, productIDs []string) error {
+	sourcesJSON, err := json.Marshal(sourceIDs)
+	if err != nil {
+		return err
+	}
+	productsJSON, err := json.Marshal(productIDs)
+	if err != nil {
+		return err
+	}
+	return m.db.Model(&database.Webhook{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"sources":  string(sourcesJSON),
+		"products": string(productsJSON),
+	}).Error
+}
+
+// SetWebhookSecret sets the secret payloads are signed with; an empty secret
+// sends them unsigned
+func (m *Manager) SetWebhookSecret(id uint, secret string) error {
+	return m.db.Model(&database.Webhook{}).Where("id = ?", id).Update("secret", secret).Error
+}
+
+// Signature returns the value of SignatureHeader for a payload, so receivers
+// can check an event came from the loader
+func Signature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeleteWebhook removes a webhook with its dead letters; a pending digest is
+// discarded
 func (m *Manager) DeleteWebhook(id uint) error {
-	return m.db.Delete(&database.Webhook{}, id).Error
+	if err := m.db.Where("webhook_id = ?", id).Delete(&database.WebhookDeadLetter{}).Error; err != nil {
+		return err
+	}
+	if err := m.db.Delete(&database.Webhook{}, id).Error; err != nil {
+		return err
+	}
+
+	m.webhookDigestMu.Lock()
+	if d, ok := m.webhookDigests[id]; ok {
+		d.timer.Stop()
+		delete(m.webhookDigests, id)
+	}
+	m.webhookDigestMu.Unlock()
+	return nil
 }
 
 func (m *Manager) ListWebhooks() ([]database.Webhook, error) {
@@ -147,6 +306,13 @@ func ParseEvents(eventsJSON string) []string {
 	return events
 }
 
+// ParseIDs decodes a webhook's source or product filter
+func ParseIDs(idsJSON string) []string {
+	var ids []string
+	json.Unmarshal([]byte(idsJSON), &ids)
+	return ids
+}
+
 func AllEvents() []string {
 	return []string{
 		EventFileAvailable,
@@ -157,6 +323,13 @@ func AllEvents() []string {
 		EventChecksumMismatch,
 		EventSyncCompleted,
 		EventSyncFailed,
+		EventCredentialsExpiring,
+		EventCredentialsAccessed,
+		EventDeliveryExpiring,
+		EventDownloadInvalid,
+		EventFileProcessed,
+		EventPipelineFailed,
+		EventStorageQuotaExceeded,
 	}
 }
 
@@ -1,15 +1,21 @@
 package hooks
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/patent-dev/bulk-file-loader/internal/aws"
 	"github.com/patent-dev/bulk-file-loader/internal/database"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -24,7 +30,7 @@ func setupTestDB(t *testing.T) *database.DB {
 	if err != nil {
 		t.Fatal(err)
 	}
-	gormDB.AutoMigrate(&database.Webhook{})
+	gormDB.AutoMigrate(&database.Webhook{}, &database.WebhookDeadLetter{}, &database.SlackNotifier{}, &database.EmailNotifier{}, &database.ChatNotifier{}, &database.Event{}, &database.NatsPublisher{})
 	return &database.DB{DB: gormDB}
 }
 
@@ -243,6 +249,32 @@ func TestDisabledWebhookNotDelivered(t *testing.T) {
 	}
 }
 
+func TestSubscribe(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+
+	events, unsubscribe := manager.Subscribe(1)
+
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "s1"))
+
+	select {
+	case event := <-events:
+		if event.Type != EventSyncCompleted {
+			t.Errorf("Event type = %q, want %q", event.Type, EventSyncCompleted)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Subscriber did not receive event")
+	}
+
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Error("Channel should be closed after unsubscribe")
+	}
+
+	// Emitting after unsubscribe must not panic
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "s1"))
+}
+
 func TestParseEvents(t *testing.T) {
 	events := ParseEvents(`["download.completed","download.failed"]`)
 	if len(events) != 2 {
@@ -330,3 +362,767 @@ func TestEventBuilder(t *testing.T) {
 		t.Error("Alerts not set correctly")
 	}
 }
+
+func TestEmitSignsPayload(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+
+	signatures := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got := r.Header.Get(SignatureHeader)
+		if got != "" && got != Signature("s3cret", body) {
+			got = "invalid"
+		}
+		signatures <- got
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	webhook, _ := manager.CreateWebhook("Signed", server.URL, []string{"*"})
+	if err := manager.SetWebhookSecret(webhook.ID, "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "source-1"))
+	manager.Wait()
+	if got := <-signatures; got == "" || got == "invalid" {
+		t.Errorf("signature = %q, want a valid signature", got)
+	}
+
+	manager.SetWebhookSecret(webhook.ID, "")
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "source-1"))
+	manager.Wait()
+	if got := <-signatures; got != "" {
+		t.Errorf("signature = %q without a secret, want none", got)
+	}
+}
+
+func TestEmitFiltersBySourceAndProduct(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		json.NewDecoder(r.Body).Decode(&event)
+		product := ""
+		if event.Product != nil {
+			product = event.Product.ID
+		}
+		received <- event.Source + "/" + product
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	webhook, _ := manager.CreateWebhook("EBD only", server.URL, []string{"*"})
+	if err := manager.SetWebhookFilters(webhook.ID, []string{"epo"}, []string{"ebd"}); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "uspto").WithProduct("ebd", "EBD"))
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "epo").WithProduct("docdb", "DOCDB"))
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "epo"))
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "epo").WithProduct("ebd", "EBD"))
+	manager.Wait()
+	close(received)
+
+	var got []string
+	for r := range received {
+		got = append(got, r)
+	}
+	if len(got) != 1 || got[0] != "epo/ebd" {
+		t.Errorf("received %v, want [epo/ebd]", got)
+	}
+
+	updated, _ := manager.GetWebhook(webhook.ID)
+	if sources := ParseIDs(updated.Sources); len(sources) != 1 || sources[0] != "epo" {
+		t.Errorf("Sources = %v, want [epo]", sources)
+	}
+}
+
+func TestCredentialsAccessedIsOptIn(t *testing.T) {
+	event := NewEvent(EventCredentialsAccessed, "epo").WithAudit("decrypted", "system")
+	if (Subscription{Events: `["*"]`}).Matches(event) {
+		t.Error("the wildcard should not match credentials.accessed")
+	}
+	if !(Subscription{Events: `["credentials.accessed"]`}).Matches(event) {
+		t.Error("an explicit subscription should match credentials.accessed")
+	}
+}
+
+func TestEmitRendersTemplate(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	webhook, _ := manager.CreateWebhook("Jenkins", server.URL, []string{"*"})
+	tmpl := `{"job":"import","source":{{json .Source}}{{with .Product}},"product":{{json .Name}}{{end}}}`
+	if err := manager.SetWebhookTemplate(webhook.ID, tmpl); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "epo").WithProduct("ebd", `EBD "full"`))
+	manager.Wait()
+	want := `{"job":"import","source":"epo","product":"EBD \"full\""}`
+	if got := <-bodies; got != want {
+		t.Errorf("payload = %s, want %s", got, want)
+	}
+
+	if err := manager.SetWebhookTemplate(webhook.ID, "{{.Type"); err == nil {
+		t.Error("SetWebhookTemplate accepted an invalid template")
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+
+	type message struct {
+		auth    string
+		channel string
+		text    string
+	}
+	messages := make(chan message, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		messages <- message{r.Header.Get("Authorization"), body["channel"], body["text"]}
+		if r.URL.Path == "/api/chat.postMessage" {
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer server.Close()
+
+	orig := slackPostMessageURL
+	slackPostMessageURL = server.URL + "/api/chat.postMessage"
+	defer func() { slackPostMessageURL = orig }()
+
+	incoming := &database.SlackNotifier{
+		Name:       "Incoming",
+		WebhookURL: server.URL + "/services/T000/B000/XXX",
+		Events:     EncodeList([]string{EventDownloadCompleted}),
+		Sources:    EncodeList([]string{"epo"}),
+		Enabled:    true,
+	}
+	if err := manager.CreateSlackNotifier(incoming); err != nil {
+		t.Fatal(err)
+	}
+	bot := &database.SlackNotifier{
+		Name:     "Bot",
+		BotToken: "xoxb-test",
+		Channel:  "#patents",
+		Events:   EncodeList([]string{EventSyncFailed}),
+		Template: `Sync of {{.Source}} failed{{with .Error}}: {{.Message}}{{end}}`,
+		Enabled:  true,
+	}
+	if err := manager.CreateSlackNotifier(bot); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.Emit(context.Background(), NewEvent(EventDownloadCompleted, "uspto").WithProduct("ptgrxml", "Grants"))
+	manager.Emit(context.Background(), NewEvent(EventDownloadCompleted, "epo").
+		WithProduct("ebd", "EBD").
+		WithFile("f1", "EBD_2024_01.zip", 1024, "", ""))
+	manager.Emit(context.Background(), NewEvent(EventSyncFailed, "epo").WithError("TIMEOUT", "timed out"))
+	manager.Wait()
+	close(messages)
+
+	var got []message
+	for m := range messages {
+		got = append(got, m)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d messages, want 2: %+v", len(got), got)
+	}
+	for _, m := range got {
+		switch m.auth {
+		case "":
+			if want := "*download.completed* epo / EBD: EBD_2024_01.zip"; m.text != want {
+				t.Errorf("incoming webhook text = %q, want %q", m.text, want)
+			}
+		case "Bearer xoxb-test":
+			if m.channel != "#patents" || m.text != "Sync of epo failed: timed out" {
+				t.Errorf("bot message = %+v", m)
+			}
+		default:
+			t.Errorf("unexpected Authorization %q", m.auth)
+		}
+	}
+
+	if err := manager.CreateSlackNotifier(&database.SlackNotifier{Name: "Incomplete", BotToken: "xoxb-test"}); err == nil {
+		t.Error("CreateSlackNotifier accepted a bot token without a channel")
+	}
+}
+
+func TestSlackBotError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+	}))
+	defer server.Close()
+
+	orig := slackPostMessageURL
+	slackPostMessageURL = server.URL
+	defer func() { slackPostMessageURL = orig }()
+
+	manager := New(setupTestDB(t))
+	notifier := database.SlackNotifier{BotToken: "xoxb-test", Channel: "#missing"}
+	err := slackNotifier{manager}.Deliver(context.Background(), Target{Config: notifier}, NewEvent(EventSyncCompleted, "epo"))
+	if err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Errorf("Deliver error = %v, want channel_not_found", err)
+	}
+	if retryableDelivery(err) {
+		t.Error("channel_not_found should not be retried")
+	}
+}
+
+func TestChatNotifiers(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+
+	bodies := make(chan map[string]any, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	for _, n := range []*database.ChatNotifier{
+		{Name: "Discord", Platform: ChatDiscord, WebhookURL: server.URL + "/discord", Events: EncodeList([]string{EventDownloadFailed}), Enabled: true},
+		{Name: "Teams", Platform: ChatTeams, WebhookURL: server.URL + "/teams", Events: EncodeList([]string{EventDownloadFailed}), Enabled: true},
+	} {
+		if err := manager.CreateChatNotifier(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager.Emit(context.Background(), NewEvent(EventDownloadFailed, "epo").
+		WithProduct("ebd", "EBD").
+		WithError("TIMEOUT", "timed out"))
+	manager.Emit(context.Background(), NewEvent(EventDownloadCompleted, "epo"))
+	manager.Wait()
+	close(bodies)
+
+	var discord, teams int
+	for body := range bodies {
+		if embeds, ok := body["embeds"].([]any); ok {
+			embed := embeds[0].(map[string]any)
+			if embed["title"] != EventDownloadFailed || embed["color"] != float64(discordColors["error"]) {
+				t.Errorf("Discord embed = %v", embed)
+			}
+			discord++
+		}
+		if body["type"] == "message" {
+			card := body["attachments"].([]any)[0].(map[string]any)["content"].(map[string]any)
+			facts := card["body"].([]any)[1].(map[string]any)["facts"].([]any)
+			if len(facts) != 3 {
+				t.Errorf("Teams facts = %v, want source, product and error", facts)
+			}
+			teams++
+		}
+	}
+	if discord != 1 || teams != 1 {
+		t.Errorf("got %d Discord and %d Teams messages, want 1 each", discord, teams)
+	}
+
+	invalid := &database.ChatNotifier{Name: "IRC", Platform: "irc", WebhookURL: server.URL}
+	if err := manager.CreateChatNotifier(invalid); err == nil {
+		t.Error("CreateChatNotifier accepted an unsupported platform")
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+
+	type sent struct {
+		to  []string
+		msg string
+	}
+	var mu sync.Mutex
+	var mails []sent
+	orig := sendMail
+	sendMail = func(cfg SMTPConfig, to []string, msg []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		mails = append(mails, sent{to, string(msg)})
+		return nil
+	}
+	defer func() { sendMail = orig }()
+
+	notifier := &database.EmailNotifier{
+		Name:       "Ops",
+		Recipients: EncodeList([]string{"ops@example.com"}),
+		Enabled:    true,
+	}
+	if err := manager.CreateEmailNotifier(notifier); err == nil {
+		t.Error("CreateEmailNotifier succeeded without SMTP")
+	}
+
+	manager.SetSMTP(SMTPConfig{Host: "smtp.example.com", Port: 587, From: "loader@example.com"})
+	if err := manager.CreateEmailNotifier(notifier); err != nil {
+		t.Fatal(err)
+	}
+	if events := ParseEvents(notifier.Events); len(events) != len(DefaultEmailEvents) {
+		t.Errorf("Events = %v, want the defaults", events)
+	}
+	digest := &database.EmailNotifier{
+		Name:          "Daily",
+		Recipients:    EncodeList([]string{"Team <team@example.com>"}),
+		Events:        EncodeList([]string{"*"}),
+		DigestMinutes: 60,
+		Enabled:       true,
+	}
+	if err := manager.CreateEmailNotifier(digest); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.Emit(context.Background(), NewEvent(EventDownloadFailed, "epo").
+		WithProduct("ebd", "EBD").
+		WithFile("f1", "EBD_2024_01.zip", 0, "", "").
+		WithError("TIMEOUT", "timed out"))
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "epo"))
+	manager.Wait()
+
+	mu.Lock()
+	if len(mails) != 1 || mails[0].to[0] != "ops@example.com" ||
+		!strings.Contains(mails[0].msg, "Subject: [Bulk File Loader] download.failed epo / EBD / EBD_2024_01.zip (TIMEOUT: timed out)") {
+		t.Errorf("immediate mails = %+v", mails)
+	}
+	mails = nil
+	mu.Unlock()
+
+	manager.Stop()
+	if len(mails) != 1 || mails[0].to[0] != "Team <team@example.com>" ||
+		!strings.Contains(mails[0].msg, "Subject: [Bulk File Loader] 2 events") ||
+		!strings.Contains(mails[0].msg, "sync.completed epo") {
+		t.Errorf("digest mails = %+v", mails)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	// HMAC-SHA256 of "hello" with key "key"
+	want := "sha256=9307b3b915efb5171ff14d8cb55fbcc798c6c0ef1456d66ded1a6aa723a58b7b"
+	if got := Signature("key", []byte("hello")); got != want {
+		t.Errorf("Signature = %q, want %q", got, want)
+	}
+}
+
+// recordingNotifier fails the first deliveries and records the events it got
+type recordingNotifier struct {
+	failures atomic.Int32
+	mu       sync.Mutex
+	events   []string
+}
+
+func (r *recordingNotifier) Name() string { return "recording" }
+
+func (r *recordingNotifier) Targets() ([]Target, error) {
+	return []Target{{ID: 1, Subscription: Subscription{
+		Events:  EncodeList([]string{EventDownloadFailed}),
+		Sources: EncodeList([]string{"epo"}),
+	}}}, nil
+}
+
+func (r *recordingNotifier) Deliver(ctx context.Context, target Target, event *Event) error {
+	if r.failures.Add(-1) >= 0 {
+		return errors.New("unavailable")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event.Type+"/"+event.Source)
+	return nil
+}
+
+func TestRegisterNotifier(t *testing.T) {
+	manager := New(setupTestDB(t))
+	manager.SetRetryPolicy(2, time.Millisecond)
+
+	notifier := &recordingNotifier{}
+	notifier.failures.Store(2)
+	manager.Register(notifier)
+
+	manager.Emit(context.Background(), NewEvent(EventDownloadFailed, "uspto"))
+	manager.Emit(context.Background(), NewEvent(EventDownloadCompleted, "epo"))
+	manager.Emit(context.Background(), NewEvent(EventDownloadFailed, "epo"))
+	manager.Wait()
+
+	if len(notifier.events) != 1 || notifier.events[0] != "download.failed/epo" {
+		t.Errorf("events = %v, want [download.failed/epo] after two retries", notifier.events)
+	}
+	if retryableDelivery(Permanent(errors.New("rejected"))) {
+		t.Error("permanent errors should not be retried")
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+	manager.SetRetryPolicy(3, 10*time.Millisecond)
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	manager.CreateWebhook("Flaky", server.URL, []string{"*"})
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "source-1"))
+	manager.Wait()
+
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3", calls.Load())
+	}
+	if letters, _ := manager.ListDeadLetters(0); len(letters) != 0 {
+		t.Errorf("%d dead letters for a delivery that succeeded", len(letters))
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+	manager.SetRetryPolicy(1, 10*time.Millisecond)
+
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	webhook, _ := manager.CreateWebhook("Down", server.URL, []string{"*"})
+	manager.Emit(context.Background(), NewEvent(EventSyncFailed, "source-1"))
+	manager.Wait()
+
+	letters, _ := manager.ListDeadLetters(webhook.ID)
+	if len(letters) != 1 {
+		t.Fatalf("%d dead letters, want 1", len(letters))
+	}
+	letter := letters[0]
+	if letter.Attempts != 2 || letter.Event != EventSyncFailed || letter.LastError != "webhook returned status 500" {
+		t.Errorf("dead letter = %+v", letter)
+	}
+	var payload Event
+	if err := json.Unmarshal(letter.Payload, &payload); err != nil || payload.Source != "source-1" {
+		t.Errorf("payload = %s", letter.Payload)
+	}
+
+	if err := manager.ReplayDeadLetter(context.Background(), letter.ID); err == nil {
+		t.Error("replay against a failing webhook should fail")
+	}
+	status.Store(http.StatusOK)
+	if err := manager.ReplayDeadLetter(context.Background(), letter.ID); err != nil {
+		t.Fatalf("ReplayDeadLetter: %v", err)
+	}
+	if letters, _ := manager.ListDeadLetters(0); len(letters) != 0 {
+		t.Errorf("%d dead letters after a successful replay", len(letters))
+	}
+	if err := manager.ReplayDeadLetter(context.Background(), letter.ID); err != ErrDeadLetterNotFound {
+		t.Errorf("replaying a removed dead letter = %v, want ErrDeadLetterNotFound", err)
+	}
+
+	// Client errors are not retried
+	calls.Store(0)
+	status.Store(http.StatusNotFound)
+	manager.Emit(context.Background(), NewEvent(EventSyncFailed, "source-1"))
+	manager.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d for a 404, want 1", calls.Load())
+	}
+}
+
+func TestStopEndsRetries(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+	manager.SetRetryPolicy(3, time.Hour)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	manager.CreateWebhook("Down", server.URL, []string{"*"})
+	manager.Emit(context.Background(), NewEvent(EventSyncFailed, "source-1"))
+
+	done := make(chan struct{})
+	go func() {
+		manager.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not end the pending retry")
+	}
+	if letters, _ := manager.ListDeadLetters(0); len(letters) != 1 {
+		t.Errorf("%d dead letters, want the stopped delivery kept", len(letters))
+	}
+}
+
+func TestReplayEvents(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+
+	bodies := make(chan Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		json.NewDecoder(r.Body).Decode(&event)
+		bodies <- event
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	start := time.Now().Add(-time.Minute)
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "epo"))
+	manager.Emit(context.Background(), NewEvent(EventDownloadFailed, "epo"))
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "uspto"))
+	manager.Wait()
+
+	// Created after the events were emitted, as for a receiver set up late
+	webhook, _ := manager.CreateWebhook("Late", server.URL, []string{EventSyncCompleted, EventDownloadFailed})
+
+	count, err := manager.ReplayEvents(webhook.ID, ReplayFilter{Types: []string{EventSyncCompleted}, Since: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Wait()
+	if count != 2 || len(bodies) != 2 {
+		t.Fatalf("replayed %d events, delivered %d, want 2", count, len(bodies))
+	}
+	if first := <-bodies; first.Source != "epo" || first.Type != EventSyncCompleted {
+		t.Errorf("first replayed event = %s/%s, want oldest first", first.Type, first.Source)
+	}
+
+	count, _ = manager.ReplayEvents(webhook.ID, ReplayFilter{Since: time.Now().Add(time.Minute)})
+	if count != 0 {
+		t.Errorf("replayed %d events from the future", count)
+	}
+	if _, err := manager.ReplayEvents(999, ReplayFilter{Since: start}); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("unknown webhook: err = %v, want ErrWebhookNotFound", err)
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+	manager.SetEventRetention(30 * 24 * time.Hour)
+
+	old := &database.Event{Type: EventSyncCompleted, Source: "epo", Payload: []byte(`{}`), CreatedAt: time.Now().AddDate(0, 0, -31).UTC()}
+	db.Create(old)
+
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "epo"))
+	manager.Emit(context.Background(), NewEvent(EventDownloadFailed, "uspto"))
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "uspto"))
+
+	events, err := manager.ListEvents("", time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("listed %d events, want 3 after the expired one was pruned", len(events))
+	}
+	if events[0].Type != EventSyncCompleted || events[0].Source != "uspto" {
+		t.Errorf("first event = %s/%s, want newest first", events[0].Type, events[0].Source)
+	}
+
+	events, _ = manager.ListEvents(EventSyncCompleted, time.Now().Add(-time.Minute), 10)
+	if len(events) != 2 {
+		t.Errorf("listed %d sync.completed events, want 2", len(events))
+	}
+	events, _ = manager.ListEvents("", time.Now().Add(time.Minute), 10)
+	if len(events) != 0 {
+		t.Errorf("listed %d events from the future", len(events))
+	}
+
+	deleted, err := manager.PruneEvents(time.Now().Add(time.Minute))
+	if err != nil || deleted != 3 {
+		t.Errorf("PruneEvents = %d, %v, want 3", deleted, err)
+	}
+}
+
+func TestWebhookDigest(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	webhook, _ := manager.CreateWebhook("Hourly", server.URL, []string{EventFileAvailable})
+	if err := manager.SetWebhookDigest(webhook.ID, 60); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.Emit(context.Background(), NewEvent(EventFileAvailable, "epo").WithFile("1", "a.zip", 1, "", ""))
+	manager.Emit(context.Background(), NewEvent(EventFileAvailable, "epo").WithFile("2", "b.zip", 1, "", ""))
+	manager.Emit(context.Background(), NewEvent(EventSyncCompleted, "epo"))
+	manager.Wait()
+	if len(bodies) != 0 {
+		t.Fatalf("%d payloads sent before the digest was due", len(bodies))
+	}
+
+	manager.FlushDigests()
+	manager.Wait()
+	if len(bodies) != 1 {
+		t.Fatalf("sent %d payloads, want one digest", len(bodies))
+	}
+	var digest Digest
+	if err := json.Unmarshal(<-bodies, &digest); err != nil {
+		t.Fatal(err)
+	}
+	if digest.Type != EventDigest || len(digest.Events) != 2 || digest.Events[1].File.Name != "b.zip" {
+		t.Errorf("digest = %+v, want both file.available events in order", digest)
+	}
+
+	if err := manager.SetWebhookDigest(webhook.ID, -1); err == nil {
+		t.Error("SetWebhookDigest accepted a negative interval")
+	}
+}
+
+func TestNatsPublishers(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	subjects := make(chan string, 10)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.WriteString(c, "INFO {\"max_payload\":1048576}\r\n")
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch fields[0] {
+					case "PUB":
+						subjects <- fields[1]
+						// Skip the payload
+						r.ReadString('\n')
+					case "PING":
+						io.WriteString(c, "PONG\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	url := "nats://" + ln.Addr().String()
+
+	if err := manager.SetNATS(NATSConfig{URL: url, Subject: "loader"}); err != nil {
+		t.Fatal(err)
+	}
+	publisher := &database.NatsPublisher{Name: "Failures", URL: url, Subject: "ops.alerts", Events: EncodeList([]string{EventDownloadFailed}), Enabled: true}
+	if err := manager.CreateNatsPublisher(publisher); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.Emit(context.Background(), NewEvent(EventDownloadFailed, "epo"))
+	manager.Emit(context.Background(), NewEvent(EventDownloadCompleted, "epo"))
+	manager.Wait()
+	close(subjects)
+
+	got := make(map[string]int)
+	for subject := range subjects {
+		got[subject]++
+	}
+	want := map[string]int{"loader.download.failed": 1, "loader.download.completed": 1, "ops.alerts.download.failed": 1}
+	if len(got) != len(want) {
+		t.Errorf("published to %v, want %v", got, want)
+	}
+	for subject, n := range want {
+		if got[subject] != n {
+			t.Errorf("published %d events to %s, want %d", got[subject], subject, n)
+		}
+	}
+
+	for _, p := range []*database.NatsPublisher{
+		{Name: "HTTP", URL: "http://localhost:4222", Subject: "loader"},
+		{Name: "Wildcard", URL: url, Subject: "loader.>"},
+		{Name: "Empty token", URL: url, Subject: "loader..events"},
+	} {
+		if err := manager.CreateNatsPublisher(p); err == nil {
+			t.Errorf("CreateNatsPublisher accepted %q", p.Name)
+		}
+	}
+}
+
+func TestAWSPublishers(t *testing.T) {
+	db := setupTestDB(t)
+	manager := New(db)
+
+	forms := make(chan map[string]string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form := make(map[string]string)
+		for name := range r.PostForm {
+			form[name] = r.PostForm.Get(name)
+		}
+		forms <- form
+	}))
+	defer server.Close()
+
+	client := aws.NewClient(aws.Config{AccessKeyID: "AKID", SecretAccessKey: "secret", Endpoint: server.URL})
+	manager.Register(NewSQSPublisher(client, "https://sqs.eu-west-1.amazonaws.com/123456789012/events"))
+	manager.Register(NewSNSPublisher(client, "arn:aws:sns:eu-west-1:123456789012:events"))
+
+	manager.Emit(context.Background(), NewEvent(EventDownloadCompleted, "epo").WithProduct("ebd", "EBD"))
+	manager.Wait()
+	close(forms)
+
+	actions := make(map[string]bool)
+	for form := range forms {
+		actions[form["Action"]] = true
+		attributes := make(map[string]string)
+		for name, value := range form {
+			if strings.HasSuffix(name, ".Name") {
+				attributes[value] = form[strings.TrimSuffix(name, "Name")+"Value.StringValue"]
+			}
+		}
+		if attributes["event"] != EventDownloadCompleted || attributes["source"] != "epo" || attributes["product"] != "ebd" {
+			t.Errorf("%s attributes = %v", form["Action"], attributes)
+		}
+	}
+	if !actions["SendMessage"] || !actions["Publish"] {
+		t.Errorf("actions = %v, want SendMessage and Publish", actions)
+	}
+
+	denied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<ErrorResponse><Error><Code>AccessDenied</Code></Error></ErrorResponse>")
+	}))
+	defer denied.Close()
+	publisher := NewSNSPublisher(aws.NewClient(aws.Config{Endpoint: denied.URL}), "arn:aws:sns:eu-west-1:123456789012:events")
+	err := publisher.Deliver(context.Background(), Target{}, NewEvent(EventDownloadCompleted, "epo"))
+	var permanent *permanentError
+	if !errors.As(err, &permanent) {
+		t.Errorf("Deliver with denied access = %v, want a permanent error", err)
+	}
+}
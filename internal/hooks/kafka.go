@@ -0,0 +1,42 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/patent-dev/bulk-file-loader/internal/kafka"
+)
+
+// KafkaPublisher publishes every event as JSON to a Kafka topic. Records are
+// keyed by the event's source, so each source's events stay in order.
+type KafkaPublisher struct {
+	producer *kafka.Producer
+	topic    string
+}
+
+func NewKafkaPublisher(cfg kafka.Config, topic string) *KafkaPublisher {
+	return &KafkaPublisher{producer: kafka.NewProducer(cfg), topic: topic}
+}
+
+func (p *KafkaPublisher) Name() string { return "kafka" }
+
+// Targets returns the topic, subscribed to all events
+func (p *KafkaPublisher) Targets() ([]Target, error) {
+	return []Target{{Subscription: Subscription{Events: `["*"]`}, Config: p.topic}}, nil
+}
+
+// Deliver publishes the event. Broker errors that retrying won't fix, such as
+// failed authentication, are permanent.
+func (p *KafkaPublisher) Deliver(ctx context.Context, target Target, event *Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return Permanent(err)
+	}
+	err = p.producer.Produce(ctx, p.topic, []byte(event.Source), value)
+	var kerr kafka.Error
+	if errors.As(err, &kerr) && !kerr.Retriable() {
+		return Permanent(err)
+	}
+	return err
+}
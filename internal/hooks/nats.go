@@ -0,0 +1,138 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/nats"
+)
+
+// ErrNatsPublisherNotFound is returned for unknown NATS publisher IDs
+var ErrNatsPublisherNotFound = errors.New("NATS publisher not found")
+
+// NATSConfig is a NATS publisher configured in the environment, receiving
+// all events in addition to those configured through the API
+type NATSConfig struct {
+	URL       string
+	Subject   string
+	JetStream bool
+}
+
+// SetNATS sets the publisher configured in the environment; an empty URL
+// disables it
+func (m *Manager) SetNATS(cfg NATSConfig) error {
+	if cfg.URL != "" {
+		if err := ValidateNatsPublisher(&database.NatsPublisher{URL: cfg.URL, Subject: cfg.Subject}); err != nil {
+			return err
+		}
+	}
+	m.natsMu.Lock()
+	defer m.natsMu.Unlock()
+	m.nats = cfg
+	return nil
+}
+
+func (m *Manager) natsConfig() NATSConfig {
+	m.natsMu.Lock()
+	defer m.natsMu.Unlock()
+	return m.nats
+}
+
+// ValidateNatsPublisher checks the server URL and the subject prefix
+func ValidateNatsPublisher(p *database.NatsPublisher) error {
+	if _, err := nats.ParseURL(p.URL); err != nil {
+		return err
+	}
+	if !nats.ValidSubject(p.Subject) {
+		return fmt.Errorf("invalid subject %q, want dot-separated tokens without wildcards", p.Subject)
+	}
+	return nil
+}
+
+func (m *Manager) ListNatsPublishers() ([]database.NatsPublisher, error) {
+	var publishers []database.NatsPublisher
+	return publishers, m.db.Find(&publishers).Error
+}
+
+func (m *Manager) GetNatsPublisher(id uint) (*database.NatsPublisher, error) {
+	var publisher database.NatsPublisher
+	if err := m.db.First(&publisher, id).Error; err != nil {
+		return nil, ErrNatsPublisherNotFound
+	}
+	return &publisher, nil
+}
+
+func (m *Manager) CreateNatsPublisher(p *database.NatsPublisher) error {
+	if err := ValidateNatsPublisher(p); err != nil {
+		return err
+	}
+	return m.db.Create(p).Error
+}
+
+func (m *Manager) UpdateNatsPublisher(p *database.NatsPublisher) error {
+	if err := ValidateNatsPublisher(p); err != nil {
+		return err
+	}
+	return m.db.Save(p).Error
+}
+
+func (m *Manager) DeleteNatsPublisher(id uint) error {
+	result := m.db.Delete(&database.NatsPublisher{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNatsPublisherNotFound
+	}
+	return nil
+}
+
+// natsNotifier publishes events as JSON to <subject>.<event type>
+type natsNotifier struct {
+	m *Manager
+}
+
+func (n natsNotifier) Name() string { return "nats" }
+
+// Targets returns the publisher configured in the environment, if any, as
+// target 0 and the enabled publishers configured through the API
+func (n natsNotifier) Targets() ([]Target, error) {
+	var publishers []database.NatsPublisher
+	if err := n.m.db.Where("enabled = ?", true).Find(&publishers).Error; err != nil {
+		return nil, err
+	}
+	var targets []Target
+	if cfg := n.m.natsConfig(); cfg.URL != "" {
+		targets = append(targets, Target{
+			Subscription: Subscription{Events: `["*"]`},
+			Config:       database.NatsPublisher{URL: cfg.URL, Subject: cfg.Subject, JetStream: cfg.JetStream},
+		})
+	}
+	for _, p := range publishers {
+		targets = append(targets, Target{
+			ID:           p.ID,
+			Subscription: Subscription{Events: p.Events, Sources: p.Sources, Products: p.Products},
+			Config:       p,
+		})
+	}
+	return targets, nil
+}
+
+// Deliver publishes the event. Errors reported by the server, such as a
+// permissions violation, and oversized events are permanent.
+func (n natsNotifier) Deliver(ctx context.Context, target Target, event *Event) error {
+	p := target.Config.(database.NatsPublisher)
+	data, err := json.Marshal(event)
+	if err != nil {
+		return Permanent(err)
+	}
+	err = nats.Publish(ctx, p.URL, p.Subject+"."+event.Type, data, p.JetStream)
+	var serverErr *nats.ServerError
+	if errors.As(err, &serverErr) || errors.Is(err, nats.ErrPayloadTooLarge) {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+)
+
+// Notifier delivers events over one transport, e.g. webhooks or Slack. The
+// manager matches its targets against each event and retries failed
+// deliveries, so a notifier only lists targets and sends to one.
+type Notifier interface {
+	// Name identifies the transport in logs, e.g. "webhook"
+	Name() string
+	// Targets returns the enabled targets
+	Targets() ([]Target, error)
+	// Deliver sends an event to a target once
+	Deliver(ctx context.Context, target Target, event *Event) error
+}
+
+// DeadLetterer is implemented by notifiers that keep deliveries which still
+// failed after all retries
+type DeadLetterer interface {
+	DeadLetter(target Target, event *Event, attempts int, err error)
+}
+
+// Target is one configured destination of a notifier, e.g. a webhook or a
+// Slack channel
+type Target struct {
+	ID           uint
+	Subscription Subscription
+	// Config holds the transport's settings, e.g. a database.Webhook
+	Config any
+}
+
+// Subscription selects the events a target receives. Each field is a JSON
+// array as stored on the target; empty sources or products match all.
+type Subscription struct {
+	Events   string
+	Sources  string
+	Products string
+}
+
+// Matches reports whether an event passes the subscription's event type,
+// source and product filters
+func (s Subscription) Matches(event *Event) bool {
+	var events []string
+	if json.Unmarshal([]byte(s.Events), &events) != nil {
+		return false
+	}
+	if !slices.Contains(events, event.Type) &&
+		(!slices.Contains(events, "*") || event.Type == EventCredentialsAccessed) {
+		return false
+	}
+	if sources := ParseIDs(s.Sources); len(sources) > 0 && !slices.Contains(sources, event.Source) {
+		return false
+	}
+	// Events without a product, e.g. credentials.expiring, don't match a
+	// product filter
+	if products := ParseIDs(s.Products); len(products) > 0 &&
+		(event.Product == nil || !slices.Contains(products, event.Product.ID)) {
+		return false
+	}
+	return true
+}
+
+// permanentError is a delivery error retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a delivery error as not worth retrying, e.g. a rejected
+// recipient
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Register adds a notifier; events emitted afterwards are delivered to its
+// targets too
+func (m *Manager) Register(n Notifier) {
+	m.notifierMu.Lock()
+	defer m.notifierMu.Unlock()
+	m.notifiers = append(m.notifiers, n)
+}
+
+func (m *Manager) registered() []Notifier {
+	m.notifierMu.RLock()
+	defer m.notifierMu.RUnlock()
+	return slices.Clone(m.notifiers)
+}
+
+// notify starts a delivery to every target subscribed to the event
+func (m *Manager) notify(ctx context.Context, event *Event) {
+	for _, n := range m.registered() {
+		targets, err := n.Targets()
+		if err != nil {
+			slog.Error("Failed to get notification targets", "notifier", n.Name(), "error", err)
+			continue
+		}
+		for _, target := range targets {
+			if !target.Subscription.Matches(event) {
+				continue
+			}
+			m.deliveries.Add(1)
+			go func(n Notifier, target Target) {
+				defer m.deliveries.Done()
+				m.deliver(ctx, n, target, event)
+			}(n, target)
+		}
+	}
+}
+
+// deliver sends an event to a target, retrying failures with backoff. A
+// delivery that still fails is handed to the notifier's DeadLetter, if any.
+func (m *Manager) deliver(ctx context.Context, n Notifier, target Target, event *Event) {
+	retries, delay := m.retryPolicy()
+	attempt := 1
+	var err error
+	for {
+		err = n.Deliver(ctx, target, event)
+		if err == nil {
+			return
+		}
+		if attempt > retries || !retryableDelivery(err) {
+			break
+		}
+		wait := retryBackoff(delay, attempt)
+		slog.Warn("Notification failed, retrying", "notifier", n.Name(), "error", err, "targetID", target.ID, "attempt", attempt, "delay", wait)
+		if !m.sleep(ctx, wait) {
+			break
+		}
+		attempt++
+	}
+
+	slog.Error("Notification failed", "notifier", n.Name(), "error", err, "targetID", target.ID, "event", event.Type, "attempts", attempt)
+	if dl, ok := n.(DeadLetterer); ok {
+		dl.DeadLetter(target, event, attempt, err)
+	}
+}
@@ -0,0 +1,145 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+const (
+	defaultRetries    = 3
+	defaultRetryDelay = 10 * time.Second
+	maxRetryDelay     = 10 * time.Minute
+)
+
+// ErrDeadLetterNotFound is returned for unknown dead letter IDs
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// StatusError is a webhook response with an error status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook returned status %d", e.StatusCode)
+}
+
+// SetRetryPolicy sets how often a failed delivery of any notifier is retried
+// before it is given up, or stored as a dead letter for webhooks. Retries
+// start after baseDelay and the delay doubles with every attempt, up to 10
+// minutes.
+func (m *Manager) SetRetryPolicy(retries int, baseDelay time.Duration) {
+	m.retryMu.Lock()
+	defer m.retryMu.Unlock()
+	m.retries = retries
+	m.retryDelay = baseDelay
+}
+
+func (m *Manager) retryPolicy() (int, time.Duration) {
+	m.retryMu.RLock()
+	defer m.retryMu.RUnlock()
+	return m.retries, m.retryDelay
+}
+
+// retryableDelivery reports whether a failed delivery may succeed later.
+// Permanent errors and client errors other than timeouts and rate limits
+// won't.
+func retryableDelivery(err error) bool {
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	var status *StatusError
+	if !errors.As(err, &status) {
+		return true
+	}
+	return status.StatusCode >= 500 ||
+		status.StatusCode == http.StatusRequestTimeout ||
+		status.StatusCode == http.StatusTooManyRequests
+}
+
+// retryBackoff returns the delay before the given retry (1-based)
+func retryBackoff(base time.Duration, retry int) time.Duration {
+	delay := base
+	for i := 1; i < retry && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// sleep waits for d and reports false if the manager was stopped or ctx
+// ended first
+func (m *Manager) sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-m.stop:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (m *Manager) storeDeadLetter(webhookID uint, eventType string, payload []byte, attempts int, err error) {
+	letter := &database.WebhookDeadLetter{
+		WebhookID: webhookID,
+		Event:     eventType,
+		Payload:   payload,
+		Attempts:  attempts,
+		LastError: err.Error(),
+	}
+	if err := m.db.Create(letter).Error; err != nil {
+		slog.Error("Failed to store dead letter", "error", err, "webhookID", webhookID)
+	}
+}
+
+// ListDeadLetters returns the stored failed deliveries, newest first. A
+// webhookID of 0 lists those of all webhooks.
+func (m *Manager) ListDeadLetters(webhookID uint) ([]database.WebhookDeadLetter, error) {
+	query := m.db.Order("id DESC")
+	if webhookID != 0 {
+		query = query.Where("webhook_id = ?", webhookID)
+	}
+	var letters []database.WebhookDeadLetter
+	return letters, query.Find(&letters).Error
+}
+
+// ReplayDeadLetter sends a failed delivery again, once, with the webhook's
+// current URL, headers and secret. It is removed if the delivery succeeds.
+func (m *Manager) ReplayDeadLetter(ctx context.Context, id uint) error {
+	var letter database.WebhookDeadLetter
+	if err := m.db.First(&letter, id).Error; err != nil {
+		return ErrDeadLetterNotFound
+	}
+	webhook, err := m.GetWebhook(letter.WebhookID)
+	if err != nil {
+		return fmt.Errorf("webhook %d no longer exists", letter.WebhookID)
+	}
+
+	if err := m.send(ctx, *webhook, letter.Payload); err != nil {
+		letter.Attempts++
+		letter.LastError = err.Error()
+		m.db.Save(&letter)
+		return err
+	}
+	return m.db.Delete(&letter).Error
+}
+
+// DeleteDeadLetter discards a failed delivery
+func (m *Manager) DeleteDeadLetter(id uint) error {
+	result := m.db.Delete(&database.WebhookDeadLetter{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// slackPostMessageURL is Slack's chat.postMessage method, used with bot tokens
+var slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+// DefaultSlackTemplate renders messages of Slack notifiers without their own
+// template, e.g. "*download.completed* epo / EBD: EBD_2024_01.zip"
+const DefaultSlackTemplate = `*{{.Type}}* {{.Source}}` +
+	`{{with .Product}} / {{.Name}}{{end}}` +
+	`{{with .Delivery}} / {{.Name}}{{end}}` +
+	`{{with .File}}: {{.Name}}{{end}}` +
+	`{{with .Error}} ({{.Message}}){{end}}` +
+	`{{range .Alerts}}` + "\n" + `{{.Message}}{{end}}`
+
+// ErrSlackNotifierNotFound is returned for unknown Slack notifier IDs
+var ErrSlackNotifierNotFound = errors.New("slack notifier not found")
+
+// ValidateSlackNotifier checks a notifier can post: it needs an incoming
+// webhook URL, or a bot token and a channel, and a valid template
+func ValidateSlackNotifier(n *database.SlackNotifier) error {
+	if n.WebhookURL == "" && (n.BotToken == "" || n.Channel == "") {
+		return errors.New("either webhookUrl or botToken and channel are required")
+	}
+	if n.Template != "" {
+		if _, err := ParseTemplate(n.Template); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeList encodes event types or IDs as stored on webhooks and notifiers
+func EncodeList(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+func (m *Manager) ListSlackNotifiers() ([]database.SlackNotifier, error) {
+	var notifiers []database.SlackNotifier
+	return notifiers, m.db.Find(&notifiers).Error
+}
+
+func (m *Manager) GetSlackNotifier(id uint) (*database.SlackNotifier, error) {
+	var notifier database.SlackNotifier
+	if err := m.db.First(&notifier, id).Error; err != nil {
+		return nil, ErrSlackNotifierNotFound
+	}
+	return &notifier, nil
+}
+
+func (m *Manager) CreateSlackNotifier(n *database.SlackNotifier) error {
+	if err := ValidateSlackNotifier(n); err != nil {
+		return err
+	}
+	return m.db.Create(n).Error
+}
+
+func (m *Manager) UpdateSlackNotifier(n *database.SlackNotifier) error {
+	if err := ValidateSlackNotifier(n); err != nil {
+		return err
+	}
+	return m.db.Save(n).Error
+}
+
+func (m *Manager) DeleteSlackNotifier(id uint) error {
+	result := m.db.Delete(&database.SlackNotifier{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSlackNotifierNotFound
+	}
+	return nil
+}
+
+// slackNotifier posts events to Slack channels
+type slackNotifier struct {
+	m *Manager
+}
+
+func (s slackNotifier) Name() string { return "slack" }
+
+func (s slackNotifier) Targets() ([]Target, error) {
+	var notifiers []database.SlackNotifier
+	if err := s.m.db.Where("enabled = ?", true).Find(&notifiers).Error; err != nil {
+		return nil, err
+	}
+	targets := make([]Target, len(notifiers))
+	for i, n := range notifiers {
+		targets[i] = Target{
+			ID:           n.ID,
+			Subscription: Subscription{Events: n.Events, Sources: n.Sources, Products: n.Products},
+			Config:       n,
+		}
+	}
+	return targets, nil
+}
+
+// Deliver renders the event message and posts it to the notifier's channel
+func (s slackNotifier) Deliver(ctx context.Context, target Target, event *Event) error {
+	n := target.Config.(database.SlackNotifier)
+	text := n.Template
+	if text == "" {
+		text = DefaultSlackTemplate
+	}
+	tmpl, err := ParseTemplate(text)
+	if err != nil {
+		return Permanent(err)
+	}
+	var message bytes.Buffer
+	if err := tmpl.Execute(&message, event); err != nil {
+		return Permanent(fmt.Errorf("render message template: %w", err))
+	}
+
+	url := n.WebhookURL
+	body := map[string]string{"text": message.String()}
+	if url == "" {
+		url = slackPostMessageURL
+		body["channel"] = n.Channel
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", "BulkFileLoader/1.0")
+	if n.WebhookURL == "" {
+		req.Header.Set("Authorization", "Bearer "+n.BotToken)
+	}
+
+	resp, err := s.m.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	if n.WebhookURL != "" {
+		return nil
+	}
+	// The Web API answers 200 with ok=false on errors such as an unknown
+	// channel or a revoked token
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result); err != nil {
+		return fmt.Errorf("decode Slack response: %w", err)
+	}
+	// Only rate limiting is worth retrying; other errors such as
+	// channel_not_found need the notifier to be fixed
+	switch {
+	case result.OK:
+		return nil
+	case result.Error == "ratelimited":
+		return fmt.Errorf("slack: %s", result.Error)
+	default:
+		return Permanent(fmt.Errorf("slack: %s", result.Error))
+	}
+}
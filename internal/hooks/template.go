@@ -0,0 +1,56 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// templateFuncs are available in payload templates. json encodes a value, so
+// strings can be embedded in a JSON payload with proper quoting.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// ParseTemplate parses a webhook payload template. Templates are executed
+// with the Event, e.g. {{.Type}} or {{with .Product}}{{json .Name}}{{end}}.
+func ParseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("payload").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// SetWebhookTemplate sets the template the webhook's payloads are rendered
+// with; an empty template sends the event JSON
+func (m *Manager) SetWebhookTemplate(id uint, text string) error {
+	if text != "" {
+		if _, err := ParseTemplate(text); err != nil {
+			return err
+		}
+	}
+	return m.db.Model(&database.Webhook{}).Where("id = ?", id).Update("template", text).Error
+}
+
+// renderPayload returns the body sent to a webhook for an event
+func renderPayload(webhook database.Webhook, event *Event) ([]byte, error) {
+	if webhook.Template == "" {
+		return json.Marshal(event)
+	}
+	tmpl, err := ParseTemplate(webhook.Template)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("render payload template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,355 @@
+// Package kafka is a minimal Kafka producer. It publishes records over the
+// Kafka wire protocol (brokers 1.0 and later), with optional TLS and
+// SASL/PLAIN authentication.
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	clientID       = "bulk-file-loader"
+	dialTimeout    = 30 * time.Second
+	requestTimeout = 30 * time.Second
+	// maxResponseSize bounds the responses read, well above what metadata
+	// and produce responses take, so a peer that isn't a Kafka broker can't
+	// make the producer allocate gigabytes
+	maxResponseSize = 16 << 20
+)
+
+// Config holds the brokers to bootstrap from and the authentication
+type Config struct {
+	// Brokers are host:port addresses; any one of them is enough to find the
+	// partition leaders
+	Brokers []string
+	// Username enables SASL/PLAIN; use it with TLS
+	Username string
+	Password string
+	TLS      bool
+}
+
+// Producer sends records to the leaders of their partitions. It is safe for
+// concurrent use; records are sent one at a time.
+type Producer struct {
+	cfg Config
+
+	mu      sync.Mutex
+	brokers map[int32]string // node ID to address
+	leaders map[string][]int32
+	conns   map[int32]*conn
+	next    int
+}
+
+func NewProducer(cfg Config) *Producer {
+	return &Producer{
+		cfg:     cfg,
+		brokers: make(map[int32]string),
+		leaders: make(map[string][]int32),
+		conns:   make(map[int32]*conn),
+	}
+}
+
+// Produce appends a record to the topic and waits until all in-sync replicas
+// have it. Records with the same key go to the same partition; records
+// without a key are spread round robin.
+func (p *Producer) Produce(ctx context.Context, topic string, key, value []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	leaders, err := p.partitions(ctx, topic)
+	if err != nil {
+		return err
+	}
+	var partition int32
+	if key != nil {
+		partition = (murmur2(key) & 0x7fffffff) % int32(len(leaders))
+	} else {
+		partition = int32(p.next % len(leaders))
+		p.next++
+	}
+
+	c, err := p.leader(ctx, leaders[partition])
+	if err == nil {
+		err = c.produce(ctx, topic, partition, recordBatch(key, value, time.Now()))
+	}
+	if err != nil {
+		// Leaders move and connections break; start over on the next record
+		p.reset()
+		return err
+	}
+	return nil
+}
+
+// Close closes the connections to the brokers
+func (p *Producer) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reset()
+}
+
+func (p *Producer) reset() {
+	for _, c := range p.conns {
+		c.Close()
+	}
+	clear(p.conns)
+	clear(p.leaders)
+}
+
+// partitions returns the leader of each partition of the topic, fetching the
+// metadata from the first reachable broker if it isn't known yet
+func (p *Producer) partitions(ctx context.Context, topic string) ([]int32, error) {
+	if leaders, ok := p.leaders[topic]; ok {
+		return leaders, nil
+	}
+	if len(p.cfg.Brokers) == 0 {
+		return nil, errors.New("kafka: no brokers configured")
+	}
+
+	var lastErr error
+	for _, addr := range p.cfg.Brokers {
+		c, err := p.dial(ctx, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		brokers, leaders, err := c.metadata(ctx, topic)
+		c.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for id, addr := range brokers {
+			p.brokers[id] = addr
+		}
+		p.leaders[topic] = leaders
+		return leaders, nil
+	}
+	return nil, lastErr
+}
+
+// leader returns a connection to the given broker
+func (p *Producer) leader(ctx context.Context, id int32) (*conn, error) {
+	if c, ok := p.conns[id]; ok {
+		return c, nil
+	}
+	addr, ok := p.brokers[id]
+	if !ok {
+		return nil, ErrLeaderNotAvailable
+	}
+	c, err := p.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[id] = c
+	return c, nil
+}
+
+// conn is a connection to one broker
+type conn struct {
+	net.Conn
+	correlationID int32
+}
+
+// dial connects to a broker, negotiates TLS and authenticates if configured
+func (p *Producer) dial(ctx context.Context, addr string) (*conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if p.cfg.TLS {
+		host, _, _ := net.SplitHostPort(addr)
+		tlsConn := tls.Client(raw, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			raw.Close()
+			return nil, err
+		}
+		raw = tlsConn
+	}
+
+	c := &conn{Conn: raw}
+	if p.cfg.Username != "" {
+		if err := c.authenticate(ctx, p.cfg.Username, p.cfg.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// roundTrip sends a request and returns the response body after the header
+func (c *conn) roundTrip(ctx context.Context, apiKey, version int16, body []byte) (*decoder, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(requestTimeout)
+	}
+	c.SetDeadline(deadline)
+
+	c.correlationID++
+	var req encoder
+	req.int32(0) // size, set below
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(c.correlationID)
+	req.string(clientID)
+	req.raw(body)
+	binary.BigEndian.PutUint32(req.b, uint32(len(req.b)-4))
+	if _, err := c.Write(req.b); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxResponseSize {
+		return nil, fmt.Errorf("%w: %d bytes", errResponseTooLarge, n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c, resp); err != nil {
+		return nil, err
+	}
+	d := &decoder{b: resp}
+	if id := d.int32(); d.err == nil && id != c.correlationID {
+		return nil, fmt.Errorf("kafka: response to request %d, want %d", id, c.correlationID)
+	}
+	return d, d.err
+}
+
+// authenticate performs a SASL/PLAIN exchange
+func (c *conn) authenticate(ctx context.Context, username, password string) error {
+	var req encoder
+	req.string("PLAIN")
+	d, err := c.roundTrip(ctx, apiSaslHandshake, 1, req.b)
+	if err != nil {
+		return err
+	}
+	if code := Error(d.int16()); code != 0 {
+		return code
+	}
+
+	req = encoder{}
+	req.bytes([]byte("\x00" + username + "\x00" + password))
+	d, err = c.roundTrip(ctx, apiSaslAuthenticate, 0, req.b)
+	if err != nil {
+		return err
+	}
+	if code := Error(d.int16()); code != 0 {
+		if msg := d.string(); msg != "" {
+			return fmt.Errorf("%w: %s", code, msg)
+		}
+		return code
+	}
+	return nil
+}
+
+// metadata returns the brokers' addresses and the leader of each partition
+// of the topic (Metadata v4)
+func (c *conn) metadata(ctx context.Context, topic string) (map[int32]string, []int32, error) {
+	var req encoder
+	req.int32(1)
+	req.string(topic)
+	req.int8(1) // allow auto topic creation
+	d, err := c.roundTrip(ctx, apiMetadata, 4, req.b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d.int32() // throttle time
+	brokers := make(map[int32]string)
+	for range d.arrayLen() {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string() // cluster ID
+	d.int32()  // controller ID
+
+	var leaders []int32
+	for range d.arrayLen() {
+		code := Error(d.int16())
+		name := d.string()
+		d.int8() // internal
+		partitions := make([]int32, d.arrayLen())
+		for range partitions {
+			d.int16() // partition error
+			index := d.int32()
+			leader := d.int32()
+			for range d.arrayLen() {
+				d.int32() // replicas
+			}
+			for range d.arrayLen() {
+				d.int32() // in-sync replicas
+			}
+			if index >= 0 && int(index) < len(partitions) {
+				partitions[index] = leader
+			}
+		}
+		if d.err != nil {
+			return nil, nil, d.err
+		}
+		if name != topic {
+			continue
+		}
+		if code != 0 {
+			return nil, nil, code
+		}
+		leaders = partitions
+	}
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	if len(leaders) == 0 {
+		return nil, nil, ErrUnknownTopicOrPartition
+	}
+	for _, leader := range leaders {
+		if leader < 0 {
+			return nil, nil, ErrLeaderNotAvailable
+		}
+	}
+	return brokers, leaders, nil
+}
+
+// produce sends a record batch to a partition (Produce v3) and waits for all
+// in-sync replicas
+func (c *conn) produce(ctx context.Context, topic string, partition int32, batch []byte) error {
+	var req encoder
+	req.int16(-1) // no transactional ID
+	req.int16(-1) // acks: all in-sync replicas
+	req.int32(int32(requestTimeout / time.Millisecond))
+	req.int32(1)
+	req.string(topic)
+	req.int32(1)
+	req.int32(partition)
+	req.bytes(batch)
+	d, err := c.roundTrip(ctx, apiProduce, 3, req.b)
+	if err != nil {
+		return err
+	}
+
+	for range d.arrayLen() {
+		d.string() // topic
+		for range d.arrayLen() {
+			d.int32() // partition
+			code := Error(d.int16())
+			d.int64() // base offset
+			d.int64() // log append time
+			if d.err == nil && code != 0 {
+				return code
+			}
+		}
+	}
+	return d.err
+}
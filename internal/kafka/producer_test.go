@@ -0,0 +1,224 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestMurmur2(t *testing.T) {
+	// Values of the Java client's Utils.murmur2
+	tests := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	for in, want := range tests {
+		if got := murmur2([]byte(in)); got != want {
+			t.Errorf("murmur2(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+// record is a record received by the fake broker
+type record struct {
+	partition int32
+	key       string
+	value     string
+}
+
+// fakeBroker is a single-node cluster with a two-partition topic, answering
+// the requests the producer sends
+func fakeBroker(t *testing.T, topic, username, password string) (string, <-chan record) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	records := make(chan record, 10)
+	serve := func(c net.Conn) {
+		defer c.Close()
+		for {
+			var size [4]byte
+			if _, err := io.ReadFull(c, size[:]); err != nil {
+				return
+			}
+			req := make([]byte, binary.BigEndian.Uint32(size[:]))
+			if _, err := io.ReadFull(c, req); err != nil {
+				return
+			}
+			d := &decoder{b: req}
+			apiKey := d.int16()
+			d.int16() // version
+			correlationID := d.int32()
+			d.string() // client ID
+
+			var resp encoder
+			resp.int32(correlationID)
+			switch apiKey {
+			case apiSaslHandshake:
+				resp.int16(0)
+				resp.int32(1)
+				resp.string("PLAIN")
+			case apiSaslAuthenticate:
+				if string(d.bytes()) != "\x00"+username+"\x00"+password {
+					resp.int16(58)
+					resp.string("Authentication failed")
+				} else {
+					resp.int16(0)
+					resp.int16(-1)
+				}
+				resp.int32(0)
+			case apiMetadata:
+				resp.int32(0) // throttle time
+				resp.int32(1)
+				resp.int32(1)
+				resp.string(host)
+				resp.int32(int32(portNum))
+				resp.int16(-1) // rack
+				resp.int16(-1) // cluster ID
+				resp.int32(1)  // controller
+				resp.int32(1)
+				resp.int16(0)
+				resp.string(topic)
+				resp.int8(0)
+				resp.int32(2)
+				for i := range int32(2) {
+					resp.int16(0)
+					resp.int32(i)
+					resp.int32(1) // leader
+					resp.int32(1)
+					resp.int32(1)
+					resp.int32(1)
+					resp.int32(1)
+				}
+			case apiProduce:
+				d.int16() // transactional ID
+				d.int16() // acks
+				d.int32() // timeout
+				d.arrayLen()
+				name := d.string()
+				d.arrayLen()
+				partition := d.int32()
+				key, value, err := readBatch(d.bytes())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				records <- record{partition, key, value}
+				resp.int32(1)
+				resp.string(name)
+				resp.int32(1)
+				resp.int32(partition)
+				resp.int16(0)
+				resp.int64(0)
+				resp.int64(-1)
+				resp.int32(0) // throttle time
+			}
+			out := binary.BigEndian.AppendUint32(nil, uint32(len(resp.b)))
+			c.Write(append(out, resp.b...))
+		}
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(c)
+		}
+	}()
+	return ln.Addr().String(), records
+}
+
+// readBatch checks a single-record batch and returns its key and value
+func readBatch(batch []byte) (string, string, error) {
+	if len(batch) < 61 || batch[16] != 2 {
+		return "", "", errors.New("not a v2 record batch")
+	}
+	body := batch[21:]
+	if crc32.Checksum(body, castagnoli) != binary.BigEndian.Uint32(batch[17:]) {
+		return "", "", errors.New("record batch CRC mismatch")
+	}
+	rec := body[40:]
+	_, n := binary.Varint(rec) // length
+	rec = rec[n+1:]            // attributes
+	_, n = binary.Varint(rec)  // timestamp delta
+	rec = rec[n:]
+	_, n = binary.Varint(rec) // offset delta
+	rec = rec[n:]
+	keyLen, n := binary.Varint(rec)
+	key := string(rec[n : n+int(keyLen)])
+	rec = rec[n+int(keyLen):]
+	valueLen, n := binary.Varint(rec)
+	return key, string(rec[n : n+int(valueLen)]), nil
+}
+
+func TestProduce(t *testing.T) {
+	addr, records := fakeBroker(t, "events", "loader", "secret")
+	producer := NewProducer(Config{Brokers: []string{"127.0.0.1:1", addr}, Username: "loader", Password: "secret"})
+	defer producer.Close()
+
+	for _, key := range []string{"epo", "uspto", "epo"} {
+		if err := producer.Produce(context.Background(), "events", []byte(key), []byte(`{"source":"`+key+`"}`)); err != nil {
+			t.Fatal(err)
+		}
+		got := <-records
+		want := record{(murmur2([]byte(key)) & 0x7fffffff) % 2, key, `{"source":"` + key + `"}`}
+		if got != want {
+			t.Errorf("broker received %+v, want %+v", got, want)
+		}
+	}
+
+	if err := producer.Produce(context.Background(), "other", nil, []byte("x")); !errors.Is(err, ErrUnknownTopicOrPartition) {
+		t.Errorf("unknown topic: err = %v, want ErrUnknownTopicOrPartition", err)
+	}
+}
+
+func TestProduceResponseTooLarge(t *testing.T) {
+	// A TLS or HTTP port answers with bytes read as a huge response size
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+		io.Copy(io.Discard, c)
+	}()
+
+	producer := NewProducer(Config{Brokers: []string{ln.Addr().String()}})
+	defer producer.Close()
+	if err := producer.Produce(context.Background(), "events", nil, []byte("x")); !errors.Is(err, errResponseTooLarge) {
+		t.Errorf("err = %v, want errResponseTooLarge", err)
+	}
+}
+
+func TestProduceAuthFailure(t *testing.T) {
+	addr, _ := fakeBroker(t, "events", "loader", "secret")
+	producer := NewProducer(Config{Brokers: []string{addr}, Username: "loader", Password: "wrong"})
+	defer producer.Close()
+
+	err := producer.Produce(context.Background(), "events", nil, []byte("x"))
+	var kerr Error
+	if !errors.As(err, &kerr) || kerr != 58 || kerr.Retriable() {
+		t.Errorf("err = %v, want a permanent SASL_AUTHENTICATION_FAILED", err)
+	}
+}
@@ -0,0 +1,242 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// API keys of the requests the producer sends
+const (
+	apiProduce          = 0
+	apiMetadata         = 3
+	apiSaslHandshake    = 17
+	apiSaslAuthenticate = 36
+)
+
+// Error is an error code returned by a broker
+type Error int16
+
+const (
+	ErrUnknownTopicOrPartition Error = 3
+	ErrLeaderNotAvailable      Error = 5
+)
+
+var errorNames = map[Error]string{
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	13: "NETWORK_EXCEPTION",
+	14: "COORDINATOR_LOAD_IN_PROGRESS",
+	15: "COORDINATOR_NOT_AVAILABLE",
+	17: "INVALID_TOPIC_EXCEPTION",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	31: "CLUSTER_AUTHORIZATION_FAILED",
+	33: "UNSUPPORTED_SASL_MECHANISM",
+	34: "ILLEGAL_SASL_STATE",
+	35: "UNSUPPORTED_VERSION",
+	58: "SASL_AUTHENTICATION_FAILED",
+}
+
+func (e Error) Error() string {
+	if name, ok := errorNames[e]; ok {
+		return "kafka: " + name
+	}
+	return fmt.Sprintf("kafka: error code %d", int16(e))
+}
+
+// Retriable reports whether the request may succeed when sent again, e.g.
+// after a leader election
+func (e Error) Retriable() bool {
+	switch e {
+	case 3, 5, 6, 7, 13, 14, 15, 19, 20:
+		return true
+	}
+	return false
+}
+
+var (
+	errShortResponse    = errors.New("kafka: truncated response")
+	errResponseTooLarge = errors.New("kafka: response too large, is this a Kafka broker?")
+)
+
+// encoder builds a request body in the Kafka wire format
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8)     { e.b = append(e.b, byte(v)) }
+func (e *encoder) int16(v int16)   { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+func (e *encoder) int32(v int32)   { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+func (e *encoder) int64(v int64)   { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+func (e *encoder) varint(v int64)  { e.b = binary.AppendVarint(e.b, v) }
+func (e *encoder) raw(b []byte)    { e.b = append(e.b, b...) }
+func (e *encoder) string(s string) { e.int16(int16(len(s))); e.b = append(e.b, s...) }
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// varbytes writes a record key or value; nil is encoded as null
+func (e *encoder) varbytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// decoder reads a response body. The first short read is kept in err and
+// makes all further reads return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errShortResponse
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int8() int8 {
+	if v := d.take(1); v != nil {
+		return int8(v[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if v := d.take(2); v != nil {
+		return int16(binary.BigEndian.Uint16(v))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if v := d.take(4); v != nil {
+		return int32(binary.BigEndian.Uint32(v))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if v := d.take(8); v != nil {
+		return int64(binary.BigEndian.Uint64(v))
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// arrayLen reads an array length; null arrays are empty. Lengths beyond the
+// remaining bytes are treated as a truncated response.
+func (d *decoder) arrayLen() int {
+	n := int(d.int32())
+	if n > len(d.b) {
+		d.err = errShortResponse
+		return 0
+	}
+	return max(n, 0)
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// recordBatch encodes a single record as an uncompressed record batch
+// (message format v2)
+func recordBatch(key, value []byte, now time.Time) []byte {
+	var record encoder
+	record.int8(0)   // attributes
+	record.varint(0) // timestamp delta
+	record.varint(0) // offset delta
+	record.varbytes(key)
+	record.varbytes(value)
+	record.varint(0) // headers
+
+	// The CRC covers everything from the attributes on
+	var body encoder
+	body.int16(0) // attributes: no compression, create time
+	body.int32(0) // last offset delta
+	ts := now.UnixMilli()
+	body.int64(ts) // first timestamp
+	body.int64(ts) // max timestamp
+	body.int64(-1) // producer ID
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(1)  // records
+	body.varint(int64(len(record.b)))
+	body.raw(record.b)
+
+	var batch encoder
+	batch.int64(0)                              // base offset
+	batch.int32(int32(4 + 1 + 4 + len(body.b))) // length of the rest
+	batch.int32(-1)                             // partition leader epoch
+	batch.int8(2)                               // magic
+	batch.b = binary.BigEndian.AppendUint32(batch.b, crc32.Checksum(body.b, castagnoli))
+	batch.raw(body.b)
+	return batch.b
+}
+
+// murmur2 is the hash Kafka's default partitioner applies to record keys, so
+// records are partitioned like those of the Java client
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	h := seed ^ uint32(len(data))
+	n := len(data) &^ 3
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	switch len(data) & 3 {
+	case 3:
+		h ^= uint32(data[n+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[n+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[n])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
@@ -0,0 +1,68 @@
+// Package listen creates the network listeners for the built-in HTTP server.
+package listen
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+)
+
+// Listeners opens a TCP listener on the configured address unless the port is
+// 0, and a unix socket listener if a socket path is configured
+func Listeners(cfg *config.Config) ([]net.Listener, error) {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, lis := range listeners {
+			lis.Close()
+		}
+	}
+
+	if cfg.Port > 0 {
+		lis, err := net.Listen("tcp", cfg.HTTPAddr())
+		if err != nil {
+			return nil, fmt.Errorf("listen on %s: %w", cfg.HTTPAddr(), err)
+		}
+		listeners = append(listeners, lis)
+	}
+
+	if cfg.SocketPath != "" {
+		lis, err := Unix(cfg.SocketPath, cfg.SocketMode)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, lis)
+	}
+
+	if len(listeners) == 0 {
+		return nil, errors.New("no listener configured: set BULK_LOADER_PORT or BULK_LOADER_SOCKET")
+	}
+	return listeners, nil
+}
+
+// Unix listens on a unix domain socket at path with the given file mode. A
+// stale socket left behind by an unclean shutdown is removed first; any other
+// existing file is an error.
+func Unix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("socket path %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on socket %s: %w", path, err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		lis.Close()
+		return nil, fmt.Errorf("set socket permissions: %w", err)
+	}
+	return lis, nil
+}
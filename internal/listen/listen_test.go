@@ -0,0 +1,105 @@
+package listen
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+)
+
+func TestUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bulk-loader.sock")
+
+	lis, err := Unix(path, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0660 {
+		t.Errorf("socket mode = %v, want 0660", info.Mode().Perm())
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial socket: %v", err)
+	}
+	conn.Close()
+	lis.Close()
+}
+
+func TestUnixRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bulk-loader.sock")
+
+	// A listener that doesn't unlink its socket on close leaves it behind
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	lis, err := Unix(path, 0600)
+	if err != nil {
+		t.Fatalf("Unix() with stale socket: %v", err)
+	}
+	lis.Close()
+}
+
+func TestUnixRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	os.WriteFile(path, []byte("keep me"), 0644)
+
+	if _, err := Unix(path, 0660); err == nil {
+		t.Fatal("Unix() should refuse to replace a regular file")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "keep me" {
+		t.Error("regular file was modified")
+	}
+}
+
+func TestListeners(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bulk-loader.sock")
+
+	listeners, err := Listeners(&config.Config{SocketPath: path, SocketMode: 0660})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 1 || listeners[0].Addr().Network() != "unix" {
+		t.Errorf("Listeners() = %v, want only the unix socket", listeners)
+	}
+	for _, lis := range listeners {
+		lis.Close()
+	}
+
+	if _, err := Listeners(&config.Config{}); err == nil {
+		t.Error("Listeners() should fail without a port or socket")
+	}
+}
+
+func TestListenersBindAddress(t *testing.T) {
+	listeners, err := Listeners(&config.Config{ListenAddr: "127.0.0.1", Port: freePort(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listeners[0].Close()
+
+	addr := listeners[0].Addr().(*net.TCPAddr)
+	if !addr.IP.IsLoopback() {
+		t.Errorf("listener bound to %v, want loopback", addr.IP)
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().(*net.TCPAddr).Port
+}
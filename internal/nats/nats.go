@@ -0,0 +1,297 @@
+// Package nats publishes messages to a NATS server over the client protocol,
+// optionally waiting for a JetStream stream to acknowledge them. Each publish
+// uses its own short-lived connection.
+package nats
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPort    = "4222"
+	requestTimeout = 30 * time.Second
+	// maxLineSize and maxReplySize bound what is read from the server, well
+	// above INFO lines and acknowledgements, so a peer that isn't a NATS
+	// server can't make the client allocate gigabytes
+	maxLineSize  = 64 << 10
+	maxReplySize = 1 << 20
+)
+
+var (
+	// ErrNoStream is returned by JetStream publishes no stream accepted
+	ErrNoStream = errors.New("nats: no JetStream stream for subject")
+	// ErrPayloadTooLarge is returned for messages beyond the server's limit
+	ErrPayloadTooLarge = errors.New("nats: message exceeds the maximum payload")
+
+	errReplyTooLarge = errors.New("nats: reply too large, is this a NATS server?")
+)
+
+// ServerError is an -ERR sent by the server, e.g. an authorization or
+// permissions violation
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string { return "nats: " + e.Message }
+
+// AckError is a JetStream publish the stream rejected
+type AckError struct {
+	Code        int
+	Description string
+}
+
+func (e *AckError) Error() string {
+	return fmt.Sprintf("nats: JetStream error %d: %s", e.Code, e.Description)
+}
+
+// ParseURL checks a server URL: nats://host[:port] or tls://host[:port],
+// with credentials as user:password or a token in the user part
+func ParseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q, want nats://host:port or tls://host:port", Redact(rawURL))
+	}
+	return u, nil
+}
+
+// Redact removes credentials from a server URL
+func Redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	return u.String()
+}
+
+// ValidSubject reports whether a subject can be published to: dot-separated
+// tokens without whitespace or wildcards
+func ValidSubject(subject string) bool {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n*>") {
+		return false
+	}
+	for _, token := range strings.Split(subject, ".") {
+		if token == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// serverInfo is the part of the server's INFO the client uses
+type serverInfo struct {
+	TLSRequired bool  `json:"tls_required"`
+	MaxPayload  int64 `json:"max_payload"`
+}
+
+// Publish sends a message and waits until the server processed it. With
+// jetStream it waits for a stream's acknowledgement instead.
+func Publish(ctx context.Context, rawURL, subject string, data []byte, jetStream bool) error {
+	u, err := ParseURL(rawURL)
+	if err != nil {
+		return err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	// Deadlines on the TCP connection also interrupt TLS wrapped around it
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	r := bufio.NewReader(conn)
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	op, args, _ := strings.Cut(line, " ")
+	if op != "INFO" {
+		return fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+	var info serverInfo
+	if err := json.Unmarshal([]byte(args), &info); err != nil {
+		return fmt.Errorf("nats: invalid INFO: %w", err)
+	}
+	if info.MaxPayload > 0 && int64(len(data)) > info.MaxPayload {
+		return fmt.Errorf("%w: %d bytes, maximum %d", ErrPayloadTooLarge, len(data), info.MaxPayload)
+	}
+
+	var rw io.ReadWriter = conn
+	if u.Scheme == "tls" || info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return err
+		}
+		rw = tlsConn
+		r = bufio.NewReader(tlsConn)
+	}
+
+	connect := map[string]any{
+		"verbose":       false,
+		"pedantic":      false,
+		"name":          "bulk-file-loader",
+		"lang":          "go",
+		"version":       "1.0",
+		"protocol":      1,
+		"headers":       true,
+		"no_responders": true,
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			connect["user"] = u.User.Username()
+			connect["pass"] = password
+		} else {
+			connect["auth_token"] = u.User.Username()
+		}
+	}
+	connectJSON, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "CONNECT %s\r\n", connectJSON)
+	if jetStream {
+		inbox := newInbox()
+		fmt.Fprintf(&out, "SUB %s 1\r\n", inbox)
+		fmt.Fprintf(&out, "PUB %s %s %d\r\n", subject, inbox, len(data))
+	} else {
+		fmt.Fprintf(&out, "PUB %s %d\r\n", subject, len(data))
+	}
+	out.Write(data)
+	// The PONG confirms the server processed everything before the PING
+	out.WriteString("\r\nPING\r\n")
+	if _, err := io.WriteString(rw, out.String()); err != nil {
+		return err
+	}
+
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return err
+		}
+		op, args, _ := strings.Cut(line, " ")
+		switch op {
+		case "PING":
+			if _, err := io.WriteString(rw, "PONG\r\n"); err != nil {
+				return err
+			}
+		case "PONG":
+			if !jetStream {
+				return nil
+			}
+		case "-ERR":
+			return &ServerError{Message: strings.Trim(args, "' ")}
+		case "MSG":
+			payload, err := readPayload(r, args, 1)
+			if err != nil {
+				return err
+			}
+			return parseAck(payload)
+		case "HMSG":
+			// A status header without a payload; 503 means no responders
+			payload, err := readPayload(r, args, 2)
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(string(payload), "NATS/1.0 503") {
+				return ErrNoStream
+			}
+			status, _, _ := strings.Cut(string(payload), "\r\n")
+			return fmt.Errorf("nats: unexpected reply %q", status)
+		}
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxLineSize {
+			return "", errReplyTooLarge
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+// readPayload reads the payload of a MSG or HMSG, whose size is the last of
+// its arguments; sizes counts the size arguments
+func readPayload(r *bufio.Reader, args string, sizes int) ([]byte, error) {
+	fields := strings.Fields(args)
+	if len(fields) < 2+sizes {
+		return nil, fmt.Errorf("nats: malformed message %q", args)
+	}
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("nats: malformed message %q", args)
+	}
+	if size > maxReplySize {
+		return nil, fmt.Errorf("%w: %d bytes", errReplyTooLarge, size)
+	}
+	payload := make([]byte, size+2)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload[:size], nil
+}
+
+// parseAck checks a JetStream publish acknowledgement
+func parseAck(payload []byte) error {
+	var ack struct {
+		Stream string `json:"stream"`
+		Error  *struct {
+			Code        int    `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(payload, &ack); err != nil {
+		return fmt.Errorf("nats: invalid JetStream acknowledgement: %w", err)
+	}
+	if ack.Error != nil {
+		return &AckError{Code: ack.Error.Code, Description: ack.Error.Description}
+	}
+	if ack.Stream == "" {
+		return errors.New("nats: invalid JetStream acknowledgement")
+	}
+	return nil
+}
+
+func newInbox() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "_INBOX." + hex.EncodeToString(b)
+}
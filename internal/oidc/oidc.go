@@ -0,0 +1,280 @@
+// Package oidc signs users in with an OpenID Connect provider: the
+// authorization code flow with PKCE, and verification of the ID token against
+// the keys the provider publishes.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	requestTimeout = 30 * time.Second
+	// loginTimeout is how long a user has to sign in at the provider
+	loginTimeout = 10 * time.Minute
+	// maxPendingLogins bounds the logins started but not completed
+	maxPendingLogins = 1000
+)
+
+var (
+	// ErrUnknownState is returned for callbacks of logins that were not
+	// started here or have expired
+	ErrUnknownState = errors.New("oidc: unknown or expired login")
+	// ErrInvalidToken is returned when the ID token fails verification
+	ErrInvalidToken = errors.New("oidc: invalid ID token")
+)
+
+// Config identifies the client at the provider
+type Config struct {
+	// Issuer is the provider's issuer URL; its discovery document is at
+	// Issuer + "/.well-known/openid-configuration"
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL registered with the provider
+	RedirectURL string
+	// Scopes are requested in addition to openid
+	Scopes []string
+}
+
+// Claims are the claims of a verified ID token
+type Claims map[string]any
+
+// Subject returns the sub claim
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Name returns a display name: the preferred username, email or subject
+func (c Claims) Name() string {
+	for _, claim := range []string{"preferred_username", "email", "name"} {
+		if name, ok := c[claim].(string); ok && name != "" {
+			return name
+		}
+	}
+	return c.Subject()
+}
+
+// Strings returns a claim holding a string or a list of strings, e.g.
+// groups. Dots address nested claims, e.g. realm_access.roles.
+func (c Claims) Strings(name string) []string {
+	var value any = map[string]any(c)
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// metadata is the part of the discovery document the client uses
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type pendingLogin struct {
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+// Provider runs logins against one provider. The discovery document and the
+// signing keys are fetched on first use. It is safe for concurrent use.
+type Provider struct {
+	cfg        Config
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     *keySet
+	pending  map[string]pendingLogin // by state
+}
+
+// New checks the configuration and returns a provider
+func New(cfg Config) (*Provider, error) {
+	u, err := url.Parse(cfg.Issuer)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OIDC issuer %q, want an https URL", cfg.Issuer)
+	}
+	if cfg.ClientID == "" {
+		return nil, errors.New("OIDC client ID required")
+	}
+	if u, err := url.Parse(cfg.RedirectURL); err != nil || !u.IsAbs() {
+		return nil, fmt.Errorf("invalid OIDC redirect URL %q, want e.g. https://loader.example.com/api/auth/oidc/callback", cfg.RedirectURL)
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &Provider{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: requestTimeout},
+		now:        time.Now,
+		pending:    make(map[string]pendingLogin),
+	}, nil
+}
+
+// AuthURL starts a login and returns the provider URL to redirect the browser
+// to, and the state the callback must carry
+func (p *Provider) AuthURL(ctx context.Context) (string, string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	state, nonce, verifier := randomString(), randomString(), randomString()
+	challenge := sha256.Sum256([]byte(verifier))
+
+	p.mu.Lock()
+	now := p.now()
+	for s, login := range p.pending {
+		if now.After(login.expires) {
+			delete(p.pending, s)
+		}
+	}
+	if len(p.pending) >= maxPendingLogins {
+		p.mu.Unlock()
+		return "", "", errors.New("oidc: too many logins in progress")
+	}
+	p.pending[state] = pendingLogin{nonce: nonce, verifier: verifier, expires: now.Add(loginTimeout)}
+	p.mu.Unlock()
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return md.AuthorizationEndpoint + sep + params.Encode(), state, nil
+}
+
+// Exchange completes the login the state belongs to: it redeems the code and
+// returns the claims of the verified ID token
+func (p *Provider) Exchange(ctx context.Context, state, code string) (Claims, error) {
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || p.now().After(login.expires) {
+		return nil, ErrUnknownState
+	}
+
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {login.verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("oidc: invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: token request failed with status %d: %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("oidc: token response without ID token")
+	}
+	return p.verify(ctx, md, body.IDToken, login.nonce)
+}
+
+// discover fetches the discovery document once
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var md metadata
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", &md); err != nil {
+		return nil, fmt.Errorf("oidc: discovery failed: %w", err)
+	}
+	if md.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: discovery document is for issuer %q, want %q", md.Issuer, p.cfg.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document lacks endpoints")
+	}
+	p.metadata = &md
+	p.keys = newKeySet(md.JWKSURI, p.getJSON)
+	return p.metadata, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
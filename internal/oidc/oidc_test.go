@@ -0,0 +1,232 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeProvider issues ID tokens signed with an RSA or EC key. The token
+// endpoint checks the PKCE verifier against the challenge of the login.
+type fakeProvider struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	// alg selects the signing key, RS256 or ES256
+	alg string
+	// claims are modified before signing
+	claims func(Claims)
+
+	challenge, nonce string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{rsaKey: rsaKey, ecKey: ecKey, alg: "RS256", claims: func(Claims) {}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(metadata{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jwk{
+			{Kty: "RSA", Kid: "rsa", Use: "sig", N: b64(rsaKey.N.Bytes()), E: b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{Kty: "EC", Kid: "ec", Crv: "P-256", X: b64(ecKey.X.FillBytes(make([]byte, 32))), Y: b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, _ := r.BasicAuth()
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if clientID != "loader" || secret != "secret" || r.FormValue("code") != "good" ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := Claims{
+			"iss":    p.URL,
+			"aud":    "loader",
+			"sub":    "user-1",
+			"email":  "ada@example.com",
+			"exp":    float64(time.Now().Add(time.Hour).Unix()),
+			"nonce":  p.nonce,
+			"groups": []any{"staff", "loader-admins"},
+		}
+		p.claims(claims)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(t, claims)})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeProvider) sign(t *testing.T, claims Claims) string {
+	header, _ := json.Marshal(map[string]string{"alg": p.alg, "kid": map[string]string{"RS256": "rsa", "ES256": "ec"}[p.alg]})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	if p.alg == "ES256" {
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, p.ecKey, digest[:])
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	} else {
+		signature, err = rsa.SignPKCS1v15(rand.Reader, p.rsaKey, crypto.SHA256, digest[:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// login starts a login and remembers what the browser would carry to the
+// provider
+func (p *fakeProvider) login(t *testing.T, provider *Provider) string {
+	t.Helper()
+	authURL, state, err := provider.AuthURL(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	query := u.Query()
+	if u.Path != "/authorize" || query.Get("client_id") != "loader" || query.Get("state") != state ||
+		query.Get("scope") != "openid groups" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("auth URL = %s", authURL)
+	}
+	p.challenge, p.nonce = query.Get("code_challenge"), query.Get("nonce")
+	return state
+}
+
+func TestLogin(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider, err := New(Config{
+		Issuer:       fake.URL + "/",
+		ClientID:     "loader",
+		ClientSecret: "secret",
+		RedirectURL:  "https://loader.example.com/api/auth/oidc/callback",
+		Scopes:       []string{"groups"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		fake.alg = alg
+		state := fake.login(t, provider)
+		claims, err := provider.Exchange(context.Background(), state, "good")
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if claims.Subject() != "user-1" || claims.Name() != "ada@example.com" || len(claims.Strings("groups")) != 2 {
+			t.Errorf("%s: claims = %v", alg, claims)
+		}
+		if _, err := provider.Exchange(context.Background(), state, "good"); !errors.Is(err, ErrUnknownState) {
+			t.Errorf("%s: reused state: err = %v, want ErrUnknownState", alg, err)
+		}
+	}
+	fake.alg = "RS256"
+
+	tests := []struct {
+		name   string
+		claims func(Claims)
+	}{
+		{"wrong audience", func(c Claims) { c["aud"] = []any{"other"} }},
+		{"wrong issuer", func(c Claims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", func(c Claims) { c["exp"] = float64(time.Now().Add(-time.Hour).Unix()) }},
+		{"wrong nonce", func(c Claims) { c["nonce"] = "replayed" }},
+	}
+	for _, tt := range tests {
+		fake.claims = tt.claims
+		state := fake.login(t, provider)
+		if _, err := provider.Exchange(context.Background(), state, "good"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", tt.name, err)
+		}
+	}
+	fake.claims = func(Claims) {}
+
+	state := fake.login(t, provider)
+	if _, err := provider.Exchange(context.Background(), state, "bad"); err == nil {
+		t.Error("Exchange accepted a rejected code")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider, _ := New(Config{Issuer: fake.URL, ClientID: "loader", RedirectURL: "https://loader.example.com/cb"})
+	md, err := provider.discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := Claims{"iss": fake.URL, "aud": "loader", "sub": "user-1", "exp": float64(time.Now().Add(time.Hour).Unix()), "nonce": "n"}
+	token := fake.sign(t, claims)
+	if _, err := provider.verify(context.Background(), md, token, "n"); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+	tampered := token[:len(token)-4] + "AAAA"
+	if _, err := provider.verify(context.Background(), md, tampered, "n"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("tampered signature: err = %v, want ErrInvalidToken", err)
+	}
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"rsa"}`))
+	unsigned := header + token[len(header):]
+	if _, err := provider.verify(context.Background(), md, unsigned, "n"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("alg none: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestClaimsStrings(t *testing.T) {
+	claims := Claims{
+		"groups":       []any{"a", "b", 3},
+		"scope":        "read write",
+		"realm_access": map[string]any{"roles": []any{"admin"}},
+	}
+	tests := map[string]int{"groups": 2, "scope": 2, "realm_access.roles": 1, "missing": 0, "scope.nested": 0}
+	for name, want := range tests {
+		if got := claims.Strings(name); len(got) != want {
+			t.Errorf("Strings(%q) = %v, want %d values", name, got, want)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{Issuer: "issuer", ClientID: "loader", RedirectURL: "https://loader.example.com/cb"},
+		{Issuer: "https://idp.example.com", RedirectURL: "https://loader.example.com/cb"},
+		{Issuer: "https://idp.example.com", ClientID: "loader", RedirectURL: "/cb"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) accepted an invalid configuration", cfg)
+		}
+	}
+}
@@ -0,0 +1,497 @@
+// Package pipeline runs a product's post-processing steps on a completed
+// download, e.g. verify, extract, transform, upload and notify, so an
+// ingestion flow can be modelled inside the loader.
+package pipeline
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/validate"
+	"github.com/patent-dev/bulk-file-loader/internal/workpool"
+)
+
+var (
+	// ErrInvalidStep is returned for a step that is unknown or misses settings
+	ErrInvalidStep = errors.New("invalid pipeline step")
+	// ErrCommandNotAllowed is returned for a transform command the operator
+	// didn't allow
+	ErrCommandNotAllowed = errors.New("command not allowed")
+	// ErrDirNotAllowed is returned for an extract or upload directory outside
+	// the directories the operator allowed
+	ErrDirNotAllowed = errors.New("directory not allowed")
+)
+
+// Step types
+const (
+	// Verify runs validators on the downloaded file, see the validate package
+	Verify = "verify"
+	// Extract unpacks a ZIP archive; later steps work on its entries
+	Extract = "extract"
+	// Transform runs a command on the file or the extracted directory
+	Transform = "transform"
+	// Upload copies the current files to a directory or PUTs them to a URL
+	Upload = "upload"
+	// Notify emits a file.processed event
+	Notify = "notify"
+)
+
+// stderrLimit bounds the command output kept in a transform error
+const stderrLimit = 1024
+
+// maxExtractRatio bounds the bytes an archive may extract to as a multiple of
+// its size, which stops zip bombs; XML compresses to about a tenth
+const maxExtractRatio = 100
+
+// maxResponseDrain bounds how much of an upload response is read
+const maxResponseDrain = 64 << 10
+
+// Step is one stage of a pipeline. Only the fields of its type are used.
+type Step struct {
+	Type string `json:"type"`
+	// Validators for verify
+	Validators []string `json:"validators,omitempty"`
+	// Command for transform, run without a shell
+	Command []string `json:"command,omitempty"`
+	// Dir is the directory extract unpacks under, or upload copies to
+	Dir string `json:"dir,omitempty"`
+	// URL for upload; files are PUT to it with their relative path appended
+	URL string `json:"url,omitempty"`
+	// Message for notify
+	Message string `json:"message,omitempty"`
+}
+
+// Parse decodes steps stored as JSON; an empty string is no pipeline
+func Parse(data string) ([]Step, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var steps []Step
+	if err := json.Unmarshal([]byte(data), &steps); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// Check reports whether the steps are known and complete
+func Check(steps []Step) error {
+	for i, s := range steps {
+		var err error
+		switch s.Type {
+		case Verify:
+			if len(s.Validators) == 0 {
+				err = errors.New("validators required")
+			} else {
+				err = validate.Check(s.Validators)
+			}
+		case Extract, Notify:
+		case Transform:
+			if len(s.Command) == 0 || s.Command[0] == "" {
+				err = errors.New("command required")
+			}
+		case Upload:
+			err = checkUpload(s)
+		default:
+			err = fmt.Errorf("unknown type %q: use %s, %s, %s, %s or %s", s.Type, Verify, Extract, Transform, Upload, Notify)
+		}
+		if err != nil {
+			return fmt.Errorf("%w %d: %v", ErrInvalidStep, i+1, err)
+		}
+	}
+	return nil
+}
+
+// CheckCommands reports whether the transform steps run only allowed
+// commands, matched exactly against their first element
+func CheckCommands(steps []Step, allowed []string) error {
+	for i, s := range steps {
+		if s.Type != Transform || len(s.Command) == 0 {
+			continue
+		}
+		if !slices.Contains(allowed, s.Command[0]) {
+			return fmt.Errorf("step %d: %w: %s", i+1, ErrCommandNotAllowed, s.Command[0])
+		}
+	}
+	return nil
+}
+
+// CheckDirs reports whether the extract and upload steps use only
+// directories below allowed ones
+func CheckDirs(steps []Step, allowed []string) error {
+	for i, s := range steps {
+		if err := checkDir(s, allowed); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func checkDir(s Step, allowed []string) error {
+	if (s.Type != Extract && s.Type != Upload) || s.Dir == "" || config.PathWithin(s.Dir, allowed) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrDirNotAllowed, s.Dir)
+}
+
+func checkUpload(s Step) error {
+	if (s.Dir == "") == (s.URL == "") {
+		return errors.New("either dir or url required")
+	}
+	if s.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be http or https")
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		return errors.New("url must end with /")
+	}
+	return nil
+}
+
+// Job is the completed download a pipeline runs on
+type Job struct {
+	FileID    string
+	ProductID string
+	// Path is where the file is stored, Name its file name
+	Path string
+	Name string
+	// ExtractDir is the directory extract unpacks under without a dir of its own
+	ExtractDir string
+	// WorkDir is where transform runs when nothing was extracted, outside the
+	// downloads directory; it's emptied first
+	WorkDir string
+}
+
+// Env provides what steps need from the loader
+type Env struct {
+	// Pool starts transform commands at the post-processing niceness; may be nil
+	Pool   *workpool.Pool
+	Client *http.Client
+	// Commands are the executables transform steps may run
+	Commands []string
+	// Dirs are the directories extract and upload steps may use below
+	Dirs []string
+	// Notify is called by notify steps with the current files
+	Notify func(ctx context.Context, job Job, message string, files []string)
+}
+
+// StepError is returned by Run for the step that failed
+type StepError struct {
+	Index int
+	Type  string
+	Err   error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %d (%s): %v", e.Index+1, e.Type, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// state is what the steps so far produced: the files later steps work on,
+// relative to base
+type state struct {
+	base  string
+	files []string
+}
+
+// Run runs the steps in order, stopping at the first failure
+func Run(ctx context.Context, steps []Step, job Job, env Env) error {
+	st := &state{base: filepath.Dir(job.Path), files: []string{job.Path}}
+	for i, s := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var err error
+		switch s.Type {
+		case Verify:
+			err = validate.File(ctx, job.Path, job.Name, s.Validators)
+		case Extract:
+			err = extract(ctx, s, job, st, env.Dirs)
+		case Transform:
+			err = transform(ctx, s, job, st, env)
+		case Upload:
+			err = upload(ctx, s, st, env)
+		case Notify:
+			if env.Notify != nil {
+				env.Notify(ctx, job, s.Message, st.files)
+			}
+		default:
+			err = ErrInvalidStep
+		}
+		if err != nil {
+			return &StepError{Index: i, Type: s.Type, Err: err}
+		}
+	}
+	return nil
+}
+
+// extract unpacks the archive to <dir>/<name without extension>, replacing an
+// earlier extraction. The archive may extract to maxExtractRatio times its
+// size.
+func extract(ctx context.Context, s Step, job Job, st *state, dirs []string) error {
+	// Checked again as the pipeline may predate the allowed directories
+	if err := checkDir(s, dirs); err != nil {
+		return err
+	}
+	root := s.Dir
+	if root == "" {
+		root = job.ExtractDir
+	}
+	base := strings.TrimSuffix(job.Name, filepath.Ext(job.Name))
+	if base == "" || base == "." || !filepath.IsLocal(base) {
+		return fmt.Errorf("%s: no directory to extract to", job.Name)
+	}
+	target := filepath.Join(root, base)
+	zr, err := zip.OpenReader(job.Path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	info, err := os.Stat(job.Path)
+	if err != nil {
+		return err
+	}
+	remaining := info.Size() * maxExtractRatio
+
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	var files []string
+	for _, f := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := filepath.FromSlash(f.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("%s: entry outside the archive", f.Name)
+		}
+		dest := filepath.Join(target, name)
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		n, err := extractFile(f, dest, remaining)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		remaining -= n
+		files = append(files, dest)
+	}
+	st.base, st.files = target, files
+	return nil
+}
+
+// extractFile writes the entry to dest and returns its size, failing once it
+// exceeds limit
+func extractFile(f *zip.File, dest string, limit int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return 0, err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, io.LimitReader(rc, limit+1))
+	if err == nil && n > limit {
+		err = fmt.Errorf("archive extracts to more than %d times its size", maxExtractRatio)
+	}
+	if err != nil {
+		out.Close()
+		return n, err
+	}
+	return n, out.Close()
+}
+
+// transform runs the command in the extracted directory, or the job's work
+// directory, with the job in BULK_LOADER_* variables. Files it writes there
+// are picked up by later steps; files written to the work directory replace
+// the download.
+func transform(ctx context.Context, s Step, job Job, st *state, env Env) error {
+	// Checked again as the pipeline may predate the allowed commands
+	if !slices.Contains(env.Commands, s.Command[0]) {
+		return fmt.Errorf("%w: %s", ErrCommandNotAllowed, s.Command[0])
+	}
+	dir := st.base
+	inPlace := dir == filepath.Dir(job.Path)
+	if inPlace {
+		// Output written next to the download would be an orphan to
+		// reconciliation
+		dir = job.WorkDir
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	pool := env.Pool
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"BULK_LOADER_FILE="+job.Path,
+		"BULK_LOADER_FILE_ID="+job.FileID,
+		"BULK_LOADER_PRODUCT_ID="+job.ProductID,
+		"BULK_LOADER_WORK_DIR="+dir,
+	)
+	var stderr tailBuffer
+	cmd.Stderr = &stderr
+	start := cmd.Start
+	if pool != nil {
+		start = func() error { return pool.Start(cmd) }
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+
+	files, err := scan(dir)
+	if err != nil {
+		return err
+	}
+	// Without output, later steps keep working on the download
+	if !inPlace || len(files) > 0 {
+		st.base, st.files = dir, files
+	}
+	return nil
+}
+
+// scan lists the regular files under dir
+func scan(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return err
+	})
+	return files, err
+}
+
+// upload copies or PUTs the current files, keeping their paths relative to
+// the extracted directory
+func upload(ctx context.Context, s Step, st *state, env Env) error {
+	// Checked again as the pipeline may predate the allowed directories
+	if err := checkDir(s, env.Dirs); err != nil {
+		return err
+	}
+	client := env.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for _, path := range st.files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(st.base, path)
+		if err != nil {
+			return err
+		}
+		if s.Dir != "" {
+			err = copyFile(path, filepath.Join(s.Dir, rel))
+		} else {
+			err = put(ctx, client, s.URL+(&url.URL{Path: filepath.ToSlash(rel)}).EscapedPath(), path)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+func copyFile(source, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func put(ctx context.Context, client *http.Client, target, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseDrain))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("upload returned %s", resp.Status)
+	}
+	return nil
+}
+
+// tailBuffer keeps the last stderrLimit bytes written to it
+type tailBuffer struct {
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	if len(p) >= stderrLimit {
+		b.data = append(b.data[:0], p[len(p)-stderrLimit:]...)
+		return len(p), nil
+	}
+	if over := len(b.data) + len(p) - stderrLimit; over > 0 {
+		b.data = append(b.data[:0], b.data[over:]...)
+	}
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.data)
+}
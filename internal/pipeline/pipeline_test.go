@@ -0,0 +1,248 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func writeZip(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestCheck(t *testing.T) {
+	valid := []Step{
+		{Type: Verify, Validators: []string{"zip"}},
+		{Type: Extract},
+		{Type: Transform, Command: []string{"true"}},
+		{Type: Upload, Dir: "/srv/ingest"},
+		{Type: Upload, URL: "https://example.com/ingest/"},
+		{Type: Notify},
+	}
+	if err := Check(valid); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+
+	for _, s := range []Step{
+		{Type: "copy"},
+		{Type: Verify},
+		{Type: Verify, Validators: []string{"gzip"}},
+		{Type: Transform},
+		{Type: Upload},
+		{Type: Upload, Dir: "/srv", URL: "https://example.com/"},
+		{Type: Upload, URL: "ftp://example.com/"},
+		{Type: Upload, URL: "https://example.com/ingest"},
+	} {
+		if err := Check([]Step{s}); !errors.Is(err, ErrInvalidStep) {
+			t.Errorf("Check(%+v) error = %v, want ErrInvalidStep", s, err)
+		}
+	}
+}
+
+func TestCheckCommands(t *testing.T) {
+	steps := []Step{{Type: Extract}, {Type: Transform, Command: []string{"/opt/convert.sh", "-v"}}}
+	if err := CheckCommands(steps, []string{"/opt/convert.sh"}); err != nil {
+		t.Errorf("CheckCommands() error = %v", err)
+	}
+	for _, allowed := range [][]string{nil, {"convert.sh"}, {"/opt/convert"}} {
+		if err := CheckCommands(steps, allowed); !errors.Is(err, ErrCommandNotAllowed) {
+			t.Errorf("CheckCommands(%v) error = %v, want ErrCommandNotAllowed", allowed, err)
+		}
+	}
+}
+
+func TestCheckDirs(t *testing.T) {
+	root := t.TempDir()
+	steps := []Step{{Type: Extract}, {Type: Upload, Dir: filepath.Join(root, "out")}, {Type: Upload, URL: "https://example.com/"}}
+	if err := CheckDirs(steps, []string{root}); err != nil {
+		t.Errorf("CheckDirs() error = %v", err)
+	}
+	for _, dir := range []string{"/srv/ingest", filepath.Join(root, "..", "out"), "out"} {
+		steps := []Step{{Type: Extract, Dir: dir}}
+		if err := CheckDirs(steps, []string{root}); !errors.Is(err, ErrDirNotAllowed) {
+			t.Errorf("CheckDirs(%q) error = %v, want ErrDirNotAllowed", dir, err)
+		}
+	}
+	if err := CheckDirs([]Step{{Type: Upload, Dir: root}}, nil); !errors.Is(err, ErrDirNotAllowed) {
+		t.Errorf("CheckDirs() without allowed dirs error = %v, want ErrDirNotAllowed", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "a.zip")
+	writeZip(t, archive, map[string]string{"doc/1.xml": "<doc/>", "doc/2.xml": "<doc/>"})
+
+	var mu sync.Mutex
+	uploaded := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		uploaded[r.URL.Path] = string(body)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	var notified []string
+	steps := []Step{
+		{Type: Verify, Validators: []string{"zip", "xml"}},
+		{Type: Extract},
+		{Type: Transform, Command: []string{"sh", "-c", `echo "$BULK_LOADER_FILE_ID" > id.txt`}},
+		{Type: Upload, Dir: filepath.Join(dir, "out")},
+		{Type: Upload, URL: server.URL + "/ingest/"},
+		{Type: Notify, Message: "ingested"},
+	}
+	job := Job{FileID: "f1", ProductID: "p1", Path: archive, Name: "a.zip", ExtractDir: filepath.Join(dir, "extracted")}
+	env := Env{Commands: []string{"sh"}, Dirs: []string{dir}, Notify: func(ctx context.Context, job Job, message string, files []string) {
+		notified = append(notified, message)
+		notified = append(notified, files...)
+	}}
+	if err := Run(context.Background(), steps, job, env); err != nil {
+		t.Fatal(err)
+	}
+
+	extracted := filepath.Join(dir, "extracted", "a")
+	for _, name := range []string{"doc/1.xml", "doc/2.xml", "id.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, "out", name)); err != nil {
+			t.Errorf("%s not copied: %v", name, err)
+		}
+		if _, ok := uploaded["/ingest/"+name]; !ok {
+			t.Errorf("%s not uploaded, got %v", name, uploaded)
+		}
+	}
+	if uploaded["/ingest/id.txt"] != "f1\n" {
+		t.Errorf("transform output = %q, want the file ID", uploaded["/ingest/id.txt"])
+	}
+	if len(notified) != 4 || notified[0] != "ingested" || !slices.Contains(notified, filepath.Join(extracted, "id.txt")) {
+		t.Errorf("notified = %v, want the message and the 3 files", notified)
+	}
+}
+
+func TestRunStepError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.zip")
+	os.WriteFile(path, []byte("not a zip"), 0644)
+	job := Job{Path: path, Name: "a.zip", ExtractDir: dir, WorkDir: filepath.Join(dir, "work")}
+
+	var notified bool
+	env := Env{Commands: []string{"sh"}, Notify: func(context.Context, Job, string, []string) { notified = true }}
+	err := Run(context.Background(), []Step{{Type: Extract}, {Type: Notify}}, job, env)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Index != 0 || stepErr.Type != Extract {
+		t.Errorf("Run() error = %v, want a StepError for step 1", err)
+	}
+	if notified {
+		t.Error("steps after the failing one ran")
+	}
+
+	err = Run(context.Background(), []Step{{Type: Transform, Command: []string{"sh", "-c", "echo broken >&2; exit 3"}}}, job, env)
+	if err == nil || !errors.As(err, &stepErr) || stepErr.Type != Transform {
+		t.Errorf("Run() error = %v, want a transform StepError", err)
+	}
+
+	err = Run(context.Background(), []Step{{Type: Transform, Command: []string{"true"}}}, job, env)
+	if !errors.Is(err, ErrCommandNotAllowed) {
+		t.Errorf("Run() error = %v, want ErrCommandNotAllowed", err)
+	}
+}
+
+func TestTransformWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	downloads := filepath.Join(dir, "downloads")
+	os.MkdirAll(downloads, 0755)
+	path := filepath.Join(downloads, "a.xml")
+	os.WriteFile(path, []byte("<a/>"), 0644)
+	job := Job{FileID: "f1", Path: path, Name: "a.xml", WorkDir: filepath.Join(dir, "work", "f1")}
+	env := Env{Commands: []string{"sh", "true"}, Dirs: []string{dir}}
+
+	steps := []Step{
+		{Type: Transform, Command: []string{"sh", "-c", `tr a b < "$BULK_LOADER_FILE" > b.xml`}},
+		{Type: Upload, Dir: filepath.Join(dir, "out")},
+	}
+	if err := Run(context.Background(), steps, job, env); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "out", "b.xml")); string(data) != "<b/>" {
+		t.Errorf("uploaded output = %q, want <b/>", data)
+	}
+	if entries, _ := os.ReadDir(downloads); len(entries) != 1 {
+		t.Errorf("downloads directory has %d entries, want only the download", len(entries))
+	}
+
+	// Without output the download is uploaded
+	steps = []Step{{Type: Transform, Command: []string{"true"}}, {Type: Upload, Dir: filepath.Join(dir, "out2")}}
+	if err := Run(context.Background(), steps, job, env); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out2", "a.xml")); err != nil {
+		t.Errorf("download not uploaded: %v", err)
+	}
+}
+
+func TestExtractRejectsEscapingEntries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.zip")
+	writeZip(t, path, map[string]string{"../evil.txt": "x"})
+	job := Job{Path: path, Name: "a.zip", ExtractDir: filepath.Join(dir, "extracted")}
+
+	if err := Run(context.Background(), []Step{{Type: Extract}}, job, Env{}); err == nil {
+		t.Error("expected an entry outside the archive to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "extracted", "evil.txt")); err == nil {
+		t.Error("escaping entry was written")
+	}
+}
+
+func TestDirsOutsideAllowedRoot(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.zip")
+	writeZip(t, path, map[string]string{"1.xml": "<a/>"})
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "keep.txt"), []byte("x"), 0644)
+	job := Job{Path: path, Name: "a.zip", ExtractDir: filepath.Join(dir, "extracted")}
+	env := Env{Dirs: []string{filepath.Join(dir, "extracted")}}
+
+	for _, step := range []Step{{Type: Extract, Dir: outside}, {Type: Upload, Dir: outside}} {
+		if err := Run(context.Background(), []Step{step}, job, env); !errors.Is(err, ErrDirNotAllowed) {
+			t.Errorf("Run(%s to %s) error = %v, want ErrDirNotAllowed", step.Type, outside, err)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 1 {
+		t.Errorf("directory outside the allowed root has %d entries, want it untouched", len(entries))
+	}
+}
+
+func TestExtractLimit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bomb.zip")
+	writeZip(t, path, map[string]string{"zeros.bin": string(make([]byte, 4<<20))})
+	job := Job{Path: path, Name: "bomb.zip", ExtractDir: filepath.Join(dir, "extracted")}
+
+	if err := Run(context.Background(), []Step{{Type: Extract}}, job, Env{}); err == nil {
+		t.Error("expected an archive extracting to more than the ratio limit to fail")
+	}
+}
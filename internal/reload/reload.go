@@ -0,0 +1,223 @@
+// Package reload re-reads the configuration at runtime and applies the
+// settings that can change without a restart.
+package reload
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/downloader"
+	"github.com/patent-dev/bulk-file-loader/internal/scheduler"
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/workpool"
+)
+
+// Result describes what a reload changed
+type Result struct {
+	MaxConcurrent   int
+	DownloadTimeout int
+	// PostProcessWorkers is the new size of the post-processing pool
+	PostProcessWorkers int
+	Schedules          int
+	// RestartRequired lists changed settings that only take effect after a restart
+	RestartRequired []string
+}
+
+// Reloader applies configuration changes to the running services
+type Reloader struct {
+	mu         sync.Mutex
+	current    config.Config
+	downloader *downloader.Downloader
+	scheduler  *scheduler.Scheduler
+	pool       *workpool.Pool
+}
+
+func New(cfg *config.Config, dl *downloader.Downloader, sched *scheduler.Scheduler, pool *workpool.Pool) *Reloader {
+	return &Reloader{
+		current:    *cfg,
+		downloader: dl,
+		scheduler:  sched,
+		pool:       pool,
+	}
+}
+
+// Reload re-reads the configuration, applies proxy overrides, download limits
+// the sync retry policy and the credential reminder, and reloads product
+// schedules from the database
+func (r *Reloader) Reload() (*Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("load configuration: %w", err)
+	}
+	if cfg.MaxConcurrent < 1 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_MAX_CONCURRENT: %d", cfg.MaxConcurrent)
+	}
+	if cfg.DownloadTimeout < 1 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_DOWNLOAD_TIMEOUT: %d", cfg.DownloadTimeout)
+	}
+	if cfg.DownloadMinTimeout < 1 || cfg.DownloadMaxTimeout < cfg.DownloadMinTimeout {
+		return nil, fmt.Errorf("invalid download timeouts: minimum %d, maximum %d", cfg.DownloadMinTimeout, cfg.DownloadMaxTimeout)
+	}
+	if cfg.DownloadMinThroughput < 0 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_DOWNLOAD_MIN_THROUGHPUT: %d", cfg.DownloadMinThroughput)
+	}
+	if cfg.PostProcessWorkers < 1 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_POSTPROCESS_WORKERS: %d", cfg.PostProcessWorkers)
+	}
+	if cfg.PostProcessNice < 0 || cfg.PostProcessNice > 19 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_POSTPROCESS_NICE: %d", cfg.PostProcessNice)
+	}
+	if cfg.SyncRetries < 0 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_SYNC_RETRIES: %d", cfg.SyncRetries)
+	}
+	if cfg.SyncRetryDelay < 1 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_SYNC_RETRY_DELAY: %d", cfg.SyncRetryDelay)
+	}
+	if cfg.CredentialReminderDays < 0 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_CREDENTIAL_REMINDER_DAYS: %d", cfg.CredentialReminderDays)
+	}
+	if cfg.DeliveryReminderDays < 0 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_DELIVERY_REMINDER_DAYS: %d", cfg.DeliveryReminderDays)
+	}
+	if cfg.DownloadRetentionDays < 0 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_DOWNLOAD_RETENTION_DAYS: %d", cfg.DownloadRetentionDays)
+	}
+	if cfg.ArchiveAfterDays < 0 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_ARCHIVE_AFTER_DAYS: %d", cfg.ArchiveAfterDays)
+	}
+	if cfg.ScheduleJitter < 0 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_SCHEDULE_JITTER: %d", cfg.ScheduleJitter)
+	}
+	if cfg.MaxConcurrentSyncs < 1 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_MAX_CONCURRENT_SYNCS: %d", cfg.MaxConcurrentSyncs)
+	}
+	if cfg.SyncFailureLimit < 0 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_SYNC_FAILURE_LIMIT: %d", cfg.SyncFailureLimit)
+	}
+	if cfg.StorageQuotaGB < 0 {
+		return nil, fmt.Errorf("invalid BULK_LOADER_STORAGE_QUOTA_GB: %d", cfg.StorageQuotaGB)
+	}
+
+	if err := sources.ConfigureProxy(cfg.SourceProxies); err != nil {
+		return nil, err
+	}
+	r.downloader.Reconfigure(cfg.MaxConcurrent, downloader.NewTimeoutPolicy(cfg))
+	r.downloader.SetBlackout(cfg.Blackout)
+	r.downloader.SetDownloadWindow(cfg.DownloadWindow)
+	r.downloader.SetStorageQuota(int64(cfg.StorageQuotaGB) << 30)
+	r.downloader.SetLatestLinks(cfg.LatestLinks)
+	r.downloader.SetDedup(cfg.Dedup)
+	r.pool.Reconfigure(cfg.PostProcessWorkers, cfg.PostProcessNice)
+	r.scheduler.SetRetryPolicy(cfg.SyncRetries, time.Duration(cfg.SyncRetryDelay)*time.Second)
+	r.scheduler.SetCredentialReminder(cfg.CredentialReminderDays)
+	r.scheduler.SetDeliveryReminder(cfg.DeliveryReminderDays)
+	r.scheduler.SetDownloadRetention(cfg.DownloadRetentionDays)
+	r.scheduler.SetArchiveAge(cfg.ArchiveAfterDays)
+	r.scheduler.SetArchiveExpired(cfg.ArchiveExpired)
+	r.scheduler.SetReconcileFix(cfg.ReconcileFix)
+	r.scheduler.SetScheduleJitter(time.Duration(cfg.ScheduleJitter) * time.Second)
+	r.scheduler.SetBlackout(cfg.Blackout)
+	r.scheduler.SetMaxConcurrentSyncs(cfg.MaxConcurrentSyncs)
+	r.scheduler.SetSyncFailureLimit(cfg.SyncFailureLimit)
+
+	result := &Result{
+		MaxConcurrent:      cfg.MaxConcurrent,
+		DownloadTimeout:    cfg.DownloadTimeout,
+		PostProcessWorkers: cfg.PostProcessWorkers,
+		Schedules:          r.scheduler.Reload(),
+		RestartRequired:    restartRequired(&r.current, cfg),
+	}
+	r.current.MaxConcurrent = cfg.MaxConcurrent
+	r.current.DownloadTimeout = cfg.DownloadTimeout
+	r.current.DownloadMinTimeout = cfg.DownloadMinTimeout
+	r.current.DownloadMaxTimeout = cfg.DownloadMaxTimeout
+	r.current.DownloadMinThroughput = cfg.DownloadMinThroughput
+
+	slog.Info("Configuration reloaded",
+		"maxConcurrent", result.MaxConcurrent,
+		"downloadTimeout", result.DownloadTimeout,
+		"postProcessWorkers", result.PostProcessWorkers,
+		"schedules", result.Schedules,
+	)
+	for _, name := range result.RestartRequired {
+		slog.Warn("Changed setting requires a restart", "setting", name)
+	}
+	return result, nil
+}
+
+func restartRequired(old, cfg *config.Config) []string {
+	var changed []string
+	check := func(name string, differs bool) {
+		if differs {
+			changed = append(changed, name)
+		}
+	}
+	check("BULK_LOADER_PASSPHRASE", old.Passphrase != cfg.Passphrase)
+	check("BULK_LOADER_DB_DRIVER", old.DBDriver != cfg.DBDriver)
+	check("BULK_LOADER_DB_DSN", old.DBDSN != cfg.DBDSN)
+	check("BULK_LOADER_DATA_DIR", old.DataDir != cfg.DataDir)
+	check("BULK_LOADER_DOWNLOADS_DIR", old.DownloadsDir != cfg.DownloadsDir)
+	check("BULK_LOADER_STORAGE_LAYOUT", old.StorageLayout != cfg.StorageLayout)
+	check("BULK_LOADER_LISTEN_ADDR", old.ListenAddr != cfg.ListenAddr)
+	check("BULK_LOADER_PORT", old.Port != cfg.Port)
+	check("BULK_LOADER_SHUTDOWN_DRAIN", old.ShutdownDrain != cfg.ShutdownDrain)
+	check("BULK_LOADER_WEBHOOK_RETRIES", old.WebhookRetries != cfg.WebhookRetries)
+	check("BULK_LOADER_WEBHOOK_RETRY_DELAY", old.WebhookRetryDelay != cfg.WebhookRetryDelay)
+	check("BULK_LOADER_EVENT_RETENTION_DAYS", old.EventRetentionDays != cfg.EventRetentionDays)
+	check("BULK_LOADER_SMTP_HOST", old.SMTPHost != cfg.SMTPHost)
+	check("BULK_LOADER_SMTP_PORT", old.SMTPPort != cfg.SMTPPort)
+	check("BULK_LOADER_SMTP_USERNAME", old.SMTPUsername != cfg.SMTPUsername)
+	check("BULK_LOADER_SMTP_PASSWORD", old.SMTPPassword != cfg.SMTPPassword)
+	check("BULK_LOADER_SMTP_FROM", old.SMTPFrom != cfg.SMTPFrom)
+	check("BULK_LOADER_KAFKA_BROKERS", strings.Join(old.KafkaBrokers, ",") != strings.Join(cfg.KafkaBrokers, ","))
+	check("BULK_LOADER_KAFKA_TOPIC", old.KafkaTopic != cfg.KafkaTopic)
+	check("BULK_LOADER_KAFKA_USERNAME", old.KafkaUsername != cfg.KafkaUsername)
+	check("BULK_LOADER_KAFKA_PASSWORD", old.KafkaPassword != cfg.KafkaPassword)
+	check("BULK_LOADER_KAFKA_TLS", old.KafkaTLS != cfg.KafkaTLS)
+	check("BULK_LOADER_NATS_URL", old.NATSURL != cfg.NATSURL)
+	check("BULK_LOADER_NATS_SUBJECT", old.NATSSubject != cfg.NATSSubject)
+	check("BULK_LOADER_NATS_JETSTREAM", old.NATSJetStream != cfg.NATSJetStream)
+	check("BULK_LOADER_SQS_QUEUE_URL", old.SQSQueueURL != cfg.SQSQueueURL)
+	check("BULK_LOADER_SNS_TOPIC_ARN", old.SNSTopicARN != cfg.SNSTopicARN)
+	check("BULK_LOADER_AWS_REGION", old.AWSRegion != cfg.AWSRegion)
+	check("BULK_LOADER_AWS_ACCESS_KEY_ID", old.AWSAccessKeyID != cfg.AWSAccessKeyID)
+	check("BULK_LOADER_AWS_SECRET_ACCESS_KEY", old.AWSSecretAccessKey != cfg.AWSSecretAccessKey)
+	check("BULK_LOADER_AWS_SESSION_TOKEN", old.AWSSessionToken != cfg.AWSSessionToken)
+	check("BULK_LOADER_AWS_ENDPOINT", old.AWSEndpoint != cfg.AWSEndpoint)
+	check("BULK_LOADER_AMQP_URL", old.AMQPURL != cfg.AMQPURL)
+	check("BULK_LOADER_AMQP_EXCHANGE", old.AMQPExchange != cfg.AMQPExchange)
+	check("BULK_LOADER_SOCKET", old.SocketPath != cfg.SocketPath)
+	check("BULK_LOADER_SOCKET_MODE", old.SocketMode != cfg.SocketMode)
+	check("BULK_LOADER_GRPC_PORT", old.GRPCPort != cfg.GRPCPort)
+	check("BULK_LOADER_DEV_MODE", old.DevMode != cfg.DevMode)
+	check("BULK_LOADER_VITE_PROXY", old.ViteProxy != cfg.ViteProxy)
+	check("BULK_LOADER_TELEMETRY", old.Telemetry != cfg.Telemetry)
+	check("BULK_LOADER_TELEMETRY_URL", old.TelemetryURL != cfg.TelemetryURL)
+	check("BULK_LOADER_STANDBY_PRIMARY", old.StandbyPrimary != cfg.StandbyPrimary)
+	check("BULK_LOADER_STANDBY_INTERVAL", old.StandbyInterval != cfg.StandbyInterval)
+	check("BULK_LOADER_TLS_CERT", old.TLSCertFile != cfg.TLSCertFile)
+	check("BULK_LOADER_TLS_KEY", old.TLSKeyFile != cfg.TLSKeyFile)
+	check("BULK_LOADER_ACME_DOMAINS", strings.Join(old.ACMEDomains, ",") != strings.Join(cfg.ACMEDomains, ","))
+	check("BULK_LOADER_ACME_EMAIL", old.ACMEEmail != cfg.ACMEEmail)
+	check("BULK_LOADER_ACME_CACHE_DIR", old.ACMECacheDir != cfg.ACMECacheDir)
+	check("BULK_LOADER_OIDC_ISSUER", old.OIDCIssuer != cfg.OIDCIssuer)
+	check("BULK_LOADER_OIDC_CLIENT_ID", old.OIDCClientID != cfg.OIDCClientID)
+	check("BULK_LOADER_OIDC_CLIENT_SECRET", old.OIDCClientSecret != cfg.OIDCClientSecret)
+	check("BULK_LOADER_OIDC_REDIRECT_URL", old.OIDCRedirectURL != cfg.OIDCRedirectURL)
+	check("BULK_LOADER_OIDC_SCOPES", strings.Join(old.OIDCScopes, ",") != strings.Join(cfg.OIDCScopes, ","))
+	check("BULK_LOADER_OIDC_GROUPS_CLAIM", old.OIDCGroupsClaim != cfg.OIDCGroupsClaim)
+	check("BULK_LOADER_OIDC_ROLES", old.OIDCRoles != cfg.OIDCRoles)
+	check("BULK_LOADER_PROXY_AUTH_HEADER", old.ProxyAuthHeader != cfg.ProxyAuthHeader)
+	check("BULK_LOADER_PROXY_AUTH_TRUSTED", strings.Join(old.ProxyAuthTrusted, ",") != strings.Join(cfg.ProxyAuthTrusted, ","))
+	check("BULK_LOADER_PROXY_AUTH_ROLE", old.ProxyAuthRole != cfg.ProxyAuthRole)
+	check("BULK_LOADER_DISABLE_LOGIN", old.DisableLogin != cfg.DisableLogin)
+	check("BULK_LOADER_READ_ONLY", old.ReadOnly != cfg.ReadOnly)
+	return changed
+}
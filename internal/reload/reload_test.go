@@ -0,0 +1,79 @@
+package reload
+
+import (
+	"os"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/downloader"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+	"github.com/patent-dev/bulk-file-loader/internal/scheduler"
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/workpool"
+)
+
+func TestReload(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gormDB.AutoMigrate(&database.Source{}, &database.Product{}, &database.Webhook{})
+	db := &database.DB{DB: gormDB}
+
+	dataDir := t.TempDir()
+	os.Setenv("BULK_LOADER_DATA_DIR", dataDir)
+	defer os.Unsetenv("BULK_LOADER_DATA_DIR")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := sources.NewRegistry(db, cfg)
+	hooksManager := hooks.New(db)
+	dl := downloader.New(db, registry, hooksManager, cfg)
+	sched := scheduler.New(db, registry, dl, hooksManager)
+	defer sched.Stop()
+
+	pool := workpool.New(cfg.PostProcessWorkers, cfg.PostProcessNice)
+	reloader := New(cfg, dl, sched, pool)
+
+	db.Create(&database.Product{ID: "p1", AutoDownload: true, CheckWindowStart: "0 6 * * *"})
+	os.Setenv("BULK_LOADER_MAX_CONCURRENT", "8")
+	os.Setenv("BULK_LOADER_POSTPROCESS_WORKERS", "2")
+	os.Setenv("BULK_LOADER_PORT", "9999")
+	defer os.Unsetenv("BULK_LOADER_POSTPROCESS_WORKERS")
+	defer os.Unsetenv("BULK_LOADER_MAX_CONCURRENT")
+	defer os.Unsetenv("BULK_LOADER_PORT")
+
+	result, err := reloader.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MaxConcurrent != 8 {
+		t.Errorf("MaxConcurrent = %d, want 8", result.MaxConcurrent)
+	}
+	if pool.Stats().Workers != 2 {
+		t.Errorf("post-processing workers = %d, want 2", pool.Stats().Workers)
+	}
+	if result.Schedules != 1 {
+		t.Errorf("Schedules = %d, want 1", result.Schedules)
+	}
+	if len(result.RestartRequired) != 1 || result.RestartRequired[0] != "BULK_LOADER_PORT" {
+		t.Errorf("RestartRequired = %v, want [BULK_LOADER_PORT]", result.RestartRequired)
+	}
+	if sched.GetNextRun("p1") == nil {
+		t.Error("p1 should be scheduled after reload")
+	}
+
+	os.Setenv("BULK_LOADER_MAX_CONCURRENT", "0")
+	if _, err := reloader.Reload(); err == nil {
+		t.Error("Reload() should reject a concurrency of 0")
+	}
+}
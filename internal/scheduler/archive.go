@@ -0,0 +1,36 @@
+package scheduler
+
+import (
+	"log/slog"
+	"time"
+)
+
+const archiveSchedule = "@daily"
+
+// SetArchiveAge sets after how many days deliveries and their files are
+// archived. 0 turns archiving off.
+func (s *Scheduler) SetArchiveAge(days int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.archiveAge = time.Duration(days) * 24 * time.Hour
+}
+
+// archive flags deliveries older than the archive age and their files as
+// archived
+func (s *Scheduler) archive(now time.Time) {
+	s.mu.Lock()
+	age := s.archiveAge
+	s.mu.Unlock()
+	if age <= 0 {
+		return
+	}
+
+	archived, err := s.db.ArchiveDeliveries(now.Add(-age))
+	if err != nil {
+		slog.Error("Failed to archive old deliveries", "error", err)
+		return
+	}
+	if archived > 0 {
+		slog.Info("Archived old files", "files", archived)
+	}
+}
@@ -0,0 +1,47 @@
+package scheduler
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/blackout"
+)
+
+// SetBlackout sets the periods in which scheduled syncs, retries and
+// catch-ups are deferred until the period ends
+func (s *Scheduler) SetBlackout(schedule blackout.Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blackout = schedule
+}
+
+// blackoutEnd reports whether t falls into a blackout period and when it ends
+func (s *Scheduler) blackoutEnd(t time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blackout.End(t)
+}
+
+// deferSync runs a sync once the blackout ends. Like the scheduled runs, the
+// deferred syncs of different products are spread by the jitter.
+func (s *Scheduler) deferSync(productID, trigger string, attempt int, until time.Time) {
+	s.mu.Lock()
+	delay := time.Until(until) + jitterOffset(productID, s.jitter)
+	s.mu.Unlock()
+
+	s.retryMu.Lock()
+	defer s.retryMu.Unlock()
+	if s.retryTimers == nil {
+		s.retryTimers = make(map[string]*time.Timer)
+	}
+	if t, ok := s.retryTimers[productID]; ok {
+		t.Stop()
+	}
+	s.retryTimers[productID] = time.AfterFunc(delay, func() {
+		s.retryMu.Lock()
+		delete(s.retryTimers, productID)
+		s.retryMu.Unlock()
+		s.syncProduct(productID, trigger, attempt)
+	})
+	slog.Info("Blackout period, sync deferred", "productID", productID, "trigger", trigger, "until", until)
+}
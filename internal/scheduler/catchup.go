@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// CatchUp syncs the scheduled products whose last scheduled run was missed,
+// e.g. because the server was down, instead of waiting for the next one. The
+// syncs run one after another in the background. It returns the number of
+// products caught up.
+func (s *Scheduler) CatchUp() int {
+	missed := s.missedRuns(time.Now())
+	if len(missed) == 0 {
+		return 0
+	}
+
+	slog.Info("Catching up missed scheduled syncs", "count", len(missed))
+	go func() {
+		for _, productID := range missed {
+			s.syncProduct(productID, database.SyncTriggerCatchUp, 1)
+		}
+	}()
+	return len(missed)
+}
+
+// missedRuns returns the IDs of scheduled products with a run due between
+// their last sync without errors, or their creation if they never had one,
+// and now
+func (s *Scheduler) missedRuns(now time.Time) []string {
+	var products []database.Product
+	enabledSources := s.db.Model(&database.Source{}).Select("id").Where("enabled = ?", true)
+	err := s.db.Where("auto_download = ? AND check_window_start != ? AND sync_disabled_at IS NULL AND source_id IN (?)", true, "", enabledSources).
+		Find(&products).Error
+	if err != nil {
+		slog.Error("Failed to load scheduled products", "error", err)
+		return nil
+	}
+
+	s.mu.Lock()
+	jitter := s.jitter
+	s.mu.Unlock()
+
+	var missed []string
+	for _, product := range products {
+		schedule, err := cron.ParseStandard(product.CheckWindowStart)
+		if err != nil {
+			continue
+		}
+		last := product.CreatedAt
+		if product.LastSyncedAt != nil {
+			last = *product.LastSyncedAt
+		}
+		due := jitterSchedule{Schedule: schedule, offset: jitterOffset(product.ID, jitter)}.Next(last)
+		if !due.After(now) {
+			missed = append(missed, product.ID)
+		}
+	}
+	return missed
+}
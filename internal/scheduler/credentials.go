@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+)
+
+const (
+	defaultCredentialReminder = 14 * 24 * time.Hour
+	credentialCheckSchedule   = "@hourly"
+)
+
+// SetCredentialReminder sets how many days before source credentials expire
+// the credentials.expiring event is emitted. 0 disables reminders.
+func (s *Scheduler) SetCredentialReminder(days int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credentialReminder = time.Duration(days) * 24 * time.Hour
+}
+
+// checkCredentials emits credentials.expiring once for each source whose
+// credentials expire within the reminder period or have already expired
+func (s *Scheduler) checkCredentials(now time.Time) {
+	s.mu.Lock()
+	reminder := s.credentialReminder
+	s.mu.Unlock()
+	if reminder <= 0 {
+		return
+	}
+
+	var expiring []database.Source
+	err := s.db.Where("credentials_expire_at IS NOT NULL AND credentials_expire_at <= ? AND credentials_reminded_at IS NULL", now.Add(reminder)).
+		Find(&expiring).Error
+	if err != nil {
+		slog.Error("Failed to check credential expiry", "error", err)
+		return
+	}
+
+	for _, source := range expiring {
+		expireAt := source.CredentialsExpireAt.UTC()
+		message := fmt.Sprintf("Credentials expire on %s", expireAt.Format(time.DateOnly))
+		severity := "warning"
+		if !expireAt.After(now) {
+			message = fmt.Sprintf("Credentials expired on %s", expireAt.Format(time.DateOnly))
+			severity = "error"
+		}
+
+		slog.Warn("Source credentials expiring", "source", source.ID, "expireAt", expireAt)
+		s.hooks.Emit(context.Background(), hooks.NewEvent(hooks.EventCredentialsExpiring, source.ID).
+			WithAlert("credentials_expiring", message, severity))
+
+		if err := s.db.Model(&source).Update("credentials_reminded_at", now).Error; err != nil {
+			slog.Error("Failed to record credential reminder", "source", source.ID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+)
+
+const (
+	defaultDeliveryReminder = 7 * 24 * time.Hour
+	deliveryCheckSchedule   = "@hourly"
+)
+
+// SetDeliveryReminder sets how many days before a delivery expires the
+// delivery.expiring event is emitted for files not yet downloaded. 0 disables
+// reminders.
+func (s *Scheduler) SetDeliveryReminder(days int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveryReminder = time.Duration(days) * 24 * time.Hour
+}
+
+// SetArchiveExpired sets whether files of expired deliveries that were never
+// downloaded are archived along with being marked expired
+func (s *Scheduler) SetArchiveExpired(archive bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.archiveExpired = archive
+}
+
+// checkDeliveries emits delivery.expiring once for each delivery that expires
+// within the reminder period while some of its files aren't downloaded, and
+// clears the mark of deliveries downloaded since
+func (s *Scheduler) checkDeliveries(now time.Time) {
+	s.mu.Lock()
+	reminder := s.deliveryReminder
+	s.mu.Unlock()
+	if reminder <= 0 {
+		return
+	}
+
+	pending := s.db.Model(&database.File{}).Select("delivery_id").
+		Where("skipped = ? AND expired = ? AND status <> ? AND archived_at IS NULL", false, false, database.FileStatusDownloaded)
+	err := s.db.Model(&database.Delivery{}).
+		Where("expiry_reminded_at IS NOT NULL AND id NOT IN (?)", pending).
+		Update("expiry_reminded_at", nil).Error
+	if err != nil {
+		slog.Error("Failed to clear delivery expiry reminders", "error", err)
+	}
+
+	var expiring []database.Delivery
+	err = s.db.Preload("Product").
+		Where("expires_at > ? AND expires_at <= ? AND expiry_reminded_at IS NULL AND archived_at IS NULL", now, now.Add(reminder)).
+		Where("id IN (?)", pending).
+		Find(&expiring).Error
+	if err != nil {
+		slog.Error("Failed to check delivery expiry", "error", err)
+		return
+	}
+
+	for _, delivery := range expiring {
+		var remaining int64
+		s.db.Model(&database.File{}).
+			Where("delivery_id = ? AND skipped = ? AND expired = ? AND status <> ? AND archived_at IS NULL",
+				delivery.ID, false, false, database.FileStatusDownloaded).
+			Count(&remaining)
+		expireAt := delivery.ExpiresAt.UTC()
+		message := fmt.Sprintf("Delivery expires on %s before all its files are downloaded (%d remaining)", expireAt.Format(time.DateOnly), remaining)
+
+		slog.Warn("Delivery expiring", "delivery", delivery.ID, "expireAt", expireAt, "files", remaining)
+		s.hooks.Emit(context.Background(), hooks.NewEvent(hooks.EventDeliveryExpiring, delivery.Product.SourceID).
+			WithProduct(delivery.ProductID, delivery.Product.Name).
+			WithDelivery(delivery.ID, delivery.Name).
+			WithAlert("delivery_expiring", message, "warning"))
+
+		if err := s.db.Model(&delivery).Update("expiry_reminded_at", now).Error; err != nil {
+			slog.Error("Failed to record delivery expiry reminder", "delivery", delivery.ID, "error", err)
+		}
+	}
+}
+
+// expireDeliveries marks the files of expired deliveries that were never
+// downloaded as expired, so they no longer count as waiting for download
+func (s *Scheduler) expireDeliveries(now time.Time) {
+	s.mu.Lock()
+	archive := s.archiveExpired
+	s.mu.Unlock()
+
+	expired, err := s.db.ExpireDeliveries(now, archive)
+	if err != nil {
+		slog.Error("Failed to expire deliveries", "error", err)
+		return
+	}
+	if expired > 0 {
+		slog.Info("Marked files of expired deliveries", "files", expired, "archived", archive)
+	}
+}
@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+)
+
+const defaultSyncFailureLimit = 10
+
+// SetSyncFailureLimit sets after how many consecutive failed syncs a product's
+// scheduled syncs are suspended; 0 never suspends them. A sync that is retried
+// counts once, with the outcome of its last attempt.
+func (s *Scheduler) SetSyncFailureLimit(limit int) {
+	s.retryMu.Lock()
+	defer s.retryMu.Unlock()
+	s.failureLimit = limit
+}
+
+// recordSyncResult updates the product's count of consecutive failed syncs.
+// Reaching the failure limit suspends its schedule and emits sync.failed with
+// an error alert; a successful sync resumes a suspended schedule.
+func (s *Scheduler) recordSyncResult(productID string, syncErr error) {
+	var product database.Product
+	if err := s.db.First(&product, "id = ?", productID).Error; err != nil {
+		return
+	}
+
+	if syncErr == nil {
+		if product.SyncFailures == 0 && product.SyncDisabledAt == nil {
+			return
+		}
+		product.SyncFailures = 0
+		resumed := product.SyncDisabledAt != nil
+		product.SyncDisabledAt = nil
+		s.db.Model(&product).Select("sync_failures", "sync_disabled_at").Updates(&product)
+		if resumed && product.AutoDownload {
+			slog.Info("Sync succeeded, resuming schedule", "productID", productID)
+			if err := s.ScheduleProduct(&product); err != nil {
+				slog.Error("Failed to schedule product", "productID", productID, "error", err)
+			}
+		}
+		return
+	}
+
+	s.retryMu.Lock()
+	limit := s.failureLimit
+	s.retryMu.Unlock()
+
+	product.SyncFailures++
+	disable := limit > 0 && product.SyncFailures >= limit && product.SyncDisabledAt == nil
+	if disable {
+		now := time.Now()
+		product.SyncDisabledAt = &now
+	}
+	s.db.Model(&product).Select("sync_failures", "sync_disabled_at").Updates(&product)
+	if !disable {
+		return
+	}
+
+	s.UnscheduleProduct(productID)
+	message := fmt.Sprintf("Sync of %s failed %d times in a row, scheduled syncs suspended", product.Name, product.SyncFailures)
+	slog.Error("Sync failure limit reached, suspending schedule", "productID", productID, "failures", product.SyncFailures, "error", syncErr)
+	event := hooks.NewEvent(hooks.EventSyncFailed, product.SourceID).
+		WithProduct(product.ID, product.Name).
+		WithError("SYNC_SUSPENDED", syncErr.Error()).
+		WithAlert("sync_suspended", message, "error")
+	s.hooks.Emit(context.Background(), event)
+}
@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultDownloadRetention = 90 * 24 * time.Hour
+	downloadPruneSchedule    = "@hourly"
+)
+
+// SetDownloadRetention sets how many days finished download entries are kept
+// in the download history. 0 keeps them forever.
+func (s *Scheduler) SetDownloadRetention(days int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.downloadRetention = time.Duration(days) * 24 * time.Hour
+}
+
+// pruneDownloads deletes download entries older than the retention, keeping
+// the latest completed download of each file
+func (s *Scheduler) pruneDownloads(now time.Time) {
+	s.mu.Lock()
+	retention := s.downloadRetention
+	s.mu.Unlock()
+	if retention <= 0 {
+		return
+	}
+
+	deleted, err := s.db.PruneDownloadEntries(now.Add(-retention))
+	if err != nil {
+		slog.Error("Failed to prune download history", "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Info("Pruned download history", "deleted", deleted)
+	}
+}
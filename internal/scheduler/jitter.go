@@ -0,0 +1,46 @@
+package scheduler
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const defaultScheduleJitter = 5 * time.Minute
+
+// SetScheduleJitter sets the maximum delay added to each product's scheduled
+// syncs, so products sharing a schedule don't all hit a source API in the
+// same second. Existing schedules are reloaded if the jitter changed.
+func (s *Scheduler) SetScheduleJitter(jitter time.Duration) {
+	s.mu.Lock()
+	changed := s.jitter != jitter
+	s.jitter = jitter
+	s.mu.Unlock()
+
+	if changed {
+		s.Reload()
+	}
+}
+
+// jitterOffset returns the product's delay within the jitter. It is derived
+// from the product ID, so the next run stays the same across reloads and
+// restarts while products sharing a schedule are spread out.
+func jitterOffset(productID string, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(productID))
+	return time.Duration(h.Sum64()%uint64(jitter/time.Second)) * time.Second
+}
+
+// jitterSchedule runs a schedule a fixed offset later
+type jitterSchedule struct {
+	cron.Schedule
+	offset time.Duration
+}
+
+func (j jitterSchedule) Next(t time.Time) time.Time {
+	return j.Schedule.Next(t.Add(-j.offset)).Add(j.offset)
+}
@@ -0,0 +1,39 @@
+package scheduler
+
+import "log/slog"
+
+const defaultMaxConcurrentSyncs = 4
+
+// SetMaxConcurrentSyncs sets how many product syncs run at once, so enabling
+// a source with many products doesn't crawl its API in parallel. Running
+// syncs keep their slot; waiting ones take slots of the new size. n below 1
+// removes the limit.
+func (s *Scheduler) SetMaxConcurrentSyncs(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n < 1 {
+		s.syncSlots = nil
+	} else if s.syncSlots == nil || cap(s.syncSlots) != n {
+		s.syncSlots = make(chan struct{}, n)
+	}
+}
+
+// acquireSync waits for a sync slot and returns the function releasing it.
+// Without a limit set, syncs are not restricted.
+func (s *Scheduler) acquireSync(productID string) func() {
+	s.mu.Lock()
+	slots := s.syncSlots
+	s.mu.Unlock()
+
+	if slots == nil {
+		return func() {}
+	}
+	select {
+	case slots <- struct{}{}:
+	default:
+		slog.Info("Sync limit reached, waiting", "productID", productID, "limit", cap(slots))
+		slots <- struct{}{}
+	}
+	return func() { <-slots }
+}
@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"sort"
+	"time"
+)
+
+// SyncProgress is the progress of a running product sync
+type SyncProgress struct {
+	ProductID           string    `json:"productId"`
+	SourceID            string    `json:"sourceId"`
+	Trigger             string    `json:"trigger"`
+	DeliveriesTotal     int       `json:"deliveriesTotal"`
+	DeliveriesProcessed int       `json:"deliveriesProcessed"`
+	FilesDiscovered     int       `json:"filesDiscovered"`
+	StartedAt           time.Time `json:"startedAt"`
+}
+
+// ActiveSyncs returns the progress of all running product syncs, oldest first
+func (s *Scheduler) ActiveSyncs() []SyncProgress {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+
+	result := make([]SyncProgress, 0, len(s.progress))
+	for _, p := range s.progress {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].StartedAt.Equal(result[j].StartedAt) {
+			return result[i].StartedAt.Before(result[j].StartedAt)
+		}
+		return result[i].ProductID < result[j].ProductID
+	})
+	return result
+}
+
+func (s *Scheduler) startProgress(productID, sourceID, trigger string) {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+
+	if s.progress == nil {
+		s.progress = make(map[string]*SyncProgress)
+	}
+	s.progress[productID] = &SyncProgress{
+		ProductID: productID,
+		SourceID:  sourceID,
+		Trigger:   trigger,
+		StartedAt: time.Now(),
+	}
+}
+
+// updateProgress applies update to the progress of a running product sync
+func (s *Scheduler) updateProgress(productID string, update func(*SyncProgress)) {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+
+	if p, ok := s.progress[productID]; ok {
+		update(p)
+	}
+}
+
+func (s *Scheduler) finishProgress(productID string) {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	delete(s.progress, productID)
+}
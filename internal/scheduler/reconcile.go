@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+const reconcileSchedule = "@daily"
+
+// SetReconcileFix sets whether the daily reconciliation also fixes what it
+// finds; see database.Reconcile
+func (s *Scheduler) SetReconcileFix(fix bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reconcileFix = fix
+}
+
+// Reconcile compares the download history with the downloads directory and
+// keeps the report for LastReconcile
+func (s *Scheduler) Reconcile(fix bool) (*database.ReconcileReport, error) {
+	report, err := s.db.Reconcile(s.downloader.DownloadsPath(), fix, time.Now(), s.downloader.ActiveIDs())
+	if err != nil {
+		return nil, err
+	}
+	if n := len(report.Missing) + len(report.Modified) + len(report.Orphaned); n > 0 {
+		slog.Warn("Downloads directory differs from download history", "missing", len(report.Missing),
+			"modified", len(report.Modified), "orphaned", len(report.Orphaned), "fixed", fix)
+	}
+
+	s.mu.Lock()
+	s.lastReconcile = report
+	s.mu.Unlock()
+	return report, nil
+}
+
+// LastReconcile returns the report of the latest reconciliation, nil if none
+// ran since the start
+func (s *Scheduler) LastReconcile() *database.ReconcileReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastReconcile
+}
+
+func (s *Scheduler) reconcile() {
+	s.mu.Lock()
+	fix := s.reconcileFix
+	s.mu.Unlock()
+
+	if _, err := s.Reconcile(fix); err != nil {
+		slog.Error("Failed to reconcile downloads directory", "error", err)
+	}
+}
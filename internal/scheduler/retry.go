@@ -0,0 +1,130 @@
+package scheduler
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/downloader"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultRetryDelay = time.Minute
+	maxRetryDelay     = 30 * time.Minute
+)
+
+var (
+	errProductNotFound   = errors.New("product not found")
+	errIncompleteListing = errors.New("some deliveries could not be listed")
+)
+
+// SetRetryPolicy sets how often a failed scheduled sync is retried before
+// waiting for the next scheduled run. Retries start after baseDelay and the
+// delay doubles with every attempt, up to 30 minutes.
+func (s *Scheduler) SetRetryPolicy(maxRetries int, baseDelay time.Duration) {
+	s.retryMu.Lock()
+	defer s.retryMu.Unlock()
+	s.maxRetries = maxRetries
+	s.retryDelay = baseDelay
+}
+
+// retryable reports whether a sync error may go away by trying again
+func retryable(err error) bool {
+	return !errors.Is(err, errProductNotFound) && !errors.Is(err, downloader.ErrSourceNotFound)
+}
+
+// retryBackoff returns the delay before the given retry (1-based)
+func retryBackoff(base time.Duration, retry int) time.Duration {
+	delay := base
+	for i := 1; i < retry && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// scheduleRetry arranges another sync attempt after a failed one, unless the
+// retry budget is used up. It reports whether a retry was scheduled.
+func (s *Scheduler) scheduleRetry(productID string, attempt int) bool {
+	s.retryMu.Lock()
+	defer s.retryMu.Unlock()
+
+	// attempt counts the initial run, so attempt 1 failing means retry 1 is next
+	if attempt > s.maxRetries || s.retryDelay <= 0 {
+		slog.Warn("Sync retries exhausted, waiting for next scheduled run", "productID", productID, "attempts", attempt)
+		return false
+	}
+
+	delay := retryBackoff(s.retryDelay, attempt)
+	if s.retryTimers == nil {
+		s.retryTimers = make(map[string]*time.Timer)
+	}
+	if t, ok := s.retryTimers[productID]; ok {
+		t.Stop()
+	}
+	s.retryTimers[productID] = time.AfterFunc(delay, func() {
+		s.retryMu.Lock()
+		delete(s.retryTimers, productID)
+		s.retryMu.Unlock()
+		s.syncProduct(productID, database.SyncTriggerRetry, attempt+1)
+	})
+
+	nextRetry := time.Now().Add(delay)
+	var run database.SyncRun
+	if err := s.db.Where("product_id = ?", productID).Order("id DESC").First(&run).Error; err == nil {
+		s.db.Model(&run).Update("next_retry_at", nextRetry)
+	}
+	slog.Info("Scheduled sync retry", "productID", productID, "attempt", attempt+1, "delay", delay)
+	return true
+}
+
+func (s *Scheduler) cancelRetry(productID string) {
+	s.retryMu.Lock()
+	defer s.retryMu.Unlock()
+	if t, ok := s.retryTimers[productID]; ok {
+		t.Stop()
+		delete(s.retryTimers, productID)
+	}
+}
+
+func (s *Scheduler) cancelRetries() {
+	s.retryMu.Lock()
+	defer s.retryMu.Unlock()
+	for productID, t := range s.retryTimers {
+		t.Stop()
+		delete(s.retryTimers, productID)
+	}
+}
+
+func (s *Scheduler) startSyncRun(product *database.Product, trigger string, attempt int) *database.SyncRun {
+	run := &database.SyncRun{
+		ProductID: product.ID,
+		SourceID:  product.SourceID,
+		Trigger:   trigger,
+		Attempt:   attempt,
+		Status:    database.SyncStatusRunning,
+		StartedAt: time.Now(),
+	}
+	if err := s.db.Create(run).Error; err != nil {
+		slog.Error("Failed to record sync run", "productID", product.ID, "error", err)
+	}
+	return run
+}
+
+func (s *Scheduler) finishSyncRun(run *database.SyncRun, newFiles int, err error) {
+	now := time.Now()
+	run.CompletedAt = &now
+	run.NewFiles = newFiles
+	run.Status = database.SyncStatusCompleted
+	if err != nil {
+		run.Status = database.SyncStatusFailed
+		run.ErrorMessage = err.Error()
+	}
+	if run.ID == 0 {
+		return
+	}
+	if err := s.db.Save(run).Error; err != nil {
+		slog.Error("Failed to update sync run", "productID", run.ProductID, "error", err)
+	}
+}
@@ -2,12 +2,14 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
 
+	"github.com/patent-dev/bulk-file-loader/internal/blackout"
 	"github.com/patent-dev/bulk-file-loader/internal/database"
 	"github.com/patent-dev/bulk-file-loader/internal/downloader"
 	"github.com/patent-dev/bulk-file-loader/internal/hooks"
@@ -21,7 +23,28 @@ type Scheduler struct {
 	hooks      *hooks.Manager
 	cron       *cron.Cron
 	entryIDs   map[string]cron.EntryID
+	jitter     time.Duration
+	blackout   blackout.Schedule
+	syncSlots  chan struct{}
 	mu         sync.Mutex
+
+	retryMu     sync.Mutex
+	retryTimers map[string]*time.Timer
+	maxRetries  int
+	retryDelay  time.Duration
+	// failureLimit is guarded by retryMu
+	failureLimit int
+
+	progressMu sync.Mutex
+	progress   map[string]*SyncProgress
+
+	credentialReminder time.Duration
+	deliveryReminder   time.Duration
+	downloadRetention  time.Duration
+	archiveAge         time.Duration
+	archiveExpired     bool
+	reconcileFix       bool
+	lastReconcile      *database.ReconcileReport
 }
 
 func New(db *database.DB, registry *sources.Registry, dl *downloader.Downloader, hooks *hooks.Manager) *Scheduler {
@@ -32,14 +55,66 @@ func New(db *database.DB, registry *sources.Registry, dl *downloader.Downloader,
 		hooks:      hooks,
 		cron:       cron.New(),
 		entryIDs:   make(map[string]cron.EntryID),
+		jitter:     defaultScheduleJitter,
+		syncSlots:  make(chan struct{}, defaultMaxConcurrentSyncs),
+		maxRetries: defaultMaxRetries,
+		retryDelay: defaultRetryDelay,
+
+		failureLimit:       defaultSyncFailureLimit,
+		credentialReminder: defaultCredentialReminder,
+		deliveryReminder:   defaultDeliveryReminder,
+		downloadRetention:  defaultDownloadRetention,
 	}
 	s.loadSchedules()
+	s.cron.AddFunc(credentialCheckSchedule, func() { s.checkCredentials(time.Now()) })
+	s.cron.AddFunc(deliveryCheckSchedule, func() {
+		now := time.Now()
+		s.expireDeliveries(now)
+		s.checkDeliveries(now)
+	})
+	s.cron.AddFunc(downloadPruneSchedule, func() { s.pruneDownloads(time.Now()) })
+	s.cron.AddFunc(archiveSchedule, func() { s.archive(time.Now()) })
+	s.cron.AddFunc(reconcileSchedule, s.reconcile)
 	s.cron.Start()
 	return s
 }
 
 func (s *Scheduler) Stop() {
 	<-s.cron.Stop().Done()
+	s.cancelRetries()
+}
+
+// Start reloads product schedules and restarts the scheduler after Stop,
+// e.g. when a standby is promoted. It returns the number of scheduled products.
+func (s *Scheduler) Start() int {
+	scheduled := s.Reload()
+	s.cron.Start()
+	return scheduled
+}
+
+// ValidateSchedule checks a cron expression as used for check schedules
+func ValidateSchedule(spec string) error {
+	_, err := cron.ParseStandard(spec)
+	return err
+}
+
+// NextRuns returns the next n fire times of a cron expression after from, in
+// from's location
+func NextRuns(spec string, from time.Time, n int) ([]time.Time, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]time.Time, 0, n)
+	for t := from; len(runs) < n; {
+		t = schedule.Next(t)
+		if t.IsZero() {
+			// The expression never fires, e.g. on February 30th
+			break
+		}
+		runs = append(runs, t)
+	}
+	return runs, nil
 }
 
 func (s *Scheduler) ScheduleProduct(product *database.Product) error {
@@ -51,19 +126,24 @@ func (s *Scheduler) ScheduleProduct(product *database.Product) error {
 		delete(s.entryIDs, product.ID)
 	}
 
-	if product.CheckWindowStart == "" {
+	if _, err := parseWindow(product); err != nil {
+		return err
+	}
+	if product.CheckWindowStart == "" || product.SyncDisabledAt != nil {
 		return nil
 	}
 
-	entryID, err := s.cron.AddFunc(product.CheckWindowStart, func() {
-		s.syncProduct(product.ID)
-	})
+	schedule, err := cron.ParseStandard(product.CheckWindowStart)
 	if err != nil {
 		return err
 	}
+	offset := jitterOffset(product.ID, s.jitter)
+	entryID := s.cron.Schedule(jitterSchedule{Schedule: schedule, offset: offset}, cron.FuncJob(func() {
+		s.syncProduct(product.ID, database.SyncTriggerScheduled, 1)
+	}))
 
 	s.entryIDs[product.ID] = entryID
-	slog.Info("Scheduled product", "productID", product.ID, "schedule", product.CheckWindowStart)
+	slog.Info("Scheduled product", "productID", product.ID, "schedule", product.CheckWindowStart, "jitter", offset)
 	return nil
 }
 
@@ -77,59 +157,162 @@ func (s *Scheduler) UnscheduleProduct(productID string) {
 	}
 }
 
-func (s *Scheduler) loadSchedules() {
+// Reload replaces all cron entries with the schedules currently stored in
+// the database. Syncs that are already running are not affected.
+func (s *Scheduler) Reload() int {
+	s.mu.Lock()
+	for productID, entryID := range s.entryIDs {
+		s.cron.Remove(entryID)
+		delete(s.entryIDs, productID)
+	}
+	s.mu.Unlock()
+
+	return s.loadSchedules()
+}
+
+func (s *Scheduler) loadSchedules() int {
 	var products []database.Product
 	if err := s.db.Where("auto_download = ? AND check_window_start != ?", true, "").Find(&products).Error; err != nil {
 		slog.Error("Failed to load scheduled products", "error", err)
-		return
+		return 0
 	}
 
+	scheduled := 0
 	for i := range products {
 		if err := s.ScheduleProduct(&products[i]); err != nil {
 			slog.Error("Failed to schedule product", "productID", products[i].ID, "error", err)
+			continue
 		}
+		scheduled++
 	}
-	slog.Info("Loaded product schedules", "count", len(products))
+	slog.Info("Loaded product schedules", "count", scheduled)
+	return scheduled
 }
 
-func (s *Scheduler) syncProduct(productID string) {
-	ctx := context.Background()
-	slog.Info("Starting sync", "productID", productID)
+func (s *Scheduler) syncProduct(productID, trigger string, attempt int) {
+	if trigger != database.SyncTriggerRetry {
+		s.cancelRetry(productID)
+	}
+
+	// The window and blackout are checked once a slot is free, as waiting
+	// may take a while
+	release := s.acquireSync(productID)
+	defer release()
+
+	// Retries and catch-ups don't run outside the check window; the next
+	// scheduled sync takes over. Manual syncs always run.
+	win := s.productWindow(productID)
+	if (trigger == database.SyncTriggerRetry || trigger == database.SyncTriggerCatchUp) && !win.open(time.Now()) {
+		slog.Info("Check window closed, skipping sync", "productID", productID, "trigger", trigger, "attempt", attempt)
+		return
+	}
+	if trigger != database.SyncTriggerManual {
+		if end, ok := s.blackoutEnd(time.Now()); ok {
+			s.deferSync(productID, trigger, attempt, end)
+			return
+		}
+	}
+
+	fileIDs, err := s.sync(context.Background(), productID, trigger, attempt)
+	s.startDownloads(productID, win, fileIDs)
+
+	if err != nil && trigger != database.SyncTriggerManual && retryable(err) && s.scheduleRetry(productID, attempt) {
+		return
+	}
+	s.recordSyncResult(productID, err)
+}
+
+// sync fetches the product's deliveries and records new files. It returns the
+// IDs of new files that should be downloaded automatically, which may be
+// non-empty even on error if only some deliveries could be listed.
+func (s *Scheduler) sync(ctx context.Context, productID, trigger string, attempt int) (downloads []string, err error) {
+	slog.Info("Starting sync", "productID", productID, "trigger", trigger, "attempt", attempt)
 
 	var product database.Product
 	if err := s.db.First(&product, "id = ?", productID).Error; err != nil {
 		slog.Error("Product not found", "productID", productID)
-		return
+		return nil, errProductNotFound
 	}
 
+	run := s.startSyncRun(&product, trigger, attempt)
+	s.startProgress(productID, product.SourceID, trigger)
+	newFilesCount := 0
+	defer func() {
+		s.finishProgress(productID)
+		s.finishSyncRun(run, newFilesCount, err)
+	}()
+
 	adapter, ok := s.registry.Get(product.SourceID)
 	if !ok {
 		slog.Error("Source adapter not found", "sourceID", product.SourceID)
-		return
+		return nil, downloader.ErrSourceNotFound
 	}
 
-	deliveries, err := adapter.FetchDeliveries(ctx, product.ExternalID)
+	// Scheduled syncs only list deliveries published since the last complete
+	// sync; manual syncs and the first sync of a product list everything
+	incremental := trigger != database.SyncTriggerManual && product.SyncWatermark != nil
+	var deliveries []sources.DeliveryInfo
+	if incremental {
+		deliveries, err = sources.FetchDeliveriesSince(ctx, adapter, product.ExternalID, *product.SyncWatermark)
+	} else {
+		deliveries, err = adapter.FetchDeliveries(ctx, product.ExternalID)
+	}
 	if err != nil {
 		slog.Error("Failed to fetch deliveries", "productID", productID, "error", err)
 		s.emitSyncFailed(product.SourceID, productID, err)
-		return
+		return nil, err
 	}
+	s.updateProgress(productID, func(p *SyncProgress) { p.DeliveriesTotal = len(deliveries) })
 
-	newFilesCount := 0
+	// Sizes of the listed files, by file ID
+	catalog := make(map[string]int64)
+	catalogComplete := true
+	newDelivery := false
+	watermark := product.SyncWatermark
 	for _, delivery := range deliveries {
+		// Remote IDs and names end up in download and work paths
+		if err := sources.CheckName(delivery.ExternalID); err != nil {
+			slog.Warn("Skipping delivery", "productID", productID, "error", err)
+			s.updateProgress(productID, func(p *SyncProgress) { p.DeliveriesProcessed++ })
+			continue
+		}
 		files, err := adapter.FetchFiles(ctx, product.ExternalID, delivery.ExternalID)
+		s.updateProgress(productID, func(p *SyncProgress) {
+			p.DeliveriesProcessed++
+			p.FilesDiscovered += len(files)
+		})
 		if err != nil {
 			slog.Error("Failed to fetch files", "deliveryID", delivery.ExternalID, "error", err)
+			catalogComplete = false
 			continue
 		}
+		if watermark == nil || delivery.PublishedAt.After(*watermark) {
+			published := delivery.PublishedAt
+			watermark = &published
+		}
 
 		for _, fileInfo := range files {
+			if err := errors.Join(sources.CheckName(fileInfo.ExternalID), sources.CheckName(fileInfo.FileName)); err != nil {
+				slog.Warn("Skipping file", "deliveryID", delivery.ExternalID, "error", err)
+				continue
+			}
 			fileID := buildFileID(productID, delivery.ExternalID, fileInfo.ExternalID)
+			catalog[fileID] = fileInfo.FileSize
+
+			// Deleted files stay deleted
 			var count int64
-			s.db.Model(&database.File{}).Where("id = ?", fileID).Count(&count)
+			s.db.Unscoped().Model(&database.File{}).Where("id = ?", fileID).Count(&count)
 			if count > 0 {
 				continue
 			}
+			released := fileInfo.ReleasedAt
+			if released.IsZero() {
+				released = delivery.PublishedAt
+			}
+			filtered := !product.MatchesFilters(fileInfo.FileName) || !product.ReleasedInRange(released)
+			if filtered && !product.SkipFiltered {
+				continue
+			}
 
 			deliveryID := buildDeliveryID(productID, delivery.ExternalID)
 			file := &database.File{
@@ -145,8 +328,13 @@ func (s *Scheduler) syncProduct(productID string) {
 				DownloadURI:       fileInfo.DownloadURI,
 				ReleasedAt:        &fileInfo.ReleasedAt,
 			}
+			if filtered {
+				file.Skipped, file.Status = true, database.FileStatusSkipped
+			}
 
-			s.ensureDelivery(deliveryID, productID, &delivery)
+			if s.ensureDelivery(deliveryID, productID, &delivery) {
+				newDelivery = true
+			}
 
 			if err := s.db.Create(file).Error; err != nil {
 				slog.Error("Failed to create file", "fileID", fileID, "error", err)
@@ -162,28 +350,88 @@ func (s *Scheduler) syncProduct(productID string) {
 			s.hooks.Emit(ctx, event)
 
 			if product.AutoDownload && !file.Skipped {
-				go func(fID string) {
-					if err := s.downloader.Download(context.Background(), fID); err != nil {
-						slog.Error("Auto-download failed", "fileID", fID, "error", err)
-					}
-				}(fileID)
+				if product.AutoDownloads(file.FileSize) {
+					downloads = append(downloads, fileID)
+				} else {
+					slog.Info("File outside the auto-download size bounds, waiting for a manual download", "fileID", fileID, "size", file.FileSize)
+				}
 			}
 		}
 	}
 
 	now := time.Now()
 	product.LastCheckedAt = &now
-	s.db.Save(&product)
+	if catalogComplete {
+		product.LastSyncedAt = &now
+	}
+	// The watermark only advances when no delivery was missed
+	if catalogComplete && watermark != nil && !watermark.IsZero() {
+		product.SyncWatermark = watermark
+	}
+	// A new delivery supersedes the older ones of a product tracking only its
+	// latest delivery; their files are neither kept pending nor downloaded
+	if product.LatestOnly && newDelivery {
+		skipped, err := s.db.SkipOlderDeliveries(productID)
+		if err != nil {
+			slog.Error("Failed to skip older deliveries", "productID", productID, "error", err)
+		} else if skipped > 0 {
+			slog.Info("Skipped files of older deliveries", "productID", productID, "files", skipped)
+		}
+		if len(downloads) > 0 {
+			var latest []string
+			s.db.Model(&database.File{}).Where("id IN ? AND skipped = ?", downloads, false).Pluck("id", &latest)
+			downloads = latest
+		}
+	}
+
+	// Save would undelete a product deleted while it was syncing
+	s.db.Model(&product).Select("last_checked_at", "last_synced_at", "sync_watermark").Updates(&product)
+
+	// A partial listing would show files as removed from the catalog. An
+	// incremental one only lists new deliveries, so it adds to the last
+	// snapshot.
+	if catalogComplete {
+		var ids []string
+		var size int64
+		if incremental {
+			if previous, err := s.db.CatalogSnapshotAt(productID, now); err == nil && previous != nil {
+				ids, size = previous.Files(), previous.TotalSize
+			}
+		}
+		known := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			known[id] = true
+		}
+		for id, fileSize := range catalog {
+			if !known[id] {
+				ids = append(ids, id)
+				size += fileSize
+			}
+		}
+		if err := s.db.SaveCatalogSnapshot(productID, product.SourceID, ids, size, now); err != nil {
+			slog.Error("Failed to save catalog snapshot", "productID", productID, "error", err)
+		}
+	}
+
+	if !catalogComplete {
+		err := errIncompleteListing
+		s.emitSyncFailed(product.SourceID, productID, err)
+		slog.Warn("Sync incomplete", "productID", productID, "newFiles", newFilesCount)
+		return downloads, err
+	}
 
 	s.hooks.Emit(ctx, hooks.NewEvent(hooks.EventSyncCompleted, product.SourceID).WithProduct(productID, product.Name))
 	slog.Info("Sync completed", "productID", productID, "newFiles", newFilesCount)
+	return downloads, nil
 }
 
-func (s *Scheduler) ensureDelivery(deliveryID, productID string, info *sources.DeliveryInfo) {
+// ensureDelivery records the delivery unless it exists and reports whether it
+// was added
+func (s *Scheduler) ensureDelivery(deliveryID, productID string, info *sources.DeliveryInfo) bool {
 	var count int64
-	s.db.Model(&database.Delivery{}).Where("id = ?", deliveryID).Count(&count)
+	s.db.Unscoped().Model(&database.Delivery{}).Where("id = ?", deliveryID).Count(&count)
 	if count > 0 {
-		return
+		return false
 	}
 
 	delivery := &database.Delivery{
@@ -194,7 +442,7 @@ func (s *Scheduler) ensureDelivery(deliveryID, productID string, info *sources.D
 		PublishedAt: &info.PublishedAt,
 		ExpiresAt:   info.ExpiresAt,
 	}
-	s.db.Create(delivery)
+	return s.db.Create(delivery).Error == nil
 }
 
 func (s *Scheduler) emitSyncFailed(sourceID, productID string, err error) {
@@ -212,7 +460,7 @@ func buildFileID(productID, deliveryExternalID, fileExternalID string) string {
 }
 
 func (s *Scheduler) SyncNow(_ context.Context, productID string) error {
-	go s.syncProduct(productID)
+	go s.syncProduct(productID, database.SyncTriggerManual, 1)
 	return nil
 }
 
@@ -227,3 +475,95 @@ func (s *Scheduler) GetNextRun(productID string) *time.Time {
 	next := s.cron.Entry(entryID).Next
 	return &next
 }
+
+// RunResult summarizes a single RunOnce pass
+type RunResult struct {
+	Products        int
+	FailedSyncs     int
+	NewFiles        int
+	Downloaded      int
+	FailedDownloads int
+	// Deferred are downloads paused for a later run as they couldn't start
+	Deferred int
+	// Skipped are products not synced as their scheduled syncs are
+	// suspended, their check window is closed or a blackout is in progress
+	Skipped int
+}
+
+// OK reports whether every sync and download succeeded
+func (r *RunResult) OK() bool {
+	return r.FailedSyncs == 0 && r.FailedDownloads == 0
+}
+
+// RunOnce syncs every auto-download product of an enabled source, downloads
+// the new files and returns once all downloads have finished
+func (s *Scheduler) RunOnce(ctx context.Context) (*RunResult, error) {
+	var products []database.Product
+	enabledSources := s.db.Model(&database.Source{}).Select("id").Where("enabled = ?", true)
+	if err := s.db.Where("auto_download = ? AND source_id IN (?)", true, enabledSources).Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	result := &RunResult{Products: len(products)}
+	var fileIDs []string
+	for _, product := range products {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		// Runs count towards the failure limit like scheduled syncs, and
+		// products whose syncs are suspended are left alone
+		if product.SyncDisabledAt != nil {
+			slog.Info("Scheduled syncs suspended, skipping product", "productID", product.ID)
+			result.Skipped++
+			continue
+		}
+		// Blackouts and closed check windows skip the sync instead of waiting;
+		// the next run catches up
+		now := time.Now()
+		if _, ok := s.blackoutEnd(now); ok {
+			slog.Info("Blackout period, skipping sync", "productID", product.ID)
+			result.Skipped++
+			continue
+		}
+		if !s.productWindow(product.ID).open(now) {
+			slog.Info("Check window closed, skipping sync", "productID", product.ID)
+			result.Skipped++
+			continue
+		}
+		ids, err := s.sync(ctx, product.ID, database.SyncTriggerOnce, 1)
+		fileIDs = append(fileIDs, ids...)
+		if err != nil {
+			result.FailedSyncs++
+		}
+		s.recordSyncResult(product.ID, err)
+	}
+	result.NewFiles = len(fileIDs)
+	// Downloads deferred by an earlier run
+	for _, product := range products {
+		fileIDs = append(fileIDs, s.downloader.ResumePaused(product.ID)...)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, fileID := range fileIDs {
+		wg.Add(1)
+		go func(fID string) {
+			defer wg.Done()
+			err := s.downloader.Download(ctx, fID)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, downloader.ErrDownloadDeferred):
+				result.Deferred++
+			case err != nil:
+				slog.Error("Download failed", "fileID", fID, "error", err)
+				result.FailedDownloads++
+			default:
+				result.Downloaded++
+			}
+		}(fileID)
+	}
+	wg.Wait()
+
+	return result, ctx.Err()
+}
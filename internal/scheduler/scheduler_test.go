@@ -1,18 +1,61 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/robfig/cron/v3"
 
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/blackout"
 	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/downloader"
 	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+type mockAdapter struct {
+	files         []sources.FileInfo
+	deliveriesErr error
+	downloadErr   map[string]error
+}
+
+func (m *mockAdapter) ID() string                                  { return "mock" }
+func (m *mockAdapter) Name() string                                { return "Mock Source" }
+func (m *mockAdapter) CredentialFields() []sources.CredentialField { return nil }
+func (m *mockAdapter) SetCredentials(creds map[string]string)      {}
+func (m *mockAdapter) ValidateCredentials(context.Context) error   { return nil }
+func (m *mockAdapter) FetchProducts(context.Context) ([]sources.ProductInfo, error) {
+	return nil, nil
+}
+func (m *mockAdapter) FetchDeliveries(context.Context, string) ([]sources.DeliveryInfo, error) {
+	if m.deliveriesErr != nil {
+		return nil, m.deliveriesErr
+	}
+	return []sources.DeliveryInfo{{ExternalID: "d1", Name: "Delivery 1", PublishedAt: time.Now()}}, nil
+}
+func (m *mockAdapter) FetchFiles(context.Context, string, string) ([]sources.FileInfo, error) {
+	return m.files, nil
+}
+func (m *mockAdapter) DownloadFile(ctx context.Context, file sources.FileInfo, w io.Writer, progress sources.ProgressFunc) error {
+	if err := m.downloadErr[file.ExternalID]; err != nil {
+		return err
+	}
+	w.Write([]byte("test content"))
+	progress(12, 12)
+	return nil
+}
+
 func setupTestDB(t *testing.T) *database.DB {
 	t.Helper()
 	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
@@ -28,6 +71,8 @@ func setupTestDB(t *testing.T) *database.DB {
 		&database.File{},
 		&database.DownloadEntry{},
 		&database.Webhook{},
+		&database.CatalogSnapshot{},
+		&database.SyncRun{},
 	)
 	return &database.DB{DB: gormDB}
 }
@@ -240,3 +285,1070 @@ func TestBuildFileID(t *testing.T) {
 		t.Errorf("buildFileID() = %q, want %q", id, expected)
 	}
 }
+
+func TestRunOnce(t *testing.T) {
+	db := setupTestDB(t)
+	// Downloads run concurrently; keep them on the single in-memory database
+	sqlDB, _ := db.DB.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	cfg := &config.Config{DataDir: t.TempDir(), MaxConcurrent: 2, DownloadTimeout: 60}
+	registry := sources.NewRegistry(db, cfg)
+	registry.Register(&mockAdapter{
+		files: []sources.FileInfo{
+			{ExternalID: "f1", FileName: "a.zip"},
+			{ExternalID: "f2", FileName: "b.zip"},
+		},
+		downloadErr: map[string]error{"f2": errors.New("connection reset")},
+	})
+	hooksManager := hooks.New(db)
+	scheduler := &Scheduler{
+		db:         db,
+		registry:   registry,
+		downloader: downloader.New(db, registry, hooksManager, cfg),
+		hooks:      hooksManager,
+	}
+
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Source{ID: "disabled", Name: "Disabled"})
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1", AutoDownload: true})
+	db.Create(&database.Product{ID: "p2", SourceID: "mock", ExternalID: "p2"})
+	db.Create(&database.Product{ID: "p3", SourceID: "disabled", ExternalID: "p3", AutoDownload: true})
+
+	result, err := scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := RunResult{Products: 1, NewFiles: 2, Downloaded: 1, FailedDownloads: 1}
+	if *result != want {
+		t.Errorf("RunOnce() = %+v, want %+v", *result, want)
+	}
+	if result.OK() {
+		t.Error("OK() should be false when a download failed")
+	}
+
+	snapshot, err := db.CatalogSnapshotAt("p1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot == nil || snapshot.FileCount != 2 {
+		t.Errorf("Catalog snapshot = %+v, want 2 files", snapshot)
+	}
+
+	// A second run finds no new files
+	result, err = scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.NewFiles != 0 || !result.OK() {
+		t.Errorf("Second RunOnce() = %+v, want no new files", *result)
+	}
+}
+
+func TestRunOnceSyncFailureLimit(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{DataDir: t.TempDir(), MaxConcurrent: 2, DownloadTimeout: 60}
+	registry := sources.NewRegistry(db, cfg)
+	adapter := &mockAdapter{deliveriesErr: errors.New("product retired")}
+	registry.Register(adapter)
+	hooksManager := hooks.New(db)
+	scheduler := &Scheduler{db: db, registry: registry, downloader: downloader.New(db, registry, hooksManager, cfg), hooks: hooksManager}
+	scheduler.SetSyncFailureLimit(2)
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1", AutoDownload: true})
+
+	for range 2 {
+		if result, err := scheduler.RunOnce(context.Background()); err != nil || result.FailedSyncs != 1 {
+			t.Fatalf("RunOnce() = %+v, %v; want a failed sync", result, err)
+		}
+	}
+	var product database.Product
+	db.First(&product, "id = ?", "p1")
+	if product.SyncFailures != 2 || product.SyncDisabledAt == nil {
+		t.Fatalf("product after 2 failed runs = %d failures, disabled at %v; want suspended", product.SyncFailures, product.SyncDisabledAt)
+	}
+
+	// Suspended products aren't synced by later runs
+	adapter.deliveriesErr = nil
+	result, err := scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (RunResult{Products: 1, Skipped: 1}); *result != want {
+		t.Errorf("RunOnce() of a suspended product = %+v, want %+v", *result, want)
+	}
+	var runs int64
+	db.Model(&database.SyncRun{}).Count(&runs)
+	if runs != 2 {
+		t.Errorf("%d sync runs, want the suspended product skipped", runs)
+	}
+}
+
+func TestRunOnceSkipsBlackoutAndClosedWindow(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{DataDir: t.TempDir(), MaxConcurrent: 2, DownloadTimeout: 60}
+	registry := sources.NewRegistry(db, cfg)
+	registry.Register(&mockAdapter{files: []sources.FileInfo{{ExternalID: "f1", FileName: "a.zip"}}})
+	hooksManager := hooks.New(db)
+	scheduler := &Scheduler{db: db, registry: registry, downloader: downloader.New(db, registry, hooksManager, cfg), hooks: hooksManager}
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1", AutoDownload: true})
+	// A window closing within a minute is open, one opening within a
+	// minute is closed
+	db.Create(&database.Product{ID: "p2", SourceID: "mock", ExternalID: "p2", AutoDownload: true,
+		CheckWindowStart: "0 0 1 1 *", CheckWindowEnd: "* * * * *"})
+	db.Create(&database.Product{ID: "p3", SourceID: "mock", ExternalID: "p3", AutoDownload: true,
+		CheckWindowStart: "* * * * *", CheckWindowEnd: "0 0 1 1 *"})
+
+	allDay, _ := blackout.Parse("00:00-24:00")
+	scheduler.SetBlackout(allDay)
+	done := make(chan *RunResult, 1)
+	go func() {
+		result, _ := scheduler.RunOnce(context.Background())
+		done <- result
+	}()
+	select {
+	case result := <-done:
+		if want := (RunResult{Products: 3, Skipped: 3}); *result != want {
+			t.Errorf("RunOnce() in a blackout = %+v, want %+v", *result, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunOnce() waited for the blackout to end")
+	}
+
+	scheduler.SetBlackout(nil)
+	result, err := scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skipped != 1 || result.NewFiles != 2 {
+		t.Errorf("RunOnce() after the blackout = %+v, want p3 skipped and the others synced", *result)
+	}
+	var synced int64
+	db.Model(&database.SyncRun{}).Where("product_id = ?", "p3").Count(&synced)
+	if synced != 0 {
+		t.Error("product with a closed check window was synced")
+	}
+}
+
+func TestRunOnceDefersClosedDownloads(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, _ := db.DB.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	cfg := &config.Config{DataDir: t.TempDir(), MaxConcurrent: 2, DownloadTimeout: 60}
+	registry := sources.NewRegistry(db, cfg)
+	registry.Register(&mockAdapter{files: []sources.FileInfo{{ExternalID: "f1", FileName: "a.zip"}}})
+	hooksManager := hooks.New(db)
+	dl := downloader.New(db, registry, hooksManager, cfg)
+	scheduler := &Scheduler{db: db, registry: registry, downloader: dl, hooks: hooksManager}
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1", AutoDownload: true})
+
+	allDay, _ := blackout.Parse("00:00-24:00")
+	dl.SetBlackout(allDay)
+	dl.SetDeferClosed(true)
+	done := make(chan *RunResult, 1)
+	go func() {
+		result, _ := scheduler.RunOnce(context.Background())
+		done <- result
+	}()
+	select {
+	case result := <-done:
+		if want := (RunResult{Products: 1, NewFiles: 1, Deferred: 1}); *result != want || !result.OK() {
+			t.Errorf("RunOnce() in a blackout = %+v, want %+v", *result, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunOnce() waited for the blackout to end")
+	}
+
+	// The next run downloads the deferred file
+	dl.SetBlackout(nil)
+	result, err := scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.NewFiles != 0 || result.Downloaded != 1 || result.Deferred != 0 {
+		t.Errorf("RunOnce() after the blackout = %+v, want the deferred file downloaded", *result)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{6, 30 * time.Minute},
+		{50, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := retryBackoff(time.Minute, tt.retry); got != tt.want {
+			t.Errorf("retryBackoff(1m, %d) = %v, want %v", tt.retry, got, tt.want)
+		}
+	}
+}
+
+func TestSyncRetry(t *testing.T) {
+	db := setupTestDB(t)
+	// Retries run on timer goroutines; keep them on the single in-memory database
+	sqlDB, _ := db.DB.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	cfg := &config.Config{DataDir: t.TempDir(), MaxConcurrent: 1, DownloadTimeout: 60}
+	registry := sources.NewRegistry(db, cfg)
+	registry.Register(&mockAdapter{deliveriesErr: errors.New("service unavailable")})
+	hooksManager := hooks.New(db)
+	scheduler := &Scheduler{
+		db:         db,
+		registry:   registry,
+		downloader: downloader.New(db, registry, hooksManager, cfg),
+		hooks:      hooksManager,
+	}
+	scheduler.SetRetryPolicy(2, 10*time.Millisecond)
+	defer scheduler.cancelRetries()
+
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1"})
+
+	scheduler.syncProduct("p1", database.SyncTriggerScheduled, 1)
+
+	// The initial run plus two retries
+	var runs []database.SyncRun
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		db.Where("status = ?", database.SyncStatusFailed).Order("id").Find(&runs)
+		if len(runs) >= 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give a further retry the chance to show up if the cap were ignored
+	time.Sleep(100 * time.Millisecond)
+	db.Order("id").Find(&runs)
+
+	if len(runs) != 3 {
+		t.Fatalf("Got %d sync runs, want 3", len(runs))
+	}
+	for i, run := range runs {
+		wantTrigger := database.SyncTriggerRetry
+		if i == 0 {
+			wantTrigger = database.SyncTriggerScheduled
+		}
+		if run.Attempt != i+1 || run.Trigger != wantTrigger || run.Status != database.SyncStatusFailed {
+			t.Errorf("Run %d = attempt %d, trigger %q, status %q", i, run.Attempt, run.Trigger, run.Status)
+		}
+		if run.ErrorMessage != "service unavailable" {
+			t.Errorf("Run %d error = %q", i, run.ErrorMessage)
+		}
+	}
+	if runs[0].NextRetryAt == nil || runs[2].NextRetryAt != nil {
+		t.Error("NextRetryAt should be set on retried runs only")
+	}
+}
+
+func TestSyncManualNotRetried(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{DataDir: t.TempDir(), MaxConcurrent: 1, DownloadTimeout: 60}
+	registry := sources.NewRegistry(db, cfg)
+	registry.Register(&mockAdapter{deliveriesErr: errors.New("service unavailable")})
+	hooksManager := hooks.New(db)
+	scheduler := &Scheduler{
+		db:         db,
+		registry:   registry,
+		downloader: downloader.New(db, registry, hooksManager, cfg),
+		hooks:      hooksManager,
+	}
+	scheduler.SetRetryPolicy(2, time.Hour)
+	defer scheduler.cancelRetries()
+
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1"})
+
+	scheduler.syncProduct("p1", database.SyncTriggerManual, 1)
+	if len(scheduler.retryTimers) != 0 {
+		t.Error("Manual sync failure should not schedule a retry")
+	}
+
+	scheduler.syncProduct("p1", database.SyncTriggerScheduled, 1)
+	if len(scheduler.retryTimers) != 1 {
+		t.Error("Scheduled sync failure should schedule a retry")
+	}
+}
+
+// historyAdapter returns fixed deliveries and records which were listed
+type historyAdapter struct {
+	mockAdapter
+	deliveries []sources.DeliveryInfo
+	listed     []string
+}
+
+func (h *historyAdapter) FetchDeliveries(context.Context, string) ([]sources.DeliveryInfo, error) {
+	return h.deliveries, nil
+}
+
+func (h *historyAdapter) FetchFiles(_ context.Context, _, deliveryID string) ([]sources.FileInfo, error) {
+	h.listed = append(h.listed, deliveryID)
+	return []sources.FileInfo{{ExternalID: "f-" + deliveryID, FileName: deliveryID + ".zip"}}, nil
+}
+
+func TestSyncIncremental(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{DataDir: t.TempDir()}
+	march := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	adapter := &historyAdapter{deliveries: []sources.DeliveryInfo{
+		{ExternalID: "2025-02", PublishedAt: march.AddDate(0, -1, 0)},
+		{ExternalID: "2025-03", PublishedAt: march},
+	}}
+	registry := sources.NewRegistry(db, cfg)
+	registry.Register(adapter)
+	hooksManager := hooks.New(db)
+	scheduler := &Scheduler{db: db, registry: registry, hooks: hooksManager}
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1"})
+	ctx := context.Background()
+
+	// The first sync lists everything and sets the watermark
+	if _, err := scheduler.sync(ctx, "p1", database.SyncTriggerScheduled, 1); err != nil {
+		t.Fatal(err)
+	}
+	var product database.Product
+	db.First(&product, "id = ?", "p1")
+	if product.SyncWatermark == nil || !product.SyncWatermark.Equal(march) {
+		t.Fatalf("SyncWatermark = %v, want %v", product.SyncWatermark, march)
+	}
+
+	// A scheduled sync skips deliveries older than the watermark
+	adapter.listed = nil
+	adapter.deliveries = append(adapter.deliveries, sources.DeliveryInfo{ExternalID: "2025-04", PublishedAt: march.AddDate(0, 1, 0)})
+	if _, err := scheduler.sync(ctx, "p1", database.SyncTriggerScheduled, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(adapter.listed) != 2 || adapter.listed[0] != "2025-03" || adapter.listed[1] != "2025-04" {
+		t.Errorf("scheduled sync listed %v, want 2025-03 and 2025-04", adapter.listed)
+	}
+	// and still records the whole catalog
+	snapshot, err := db.CatalogSnapshotAt("p1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot == nil || snapshot.FileCount != 3 {
+		t.Errorf("catalog snapshot after a scheduled sync = %+v, want all 3 files", snapshot)
+	}
+
+	// A manual sync lists everything again
+	adapter.listed = nil
+	if _, err := scheduler.sync(ctx, "p1", database.SyncTriggerManual, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(adapter.listed) != 3 {
+		t.Errorf("manual sync listed %v, want all deliveries", adapter.listed)
+	}
+	var files int64
+	db.Model(&database.File{}).Where("product_id = ?", "p1").Count(&files)
+	if files != 3 {
+		t.Errorf("recorded %d files, want 3", files)
+	}
+
+	// Syncs don't bring back deleted files
+	var deleted database.File
+	db.First(&deleted, "product_id = ?", "p1")
+	if err := db.DeleteFile(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scheduler.sync(ctx, "p1", database.SyncTriggerManual, 1); err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&database.File{}).Where("product_id = ?", "p1").Count(&files)
+	if files != 2 || !db.IsDeleted(&database.File{}, deleted.ID) {
+		t.Errorf("after syncing again: %d files, want the deleted one to stay deleted", files)
+	}
+}
+
+func TestSyncUnsafeNames(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{DataDir: t.TempDir()}
+	registry := sources.NewRegistry(db, cfg)
+	registry.Register(&mockAdapter{files: []sources.FileInfo{
+		{ExternalID: "f1", FileName: "a/../../../evil.zip"},
+		{ExternalID: "../f2", FileName: "f2.zip"},
+		{ExternalID: "f3", FileName: ".."},
+		{ExternalID: "f4", FileName: "grants.zip"},
+	}})
+	scheduler := &Scheduler{db: db, registry: registry, hooks: hooks.New(db)}
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1"})
+
+	if _, err := scheduler.sync(context.Background(), "p1", database.SyncTriggerManual, 1); err != nil {
+		t.Fatal(err)
+	}
+	var files []database.File
+	db.Find(&files)
+	if len(files) != 1 || files[0].FileName != "grants.zip" {
+		t.Errorf("recorded %+v, want only grants.zip", files)
+	}
+
+	// Deliveries with unsafe IDs aren't listed
+	adapter := &historyAdapter{deliveries: []sources.DeliveryInfo{{ExternalID: "../../evil"}, {ExternalID: "2025-03"}}}
+	registry = sources.NewRegistry(db, cfg)
+	registry.Register(adapter)
+	scheduler.registry = registry
+	if _, err := scheduler.sync(context.Background(), "p1", database.SyncTriggerManual, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(adapter.listed, []string{"2025-03"}) {
+		t.Errorf("listed deliveries %v, want only 2025-03", adapter.listed)
+	}
+	var deliveries int64
+	db.Model(&database.Delivery{}).Where("external_id = ?", "../../evil").Count(&deliveries)
+	if deliveries != 0 {
+		t.Error("delivery with an unsafe ID was recorded")
+	}
+}
+
+func TestSyncFilters(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{DataDir: t.TempDir()}
+	registry := sources.NewRegistry(db, cfg)
+	registry.Register(&mockAdapter{files: []sources.FileInfo{
+		{ExternalID: "f1", FileName: "grants.ZIP"},
+		{ExternalID: "f2", FileName: "grants-images.zip"},
+		{ExternalID: "f3", FileName: "readme.txt"},
+	}})
+	scheduler := &Scheduler{db: db, registry: registry, hooks: hooks.New(db)}
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	filters := database.Product{SourceID: "mock", AutoDownload: true,
+		IncludePatterns: `["*.zip"]`, ExcludePatterns: `["*-images.*"]`}
+	ignoring, skipping := filters, filters
+	ignoring.ID, ignoring.ExternalID = "p1", "p1"
+	skipping.ID, skipping.ExternalID, skipping.SkipFiltered = "p2", "p2", true
+	db.Create(&ignoring)
+	db.Create(&skipping)
+	ctx := context.Background()
+
+	// Filtered files are left out of the catalog
+	downloads, err := scheduler.sync(ctx, "p1", database.SyncTriggerManual, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []database.File
+	db.Where("product_id = ?", "p1").Find(&files)
+	if len(files) != 1 || files[0].FileName != "grants.ZIP" || len(downloads) != 1 {
+		t.Errorf("recorded %+v, downloading %v, want only grants.ZIP", files, downloads)
+	}
+
+	// or recorded as skipped, without downloading them
+	downloads, err = scheduler.sync(ctx, "p2", database.SyncTriggerManual, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skipped int64
+	db.Model(&database.File{}).Where("product_id = ? AND skipped = ? AND status = ?", "p2", true, database.FileStatusSkipped).Count(&skipped)
+	if skipped != 2 || len(downloads) != 1 || downloads[0] != buildFileID("p2", "d1", "f1") {
+		t.Errorf("%d files skipped, downloading %v, want 2 skipped and grants.ZIP downloaded", skipped, downloads)
+	}
+}
+
+func TestSyncReleasedAfter(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{DataDir: t.TempDir()}
+	registry := sources.NewRegistry(db, cfg)
+	registry.Register(&mockAdapter{files: []sources.FileInfo{
+		{ExternalID: "old", FileName: "1998.zip", ReleasedAt: time.Date(1998, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{ExternalID: "new", FileName: "2024.zip", ReleasedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		// Without a release date the delivery's is used, which is now
+		{ExternalID: "undated", FileName: "undated.zip"},
+	}})
+	scheduler := &Scheduler{db: db, registry: registry, hooks: hooks.New(db)}
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1", AutoDownload: true, ReleasedAfter: &cutoff})
+
+	downloads, err := scheduler.sync(context.Background(), "p1", database.SyncTriggerManual, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []database.File
+	db.Where("product_id = ?", "p1").Order("file_name").Find(&files)
+	if len(files) != 2 || files[0].FileName != "2024.zip" || files[1].FileName != "undated.zip" || len(downloads) != 2 {
+		t.Errorf("recorded %+v, downloading %v, want the files released after the cutoff", files, downloads)
+	}
+}
+
+func TestSyncAutoDownloadSizes(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{DataDir: t.TempDir()}
+	registry := sources.NewRegistry(db, cfg)
+	registry.Register(&mockAdapter{files: []sources.FileInfo{
+		{ExternalID: "small", FileName: "a.zip", FileSize: 1 << 20},
+		{ExternalID: "large", FileName: "b.zip", FileSize: 8 << 30},
+		{ExternalID: "unknown", FileName: "c.zip"},
+	}})
+	scheduler := &Scheduler{db: db, registry: registry, hooks: hooks.New(db)}
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1", AutoDownload: true, MaxAutoDownloadSize: 5 << 30})
+
+	downloads, err := scheduler.sync(context.Background(), "p1", database.SyncTriggerManual, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(downloads) != 1 || downloads[0] != buildFileID("p1", "d1", "small") {
+		t.Errorf("downloading %v, want only the file under 5 GB", downloads)
+	}
+	var files int64
+	db.Model(&database.File{}).Where("product_id = ? AND skipped = ?", "p1", false).Count(&files)
+	if files != 3 {
+		t.Errorf("recorded %d files, want all 3 available for a manual download", files)
+	}
+}
+
+func TestSyncLatestOnly(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{DataDir: t.TempDir()}
+	march := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	adapter := &historyAdapter{deliveries: []sources.DeliveryInfo{
+		{ExternalID: "2025-02", PublishedAt: march.AddDate(0, -1, 0)},
+		{ExternalID: "2025-03", PublishedAt: march},
+	}}
+	registry := sources.NewRegistry(db, cfg)
+	registry.Register(adapter)
+	scheduler := &Scheduler{db: db, registry: registry, hooks: hooks.New(db)}
+	db.Create(&database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1", AutoDownload: true, LatestOnly: true})
+	ctx := context.Background()
+	skipped := func() []string {
+		var ids []string
+		db.Model(&database.File{}).Where("product_id = ? AND skipped = ?", "p1", true).Order("id").Pluck("id", &ids)
+		return ids
+	}
+
+	downloads, err := scheduler.sync(ctx, "p1", database.SyncTriggerScheduled, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	march03 := buildFileID("p1", "2025-03", "f-2025-03")
+	if len(downloads) != 1 || downloads[0] != march03 {
+		t.Errorf("downloading %v, want only the latest delivery", downloads)
+	}
+	if got := skipped(); len(got) != 1 || got[0] != buildFileID("p1", "2025-02", "f-2025-02") {
+		t.Errorf("skipped %v, want the February file", got)
+	}
+
+	// A downloaded file stays, a pending one is skipped once a newer
+	// delivery appears
+	db.Model(&database.File{}).Where("id = ?", march03).Update("status", database.FileStatusDownloaded)
+	adapter.deliveries = append(adapter.deliveries, sources.DeliveryInfo{ExternalID: "2025-04", PublishedAt: march.AddDate(0, 1, 0)})
+	if _, err := scheduler.sync(ctx, "p1", database.SyncTriggerScheduled, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := skipped(); len(got) != 1 {
+		t.Errorf("skipped %v, want the downloaded March file kept", got)
+	}
+}
+
+func TestCheckCredentials(t *testing.T) {
+	db := setupTestDB(t)
+	hooksManager := hooks.New(db)
+	events, unsubscribe := hooksManager.Subscribe(10)
+	defer unsubscribe()
+	scheduler := &Scheduler{db: db, hooks: hooksManager, credentialReminder: 14 * 24 * time.Hour}
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	soon := now.AddDate(0, 0, 10)
+	later := now.AddDate(0, 0, 60)
+	db.Create(&database.Source{ID: "soon", CredentialsExpireAt: &soon})
+	db.Create(&database.Source{ID: "later", CredentialsExpireAt: &later})
+	db.Create(&database.Source{ID: "never"})
+
+	scheduler.checkCredentials(now)
+	select {
+	case event := <-events:
+		if event.Type != hooks.EventCredentialsExpiring || event.Source != "soon" || len(event.Alerts) != 1 || event.Alerts[0].Severity != "warning" {
+			t.Errorf("event = %+v, want credentials.expiring for soon", event)
+		}
+	default:
+		t.Fatal("no event emitted")
+	}
+
+	// The reminder is sent once per expiry date
+	scheduler.checkCredentials(now.Add(time.Hour))
+	select {
+	case event := <-events:
+		t.Errorf("unexpected second event %+v", event)
+	default:
+	}
+}
+
+func TestCheckDeliveries(t *testing.T) {
+	db := setupTestDB(t)
+	hooksManager := hooks.New(db)
+	events, unsubscribe := hooksManager.Subscribe(10)
+	defer unsubscribe()
+	scheduler := &Scheduler{db: db, hooks: hooksManager, deliveryReminder: 7 * 24 * time.Hour}
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	soon := now.AddDate(0, 0, 3)
+	later := now.AddDate(0, 0, 30)
+	db.Create(&database.Product{ID: "p1", SourceID: "epo", Name: "Product 1"})
+	db.Create(&database.Delivery{ID: "soon", ProductID: "p1", Name: "Soon", ExpiresAt: &soon})
+	db.Create(&database.Delivery{ID: "done", ProductID: "p1", ExpiresAt: &soon})
+	db.Create(&database.Delivery{ID: "later", ProductID: "p1", ExpiresAt: &later})
+	db.Create(&database.File{ID: "f1", DeliveryID: "soon", ProductID: "p1"})
+	db.Create(&database.File{ID: "f2", DeliveryID: "soon", ProductID: "p1", Skipped: true, Status: database.FileStatusSkipped})
+	db.Create(&database.File{ID: "f3", DeliveryID: "done", ProductID: "p1", Status: database.FileStatusDownloaded})
+	db.Create(&database.File{ID: "f4", DeliveryID: "later", ProductID: "p1"})
+
+	scheduler.checkDeliveries(now)
+	select {
+	case event := <-events:
+		if event.Type != hooks.EventDeliveryExpiring || event.Source != "epo" || event.Delivery == nil || event.Delivery.ID != "soon" ||
+			len(event.Alerts) != 1 || !strings.Contains(event.Alerts[0].Message, "(1 remaining)") {
+			t.Errorf("event = %+v, want delivery.expiring for soon", event)
+		}
+	default:
+		t.Fatal("no event emitted")
+	}
+
+	// The reminder is sent once
+	scheduler.checkDeliveries(now.Add(time.Hour))
+	select {
+	case event := <-events:
+		t.Errorf("unexpected second event %+v", event)
+	default:
+	}
+
+	// Downloading the delivery clears the mark
+	db.Model(&database.File{}).Where("id = ?", "f1").Update("status", database.FileStatusDownloaded)
+	scheduler.checkDeliveries(now.Add(2 * time.Hour))
+	var delivery database.Delivery
+	db.First(&delivery, "id = ?", "soon")
+	if delivery.ExpiryRemindedAt != nil {
+		t.Errorf("ExpiryRemindedAt = %v after download, want nil", delivery.ExpiryRemindedAt)
+	}
+}
+
+func TestPruneDownloads(t *testing.T) {
+	db := setupTestDB(t)
+	scheduler := &Scheduler{db: db, downloadRetention: 30 * 24 * time.Hour}
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -60)
+	for _, entry := range []database.DownloadEntry{
+		{FileID: "f1", Status: database.DownloadStatusCompleted, CreatedAt: old.Add(-time.Hour)},
+		{FileID: "f1", Status: database.DownloadStatusCompleted, CreatedAt: old},
+		{FileID: "f1", Status: database.DownloadStatusFailed, CreatedAt: old},
+		{FileID: "f2", Status: database.DownloadStatusCancelled, CreatedAt: old},
+		{FileID: "f2", Status: database.DownloadStatusFailed, CreatedAt: now},
+		{FileID: "f3", Status: database.DownloadStatusInterrupted, CreatedAt: old},
+	} {
+		db.Create(&entry)
+	}
+
+	scheduler.pruneDownloads(now)
+	var kept []database.DownloadEntry
+	db.Order("id").Find(&kept)
+	var got []string
+	for _, e := range kept {
+		got = append(got, e.FileID+":"+e.Status)
+	}
+	want := []string{"f1:completed", "f2:failed", "f3:interrupted"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+	if kept[0].ID != 2 {
+		t.Errorf("kept completed entry %d, want the latest", kept[0].ID)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	db := setupTestDB(t)
+	scheduler := &Scheduler{db: db}
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -60)
+	db.Create(&database.Delivery{ID: "d1", ProductID: "p1", PublishedAt: &old})
+	db.Create(&database.File{ID: "f1", DeliveryID: "d1", ProductID: "p1"})
+
+	// Archiving is off by default
+	scheduler.archive(now)
+	var count int64
+	db.Model(&database.File{}).Where("archived_at IS NOT NULL").Count(&count)
+	if count != 0 {
+		t.Errorf("archived files = %d, want 0 while archiving is off", count)
+	}
+
+	scheduler.SetArchiveAge(30)
+	scheduler.archive(now)
+	db.Model(&database.File{}).Where("archived_at IS NOT NULL").Count(&count)
+	if count != 1 {
+		t.Errorf("archived files = %d, want 1", count)
+	}
+}
+
+func TestCheckWindow(t *testing.T) {
+	win, err := parseWindow(&database.Product{CheckWindowStart: "0 22 * * *", CheckWindowEnd: "0 6 * * *"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at   string
+		open bool
+	}{
+		{"2025-03-01T21:59:00Z", false},
+		{"2025-03-01T22:00:00Z", true},
+		{"2025-03-02T03:00:00Z", true},
+		{"2025-03-02T06:00:00Z", false},
+		{"2025-03-02T12:00:00Z", false},
+	}
+	for _, tt := range tests {
+		at, _ := time.Parse(time.RFC3339, tt.at)
+		if got := win.open(at); got != tt.open {
+			t.Errorf("open(%s) = %v, want %v", tt.at, got, tt.open)
+		}
+	}
+
+	var none *window
+	if !none.open(time.Now()) {
+		t.Error("a product without a window end should always be open")
+	}
+	if _, err := parseWindow(&database.Product{CheckWindowEnd: "0 6 * * *"}); err == nil {
+		t.Error("parseWindow() without a start succeeded")
+	}
+}
+
+func TestSyncOutsideWindowPausesDownloads(t *testing.T) {
+	db := setupTestDB(t)
+	hooksManager := hooks.New(db)
+	registry := sources.NewRegistry(db, &config.Config{})
+	registry.Register(&mockAdapter{files: []sources.FileInfo{{ExternalID: "f1", FileName: "f1.zip"}}})
+	cfg := &config.Config{DataDir: t.TempDir(), MaxConcurrent: 1, DownloadTimeout: 60}
+
+	// The window opens in 12 hours, so it is closed now
+	hour := time.Now().Hour()
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{
+		ID: "mock:p1", SourceID: "mock", ExternalID: "p1", Name: "P1", AutoDownload: true,
+		CheckWindowStart: fmt.Sprintf("0 %d * * *", (hour+12)%24),
+		CheckWindowEnd:   fmt.Sprintf("0 %d * * *", (hour+13)%24),
+	})
+
+	scheduler := &Scheduler{
+		db:          db,
+		registry:    registry,
+		downloader:  downloader.New(db, registry, hooksManager, cfg),
+		hooks:       hooksManager,
+		retryTimers: make(map[string]*time.Timer),
+	}
+	scheduler.syncProduct("mock:p1", database.SyncTriggerManual, 1)
+
+	var entry database.DownloadEntry
+	if err := db.First(&entry, "file_id = ?", "mock:p1:d1:f1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if entry.Status != database.DownloadStatusPaused {
+		t.Errorf("status of a download outside the window = %q, want paused", entry.Status)
+	}
+}
+
+func TestScheduleJitter(t *testing.T) {
+	jitter := 5 * time.Minute
+	offsets := make(map[time.Duration]bool)
+	for _, id := range []string{"epo:a", "epo:b", "uspto:a", "uspto:b"} {
+		offset := jitterOffset(id, jitter)
+		if offset < 0 || offset >= jitter {
+			t.Errorf("jitterOffset(%q) = %v, want within %v", id, offset, jitter)
+		}
+		if offset != jitterOffset(id, jitter) {
+			t.Errorf("jitterOffset(%q) is not stable", id)
+		}
+		offsets[offset] = true
+	}
+	if len(offsets) < 2 {
+		t.Error("products sharing a schedule should get different offsets")
+	}
+	if got := jitterOffset("epo:a", 0); got != 0 {
+		t.Errorf("jitterOffset() without jitter = %v, want 0", got)
+	}
+
+	schedule, _ := cron.ParseStandard("0 6 * * *")
+	jittered := jitterSchedule{Schedule: schedule, offset: 90 * time.Second}
+	at := time.Date(2025, 3, 1, 6, 0, 30, 0, time.UTC)
+	if got, want := jittered.Next(at), time.Date(2025, 3, 1, 6, 1, 30, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", at, got, want)
+	}
+}
+
+func TestMissedRuns(t *testing.T) {
+	db := setupTestDB(t)
+	scheduler := &Scheduler{db: db}
+
+	now := time.Date(2025, 3, 5, 12, 0, 0, 0, time.UTC)
+	synced := func(d time.Time) *time.Time { return &d }
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	for _, p := range []database.Product{
+		{ID: "synced-today", LastSyncedAt: synced(now.Add(-5 * time.Hour)), AutoDownload: true},
+		{ID: "missed", LastSyncedAt: synced(now.Add(-29 * time.Hour)), AutoDownload: true},
+		{ID: "new", CreatedAt: now.Add(-time.Hour), AutoDownload: true},
+		{ID: "never-synced", CreatedAt: now.AddDate(0, 0, -3), AutoDownload: true},
+		{ID: "manual-only", LastSyncedAt: synced(now.AddDate(0, 0, -3))},
+	} {
+		p.SourceID = "mock"
+		p.CheckWindowStart = "0 6 * * *"
+		db.Create(&p)
+	}
+
+	missed := scheduler.missedRuns(now)
+	if strings.Join(missed, ",") != "missed,never-synced" {
+		t.Errorf("missedRuns() = %v, want missed and never-synced", missed)
+	}
+}
+
+func TestNextRuns(t *testing.T) {
+	from := time.Date(2025, 3, 5, 12, 0, 0, 0, time.UTC) // a Wednesday
+	runs, err := NextRuns("0 6 * * TUE", from, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Time{
+		time.Date(2025, 3, 11, 6, 0, 0, 0, time.UTC),
+		time.Date(2025, 3, 18, 6, 0, 0, 0, time.UTC),
+		time.Date(2025, 3, 25, 6, 0, 0, 0, time.UTC),
+	}
+	if len(runs) != len(want) {
+		t.Fatalf("NextRuns() = %v, want %v", runs, want)
+	}
+	for i := range want {
+		if !runs[i].Equal(want[i]) {
+			t.Errorf("NextRuns()[%d] = %v, want %v", i, runs[i], want[i])
+		}
+	}
+
+	if runs, err := NextRuns("0 6 30 2 *", from, 3); err != nil || len(runs) != 0 {
+		t.Errorf("NextRuns() for February 30th = %v, %v, want no runs", runs, err)
+	}
+	if _, err := NextRuns("0 6 * *", from, 3); err == nil {
+		t.Error("NextRuns() with an invalid expression succeeded")
+	}
+}
+
+func TestSyncDeferredByBlackout(t *testing.T) {
+	db := setupTestDB(t)
+	hooksManager := hooks.New(db)
+	registry := sources.NewRegistry(db, &config.Config{})
+	registry.Register(&mockAdapter{})
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "mock:p1", SourceID: "mock", ExternalID: "p1", Name: "P1"})
+
+	allDay, err := blackout.Parse("00:00-24:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{DataDir: t.TempDir(), MaxConcurrent: 1, DownloadTimeout: 60}
+	scheduler := &Scheduler{
+		db:          db,
+		registry:    registry,
+		downloader:  downloader.New(db, registry, hooksManager, cfg),
+		hooks:       hooksManager,
+		retryTimers: make(map[string]*time.Timer),
+	}
+	scheduler.SetBlackout(allDay)
+	defer scheduler.cancelRetries()
+
+	scheduler.syncProduct("mock:p1", database.SyncTriggerScheduled, 1)
+	var runs int64
+	db.Model(&database.SyncRun{}).Count(&runs)
+	if runs != 0 {
+		t.Errorf("%d sync runs during the blackout, want the sync deferred", runs)
+	}
+	if _, ok := scheduler.retryTimers["mock:p1"]; !ok {
+		t.Error("deferred sync should be waiting for the blackout to end")
+	}
+
+	// Manual syncs run anyway
+	scheduler.syncProduct("mock:p1", database.SyncTriggerManual, 1)
+	db.Model(&database.SyncRun{}).Count(&runs)
+	if runs != 1 {
+		t.Errorf("%d sync runs after a manual sync, want 1", runs)
+	}
+}
+
+// countingAdapter records how many product syncs list deliveries at once
+type countingAdapter struct {
+	mockAdapter
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (c *countingAdapter) FetchDeliveries(ctx context.Context, productID string) ([]sources.DeliveryInfo, error) {
+	c.mu.Lock()
+	c.running++
+	c.peak = max(c.peak, c.running)
+	c.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	c.mu.Lock()
+	c.running--
+	c.mu.Unlock()
+	return c.mockAdapter.FetchDeliveries(ctx, productID)
+}
+
+func TestMaxConcurrentSyncs(t *testing.T) {
+	db := setupTestDB(t)
+	// Keep the concurrent syncs on the single in-memory database
+	sqlDB, _ := db.DB.DB()
+	sqlDB.SetMaxOpenConns(1)
+	hooksManager := hooks.New(db)
+	registry := sources.NewRegistry(db, &config.Config{})
+	adapter := &countingAdapter{}
+	registry.Register(adapter)
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	for i := 1; i <= 4; i++ {
+		db.Create(&database.Product{ID: fmt.Sprintf("mock:p%d", i), SourceID: "mock", ExternalID: fmt.Sprintf("p%d", i), Name: "P"})
+	}
+
+	cfg := &config.Config{DataDir: t.TempDir(), MaxConcurrent: 1, DownloadTimeout: 60}
+	scheduler := &Scheduler{
+		db:          db,
+		registry:    registry,
+		downloader:  downloader.New(db, registry, hooksManager, cfg),
+		hooks:       hooksManager,
+		retryTimers: make(map[string]*time.Timer),
+	}
+	scheduler.SetMaxConcurrentSyncs(2)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 4; i++ {
+		wg.Add(1)
+		go func(productID string) {
+			defer wg.Done()
+			scheduler.syncProduct(productID, database.SyncTriggerManual, 1)
+		}(fmt.Sprintf("mock:p%d", i))
+	}
+	wg.Wait()
+
+	if adapter.peak != 2 {
+		t.Errorf("%d syncs ran at once, want 2", adapter.peak)
+	}
+	var runs int64
+	db.Model(&database.SyncRun{}).Where("status = ?", database.SyncStatusCompleted).Count(&runs)
+	if runs != 4 {
+		t.Errorf("%d completed sync runs, want 4", runs)
+	}
+}
+
+// blockingAdapter holds each delivery's file listing until released
+type blockingAdapter struct {
+	mockAdapter
+	listing chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingAdapter) FetchDeliveries(context.Context, string) ([]sources.DeliveryInfo, error) {
+	return []sources.DeliveryInfo{{ExternalID: "d1", PublishedAt: time.Now()}, {ExternalID: "d2", PublishedAt: time.Now()}}, nil
+}
+
+func (b *blockingAdapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]sources.FileInfo, error) {
+	b.listing <- struct{}{}
+	<-b.release
+	return []sources.FileInfo{{ExternalID: deliveryID + "-a"}, {ExternalID: deliveryID + "-b"}}, nil
+}
+
+func TestSyncProgress(t *testing.T) {
+	db := setupTestDB(t)
+	hooksManager := hooks.New(db)
+	registry := sources.NewRegistry(db, &config.Config{})
+	adapter := &blockingAdapter{listing: make(chan struct{}), release: make(chan struct{})}
+	registry.Register(adapter)
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	db.Create(&database.Product{ID: "mock:p1", SourceID: "mock", ExternalID: "p1", Name: "P1"})
+
+	scheduler := &Scheduler{db: db, registry: registry, hooks: hooksManager}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scheduler.sync(context.Background(), "mock:p1", database.SyncTriggerManual, 1)
+	}()
+
+	<-adapter.listing
+	active := scheduler.ActiveSyncs()
+	if len(active) != 1 || active[0].ProductID != "mock:p1" || active[0].SourceID != "mock" || active[0].Trigger != database.SyncTriggerManual {
+		t.Fatalf("ActiveSyncs = %+v, want the running manual sync of mock:p1", active)
+	}
+	if active[0].DeliveriesTotal != 2 || active[0].DeliveriesProcessed != 0 {
+		t.Errorf("progress = %+v, want 0 of 2 deliveries", active[0])
+	}
+
+	adapter.release <- struct{}{}
+	<-adapter.listing
+	active = scheduler.ActiveSyncs()
+	if len(active) != 1 || active[0].DeliveriesProcessed != 1 || active[0].FilesDiscovered != 2 {
+		t.Errorf("progress = %+v, want 1 delivery and 2 files", active)
+	}
+
+	adapter.release <- struct{}{}
+	<-done
+	if active := scheduler.ActiveSyncs(); len(active) != 0 {
+		t.Errorf("ActiveSyncs after the sync = %+v, want none", active)
+	}
+}
+
+func TestSyncFailureLimit(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{DataDir: t.TempDir(), MaxConcurrent: 1, DownloadTimeout: 60}
+	registry := sources.NewRegistry(db, cfg)
+	adapter := &mockAdapter{deliveriesErr: errors.New("unknown product")}
+	registry.Register(adapter)
+	hooksManager := hooks.New(db)
+	scheduler := &Scheduler{
+		db:         db,
+		registry:   registry,
+		downloader: downloader.New(db, registry, hooksManager, cfg),
+		hooks:      hooksManager,
+		cron:       cron.New(),
+		entryIDs:   make(map[string]cron.EntryID),
+	}
+	scheduler.SetRetryPolicy(2, time.Hour)
+	scheduler.SetSyncFailureLimit(2)
+	defer scheduler.cancelRetries()
+
+	db.Create(&database.Source{ID: "mock", Name: "Mock", Enabled: true})
+	product := &database.Product{ID: "p1", SourceID: "mock", ExternalID: "p1", AutoDownload: true, CheckWindowStart: "0 6 * * *"}
+	db.Create(product)
+	scheduler.ScheduleProduct(product)
+
+	// A sync that is retried only counts once its retries are used up
+	scheduler.syncProduct("p1", database.SyncTriggerScheduled, 1)
+	scheduler.syncProduct("p1", database.SyncTriggerRetry, 3)
+	db.First(product, "id = ?", "p1")
+	if product.SyncFailures != 1 || product.SyncDisabledAt != nil {
+		t.Fatalf("after one failed sync: failures = %d, disabled = %v", product.SyncFailures, product.SyncDisabledAt)
+	}
+
+	scheduler.syncProduct("p1", database.SyncTriggerManual, 1)
+	db.First(product, "id = ?", "p1")
+	if product.SyncFailures != 2 || product.SyncDisabledAt == nil {
+		t.Fatalf("after two failed syncs: failures = %d, disabled = %v", product.SyncFailures, product.SyncDisabledAt)
+	}
+	if scheduler.GetNextRun("p1") != nil {
+		t.Error("suspended product should not be scheduled")
+	}
+	if runs := scheduler.missedRuns(time.Now().AddDate(0, 0, 2)); len(runs) != 0 {
+		t.Errorf("missedRuns = %v, want suspended products skipped", runs)
+	}
+
+	// A successful manual sync resumes the schedule
+	adapter.deliveriesErr = nil
+	scheduler.syncProduct("p1", database.SyncTriggerManual, 1)
+	product = &database.Product{}
+	db.First(product, "id = ?", "p1")
+	if product.SyncFailures != 0 || product.SyncDisabledAt != nil {
+		t.Errorf("after a successful sync: failures = %d, disabled = %v", product.SyncFailures, product.SyncDisabledAt)
+	}
+	if scheduler.GetNextRun("p1") == nil {
+		t.Error("product should be scheduled again")
+	}
+}
@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/downloader"
+)
+
+var errWindowEndWithoutStart = errors.New("check window end requires a check window start")
+
+// window is the period in which a product's scheduled syncs and
+// auto-downloads run. It opens at each CheckWindowStart and closes at the
+// following CheckWindowEnd; without an end it never closes.
+type window struct {
+	start cron.Schedule
+	end   cron.Schedule
+}
+
+// parseWindow parses the product's check window. It returns nil if the
+// product has no check window end.
+func parseWindow(product *database.Product) (*window, error) {
+	if product.CheckWindowEnd == "" {
+		return nil, nil
+	}
+	if product.CheckWindowStart == "" {
+		return nil, errWindowEndWithoutStart
+	}
+	start, err := cron.ParseStandard(product.CheckWindowStart)
+	if err != nil {
+		return nil, err
+	}
+	end, err := cron.ParseStandard(product.CheckWindowEnd)
+	if err != nil {
+		return nil, err
+	}
+	return &window{start: start, end: end}, nil
+}
+
+// open reports whether the window is open at t, i.e. whether it closes
+// before it opens again
+func (w *window) open(t time.Time) bool {
+	return w == nil || w.end.Next(t).Before(w.start.Next(t))
+}
+
+// closesAt returns when the window that is open at t closes
+func (w *window) closesAt(t time.Time) time.Time {
+	return w.end.Next(t)
+}
+
+// opensAt returns when the window opens next after t
+func (w *window) opensAt(t time.Time) time.Time {
+	return w.start.Next(t)
+}
+
+// productWindow returns the check window of a product. A product that can't
+// be loaded or has an invalid window is treated as having none.
+func (s *Scheduler) productWindow(productID string) *window {
+	var product database.Product
+	if err := s.db.First(&product, "id = ?", productID).Error; err != nil {
+		return nil
+	}
+	win, err := parseWindow(&product)
+	if err != nil {
+		slog.Error("Invalid check window", "productID", productID, "error", err)
+		return nil
+	}
+	return win
+}
+
+// startDownloads downloads the files within the product's check window.
+// Downloads still running when the window closes are paused, and files found
+// outside the window are paused right away; both resume with the next sync
+// inside the window.
+func (s *Scheduler) startDownloads(productID string, win *window, fileIDs []string) {
+	now := time.Now()
+	if !win.open(now) {
+		for _, fileID := range fileIDs {
+			if err := s.downloader.MarkPaused(fileID); err != nil {
+				slog.Error("Failed to pause download", "fileID", fileID, "error", err)
+			}
+		}
+		if len(fileIDs) > 0 {
+			slog.Info("Check window closed, downloads paused", "productID", productID,
+				"count", len(fileIDs), "opensAt", win.opensAt(now))
+		}
+		return
+	}
+
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if win != nil {
+		ctx, cancel = context.WithDeadlineCause(ctx, win.closesAt(now), downloader.ErrWindowClosed)
+	}
+
+	// Downloads paused earlier run again with the new ones
+	fileIDs = append(fileIDs, s.downloader.ResumePaused(productID)...)
+
+	var wg sync.WaitGroup
+	for _, fileID := range fileIDs {
+		wg.Add(1)
+		go func(fID string) {
+			defer wg.Done()
+			if err := s.downloader.Download(ctx, fID); err != nil && !errors.Is(err, downloader.ErrWindowClosed) {
+				slog.Error("Auto-download failed", "fileID", fID, "error", err)
+			}
+		}(fileID)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+}
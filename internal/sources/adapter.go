@@ -26,13 +26,48 @@ type Adapter interface {
 	DownloadFile(ctx context.Context, file FileInfo, dst io.Writer, progress ProgressFunc) error
 }
 
+// IncrementalAdapter is implemented by adapters that can list only the
+// deliveries published since a point in time, saving requests to the office
+type IncrementalAdapter interface {
+	FetchDeliveriesSince(ctx context.Context, productID string, since time.Time) ([]DeliveryInfo, error)
+}
+
+// FetchDeliveriesSince returns the deliveries published at or after since.
+// Adapters without IncrementalAdapter list all deliveries, which are then
+// filtered here. Deliveries without a publication date are always included.
+func FetchDeliveriesSince(ctx context.Context, adapter Adapter, productID string, since time.Time) ([]DeliveryInfo, error) {
+	var deliveries []DeliveryInfo
+	var err error
+	if incremental, ok := adapter.(IncrementalAdapter); ok {
+		deliveries, err = incremental.FetchDeliveriesSince(ctx, productID, since)
+	} else {
+		deliveries, err = adapter.FetchDeliveries(ctx, productID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := deliveries[:0]
+	for _, d := range deliveries {
+		if d.PublishedAt.IsZero() || !d.PublishedAt.Before(since) {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
 // CredentialField defines a credential input field
 type CredentialField struct {
 	Key      string `json:"key"`
 	Label    string `json:"label"`
-	Type     string `json:"type"` // "text", "password"
+	Type     string `json:"type"` // "text", "password", "oauth2"
 	Required bool   `json:"required"`
 	HelpText string `json:"helpText,omitempty"`
+	// ExpiresAfterDays is how long the office accepts a newly issued value,
+	// e.g. for API keys or passwords that must be rotated (0 = no expiry)
+	ExpiresAfterDays int `json:"expiresAfterDays,omitempty"`
+	// OAuth2 describes the token endpoint of an "oauth2" field
+	OAuth2 *OAuth2Config `json:"oauth2,omitempty"`
 }
 
 // ProductInfo represents product metadata from an API
@@ -0,0 +1,315 @@
+// Package bdss is a source adapter for the legacy USPTO Bulk Data Storage
+// System at bulkdata.uspto.gov. It covers the historical archives that are not
+// yet available through the Open Data Portal used by the uspto adapter.
+package bdss
+
+import (
+	"bytes"
+	"context"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/httpdir"
+)
+
+const (
+	SourceID   = "uspto-bdss"
+	SourceName = "USPTO Bulk Data (Legacy)"
+
+	defaultBaseURL = "https://bulkdata.uspto.gov/data/"
+)
+
+// product is a BDSS collection. Its directory holds one subdirectory per year.
+type product struct {
+	path     string
+	name     string
+	schedule string
+}
+
+// catalog lists the collections offered when no paths are configured
+var catalog = []product{
+	{"patent/grant/redbook/fulltext", "Patent Grant Full Text", "0 6 * * 2"},                      // Grants issue on Tuesdays
+	{"patent/grant/redbook/bibliographic", "Patent Grant Bibliographic", "0 6 * * 2"},             // Grants issue on Tuesdays
+	{"patent/application/redbook/fulltext", "Patent Application Full Text", "0 6 * * 4"},          // Applications publish on Thursdays
+	{"patent/application/redbook/bibliographic", "Patent Application Bibliographic", "0 6 * * 4"}, // Applications publish on Thursdays
+}
+
+// Adapter implements the sources.Adapter interface for BDSS. Each collection
+// is a product, each year directory a delivery.
+type Adapter struct {
+	client      *httpdir.Client
+	credentials map[string]string
+}
+
+// New creates a new BDSS adapter
+func New() *Adapter {
+	return &Adapter{
+		credentials: make(map[string]string),
+	}
+}
+
+// ID returns the source identifier
+func (a *Adapter) ID() string {
+	return SourceID
+}
+
+// Name returns the human-readable source name
+func (a *Adapter) Name() string {
+	return SourceName
+}
+
+// CredentialFields returns the configuration fields. BDSS is public, so none
+// are required.
+func (a *Adapter) CredentialFields() []sources.CredentialField {
+	return []sources.CredentialField{
+		{
+			Key:      "paths",
+			Label:    "Collections",
+			Type:     "text",
+			HelpText: "Collection paths below the base URL separated by commas, e.g. patent/grant/redbook/fulltext (default: grant and application full text and bibliographic)",
+		},
+		{
+			Key:      "base_url",
+			Label:    "Base URL",
+			Type:     "text",
+			HelpText: "Default: " + defaultBaseURL,
+		},
+	}
+}
+
+// SetCredentials sets the credentials for the adapter
+func (a *Adapter) SetCredentials(creds map[string]string) {
+	a.credentials = creds
+	a.client = nil // Reset client to force re-creation with new credentials
+}
+
+// ValidateCredentials checks that the configured collections can be listed
+func (a *Adapter) ValidateCredentials(ctx context.Context) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range a.products() {
+		if _, err := a.list(ctx, client, p.path); err != nil {
+			return sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Failed to list "+p.path, err)
+		}
+	}
+	return nil
+}
+
+// FetchProducts returns the configured collections
+func (a *Adapter) FetchProducts(ctx context.Context) ([]sources.ProductInfo, error) {
+	if _, err := a.getClient(); err != nil {
+		return nil, err
+	}
+
+	var result []sources.ProductInfo
+	for _, p := range a.products() {
+		result = append(result, sources.ProductInfo{
+			ExternalID:    productID(p.path),
+			Name:          p.name,
+			Description:   "USPTO bulk data archive " + p.path,
+			CheckSchedule: p.schedule,
+		})
+	}
+	return result, nil
+}
+
+// FetchDeliveries returns the year directories of a collection
+func (a *Adapter) FetchDeliveries(ctx context.Context, productID string) ([]sources.DeliveryInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+	p, err := a.product(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := a.list(ctx, client, p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.DeliveryInfo
+	for _, e := range entries {
+		year, err := strconv.Atoi(e.Name)
+		if !e.Dir || err != nil || len(e.Name) != 4 {
+			continue
+		}
+		published := e.Modified
+		if published.IsZero() {
+			published = time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		result = append(result, sources.DeliveryInfo{
+			ExternalID:  e.Name,
+			Name:        e.Name,
+			PublishedAt: published,
+		})
+	}
+
+	// Newest first, like the other sources
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ExternalID > result[j].ExternalID
+	})
+
+	return result, nil
+}
+
+// FetchFiles returns the archives of a year
+func (a *Adapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]sources.FileInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+	p, err := a.product(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Join(p.path, deliveryID)
+	entries, err := a.list(ctx, client, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.FileInfo
+	for _, e := range entries {
+		if e.Dir {
+			continue
+		}
+		result = append(result, sources.FileInfo{
+			ExternalID:  e.Name,
+			FileName:    e.Name,
+			FileSize:    e.Size,
+			DownloadURI: path.Join(dir, e.Name),
+			ReleasedAt:  e.Modified,
+		})
+	}
+
+	return result, nil
+}
+
+// DownloadFile downloads a file
+func (a *Adapter) DownloadFile(ctx context.Context, file sources.FileInfo, dst io.Writer, progress sources.ProgressFunc) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	if file.DownloadURI == "" || strings.Contains(file.DownloadURI, "..") || strings.Contains(file.DownloadURI, "://") {
+		return sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid download URI", nil)
+	}
+
+	return client.Download(ctx, file.DownloadURI, dst, progress)
+}
+
+// list returns the entries of a directory. BDSS pages are tables with the
+// size before the date, which httpdir.Parse doesn't read, so they are parsed
+// here; autoindex pages from mirrors are handled by httpdir.
+func (a *Adapter) list(ctx context.Context, client *httpdir.Client, dir string) ([]httpdir.Entry, error) {
+	page, err := client.Page(ctx, strings.TrimSuffix(dir, "/")+"/")
+	if err != nil {
+		return nil, err
+	}
+	if entries := parseListing(page); len(entries) > 0 {
+		return entries, nil
+	}
+	return httpdir.Parse(bytes.NewReader(page))
+}
+
+func (a *Adapter) getClient() (*httpdir.Client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	baseURL := a.credentials["base_url"]
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	if u, err := url.Parse(baseURL); err != nil || u.Host == "" {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid base URL", err)
+	}
+
+	a.client = &httpdir.Client{
+		BaseURL:    baseURL,
+		HTTPClient: sources.NewHTTPClient(SourceID),
+	}
+	return a.client, nil
+}
+
+// products returns the configured collections, or the catalog if none are
+func (a *Adapter) products() []product {
+	var result []product
+	for _, p := range strings.Split(a.credentials["paths"], ",") {
+		p = strings.Trim(strings.TrimSpace(p), "/")
+		if p == "" {
+			continue
+		}
+		entry := product{path: p, name: p, schedule: "0 6 * * *"} // Default: 6 AM daily
+		for _, known := range catalog {
+			if known.path == p {
+				entry = known
+			}
+		}
+		result = append(result, entry)
+	}
+	if len(result) == 0 {
+		return catalog
+	}
+	return result
+}
+
+func (a *Adapter) product(id string) (product, error) {
+	for _, p := range a.products() {
+		if productID(p.path) == id {
+			return p, nil
+		}
+	}
+	return product{}, sources.NewAdapterError(sources.ErrCodeNotFound, "Collection is no longer configured", nil)
+}
+
+// productID turns a collection path into an ID usable in API paths
+func productID(p string) string {
+	return strings.ReplaceAll(p, "/", "_")
+}
+
+// rowRegex matches a row of a BDSS listing table: the link, the size in bytes
+// and the modification time
+var rowRegex = regexp.MustCompile(`(?i)<a href="([^"]+)"[^>]*>[^<]*</a>\s*</td>\s*<td[^>]*>\s*([\d,]+|-)?\s*</td>\s*<td[^>]*>\s*(\d{4}-\d{2}-\d{2} \d{2}:\d{2})`)
+
+// parseListing extracts the entries of a BDSS listing table. Links leaving
+// the directory are skipped.
+func parseListing(page []byte) []httpdir.Entry {
+	var entries []httpdir.Entry
+	for _, m := range rowRegex.FindAllSubmatch(page, -1) {
+		href := html.UnescapeString(string(m[1]))
+		if strings.HasPrefix(href, "?") || strings.HasPrefix(href, "/") || strings.HasPrefix(href, "..") || strings.Contains(href, "://") {
+			continue
+		}
+		name, err := url.PathUnescape(href)
+		if err != nil {
+			name = href
+		}
+		entry := httpdir.Entry{Name: strings.TrimSuffix(name, "/"), Dir: strings.HasSuffix(name, "/")}
+		// Names end up in download paths
+		if sources.CheckName(entry.Name) != nil {
+			continue
+		}
+		if !entry.Dir {
+			entry.Size, _ = strconv.ParseInt(strings.ReplaceAll(string(m[2]), ",", ""), 10, 64)
+		}
+		entry.Modified, _ = time.Parse("2006-01-02 15:04", string(m[3]))
+		entries = append(entries, entry)
+	}
+	return entries
+}
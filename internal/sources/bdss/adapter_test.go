@@ -0,0 +1,77 @@
+package bdss
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const yearsPage = `<html><body><table>
+<tr><th>File Name</th><th>Size</th><th>Date</th></tr>
+<tr><td><a href="../">Parent Directory</a></td><td></td><td></td></tr>
+<tr><td><a href="2023/">2023</a></td><td align="right">-</td><td>2024-01-02 00:10</td></tr>
+<tr><td><a href="2024/">2024</a></td><td align="right">-</td><td>2025-01-01 00:10</td></tr>
+<tr><td><a href="README.txt">README.txt</a></td><td align="right">512</td><td>2020-05-01 12:00</td></tr>
+</table></body></html>`
+
+const filesPage = `<html><body><table>
+<tr><td><a href="ipg240102.zip">ipg240102.zip</a></td><td align="right">137,893,845</td><td>2024-01-02 00:03</td></tr>
+<tr><td><a href="ipg240109.zip">ipg240109.zip</a></td><td align="right">140123456</td><td>2024-01-09 00:04</td></tr>
+<tr><td><a href="a%5C..%5Cevil.zip">evil.zip</a></td><td align="right">42</td><td>2024-01-09 00:04</td></tr>
+<tr><td><a href="%2E%2E">evil</a></td><td align="right">42</td><td>2024-01-09 00:04</td></tr>
+</table></body></html>`
+
+func TestAdapter(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/data/patent/grant/redbook/fulltext/", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(yearsPage)) })
+	mux.HandleFunc("/data/patent/grant/redbook/fulltext/2024/", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(filesPage)) })
+	mux.HandleFunc("/data/patent/grant/redbook/fulltext/2024/ipg240109.zip", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("PK")) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	ctx := context.Background()
+
+	a := New()
+	a.SetCredentials(map[string]string{"base_url": server.URL + "/data/", "paths": "/patent/grant/redbook/fulltext/"})
+
+	products, err := a.FetchProducts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 || products[0].ExternalID != "patent_grant_redbook_fulltext" || products[0].Name != "Patent Grant Full Text" {
+		t.Fatalf("FetchProducts() = %+v, want the grant full text collection", products)
+	}
+
+	deliveries, err := a.FetchDeliveries(ctx, products[0].ExternalID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || deliveries[0].ExternalID != "2024" || deliveries[1].ExternalID != "2023" {
+		t.Fatalf("FetchDeliveries() = %+v, want 2024 and 2023", deliveries)
+	}
+
+	files, err := a.FetchFiles(ctx, products[0].ExternalID, "2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].FileSize != 137893845 || files[1].DownloadURI != "patent/grant/redbook/fulltext/2024/ipg240109.zip" {
+		t.Fatalf("FetchFiles() = %+v, want both archives with sizes", files)
+	}
+
+	var buf bytes.Buffer
+	if err := a.DownloadFile(ctx, files[1], &buf, nil); err != nil || buf.String() != "PK" {
+		t.Errorf("DownloadFile() = %q, %v", buf.String(), err)
+	}
+}
+
+func TestProducts(t *testing.T) {
+	a := New()
+	if got := a.products(); len(got) != len(catalog) {
+		t.Errorf("products() without paths = %d collections, want the catalog", len(got))
+	}
+	a.SetCredentials(map[string]string{"paths": "trademark/dailyxml/applications"})
+	if got := a.products(); len(got) != 1 || got[0].name != "trademark/dailyxml/applications" {
+		t.Errorf("products() = %+v, want the custom path", got)
+	}
+}
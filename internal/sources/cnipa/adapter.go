@@ -0,0 +1,284 @@
+package cnipa
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/httpdir"
+)
+
+const (
+	SourceID   = "cnipa"
+	SourceName = "CNIPA"
+)
+
+// Adapter implements the sources.Adapter interface for the CNIPA bulk data
+// service. Requests are authorised with a bearer token obtained from the
+// service's token endpoint. Top-level directories are data types (products)
+// and their subdirectories are deliveries. Large archives are split into
+// numbered parts, which the adapter presents and downloads as one file.
+type Adapter struct {
+	client      *httpdir.Client
+	credentials map[string]string
+}
+
+// New creates a new CNIPA adapter
+func New() *Adapter {
+	return &Adapter{
+		credentials: make(map[string]string),
+	}
+}
+
+// ID returns the source identifier
+func (a *Adapter) ID() string {
+	return SourceID
+}
+
+// Name returns the human-readable source name
+func (a *Adapter) Name() string {
+	return SourceName
+}
+
+// CredentialFields returns the required credential fields
+func (a *Adapter) CredentialFields() []sources.CredentialField {
+	return []sources.CredentialField{
+		{
+			Key:      "base_url",
+			Label:    "Base URL",
+			Type:     "text",
+			Required: true,
+			HelpText: "The bulk data URL from your CNIPA data service account",
+		},
+		{
+			Key:      "token_url",
+			Label:    "Token URL",
+			Type:     "text",
+			Required: true,
+			HelpText: "The endpoint issuing access tokens for your account",
+		},
+		{
+			Key:      "client_id",
+			Label:    "Client ID",
+			Type:     "text",
+			Required: true,
+			HelpText: "Your CNIPA data service client ID",
+		},
+		{
+			Key:      "client_secret",
+			Label:    "Client Secret",
+			Type:     "password",
+			Required: true,
+			HelpText: "Your CNIPA data service client secret",
+		},
+	}
+}
+
+// SetCredentials sets the credentials for the adapter
+func (a *Adapter) SetCredentials(creds map[string]string) {
+	a.credentials = creds
+	a.client = nil // Reset client to force re-creation with new credentials
+}
+
+// ValidateCredentials tests if the credentials are valid
+func (a *Adapter) ValidateCredentials(ctx context.Context) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	// Try to list the data types to validate credentials
+	if _, err := client.List(ctx, ""); err != nil {
+		return sources.NewAdapterError(sources.ErrCodeAuth, "Failed to authenticate with CNIPA", err)
+	}
+
+	return nil
+}
+
+// FetchProducts fetches the data types available to the account
+func (a *Adapter) FetchProducts(ctx context.Context) ([]sources.ProductInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := client.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.ProductInfo
+	for _, e := range entries {
+		if !e.Dir {
+			continue
+		}
+		result = append(result, sources.ProductInfo{
+			ExternalID:    e.Name,
+			Name:          "CNIPA " + e.Name,
+			Description:   "CNIPA bulk data " + e.Name,
+			CheckSchedule: "0 6 * * *", // Default: 6 AM daily
+		})
+	}
+
+	return result, nil
+}
+
+// FetchDeliveries fetches the deliveries of a data type
+func (a *Adapter) FetchDeliveries(ctx context.Context, productID string) ([]sources.DeliveryInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := client.List(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.DeliveryInfo
+	for _, e := range entries {
+		if !e.Dir {
+			continue
+		}
+		result = append(result, sources.DeliveryInfo{
+			ExternalID:  e.Name,
+			Name:        e.Name,
+			PublishedAt: e.Modified,
+		})
+	}
+
+	// Newest first, like the other sources
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ExternalID > result[j].ExternalID
+	})
+
+	return result, nil
+}
+
+// FetchFiles fetches files for a delivery, joining split archives
+func (a *Adapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]sources.FileInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Join(productID, deliveryID)
+	entries, err := client.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.FileInfo
+	for _, f := range groupParts(entries) {
+		// Parts such as "...001" would join into ".."
+		if sources.CheckName(f.name) != nil {
+			continue
+		}
+		uri := path.Join(dir, f.name)
+		if len(f.parts) > 0 {
+			uri += splitSuffix
+		}
+		result = append(result, sources.FileInfo{
+			ExternalID:  f.name,
+			FileName:    f.name,
+			FileSize:    f.size,
+			DownloadURI: uri,
+			ReleasedAt:  f.modified,
+		})
+	}
+
+	return result, nil
+}
+
+// DownloadFile downloads a file. Split archives are written part by part
+// into dst, so the result is the complete archive.
+func (a *Adapter) DownloadFile(ctx context.Context, file sources.FileInfo, dst io.Writer, progress sources.ProgressFunc) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	if file.DownloadURI == "" || strings.Contains(file.DownloadURI, "..") {
+		return sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid download URI", nil)
+	}
+
+	archive, split := strings.CutSuffix(file.DownloadURI, splitSuffix)
+	if !split {
+		return client.Download(ctx, file.DownloadURI, dst, progress)
+	}
+
+	// List the parts again: the part count isn't stored and may have changed
+	dir, name := path.Split(archive)
+	entries, err := client.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+	var archiveFile *splitFile
+	for _, f := range groupParts(entries) {
+		if f.name == name && len(f.parts) > 0 {
+			archiveFile = &f
+			break
+		}
+	}
+	if archiveFile == nil {
+		return sources.NewAdapterError(sources.ErrCodeNotFound, "Split archive not found", nil)
+	}
+
+	var done int64
+	for _, part := range archiveFile.parts {
+		var partProgress sources.ProgressFunc
+		if progress != nil {
+			offset := done
+			partProgress = func(written, _ int64) {
+				progress(offset+written, archiveFile.size)
+			}
+		}
+		if err := client.Download(ctx, path.Join(dir, part.Name), dst, partProgress); err != nil {
+			return err
+		}
+		done += part.Size
+	}
+	return nil
+}
+
+func (a *Adapter) getClient() (*httpdir.Client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	baseURL := a.credentials["base_url"]
+	tokenURL := a.credentials["token_url"]
+	clientID := a.credentials["client_id"]
+	clientSecret := a.credentials["client_secret"]
+
+	if baseURL == "" || tokenURL == "" || clientID == "" || clientSecret == "" {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Missing credentials", nil)
+	}
+
+	httpClient := sources.NewHTTPClient(SourceID)
+	tokens := &tokenSource{
+		url:          tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient:   httpClient,
+	}
+
+	a.client = &httpdir.Client{
+		BaseURL:    baseURL,
+		HTTPClient: httpClient,
+		Authorize: func(req *http.Request) error {
+			token, err := tokens.Token(req.Context())
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		},
+	}
+
+	return a.client, nil
+}
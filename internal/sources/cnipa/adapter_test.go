@@ -0,0 +1,107 @@
+package cnipa
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+const deliveryListing = `<html><body><pre><a href="../">../</a>
+<a href="CN-A-20250314.zip.002">CN-A-20250314.zip.002</a>          14-Mar-2025 09:00                   4
+<a href="CN-A-20250314.zip.001">CN-A-20250314.zip.001</a>          14-Mar-2025 08:00                   6
+<a href="index.xml">index.xml</a>                                  14-Mar-2025 08:00                   3
+<a href="%2E%2E.001">...001</a>                                  14-Mar-2025 08:00                   3
+<a href="..%2Fevil.zip">evil.zip</a>                               14-Mar-2025 08:00                   3
+</pre></body></html>`
+
+func TestAdapter(t *testing.T) {
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			if r.PostFormValue("client_secret") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"access_token":"abc","expires_in":3600}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/data/invention/20250314/":
+			w.Write([]byte(deliveryListing))
+		case "/data/invention/20250314/CN-A-20250314.zip.001":
+			w.Write([]byte("first-"))
+		case "/data/invention/20250314/CN-A-20250314.zip.002":
+			w.Write([]byte("last"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := New()
+	a.SetCredentials(map[string]string{
+		"base_url":      server.URL + "/data",
+		"token_url":     server.URL + "/token",
+		"client_id":     "client",
+		"client_secret": "secret",
+	})
+	ctx := context.Background()
+
+	files, err := a.FetchFiles(ctx, "invention", "20250314")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("FetchFiles() returned %d files, want 2: %+v", len(files), files)
+	}
+	for _, f := range files {
+		if err := errors.Join(sources.CheckName(f.ExternalID), sources.CheckName(f.FileName)); err != nil {
+			t.Errorf("FetchFiles() returned an unsafe name: %v", err)
+		}
+	}
+	archive := files[0]
+	if archive.FileName != "CN-A-20250314.zip" || archive.FileSize != 10 {
+		t.Errorf("split archive = %s (%d bytes), want CN-A-20250314.zip (10 bytes)", archive.FileName, archive.FileSize)
+	}
+	if files[1].FileName != "index.xml" {
+		t.Errorf("second file = %s, want index.xml", files[1].FileName)
+	}
+
+	var buf bytes.Buffer
+	var lastWritten, lastTotal int64
+	err = a.DownloadFile(ctx, archive, &buf, func(written, total int64) {
+		lastWritten, lastTotal = written, total
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "first-last" {
+		t.Errorf("DownloadFile() wrote %q, want parts in order", buf.String())
+	}
+	if lastWritten != 10 || lastTotal != 10 {
+		t.Errorf("progress = %d/%d, want 10/10", lastWritten, lastTotal)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("token requested %d times, want 1", tokenRequests)
+	}
+
+	a.SetCredentials(map[string]string{
+		"base_url":      server.URL + "/data",
+		"token_url":     server.URL + "/token",
+		"client_id":     "client",
+		"client_secret": "wrong",
+	})
+	if err := a.ValidateCredentials(ctx); err == nil {
+		t.Error("ValidateCredentials() with a wrong secret succeeded")
+	}
+}
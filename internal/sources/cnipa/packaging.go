@@ -0,0 +1,60 @@
+package cnipa
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources/httpdir"
+)
+
+// splitSuffix marks the download URI of an archive that is delivered in parts
+const splitSuffix = ".*"
+
+// partRegex matches numbered parts of a split archive, e.g. "CN-A-20250314.zip.001"
+var partRegex = regexp.MustCompile(`^(.+)\.(\d{3})$`)
+
+// splitFile is a file of a delivery, either a single entry or an archive made
+// of numbered parts
+type splitFile struct {
+	name     string
+	size     int64
+	modified time.Time
+	parts    []httpdir.Entry // in order; empty for unsplit files
+}
+
+// groupParts joins the numbered parts of split archives into a single file.
+// Other files are returned unchanged, in listing order.
+func groupParts(entries []httpdir.Entry) []splitFile {
+	var files []splitFile
+	index := make(map[string]int)
+	for _, e := range entries {
+		if e.Dir {
+			continue
+		}
+		m := partRegex.FindStringSubmatch(e.Name)
+		if m == nil {
+			files = append(files, splitFile{name: e.Name, size: e.Size, modified: e.Modified})
+			continue
+		}
+
+		i, ok := index[m[1]]
+		if !ok {
+			i = len(files)
+			index[m[1]] = i
+			files = append(files, splitFile{name: m[1]})
+		}
+		f := &files[i]
+		f.parts = append(f.parts, e)
+		f.size += e.Size
+		if e.Modified.After(f.modified) {
+			f.modified = e.Modified
+		}
+	}
+
+	for i := range files {
+		parts := files[i].parts
+		sort.Slice(parts, func(a, b int) bool { return parts[a].Name < parts[b].Name })
+	}
+	return files
+}
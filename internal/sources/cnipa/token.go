@@ -0,0 +1,80 @@
+package cnipa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+// tokenExpiryMargin renews tokens this long before they expire, so a token
+// doesn't run out between listing a directory and starting a download
+const tokenExpiryMargin = time.Minute
+
+// tokenSource fetches access tokens with the client credentials grant and
+// caches them until shortly before they expire
+type tokenSource struct {
+	url          string
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Token returns a valid access token, requesting a new one if needed
+func (s *tokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.clientID},
+		"client_secret": {s.clientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid token URL", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", sources.NewAdapterError(sources.ErrCodeNetwork, "Token request failed", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized:
+		return "", sources.NewAdapterError(sources.ErrCodeAuth, "Invalid client credentials", fmt.Errorf("status %d", resp.StatusCode))
+	case resp.StatusCode != http.StatusOK:
+		return "", sources.NewAdapterError(sources.ErrCodeNetwork, "Token request failed", fmt.Errorf("status %d", resp.StatusCode))
+	}
+
+	var body tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err != nil || body.AccessToken == "" {
+		return "", sources.NewAdapterError(sources.ErrCodeNetwork, "Invalid token response", err)
+	}
+
+	s.token = body.AccessToken
+	s.expires = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - tokenExpiryMargin)
+	return s.token, nil
+}
@@ -19,6 +19,7 @@ const (
 type Adapter struct {
 	client      *bdds.Client
 	credentials map[string]string
+	baseURL     string
 }
 
 // New creates a new EPO BDDS adapter
@@ -64,6 +65,12 @@ func (a *Adapter) SetCredentials(creds map[string]string) {
 	a.client = nil // Reset client to force re-creation with new credentials
 }
 
+// SetOptions sets the base URL override, e.g. for a test environment
+func (a *Adapter) SetOptions(opts sources.Options) {
+	a.baseURL = opts.BaseURL
+	a.client = nil
+}
+
 // ValidateCredentials tests if the credentials are valid
 func (a *Adapter) ValidateCredentials(ctx context.Context) error {
 	client, err := a.getClient()
@@ -231,6 +238,7 @@ func (a *Adapter) getClient() (*bdds.Client, error) {
 	client, err := bdds.NewClient(&bdds.Config{
 		Username: username,
 		Password: password,
+		BaseURL:  a.baseURL, // Empty uses the library's default
 	})
 	if err != nil {
 		return nil, sources.NewAdapterError(sources.ErrCodeAuth, "Failed to create client", err)
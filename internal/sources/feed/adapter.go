@@ -0,0 +1,327 @@
+// Package feed is a source adapter for offices that announce releases in an
+// RSS or Atom feed or a sitemap rather than through an API
+package feed
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/httpdir"
+)
+
+const (
+	SourceID   = "feed"
+	SourceName = "Feed"
+
+	// productID is the single product the adapter exposes
+	productID = "feed"
+
+	// maxSitemaps limits how many child sitemaps of an index are read
+	maxSitemaps = 50
+)
+
+// Adapter implements the sources.Adapter interface for a feed. Each entry is
+// a delivery; its enclosures, or its link if it has none, are the files.
+type Adapter struct {
+	client      *httpdir.Client
+	credentials map[string]string
+}
+
+// New creates a new feed adapter
+func New() *Adapter {
+	return &Adapter{
+		credentials: make(map[string]string),
+	}
+}
+
+// ID returns the source identifier
+func (a *Adapter) ID() string {
+	return SourceID
+}
+
+// Name returns the human-readable source name
+func (a *Adapter) Name() string {
+	return SourceName
+}
+
+// CredentialFields returns the configuration fields
+func (a *Adapter) CredentialFields() []sources.CredentialField {
+	return []sources.CredentialField{
+		{
+			Key:      "feed_url",
+			Label:    "Feed URL",
+			Type:     "text",
+			Required: true,
+			HelpText: "URL of an RSS or Atom feed, a sitemap or a sitemap index",
+		},
+		{
+			Key:      "file_pattern",
+			Label:    "File Name Pattern",
+			Type:     "text",
+			HelpText: "Regular expression linked file names must match, e.g. \\.zip$",
+		},
+		{
+			Key:      "product_name",
+			Label:    "Product Name",
+			Type:     "text",
+			HelpText: "Name shown for the feed (default: the feed URL)",
+		},
+		{
+			Key:      "username",
+			Label:    "Username",
+			Type:     "text",
+			HelpText: "Username for HTTP basic authentication, if required",
+		},
+		{
+			Key:      "password",
+			Label:    "Password",
+			Type:     "password",
+			HelpText: "Password for HTTP basic authentication, if required",
+		},
+	}
+}
+
+// SetCredentials sets the credentials for the adapter
+func (a *Adapter) SetCredentials(creds map[string]string) {
+	a.credentials = creds
+	a.client = nil // Reset client to force re-creation with new credentials
+}
+
+// ValidateCredentials reads the feed
+func (a *Adapter) ValidateCredentials(ctx context.Context) error {
+	_, err := a.items(ctx)
+	return err
+}
+
+// FetchProducts returns the single product holding the feed's entries
+func (a *Adapter) FetchProducts(ctx context.Context) ([]sources.ProductInfo, error) {
+	if _, err := a.getClient(); err != nil {
+		return nil, err
+	}
+
+	feedURL := a.credentials["feed_url"]
+	name := a.credentials["product_name"]
+	if name == "" {
+		name = feedURL
+	}
+
+	return []sources.ProductInfo{{
+		ExternalID:    productID,
+		Name:          name,
+		Description:   "Files announced in " + feedURL,
+		CheckSchedule: "0 6 * * *", // Default: 6 AM daily
+	}}, nil
+}
+
+// FetchDeliveries returns one delivery per feed entry that links to files
+func (a *Adapter) FetchDeliveries(ctx context.Context, productID string) ([]sources.DeliveryInfo, error) {
+	items, err := a.items(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]sources.DeliveryInfo, 0, len(items))
+	for _, it := range items {
+		title := it.title
+		if title == "" {
+			title = it.id
+		}
+		result = append(result, sources.DeliveryInfo{
+			ExternalID:  entryID(it),
+			Name:        title,
+			PublishedAt: it.published,
+		})
+	}
+
+	// Newest first, like the other sources
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].PublishedAt.After(result[j].PublishedAt)
+	})
+
+	return result, nil
+}
+
+// FetchFiles returns the files linked from an entry
+func (a *Adapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]sources.FileInfo, error) {
+	items, err := a.items(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, it := range items {
+		if entryID(it) != deliveryID {
+			continue
+		}
+		result := make([]sources.FileInfo, 0, len(it.links))
+		for _, l := range it.links {
+			name := fileName(l.url)
+			result = append(result, sources.FileInfo{
+				ExternalID:  name,
+				FileName:    name,
+				FileSize:    l.size,
+				DownloadURI: l.url,
+				ReleasedAt:  it.published,
+			})
+		}
+		return result, nil
+	}
+
+	return nil, sources.NewAdapterError(sources.ErrCodeNotFound, "Entry is no longer in the feed", nil)
+}
+
+// DownloadFile downloads a file
+func (a *Adapter) DownloadFile(ctx context.Context, file sources.FileInfo, dst io.Writer, progress sources.ProgressFunc) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(file.DownloadURI, "http://") && !strings.HasPrefix(file.DownloadURI, "https://") {
+		return sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid download URI", nil)
+	}
+
+	return client.Download(ctx, file.DownloadURI, dst, progress)
+}
+
+// items reads the feed, following one level of sitemap index, and keeps the
+// entries that link to at least one file matching the file pattern. Links
+// are resolved against the document they appear in.
+func (a *Adapter) items(ctx context.Context) ([]item, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+	var filter *regexp.Regexp
+	if pattern := a.credentials["file_pattern"]; pattern != "" {
+		if filter, err = regexp.Compile(pattern); err != nil {
+			return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid file name pattern", err)
+		}
+	}
+
+	feedURL := a.credentials["feed_url"]
+	items, sitemaps, err := a.read(ctx, client, feedURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(sitemaps) > maxSitemaps {
+		sitemaps = sitemaps[:maxSitemaps]
+	}
+	for _, sitemap := range sitemaps {
+		children, _, err := a.read(ctx, client, sitemap)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, children...)
+	}
+
+	result := items[:0]
+	for _, it := range items {
+		links := it.links[:0]
+		for _, l := range it.links {
+			name := fileName(l.url)
+			if name == "" || (filter != nil && !filter.MatchString(name)) {
+				continue
+			}
+			links = append(links, l)
+		}
+		if len(links) > 0 {
+			it.links = links
+			result = append(result, it)
+		}
+	}
+	return result, nil
+}
+
+// read fetches and parses one document, resolving its links
+func (a *Adapter) read(ctx context.Context, client *httpdir.Client, docURL string) ([]item, []string, error) {
+	base, err := url.Parse(docURL)
+	if err != nil || base.Host == "" {
+		return nil, nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid feed URL", err)
+	}
+
+	body, err := client.Page(ctx, docURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, sitemaps, err := parse(body)
+	if err != nil {
+		return nil, nil, sources.NewAdapterError(sources.ErrCodeNetwork, "Failed to parse "+docURL, err)
+	}
+
+	for i := range items {
+		links := items[i].links[:0]
+		for _, l := range items[i].links {
+			if ref, err := url.Parse(l.url); err == nil {
+				if target := base.ResolveReference(ref); target.Scheme == "http" || target.Scheme == "https" {
+					l.url = target.String()
+					links = append(links, l)
+				}
+			}
+		}
+		items[i].links = links
+	}
+	for i, s := range sitemaps {
+		if ref, err := url.Parse(s); err == nil {
+			sitemaps[i] = base.ResolveReference(ref).String()
+		}
+	}
+	return items, sitemaps, nil
+}
+
+func (a *Adapter) getClient() (*httpdir.Client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	feedURL := a.credentials["feed_url"]
+	if feedURL == "" {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Missing credentials", nil)
+	}
+
+	client := &httpdir.Client{
+		BaseURL:    feedURL,
+		HTTPClient: sources.NewHTTPClient(SourceID),
+	}
+	if username, password := a.credentials["username"], a.credentials["password"]; username != "" {
+		client.Authorize = func(req *http.Request) error {
+			req.SetBasicAuth(username, password)
+			return nil
+		}
+	}
+
+	a.client = client
+	return a.client, nil
+}
+
+// entryID derives a stable delivery ID from the entry's ID, which in feeds is
+// usually a URL and can't be used in API paths as it is
+func entryID(it item) string {
+	id := it.id
+	if id == "" {
+		id = it.title + "|" + it.published.String()
+	}
+	sum := sha1.Sum([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// fileName returns the last path segment of a URL
+func fileName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || strings.HasSuffix(u.Path, "/") {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,95 @@
+package feed
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const rssDoc = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Releases</title>
+<item><title>Week 11</title><guid>urn:release:11</guid><pubDate>Thu, 13 Mar 2025 08:00:00 +0000</pubDate>
+<enclosure url="/files/week11.zip" length="1024" type="application/zip"/>
+<enclosure url="/files/week11.pdf" length="10" type="application/pdf"/></item>
+<item><title>Week 10</title><link>https://example.org/files/week10.zip</link><pubDate>Thu, 6 Mar 2025 08:00:00 +0000</pubDate></item>
+<item><title>Announcement</title><link>https://example.org/news/</link></item>
+</channel></rss>`
+
+const atomDoc = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<entry><id>tag:example.org,2025:1</id><title>Grants</title><updated>2025-03-14T10:00:00Z</updated>
+<link rel="alternate" href="https://example.org/release/1"/>
+<link rel="enclosure" href="https://example.org/grants.zip" length="5"/></entry>
+</feed>`
+
+const sitemapIndexDoc = `<?xml version="1.0"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>/sitemap-1.xml</loc></sitemap>
+</sitemapindex>`
+
+const sitemapDoc = `<?xml version="1.0"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>https://example.org/bulk/a.zip</loc><lastmod>2025-03-01</lastmod></url>
+</urlset>`
+
+func TestParse(t *testing.T) {
+	items, _, err := parse([]byte(atomDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || len(items[0].links) != 1 || items[0].links[0].url != "https://example.org/grants.zip" {
+		t.Fatalf("Atom items = %+v, want the enclosure only", items)
+	}
+	if want := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC); !items[0].published.Equal(want) {
+		t.Errorf("published = %v, want %v", items[0].published, want)
+	}
+
+	_, sitemaps, err := parse([]byte(sitemapIndexDoc))
+	if err != nil || len(sitemaps) != 1 {
+		t.Errorf("sitemap index = %v, %v; want one child", sitemaps, err)
+	}
+
+	if _, _, err := parse([]byte(`<html></html>`)); err == nil {
+		t.Error("parse() accepted an HTML page")
+	}
+}
+
+func TestAdapter(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed.xml", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(rssDoc)) })
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(sitemapIndexDoc)) })
+	mux.HandleFunc("/sitemap-1.xml", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(sitemapDoc)) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	ctx := context.Background()
+
+	a := New()
+	a.SetCredentials(map[string]string{"feed_url": server.URL + "/feed.xml", "file_pattern": `\.zip$`})
+
+	deliveries, err := a.FetchDeliveries(ctx, productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || deliveries[0].Name != "Week 11" || deliveries[1].Name != "Week 10" {
+		t.Fatalf("FetchDeliveries() = %+v, want Week 11 and Week 10", deliveries)
+	}
+
+	files, err := a.FetchFiles(ctx, productID, deliveries[0].ExternalID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].DownloadURI != server.URL+"/files/week11.zip" || files[0].FileSize != 1024 {
+		t.Errorf("FetchFiles() = %+v, want the resolved zip enclosure", files)
+	}
+
+	a.SetCredentials(map[string]string{"feed_url": server.URL + "/sitemap.xml"})
+	deliveries, err = a.FetchDeliveries(ctx, productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Name != "https://example.org/bulk/a.zip" {
+		t.Errorf("sitemap deliveries = %+v, want the URL from the child sitemap", deliveries)
+	}
+}
@@ -0,0 +1,187 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// item is a feed entry: an RSS item, an Atom entry or a sitemap URL
+type item struct {
+	id        string
+	title     string
+	published time.Time
+	links     []link
+}
+
+// link is a file referenced by an item
+type link struct {
+	url  string
+	size int64
+}
+
+type rssFeed struct {
+	Items []struct {
+		Title      string `xml:"title"`
+		Link       string `xml:"link"`
+		GUID       string `xml:"guid"`
+		PubDate    string `xml:"pubDate"`
+		Enclosures []struct {
+			URL    string `xml:"url,attr"`
+			Length int64  `xml:"length,attr"`
+		} `xml:"enclosure"`
+	} `xml:"channel>item"`
+}
+
+type atomFeed struct {
+	Entries []struct {
+		ID        string `xml:"id"`
+		Title     string `xml:"title"`
+		Updated   string `xml:"updated"`
+		Published string `xml:"published"`
+		Links     []struct {
+			Href   string `xml:"href,attr"`
+			Rel    string `xml:"rel,attr"`
+			Length int64  `xml:"length,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+type urlSet struct {
+	URLs []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"url"`
+}
+
+type sitemapIndex struct {
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// parse reads an RSS, Atom or sitemap document. For a sitemap index it
+// returns the URLs of the child sitemaps instead of items.
+func parse(body []byte) (items []item, sitemaps []string, err error) {
+	root, err := rootElement(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch root {
+	case "rss":
+		var feed rssFeed
+		if err := xml.Unmarshal(body, &feed); err != nil {
+			return nil, nil, err
+		}
+		for _, i := range feed.Items {
+			it := item{id: i.GUID, title: i.Title, published: parseDate(i.PubDate)}
+			for _, e := range i.Enclosures {
+				it.links = append(it.links, link{url: strings.TrimSpace(e.URL), size: e.Length})
+			}
+			if len(it.links) == 0 && i.Link != "" {
+				it.links = append(it.links, link{url: strings.TrimSpace(i.Link)})
+			}
+			if it.id == "" {
+				it.id = i.Link
+			}
+			items = append(items, it)
+		}
+
+	case "feed":
+		var feed atomFeed
+		if err := xml.Unmarshal(body, &feed); err != nil {
+			return nil, nil, err
+		}
+		for _, e := range feed.Entries {
+			it := item{id: e.ID, title: e.Title, published: parseDate(e.Published)}
+			if it.published.IsZero() {
+				it.published = parseDate(e.Updated)
+			}
+			var alternate []link
+			for _, l := range e.Links {
+				switch l.Rel {
+				case "enclosure":
+					it.links = append(it.links, link{url: strings.TrimSpace(l.Href), size: l.Length})
+				case "", "alternate":
+					alternate = append(alternate, link{url: strings.TrimSpace(l.Href)})
+				}
+			}
+			if len(it.links) == 0 {
+				it.links = alternate
+			}
+			items = append(items, it)
+		}
+
+	case "urlset":
+		var set urlSet
+		if err := xml.Unmarshal(body, &set); err != nil {
+			return nil, nil, err
+		}
+		for _, u := range set.URLs {
+			loc := strings.TrimSpace(u.Loc)
+			items = append(items, item{
+				id:        loc,
+				title:     loc,
+				published: parseDate(u.LastMod),
+				links:     []link{{url: loc}},
+			})
+		}
+
+	case "sitemapindex":
+		var index sitemapIndex
+		if err := xml.Unmarshal(body, &index); err != nil {
+			return nil, nil, err
+		}
+		for _, s := range index.Sitemaps {
+			sitemaps = append(sitemaps, strings.TrimSpace(s.Loc))
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported document <%s>; expected RSS, Atom or a sitemap", root)
+	}
+
+	return items, sitemaps, nil
+}
+
+// rootElement returns the local name of the document's root element
+func rootElement(body []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return "", fmt.Errorf("empty document")
+		}
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02T15:04-07:00",
+	"2006-01-02",
+}
+
+// parseDate parses RSS (RFC 822), Atom (RFC 3339) and sitemap (W3C) dates
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,326 @@
+// Package ftp is a source adapter for bulk data distributed over FTP or FTPS
+package ftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+const (
+	SourceID   = "ftp"
+	SourceName = "FTP"
+)
+
+// Adapter implements the sources.Adapter interface for FTP servers. Each
+// configured path is a product, its subdirectories are deliveries and the
+// files in them are downloaded. HTTP proxies don't apply to FTP.
+type Adapter struct {
+	credentials map[string]string
+}
+
+// New creates a new FTP adapter
+func New() *Adapter {
+	return &Adapter{
+		credentials: make(map[string]string),
+	}
+}
+
+// ID returns the source identifier
+func (a *Adapter) ID() string {
+	return SourceID
+}
+
+// Name returns the human-readable source name
+func (a *Adapter) Name() string {
+	return SourceName
+}
+
+// CredentialFields returns the required credential fields
+func (a *Adapter) CredentialFields() []sources.CredentialField {
+	return []sources.CredentialField{
+		{
+			Key:      "host",
+			Label:    "Host",
+			Type:     "text",
+			Required: true,
+			HelpText: "Server name, optionally with port, e.g. ftp.example.org:21",
+		},
+		{
+			Key:      "username",
+			Label:    "Username",
+			Type:     "text",
+			HelpText: "Leave empty for anonymous access",
+		},
+		{
+			Key:   "password",
+			Label: "Password",
+			Type:  "password",
+		},
+		{
+			Key:      "tls",
+			Label:    "TLS",
+			Type:     "text",
+			HelpText: "none (default), explicit (AUTH TLS) or implicit (FTPS, usually port 990)",
+		},
+		{
+			Key:      "paths",
+			Label:    "Paths",
+			Type:     "text",
+			HelpText: "Comma-separated directories whose subdirectories are deliveries (default: /)",
+		},
+	}
+}
+
+// SetCredentials sets the credentials for the adapter
+func (a *Adapter) SetCredentials(creds map[string]string) {
+	a.credentials = creds
+}
+
+// ValidateCredentials logs in and lists the configured paths
+func (a *Adapter) ValidateCredentials(ctx context.Context) error {
+	c, err := a.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for _, p := range a.paths() {
+		if _, err := c.list(ctx, p); err != nil {
+			return wrapError("Failed to list "+p, err)
+		}
+	}
+	return nil
+}
+
+// FetchProducts returns one product per configured path
+func (a *Adapter) FetchProducts(ctx context.Context) ([]sources.ProductInfo, error) {
+	if _, err := a.dialConfig(); err != nil {
+		return nil, err
+	}
+
+	host := a.credentials["host"]
+	var result []sources.ProductInfo
+	for _, p := range a.paths() {
+		result = append(result, sources.ProductInfo{
+			ExternalID:    productID(p),
+			Name:          host + p,
+			Description:   "Files below ftp://" + host + p,
+			CheckSchedule: "0 6 * * *", // Default: 6 AM daily
+		})
+	}
+	return result, nil
+}
+
+// FetchDeliveries lists the subdirectories of a product's path
+func (a *Adapter) FetchDeliveries(ctx context.Context, productID string) ([]sources.DeliveryInfo, error) {
+	dir, err := a.productPath(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := a.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	entries, err := c.list(ctx, dir)
+	if err != nil {
+		return nil, wrapError("Failed to list deliveries", err)
+	}
+
+	var result []sources.DeliveryInfo
+	for _, e := range entries {
+		if !e.dir {
+			continue
+		}
+		result = append(result, sources.DeliveryInfo{
+			ExternalID:  e.name,
+			Name:        e.name,
+			PublishedAt: e.modified,
+		})
+	}
+
+	// Newest first, like the other sources
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ExternalID > result[j].ExternalID
+	})
+
+	return result, nil
+}
+
+// FetchFiles lists the files of a delivery directory
+func (a *Adapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]sources.FileInfo, error) {
+	root, err := a.productPath(productID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(deliveryID, "/") || deliveryID == ".." {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid delivery ID", nil)
+	}
+	dir := path.Join(root, deliveryID)
+
+	c, err := a.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	entries, err := c.list(ctx, dir)
+	if err != nil {
+		return nil, wrapError("Failed to list files", err)
+	}
+
+	var result []sources.FileInfo
+	for _, e := range entries {
+		if e.dir {
+			continue
+		}
+		result = append(result, sources.FileInfo{
+			ExternalID:  e.name,
+			FileName:    e.name,
+			FileSize:    e.size,
+			DownloadURI: path.Join(dir, e.name),
+			ReleasedAt:  e.modified,
+		})
+	}
+
+	return result, nil
+}
+
+// DownloadFile downloads a file, reporting progress against its listed size
+func (a *Adapter) DownloadFile(ctx context.Context, file sources.FileInfo, dst io.Writer, progress sources.ProgressFunc) error {
+	if !strings.HasPrefix(file.DownloadURI, "/") || strings.Contains(file.DownloadURI, "..") {
+		return sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid download URI", nil)
+	}
+
+	c, err := a.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if progress != nil {
+		dst = &progressWriter{w: dst, total: file.FileSize, progress: progress}
+	}
+	if err := c.retrieve(ctx, file.DownloadURI, dst); err != nil {
+		return wrapError("Download failed", err)
+	}
+	return nil
+}
+
+func (a *Adapter) connect(ctx context.Context) (*conn, error) {
+	cfg, err := a.dialConfig()
+	if err != nil {
+		return nil, err
+	}
+	c, err := dial(ctx, cfg)
+	if err != nil {
+		return nil, wrapError("Failed to connect to "+cfg.addr, err)
+	}
+	return c, nil
+}
+
+func (a *Adapter) dialConfig() (dialConfig, error) {
+	host := a.credentials["host"]
+	if host == "" {
+		return dialConfig{}, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Missing credentials", nil)
+	}
+
+	tlsMode := strings.ToLower(a.credentials["tls"])
+	port := "21"
+	switch tlsMode {
+	case "", TLSNone:
+		tlsMode = TLSNone
+	case TLSExplicit:
+	case TLSImplicit:
+		port = "990"
+	default:
+		return dialConfig{}, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "TLS must be none, explicit or implicit", nil)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, port)
+	}
+
+	return dialConfig{
+		addr:     host,
+		username: a.credentials["username"],
+		password: a.credentials["password"],
+		tlsMode:  tlsMode,
+	}, nil
+}
+
+// paths returns the configured directories as clean absolute paths
+func (a *Adapter) paths() []string {
+	var paths []string
+	for _, p := range strings.Split(a.credentials["paths"], ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, path.Clean("/"+p))
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+	return paths
+}
+
+// productPath maps a product ID back to its configured path
+func (a *Adapter) productPath(id string) (string, error) {
+	for _, p := range a.paths() {
+		if productID(p) == id {
+			return p, nil
+		}
+	}
+	return "", sources.NewAdapterError(sources.ErrCodeNotFound, "Path is no longer configured", nil)
+}
+
+// productID derives a product ID from a path. IDs can't contain slashes,
+// which would break API paths.
+func productID(p string) string {
+	if p == "/" {
+		return "root"
+	}
+	return strings.ReplaceAll(strings.Trim(p, "/"), "/", "_")
+}
+
+// wrapError classifies FTP errors
+func wrapError(message string, err error) error {
+	var authErr *authError
+	if errors.As(err, &authErr) {
+		return sources.NewAdapterError(sources.ErrCodeAuth, "Login failed", err)
+	}
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		switch protoErr.Code {
+		case 530:
+			return sources.NewAdapterError(sources.ErrCodeAuth, message, err)
+		case 550:
+			return sources.NewAdapterError(sources.ErrCodeNotFound, message, err)
+		case 421:
+			return sources.NewAdapterError(sources.ErrCodeRateLimit, message, err)
+		}
+	}
+	return sources.NewAdapterError(sources.ErrCodeNetwork, message, err)
+}
+
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress sources.ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.progress(p.written, p.total)
+	return n, err
+}
@@ -0,0 +1,187 @@
+package ftp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseList(t *testing.T) {
+	now := time.Date(2025, 3, 20, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		line string
+		want entry
+		ok   bool
+	}{
+		{"-rw-r--r--   1 ftp  ftp   1024 Mar 14 08:00 CN A.zip", entry{name: "CN A.zip", size: 1024, modified: time.Date(2025, 3, 14, 8, 0, 0, 0, time.UTC)}, true},
+		{"drwxr-xr-x   2 ftp  ftp   4096 Dec 30  2024 2024-52", entry{name: "2024-52", dir: true, size: 4096, modified: time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC)}, true},
+		{"-rw-r--r--   1 ftp  ftp   10 Dec 30 08:00 old.zip", entry{name: "old.zip", size: 10, modified: time.Date(2024, 12, 30, 8, 0, 0, 0, time.UTC)}, true},
+		{"lrwxrwxrwx   1 ftp  ftp   10 Mar 14 08:00 link -> target", entry{}, false},
+		{"total 12", entry{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseList(tt.line, now)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseList(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseMLSD(t *testing.T) {
+	got, ok := parseMLSD("type=file;size=1024;modify=20250314080000.123; CN A.zip", time.Time{})
+	want := entry{name: "CN A.zip", size: 1024, modified: time.Date(2025, 3, 14, 8, 0, 0, 0, time.UTC)}
+	if !ok || got != want {
+		t.Errorf("parseMLSD() = %+v, %v; want %+v", got, ok, want)
+	}
+	if _, ok := parseMLSD("type=cdir;modify=20250314080000; /pub", time.Time{}); ok {
+		t.Error("parseMLSD() accepted the current directory")
+	}
+}
+
+// fakeServer is a minimal FTP server supporting the commands the client uses
+func fakeServer(t *testing.T, files map[string]string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			control, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFTP(control, files)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveFTP(control net.Conn, files map[string]string) {
+	defer control.Close()
+	reply := func(format string, args ...any) { fmt.Fprintf(control, format+"\r\n", args...) }
+	reply("220 ready")
+
+	var data net.Listener
+	r := bufio.NewReader(control)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch cmd {
+		case "USER":
+			reply("331 password required")
+		case "PASS":
+			if arg != "secret" {
+				reply("530 login incorrect")
+				continue
+			}
+			reply("230 logged in")
+		case "TYPE":
+			reply("200 ok")
+		case "EPSV":
+			data, _ = net.Listen("tcp", "127.0.0.1:0")
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "MLSD", "RETR":
+			conn, err := data.Accept()
+			data.Close()
+			if err != nil {
+				return
+			}
+			var body string
+			if cmd == "MLSD" {
+				for name, content := range files {
+					if dir, file, _ := strings.Cut(name, "|"); dir == arg {
+						body += fmt.Sprintf("type=file;size=%d;modify=20250314080000; %s\r\n", len(content), file)
+					}
+				}
+				if arg == "/pub" {
+					body = "type=cdir; /pub\r\ntype=dir;modify=20250314080000; 2025-11\r\n"
+				}
+				if arg == "/huge" {
+					body = strings.Repeat("type=file;size=1; x.zip\r\n", maxListingSize/24+1)
+				}
+			} else {
+				body = files[strings.Replace(arg, "/pub/2025-11/", "/pub/2025-11|", 1)]
+			}
+			reply("150 opening data connection")
+			conn.Write([]byte(body))
+			conn.Close()
+			reply("226 transfer complete")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestAdapter(t *testing.T) {
+	addr := fakeServer(t, map[string]string{
+		"/pub/2025-11|data.zip":         "zip content",
+		"/pub/2025-11|sub/..":           "unsafe",
+		`/pub/2025-11|a\..\..\evil.zip`: "unsafe",
+	})
+
+	a := New()
+	a.SetCredentials(map[string]string{"host": addr, "username": "user", "password": "secret", "paths": "pub"})
+	ctx := context.Background()
+
+	if err := a.ValidateCredentials(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	products, err := a.FetchProducts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 || products[0].ExternalID != "pub" {
+		t.Fatalf("FetchProducts() = %+v, want product pub", products)
+	}
+
+	deliveries, err := a.FetchDeliveries(ctx, "pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].ExternalID != "2025-11" {
+		t.Fatalf("FetchDeliveries() = %+v, want delivery 2025-11", deliveries)
+	}
+
+	files, err := a.FetchFiles(ctx, "pub", "2025-11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].DownloadURI != "/pub/2025-11/data.zip" || files[0].FileSize != 11 {
+		t.Fatalf("FetchFiles() = %+v", files)
+	}
+
+	var buf bytes.Buffer
+	var written int64
+	if err := a.DownloadFile(ctx, files[0], &buf, func(n, _ int64) { written = n }); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "zip content" || written != 11 {
+		t.Errorf("DownloadFile() wrote %q, progress %d", buf.String(), written)
+	}
+
+	a.SetCredentials(map[string]string{"host": addr, "username": "user", "password": "secret", "paths": "huge"})
+	if _, err := a.FetchDeliveries(ctx, "huge"); err == nil {
+		t.Error("FetchDeliveries() of an oversized listing succeeded")
+	}
+
+	a.SetCredentials(map[string]string{"host": addr, "username": "user", "password": "wrong"})
+	if err := a.ValidateCredentials(ctx); err == nil {
+		t.Error("ValidateCredentials() with a wrong password succeeded")
+	}
+}
@@ -0,0 +1,374 @@
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+// TLS modes
+const (
+	TLSNone     = "none"
+	TLSExplicit = "explicit" // AUTH TLS on the plain port
+	TLSImplicit = "implicit" // TLS from the first byte, usually port 990
+)
+
+const dialTimeout = 30 * time.Second
+
+// maxListingSize limits how much of a directory listing is read
+const maxListingSize = 16 << 20
+
+// entry is a file or directory in a listing
+type entry struct {
+	name     string
+	dir      bool
+	size     int64
+	modified time.Time
+}
+
+// conn is a logged-in FTP control connection. It isn't safe for concurrent
+// use; the adapter opens one per operation.
+type conn struct {
+	raw       net.Conn
+	text      *textproto.Conn
+	host      string
+	tlsConfig *tls.Config
+	// stop cancels the deadline set when the operation's context ends
+	stop func() bool
+}
+
+type dialConfig struct {
+	addr     string // host:port
+	username string
+	password string
+	tlsMode  string
+}
+
+// dial connects, negotiates TLS if configured and logs in
+func dial(ctx context.Context, cfg dialConfig) (*conn, error) {
+	host, _, err := net.SplitHostPort(cfg.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	raw, err := dialer.DialContext(ctx, "tcp", cfg.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{raw: raw, host: host}
+	// Deadlines on the TCP connection also interrupt TLS wrapped around it
+	c.stop = context.AfterFunc(ctx, func() { raw.SetDeadline(time.Now()) })
+	if cfg.tlsMode != TLSNone {
+		c.tlsConfig = &tls.Config{
+			ServerName: host,
+			MinVersion: tls.VersionTLS12,
+			// Many servers require data connections to resume the control
+			// connection's TLS session
+			ClientSessionCache: tls.NewLRUClientSessionCache(4),
+		}
+	}
+	if cfg.tlsMode == TLSImplicit {
+		c.raw = tls.Client(raw, c.tlsConfig)
+	}
+	c.text = textproto.NewConn(c.raw)
+
+	if err := c.setup(cfg); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *conn) setup(cfg dialConfig) error {
+	if _, _, err := c.text.ReadResponse(220); err != nil {
+		return err
+	}
+
+	if cfg.tlsMode == TLSExplicit {
+		if _, err := c.cmd(234, "AUTH TLS"); err != nil {
+			return err
+		}
+		c.raw = tls.Client(c.raw, c.tlsConfig)
+		c.text = textproto.NewConn(c.raw)
+	}
+
+	username := cfg.username
+	if username == "" {
+		username = "anonymous"
+	}
+	code, _, err := c.cmdAny("USER %s", username)
+	if err != nil {
+		return err
+	}
+	switch code {
+	case 230:
+	case 331, 332:
+		if _, err := c.cmd(230, "PASS %s", cfg.password); err != nil {
+			return &authError{err}
+		}
+	default:
+		return &authError{fmt.Errorf("USER: unexpected response %d", code)}
+	}
+
+	if c.tlsConfig != nil {
+		if _, err := c.cmd(200, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, err := c.cmd(200, "PROT P"); err != nil {
+			return err
+		}
+	}
+	_, err = c.cmd(200, "TYPE I")
+	return err
+}
+
+// Close ends the session
+func (c *conn) Close() error {
+	c.stop()
+	c.cmdAny("QUIT")
+	return c.text.Close()
+}
+
+// cmd sends a command and expects a response with the given code
+func (c *conn) cmd(expect int, format string, args ...any) (string, error) {
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		return "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+	_, msg, err := c.text.ReadResponse(expect)
+	return msg, err
+}
+
+// cmdAny sends a command and returns whatever response code the server sent
+func (c *conn) cmdAny(format string, args ...any) (int, string, error) {
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+	return c.text.ReadResponse(0)
+}
+
+var pasvRegex = regexp.MustCompile(`(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+
+// openData opens a passive data connection, preferring EPSV. The address
+// the server reports for PASV is ignored in favour of the control
+// connection's host, since servers behind NAT often report a private one.
+func (c *conn) openData(ctx context.Context) (net.Conn, error) {
+	var port int
+	if code, msg, err := c.cmdAny("EPSV"); err != nil {
+		return nil, err
+	} else if code == 229 {
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start < 0 || end < start+4 {
+			return nil, fmt.Errorf("EPSV: malformed response %q", msg)
+		}
+		if port, err = strconv.Atoi(msg[start+4 : end]); err != nil {
+			return nil, fmt.Errorf("EPSV: malformed response %q", msg)
+		}
+	} else {
+		msg, err := c.cmd(227, "PASV")
+		if err != nil {
+			return nil, err
+		}
+		m := pasvRegex.FindStringSubmatch(msg)
+		if m == nil {
+			return nil, fmt.Errorf("PASV: malformed response %q", msg)
+		}
+		p1, _ := strconv.Atoi(m[5])
+		p2, _ := strconv.Atoi(m[6])
+		port = p1<<8 | p2
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	data, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	if c.tlsConfig != nil {
+		data = tls.Client(data, c.tlsConfig)
+	}
+	return data, nil
+}
+
+// transfer opens a data connection and sends a command that uses it. The
+// caller reads the data connection and then calls finish.
+func (c *conn) transfer(ctx context.Context, format string, args ...any) (net.Conn, error) {
+	data, err := c.openData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	code, msg, err := c.cmdAny(format, args...)
+	if err == nil && code != 125 && code != 150 {
+		err = &textproto.Error{Code: code, Msg: msg}
+	}
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { data.SetDeadline(time.Now()) })
+	return &dataConn{Conn: data, stop: stop}, nil
+}
+
+// finish closes the data connection and reads the transfer result. Servers
+// answer 226 or 250.
+func (c *conn) finish(data net.Conn) error {
+	data.Close()
+	_, _, err := c.text.ReadResponse(2)
+	return err
+}
+
+type dataConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (d *dataConn) Close() error {
+	d.stop()
+	return d.Conn.Close()
+}
+
+// list returns the entries of dir, using MLSD where the server supports it
+// and parsing Unix-style LIST output otherwise
+func (c *conn) list(ctx context.Context, dir string) ([]entry, error) {
+	parse := parseMLSD
+	data, err := c.transfer(ctx, "MLSD %s", dir)
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && (protoErr.Code == 500 || protoErr.Code == 501 || protoErr.Code == 502) {
+		parse = parseList
+		data, err = c.transfer(ctx, "LIST %s", dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(data, maxListingSize+1))
+	if err == nil && len(body) > maxListingSize {
+		err = fmt.Errorf("listing of %s exceeds %d bytes", dir, maxListingSize)
+	}
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	if err := c.finish(data); err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimRight(line, "\r")
+		// Names end up in download paths; "sub/.." would become ".."
+		if e, ok := parse(line, time.Now().UTC()); ok {
+			e.name = path.Base(e.name)
+			if sources.CheckName(e.name) == nil {
+				entries = append(entries, e)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// retrieve copies the file at name to dst
+func (c *conn) retrieve(ctx context.Context, name string, dst io.Writer) error {
+	data, err := c.transfer(ctx, "RETR %s", name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, data); err != nil {
+		data.Close()
+		return err
+	}
+	return c.finish(data)
+}
+
+// parseMLSD parses a machine-readable listing line such as
+// "type=file;size=1024;modify=20250314080000; CN-A.zip"
+func parseMLSD(line string, _ time.Time) (entry, bool) {
+	facts, name, ok := strings.Cut(line, " ")
+	if !ok || name == "" {
+		return entry{}, false
+	}
+	e := entry{name: name}
+	for _, fact := range strings.Split(facts, ";") {
+		key, value, _ := strings.Cut(fact, "=")
+		switch strings.ToLower(key) {
+		case "type":
+			switch strings.ToLower(value) {
+			case "dir":
+				e.dir = true
+			case "file":
+			default: // cdir, pdir and links
+				return entry{}, false
+			}
+		case "size":
+			e.size, _ = strconv.ParseInt(value, 10, 64)
+		case "modify":
+			if t, err := time.Parse("20060102150405", strings.SplitN(value, ".", 2)[0]); err == nil {
+				e.modified = t
+			}
+		}
+	}
+	return e, true
+}
+
+// parseList parses a Unix-style LIST line such as
+// "-rw-r--r-- 1 ftp ftp 1024 Mar 14 08:00 CN-A.zip". Dates without a year
+// are in the last twelve months.
+func parseList(line string, now time.Time) (entry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 9 || (line[0] != '-' && line[0] != 'd') {
+		return entry{}, false
+	}
+
+	e := entry{dir: line[0] == 'd'}
+	e.size, _ = strconv.ParseInt(fields[4], 10, 64)
+
+	// The name is everything after the eighth field, spaces included
+	rest := line
+	for i := 0; i < 8; i++ {
+		rest = strings.TrimLeft(rest, " ")
+		rest = rest[strings.Index(rest, fields[i])+len(fields[i]):]
+	}
+	e.name = strings.TrimLeft(rest, " ")
+
+	stamp := fields[5] + " " + fields[6] + " " + fields[7]
+	if t, err := time.Parse("Jan 2 2006", stamp); err == nil {
+		e.modified = t
+	} else if t, err := time.Parse("Jan 2 15:04", stamp); err == nil {
+		t = t.AddDate(now.Year(), 0, 0)
+		if t.After(now.AddDate(0, 0, 1)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		e.modified = t
+	}
+	return e, e.name != ""
+}
+
+// authError marks a rejected login
+type authError struct {
+	err error
+}
+
+func (e *authError) Error() string {
+	return "login failed: " + e.err.Error()
+}
+
+func (e *authError) Unwrap() error {
+	return e.err
+}
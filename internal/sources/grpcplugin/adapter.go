@@ -0,0 +1,287 @@
+// Package grpcplugin connects to source adapters that run as separate gRPC
+// services implementing api/proto/sourceplugin/v1. Such plugins are built,
+// versioned and deployed on their own, and a crashing plugin only fails the
+// calls to its source; the connection recovers when it is back.
+package grpcplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/patent-dev/bulk-file-loader/api/generated/sourcepluginv1"
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+// describeTimeout limits how long loading waits for a plugin to answer
+const describeTimeout = 10 * time.Second
+
+// Adapter implements the sources.Adapter interface by calling a plugin
+type Adapter struct {
+	conn        *grpc.ClientConn
+	client      pb.SourcePluginClient
+	desc        *pb.DescribeResponse
+	credentials map[string]string
+}
+
+// Dial connects to the plugin at target ("host:port" or
+// "unix:///path/to.sock") and asks for its description
+func Dial(ctx context.Context, target string) (*Adapter, error) {
+	// Plugins run next to the loader, so the connection is neither encrypted
+	// nor sent through the outgoing proxy
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithNoProxy())
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Adapter{
+		conn:        conn,
+		client:      pb.NewSourcePluginClient(conn),
+		credentials: make(map[string]string),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, describeTimeout)
+	defer cancel()
+	a.desc, err = a.client.Describe(ctx, &pb.DescribeRequest{}, grpc.WaitForReady(true))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("describe: %w", err)
+	}
+	if id := a.desc.GetId(); id == "" || strings.ContainsAny(id, "/: ") {
+		conn.Close()
+		return nil, fmt.Errorf("invalid source ID %q", id)
+	}
+	return a, nil
+}
+
+// Load connects to each target and registers the plugins. Plugins that can't
+// be reached or reuse a registered source ID are skipped with a warning.
+func Load(ctx context.Context, registry *sources.Registry, targets []string) {
+	for _, target := range targets {
+		a, err := Dial(ctx, target)
+		if err != nil {
+			slog.Warn("Skipping gRPC source plugin", "target", target, "error", err)
+			continue
+		}
+		if _, exists := registry.Get(a.ID()); exists {
+			slog.Warn("Skipping gRPC source plugin with duplicate ID", "target", target, "id", a.ID())
+			a.Close()
+			continue
+		}
+
+		registry.Register(a)
+		slog.Info("Loaded gRPC source plugin", "target", target, "id", a.ID(), "version", a.desc.GetVersion())
+	}
+}
+
+// Close closes the connection to the plugin
+func (a *Adapter) Close() error {
+	return a.conn.Close()
+}
+
+// ID returns the source identifier
+func (a *Adapter) ID() string {
+	return a.desc.GetId()
+}
+
+// Name returns the human-readable source name
+func (a *Adapter) Name() string {
+	if name := a.desc.GetName(); name != "" {
+		return name
+	}
+	return a.desc.GetId()
+}
+
+// CredentialFields returns the credential fields the plugin described
+func (a *Adapter) CredentialFields() []sources.CredentialField {
+	fields := make([]sources.CredentialField, 0, len(a.desc.GetCredentialFields()))
+	for _, f := range a.desc.GetCredentialFields() {
+		fields = append(fields, sources.CredentialField{
+			Key:      f.GetKey(),
+			Label:    f.GetLabel(),
+			Type:     f.GetType(),
+			Required: f.GetRequired(),
+			HelpText: f.GetHelpText(),
+
+			ExpiresAfterDays: int(f.GetExpiresAfterDays()),
+		})
+	}
+	return fields
+}
+
+// SetCredentials sets the credentials sent with each call
+func (a *Adapter) SetCredentials(creds map[string]string) {
+	a.credentials = creds
+}
+
+// ValidateCredentials asks the plugin to check its credentials
+func (a *Adapter) ValidateCredentials(ctx context.Context) error {
+	_, err := a.client.ValidateCredentials(ctx, &pb.ValidateCredentialsRequest{Credentials: a.credentials})
+	return convertError(err)
+}
+
+// FetchProducts asks the plugin for its products
+func (a *Adapter) FetchProducts(ctx context.Context) ([]sources.ProductInfo, error) {
+	resp, err := a.client.FetchProducts(ctx, &pb.FetchProductsRequest{Credentials: a.credentials})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	result := make([]sources.ProductInfo, 0, len(resp.GetProducts()))
+	for _, p := range resp.GetProducts() {
+		if err := sources.CheckName(p.GetExternalId()); err != nil {
+			return nil, fmt.Errorf("product: %w", err)
+		}
+		result = append(result, sources.ProductInfo{
+			ExternalID:    p.GetExternalId(),
+			Name:          p.GetName(),
+			Description:   p.GetDescription(),
+			CheckSchedule: p.GetCheckSchedule(),
+		})
+	}
+	return result, nil
+}
+
+// FetchDeliveries asks the plugin for the deliveries of a product
+func (a *Adapter) FetchDeliveries(ctx context.Context, productID string) ([]sources.DeliveryInfo, error) {
+	resp, err := a.client.FetchDeliveries(ctx, &pb.FetchDeliveriesRequest{Credentials: a.credentials, ProductId: productID})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	result := make([]sources.DeliveryInfo, 0, len(resp.GetDeliveries()))
+	for _, d := range resp.GetDeliveries() {
+		if err := sources.CheckName(d.GetExternalId()); err != nil {
+			return nil, fmt.Errorf("delivery: %w", err)
+		}
+		info := sources.DeliveryInfo{
+			ExternalID:  d.GetExternalId(),
+			Name:        d.GetName(),
+			PublishedAt: timeOf(d.GetPublishedAt()),
+		}
+		if d.GetExpiresAt() != nil {
+			expires := d.GetExpiresAt().AsTime()
+			info.ExpiresAt = &expires
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// FetchFiles asks the plugin for the files of a delivery
+func (a *Adapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]sources.FileInfo, error) {
+	resp, err := a.client.FetchFiles(ctx, &pb.FetchFilesRequest{Credentials: a.credentials, ProductId: productID, DeliveryId: deliveryID})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	result := make([]sources.FileInfo, 0, len(resp.GetFiles()))
+	for _, f := range resp.GetFiles() {
+		// Names from a remote plugin end up in download paths
+		if err := errors.Join(sources.CheckName(f.GetExternalId()), sources.CheckName(f.GetFileName())); err != nil {
+			return nil, fmt.Errorf("file: %w", err)
+		}
+		result = append(result, sources.FileInfo{
+			ExternalID:        f.GetExternalId(),
+			FileName:          f.GetFileName(),
+			FileSize:          f.GetFileSize(),
+			Checksum:          f.GetChecksum(),
+			ChecksumAlgorithm: f.GetChecksumAlgorithm(),
+			DownloadURI:       f.GetDownloadUri(),
+			ReleasedAt:        timeOf(f.GetReleasedAt()),
+		})
+	}
+	return result, nil
+}
+
+// DownloadFile writes the chunks streamed by the plugin
+func (a *Adapter) DownloadFile(ctx context.Context, file sources.FileInfo, dst io.Writer, progress sources.ProgressFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Ends the stream if writing fails
+	stream, err := a.client.DownloadFile(ctx, &pb.DownloadFileRequest{Credentials: a.credentials, File: convertFile(file)})
+	if err != nil {
+		return convertError(err)
+	}
+
+	var written int64
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return convertError(err)
+		}
+		if _, err := dst.Write(chunk.GetData()); err != nil {
+			return err
+		}
+		written += int64(len(chunk.GetData()))
+		if progress != nil {
+			progress(written, file.FileSize)
+		}
+	}
+}
+
+func convertFile(f sources.FileInfo) *pb.File {
+	result := &pb.File{
+		ExternalId:        f.ExternalID,
+		FileName:          f.FileName,
+		FileSize:          f.FileSize,
+		Checksum:          f.Checksum,
+		ChecksumAlgorithm: f.ChecksumAlgorithm,
+		DownloadUri:       f.DownloadURI,
+	}
+	if !f.ReleasedAt.IsZero() {
+		result.ReleasedAt = timestamppb.New(f.ReleasedAt)
+	}
+	return result
+}
+
+// timeOf converts an optional timestamp, leaving unset ones zero
+func timeOf(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+// convertError maps gRPC status codes to adapter error codes
+func convertError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return sources.NewAdapterError(sources.ErrCodeNetwork, "Plugin call failed", err)
+	}
+
+	code := sources.ErrCodeNetwork
+	switch s.Code() {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		code = sources.ErrCodeAuth
+	case codes.NotFound:
+		code = sources.ErrCodeNotFound
+	case codes.ResourceExhausted:
+		code = sources.ErrCodeRateLimit
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		code = sources.ErrCodeInvalidConfig
+	case codes.Canceled:
+		return context.Canceled
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	}
+	return sources.NewAdapterError(code, s.Message(), nil)
+}
@@ -0,0 +1,116 @@
+package grpcplugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/patent-dev/bulk-file-loader/api/generated/sourcepluginv1"
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+type testPlugin struct {
+	pb.UnimplementedSourcePluginServer
+}
+
+func (testPlugin) Describe(context.Context, *pb.DescribeRequest) (*pb.DescribeResponse, error) {
+	return &pb.DescribeResponse{
+		Id:               "example",
+		Name:             "Example Office",
+		Version:          "1.2.0",
+		CredentialFields: []*pb.CredentialField{{Key: "token", Label: "Token", Type: "password", Required: true}},
+	}, nil
+}
+
+func (testPlugin) ValidateCredentials(_ context.Context, req *pb.ValidateCredentialsRequest) (*pb.ValidateCredentialsResponse, error) {
+	if req.GetCredentials()["token"] != "good" {
+		return nil, status.Error(codes.Unauthenticated, "bad token")
+	}
+	return &pb.ValidateCredentialsResponse{}, nil
+}
+
+func (testPlugin) FetchFiles(_ context.Context, req *pb.FetchFilesRequest) (*pb.FetchFilesResponse, error) {
+	switch req.GetDeliveryId() {
+	case "2025-11":
+	case "2025-12":
+		return &pb.FetchFilesResponse{Files: []*pb.File{{ExternalId: "b", FileName: "../../b.zip", DownloadUri: "b.zip"}}}, nil
+	default:
+		return nil, status.Error(codes.NotFound, "no such delivery")
+	}
+	return &pb.FetchFilesResponse{Files: []*pb.File{{ExternalId: "a", FileName: "a.zip", FileSize: 5, DownloadUri: "a.zip"}}}, nil
+}
+
+func (testPlugin) DownloadFile(req *pb.DownloadFileRequest, stream grpc.ServerStreamingServer[pb.DownloadFileChunk]) error {
+	for _, part := range []string{"hel", "lo"} {
+		if err := stream.Send(&pb.DownloadFileChunk{Data: []byte(part)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startPlugin(t *testing.T) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterSourcePluginServer(server, testPlugin{})
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return "unix://" + socket
+}
+
+func TestAdapter(t *testing.T) {
+	ctx := context.Background()
+	a, err := Dial(ctx, startPlugin(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if a.ID() != "example" || a.Name() != "Example Office" || len(a.CredentialFields()) != 1 || !a.CredentialFields()[0].Required {
+		t.Errorf("description = %s %s %+v", a.ID(), a.Name(), a.CredentialFields())
+	}
+
+	var adapterErr *sources.AdapterError
+	a.SetCredentials(map[string]string{"token": "bad"})
+	if err := a.ValidateCredentials(ctx); !errors.As(err, &adapterErr) || adapterErr.Code != sources.ErrCodeAuth {
+		t.Errorf("ValidateCredentials() = %v, want an auth error", err)
+	}
+	a.SetCredentials(map[string]string{"token": "good"})
+	if err := a.ValidateCredentials(ctx); err != nil {
+		t.Errorf("ValidateCredentials() = %v", err)
+	}
+
+	if _, err := a.FetchFiles(ctx, "grants", "2024-01"); !errors.As(err, &adapterErr) || adapterErr.Code != sources.ErrCodeNotFound {
+		t.Errorf("FetchFiles() for a missing delivery = %v, want not found", err)
+	}
+	if _, err := a.FetchFiles(ctx, "grants", "2025-12"); !errors.Is(err, sources.ErrUnsafeName) {
+		t.Errorf("FetchFiles() with a name outside the directory = %v, want ErrUnsafeName", err)
+	}
+	files, err := a.FetchFiles(ctx, "grants", "2025-11")
+	if err != nil || len(files) != 1 || files[0].FileName != "a.zip" {
+		t.Fatalf("FetchFiles() = %+v, %v", files, err)
+	}
+
+	var buf bytes.Buffer
+	var written int64
+	err = a.DownloadFile(ctx, files[0], &buf, func(n, total int64) { written = n })
+	if err != nil || buf.String() != "hello" || written != 5 {
+		t.Errorf("DownloadFile() = %q (%d bytes reported), %v", buf.String(), written, err)
+	}
+
+	if _, err := a.FetchProducts(ctx); !errors.As(err, &adapterErr) || adapterErr.Code != sources.ErrCodeNetwork {
+		t.Errorf("FetchProducts() on a plugin without it = %v, want a network error", err)
+	}
+}
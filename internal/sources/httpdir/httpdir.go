@@ -0,0 +1,292 @@
+// Package httpdir reads bulk data published as HTTP directory listings, the
+// format used by offices that serve their collections from a plain file
+// server (Apache or nginx autoindex pages).
+package httpdir
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+// Entry is a file or directory in a listing
+type Entry struct {
+	Name     string
+	Dir      bool
+	Size     int64 // 0 for directories and unknown sizes
+	Modified time.Time
+}
+
+// Client lists and downloads files below a base URL
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Authorize adds credentials to each request
+	Authorize func(req *http.Request) error
+}
+
+// maxPageSize limits how much of an index page is read
+const maxPageSize = 16 << 20
+
+// List returns the entries of the directory at path, relative to BaseURL
+func (c *Client) List(ctx context.Context, path string) ([]Entry, error) {
+	page, err := c.Page(ctx, strings.TrimSuffix(path, "/")+"/")
+	if err != nil {
+		return nil, err
+	}
+	return Parse(bytes.NewReader(page))
+}
+
+// Page returns the body of the page at path, which is relative to BaseURL or
+// an absolute URL
+func (c *Client) Page(ctx context.Context, path string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, sources.NewAdapterError(sources.ErrCodeNetwork, "Failed to read page", err)
+	}
+	return page, nil
+}
+
+// Stat returns the size and modification time of the file at path from a
+// HEAD request. Either may be zero if the server doesn't report it; the name
+// is left empty.
+func (c *Client) Stat(ctx context.Context, path string) (Entry, error) {
+	resp, err := c.do(ctx, http.MethodHead, path)
+	if err != nil {
+		return Entry{}, err
+	}
+	resp.Body.Close()
+
+	var entry Entry
+	if resp.ContentLength > 0 {
+		entry.Size = resp.ContentLength
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		entry.Modified = modified.UTC()
+	}
+	return entry, nil
+}
+
+// Download streams the file at path to dst, reporting progress against the
+// response's Content-Length
+func (c *Client) Download(ctx context.Context, path string, dst io.Writer, progress sources.ProgressFunc) error {
+	resp, err := c.do(ctx, http.MethodGet, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var src io.Reader = resp.Body
+	if progress != nil {
+		src = &progressReader{r: resp.Body, total: resp.ContentLength, progress: progress}
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string) (*http.Response, error) {
+	target, err := c.resolve(path)
+	if err != nil {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid base URL", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// Credentials are only sent to the host serving BaseURL, not to hosts an
+	// index page happens to link to
+	if c.Authorize != nil && target.Host == c.host() {
+		if err := c.Authorize(req); err != nil {
+			return nil, err
+		}
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, sources.NewAdapterError(sources.ErrCodeNetwork, "Request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, statusError(method, resp.StatusCode, target.String())
+	}
+	return resp, nil
+}
+
+// resolve returns the URL of path. Absolute URLs are used as they are;
+// other paths are escaped and resolved against BaseURL.
+func (c *Client) resolve(path string) (*url.URL, error) {
+	if strings.Contains(path, "://") {
+		target, err := url.Parse(path)
+		if err != nil || target.Host == "" {
+			return nil, fmt.Errorf("%q is not an absolute URL", path)
+		}
+		return target, nil
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(c.BaseURL, "/") + "/")
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute URL", c.BaseURL)
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	ref, err := url.Parse(strings.Join(segments, "/"))
+	if err != nil {
+		return nil, err
+	}
+	return base.ResolveReference(ref), nil
+}
+
+func (c *Client) host() string {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return base.Host
+}
+
+func statusError(method string, status int, target string) error {
+	err := fmt.Errorf("%s %s: status %d", method, target, status)
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return sources.NewAdapterError(sources.ErrCodeAuth, "Access denied", err)
+	case http.StatusNotFound:
+		return sources.NewAdapterError(sources.ErrCodeNotFound, "Not found", err)
+	case http.StatusTooManyRequests:
+		return sources.NewAdapterError(sources.ErrCodeRateLimit, "Rate limited", err)
+	}
+	return sources.NewAdapterError(sources.ErrCodeNetwork, "Unexpected response", err)
+}
+
+// entryRegex matches a link followed by the modification time and size
+// columns of Apache ("2025-03-20 10:15  1.2G") and nginx
+// ("20-Mar-2025 10:15  1288490188") listings
+var entryRegex = regexp.MustCompile(`<a href="([^"]+)"[^>]*>[^<]*</a>(?:</td><td[^>]*>|\s)+(\d{4}-\d{2}-\d{2} \d{2}:\d{2}|\d{2}-[A-Za-z]{3}-\d{4} \d{2}:\d{2})(?:</td><td[^>]*>|\s)+([\d.]+[KMGT]?|-)`)
+
+var timeLayouts = []string{"2006-01-02 15:04", "02-Jan-2006 15:04"}
+
+// Parse extracts the entries from a directory listing page. Parent, sort and
+// absolute links are skipped.
+func Parse(r io.Reader) ([]Entry, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, m := range entryRegex.FindAllStringSubmatch(string(body), -1) {
+		href := html.UnescapeString(m[1])
+		if strings.HasPrefix(href, "?") || strings.HasPrefix(href, "/") || strings.HasPrefix(href, "..") || strings.Contains(href, "://") {
+			continue
+		}
+		name, err := url.PathUnescape(href)
+		if err != nil {
+			name = href
+		}
+
+		entry := Entry{Name: strings.TrimSuffix(name, "/"), Dir: strings.HasSuffix(name, "/")}
+		// Escaped separators would make names that leave a directory
+		if sources.CheckName(entry.Name) != nil {
+			continue
+		}
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, m[2]); err == nil {
+				entry.Modified = t
+				break
+			}
+		}
+		if !entry.Dir {
+			entry.Size = parseSize(m[3])
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+var linkRegex = regexp.MustCompile(`(?i)<a\s[^>]*href\s*=\s*["']([^"']+)["']`)
+
+// Links returns the targets of all links on a page, for index pages that
+// aren't directory listings. Fragment, query-only and javascript links are
+// skipped.
+func Links(r io.Reader) ([]string, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []string
+	for _, m := range linkRegex.FindAllStringSubmatch(string(body), -1) {
+		href := strings.TrimSpace(html.UnescapeString(m[1]))
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "?") ||
+			strings.HasPrefix(strings.ToLower(href), "javascript:") || strings.HasPrefix(strings.ToLower(href), "mailto:") {
+			continue
+		}
+		links = append(links, href)
+	}
+	return links, nil
+}
+
+// parseSize parses byte counts and Apache's abbreviated sizes ("1.2G")
+func parseSize(s string) int64 {
+	multiplier := float64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(value * multiplier)
+}
+
+type progressReader struct {
+	r        io.Reader
+	written  int64
+	total    int64
+	progress sources.ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.written += int64(n)
+		p.progress(p.written, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,125 @@
+package httpdir
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+const apacheListing = `<html><body><h1>Index of /pct</h1><table>
+<tr><th><a href="?C=N;O=D">Name</a></th><th><a href="?C=M;O=A">Last modified</a></th><th><a href="?C=S;O=A">Size</a></th></tr>
+<tr><td><a href="/">Parent Directory</a></td><td>&nbsp;</td><td align="right">  - </td></tr>
+<tr><td><a href="2025-12/">2025-12/</a></td><td align="right">2025-03-20 10:15  </td><td align="right">  - </td></tr>
+<tr><td><a href="full%20text.zip">full text.zip</a></td><td align="right">2025-03-20 10:16  </td><td align="right">1.5G</td></tr>
+<tr><td><a href="README.txt">README.txt</a></td><td align="right">2025-01-02 08:00  </td><td align="right">512 </td></tr>
+</table></body></html>`
+
+const nginxListing = `<html><body><h1>Index of /pct/</h1><hr><pre><a href="../">../</a>
+<a href="2025-12/">2025-12/</a>                                           20-Mar-2025 10:15                   -
+<a href="biblio.zip">biblio.zip</a>                                         20-Mar-2025 10:16             1288490
+<a href="a%2F..%2F..%2F..%2Fevil.zip">evil.zip</a>                          20-Mar-2025 10:16                  42
+</pre><hr></body></html>`
+
+func TestParse(t *testing.T) {
+	modified := time.Date(2025, 3, 20, 10, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		listing string
+		want    []Entry
+	}{
+		{"apache", apacheListing, []Entry{
+			{Name: "2025-12", Dir: true, Modified: modified},
+			{Name: "full text.zip", Size: 1610612736, Modified: modified.Add(time.Minute)},
+			{Name: "README.txt", Size: 512, Modified: time.Date(2025, 1, 2, 8, 0, 0, 0, time.UTC)},
+		}},
+		{"nginx", nginxListing, []Entry{
+			{Name: "2025-12", Dir: true, Modified: modified},
+			{Name: "biblio.zip", Size: 1288490, Modified: modified.Add(time.Minute)},
+		}},
+		{"empty", "<html></html>", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.listing))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse() returned %d entries, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/bulk/pct/":
+			w.Write([]byte(nginxListing))
+		case "/bulk/pct/full text.zip":
+			w.Write([]byte("file content"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{
+		BaseURL: server.URL + "/bulk",
+		Authorize: func(req *http.Request) error {
+			req.SetBasicAuth("user", "secret")
+			return nil
+		},
+	}
+	ctx := context.Background()
+
+	entries, err := client.List(ctx, "pct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("List() returned %d entries, want 2", len(entries))
+	}
+
+	var buf bytes.Buffer
+	var lastWritten, lastTotal int64
+	err = client.Download(ctx, "pct/full text.zip", &buf, func(written, total int64) {
+		lastWritten, lastTotal = written, total
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "file content" {
+		t.Errorf("Download() wrote %q", buf.String())
+	}
+	if lastWritten != 12 || lastTotal != 12 {
+		t.Errorf("progress = %d/%d, want 12/12", lastWritten, lastTotal)
+	}
+
+	var adapterErr *sources.AdapterError
+	if _, err := client.List(ctx, "missing"); !errors.As(err, &adapterErr) || adapterErr.Code != sources.ErrCodeNotFound {
+		t.Errorf("List() of missing directory error = %v, want %s", err, sources.ErrCodeNotFound)
+	}
+
+	client.Authorize = nil
+	if _, err := client.List(ctx, "pct"); !errors.As(err, &adapterErr) || adapterErr.Code != sources.ErrCodeAuth {
+		t.Errorf("List() without credentials error = %v, want %s", err, sources.ErrCodeAuth)
+	}
+}
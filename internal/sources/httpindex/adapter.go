@@ -0,0 +1,478 @@
+// Package httpindex is a configurable adapter for ad-hoc bulk endpoints that
+// have no API: files are found by scraping an index page and by expanding
+// dated URL patterns.
+package httpindex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/httpdir"
+)
+
+const (
+	SourceID   = "http-index"
+	SourceName = "HTTP Index"
+
+	// productID is the single product the adapter exposes
+	productID = "files"
+
+	// undatedDelivery holds files whose release date is unknown
+	undatedDelivery = "latest"
+
+	defaultLookbackDays = 14
+	maxLookbackDays     = 366
+)
+
+// Adapter implements the sources.Adapter interface for files linked from an
+// HTTP index page or addressed by URL patterns. All files form one product;
+// deliveries group them by release date.
+type Adapter struct {
+	client      *httpdir.Client
+	credentials map[string]string
+}
+
+// remoteFile is a file found on the index page or through a pattern
+type remoteFile struct {
+	url      string
+	name     string
+	size     int64
+	released time.Time
+}
+
+// New creates a new HTTP index adapter
+func New() *Adapter {
+	return &Adapter{
+		credentials: make(map[string]string),
+	}
+}
+
+// ID returns the source identifier
+func (a *Adapter) ID() string {
+	return SourceID
+}
+
+// Name returns the human-readable source name
+func (a *Adapter) Name() string {
+	return SourceName
+}
+
+// CredentialFields returns the configuration fields. Either an index URL or
+// URL patterns are required; the UI can't express that, so neither is marked
+// required and getClient checks it.
+func (a *Adapter) CredentialFields() []sources.CredentialField {
+	return []sources.CredentialField{
+		{
+			Key:      "index_url",
+			Label:    "Index URL",
+			Type:     "text",
+			HelpText: "Page whose linked files are downloaded, e.g. a directory listing",
+		},
+		{
+			Key:      "url_patterns",
+			Label:    "URL Patterns",
+			Type:     "text",
+			HelpText: "Comma-separated file URLs with {yyyy}, {mm}, {dd} and {ww} (ISO week) placeholders, tried for each recent day",
+		},
+		{
+			Key:      "lookback_days",
+			Label:    "Lookback Days",
+			Type:     "text",
+			HelpText: "Number of days URL patterns are expanded for (default 14)",
+		},
+		{
+			Key:      "file_pattern",
+			Label:    "File Name Pattern",
+			Type:     "text",
+			HelpText: "Regular expression file names must match, e.g. \\.zip$",
+		},
+		{
+			Key:      "product_name",
+			Label:    "Product Name",
+			Type:     "text",
+			HelpText: "Name shown for the downloaded files (default: Files)",
+		},
+		{
+			Key:      "username",
+			Label:    "Username",
+			Type:     "text",
+			HelpText: "Username for HTTP basic authentication, if required",
+		},
+		{
+			Key:      "password",
+			Label:    "Password",
+			Type:     "password",
+			HelpText: "Password for HTTP basic authentication, if required",
+		},
+	}
+}
+
+// SetCredentials sets the credentials for the adapter
+func (a *Adapter) SetCredentials(creds map[string]string) {
+	a.credentials = creds
+	a.client = nil // Reset client to force re-creation with new credentials
+}
+
+// ValidateCredentials checks the configuration and that files can be found
+func (a *Adapter) ValidateCredentials(ctx context.Context) error {
+	if _, err := a.getClient(); err != nil {
+		return err
+	}
+	if _, err := a.fileFilter(); err != nil {
+		return err
+	}
+	if _, err := a.lookbackDays(); err != nil {
+		return err
+	}
+
+	if indexURL := a.credentials["index_url"]; indexURL != "" {
+		if _, err := a.client.Page(ctx, indexURL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FetchProducts returns the single product holding all files
+func (a *Adapter) FetchProducts(ctx context.Context) ([]sources.ProductInfo, error) {
+	if _, err := a.getClient(); err != nil {
+		return nil, err
+	}
+
+	name := a.credentials["product_name"]
+	if name == "" {
+		name = "Files"
+	}
+
+	var locations []string
+	if indexURL := a.credentials["index_url"]; indexURL != "" {
+		locations = append(locations, indexURL)
+	}
+	locations = append(locations, splitPatterns(a.credentials["url_patterns"])...)
+
+	return []sources.ProductInfo{{
+		ExternalID:    productID,
+		Name:          name,
+		Description:   "Files from " + strings.Join(locations, ", "),
+		CheckSchedule: "0 6 * * *", // Default: 6 AM daily
+	}}, nil
+}
+
+// FetchDeliveries groups the files by release date
+func (a *Adapter) FetchDeliveries(ctx context.Context, productID string) ([]sources.DeliveryInfo, error) {
+	return a.deliveries(ctx, time.Time{})
+}
+
+// FetchDeliveriesSince is FetchDeliveries without probing the URL patterns
+// for dates before since
+func (a *Adapter) FetchDeliveriesSince(ctx context.Context, productID string, since time.Time) ([]sources.DeliveryInfo, error) {
+	return a.deliveries(ctx, since)
+}
+
+func (a *Adapter) deliveries(ctx context.Context, since time.Time) ([]sources.DeliveryInfo, error) {
+	files, err := a.collect(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	published := make(map[string]time.Time)
+	for _, f := range files {
+		id := releaseDelivery(f.released)
+		if _, ok := published[id]; !ok || f.released.After(published[id]) {
+			published[id] = f.released
+		}
+	}
+
+	result := make([]sources.DeliveryInfo, 0, len(published))
+	for id, at := range published {
+		if id == undatedDelivery {
+			at = time.Now().UTC()
+		}
+		result = append(result, sources.DeliveryInfo{
+			ExternalID:  id,
+			Name:        id,
+			PublishedAt: at,
+		})
+	}
+
+	// Newest first, like the other sources
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].PublishedAt.After(result[j].PublishedAt)
+	})
+
+	return result, nil
+}
+
+// FetchFiles returns the files released on the delivery's date
+func (a *Adapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]sources.FileInfo, error) {
+	files, err := a.collect(ctx, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.FileInfo
+	for _, f := range files {
+		if releaseDelivery(f.released) != deliveryID {
+			continue
+		}
+		result = append(result, sources.FileInfo{
+			ExternalID:  f.name,
+			FileName:    f.name,
+			FileSize:    f.size,
+			DownloadURI: f.url,
+			ReleasedAt:  f.released,
+		})
+	}
+
+	return result, nil
+}
+
+// DownloadFile downloads a file
+func (a *Adapter) DownloadFile(ctx context.Context, file sources.FileInfo, dst io.Writer, progress sources.ProgressFunc) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(file.DownloadURI, "http://") && !strings.HasPrefix(file.DownloadURI, "https://") {
+		return sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid download URI", nil)
+	}
+
+	return client.Download(ctx, file.DownloadURI, dst, progress)
+}
+
+// collect finds all files on the index page and behind the URL patterns,
+// keeping those whose name matches the file pattern. Patterns are only
+// probed for dates from since on, if it is set.
+func (a *Adapter) collect(ctx context.Context, since time.Time) ([]remoteFile, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := a.fileFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []remoteFile
+	if indexURL := a.credentials["index_url"]; indexURL != "" {
+		indexed, err := a.scrape(ctx, client, indexURL)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, indexed...)
+	}
+
+	if patterns := splitPatterns(a.credentials["url_patterns"]); len(patterns) > 0 {
+		days, err := a.lookbackDays()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().UTC()
+		if !since.IsZero() {
+			days = max(min(days, int(now.Sub(since).Hours()/24)+1), 1)
+		}
+		probed, err := probe(ctx, client, patterns, days, now)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, probed...)
+	}
+
+	seen := make(map[string]bool)
+	result := files[:0]
+	for _, f := range files {
+		// Names come from links and URLs and end up in download paths
+		if seen[f.url] || (filter != nil && !filter.MatchString(f.name)) || sources.CheckName(f.name) != nil {
+			continue
+		}
+		seen[f.url] = true
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+// scrape returns the files linked from the index page. Directory listings
+// also provide sizes and dates; for other pages only the links are used.
+func (a *Adapter) scrape(ctx context.Context, client *httpdir.Client, indexURL string) ([]remoteFile, error) {
+	page, err := client.Page(ctx, indexURL)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid index URL", err)
+	}
+
+	var files []remoteFile
+	if entries, _ := httpdir.Parse(bytes.NewReader(page)); len(entries) > 0 {
+		if !strings.HasSuffix(base.Path, "/") {
+			base.Path += "/"
+		}
+		for _, e := range entries {
+			if e.Dir {
+				continue
+			}
+			files = append(files, remoteFile{
+				url:      base.ResolveReference(&url.URL{Path: e.Name}).String(),
+				name:     e.Name,
+				size:     e.Size,
+				released: e.Modified,
+			})
+		}
+		return files, nil
+	}
+
+	links, _ := httpdir.Links(bytes.NewReader(page))
+	for _, link := range links {
+		ref, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		target := base.ResolveReference(ref)
+		name := path.Base(target.Path)
+		if (target.Scheme != "http" && target.Scheme != "https") || strings.HasSuffix(target.Path, "/") || name == "." || name == "/" {
+			continue
+		}
+		target.Fragment = ""
+		files = append(files, remoteFile{url: target.String(), name: name})
+	}
+	return files, nil
+}
+
+// probe expands the patterns for each of the last days and keeps the URLs
+// that exist. Files are dated by the day that produced their URL.
+func probe(ctx context.Context, client *httpdir.Client, patterns []string, days int, now time.Time) ([]remoteFile, error) {
+	var files []remoteFile
+	tried := make(map[string]bool)
+	for day := 0; day < days; day++ {
+		date := now.AddDate(0, 0, -day)
+		for _, pattern := range patterns {
+			target := expandPattern(pattern, date)
+			if tried[target] {
+				continue
+			}
+			tried[target] = true
+
+			entry, err := client.Stat(ctx, target)
+			if err != nil {
+				if isNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			files = append(files, remoteFile{
+				url:      target,
+				name:     path.Base(target),
+				size:     entry.Size,
+				released: time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+			})
+		}
+	}
+	return files, nil
+}
+
+// expandPattern replaces the date placeholders in pattern
+func expandPattern(pattern string, date time.Time) string {
+	_, week := date.ISOWeek()
+	return strings.NewReplacer(
+		"{yyyy}", date.Format("2006"),
+		"{mm}", date.Format("01"),
+		"{dd}", date.Format("02"),
+		"{ww}", fmt.Sprintf("%02d", week),
+	).Replace(pattern)
+}
+
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, p := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// releaseDelivery returns the ID of the delivery holding files released at released
+func releaseDelivery(released time.Time) string {
+	if released.IsZero() {
+		return undatedDelivery
+	}
+	return released.Format("20060102")
+}
+
+func isNotFound(err error) bool {
+	var adapterErr *sources.AdapterError
+	return errors.As(err, &adapterErr) && adapterErr.Code == sources.ErrCodeNotFound
+}
+
+func (a *Adapter) fileFilter() (*regexp.Regexp, error) {
+	pattern := a.credentials["file_pattern"]
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid file name pattern", err)
+	}
+	return re, nil
+}
+
+func (a *Adapter) lookbackDays() (int, error) {
+	value := a.credentials["lookback_days"]
+	if value == "" {
+		return defaultLookbackDays, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 || days > maxLookbackDays {
+		return 0, sources.NewAdapterError(sources.ErrCodeInvalidConfig,
+			fmt.Sprintf("Lookback days must be between 1 and %d", maxLookbackDays), err)
+	}
+	return days, nil
+}
+
+func (a *Adapter) getClient() (*httpdir.Client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	indexURL := a.credentials["index_url"]
+	patterns := splitPatterns(a.credentials["url_patterns"])
+	if indexURL == "" && len(patterns) == 0 {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Set an index URL or URL patterns", nil)
+	}
+
+	// Credentials are sent to the host of the index URL, or of the first
+	// pattern when there is no index page
+	baseURL := indexURL
+	if baseURL == "" {
+		baseURL = patterns[0]
+	}
+
+	client := &httpdir.Client{
+		BaseURL:    baseURL,
+		HTTPClient: sources.NewHTTPClient(SourceID),
+	}
+	if username, password := a.credentials["username"], a.credentials["password"]; username != "" {
+		client.Authorize = func(req *http.Request) error {
+			req.SetBasicAuth(username, password)
+			return nil
+		}
+	}
+
+	a.client = client
+	return a.client, nil
+}
@@ -0,0 +1,91 @@
+package httpindex
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExpandPattern(t *testing.T) {
+	date := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	got := expandPattern("https://example.org/{yyyy}/W{ww}/data-{yyyy}{mm}{dd}.zip", date)
+	if want := "https://example.org/2025/W01/data-20250102.zip"; got != want {
+		t.Errorf("expandPattern() = %q, want %q", got, want)
+	}
+}
+
+func TestAdapter(t *testing.T) {
+	today := time.Now().UTC()
+	yesterday := today.AddDate(0, 0, -1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/downloads.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body>
+<a href="#top">Top</a>
+<a href="files/full.zip">Full</a>
+<a href='files/readme.txt'>Readme</a>
+<a href="files/a%5C..%5C..%5Cevil.zip">Evil</a>
+<a href="archive/">Archive</a>
+<a href="mailto:data@example.org">Contact</a>
+</body></html>`))
+	})
+	mux.HandleFunc("/daily/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/daily/update-"+yesterday.Format("20060102")+".zip" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", "42")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	a := New()
+	a.SetCredentials(map[string]string{
+		"index_url":     server.URL + "/downloads.html",
+		"url_patterns":  server.URL + "/daily/update-{yyyy}{mm}{dd}.zip",
+		"lookback_days": "3",
+		"file_pattern":  `\.zip$`,
+	})
+	ctx := context.Background()
+
+	if err := a.ValidateCredentials(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := a.FetchDeliveries(ctx, productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("FetchDeliveries() returned %d deliveries, want 2: %+v", len(deliveries), deliveries)
+	}
+	if deliveries[0].ExternalID != undatedDelivery || deliveries[1].ExternalID != yesterday.Format("20060102") {
+		t.Errorf("deliveries = %s, %s", deliveries[0].ExternalID, deliveries[1].ExternalID)
+	}
+
+	files, err := a.FetchFiles(ctx, productID, undatedDelivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].DownloadURI != server.URL+"/files/full.zip" {
+		t.Errorf("undated files = %+v, want only full.zip", files)
+	}
+
+	files, err = a.FetchFiles(ctx, productID, yesterday.Format("20060102"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].FileSize != 42 {
+		t.Errorf("dated files = %+v, want the update with its size", files)
+	}
+}
+
+func TestValidateCredentialsRequiresLocation(t *testing.T) {
+	a := New()
+	a.SetCredentials(map[string]string{"file_pattern": ".zip"})
+	if err := a.ValidateCredentials(context.Background()); err == nil {
+		t.Error("ValidateCredentials() without index URL or patterns succeeded")
+	}
+}
@@ -0,0 +1,259 @@
+package jpo
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/httpdir"
+)
+
+const (
+	SourceID   = "jpo-bulk"
+	SourceName = "JPO Bulk Data"
+)
+
+// Adapter implements the sources.Adapter interface for the JPO bulk data
+// download service. Each top-level directory is a data type (a product),
+// below which data is organised by year and then by weekly issue. An issue is
+// a delivery.
+type Adapter struct {
+	client      *httpdir.Client
+	credentials map[string]string
+}
+
+// New creates a new JPO adapter
+func New() *Adapter {
+	return &Adapter{
+		credentials: make(map[string]string),
+	}
+}
+
+// ID returns the source identifier
+func (a *Adapter) ID() string {
+	return SourceID
+}
+
+// Name returns the human-readable source name
+func (a *Adapter) Name() string {
+	return SourceName
+}
+
+// CredentialFields returns the required credential fields
+func (a *Adapter) CredentialFields() []sources.CredentialField {
+	return []sources.CredentialField{
+		{
+			Key:      "base_url",
+			Label:    "Base URL",
+			Type:     "text",
+			Required: true,
+			HelpText: "The download URL given in your JPO bulk data service registration",
+		},
+		{
+			Key:      "user_id",
+			Label:    "User ID",
+			Type:     "text",
+			Required: true,
+			HelpText: "Your JPO bulk data service user ID",
+		},
+		{
+			Key:      "password",
+			Label:    "Password",
+			Type:     "password",
+			Required: true,
+			HelpText: "Your JPO bulk data service password",
+		},
+	}
+}
+
+// SetCredentials sets the credentials for the adapter
+func (a *Adapter) SetCredentials(creds map[string]string) {
+	a.credentials = creds
+	a.client = nil // Reset client to force re-creation with new credentials
+}
+
+// ValidateCredentials tests if the credentials are valid
+func (a *Adapter) ValidateCredentials(ctx context.Context) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	// Try to list the data types to validate credentials
+	if _, err := client.List(ctx, ""); err != nil {
+		return sources.NewAdapterError(sources.ErrCodeAuth, "Failed to authenticate with JPO", err)
+	}
+
+	return nil
+}
+
+// FetchProducts fetches the data types available to the account
+func (a *Adapter) FetchProducts(ctx context.Context) ([]sources.ProductInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := client.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.ProductInfo
+	for _, e := range entries {
+		if !e.Dir {
+			continue
+		}
+		result = append(result, sources.ProductInfo{
+			ExternalID:    e.Name,
+			Name:          "JPO " + e.Name,
+			Description:   "JPO bulk data " + e.Name,
+			CheckSchedule: "0 6 * * 4", // Weekly issues; checked on Thursdays
+		})
+	}
+
+	return result, nil
+}
+
+// FetchDeliveries fetches the weekly issues of a data type across all years
+func (a *Adapter) FetchDeliveries(ctx context.Context, productID string) ([]sources.DeliveryInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	years, err := client.List(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.DeliveryInfo
+	for _, year := range years {
+		if !year.Dir || !isYear(year.Name) {
+			continue
+		}
+		issues, err := client.List(ctx, path.Join(productID, year.Name))
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			if !issue.Dir {
+				continue
+			}
+			result = append(result, sources.DeliveryInfo{
+				ExternalID:  deliveryID(year.Name, issue.Name),
+				Name:        issue.Name,
+				PublishedAt: issue.Modified,
+			})
+		}
+	}
+
+	// Newest first, like the other sources
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ExternalID > result[j].ExternalID
+	})
+
+	return result, nil
+}
+
+// FetchFiles fetches the archives of an issue
+func (a *Adapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]sources.FileInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	year, issue, ok := splitDeliveryID(deliveryID)
+	if !ok {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid delivery ID", nil)
+	}
+
+	dir := path.Join(productID, year, issue)
+	entries, err := client.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.FileInfo
+	for _, e := range entries {
+		if e.Dir {
+			continue
+		}
+		result = append(result, sources.FileInfo{
+			ExternalID:  e.Name,
+			FileName:    e.Name,
+			FileSize:    e.Size,
+			DownloadURI: path.Join(dir, e.Name),
+			ReleasedAt:  e.Modified,
+		})
+	}
+
+	return result, nil
+}
+
+// DownloadFile downloads a file
+func (a *Adapter) DownloadFile(ctx context.Context, file sources.FileInfo, dst io.Writer, progress sources.ProgressFunc) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	if file.DownloadURI == "" || strings.Contains(file.DownloadURI, "..") {
+		return sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid download URI", nil)
+	}
+
+	return client.Download(ctx, file.DownloadURI, dst, progress)
+}
+
+func (a *Adapter) getClient() (*httpdir.Client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	baseURL := a.credentials["base_url"]
+	userID := a.credentials["user_id"]
+	password := a.credentials["password"]
+
+	if baseURL == "" || userID == "" || password == "" {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Missing credentials", nil)
+	}
+
+	a.client = &httpdir.Client{
+		BaseURL:    baseURL,
+		HTTPClient: sources.NewHTTPClient(SourceID),
+		Authorize: func(req *http.Request) error {
+			req.SetBasicAuth(userID, password)
+			return nil
+		},
+	}
+
+	return a.client, nil
+}
+
+// deliveryID combines the year and issue directories, since issue names are
+// only unique within a year. IDs must not contain slashes or colons, which
+// separate the parts of file IDs and API paths.
+func deliveryID(year, issue string) string {
+	return year + "-" + issue
+}
+
+func splitDeliveryID(id string) (year, issue string, ok bool) {
+	year, issue, ok = strings.Cut(id, "-")
+	return year, issue, ok && isYear(year) && issue != ""
+}
+
+func isYear(name string) bool {
+	if len(name) != 4 {
+		return false
+	}
+	for _, c := range name {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package jpo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+const typesPage = `<html><body><pre><a href="../">../</a>
+<a href="JPP/">JPP/</a>                                    02-Jan-2025 00:10                   -
+<a href="JPD/">JPD/</a>                                    02-Jan-2025 00:10                   -
+<a href="notice.txt">notice.txt</a>                        02-Jan-2025 00:10                 120
+</pre></body></html>`
+
+const yearsPage = `<html><body><pre><a href="../">../</a>
+<a href="2024/">2024/</a>                                  26-Dec-2024 00:10                   -
+<a href="2025/">2025/</a>                                  09-Jan-2025 00:10                   -
+<a href="docs/">docs/</a>                                  01-Jan-2020 00:10                   -
+</pre></body></html>`
+
+const issues2024Page = `<html><body><pre><a href="../">../</a>
+<a href="20241226/">20241226/</a>                          26-Dec-2024 00:10                   -
+</pre></body></html>`
+
+const issues2025Page = `<html><body><pre><a href="../">../</a>
+<a href="20250102/">20250102/</a>                          02-Jan-2025 00:10                   -
+<a href="20250109/">20250109/</a>                          09-Jan-2025 00:10                   -
+</pre></body></html>`
+
+const filesPage = `<html><body><pre><a href="../">../</a>
+<a href="JPP_20250109_1.zip">JPP_20250109_1.zip</a>        09-Jan-2025 00:03              131072
+<a href="JPP_20250109_2.zip">JPP_20250109_2.zip</a>        09-Jan-2025 00:04                  42
+<a href="images/">images/</a>                              09-Jan-2025 00:04                   -
+<a href="..%2F..%2Fevil.zip">evil.zip</a>                   09-Jan-2025 00:04                  42
+<a href="a%5C..%5Cevil.zip">evil2.zip</a>                   09-Jan-2025 00:04                  42
+</pre></body></html>`
+
+func TestDeliveryID(t *testing.T) {
+	if id := deliveryID("2025", "20250109"); id != "2025-20250109" {
+		t.Errorf("deliveryID() = %q, want 2025-20250109", id)
+	}
+
+	for _, tt := range []struct {
+		id, year, issue string
+		ok              bool
+	}{
+		{"2025-20250109", "2025", "20250109", true},
+		{"2025-2025-01", "2025", "2025-01", true},
+		{"2025-", "", "", false},
+		{"2025", "", "", false},
+		{"25-20250109", "", "", false},
+		{"abcd-20250109", "", "", false},
+	} {
+		year, issue, ok := splitDeliveryID(tt.id)
+		if ok != tt.ok || (ok && (year != tt.year || issue != tt.issue)) {
+			t.Errorf("splitDeliveryID(%q) = %q, %q, %v; want %q, %q, %v", tt.id, year, issue, ok, tt.year, tt.issue, tt.ok)
+		}
+	}
+
+	for name, want := range map[string]bool{"2025": true, "0000": true, "202": false, "20250": false, "20a5": false, "": false} {
+		if got := isYear(name); got != want {
+			t.Errorf("isYear(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestAdapter(t *testing.T) {
+	pages := map[string]string{
+		"/bulk/":                   typesPage,
+		"/bulk/JPP/":               yearsPage,
+		"/bulk/JPP/2024/":          issues2024Page,
+		"/bulk/JPP/2025/":          issues2025Page,
+		"/bulk/JPP/2025/20250109/": filesPage,
+		"/bulk/JPP/2025/20250109/JPP_20250109_2.zip": "PK",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	a := New()
+	a.SetCredentials(map[string]string{"base_url": server.URL + "/bulk/", "user_id": "user", "password": "secret"})
+
+	products, err := a.FetchProducts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 2 || products[0].ExternalID != "JPP" || products[1].ExternalID != "JPD" {
+		t.Fatalf("FetchProducts() = %+v, want the JPP and JPD directories", products)
+	}
+
+	deliveries, err := a.FetchDeliveries(ctx, "JPP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 3 || deliveries[0].ExternalID != "2025-20250109" || deliveries[2].ExternalID != "2024-20241226" ||
+		deliveries[0].Name != "20250109" || deliveries[0].PublishedAt.IsZero() {
+		t.Fatalf("FetchDeliveries() = %+v, want the issues of both years, newest first", deliveries)
+	}
+
+	files, err := a.FetchFiles(ctx, "JPP", deliveries[0].ExternalID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].FileSize != 131072 || files[1].DownloadURI != "JPP/2025/20250109/JPP_20250109_2.zip" {
+		t.Fatalf("FetchFiles() = %+v, want both archives with sizes", files)
+	}
+	for _, f := range files {
+		if err := errors.Join(sources.CheckName(f.ExternalID), sources.CheckName(f.FileName)); err != nil {
+			t.Errorf("FetchFiles() returned an unsafe name: %v", err)
+		}
+	}
+	if _, err := a.FetchFiles(ctx, "JPP", "20250109"); err == nil {
+		t.Error("FetchFiles() with a delivery ID without year succeeded")
+	}
+
+	var buf bytes.Buffer
+	if err := a.DownloadFile(ctx, files[1], &buf, nil); err != nil || buf.String() != "PK" {
+		t.Errorf("DownloadFile() = %q, %v", buf.String(), err)
+	}
+
+	a.SetCredentials(map[string]string{"base_url": server.URL + "/bulk/", "user_id": "user", "password": "wrong"})
+	if err := a.ValidateCredentials(ctx); err == nil {
+		t.Error("ValidateCredentials() with a wrong password succeeded")
+	}
+}
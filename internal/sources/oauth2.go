@@ -0,0 +1,180 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialTypeOAuth2 is the type of a credential field holding the client
+// secret of an OAuth2 client credentials grant. The field's OAuth2 config
+// names the token endpoint and the field holding the client ID.
+const CredentialTypeOAuth2 = "oauth2"
+
+// OAuth2Config describes how the token of an OAuth2 credential field is obtained
+type OAuth2Config struct {
+	TokenURL string `json:"tokenUrl"`
+	// ClientIDKey is the key of the credential field holding the client ID
+	ClientIDKey string   `json:"clientIdKey"`
+	Scopes      []string `json:"scopes,omitempty"`
+}
+
+// OAuth2Adapter is implemented by adapters with OAuth2 credential fields.
+// Whenever credentials are set through the registry, the adapter receives a
+// token source per field, so tokens are cached and refreshed in one place.
+type OAuth2Adapter interface {
+	SetTokenSource(key string, tokens TokenSource)
+}
+
+// TokenSource provides access tokens
+type TokenSource interface {
+	// Token returns a valid access token, requesting a new one when the
+	// cached token has expired
+	Token(ctx context.Context) (string, error)
+	// Invalidate drops the cached token, e.g. after the office rejected it
+	Invalidate()
+}
+
+// tokenExpiryMargin renews tokens this long before they expire
+const tokenExpiryMargin = time.Minute
+
+// defaultTokenLifetime is assumed when a token response has no expires_in
+const defaultTokenLifetime = 20 * time.Minute
+
+// clientCredentials requests tokens with the client credentials grant
+type clientCredentials struct {
+	config       OAuth2Config
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewClientCredentials returns a token source for the client credentials
+// grant. Adapters use it directly when they run outside the registry.
+func NewClientCredentials(config OAuth2Config, clientID, clientSecret string, httpClient *http.Client) TokenSource {
+	return &clientCredentials{
+		config:       config,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient:   httpClient,
+	}
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	// Some offices (EPO OPS) send the lifetime as a string
+	ExpiresIn json.Number `json:"expires_in"`
+}
+
+// Token returns the cached token or requests a new one
+func (c *clientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+	if c.clientID == "" || c.clientSecret == "" {
+		return "", NewAdapterError(ErrCodeInvalidConfig, "Missing client credentials", nil)
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.config.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", NewAdapterError(ErrCodeNetwork, "Token request failed", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusBadRequest, resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return "", NewAdapterError(ErrCodeAuth, "Invalid client ID or secret", fmt.Errorf("status %d", resp.StatusCode))
+	case resp.StatusCode != http.StatusOK:
+		return "", NewAdapterError(ErrCodeNetwork, "Token request failed", fmt.Errorf("status %d", resp.StatusCode))
+	}
+
+	var body tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err != nil || body.AccessToken == "" {
+		return "", NewAdapterError(ErrCodeNetwork, "Invalid token response", err)
+	}
+	lifetime := defaultTokenLifetime
+	if seconds, err := body.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		lifetime = time.Duration(seconds) * time.Second
+	}
+
+	c.token = body.AccessToken
+	c.expires = time.Now().Add(max(lifetime-tokenExpiryMargin, lifetime/2))
+	return c.token, nil
+}
+
+// Invalidate drops the cached token
+func (c *clientCredentials) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = ""
+}
+
+// tokenCache keeps one token source per source and OAuth2 field, so setting
+// unchanged credentials again keeps the cached token
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]*clientCredentials
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{tokens: make(map[string]*clientCredentials)}
+}
+
+// get returns the token source for a field, replacing it when the
+// credentials or the token endpoint changed
+func (tc *tokenCache) get(sourceID string, field CredentialField, creds map[string]string) TokenSource {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	key := sourceID + "/" + field.Key
+	clientID, secret := creds[field.OAuth2.ClientIDKey], creds[field.Key]
+	if c, ok := tc.tokens[key]; ok && c.clientID == clientID && c.clientSecret == secret &&
+		c.config.TokenURL == field.OAuth2.TokenURL && slices.Equal(c.config.Scopes, field.OAuth2.Scopes) {
+		return c
+	}
+
+	c := NewClientCredentials(*field.OAuth2, clientID, secret, NewHTTPClient(sourceID)).(*clientCredentials)
+	tc.tokens[key] = c
+	return c
+}
+
+// SetCredentials sets the credentials and hands adapters with OAuth2 fields
+// a cached token source for each of them
+func (a sourceAdapter) SetCredentials(creds map[string]string) {
+	a.Adapter.SetCredentials(creds)
+
+	oauth, ok := a.Adapter.(OAuth2Adapter)
+	if !ok || a.tokens == nil {
+		return
+	}
+	for _, field := range a.Adapter.CredentialFields() {
+		if field.Type == CredentialTypeOAuth2 && field.OAuth2 != nil {
+			oauth.SetTokenSource(field.Key, a.tokens.get(a.ID(), field, creds))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+)
+
+// oauth2Adapter declares an OAuth2 field and records its token source
+type oauth2Adapter struct {
+	mockAdapter
+	tokenURL string
+	tokens   TokenSource
+}
+
+func (o *oauth2Adapter) CredentialFields() []CredentialField {
+	return []CredentialField{
+		{Key: "client_id", Type: "text"},
+		{Key: "client_secret", Type: CredentialTypeOAuth2, OAuth2: &OAuth2Config{TokenURL: o.tokenURL, ClientIDKey: "client_id", Scopes: []string{"read"}}},
+	}
+}
+
+func (o *oauth2Adapter) SetTokenSource(key string, tokens TokenSource) {
+	if key == "client_secret" {
+		o.tokens = tokens
+	}
+}
+
+func TestOAuth2TokenSource(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "read" || id != "app" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := requests.Add(1)
+		fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": "3600"}`, n)
+	}))
+	defer server.Close()
+
+	registry := NewRegistry(setupTestDB(t), &config.Config{})
+	adapter := &oauth2Adapter{mockAdapter: mockAdapter{id: "oauth", name: "OAuth"}, tokenURL: server.URL}
+	registry.Register(adapter)
+	registered, _ := registry.Get("oauth")
+	ctx := context.Background()
+
+	registered.SetCredentials(map[string]string{"client_id": "app", "client_secret": "s3cret"})
+	if adapter.tokens == nil {
+		t.Fatal("no token source set")
+	}
+	for range 2 {
+		if token, err := adapter.tokens.Token(ctx); err != nil || token != "token-1" {
+			t.Fatalf("Token() = %q, %v; want token-1", token, err)
+		}
+	}
+
+	// Setting the same credentials again keeps the cached token
+	registered.SetCredentials(map[string]string{"client_id": "app", "client_secret": "s3cret"})
+	if token, _ := adapter.tokens.Token(ctx); token != "token-1" {
+		t.Errorf("Token() after resetting credentials = %q, want the cached token-1", token)
+	}
+
+	adapter.tokens.Invalidate()
+	if token, _ := adapter.tokens.Token(ctx); token != "token-2" {
+		t.Errorf("Token() after Invalidate() = %q, want token-2", token)
+	}
+
+	registered.SetCredentials(map[string]string{"client_id": "app", "client_secret": "wrong"})
+	var adapterErr *AdapterError
+	if _, err := adapter.tokens.Token(ctx); !errors.As(err, &adapterErr) || adapterErr.Code != ErrCodeAuth {
+		t.Errorf("Token() with a wrong secret = %v, want an auth error", err)
+	}
+}
@@ -0,0 +1,403 @@
+// Package ops is a source adapter for EPO Open Patent Services. OPS has no
+// bulk files, so the adapter builds them: each configured CQL query is a
+// product, each publication week a delivery, and each page of search results
+// for that week a file.
+package ops
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+const (
+	SourceID   = "epo-ops"
+	SourceName = "EPO OPS"
+
+	searchPath = "/rest-services/published-data/search"
+
+	// pageSize is the largest range OPS returns per search request
+	pageSize = 100
+	// maxResults is the most results OPS returns for one query
+	maxResults = 2000
+
+	defaultLookbackWeeks = 4
+	maxLookbackWeeks     = 52
+)
+
+// constituents are the search result contents OPS offers
+var constituents = []string{"biblio", "abstract", "full-cycle"}
+
+// Adapter implements the sources.Adapter interface for EPO OPS
+type Adapter struct {
+	client      *client
+	credentials map[string]string
+	tokens      sources.TokenSource
+	baseURL     string
+}
+
+// New creates a new EPO OPS adapter
+func New() *Adapter {
+	return &Adapter{
+		credentials: make(map[string]string),
+	}
+}
+
+// ID returns the source identifier
+func (a *Adapter) ID() string {
+	return SourceID
+}
+
+// Name returns the human-readable source name
+func (a *Adapter) Name() string {
+	return SourceName
+}
+
+// CredentialFields returns the required credential fields
+func (a *Adapter) CredentialFields() []sources.CredentialField {
+	return []sources.CredentialField{
+		{
+			Key:      "consumer_key",
+			Label:    "Consumer Key",
+			Type:     "text",
+			Required: true,
+			HelpText: "Consumer key of your app at https://developers.epo.org",
+		},
+		{
+			Key:      "consumer_secret",
+			Label:    "Consumer Secret",
+			Type:     sources.CredentialTypeOAuth2,
+			Required: true,
+			HelpText: "Consumer secret of your app at https://developers.epo.org",
+			OAuth2:   oauth2Config(a.apiBaseURL()),
+		},
+		{
+			Key:      "queries",
+			Label:    "Queries",
+			Type:     "text",
+			Required: true,
+			HelpText: "CQL queries separated by semicolons, e.g. pa=siemens and ic=H01M; each becomes a product",
+		},
+		{
+			Key:      "constituent",
+			Label:    "Constituent",
+			Type:     "text",
+			HelpText: "Result content: biblio (default), abstract or full-cycle",
+		},
+		{
+			Key:      "lookback_weeks",
+			Label:    "Lookback Weeks",
+			Type:     "text",
+			HelpText: "Number of past publication weeks offered as deliveries (default 4)",
+		},
+	}
+}
+
+// SetCredentials sets the credentials for the adapter
+func (a *Adapter) SetCredentials(creds map[string]string) {
+	a.credentials = creds
+	a.client = nil // Reset client to force re-creation with new credentials
+	a.tokens = nil
+}
+
+// SetOptions sets the base URL override, e.g. for a gateway in front of OPS.
+// The token source is dropped since it requests tokens from the old URL.
+func (a *Adapter) SetOptions(opts sources.Options) {
+	a.baseURL = opts.BaseURL
+	a.client = nil
+	a.tokens = nil
+}
+
+// apiBaseURL returns the OPS base URL including the API version
+func (a *Adapter) apiBaseURL() string {
+	if a.baseURL != "" {
+		return a.baseURL
+	}
+	return defaultBaseURL
+}
+
+// SetTokenSource sets the source of access tokens for the consumer key and
+// secret, cached by the registry
+func (a *Adapter) SetTokenSource(key string, tokens sources.TokenSource) {
+	if key == "consumer_secret" {
+		a.tokens = tokens
+		a.client = nil
+	}
+}
+
+// ValidateCredentials requests an access token and checks the settings
+func (a *Adapter) ValidateCredentials(ctx context.Context) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+	if len(a.queries()) == 0 {
+		return sources.NewAdapterError(sources.ErrCodeInvalidConfig, "At least one query is required", nil)
+	}
+	if _, err := a.constituent(); err != nil {
+		return err
+	}
+	if _, err := a.lookbackWeeks(); err != nil {
+		return err
+	}
+
+	if _, err := client.tokens.Token(ctx); err != nil {
+		return sources.NewAdapterError(sources.ErrCodeAuth, "Failed to authenticate with EPO OPS", err)
+	}
+	return nil
+}
+
+// FetchProducts returns one product per configured query
+func (a *Adapter) FetchProducts(ctx context.Context) ([]sources.ProductInfo, error) {
+	if _, err := a.getClient(); err != nil {
+		return nil, err
+	}
+
+	var result []sources.ProductInfo
+	for _, q := range a.queries() {
+		result = append(result, sources.ProductInfo{
+			ExternalID:    queryID(q),
+			Name:          q,
+			Description:   "EPO OPS search results for " + q,
+			CheckSchedule: "0 6 * * 4", // EP publications appear on Wednesdays
+		})
+	}
+	return result, nil
+}
+
+// FetchDeliveries returns the last complete publication weeks. The running
+// week is left out so that the result pages of a delivery don't change.
+func (a *Adapter) FetchDeliveries(ctx context.Context, productID string) ([]sources.DeliveryInfo, error) {
+	if _, err := a.query(productID); err != nil {
+		return nil, err
+	}
+	weeks, err := a.lookbackWeeks()
+	if err != nil {
+		return nil, err
+	}
+
+	monday := weekStart(time.Now().UTC())
+	result := make([]sources.DeliveryInfo, 0, weeks)
+	for i := 1; i <= weeks; i++ {
+		start := monday.AddDate(0, 0, -7*i)
+		result = append(result, sources.DeliveryInfo{
+			ExternalID:  weekID(start),
+			Name:        "Week " + weekID(start),
+			PublishedAt: start,
+		})
+	}
+	return result, nil
+}
+
+// FetchFiles counts the week's results and returns one file per page
+func (a *Adapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]sources.FileInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+	q, err := a.query(productID)
+	if err != nil {
+		return nil, err
+	}
+	constituent, err := a.constituent()
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseWeekID(deliveryID)
+	if err != nil {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid delivery ID", err)
+	}
+
+	weekQuery := fmt.Sprintf(`(%s) and pd within "%s %s"`, q, start.Format("20060102"), start.AddDate(0, 0, 6).Format("20060102"))
+	total, err := a.count(ctx, client, weekQuery)
+	if err != nil {
+		return nil, err
+	}
+	if total > maxResults {
+		total = maxResults
+	}
+
+	var result []sources.FileInfo
+	for from := 1; from <= total; from += pageSize {
+		to := min(from+pageSize-1, total)
+		name := fmt.Sprintf("%s-%s-%04d-%04d.xml", deliveryID, constituent, from, to)
+		query := url.Values{"q": {weekQuery}, "Range": {fmt.Sprintf("%d-%d", from, to)}}
+		result = append(result, sources.FileInfo{
+			ExternalID:  name,
+			FileName:    name,
+			DownloadURI: searchPath + "/" + constituent + "?" + query.Encode(),
+			ReleasedAt:  start.AddDate(0, 0, 7),
+		})
+	}
+	return result, nil
+}
+
+// DownloadFile retrieves a page of search results
+func (a *Adapter) DownloadFile(ctx context.Context, file sources.FileInfo, dst io.Writer, progress sources.ProgressFunc) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	path, rawQuery, _ := strings.Cut(file.DownloadURI, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil || !strings.HasPrefix(path, searchPath+"/") {
+		return sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid download URI", err)
+	}
+
+	resp, err := client.get(ctx, "search", path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	written, err := io.Copy(dst, resp.Body)
+	if err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(written, written)
+	}
+	return nil
+}
+
+var totalRegex = regexp.MustCompile(`total-result-count="(\d+)"`)
+
+// count returns the number of results of a query
+func (a *Adapter) count(ctx context.Context, client *client, query string) (int, error) {
+	resp, err := client.get(ctx, "search", searchPath, url.Values{"q": {query}, "Range": {"1-1"}})
+	var adapterErr *sources.AdapterError
+	if errors.As(err, &adapterErr) && adapterErr.Code == sources.ErrCodeNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, sources.NewAdapterError(sources.ErrCodeNetwork, "Failed to read search result", err)
+	}
+	m := totalRegex.FindSubmatch(body)
+	if m == nil {
+		return 0, sources.NewAdapterError(sources.ErrCodeNetwork, "Search result without count", nil)
+	}
+	total, _ := strconv.Atoi(string(m[1]))
+	return total, nil
+}
+
+func (a *Adapter) getClient() (*client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	key := a.credentials["consumer_key"]
+	secret := a.credentials["consumer_secret"]
+	if key == "" || secret == "" {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Missing credentials", nil)
+	}
+
+	httpClient := sources.NewHTTPClient(SourceID)
+	tokens := a.tokens
+	if tokens == nil {
+		tokens = sources.NewClientCredentials(*oauth2Config(a.apiBaseURL()), key, secret, httpClient)
+	}
+	a.client = &client{
+		baseURL:    strings.TrimSuffix(a.apiBaseURL(), "/"),
+		tokens:     tokens,
+		httpClient: httpClient,
+		throttle:   newThrottle(),
+	}
+	return a.client, nil
+}
+
+func (a *Adapter) queries() []string {
+	var queries []string
+	for _, q := range strings.Split(a.credentials["queries"], ";") {
+		if q = strings.TrimSpace(q); q != "" {
+			queries = append(queries, q)
+		}
+	}
+	return queries
+}
+
+// query maps a product ID back to its configured query
+func (a *Adapter) query(productID string) (string, error) {
+	for _, q := range a.queries() {
+		if queryID(q) == productID {
+			return q, nil
+		}
+	}
+	return "", sources.NewAdapterError(sources.ErrCodeNotFound, "Query is no longer configured", nil)
+}
+
+func (a *Adapter) constituent() (string, error) {
+	value := a.credentials["constituent"]
+	if value == "" {
+		return constituents[0], nil
+	}
+	for _, c := range constituents {
+		if value == c {
+			return c, nil
+		}
+	}
+	return "", sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Constituent must be one of "+strings.Join(constituents, ", "), nil)
+}
+
+func (a *Adapter) lookbackWeeks() (int, error) {
+	value := a.credentials["lookback_weeks"]
+	if value == "" {
+		return defaultLookbackWeeks, nil
+	}
+	weeks, err := strconv.Atoi(value)
+	if err != nil || weeks < 1 || weeks > maxLookbackWeeks {
+		return 0, sources.NewAdapterError(sources.ErrCodeInvalidConfig,
+			fmt.Sprintf("Lookback weeks must be between 1 and %d", maxLookbackWeeks), err)
+	}
+	return weeks, nil
+}
+
+// queryID derives a product ID from a query, which can contain characters
+// not allowed in API paths
+func queryID(q string) string {
+	sum := sha1.Sum([]byte(q))
+	return hex.EncodeToString(sum[:8])
+}
+
+// weekStart returns the Monday of t's ISO week
+func weekStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// weekID formats the ISO week starting on monday, e.g. "2025-W11"
+func weekID(monday time.Time) string {
+	year, week := monday.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// parseWeekID returns the Monday of an ISO week ID
+func parseWeekID(id string) (time.Time, error) {
+	var year, week int
+	if _, err := fmt.Sscanf(id, "%d-W%d", &year, &week); err != nil || week < 1 || week > 53 {
+		return time.Time{}, fmt.Errorf("%q is not an ISO week", id)
+	}
+	// January 4th is always in week 1
+	monday := weekStart(time.Date(year, 1, 4, 0, 0, 0, 0, time.UTC)).AddDate(0, 0, 7*(week-1))
+	if weekID(monday) != id {
+		return time.Time{}, fmt.Errorf("%q is not an ISO week", id)
+	}
+	return monday, nil
+}
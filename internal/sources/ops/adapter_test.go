@@ -0,0 +1,142 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+func TestThrottle(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	th := newThrottle()
+	th.now = func() time.Time { return now }
+
+	th.update("busy (images=green:200, inpadoc=green:60, other=green:1000, retrieval=green:200, search=yellow:15)")
+	if got := th.interval["search"]; got != 4*time.Second {
+		t.Errorf("search interval = %v, want 4s", got)
+	}
+
+	th.update("overloaded (search=black:0)")
+	if !th.blockedUntil.Equal(now.Add(time.Minute)) {
+		t.Errorf("blockedUntil = %v, want a minute from now", th.blockedUntil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := th.wait(ctx, "search")
+	if adapterErr, ok := err.(*sources.AdapterError); !ok || adapterErr.Code != sources.ErrCodeRateLimit {
+		t.Errorf("wait() while blocked = %v, want a rate limit error", err)
+	}
+}
+
+func TestWeekID(t *testing.T) {
+	monday, err := parseWeekID("2025-W11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC); !monday.Equal(want) {
+		t.Errorf("parseWeekID(2025-W11) = %v, want %v", monday, want)
+	}
+	// 2024-12-30 belongs to the first week of 2025
+	if got := weekID(weekStart(time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC))); got != "2025-W01" {
+		t.Errorf("weekID() = %s, want 2025-W01", got)
+	}
+	if _, err := parseWeekID("2025-W53"); err == nil {
+		t.Error("parseWeekID() accepted a week 2025 doesn't have")
+	}
+}
+
+func TestAdapter(t *testing.T) {
+	var tokens atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/accesstoken", func(w http.ResponseWriter, r *http.Request) {
+		if key, secret, _ := r.BasicAuth(); key != "key" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		tokens.Add(1)
+		fmt.Fprint(w, `{"access_token":"abc","expires_in":"1199"}`)
+	})
+	mux.HandleFunc("/rest-services/published-data/search/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Throttling-Control", "idle (search=green:600)")
+		if !strings.Contains(r.URL.Query().Get("q"), `pd within "20250310 20250316"`) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `<ops:biblio-search total-result-count="250"><range>%s</range></ops:biblio-search>`, r.URL.Query().Get("Range"))
+	})
+	mux.HandleFunc("/rest-services/published-data/search", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Query().Get("q"), "20250310") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `<ops:biblio-search total-result-count="250"/>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	ctx := context.Background()
+
+	tokenConfig := sources.OAuth2Config{TokenURL: server.URL + "/auth/accesstoken"}
+
+	a := New()
+	a.SetCredentials(map[string]string{"consumer_key": "key", "consumer_secret": "secret", "queries": "pa=acme; ic=H01M"})
+	a.SetTokenSource("consumer_secret", sources.NewClientCredentials(tokenConfig, "key", "secret", server.Client()))
+	client, err := a.getClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.baseURL = server.URL
+
+	products, err := a.FetchProducts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 2 || products[0].Name != "pa=acme" {
+		t.Fatalf("FetchProducts() = %+v, want one product per query", products)
+	}
+
+	files, err := a.FetchFiles(ctx, products[0].ExternalID, "2025-W11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || files[2].FileName != "2025-W11-biblio-0201-0250.xml" {
+		t.Fatalf("FetchFiles() = %+v, want three pages", files)
+	}
+
+	var buf bytes.Buffer
+	if err := a.DownloadFile(ctx, files[2], &buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<range>201-250</range>") {
+		t.Errorf("downloaded %q, want the third page", buf.String())
+	}
+
+	files, err = a.FetchFiles(ctx, products[0].ExternalID, "2025-W10")
+	if err != nil || len(files) != 0 {
+		t.Errorf("FetchFiles() for a week without results = %v, %v; want none", files, err)
+	}
+	if n := tokens.Load(); n != 1 {
+		t.Errorf("requested %d tokens, want 1", n)
+	}
+
+	a.SetCredentials(map[string]string{"consumer_key": "key", "consumer_secret": "wrong", "queries": "pa=acme"})
+	a.SetTokenSource("consumer_secret", sources.NewClientCredentials(tokenConfig, "key", "wrong", server.Client()))
+	client, _ = a.getClient()
+	client.baseURL = server.URL
+	err = a.ValidateCredentials(ctx)
+	if adapterErr, ok := err.(*sources.AdapterError); !ok || adapterErr.Code != sources.ErrCodeAuth {
+		t.Errorf("ValidateCredentials() = %v, want an auth error", err)
+	}
+}
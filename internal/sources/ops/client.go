@@ -0,0 +1,181 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+const defaultBaseURL = "https://ops.epo.org/3.2"
+
+// oauth2Config requests OPS access tokens with the consumer key and secret
+func oauth2Config(baseURL string) *sources.OAuth2Config {
+	return &sources.OAuth2Config{
+		TokenURL:    strings.TrimSuffix(baseURL, "/") + "/auth/accesstoken",
+		ClientIDKey: "consumer_key",
+	}
+}
+
+// client calls OPS with an access token from the client credentials grant
+// and paces requests according to the throttling header of each response
+type client struct {
+	baseURL    string
+	tokens     sources.TokenSource
+	httpClient *http.Client
+
+	throttle *throttle
+}
+
+// get calls an OPS service path such as "/rest-services/published-data/search"
+// and returns the response for the caller to read and close. service is the
+// throttling category of the path ("search", "retrieval", ...).
+func (c *client) get(ctx context.Context, service, path string, query url.Values) (*http.Response, error) {
+	if err := c.throttle.wait(ctx, service); err != nil {
+		return nil, err
+	}
+
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/xml")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, sources.NewAdapterError(sources.ErrCodeNetwork, "Request failed", err)
+	}
+	c.throttle.update(resp.Header.Get("X-Throttling-Control"))
+
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	err = fmt.Errorf("GET %s: status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusForbidden && strings.Contains(string(body), "Fair Use"):
+		c.throttle.block(retryAfter(resp.Header.Get("Retry-After")))
+		return nil, sources.NewAdapterError(sources.ErrCodeRateLimit, "OPS fair use limit reached", err)
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		c.tokens.Invalidate() // Expired or revoked; the next request gets a new one
+		return nil, sources.NewAdapterError(sources.ErrCodeAuth, "Access denied", err)
+	case resp.StatusCode == http.StatusNotFound:
+		// OPS answers 404 for searches without results
+		return nil, sources.NewAdapterError(sources.ErrCodeNotFound, "No results", err)
+	}
+	return nil, sources.NewAdapterError(sources.ErrCodeNetwork, "Unexpected response", err)
+}
+
+// retryAfter parses a Retry-After header in seconds, defaulting to a minute
+func retryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Minute
+}
+
+// throttleRegex matches the per-service entries of X-Throttling-Control,
+// e.g. "idle (images=green:200, search=yellow:15, ...)"
+var throttleRegex = regexp.MustCompile(`(\w+)=(green|yellow|red|black):(\d+)`)
+
+// throttle spaces requests so each service stays within the number of
+// requests per minute OPS last reported for it, and pauses all requests when
+// a service is blocked
+type throttle struct {
+	mu           sync.Mutex
+	interval     map[string]time.Duration
+	next         map[string]time.Time
+	blockedUntil time.Time
+	now          func() time.Time
+}
+
+func newThrottle() *throttle {
+	return &throttle{
+		interval: make(map[string]time.Duration),
+		next:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// update records the limits from a throttling header
+func (t *throttle) update(header string) {
+	matches := throttleRegex.FindAllStringSubmatch(header, -1)
+	if len(matches) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, m := range matches {
+		service, color := m[1], m[2]
+		perMinute, _ := strconv.Atoi(m[3])
+		switch {
+		case color == "black":
+			t.blockedUntil = t.now().Add(time.Minute)
+		case perMinute > 0:
+			t.interval[service] = time.Minute / time.Duration(perMinute)
+		}
+	}
+}
+
+// block pauses all requests for d
+func (t *throttle) block(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := t.now().Add(d); until.After(t.blockedUntil) {
+		t.blockedUntil = until
+	}
+}
+
+// wait blocks until a request to service is allowed. A block longer than the
+// context allows returns a rate limit error instead of waiting.
+func (t *throttle) wait(ctx context.Context, service string) error {
+	t.mu.Lock()
+	now := t.now()
+	start := now
+	if t.blockedUntil.After(start) {
+		start = t.blockedUntil
+	}
+	if next := t.next[service]; next.After(start) {
+		start = next
+	}
+	t.next[service] = start.Add(t.interval[service])
+	t.mu.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && delay > time.Until(deadline) {
+		return sources.NewAdapterError(sources.ErrCodeRateLimit, "OPS rate limit", fmt.Errorf("next request allowed in %s", delay.Round(time.Second)))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,78 @@
+package sources
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sync"
+)
+
+// Options are per-source connection settings, e.g. to reach an office's test
+// environment or to go through a gateway appliance
+type Options struct {
+	// BaseURL replaces the API base URL of adapters implementing OptionsAdapter
+	BaseURL string `json:"baseUrl,omitempty"`
+	// Headers are added to every request made with the source's NewHTTPClient
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Validate checks the base URL and header names
+func (o Options) Validate() error {
+	if o.BaseURL != "" {
+		u, err := url.Parse(o.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid base URL %q", o.BaseURL)
+		}
+	}
+	for name := range o.Headers {
+		if name == "" || textproto.CanonicalMIMEHeaderKey(name) == "Host" {
+			return fmt.Errorf("invalid header %q", name)
+		}
+	}
+	return nil
+}
+
+// OptionsAdapter is implemented by adapters whose API base URL is not part of
+// their credentials. The registry sets the options before the credentials.
+type OptionsAdapter interface {
+	SetOptions(opts Options)
+}
+
+var (
+	headersMu     sync.RWMutex
+	sourceHeaders = map[string]map[string]string{}
+)
+
+// setSourceHeaders sets the extra headers for a source's requests
+func setSourceHeaders(sourceID string, headers map[string]string) {
+	headersMu.Lock()
+	defer headersMu.Unlock()
+	if len(headers) == 0 {
+		delete(sourceHeaders, sourceID)
+		return
+	}
+	sourceHeaders[sourceID] = headers
+}
+
+// headerTransport adds the source's extra headers to each request
+type headerTransport struct {
+	sourceID string
+	base     http.RoundTripper
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	headersMu.RLock()
+	headers := sourceHeaders[t.sourceID]
+	headersMu.RUnlock()
+	if len(headers) == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return t.base.RoundTrip(req)
+}
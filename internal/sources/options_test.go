@@ -0,0 +1,77 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+)
+
+// optionsAdapter records the options it was given
+type optionsAdapter struct {
+	mockAdapter
+	opts Options
+}
+
+func (o *optionsAdapter) SetOptions(opts Options) {
+	o.opts = opts
+}
+
+func TestUpdateOptions(t *testing.T) {
+	var gateway string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gateway = r.Header.Get("X-Gateway-Key")
+	}))
+	defer server.Close()
+
+	db := setupTestDB(t)
+	registry := NewRegistry(db, &config.Config{})
+	adapter := &optionsAdapter{mockAdapter: mockAdapter{id: "test-source", name: "Test Source"}}
+	registry.Register(adapter)
+	t.Cleanup(func() { setSourceHeaders("test-source", nil) })
+
+	if err := registry.UpdateOptions("test-source", Options{BaseURL: "ftp://test"}, &mockCryptor{}); err == nil {
+		t.Error("UpdateOptions() accepted a non-HTTP base URL")
+	}
+
+	opts := Options{BaseURL: "https://test.example.org/api", Headers: map[string]string{"X-Gateway-Key": "k1"}}
+	if err := registry.UpdateOptions("test-source", opts, &mockCryptor{}); err != nil {
+		t.Fatal(err)
+	}
+	if adapter.opts.BaseURL != opts.BaseURL {
+		t.Errorf("adapter base URL = %q, want %q", adapter.opts.BaseURL, opts.BaseURL)
+	}
+	info, _ := registry.GetSource("test-source")
+	if info.BaseURL != opts.BaseURL || len(info.HeaderNames) != 1 || info.HeaderNames[0] != "X-Gateway-Key" {
+		t.Errorf("SourceInfo = %+v, want the base URL and header name", info)
+	}
+
+	if _, err := NewHTTPClient("test-source").Get(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if gateway != "k1" {
+		t.Errorf("X-Gateway-Key = %q, want k1", gateway)
+	}
+
+	// Updating credentials keeps the options, and they are restored on startup
+	if err := registry.UpdateSource(context.Background(), "test-source", true, map[string]string{"api_key": "secret"}, &mockCryptor{}); err != nil {
+		t.Fatal(err)
+	}
+	setSourceHeaders("test-source", nil)
+	restarted := NewRegistry(db, &config.Config{})
+	reloaded := &optionsAdapter{mockAdapter: mockAdapter{id: "test-source", name: "Test Source"}}
+	restarted.Register(reloaded)
+	if err := restarted.LoadCredentialsWithDecryptor(&mockCryptor{}); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.opts.BaseURL != opts.BaseURL || reloaded.creds["api_key"] != "secret" {
+		t.Errorf("reloaded options %+v, credentials %v", reloaded.opts, reloaded.creds)
+	}
+	gateway = ""
+	NewHTTPClient("test-source").Get(server.URL)
+	if gateway != "k1" {
+		t.Errorf("X-Gateway-Key after reload = %q, want k1", gateway)
+	}
+}
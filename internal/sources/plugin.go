@@ -0,0 +1,355 @@
+package sources
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Plugins are executables that implement an adapter. Each adapter call runs
+// the executable once: the request is written to its stdin as one JSON object
+//
+//	{"method": "fetchFiles", "credentials": {...}, "params": {"productId": "...", "deliveryId": "..."}}
+//
+// and the plugin answers on stdout with JSON lines, ending with either
+// {"result": ...} or {"error": {"code": "AUTH_ERROR", "message": "..."}}.
+// For downloadFile it first writes the file as {"data": "<base64>"} lines.
+// Methods are describe, validateCredentials, fetchProducts, fetchDeliveries,
+// fetchFiles and downloadFile; results use the JSON form of the adapter
+// types.
+
+const (
+	// pluginDescribeTimeout limits how long discovery waits for a plugin
+	pluginDescribeTimeout = 10 * time.Second
+	// maxPluginLine limits the size of one line of plugin output
+	maxPluginLine = 16 << 20
+	// maxPluginStderr is how much of a plugin's stderr is kept for errors
+	maxPluginStderr = 4 << 10
+)
+
+// ErrUnsafeName is returned for a name from a plugin that isn't safe as a path
+// element under the downloads directory
+var ErrUnsafeName = errors.New("unsafe name")
+
+// CheckName reports whether name, as returned by a plugin, is a single local
+// path element. File names and the external IDs that make up product and file
+// IDs end up in download paths.
+func CheckName(name string) error {
+	if name == "." || !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w: %q", ErrUnsafeName, name)
+	}
+	return nil
+}
+
+type pluginRequest struct {
+	Method      string            `json:"method"`
+	Credentials map[string]string `json:"credentials,omitempty"`
+	Params      any               `json:"params,omitempty"`
+}
+
+type pluginResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Data []byte `json:"data"` // base64 in JSON
+}
+
+type pluginDescription struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	CredentialFields []CredentialField `json:"credentialFields"`
+}
+
+// PluginAdapter is an adapter implemented by an external executable
+type PluginAdapter struct {
+	path        string
+	desc        pluginDescription
+	credentials map[string]string
+}
+
+// NewPluginAdapter runs the executable at path to ask for its ID, name and
+// credential fields
+func NewPluginAdapter(ctx context.Context, path string) (*PluginAdapter, error) {
+	ctx, cancel := context.WithTimeout(ctx, pluginDescribeTimeout)
+	defer cancel()
+
+	p := &PluginAdapter{path: path, credentials: make(map[string]string)}
+	if err := p.call(ctx, "describe", nil, &p.desc, nil); err != nil {
+		return nil, err
+	}
+	if p.desc.ID == "" || strings.ContainsAny(p.desc.ID, "/: ") {
+		return nil, fmt.Errorf("plugin %s: invalid source ID %q", path, p.desc.ID)
+	}
+	if p.desc.Name == "" {
+		p.desc.Name = p.desc.ID
+	}
+	return p, nil
+}
+
+// ID returns the source identifier
+func (p *PluginAdapter) ID() string {
+	return p.desc.ID
+}
+
+// Name returns the human-readable source name
+func (p *PluginAdapter) Name() string {
+	return p.desc.Name
+}
+
+// CredentialFields returns the credential fields the plugin described
+func (p *PluginAdapter) CredentialFields() []CredentialField {
+	return p.desc.CredentialFields
+}
+
+// SetCredentials sets the credentials sent with each call
+func (p *PluginAdapter) SetCredentials(creds map[string]string) {
+	p.credentials = creds
+}
+
+// ValidateCredentials asks the plugin to check its credentials
+func (p *PluginAdapter) ValidateCredentials(ctx context.Context) error {
+	return p.call(ctx, "validateCredentials", nil, nil, nil)
+}
+
+// FetchProducts asks the plugin for its products
+func (p *PluginAdapter) FetchProducts(ctx context.Context) ([]ProductInfo, error) {
+	var result []ProductInfo
+	if err := p.call(ctx, "fetchProducts", nil, &result, nil); err != nil {
+		return nil, err
+	}
+	for _, info := range result {
+		if err := CheckName(info.ExternalID); err != nil {
+			return nil, fmt.Errorf("plugin %s: product: %w", p.desc.ID, err)
+		}
+	}
+	return result, nil
+}
+
+// FetchDeliveries asks the plugin for the deliveries of a product
+func (p *PluginAdapter) FetchDeliveries(ctx context.Context, productID string) ([]DeliveryInfo, error) {
+	var result []DeliveryInfo
+	params := map[string]string{"productId": productID}
+	if err := p.call(ctx, "fetchDeliveries", params, &result, nil); err != nil {
+		return nil, err
+	}
+	for _, info := range result {
+		if err := CheckName(info.ExternalID); err != nil {
+			return nil, fmt.Errorf("plugin %s: delivery: %w", p.desc.ID, err)
+		}
+	}
+	return result, nil
+}
+
+// FetchFiles asks the plugin for the files of a delivery
+func (p *PluginAdapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]FileInfo, error) {
+	var result []FileInfo
+	params := map[string]string{"productId": productID, "deliveryId": deliveryID}
+	if err := p.call(ctx, "fetchFiles", params, &result, nil); err != nil {
+		return nil, err
+	}
+	for _, info := range result {
+		if err := errors.Join(CheckName(info.ExternalID), CheckName(info.FileName)); err != nil {
+			return nil, fmt.Errorf("plugin %s: file: %w", p.desc.ID, err)
+		}
+	}
+	return result, nil
+}
+
+// DownloadFile streams a file from the plugin's data lines
+func (p *PluginAdapter) DownloadFile(ctx context.Context, file FileInfo, dst io.Writer, progress ProgressFunc) error {
+	var written int64
+	return p.call(ctx, "downloadFile", map[string]FileInfo{"file": file}, nil, func(data []byte) error {
+		if _, err := dst.Write(data); err != nil {
+			return err
+		}
+		written += int64(len(data))
+		if progress != nil {
+			progress(written, file.FileSize)
+		}
+		return nil
+	})
+}
+
+// call runs the plugin for one method. result receives the final result;
+// onData, if set, receives the data lines.
+func (p *PluginAdapter) call(ctx context.Context, method string, params, result any, onData func([]byte) error) error {
+	request, err := json.Marshal(pluginRequest{Method: method, Credentials: p.credentials, Params: params})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Stdin = bytes.NewReader(append(request, '\n'))
+	cmd.Env = pluginEnv(SourceFromContext(ctx))
+	stderr := &limitedBuffer{limit: maxPluginStderr}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return NewAdapterError(ErrCodeInvalidConfig, "Failed to start plugin", err)
+	}
+
+	response, readErr := readPluginOutput(stdout, onData)
+	if readErr != nil {
+		cancel() // Stop a plugin that is still writing
+	}
+	waitErr := cmd.Wait()
+
+	switch {
+	case readErr != nil:
+		return readErr
+	case response == nil && waitErr != nil:
+		return NewAdapterError(ErrCodeNetwork, "Plugin failed", pluginError(waitErr, stderr))
+	case response == nil:
+		return NewAdapterError(ErrCodeNetwork, "Plugin exited without a result", pluginError(nil, stderr))
+	case response.Error != nil:
+		code := response.Error.Code
+		if code == "" {
+			code = ErrCodeNetwork
+		}
+		return NewAdapterError(code, response.Error.Message, nil)
+	}
+
+	if result != nil && len(response.Result) > 0 {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			return NewAdapterError(ErrCodeNetwork, "Invalid plugin result", err)
+		}
+	}
+	return nil
+}
+
+// readPluginOutput passes data lines to onData and returns the final
+// response, or nil if the output ended without one
+func readPluginOutput(r io.Reader, onData func([]byte) error) (*pluginResponse, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxPluginLine)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var response pluginResponse
+		if err := json.Unmarshal(line, &response); err != nil {
+			return nil, NewAdapterError(ErrCodeNetwork, "Invalid plugin output", err)
+		}
+		if response.Error != nil || response.Result != nil {
+			return &response, nil
+		}
+		if response.Data != nil {
+			if onData == nil {
+				return nil, NewAdapterError(ErrCodeNetwork, "Unexpected data from plugin", nil)
+			}
+			if err := onData(response.Data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, NewAdapterError(ErrCodeNetwork, "Failed to read plugin output", err)
+	}
+	return nil, nil
+}
+
+// pluginEnv returns the environment for a plugin process. A proxy override
+// for the source replaces the proxy variables, so plugins honour it like
+// the built-in adapters.
+func pluginEnv(sourceID string) []string {
+	env := os.Environ()
+	proxyMu.RLock()
+	proxy, ok := sourceProxies[sourceID]
+	proxyMu.RUnlock()
+	if sourceID == "" || !ok {
+		return env
+	}
+
+	value := ""
+	if proxy != nil {
+		value = proxy.String()
+	}
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		env = append(env, name+"="+value)
+	}
+	if proxy == nil {
+		env = append(env, "NO_PROXY=*", "no_proxy=*")
+	}
+	return env
+}
+
+func pluginError(err error, stderr *limitedBuffer) error {
+	msg := strings.TrimSpace(stderr.String())
+	switch {
+	case err != nil && msg != "":
+		return fmt.Errorf("%w: %s", err, msg)
+	case err != nil:
+		return err
+	case msg != "":
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// LoadPlugins registers an adapter for each executable in the configured
+// plugin directory. Plugins that fail to describe themselves or reuse a
+// registered source ID are skipped with a warning.
+func (r *Registry) LoadPlugins(ctx context.Context) error {
+	dir := r.cfg.PluginDir
+	if dir == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read plugin directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		plugin, err := NewPluginAdapter(ctx, path)
+		if err != nil {
+			slog.Warn("Skipping source plugin", "path", path, "error", err)
+			continue
+		}
+		if _, exists := r.Get(plugin.ID()); exists {
+			slog.Warn("Skipping source plugin with duplicate ID", "path", path, "id", plugin.ID())
+			continue
+		}
+
+		r.Register(plugin)
+		slog.Info("Loaded source plugin", "path", path, "id", plugin.ID())
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+)
+
+// testPlugin answers each method with a fixed response
+const testPlugin = `#!/bin/sh
+read -r request
+case "$request" in
+*'"describe"'*)
+  echo '{"result": {"id": "example", "name": "Example Office", "credentialFields": [{"key": "token", "label": "Token", "type": "password", "required": true}]}}' ;;
+*'"validateCredentials"'*'"token":"good"'*)
+  echo '{"result": null}' ;;
+*'"validateCredentials"'*)
+  echo '{"error": {"code": "AUTH_ERROR", "message": "bad token"}}' ;;
+*'"fetchFiles"'*'"deliveryId":"2025-11"'*)
+  echo '{"result": [{"externalId": "a", "fileName": "a.zip", "fileSize": 5, "downloadUri": "a.zip"}]}' ;;
+*'"fetchFiles"'*)
+  echo '{"result": [{"externalId": "b", "fileName": "../../b.zip", "fileSize": 5, "downloadUri": "b.zip"}]}' ;;
+*'"downloadFile"'*)
+  echo '{"data": "aGVs"}'
+  echo '{"data": "bG8="}'
+  echo '{"result": null}' ;;
+*)
+  echo "unsupported" >&2
+  exit 3 ;;
+esac
+`
+
+func writePlugin(t *testing.T, dir, name, script string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	for name, ok := range map[string]bool{
+		"a.zip": true, "2025:11": true, "..a": true,
+		"": false, ".": false, "..": false, "../a.zip": false, "a/b.zip": false, `a\b.zip`: false, "/a.zip": false,
+	} {
+		if err := CheckName(name); (err == nil) != ok {
+			t.Errorf("CheckName(%q) = %v, want ok %v", name, err, ok)
+		}
+	}
+}
+
+func TestLoadPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin test uses a shell script")
+	}
+	dir := t.TempDir()
+	writePlugin(t, dir, "example", testPlugin)
+	writePlugin(t, dir, "broken", "#!/bin/sh\nexit 1\n")
+	os.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0644)
+
+	registry := NewRegistry(setupTestDB(t), &config.Config{PluginDir: dir})
+	registry.Register(&mockAdapter{id: "epo", name: "EPO"})
+	if err := registry.LoadPlugins(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(registry.List()); n != 2 {
+		t.Fatalf("registered %d adapters, want EPO and the example plugin", n)
+	}
+
+	adapter, ok := registry.Get("example")
+	if !ok {
+		t.Fatal("example plugin not registered")
+	}
+	if adapter.Name() != "Example Office" || len(adapter.CredentialFields()) != 1 {
+		t.Errorf("plugin description = %s %+v", adapter.Name(), adapter.CredentialFields())
+	}
+	ctx := context.Background()
+
+	adapter.SetCredentials(map[string]string{"token": "bad"})
+	var adapterErr *AdapterError
+	if err := adapter.ValidateCredentials(ctx); !errors.As(err, &adapterErr) || adapterErr.Code != ErrCodeAuth {
+		t.Errorf("ValidateCredentials() = %v, want an auth error", err)
+	}
+	adapter.SetCredentials(map[string]string{"token": "good"})
+	if err := adapter.ValidateCredentials(ctx); err != nil {
+		t.Errorf("ValidateCredentials() = %v", err)
+	}
+
+	files, err := adapter.FetchFiles(ctx, "grants", "2025-11")
+	if err != nil || len(files) != 1 || files[0].FileName != "a.zip" {
+		t.Fatalf("FetchFiles() = %+v, %v", files, err)
+	}
+
+	if _, err := adapter.FetchFiles(ctx, "grants", "2025-12"); !errors.Is(err, ErrUnsafeName) {
+		t.Errorf("FetchFiles() with a name outside the directory = %v, want ErrUnsafeName", err)
+	}
+
+	var buf bytes.Buffer
+	var written int64
+	err = adapter.DownloadFile(ctx, files[0], &buf, func(n, total int64) { written = n })
+	if err != nil || buf.String() != "hello" || written != 5 {
+		t.Errorf("DownloadFile() = %q (%d bytes reported), %v", buf.String(), written, err)
+	}
+
+	_, err = adapter.FetchProducts(ctx)
+	if err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("FetchProducts() = %v, want the plugin's stderr", err)
+	}
+}
@@ -0,0 +1,124 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyDirect disables the proxy for a source
+const ProxyDirect = "direct"
+
+type sourceKey struct{}
+
+// WithSource marks outgoing requests made with ctx as belonging to a source,
+// so they use that source's proxy
+func WithSource(ctx context.Context, sourceID string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, sourceID)
+}
+
+// SourceFromContext returns the source ID set by WithSource
+func SourceFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(sourceKey{}).(string)
+	return id
+}
+
+var (
+	proxyMu       sync.RWMutex
+	sourceProxies = map[string]*url.URL{}
+)
+
+// ConfigureProxy sets per-source proxy overrides and installs the proxy
+// selection on http.DefaultTransport, which the EPO and USPTO client
+// libraries use. Sources without an override use HTTP_PROXY, HTTPS_PROXY
+// and NO_PROXY. An override of "direct" bypasses any proxy.
+func ConfigureProxy(overrides map[string]string) error {
+	parsed := make(map[string]*url.URL, len(overrides))
+	for id, raw := range overrides {
+		if strings.EqualFold(raw, ProxyDirect) {
+			parsed[id] = nil
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid proxy URL for source %s: %q", id, raw)
+		}
+		parsed[id] = u
+	}
+
+	proxyMu.Lock()
+	sourceProxies = parsed
+	proxyMu.Unlock()
+
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t.Proxy = ProxyFunc
+	}
+	return nil
+}
+
+// ProxyFunc selects the proxy for a request based on the source stored in its
+// context, falling back to the environment
+func ProxyFunc(req *http.Request) (*url.URL, error) {
+	if id := SourceFromContext(req.Context()); id != "" {
+		proxyMu.RLock()
+		u, ok := sourceProxies[id]
+		proxyMu.RUnlock()
+		if ok {
+			return u, nil
+		}
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// NewHTTPClient returns an HTTP client for adapters that build their own
+// client instead of using a library. Its requests use the source's proxy
+// even when made without a WithSource context, and carry the source's extra
+// headers.
+func NewHTTPClient(sourceID string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return ProxyFunc(req.WithContext(WithSource(req.Context(), sourceID)))
+	}
+	return &http.Client{Transport: headerTransport{sourceID: sourceID, base: transport}}
+}
+
+// sourceAdapter attaches the source ID to the context of every adapter call
+// and provides OAuth2 tokens from the registry's cache
+type sourceAdapter struct {
+	Adapter
+	tokens *tokenCache
+}
+
+// Unwrap returns the registered adapter
+func (a sourceAdapter) Unwrap() Adapter {
+	return a.Adapter
+}
+
+func (a sourceAdapter) ValidateCredentials(ctx context.Context) error {
+	return a.Adapter.ValidateCredentials(WithSource(ctx, a.ID()))
+}
+
+func (a sourceAdapter) FetchProducts(ctx context.Context) ([]ProductInfo, error) {
+	return a.Adapter.FetchProducts(WithSource(ctx, a.ID()))
+}
+
+func (a sourceAdapter) FetchDeliveries(ctx context.Context, productID string) ([]DeliveryInfo, error) {
+	return a.Adapter.FetchDeliveries(WithSource(ctx, a.ID()), productID)
+}
+
+func (a sourceAdapter) FetchDeliveriesSince(ctx context.Context, productID string, since time.Time) ([]DeliveryInfo, error) {
+	return FetchDeliveriesSince(WithSource(ctx, a.ID()), a.Adapter, productID, since)
+}
+
+func (a sourceAdapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]FileInfo, error) {
+	return a.Adapter.FetchFiles(WithSource(ctx, a.ID()), productID, deliveryID)
+}
+
+func (a sourceAdapter) DownloadFile(ctx context.Context, file FileInfo, dst io.Writer, progress ProgressFunc) error {
+	return a.Adapter.DownloadFile(WithSource(ctx, a.ID()), file, dst, progress)
+}
@@ -0,0 +1,70 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestProxyFunc(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://env-proxy:3128")
+	t.Setenv("NO_PROXY", "")
+
+	if err := ConfigureProxy(map[string]string{
+		"epo":   "http://epo-proxy:8080",
+		"uspto": "direct",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ConfigureProxy(nil) })
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"epo", "http://epo-proxy:8080"},
+		{"uspto", ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequestWithContext(WithSource(context.Background(), tt.source), http.MethodGet, "https://example.com", nil)
+		u, err := ProxyFunc(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != tt.want {
+			t.Errorf("ProxyFunc() for %s = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestConfigureProxyInvalid(t *testing.T) {
+	if err := ConfigureProxy(map[string]string{"epo": "not a url"}); err == nil {
+		t.Error("ConfigureProxy() should reject an invalid URL")
+	}
+}
+
+type contextAdapter struct {
+	mockAdapter
+	source string
+}
+
+func (c *contextAdapter) FetchProducts(ctx context.Context) ([]ProductInfo, error) {
+	c.source = SourceFromContext(ctx)
+	return nil, nil
+}
+
+func TestRegistryAddsSourceToContext(t *testing.T) {
+	registry := NewRegistry(nil, nil)
+	mock := &contextAdapter{mockAdapter: mockAdapter{id: "ctx"}}
+	registry.Register(mock)
+
+	adapter, _ := registry.Get("ctx")
+	adapter.FetchProducts(context.Background())
+	if mock.source != "ctx" {
+		t.Errorf("Source in adapter context = %q, want ctx", mock.source)
+	}
+}
@@ -17,6 +17,9 @@ type Registry struct {
 	db       *database.DB
 	cfg      *config.Config
 	adapters map[string]Adapter
+	options  map[string]Options
+	tokens   *tokenCache
+	auditor  CredentialAuditor
 	mu       sync.RWMutex
 }
 
@@ -26,6 +29,20 @@ func NewRegistry(db *database.DB, cfg *config.Config) *Registry {
 		db:       db,
 		cfg:      cfg,
 		adapters: make(map[string]Adapter),
+		options:  make(map[string]Options),
+		tokens:   newTokenCache(),
+	}
+}
+
+// SetAuditor sets where accesses to source credentials are recorded
+func (r *Registry) SetAuditor(auditor CredentialAuditor) {
+	r.auditor = auditor
+}
+
+// audit records an access to a source's credentials
+func (r *Registry) audit(ctx context.Context, id, action string) {
+	if r.auditor != nil {
+		r.auditor.AuditCredentials(ctx, id, action)
 	}
 }
 
@@ -37,11 +54,13 @@ func (r *Registry) RegisterBuiltinAdapters(adapters ...Adapter) {
 	}
 }
 
-// Register adds an adapter to the registry
+// Register adds an adapter to the registry. Calls through the registry carry
+// the source ID in their context for proxy selection, and adapters with OAuth2
+// credential fields get their tokens from the registry's cache.
 func (r *Registry) Register(adapter Adapter) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.adapters[adapter.ID()] = adapter
+	r.adapters[adapter.ID()] = sourceAdapter{Adapter: adapter, tokens: r.tokens}
 }
 
 // Get returns an adapter by ID
@@ -82,7 +101,10 @@ func (r *Registry) ListSources() ([]SourceInfo, error) {
 			info.Enabled = dbSource.Enabled
 			info.LastSyncAt = dbSource.LastSyncAt
 			info.HasCredentials = len(dbSource.CredentialsEnc) > 0
+			info.CredentialsExpireAt = dbSource.CredentialsExpireAt
+			info.DefaultSchedule = dbSource.DefaultSchedule
 		}
+		info.BaseURL, info.HeaderNames = r.optionsSummary(adapter.ID())
 
 		sources = append(sources, info)
 	}
@@ -113,7 +135,10 @@ func (r *Registry) GetSource(id string) (*SourceInfo, error) {
 		info.Enabled = dbSource.Enabled
 		info.LastSyncAt = dbSource.LastSyncAt
 		info.HasCredentials = len(dbSource.CredentialsEnc) > 0
+		info.CredentialsExpireAt = dbSource.CredentialsExpireAt
+		info.DefaultSchedule = dbSource.DefaultSchedule
 	}
+	info.BaseURL, info.HeaderNames = r.optionsSummary(id)
 
 	return info, nil
 }
@@ -125,7 +150,7 @@ type CredentialDecryptorEncryptor interface {
 }
 
 // UpdateSource updates source configuration
-func (r *Registry) UpdateSource(id string, enabled bool, credentials map[string]string, cryptor CredentialDecryptorEncryptor) error {
+func (r *Registry) UpdateSource(ctx context.Context, id string, enabled bool, credentials map[string]string, cryptor CredentialDecryptorEncryptor) error {
 	adapter, ok := r.Get(id)
 	if !ok {
 		return fmt.Errorf("source not found: %s", id)
@@ -137,6 +162,8 @@ func (r *Registry) UpdateSource(id string, enabled bool, credentials map[string]
 
 	// Start with existing credentials
 	credentialsEnc := existingSource.CredentialsEnc
+	expireAt := existingSource.CredentialsExpireAt
+	remindedAt := existingSource.CredentialsRemindedAt
 
 	// If new credentials provided, encrypt and store them
 	if len(credentials) > 0 {
@@ -148,13 +175,17 @@ func (r *Registry) UpdateSource(id string, enabled bool, credentials map[string]
 		if err != nil {
 			return fmt.Errorf("failed to encrypt credentials: %w", err)
 		}
+		expireAt = CredentialsExpiry(adapter.CredentialFields(), credentials, time.Now())
+		remindedAt = nil
 
 		// Set credentials on adapter
 		adapter.SetCredentials(credentials)
+		r.audit(ctx, id, CredentialsUpdated)
 	} else if len(existingSource.CredentialsEnc) > 0 {
 		// Load and set existing credentials on adapter
 		credJSON, err := cryptor.DecryptCredentials(existingSource.CredentialsEnc)
 		if err == nil {
+			r.audit(ctx, id, CredentialsDecrypted)
 			var existingCreds map[string]string
 			if json.Unmarshal(credJSON, &existingCreds) == nil {
 				adapter.SetCredentials(existingCreds)
@@ -164,15 +195,119 @@ func (r *Registry) UpdateSource(id string, enabled bool, credentials map[string]
 
 	// Upsert source in database
 	source := database.Source{
-		ID:             id,
-		Name:           adapter.Name(),
-		Enabled:        enabled,
-		CredentialsEnc: credentialsEnc,
+		ID:                    id,
+		Name:                  adapter.Name(),
+		Enabled:               enabled,
+		CredentialsEnc:        credentialsEnc,
+		OptionsEnc:            existingSource.OptionsEnc,
+		CredentialsExpireAt:   expireAt,
+		CredentialsRemindedAt: remindedAt,
+		DefaultSchedule:       existingSource.DefaultSchedule,
 	}
 
 	return r.db.Save(&source).Error
 }
 
+// UpdateOptions stores and applies a source's base URL override and extra
+// headers. Empty options remove them. Like credentials, they are stored
+// encrypted since headers often carry gateway keys.
+func (r *Registry) UpdateOptions(id string, opts Options, cryptor CredentialEncryptor) error {
+	adapter, ok := r.Get(id)
+	if !ok {
+		return fmt.Errorf("source not found: %s", id)
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	var optionsEnc []byte
+	if opts.BaseURL != "" || len(opts.Headers) > 0 {
+		optsJSON, err := json.Marshal(opts)
+		if err != nil {
+			return fmt.Errorf("failed to marshal options: %w", err)
+		}
+		optionsEnc, err = cryptor.EncryptCredentials(optsJSON)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt options: %w", err)
+		}
+	}
+
+	var source database.Source
+	if err := r.db.Where("id = ?", id).First(&source).Error; err != nil {
+		source = database.Source{ID: id, Name: adapter.Name()}
+	}
+	source.OptionsEnc = optionsEnc
+	if err := r.db.Save(&source).Error; err != nil {
+		return err
+	}
+
+	r.applyOptions(id, adapter, opts)
+	return nil
+}
+
+// applyOptions hands the options to the adapter and the source's HTTP clients
+func (r *Registry) applyOptions(id string, adapter Adapter, opts Options) {
+	r.mu.Lock()
+	r.options[id] = opts
+	r.mu.Unlock()
+
+	setSourceHeaders(id, opts.Headers)
+	if wrapped, ok := adapter.(interface{ Unwrap() Adapter }); ok {
+		adapter = wrapped.Unwrap()
+	}
+	if oa, ok := adapter.(OptionsAdapter); ok {
+		oa.SetOptions(opts)
+	}
+}
+
+// optionsSummary returns the base URL and the names of the extra headers of
+// a source; header values are not shown
+func (r *Registry) optionsSummary(id string) (string, []string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	opts := r.options[id]
+	var names []string
+	for name := range opts.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return opts.BaseURL, names
+}
+
+// SetCredentialsExpiry overrides when a source's credentials expire, e.g. for
+// an API key whose expiry the office shows when issuing it. nil clears it.
+func (r *Registry) SetCredentialsExpiry(id string, expireAt *time.Time) error {
+	result := r.db.Model(&database.Source{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"credentials_expire_at":   expireAt,
+		"credentials_reminded_at": nil,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("source not found: %s", id)
+	}
+	return nil
+}
+
+// CredentialsExpiry returns when newly entered credentials expire: the
+// earliest expiry of the fields with a declared lifetime that have a value,
+// or nil if none of them expire
+func CredentialsExpiry(fields []CredentialField, credentials map[string]string, now time.Time) *time.Time {
+	var expiry *time.Time
+	for _, f := range fields {
+		if f.ExpiresAfterDays <= 0 || credentials[f.Key] == "" {
+			continue
+		}
+		t := now.AddDate(0, 0, f.ExpiresAfterDays)
+		if expiry == nil || t.Before(*expiry) {
+			expiry = &t
+		}
+	}
+	return expiry
+}
+
 // TestCredentials tests if the credentials for a source are valid
 func (r *Registry) TestCredentials(ctx context.Context, id string, credentials map[string]string) error {
 	adapter, ok := r.Get(id)
@@ -182,6 +317,7 @@ func (r *Registry) TestCredentials(ctx context.Context, id string, credentials m
 
 	// Temporarily set credentials
 	adapter.SetCredentials(credentials)
+	r.audit(ctx, id, CredentialsTested)
 
 	// Validate
 	return adapter.ValidateCredentials(ctx)
@@ -195,12 +331,21 @@ func (r *Registry) LoadCredentialsWithDecryptor(decryptor CredentialDecryptor) e
 	}
 
 	for _, source := range sources {
-		if len(source.CredentialsEnc) == 0 {
+		adapter, ok := r.Get(source.ID)
+		if !ok {
 			continue
 		}
 
-		adapter, ok := r.Get(source.ID)
-		if !ok {
+		// Options first, so adapters build their clients with the base URL
+		if len(source.OptionsEnc) > 0 {
+			var opts Options
+			optsJSON, err := decryptor.DecryptCredentials(source.OptionsEnc)
+			if err == nil && json.Unmarshal(optsJSON, &opts) == nil {
+				r.applyOptions(source.ID, adapter, opts)
+			}
+		}
+
+		if len(source.CredentialsEnc) == 0 {
 			continue
 		}
 
@@ -208,6 +353,7 @@ func (r *Registry) LoadCredentialsWithDecryptor(decryptor CredentialDecryptor) e
 		if err != nil {
 			continue
 		}
+		r.audit(context.Background(), source.ID, CredentialsDecrypted)
 
 		var credentials map[string]string
 		if err := json.Unmarshal(credJSON, &credentials); err != nil {
@@ -220,6 +366,19 @@ func (r *Registry) LoadCredentialsWithDecryptor(decryptor CredentialDecryptor) e
 	return nil
 }
 
+// SetDefaultSchedule sets the check schedule given to products discovered
+// from now on. An empty schedule restores the adapter's defaults.
+func (r *Registry) SetDefaultSchedule(id, schedule string) error {
+	result := r.db.Model(&database.Source{}).Where("id = ?", id).Update("default_schedule", schedule)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("source not found: %s", id)
+	}
+	return nil
+}
+
 // SourceInfo contains source metadata and state
 type SourceInfo struct {
 	ID               string            `json:"id"`
@@ -228,6 +387,14 @@ type SourceInfo struct {
 	HasCredentials   bool              `json:"hasCredentials"`
 	LastSyncAt       *time.Time        `json:"lastSyncAt,omitempty"`
 	CredentialFields []CredentialField `json:"credentialFields"`
+	// CredentialsExpireAt is when the stored credentials expire, if known
+	CredentialsExpireAt *time.Time `json:"credentialsExpireAt,omitempty"`
+	// DefaultSchedule is the check schedule of newly discovered products, if
+	// it overrides the adapter's
+	DefaultSchedule string `json:"defaultSchedule,omitempty"`
+	// BaseURL and HeaderNames summarize the source's Options
+	BaseURL     string   `json:"baseUrl,omitempty"`
+	HeaderNames []string `json:"headerNames,omitempty"`
 }
 
 // CredentialEncryptor interface for encrypting credentials
@@ -239,3 +406,24 @@ type CredentialEncryptor interface {
 type CredentialDecryptor interface {
 	DecryptCredentials(ciphertext []byte) ([]byte, error)
 }
+
+// Actions on source credentials passed to a CredentialAuditor
+const (
+	// CredentialsDecrypted is recorded when stored credentials are decrypted
+	// and handed to the adapter, on startup or when the source is updated
+	CredentialsDecrypted = "decrypted"
+	// CredentialsUpdated is recorded when new credentials are stored
+	CredentialsUpdated = "updated"
+	// CredentialsTested is recorded when credentials are checked against the
+	// source
+	CredentialsTested = "tested"
+	// CredentialsExported is recorded when the encrypted credentials leave
+	// the server in a state export
+	CredentialsExported = "exported"
+)
+
+// CredentialAuditor records accesses to source credentials. The context
+// identifies who caused the access.
+type CredentialAuditor interface {
+	AuditCredentials(ctx context.Context, sourceID, action string)
+}
@@ -3,7 +3,9 @@ package sources
 import (
 	"context"
 	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/patent-dev/bulk-file-loader/config"
 	"github.com/patent-dev/bulk-file-loader/internal/database"
@@ -67,7 +69,7 @@ func TestUpdateSourcePreservesCredentials(t *testing.T) {
 	adapter := &mockAdapter{id: "test-source", name: "Test Source"}
 	registry.Register(adapter)
 
-	if err := registry.UpdateSource("test-source", true, map[string]string{"api_key": "secret123"}, cryptor); err != nil {
+	if err := registry.UpdateSource(context.Background(), "test-source", true, map[string]string{"api_key": "secret123"}, cryptor); err != nil {
 		t.Fatal(err)
 	}
 
@@ -77,7 +79,7 @@ func TestUpdateSourcePreservesCredentials(t *testing.T) {
 		t.Fatal("credentials should be saved")
 	}
 
-	if err := registry.UpdateSource("test-source", false, nil, cryptor); err != nil {
+	if err := registry.UpdateSource(context.Background(), "test-source", false, nil, cryptor); err != nil {
 		t.Fatal(err)
 	}
 
@@ -99,11 +101,11 @@ func TestUpdateSourceWithNewCredentials(t *testing.T) {
 	adapter := &mockAdapter{id: "test-source", name: "Test Source"}
 	registry.Register(adapter)
 
-	if err := registry.UpdateSource("test-source", true, map[string]string{"api_key": "secret123"}, cryptor); err != nil {
+	if err := registry.UpdateSource(context.Background(), "test-source", true, map[string]string{"api_key": "secret123"}, cryptor); err != nil {
 		t.Fatal(err)
 	}
 
-	if err := registry.UpdateSource("test-source", true, map[string]string{"api_key": "newsecret456"}, cryptor); err != nil {
+	if err := registry.UpdateSource(context.Background(), "test-source", true, map[string]string{"api_key": "newsecret456"}, cryptor); err != nil {
 		t.Fatal(err)
 	}
 
@@ -111,3 +113,111 @@ func TestUpdateSourceWithNewCredentials(t *testing.T) {
 		t.Fatalf("got %q, want newsecret456", adapter.creds["api_key"])
 	}
 }
+
+// auditLog records the credential accesses it is told about
+type auditLog []string
+
+func (a *auditLog) AuditCredentials(ctx context.Context, sourceID, action string) {
+	*a = append(*a, sourceID+":"+action)
+}
+
+func TestCredentialAudit(t *testing.T) {
+	db := setupTestDB(t)
+	registry := NewRegistry(db, &config.Config{})
+	audit := &auditLog{}
+	registry.SetAuditor(audit)
+	registry.Register(&mockAdapter{id: "test-source", name: "Test Source"})
+	ctx := context.Background()
+
+	registry.UpdateSource(ctx, "test-source", true, map[string]string{"api_key": "secret"}, &mockCryptor{})
+	registry.UpdateSource(ctx, "test-source", false, nil, &mockCryptor{})
+	registry.TestCredentials(ctx, "test-source", map[string]string{"api_key": "other"})
+	registry.LoadCredentialsWithDecryptor(&mockCryptor{})
+
+	want := []string{"test-source:updated", "test-source:decrypted", "test-source:tested", "test-source:decrypted"}
+	if strings.Join(*audit, " ") != strings.Join(want, " ") {
+		t.Errorf("audited %v, want %v", *audit, want)
+	}
+}
+
+func TestCredentialsExpiry(t *testing.T) {
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	fields := []CredentialField{
+		{Key: "username"},
+		{Key: "password", ExpiresAfterDays: 90},
+		{Key: "api_key", ExpiresAfterDays: 30},
+	}
+
+	if got := CredentialsExpiry(fields, map[string]string{"username": "u"}, now); got != nil {
+		t.Errorf("CredentialsExpiry() without expiring fields = %v, want nil", got)
+	}
+	got := CredentialsExpiry(fields, map[string]string{"username": "u", "password": "p"}, now)
+	if got == nil || !got.Equal(now.AddDate(0, 0, 90)) {
+		t.Errorf("CredentialsExpiry() = %v, want 90 days later", got)
+	}
+	got = CredentialsExpiry(fields, map[string]string{"password": "p", "api_key": "k"}, now)
+	if got == nil || !got.Equal(now.AddDate(0, 0, 30)) {
+		t.Errorf("CredentialsExpiry() = %v, want the earliest expiry", got)
+	}
+}
+
+func TestSetCredentialsExpiry(t *testing.T) {
+	db := setupTestDB(t)
+	registry := NewRegistry(db, &config.Config{})
+	registry.Register(&mockAdapter{id: "test-source", name: "Test Source"})
+	if err := registry.UpdateSource(context.Background(), "test-source", true, map[string]string{"api_key": "secret"}, &mockCryptor{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expireAt := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+	if err := registry.SetCredentialsExpiry("test-source", &expireAt); err != nil {
+		t.Fatal(err)
+	}
+	info, err := registry.GetSource("test-source")
+	if err != nil || info.CredentialsExpireAt == nil || !info.CredentialsExpireAt.Equal(expireAt) {
+		t.Errorf("CredentialsExpireAt = %v (%v), want %v", info.CredentialsExpireAt, err, expireAt)
+	}
+
+	// Keeping the credentials keeps their expiry
+	if err := registry.UpdateSource(context.Background(), "test-source", false, nil, &mockCryptor{}); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := registry.GetSource("test-source"); info.CredentialsExpireAt == nil {
+		t.Error("CredentialsExpireAt cleared by an update without credentials")
+	}
+
+	if err := registry.SetCredentialsExpiry("missing", &expireAt); err == nil {
+		t.Error("SetCredentialsExpiry() for a missing source succeeded")
+	}
+}
+
+func TestFetchDeliveriesSince(t *testing.T) {
+	since := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	adapter := &deliveriesAdapter{deliveries: []DeliveryInfo{
+		{ExternalID: "old", PublishedAt: since.AddDate(0, 0, -1)},
+		{ExternalID: "same", PublishedAt: since},
+		{ExternalID: "new", PublishedAt: since.AddDate(0, 0, 1)},
+		{ExternalID: "undated"},
+	}}
+
+	got, err := FetchDeliveriesSince(context.Background(), sourceAdapter{Adapter: adapter}, "p", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, d := range got {
+		ids = append(ids, d.ExternalID)
+	}
+	if strings.Join(ids, ",") != "same,new,undated" {
+		t.Errorf("FetchDeliveriesSince() = %v, want same, new and undated", ids)
+	}
+}
+
+type deliveriesAdapter struct {
+	mockAdapter
+	deliveries []DeliveryInfo
+}
+
+func (d *deliveriesAdapter) FetchDeliveries(context.Context, string) ([]DeliveryInfo, error) {
+	return d.deliveries, nil
+}
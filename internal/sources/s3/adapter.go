@@ -0,0 +1,305 @@
+// Package s3 is a source adapter for bulk data published in S3 buckets, such
+// as the patent datasets on AWS Open Data, and S3-compatible storage
+package s3
+
+import (
+	"context"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+const (
+	SourceID   = "s3"
+	SourceName = "S3 Bucket"
+
+	defaultRegion = "us-east-1"
+)
+
+// Adapter implements the sources.Adapter interface for an S3 bucket. Each
+// configured prefix is a product, the prefixes directly below it are
+// deliveries and their objects are files.
+type Adapter struct {
+	client      *client
+	credentials map[string]string
+}
+
+// New creates a new S3 adapter
+func New() *Adapter {
+	return &Adapter{
+		credentials: make(map[string]string),
+	}
+}
+
+// ID returns the source identifier
+func (a *Adapter) ID() string {
+	return SourceID
+}
+
+// Name returns the human-readable source name
+func (a *Adapter) Name() string {
+	return SourceName
+}
+
+// CredentialFields returns the required credential fields
+func (a *Adapter) CredentialFields() []sources.CredentialField {
+	return []sources.CredentialField{
+		{
+			Key:      "bucket",
+			Label:    "Bucket",
+			Type:     "text",
+			Required: true,
+		},
+		{
+			Key:      "prefixes",
+			Label:    "Prefixes",
+			Type:     "text",
+			HelpText: "Comma-separated prefixes whose sub-prefixes are deliveries (default: bucket root)",
+		},
+		{
+			Key:      "region",
+			Label:    "Region",
+			Type:     "text",
+			HelpText: "Bucket region (default: us-east-1)",
+		},
+		{
+			Key:      "endpoint",
+			Label:    "Endpoint",
+			Type:     "text",
+			HelpText: "Endpoint URL for S3-compatible storage; leave empty for AWS",
+		},
+		{
+			Key:      "access_key_id",
+			Label:    "Access Key ID",
+			Type:     "text",
+			HelpText: "Leave empty for public buckets",
+		},
+		{
+			Key:   "secret_access_key",
+			Label: "Secret Access Key",
+			Type:  "password",
+		},
+	}
+}
+
+// SetCredentials sets the credentials for the adapter
+func (a *Adapter) SetCredentials(creds map[string]string) {
+	a.credentials = creds
+	a.client = nil // Reset client to force re-creation with new credentials
+}
+
+// ValidateCredentials lists the configured prefixes
+func (a *Adapter) ValidateCredentials(ctx context.Context) error {
+	c, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range a.prefixes() {
+		if _, _, err := c.list(ctx, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchProducts returns one product per configured prefix
+func (a *Adapter) FetchProducts(ctx context.Context) ([]sources.ProductInfo, error) {
+	if _, err := a.getClient(); err != nil {
+		return nil, err
+	}
+
+	bucket := a.credentials["bucket"]
+	var result []sources.ProductInfo
+	for _, prefix := range a.prefixes() {
+		result = append(result, sources.ProductInfo{
+			ExternalID:    productID(prefix),
+			Name:          bucket + "/" + prefix,
+			Description:   "Objects in s3://" + bucket + "/" + prefix,
+			CheckSchedule: "0 6 * * *", // Default: 6 AM daily
+		})
+	}
+	return result, nil
+}
+
+// FetchDeliveries lists the prefixes directly below the product's prefix
+func (a *Adapter) FetchDeliveries(ctx context.Context, productID string) ([]sources.DeliveryInfo, error) {
+	c, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := a.productPrefix(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, prefixes, err := c.list(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.DeliveryInfo
+	for _, p := range prefixes {
+		name := strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/")
+		if name == "" {
+			continue
+		}
+		result = append(result, sources.DeliveryInfo{
+			ExternalID: name,
+			Name:       name,
+			// Prefixes have no modification time; files carry their own
+		})
+	}
+
+	// Newest first, like the other sources
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ExternalID > result[j].ExternalID
+	})
+
+	return result, nil
+}
+
+// FetchFiles lists the objects of a delivery prefix. The ETag of objects
+// uploaded in one part is their MD5 and is used as checksum.
+func (a *Adapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]sources.FileInfo, error) {
+	c, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := a.productPrefix(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, _, err := c.list(ctx, prefix+deliveryID+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.FileInfo
+	for _, o := range objects {
+		if strings.HasSuffix(o.Key, "/") {
+			continue // folder placeholder
+		}
+		info := sources.FileInfo{
+			ExternalID:  path.Base(o.Key),
+			FileName:    path.Base(o.Key),
+			FileSize:    o.Size,
+			DownloadURI: o.Key,
+			ReleasedAt:  o.LastModified,
+		}
+		if etag := strings.Trim(o.ETag, `"`); len(etag) == 32 && !strings.Contains(etag, "-") {
+			info.Checksum = etag
+			info.ChecksumAlgorithm = "md5"
+		}
+		result = append(result, info)
+	}
+
+	return result, nil
+}
+
+// DownloadFile downloads an object
+func (a *Adapter) DownloadFile(ctx context.Context, file sources.FileInfo, dst io.Writer, progress sources.ProgressFunc) error {
+	c, err := a.getClient()
+	if err != nil {
+		return err
+	}
+	if file.DownloadURI == "" {
+		return sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid download URI", nil)
+	}
+
+	resp, err := c.get(ctx, file.DownloadURI)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var src io.Reader = resp.Body
+	if progress != nil {
+		src = &progressReader{r: resp.Body, total: resp.ContentLength, progress: progress}
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func (a *Adapter) getClient() (*client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	bucket := a.credentials["bucket"]
+	if bucket == "" || strings.Contains(bucket, "/") {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Missing or invalid bucket", nil)
+	}
+	if (a.credentials["access_key_id"] == "") != (a.credentials["secret_access_key"] == "") {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Set both access key ID and secret access key, or neither", nil)
+	}
+
+	region := a.credentials["region"]
+	if region == "" {
+		region = defaultRegion
+	}
+
+	a.client = &client{
+		bucket:          bucket,
+		region:          region,
+		endpoint:        a.credentials["endpoint"],
+		accessKeyID:     a.credentials["access_key_id"],
+		secretAccessKey: a.credentials["secret_access_key"],
+		httpClient:      sources.NewHTTPClient(SourceID),
+	}
+	return a.client, nil
+}
+
+// prefixes returns the configured prefixes, each ending in a slash except
+// the bucket root
+func (a *Adapter) prefixes() []string {
+	var prefixes []string
+	for _, p := range strings.Split(a.credentials["prefixes"], ",") {
+		if p = strings.Trim(strings.TrimSpace(p), "/"); p != "" {
+			prefixes = append(prefixes, p+"/")
+		}
+	}
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	return prefixes
+}
+
+// productPrefix maps a product ID back to its configured prefix
+func (a *Adapter) productPrefix(id string) (string, error) {
+	for _, p := range a.prefixes() {
+		if productID(p) == id {
+			return p, nil
+		}
+	}
+	return "", sources.NewAdapterError(sources.ErrCodeNotFound, "Prefix is no longer configured", nil)
+}
+
+// productID derives a product ID from a prefix. IDs can't contain slashes,
+// which would break API paths.
+func productID(prefix string) string {
+	if prefix == "" {
+		return "root"
+	}
+	return strings.ReplaceAll(strings.Trim(prefix, "/"), "/", "_")
+}
+
+type progressReader struct {
+	r        io.Reader
+	written  int64
+	total    int64
+	progress sources.ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.written += int64(n)
+		p.progress(p.written, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,267 @@
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// client is a minimal S3 REST client for listing and reading objects. Requests
+// are signed with Signature Version 4 when an access key is set and sent
+// anonymously otherwise, which works for public buckets.
+type client struct {
+	bucket          string
+	region          string
+	endpoint        string // custom endpoint for S3-compatible storage; path-style addressing
+	accessKeyID     string
+	secretAccessKey string
+	httpClient      *http.Client
+	now             func() time.Time
+}
+
+type object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+}
+
+type listResult struct {
+	Contents       []object `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+type errorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// list returns the objects and sub-prefixes directly below prefix, following
+// continuation tokens
+func (c *client) list(ctx context.Context, prefix string) ([]object, []string, error) {
+	var objects []object
+	var prefixes []string
+	token := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {prefix},
+			"delimiter": {"/"},
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := c.do(ctx, "", query)
+		if err != nil {
+			return nil, nil, err
+		}
+		var result listResult
+		// A page lists at most 1000 keys
+		err = xml.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, sources.NewAdapterError(sources.ErrCodeNetwork, "Invalid listing response", err)
+		}
+
+		objects = append(objects, result.Contents...)
+		for _, p := range result.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, prefixes, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// get opens the object at key
+func (c *client) get(ctx context.Context, key string) (*http.Response, error) {
+	return c.do(ctx, key, nil)
+}
+
+func (c *client) do(ctx context.Context, key string, query url.Values) (*http.Response, error) {
+	target, err := c.objectURL(key)
+	if err != nil {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid endpoint", err)
+	}
+	target.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid bucket or endpoint", err)
+	}
+	if c.accessKeyID != "" {
+		c.sign(req)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, sources.NewAdapterError(sources.ErrCodeNetwork, "Request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var body errorResponse
+		xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+		err := fmt.Errorf("GET %s: status %d %s %s", target.Path, resp.StatusCode, body.Code, body.Message)
+		switch resp.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return nil, sources.NewAdapterError(sources.ErrCodeAuth, "Access denied", err)
+		case http.StatusNotFound:
+			return nil, sources.NewAdapterError(sources.ErrCodeNotFound, "Not found", err)
+		case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+			return nil, sources.NewAdapterError(sources.ErrCodeRateLimit, "Slow down", err)
+		}
+		return nil, sources.NewAdapterError(sources.ErrCodeNetwork, "Unexpected response", err)
+	}
+	return resp, nil
+}
+
+// objectURL uses virtual-hosted addressing on AWS and path-style addressing
+// on custom endpoints
+func (c *client) objectURL(key string) (*url.URL, error) {
+	path := "/" + encodePath(key)
+	if c.endpoint == "" {
+		return &url.URL{
+			Scheme:  "https",
+			Host:    fmt.Sprintf("%s.s3.%s.amazonaws.com", c.bucket, c.region),
+			Path:    "/" + key,
+			RawPath: path,
+		}, nil
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(c.endpoint, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute URL", c.endpoint)
+	}
+	u.RawPath = u.EscapedPath() + "/" + encode(c.bucket) + path
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	return u, nil
+}
+
+// sign adds a Signature Version 4 authorization header
+func (c *client) sign(req *http.Request) {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secretAccessKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query parameters sorted by name, as required for
+// signing
+func canonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, encode(k)+"="+encode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// encodePath escapes each segment of an object key
+func encodePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = encode(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// encode percent-encodes everything except RFC 3986 unreserved characters
+func encode(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
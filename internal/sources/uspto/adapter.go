@@ -22,6 +22,7 @@ const (
 type Adapter struct {
 	client      *odp.Client
 	credentials map[string]string
+	baseURL     string
 }
 
 // New creates a new USPTO ODP adapter
@@ -60,6 +61,12 @@ func (a *Adapter) SetCredentials(creds map[string]string) {
 	a.client = nil // Reset client to force re-creation with new credentials
 }
 
+// SetOptions sets the base URL override, e.g. for a test environment
+func (a *Adapter) SetOptions(opts sources.Options) {
+	a.baseURL = opts.BaseURL
+	a.client = nil
+}
+
 // ValidateCredentials tests if the credentials are valid
 func (a *Adapter) ValidateCredentials(ctx context.Context) error {
 	client, err := a.getClient()
@@ -269,6 +276,9 @@ func (a *Adapter) getClient() (*odp.Client, error) {
 	cfg := odp.DefaultConfig()
 	cfg.APIKey = apiKey
 	cfg.Timeout = 3600 // 1 hour timeout for large file downloads
+	if a.baseURL != "" {
+		cfg.BaseURL = a.baseURL
+	}
 
 	client, err := odp.NewClient(cfg)
 	if err != nil {
@@ -0,0 +1,221 @@
+package wipo
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/httpdir"
+)
+
+const (
+	SourceID   = "wipo-pct"
+	SourceName = "WIPO PCT"
+)
+
+// Adapter implements the sources.Adapter interface for WIPO's PCT bulk data
+// collections. WIPO serves subscribed collections as directory listings: each
+// top-level directory is a product, its subdirectories (one per weekly
+// publication) are deliveries.
+type Adapter struct {
+	client      *httpdir.Client
+	credentials map[string]string
+}
+
+// New creates a new WIPO PCT adapter
+func New() *Adapter {
+	return &Adapter{
+		credentials: make(map[string]string),
+	}
+}
+
+// ID returns the source identifier
+func (a *Adapter) ID() string {
+	return SourceID
+}
+
+// Name returns the human-readable source name
+func (a *Adapter) Name() string {
+	return SourceName
+}
+
+// CredentialFields returns the required credential fields
+func (a *Adapter) CredentialFields() []sources.CredentialField {
+	return []sources.CredentialField{
+		{
+			Key:      "base_url",
+			Label:    "Base URL",
+			Type:     "text",
+			Required: true,
+			HelpText: "The bulk data URL from your WIPO PATENTSCOPE subscription",
+		},
+		{
+			Key:      "username",
+			Label:    "Username",
+			Type:     "text",
+			Required: true,
+			HelpText: "Your WIPO bulk data username",
+		},
+		{
+			Key:      "password",
+			Label:    "Password",
+			Type:     "password",
+			Required: true,
+			HelpText: "Your WIPO bulk data password",
+		},
+	}
+}
+
+// SetCredentials sets the credentials for the adapter
+func (a *Adapter) SetCredentials(creds map[string]string) {
+	a.credentials = creds
+	a.client = nil // Reset client to force re-creation with new credentials
+}
+
+// ValidateCredentials tests if the credentials are valid
+func (a *Adapter) ValidateCredentials(ctx context.Context) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	// Try to list the collections to validate credentials
+	if _, err := client.List(ctx, ""); err != nil {
+		return sources.NewAdapterError(sources.ErrCodeAuth, "Failed to authenticate with WIPO", err)
+	}
+
+	return nil
+}
+
+// FetchProducts fetches the subscribed collections
+func (a *Adapter) FetchProducts(ctx context.Context) ([]sources.ProductInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := client.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.ProductInfo
+	for _, e := range entries {
+		if !e.Dir {
+			continue
+		}
+		result = append(result, sources.ProductInfo{
+			ExternalID:    e.Name,
+			Name:          "PCT " + e.Name,
+			Description:   "WIPO PCT bulk data collection " + e.Name,
+			CheckSchedule: "0 6 * * 4", // PCT applications are published on Thursdays
+		})
+	}
+
+	return result, nil
+}
+
+// FetchDeliveries fetches the publication directories of a collection
+func (a *Adapter) FetchDeliveries(ctx context.Context, productID string) ([]sources.DeliveryInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := client.List(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.DeliveryInfo
+	for _, e := range entries {
+		if !e.Dir {
+			continue
+		}
+		result = append(result, sources.DeliveryInfo{
+			ExternalID:  e.Name,
+			Name:        e.Name,
+			PublishedAt: e.Modified,
+		})
+	}
+
+	// Newest first, like the other sources
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ExternalID > result[j].ExternalID
+	})
+
+	return result, nil
+}
+
+// FetchFiles fetches files for a delivery
+func (a *Adapter) FetchFiles(ctx context.Context, productID, deliveryID string) ([]sources.FileInfo, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Join(productID, deliveryID)
+	entries, err := client.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []sources.FileInfo
+	for _, e := range entries {
+		if e.Dir {
+			continue
+		}
+		result = append(result, sources.FileInfo{
+			ExternalID:  e.Name,
+			FileName:    e.Name,
+			FileSize:    e.Size,
+			DownloadURI: path.Join(dir, e.Name),
+			ReleasedAt:  e.Modified,
+		})
+	}
+
+	return result, nil
+}
+
+// DownloadFile downloads a file
+func (a *Adapter) DownloadFile(ctx context.Context, file sources.FileInfo, dst io.Writer, progress sources.ProgressFunc) error {
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	if file.DownloadURI == "" || strings.Contains(file.DownloadURI, "..") {
+		return sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Invalid download URI", nil)
+	}
+
+	return client.Download(ctx, file.DownloadURI, dst, progress)
+}
+
+func (a *Adapter) getClient() (*httpdir.Client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	baseURL := a.credentials["base_url"]
+	username := a.credentials["username"]
+	password := a.credentials["password"]
+
+	if baseURL == "" || username == "" || password == "" {
+		return nil, sources.NewAdapterError(sources.ErrCodeInvalidConfig, "Missing credentials", nil)
+	}
+
+	a.client = &httpdir.Client{
+		BaseURL:    baseURL,
+		HTTPClient: sources.NewHTTPClient(SourceID),
+		Authorize: func(req *http.Request) error {
+			req.SetBasicAuth(username, password)
+			return nil
+		},
+	}
+
+	return a.client, nil
+}
@@ -0,0 +1,108 @@
+package wipo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patent-dev/bulk-file-loader/internal/sources"
+)
+
+const collectionsPage = `<html><body><pre><a href="../">../</a>
+<a href="A1/">A1/</a>                                      02-Jan-2025 00:10                   -
+<a href="B1/">B1/</a>                                      02-Jan-2025 00:10                   -
+<a href="readme.txt">readme.txt</a>                        02-Jan-2025 00:10                 120
+<a href="%2E%2E/">evil/</a>                                02-Jan-2025 00:10                   -
+</pre></body></html>`
+
+const publicationsPage = `<html><body><pre><a href="../">../</a>
+<a href="2025-01/">2025-01/</a>                            02-Jan-2025 00:10                   -
+<a href="2025-02/">2025-02/</a>                            09-Jan-2025 00:10                   -
+<a href="a%5C..%5C..%2F/">evil/</a>                        09-Jan-2025 00:10                   -
+</pre></body></html>`
+
+const publicationFilesPage = `<html><body><pre><a href="../">../</a>
+<a href="WO-2025-02_1.zip">WO-2025-02_1.zip</a>            09-Jan-2025 00:03              131072
+<a href="WO-2025-02_2.zip">WO-2025-02_2.zip</a>            09-Jan-2025 00:04                  42
+<a href="images/">images/</a>                              09-Jan-2025 00:04                   -
+<a href="..%2F..%2Fevil.zip">evil.zip</a>                   09-Jan-2025 00:04                  42
+<a href="a%5C..%5Cevil.zip">evil2.zip</a>                   09-Jan-2025 00:04                  42
+</pre></body></html>`
+
+func TestAdapter(t *testing.T) {
+	pages := map[string]string{
+		"/pct/":                            collectionsPage,
+		"/pct/A1/":                         publicationsPage,
+		"/pct/A1/2025-02/":                 publicationFilesPage,
+		"/pct/A1/2025-02/WO-2025-02_2.zip": "PK",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	a := New()
+	a.SetCredentials(map[string]string{"base_url": server.URL + "/pct/", "username": "user", "password": "secret"})
+	if err := a.ValidateCredentials(ctx); err != nil {
+		t.Fatalf("ValidateCredentials() = %v", err)
+	}
+
+	products, err := a.FetchProducts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 2 || products[0].ExternalID != "A1" || products[1].ExternalID != "B1" || products[0].Name != "PCT A1" {
+		t.Fatalf("FetchProducts() = %+v, want the A1 and B1 collections", products)
+	}
+
+	deliveries, err := a.FetchDeliveries(ctx, "A1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || deliveries[0].ExternalID != "2025-02" || deliveries[1].ExternalID != "2025-01" || deliveries[0].PublishedAt.IsZero() {
+		t.Fatalf("FetchDeliveries() = %+v, want both publications, newest first", deliveries)
+	}
+
+	files, err := a.FetchFiles(ctx, "A1", deliveries[0].ExternalID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].FileSize != 131072 || files[1].DownloadURI != "A1/2025-02/WO-2025-02_2.zip" {
+		t.Fatalf("FetchFiles() = %+v, want both archives with sizes", files)
+	}
+	for _, f := range files {
+		if err := errors.Join(sources.CheckName(f.ExternalID), sources.CheckName(f.FileName)); err != nil {
+			t.Errorf("FetchFiles() returned an unsafe name: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := a.DownloadFile(ctx, files[1], &buf, nil); err != nil || buf.String() != "PK" {
+		t.Errorf("DownloadFile() = %q, %v", buf.String(), err)
+	}
+	if err := a.DownloadFile(ctx, sources.FileInfo{DownloadURI: "A1/../../etc/passwd"}, &buf, nil); err == nil {
+		t.Error("DownloadFile() with a traversing URI succeeded")
+	}
+
+	a.SetCredentials(map[string]string{"base_url": server.URL + "/pct/", "username": "user", "password": "wrong"})
+	if err := a.ValidateCredentials(ctx); err == nil {
+		t.Error("ValidateCredentials() with a wrong password succeeded")
+	}
+	a.SetCredentials(map[string]string{"base_url": server.URL + "/pct/"})
+	if _, err := a.FetchProducts(ctx); err == nil {
+		t.Error("FetchProducts() without credentials succeeded")
+	}
+}
@@ -0,0 +1,255 @@
+// Package standby keeps a second instance in sync with a primary so it can
+// take over after a manual failover. A standby periodically copies the
+// primary's database state and rejects requests that would start syncs or
+// downloads until it is promoted.
+package standby
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+const (
+	RolePrimary = "primary"
+	RoleStandby = "standby"
+
+	// StatePath is the primary's endpoint serving its database state
+	StatePath = "/api/system/state"
+
+	apiKeyHeader = "X-API-Key"
+
+	// defaultMaxState bounds the primary's state a replica reads
+	defaultMaxState = 1 << 30
+)
+
+var ErrNotStandby = errors.New("instance is not a standby")
+
+// Status describes the replication role and progress of an instance
+type Status struct {
+	Role       string
+	PrimaryURL string
+	Interval   time.Duration
+	// LastSyncAt is the time of the last successful copy from the primary
+	LastSyncAt *time.Time
+	LastError  string
+	Syncs      int
+	Files      int
+	PromotedAt *time.Time
+}
+
+// Replica copies the primary's state while the instance is a standby
+type Replica struct {
+	db         *database.DB
+	primaryURL string
+	apiKey     string
+	interval   time.Duration
+	httpClient *http.Client
+	onPromote  func()
+	maxState   int64
+
+	mu     sync.Mutex
+	status Status
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a replica. An empty primaryURL makes this instance a primary.
+func New(db *database.DB, primaryURL, apiKey string, interval time.Duration) *Replica {
+	role := RolePrimary
+	if primaryURL != "" {
+		role = RoleStandby
+	}
+	primaryURL = strings.TrimRight(primaryURL, "/")
+	return &Replica{
+		db:         db,
+		primaryURL: primaryURL,
+		apiKey:     apiKey,
+		interval:   interval,
+		httpClient: &http.Client{Timeout: 10 * time.Minute},
+		maxState:   defaultMaxState,
+		status: Status{
+			Role:       role,
+			PrimaryURL: primaryURL,
+			Interval:   interval,
+		},
+	}
+}
+
+// OnPromote registers the callback that starts the scheduler and other
+// services once the standby becomes the primary
+func (r *Replica) OnPromote(fn func()) {
+	r.onPromote = fn
+}
+
+// IsStandby reports whether the instance is still a standby
+func (r *Replica) IsStandby() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status.Role == RoleStandby
+}
+
+// Status returns the current replication status
+func (r *Replica) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Start copies the primary's state immediately and then at every interval
+// until Stop or Promote is called. It does nothing on a primary.
+func (r *Replica) Start() {
+	if !r.IsStandby() {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			if err := r.Sync(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("Standby sync failed", "primary", r.primaryURL, "error", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	slog.Info("Running as standby", "primary", r.primaryURL, "interval", r.interval)
+}
+
+// Stop ends replication and waits for a running copy to finish
+func (r *Replica) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+	r.cancel = nil
+}
+
+// Sync fetches the primary's state and replaces the local database with it
+func (r *Replica) Sync(ctx context.Context) error {
+	state, err := r.fetchState(ctx)
+	if err == nil {
+		err = r.db.RestoreState(state)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.status.LastError = err.Error()
+		return err
+	}
+	now := time.Now()
+	r.status.LastSyncAt = &now
+	r.status.LastError = ""
+	r.status.Syncs++
+	r.status.Files = len(state.Files)
+	slog.Debug("Standby synced from primary", "files", len(state.Files), "exportedAt", state.ExportedAt)
+	return nil
+}
+
+func (r *Replica) fetchState(ctx context.Context) (*database.State, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.primaryURL+StatePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(apiKeyHeader, r.apiKey)
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch primary state: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch primary state: status %d", resp.StatusCode)
+	}
+
+	var state database.State
+	body := &io.LimitedReader{R: resp.Body, N: r.maxState + 1}
+	if err := json.NewDecoder(body).Decode(&state); err != nil {
+		if body.N == 0 {
+			return nil, fmt.Errorf("primary state exceeds %d bytes", r.maxState)
+		}
+		return nil, fmt.Errorf("decode primary state: %w", err)
+	}
+	return &state, nil
+}
+
+// Promote stops replication and makes this instance the primary. Downloads
+// the old primary had in progress are marked as failed so they can be
+// retried.
+func (r *Replica) Promote() (Status, error) {
+	if !r.IsStandby() {
+		return r.Status(), ErrNotStandby
+	}
+	r.Stop()
+
+	if count := r.db.FailInterruptedDownloads("interrupted by failover"); count > 0 {
+		slog.Info("Marked downloads of the old primary as failed", "count", count)
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	r.status.Role = RolePrimary
+	r.status.PromotedAt = &now
+	r.mu.Unlock()
+
+	slog.Warn("Standby promoted to primary", "formerPrimary", r.primaryURL)
+	if r.onPromote != nil {
+		r.onPromote()
+	}
+	return r.Status(), nil
+}
+
+// Middleware rejects API requests that change state while the instance is a
+// standby, since they would be overwritten by the next copy or start
+// downloads. Reads, backups, login and promotion are always allowed.
+func (r *Replica) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.IsStandby() && !allowedOnStandby(req) {
+			http.Error(w, "Instance is a standby; promote it first", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func allowedOnStandby(req *http.Request) bool {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return true
+	}
+	path := req.URL.Path
+	return strings.HasPrefix(path, "/api/auth/") ||
+		path == "/api/system/standby/promote" ||
+		path == "/api/system/backup" ||
+		path == "/api/system/reload"
+}
+
+// UnaryInterceptor rejects gRPC downloads while the instance is a standby
+func (r *Replica) UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if r.IsStandby() && strings.HasSuffix(info.FullMethod, "/Download") {
+		return nil, status.Error(codes.Unavailable, "instance is a standby; promote it first")
+	}
+	return handler(ctx, req)
+}
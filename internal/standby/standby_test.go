@@ -0,0 +1,166 @@
+package standby
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+func setupTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gormDB.AutoMigrate(
+		&database.Source{},
+		&database.Product{},
+		&database.Delivery{},
+		&database.File{},
+		&database.FileTag{},
+		&database.FileMetadata{},
+		&database.DownloadEntry{},
+		&database.Webhook{},
+		&database.Setting{},
+		&database.CatalogSnapshot{},
+		&database.SyncRun{},
+	)
+	return &database.DB{DB: gormDB}
+}
+
+func newPrimary(t *testing.T, db *database.DB) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != StatePath || r.Header.Get(apiKeyHeader) != "secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		state, err := db.ExportState()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(state)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSync(t *testing.T) {
+	primaryDB := setupTestDB(t)
+	primaryDB.Create(&database.File{ID: "f1", FileName: "a.zip"})
+	primaryDB.Create(&database.DownloadEntry{FileID: "f1", Status: database.DownloadStatusDownloading})
+	primary := newPrimary(t, primaryDB)
+
+	db := setupTestDB(t)
+	replica := New(db, primary.URL+"/", "secret", time.Minute)
+	if err := replica.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	status := replica.Status()
+	if status.Role != RoleStandby || status.Syncs != 1 || status.Files != 1 || status.LastSyncAt == nil {
+		t.Errorf("Status() = %+v, want one synced file", status)
+	}
+	var file database.File
+	if err := db.First(&file, "id = ?", "f1").Error; err != nil {
+		t.Errorf("file not replicated: %v", err)
+	}
+
+	promoted := false
+	replica.OnPromote(func() { promoted = true })
+	status, err := replica.Promote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !promoted || status.Role != RolePrimary || status.PromotedAt == nil {
+		t.Errorf("Promote() = %+v, callback called = %v", status, promoted)
+	}
+	var entry database.DownloadEntry
+	db.First(&entry)
+	if entry.Status != database.DownloadStatusFailed {
+		t.Errorf("download status after promotion = %q, want failed", entry.Status)
+	}
+
+	if _, err := replica.Promote(); !errors.Is(err, ErrNotStandby) {
+		t.Errorf("second Promote() = %v, want ErrNotStandby", err)
+	}
+}
+
+func TestSyncError(t *testing.T) {
+	primary := newPrimary(t, setupTestDB(t))
+	db := setupTestDB(t)
+	db.Create(&database.Source{ID: "epo"})
+
+	replica := New(db, primary.URL, "wrong", time.Minute)
+	if err := replica.Sync(context.Background()); err == nil {
+		t.Fatal("Sync() should fail with a rejected API key")
+	}
+	if replica.Status().LastError == "" {
+		t.Error("LastError should be set after a failed sync")
+	}
+	var count int64
+	db.Model(&database.Source{}).Count(&count)
+	if count != 1 {
+		t.Error("a failed sync must leave the local database untouched")
+	}
+}
+
+func TestSyncStateLimit(t *testing.T) {
+	primaryDB := setupTestDB(t)
+	primaryDB.Create(&database.File{ID: "f1", FileName: "a.zip"})
+	primary := newPrimary(t, primaryDB)
+
+	replica := New(setupTestDB(t), primary.URL, "secret", time.Minute)
+	replica.maxState = 64
+	if err := replica.Sync(context.Background()); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("Sync() of an oversized state error = %v, want the limit exceeded", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	replica := New(setupTestDB(t), "http://primary", "secret", time.Minute)
+	handler := replica.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/files", http.StatusNoContent},
+		{http.MethodPost, "/api/files/f1/download", http.StatusServiceUnavailable},
+		{http.MethodPut, "/api/sources/epo", http.StatusServiceUnavailable},
+		{http.MethodPost, "/api/auth/login", http.StatusNoContent},
+		{http.MethodPost, "/api/system/standby/promote", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+
+	primary := New(setupTestDB(t), "", "", time.Minute)
+	rec := httptest.NewRecorder()
+	primary.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/files/f1/download", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("primary rejected a write with %d", rec.Code)
+	}
+}
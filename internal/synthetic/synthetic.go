@@ -0,0 +1,202 @@
+package synthetic
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// SourcePrefix is the ID prefix of all generated sources, so synthetic data
+// can be told apart from (and removed without touching) real sources
+const SourcePrefix = "synthetic-"
+
+const batchSize = 500
+
+// Options controls the volume of generated data
+type Options struct {
+	Sources              int
+	ProductsPerSource    int
+	DeliveriesPerProduct int
+	FilesPerDelivery     int
+	// WithDownloads adds fake download entries with a mix of statuses
+	WithDownloads bool
+	// Seed makes the generated data reproducible
+	Seed int64
+}
+
+// Result reports how many records were created
+type Result struct {
+	Sources         int
+	Products        int
+	Deliveries      int
+	Files           int
+	DownloadEntries int
+}
+
+// Generate populates the database with synthetic sources, products,
+// deliveries, files and optionally download entries
+func Generate(db *database.DB, downloadsPath string, opts Options) (*Result, error) {
+	rng := rand.New(rand.NewSource(opts.Seed))
+	result := &Result{}
+	now := time.Now()
+
+	for s := 1; s <= opts.Sources; s++ {
+		sourceID := fmt.Sprintf("%s%d", SourcePrefix, s)
+		if err := db.Save(&database.Source{
+			ID:      sourceID,
+			Name:    fmt.Sprintf("Synthetic Source %d", s),
+			Enabled: true,
+		}).Error; err != nil {
+			return result, fmt.Errorf("create source: %w", err)
+		}
+		result.Sources++
+
+		for p := 1; p <= opts.ProductsPerSource; p++ {
+			productID := fmt.Sprintf("%s:product-%d", sourceID, p)
+			if err := db.Save(&database.Product{
+				ID:               productID,
+				SourceID:         sourceID,
+				ExternalID:       fmt.Sprintf("product-%d", p),
+				Name:             fmt.Sprintf("Synthetic Product %d.%d", s, p),
+				Description:      "Generated for load testing",
+				AutoDownload:     rng.Intn(2) == 0,
+				CheckWindowStart: "0 6 * * *",
+			}).Error; err != nil {
+				return result, fmt.Errorf("create product: %w", err)
+			}
+			result.Products++
+
+			var files []database.File
+			for d := 1; d <= opts.DeliveriesPerProduct; d++ {
+				deliveryID := fmt.Sprintf("%s:delivery-%d", productID, d)
+				publishedAt := now.AddDate(0, 0, -7*(opts.DeliveriesPerProduct-d))
+				if err := db.Save(&database.Delivery{
+					ID:          deliveryID,
+					ProductID:   productID,
+					ExternalID:  fmt.Sprintf("delivery-%d", d),
+					Name:        fmt.Sprintf("Delivery %s", publishedAt.Format("2006-01-02")),
+					PublishedAt: &publishedAt,
+				}).Error; err != nil {
+					return result, fmt.Errorf("create delivery: %w", err)
+				}
+				result.Deliveries++
+
+				for f := 1; f <= opts.FilesPerDelivery; f++ {
+					releasedAt := publishedAt
+					files = append(files, database.File{
+						ID:                fmt.Sprintf("%s:file-%d", deliveryID, f),
+						DeliveryID:        deliveryID,
+						ProductID:         productID,
+						SourceID:          sourceID,
+						ExternalID:        fmt.Sprintf("file-%d", f),
+						FileName:          fmt.Sprintf("synthetic-%d-%d-%d-%d.zip", s, p, d, f),
+						FileSize:          rng.Int63n(5 << 30),
+						ExpectedChecksum:  fmt.Sprintf("%032x", rng.Uint64()),
+						ChecksumAlgorithm: "md5",
+						ReleasedAt:        &releasedAt,
+						Skipped:           rng.Intn(20) == 0,
+					})
+				}
+			}
+
+			var entries []database.DownloadEntry
+			if opts.WithDownloads {
+				entries = fakeDownloadEntries(rng, files, downloadsPath, now)
+			}
+			setFileStatus(files, entries)
+
+			if err := db.CreateInBatches(files, batchSize).Error; err != nil {
+				return result, fmt.Errorf("create files: %w", err)
+			}
+			result.Files += len(files)
+
+			if len(entries) > 0 {
+				if err := db.CreateInBatches(entries, batchSize).Error; err != nil {
+					return result, fmt.Errorf("create download entries: %w", err)
+				}
+				result.DownloadEntries += len(entries)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Remove deletes all synthetic records created by Generate
+func Remove(db *database.DB) error {
+	like := SourcePrefix + "%"
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Synthetic records are removed for good rather than soft-deleted
+		tx = tx.Unscoped().Session(&gorm.Session{})
+		for _, model := range []any{&database.DownloadEntry{}, &database.FileTag{}, &database.FileMetadata{}} {
+			if err := tx.Where("file_id IN (SELECT id FROM files WHERE source_id LIKE ?)", like).
+				Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("source_id LIKE ?", like).Delete(&database.File{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id IN (SELECT id FROM products WHERE source_id LIKE ?)", like).
+			Delete(&database.Delivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("source_id LIKE ?", like).Delete(&database.Product{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id LIKE ?", like).Delete(&database.Source{}).Error
+	})
+}
+
+// setFileStatus fills in the status column the downloader maintains from
+// each file's latest entry
+func setFileStatus(files []database.File, entries []database.DownloadEntry) {
+	latest := make(map[string]*database.DownloadEntry)
+	for i := range entries {
+		latest[entries[i].FileID] = &entries[i]
+	}
+	for i := range files {
+		files[i].Status, files[i].ErrorMessage = database.DeriveFileStatus(&files[i], latest[files[i].ID])
+	}
+}
+
+// fakeDownloadEntries gives roughly half of the files a download history,
+// including retries after failures
+func fakeDownloadEntries(rng *rand.Rand, files []database.File, downloadsPath string, now time.Time) []database.DownloadEntry {
+	var entries []database.DownloadEntry
+	for _, f := range files {
+		if f.Skipped || rng.Intn(2) == 0 {
+			continue
+		}
+
+		attempts := 1 + rng.Intn(3)
+		for i := 0; i < attempts; i++ {
+			startedAt := now.Add(-time.Duration(attempts-i) * time.Hour)
+			completedAt := startedAt.Add(time.Duration(rng.Intn(3600)) * time.Second)
+			entry := database.DownloadEntry{
+				FileID:     f.ID,
+				Status:     database.DownloadStatusFailed,
+				TotalBytes: f.FileSize,
+				StartedAt:  &startedAt,
+				CreatedAt:  startedAt,
+			}
+			if i == attempts-1 && rng.Intn(4) != 0 {
+				entry.Status = database.DownloadStatusCompleted
+				entry.Progress = f.FileSize
+				entry.LocalPath = filepath.Join(downloadsPath, f.SourceID, f.ProductID, f.FileName)
+				entry.LocalChecksum = fmt.Sprintf("sha256:%064x", rng.Uint64())
+				entry.CompletedAt = &completedAt
+			} else {
+				entry.Progress = rng.Int63n(f.FileSize + 1)
+				entry.ErrorMessage = "Download failed: synthetic error"
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,80 @@
+package synthetic
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+func setupTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gormDB.AutoMigrate(
+		&database.Source{},
+		&database.Product{},
+		&database.Delivery{},
+		&database.File{},
+		&database.FileTag{},
+		&database.FileMetadata{},
+		&database.DownloadEntry{},
+	)
+	return &database.DB{DB: gormDB}
+}
+
+func TestGenerateAndRemove(t *testing.T) {
+	db := setupTestDB(t)
+
+	// A real source must survive Remove
+	db.Create(&database.Source{ID: "epo", Name: "EPO"})
+
+	opts := Options{
+		Sources:              2,
+		ProductsPerSource:    3,
+		DeliveriesPerProduct: 4,
+		FilesPerDelivery:     5,
+		WithDownloads:        true,
+		Seed:                 1,
+	}
+	result, err := Generate(db, t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Sources != 2 || result.Products != 6 || result.Deliveries != 24 || result.Files != 120 {
+		t.Errorf("Generate() = %+v, want 2 sources, 6 products, 24 deliveries, 120 files", result)
+	}
+	if result.DownloadEntries == 0 {
+		t.Error("Generate() created no download entries")
+	}
+
+	var files, entries int64
+	db.Model(&database.File{}).Count(&files)
+	db.Model(&database.DownloadEntry{}).Count(&entries)
+	if files != 120 || entries != int64(result.DownloadEntries) {
+		t.Errorf("Database has %d files and %d entries, want 120 and %d", files, entries, result.DownloadEntries)
+	}
+
+	if err := Remove(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var sources, products, deliveries int64
+	db.Model(&database.Source{}).Count(&sources)
+	db.Model(&database.Product{}).Count(&products)
+	db.Model(&database.Delivery{}).Count(&deliveries)
+	db.Model(&database.File{}).Count(&files)
+	db.Model(&database.DownloadEntry{}).Count(&entries)
+	if sources != 1 || products != 0 || deliveries != 0 || files != 0 || entries != 0 {
+		t.Errorf("After Remove: %d sources, %d products, %d deliveries, %d files, %d entries; want only the real source",
+			sources, products, deliveries, files, entries)
+	}
+}
@@ -0,0 +1,199 @@
+// Package telemetry reports coarse, anonymous usage statistics. It is off
+// unless explicitly enabled and never sends file names, URLs, credentials or
+// anything else that identifies the user.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/buildinfo"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+const (
+	reportInterval = 24 * time.Hour
+	initialDelay   = 10 * time.Minute
+)
+
+// Payload is the exact document sent to the telemetry endpoint. Only
+// built-in sources are listed by ID; plugin IDs are chosen by the user and
+// may identify them, so enabled plugins are only counted.
+type Payload struct {
+	InstanceID           string   `json:"instanceId"`
+	Version              string   `json:"version"`
+	OS                   string   `json:"os"`
+	Arch                 string   `json:"arch"`
+	DBDriver             string   `json:"dbDriver"`
+	EnabledSources       []string `json:"enabledSources"`
+	EnabledPlugins       int64    `json:"enabledPlugins"`
+	Products             int64    `json:"products"`
+	AutoDownloadProducts int64    `json:"autoDownloadProducts"`
+	Files                int64    `json:"files"`
+	CompletedDownloads   int64    `json:"completedDownloads"`
+	Webhooks             int64    `json:"webhooks"`
+}
+
+// Reporter periodically sends the usage payload when telemetry is enabled
+type Reporter struct {
+	db         *database.DB
+	cfg        *config.Config
+	httpClient *http.Client
+	builtin    map[string]bool
+	stop       chan struct{}
+}
+
+func New(db *database.DB, cfg *config.Config) *Reporter {
+	return &Reporter{
+		db:         db,
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		stop:       make(chan struct{}),
+	}
+}
+
+// SetBuiltinSources sets the IDs of the built-in adapters, the only source
+// IDs that are reported
+func (r *Reporter) SetBuiltinSources(ids []string) {
+	r.builtin = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		r.builtin[id] = true
+	}
+}
+
+// Enabled reports whether telemetry was opted into and has an endpoint
+func (r *Reporter) Enabled() bool {
+	return r.cfg.Telemetry && r.cfg.TelemetryURL != ""
+}
+
+// Endpoint returns the URL reports are sent to
+func (r *Reporter) Endpoint() string {
+	return r.cfg.TelemetryURL
+}
+
+// Payload builds the report from the current state of the database
+func (r *Reporter) Payload() (*Payload, error) {
+	instanceID, err := r.instanceID()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Payload{
+		InstanceID:     instanceID,
+		Version:        buildinfo.Version,
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		DBDriver:       r.cfg.DBDriver,
+		EnabledSources: []string{},
+	}
+
+	var enabled []string
+	if err := r.db.Model(&database.Source{}).Where("enabled = ?", true).Pluck("id", &enabled).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range enabled {
+		if r.builtin[id] {
+			p.EnabledSources = append(p.EnabledSources, id)
+		} else {
+			p.EnabledPlugins++
+		}
+	}
+	sort.Strings(p.EnabledSources)
+
+	r.db.Model(&database.Product{}).Count(&p.Products)
+	r.db.Model(&database.Product{}).Where("auto_download = ?", true).Count(&p.AutoDownloadProducts)
+	r.db.Model(&database.File{}).Count(&p.Files)
+	r.db.Model(&database.DownloadEntry{}).Where("status = ?", database.DownloadStatusCompleted).Count(&p.CompletedDownloads)
+	r.db.Model(&database.Webhook{}).Count(&p.Webhooks)
+
+	return p, nil
+}
+
+// instanceID returns a random identifier that distinguishes installations
+// without being derived from anything about them
+func (r *Reporter) instanceID() (string, error) {
+	if id, err := r.db.GetSetting(database.SettingTelemetryID); err == nil && id != "" {
+		return id, nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	if err := r.db.SetSetting(database.SettingTelemetryID, id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Send posts the current payload to the telemetry endpoint
+func (r *Reporter) Send(ctx context.Context) error {
+	payload, err := r.Payload()
+	if err != nil {
+		return fmt.Errorf("build payload: %w", err)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.TelemetryURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BulkFileLoader/"+buildinfo.Version)
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("telemetry endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Start sends a report shortly after startup and then once a day. It does
+// nothing if telemetry is disabled.
+func (r *Reporter) Start() {
+	if !r.Enabled() {
+		return
+	}
+	slog.Info("Anonymous usage telemetry enabled", "endpoint", r.cfg.TelemetryURL)
+
+	go func() {
+		timer := time.NewTimer(initialDelay)
+		defer timer.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-timer.C:
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				if err := r.Send(ctx); err != nil {
+					slog.Debug("Telemetry report failed", "error", err)
+				}
+				cancel()
+				timer.Reset(reportInterval)
+			}
+		}
+	}()
+}
+
+// Stop ends periodic reporting
+func (r *Reporter) Stop() {
+	close(r.stop)
+}
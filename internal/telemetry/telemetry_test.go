@@ -0,0 +1,117 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+func setupTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gormDB.AutoMigrate(
+		&database.Source{},
+		&database.Product{},
+		&database.File{},
+		&database.DownloadEntry{},
+		&database.Webhook{},
+		&database.Setting{},
+	)
+	return &database.DB{DB: gormDB}
+}
+
+func TestEnabled(t *testing.T) {
+	db := setupTestDB(t)
+
+	tests := []struct {
+		cfg  config.Config
+		want bool
+	}{
+		{config.Config{}, false},
+		{config.Config{Telemetry: true}, false},
+		{config.Config{TelemetryURL: "https://example.com"}, false},
+		{config.Config{Telemetry: true, TelemetryURL: "https://example.com"}, true},
+	}
+	for _, tt := range tests {
+		if got := New(db, &tt.cfg).Enabled(); got != tt.want {
+			t.Errorf("Enabled() with %+v = %v, want %v", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestPayload(t *testing.T) {
+	db := setupTestDB(t)
+	db.Create(&database.Source{ID: "uspto", Name: "USPTO", Enabled: true})
+	db.Create(&database.Source{ID: "epo", Name: "EPO", Enabled: true})
+	db.Create(&database.Source{ID: "other", Name: "Other"})
+	db.Create(&database.Product{ID: "p1", SourceID: "epo", Name: "Secret Product", AutoDownload: true})
+	db.Create(&database.Product{ID: "p2", SourceID: "epo"})
+	db.Create(&database.File{ID: "f1", ProductID: "p1", FileName: "private.zip"})
+	db.Create(&database.DownloadEntry{FileID: "f1", Status: database.DownloadStatusCompleted})
+
+	reporter := New(db, &config.Config{DBDriver: "sqlite"})
+	reporter.SetBuiltinSources([]string{"epo", "uspto", "other"})
+	p, err := reporter.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.EnabledSources) != 2 || p.EnabledSources[0] != "epo" || p.EnabledSources[1] != "uspto" {
+		t.Errorf("EnabledSources = %v, want [epo uspto]", p.EnabledSources)
+	}
+	if p.Products != 2 || p.AutoDownloadProducts != 1 || p.Files != 1 || p.CompletedDownloads != 1 {
+		t.Errorf("Payload counts = %+v", p)
+	}
+
+	again, _ := reporter.Payload()
+	if p.InstanceID == "" || again.InstanceID != p.InstanceID {
+		t.Errorf("InstanceID should be stable, got %q and %q", p.InstanceID, again.InstanceID)
+	}
+}
+
+func TestSend(t *testing.T) {
+	db := setupTestDB(t)
+	db.Create(&database.Source{ID: "epo", Name: "EPO", Enabled: true})
+	db.Create(&database.Source{ID: "acme-internal-mirror", Name: "Acme", Enabled: true})
+
+	var received Payload
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	reporter := New(db, &config.Config{Telemetry: true, TelemetryURL: server.URL, DBDriver: "sqlite"})
+	reporter.SetBuiltinSources([]string{"epo", "uspto"})
+	if err := reporter.Send(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := reporter.Payload()
+	if received.InstanceID != want.InstanceID || received.DBDriver != "sqlite" {
+		t.Errorf("Received payload = %+v, want %+v", received, want)
+	}
+	if len(received.EnabledSources) != 1 || received.EnabledSources[0] != "epo" || received.EnabledPlugins != 1 {
+		t.Errorf("EnabledSources = %v, EnabledPlugins = %d; want [epo] and 1", received.EnabledSources, received.EnabledPlugins)
+	}
+	if bytes.Contains(body, []byte("acme")) {
+		t.Errorf("payload %s contains the plugin ID", body)
+	}
+}
@@ -0,0 +1,44 @@
+// Package tlsconfig builds the TLS configuration for the built-in HTTP server
+// from certificate files or automatic ACME certificates.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+)
+
+// New returns the TLS configuration for cfg, or nil if TLS is not enabled.
+// ACME certificates are obtained with the TLS-ALPN-01 challenge, so the
+// server must be reachable on port 443 for the configured domains.
+func New(cfg *config.Config) (*tls.Config, error) {
+	switch {
+	case cfg.TLSCertFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load TLS certificate: %w", err)
+		}
+		return &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}, nil
+	case len(cfg.ACMEDomains) > 0:
+		if err := os.MkdirAll(cfg.ACMECacheDir, 0700); err != nil {
+			return nil, fmt.Errorf("create ACME cache directory: %w", err)
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+			Cache:      autocert.DirCache(cfg.ACMECacheDir),
+			Email:      cfg.ACMEEmail,
+		}
+		tlsCfg := manager.TLSConfig()
+		tlsCfg.MinVersion = tls.VersionTLS12
+		return tlsCfg, nil
+	}
+	return nil, nil
+}
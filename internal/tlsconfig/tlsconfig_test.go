@@ -0,0 +1,99 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+)
+
+func writeSelfSigned(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestNewDisabled(t *testing.T) {
+	tlsCfg, err := New(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsCfg != nil {
+		t.Error("New() should return nil without TLS settings")
+	}
+}
+
+func TestNewCertificateFiles(t *testing.T) {
+	certFile, keyFile := writeSelfSigned(t, t.TempDir())
+
+	tlsCfg, err := New(&config.Config{TLSCertFile: certFile, TLSKeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tlsCfg.Certificates) != 1 {
+		t.Errorf("Certificates = %d, want 1", len(tlsCfg.Certificates))
+	}
+	if tlsCfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x, want TLS 1.2", tlsCfg.MinVersion)
+	}
+
+	if _, err := New(&config.Config{TLSCertFile: certFile, TLSKeyFile: certFile}); err == nil {
+		t.Error("New() should fail for an invalid key file")
+	}
+}
+
+func TestNewACME(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "acme")
+
+	tlsCfg, err := New(&config.Config{ACMEDomains: []string{"bulk.example.com"}, ACMECacheDir: cacheDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsCfg.GetCertificate == nil {
+		t.Error("GetCertificate should be set for ACME")
+	}
+	if !slices.Contains(tlsCfg.NextProtos, "acme-tls/1") {
+		t.Errorf("NextProtos = %v, want acme-tls/1 for the TLS-ALPN challenge", tlsCfg.NextProtos)
+	}
+	if _, err := os.Stat(cacheDir); err != nil {
+		t.Errorf("ACME cache directory not created: %v", err)
+	}
+
+	_, err = tlsCfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"})
+	if err == nil {
+		t.Error("GetCertificate should reject hosts outside the configured domains")
+	}
+}
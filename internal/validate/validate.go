@@ -0,0 +1,225 @@
+// Package validate checks downloaded files before they are marked complete,
+// e.g. that a ZIP archive isn't truncated.
+package validate
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidSpec is returned for a validator that isn't known
+var ErrInvalidSpec = errors.New("invalid validator")
+
+// xmlSample is the number of XML entries of a ZIP archive checked by the xml
+// validator
+const xmlSample = 3
+
+// Validators that can be configured per product
+const (
+	// Zip requires ZIP files to open and all entries to match their CRC
+	Zip = "zip"
+	// XML requires XML files, and a sample of the XML entries of ZIP files,
+	// to be well-formed
+	XML = "xml"
+	// MinRecords, as min-records=N, requires ZIP files to have at least N
+	// entries and other files at least N lines
+	MinRecords = "min-records"
+)
+
+// Check reports whether the validators are known and well-formed
+func Check(specs []string) error {
+	for _, spec := range specs {
+		if _, _, err := parse(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parse(spec string) (string, int, error) {
+	name, arg, hasArg := strings.Cut(spec, "=")
+	switch {
+	case (name == Zip || name == XML) && !hasArg:
+		return name, 0, nil
+	case name == MinRecords && hasArg:
+		n, err := strconv.Atoi(arg)
+		if err == nil && n > 0 {
+			return name, n, nil
+		}
+	}
+	return "", 0, fmt.Errorf("%w %q: use %s, %s or %s=N", ErrInvalidSpec, spec, Zip, XML, MinRecords)
+}
+
+// File runs the validators on the file at path, stored under the name, and
+// returns the first failure
+func File(ctx context.Context, filePath, name string, specs []string) error {
+	isZip := strings.EqualFold(path.Ext(name), ".zip")
+	isXML := strings.EqualFold(path.Ext(name), ".xml")
+	for _, spec := range specs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		validator, n, err := parse(spec)
+		if err != nil {
+			return err
+		}
+		switch {
+		case validator == Zip && isZip:
+			err = checkZip(ctx, filePath)
+		case validator == XML && isZip:
+			err = checkZipXML(ctx, filePath)
+		case validator == XML && isXML:
+			err = checkXMLFile(filePath)
+		case validator == MinRecords:
+			err = checkRecords(filePath, isZip, n)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", validator, err)
+		}
+	}
+	return nil
+}
+
+func checkZip(ctx context.Context, filePath string) error {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := discard(f); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func checkZipXML(ctx context.Context, filePath string) error {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	checked := 0
+	for _, f := range zr.File {
+		if checked == xmlSample {
+			break
+		}
+		if !strings.EqualFold(path.Ext(f.Name), ".xml") {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		err = checkXML(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		checked++
+	}
+	return nil
+}
+
+func checkXMLFile(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return checkXML(f)
+}
+
+// checkXML reads the whole document, failing on the first syntax error
+func checkXML(r io.Reader) error {
+	d := xml.NewDecoder(bufio.NewReader(r))
+	// Bulk data often declares encodings or entities the decoder doesn't
+	// know; only the structure is checked
+	d.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+	d.Entity = xml.HTMLEntity
+	depth, roots := 0, 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if roots != 1 {
+		return fmt.Errorf("document has %d root elements, want 1", roots)
+	}
+	return nil
+}
+
+func checkRecords(filePath string, isZip bool, want int) error {
+	var count int
+	if isZip {
+		zr, err := zip.OpenReader(filePath)
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if !f.FileInfo().IsDir() {
+				count++
+			}
+		}
+		zr.Close()
+	} else {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			count++
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if count < want {
+		return fmt.Errorf("%d records, want at least %d", count, want)
+	}
+	return nil
+}
+
+// discard reads a ZIP entry to the end, which fails on a CRC mismatch
+func discard(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
@@ -0,0 +1,104 @@
+package validate
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeZip(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestCheck(t *testing.T) {
+	if err := Check([]string{"zip", "xml", "min-records=10"}); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	for _, spec := range []string{"gzip", "zip=1", "min-records", "min-records=0", "min-records=x"} {
+		if err := Check([]string{spec}); !errors.Is(err, ErrInvalidSpec) {
+			t.Errorf("Check(%q) error = %v, want ErrInvalidSpec", spec, err)
+		}
+	}
+}
+
+func TestFileZip(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.zip")
+	writeZip(t, good, map[string]string{"a.xml": "<doc><a/></doc>", "b.xml": "<doc/>", "readme.txt": "x"})
+	ctx := context.Background()
+
+	if err := File(ctx, good, "good.zip", []string{"zip", "xml", "min-records=3"}); err != nil {
+		t.Errorf("valid archive: %v", err)
+	}
+	if err := File(ctx, good, "good.zip", []string{"min-records=4"}); err == nil {
+		t.Error("expected min-records to fail for 3 entries")
+	}
+
+	// A truncated archive has no central directory
+	data, _ := os.ReadFile(good)
+	truncated := filepath.Join(dir, "truncated.zip")
+	os.WriteFile(truncated, data[:len(data)/2], 0644)
+	if err := File(ctx, truncated, "truncated.zip", []string{"zip"}); err == nil {
+		t.Error("expected truncated archive to fail")
+	}
+
+	malformed := filepath.Join(dir, "malformed.zip")
+	writeZip(t, malformed, map[string]string{"a.xml": "<doc><a></doc>"})
+	if err := File(ctx, malformed, "malformed.zip", []string{"zip"}); err != nil {
+		t.Errorf("zip alone shouldn't check XML: %v", err)
+	}
+	if err := File(ctx, malformed, "malformed.zip", []string{"xml"}); err == nil {
+		t.Error("expected malformed XML entry to fail")
+	}
+}
+
+func TestFileXML(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	tests := []struct {
+		content string
+		valid   bool
+	}{
+		{`<?xml version="1.0" encoding="ISO-8859-1"?><doc>&amp;&nbsp;</doc>`, true},
+		{"<doc><a></doc>", false},
+		{"<a/><b/>", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, "doc.xml")
+		os.WriteFile(path, []byte(tt.content), 0644)
+		err := File(ctx, path, "doc.xml", []string{"xml"})
+		if (err == nil) != tt.valid {
+			t.Errorf("File(%q) error = %v, want valid %v", tt.content, err, tt.valid)
+		}
+	}
+
+	// Validators not applying to the file type pass
+	path := filepath.Join(dir, "data.txt")
+	os.WriteFile(path, []byte("one\ntwo\n"), 0644)
+	if err := File(ctx, path, "data.txt", []string{"zip", "xml", "min-records=2"}); err != nil {
+		t.Errorf("text file: %v", err)
+	}
+	if err := File(ctx, path, "data.txt", []string{"min-records=3"}); err == nil {
+		t.Error("expected min-records to fail for 2 lines")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package workpool
+
+// setNice is a no-op where process priorities are not supported
+func setNice(pid, nice int) error {
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package workpool
+
+import "syscall"
+
+func setNice(pid, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
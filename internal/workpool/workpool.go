@@ -0,0 +1,106 @@
+// Package workpool bounds CPU- and IO-heavy work that runs after a download,
+// such as extraction and post-processing, so it cannot starve active
+// downloads or the API.
+package workpool
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool runs work with a fixed number of slots, separate from the download
+// concurrency limit
+type Pool struct {
+	mu    sync.RWMutex
+	slots chan struct{}
+	nice  int
+
+	active  atomic.Int64
+	waiting atomic.Int64
+}
+
+// Stats is a snapshot of the pool's usage
+type Stats struct {
+	Workers int
+	Nice    int
+	Active  int
+	Waiting int
+}
+
+// New creates a pool running at most workers jobs at once. External commands
+// started through the pool run with the given niceness (0-19).
+func New(workers, nice int) *Pool {
+	return &Pool{
+		slots: make(chan struct{}, workers),
+		nice:  nice,
+	}
+}
+
+// Run waits for a free slot and calls fn. It returns the context error if ctx
+// is done before a slot becomes free.
+func (p *Pool) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	slots, _ := p.limits()
+
+	p.waiting.Add(1)
+	select {
+	case slots <- struct{}{}:
+		p.waiting.Add(-1)
+	case <-ctx.Done():
+		p.waiting.Add(-1)
+		return ctx.Err()
+	}
+	defer func() { <-slots }()
+
+	p.active.Add(1)
+	defer p.active.Add(-1)
+	return fn(ctx)
+}
+
+// Start starts cmd and lowers its CPU priority to the pool's niceness. On
+// Linux the IO priority follows the CPU niceness unless set explicitly.
+func (p *Pool) Start(cmd *exec.Cmd) error {
+	_, nice := p.limits()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if nice > 0 {
+		if err := setNice(cmd.Process.Pid, nice); err != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return fmt.Errorf("set process niceness: %w", err)
+		}
+	}
+	return nil
+}
+
+// Reconfigure changes the worker count and niceness for work started
+// afterwards. Running work keeps its slot.
+func (p *Pool) Reconfigure(workers, nice int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if workers != cap(p.slots) {
+		p.slots = make(chan struct{}, workers)
+	}
+	p.nice = nice
+}
+
+// Stats returns the current configuration and usage
+func (p *Pool) Stats() Stats {
+	slots, nice := p.limits()
+	return Stats{
+		Workers: cap(slots),
+		Nice:    nice,
+		Active:  int(p.active.Load()),
+		Waiting: int(p.waiting.Load()),
+	}
+}
+
+func (p *Pool) limits() (chan struct{}, int) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.slots, p.nice
+}
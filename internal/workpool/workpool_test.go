@@ -0,0 +1,116 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunLimitsConcurrency(t *testing.T) {
+	pool := New(2, 0)
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Run(context.Background(), func(ctx context.Context) error {
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				running.Add(-1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak.Load())
+	}
+}
+
+func TestRunReturnsError(t *testing.T) {
+	pool := New(1, 0)
+	want := errors.New("extract failed")
+
+	err := pool.Run(context.Background(), func(ctx context.Context) error { return want })
+	if !errors.Is(err, want) {
+		t.Errorf("Run() = %v, want %v", err, want)
+	}
+}
+
+func TestRunCancelledWhileWaiting(t *testing.T) {
+	pool := New(1, 0)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go pool.Run(context.Background(), func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := pool.Run(ctx, func(ctx context.Context) error {
+		t.Error("fn should not run without a free slot")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() = %v, want deadline exceeded", err)
+	}
+	if stats := pool.Stats(); stats.Active != 1 || stats.Waiting != 0 {
+		t.Errorf("Stats() = %+v, want 1 active and none waiting", stats)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	pool := New(1, 10)
+	pool.Reconfigure(4, 5)
+
+	stats := pool.Stats()
+	if stats.Workers != 4 || stats.Nice != 5 {
+		t.Errorf("Stats() = %+v, want 4 workers with niceness 5", stats)
+	}
+}
+
+func TestStartSetsNiceness(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("niceness is only checked on Linux")
+	}
+	pool := New(1, 7)
+
+	cmd := exec.Command("sh", "-c", "sleep 0.2; nice")
+	out := make(chan []byte, 1)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Start(cmd); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 16)
+		n, _ := stdout.Read(buf)
+		out <- buf[:n]
+	}()
+	got := <-out
+	cmd.Wait()
+
+	if string(got) != "7\n" {
+		t.Errorf("child niceness = %q, want 7", got)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -15,32 +16,75 @@ import (
 	"syscall"
 	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
 	"github.com/patent-dev/bulk-file-loader/api/generated"
+	"github.com/patent-dev/bulk-file-loader/api/grpcserver"
 	"github.com/patent-dev/bulk-file-loader/api/handlers"
 	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/audit"
 	"github.com/patent-dev/bulk-file-loader/internal/auth"
+	"github.com/patent-dev/bulk-file-loader/internal/aws"
+	"github.com/patent-dev/bulk-file-loader/internal/buildinfo"
 	"github.com/patent-dev/bulk-file-loader/internal/database"
 	"github.com/patent-dev/bulk-file-loader/internal/downloader"
 	"github.com/patent-dev/bulk-file-loader/internal/hooks"
+	"github.com/patent-dev/bulk-file-loader/internal/kafka"
+	"github.com/patent-dev/bulk-file-loader/internal/listen"
+	"github.com/patent-dev/bulk-file-loader/internal/oidc"
+	"github.com/patent-dev/bulk-file-loader/internal/reload"
 	"github.com/patent-dev/bulk-file-loader/internal/scheduler"
 	"github.com/patent-dev/bulk-file-loader/internal/sources"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/bdss"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/cnipa"
 	"github.com/patent-dev/bulk-file-loader/internal/sources/epo"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/feed"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/ftp"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/grpcplugin"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/httpindex"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/jpo"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/ops"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/s3"
 	"github.com/patent-dev/bulk-file-loader/internal/sources/uspto"
+	"github.com/patent-dev/bulk-file-loader/internal/sources/wipo"
+	"github.com/patent-dev/bulk-file-loader/internal/standby"
+	"github.com/patent-dev/bulk-file-loader/internal/telemetry"
+	"github.com/patent-dev/bulk-file-loader/internal/tlsconfig"
+	"github.com/patent-dev/bulk-file-loader/internal/workpool"
 )
 
 //go:embed web/ui/dist/*
 var webAssets embed.FS
 
 func main() {
-	var showVersion bool
+	var showVersion, once bool
 	flag.BoolVar(&showVersion, "version", false, "Show version and exit")
+	flag.BoolVar(&once, "once", false, "Sync and download once, then exit")
 	flag.Parse()
 
 	if showVersion {
-		fmt.Println("bulk-file-loader v0.1.0")
+		fmt.Println("bulk-file-loader v" + buildinfo.Version)
 		os.Exit(0)
 	}
 
+	if flag.Arg(0) == "seed" {
+		runSeed(flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "migrate" {
+		runMigrate(flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "import" {
+		runImport(flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "relocate" {
+		runRelocate(flag.Args()[1:])
+		return
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
 		slog.Error("Failed to load configuration", "error", err)
@@ -63,10 +107,108 @@ func main() {
 	}
 
 	authService := auth.New(db, cfg)
+	oidcRoles, err := auth.ParseRoles(cfg.OIDCRoles)
+	if err != nil {
+		slog.Error("Invalid OIDC configuration", "error", err)
+		os.Exit(1)
+	}
+	if err := authService.SetOIDC(auth.OIDCConfig{
+		Config: oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+		},
+		GroupsClaim: cfg.OIDCGroupsClaim,
+		Roles:       oidcRoles,
+	}); err != nil {
+		slog.Error("Invalid OIDC configuration", "error", err)
+		os.Exit(1)
+	}
+	if err := authService.SetProxyAuth(auth.ProxyAuthConfig{
+		Header:       cfg.ProxyAuthHeader,
+		Trusted:      cfg.ProxyAuthTrusted,
+		Role:         cfg.ProxyAuthRole,
+		DisableLogin: cfg.DisableLogin,
+	}); err != nil {
+		slog.Error("Invalid proxy authentication configuration", "error", err)
+		os.Exit(1)
+	}
+	authService.SetReadOnly(cfg.ReadOnly)
 	hooksManager := hooks.New(db)
+	hooksManager.SetRetryPolicy(cfg.WebhookRetries, time.Duration(cfg.WebhookRetryDelay)*time.Second)
+	hooksManager.SetEventRetention(time.Duration(cfg.EventRetentionDays) * 24 * time.Hour)
+	hooksManager.SetSMTP(hooks.SMTPConfig{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+	})
+	if len(cfg.KafkaBrokers) > 0 {
+		hooksManager.Register(hooks.NewKafkaPublisher(kafka.Config{
+			Brokers:  cfg.KafkaBrokers,
+			Username: cfg.KafkaUsername,
+			Password: cfg.KafkaPassword,
+			TLS:      cfg.KafkaTLS,
+		}, cfg.KafkaTopic))
+	}
+	if err := hooksManager.SetNATS(hooks.NATSConfig{
+		URL:       cfg.NATSURL,
+		Subject:   cfg.NATSSubject,
+		JetStream: cfg.NATSJetStream,
+	}); err != nil {
+		slog.Error("Invalid NATS configuration", "error", err)
+		os.Exit(1)
+	}
+	if cfg.SQSQueueURL != "" || cfg.SNSTopicARN != "" {
+		awsClient := aws.NewClient(aws.Config{
+			AccessKeyID:     cfg.AWSAccessKeyID,
+			SecretAccessKey: cfg.AWSSecretAccessKey,
+			SessionToken:    cfg.AWSSessionToken,
+			Region:          cfg.AWSRegion,
+			Endpoint:        cfg.AWSEndpoint,
+		})
+		if cfg.SQSQueueURL != "" {
+			if _, err := aws.ParseQueueURL(cfg.SQSQueueURL); err != nil {
+				slog.Error("Invalid SQS configuration", "error", err)
+				os.Exit(1)
+			}
+			hooksManager.Register(hooks.NewSQSPublisher(awsClient, cfg.SQSQueueURL))
+		}
+		if cfg.SNSTopicARN != "" {
+			if _, err := aws.ParseTopicARN(cfg.SNSTopicARN); err != nil {
+				slog.Error("Invalid SNS configuration", "error", err)
+				os.Exit(1)
+			}
+			hooksManager.Register(hooks.NewSNSPublisher(awsClient, cfg.SNSTopicARN))
+		}
+	}
+	if cfg.AMQPURL != "" {
+		publisher, err := hooks.NewAMQPPublisher(cfg.AMQPURL, cfg.AMQPExchange)
+		if err != nil {
+			slog.Error("Invalid AMQP configuration", "error", err)
+			os.Exit(1)
+		}
+		hooksManager.Register(publisher)
+	}
+
+	if err := sources.ConfigureProxy(cfg.SourceProxies); err != nil {
+		slog.Error("Invalid proxy configuration", "error", err)
+		os.Exit(1)
+	}
 
+	auditLog := audit.New(db, hooksManager)
 	sourceRegistry := sources.NewRegistry(db, cfg)
-	sourceRegistry.RegisterBuiltinAdapters(epo.New(), uspto.New())
+	sourceRegistry.SetAuditor(auditLog)
+	builtinAdapters := []sources.Adapter{epo.New(), uspto.New(), wipo.New(), jpo.New(), cnipa.New(), httpindex.New(), ftp.New(), s3.New(), feed.New(), ops.New(), bdss.New()}
+	sourceRegistry.RegisterBuiltinAdapters(builtinAdapters...)
+	if err := sourceRegistry.LoadPlugins(context.Background()); err != nil {
+		slog.Error("Failed to load source plugins", "error", err)
+		os.Exit(1)
+	}
+	grpcplugin.Load(context.Background(), sourceRegistry, cfg.GRPCPlugins)
 
 	if err := sourceRegistry.LoadCredentialsWithDecryptor(authService); err != nil {
 		slog.Debug("Credentials not loaded at startup", "error", err)
@@ -79,16 +221,97 @@ func main() {
 	})
 
 	dl := downloader.New(db, sourceRegistry, hooksManager, cfg)
+	postProcess := workpool.New(cfg.PostProcessWorkers, cfg.PostProcessNice)
+	dl.SetPostProcess(postProcess)
 	sched := scheduler.New(db, sourceRegistry, dl, hooksManager)
+	sched.SetRetryPolicy(cfg.SyncRetries, time.Duration(cfg.SyncRetryDelay)*time.Second)
+	sched.SetCredentialReminder(cfg.CredentialReminderDays)
+	sched.SetDeliveryReminder(cfg.DeliveryReminderDays)
+	sched.SetDownloadRetention(cfg.DownloadRetentionDays)
+	sched.SetArchiveAge(cfg.ArchiveAfterDays)
+	sched.SetArchiveExpired(cfg.ArchiveExpired)
+	sched.SetReconcileFix(cfg.ReconcileFix)
+	sched.SetScheduleJitter(time.Duration(cfg.ScheduleJitter) * time.Second)
+	sched.SetBlackout(cfg.Blackout)
+	sched.SetMaxConcurrentSyncs(cfg.MaxConcurrentSyncs)
+	sched.SetSyncFailureLimit(cfg.SyncFailureLimit)
+
+	if once {
+		if cfg.StandbyPrimary != "" {
+			slog.Error("--once cannot run on a standby")
+			os.Exit(1)
+		}
+		// The cron schedule is not needed for a single pass, and downloads
+		// that can't start now are left for the next run
+		sched.Stop()
+		dl.SetDeferClosed(true)
+		os.Exit(runOnce(sched, hooksManager))
+	}
+
+	if cfg.StandbyPrimary != "" && cfg.Passphrase == "" {
+		slog.Error("BULK_LOADER_PASSPHRASE is required on a standby")
+		os.Exit(1)
+	}
+	replica := standby.New(db, cfg.StandbyPrimary, cfg.Passphrase, time.Duration(cfg.StandbyInterval)*time.Second)
+	if replica.IsStandby() {
+		// Nothing is synced or downloaded until the standby is promoted
+		sched.Stop()
+		replica.OnPromote(func() {
+			// The restored settings carry the primary's encryption salt
+			authService.ReloadEncryptionKey()
+			sched.Start()
+			dl.ResumeInterrupted()
+			sched.CatchUp()
+		})
+	} else {
+		dl.ResumeInterrupted()
+		sched.CatchUp()
+	}
 
 	mux := http.NewServeMux()
 	apiHandler := handlers.New(db, authService, sourceRegistry, dl, sched, hooksManager)
+	apiHandler.SetStandby(replica)
+	apiHandler.SetAudit(auditLog)
+	apiHandler.SetImportRoots(cfg.ImportRoots)
+	apiHandler.SetRestoreLimit(int64(cfg.RestoreLimitMB) << 20)
 	_ = generated.HandlerWithOptions(apiHandler, generated.StdHTTPServerOptions{
-		BaseURL:     "/api",
-		BaseRouter:  mux,
-		Middlewares: []generated.MiddlewareFunc{authService.Middleware},
+		BaseURL:    "/api",
+		BaseRouter: mux,
+		// Authentication runs first so rejected writes on a standby still require a login
+		Middlewares: []generated.MiddlewareFunc{replica.Middleware, authService.Middleware},
 	})
 
+	webFS, err := fs.Sub(webAssets, "web/ui/dist")
+	if err != nil {
+		slog.Error("Failed to get web assets", "error", err)
+		os.Exit(1)
+	}
+
+	var apiVersion string
+	if spec, err := generated.GetSwagger(); err == nil {
+		apiVersion = spec.Info.Version
+	}
+	info, err := buildinfo.Load(webFS, apiVersion)
+	if err != nil {
+		slog.Warn("Failed to read build info", "error", err)
+	}
+	apiHandler.SetBuildInfo(info)
+
+	reporter := telemetry.New(db, cfg)
+	builtinIDs := make([]string, len(builtinAdapters))
+	for i, a := range builtinAdapters {
+		builtinIDs[i] = a.ID()
+	}
+	reporter.SetBuiltinSources(builtinIDs)
+	apiHandler.SetTelemetry(reporter)
+	if cfg.Telemetry && cfg.TelemetryURL == "" {
+		slog.Warn("Telemetry enabled but BULK_LOADER_TELEMETRY_URL is not set; nothing will be sent")
+	}
+	reporter.Start()
+
+	reloader := reload.New(cfg, dl, sched, postProcess)
+	apiHandler.SetReloader(reloader)
+
 	if cfg.DevMode && cfg.ViteProxy != "" {
 		slog.Info("Dev mode: proxying to Vite", "url", cfg.ViteProxy)
 		viteURL, err := url.Parse(cfg.ViteProxy)
@@ -98,10 +321,9 @@ func main() {
 		}
 		mux.Handle("/", httputil.NewSingleHostReverseProxy(viteURL))
 	} else {
-		webFS, err := fs.Sub(webAssets, "web/ui/dist")
-		if err != nil {
-			slog.Error("Failed to get web assets", "error", err)
-			os.Exit(1)
+		for _, problem := range info.Skew() {
+			slog.Warn("Embedded UI does not match server build", "problem", problem,
+				"version", info.Version, "uiVersion", info.UIVersion, "uiHash", info.UIHash)
 		}
 		fileServer := http.FileServer(http.FS(webFS))
 		mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -116,9 +338,21 @@ func main() {
 		}))
 	}
 
+	tlsCfg, err := tlsconfig.New(cfg)
+	if err != nil {
+		slog.Error("Failed to configure TLS", "error", err)
+		os.Exit(1)
+	}
+
+	listeners, err := listen.Listeners(cfg)
+	if err != nil {
+		slog.Error("Failed to listen", "error", err)
+		os.Exit(1)
+	}
+
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Port),
 		Handler:      mux,
+		TLSConfig:    tlsCfg,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -127,16 +361,66 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	go func() {
-		slog.Info("Server listening", "addr", server.Addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			slog.Error("Server error", "error", err)
+	for _, lis := range listeners {
+		go func(lis net.Listener) {
+			slog.Info("Server listening", "network", lis.Addr().Network(), "addr", lis.Addr().String(), "tls", tlsCfg != nil)
+			var err error
+			if tlsCfg != nil {
+				// Certificates come from TLSConfig, not from files passed here
+				err = server.ServeTLS(lis, "", "")
+			} else {
+				err = server.Serve(lis)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				slog.Error("Server error", "error", err)
+				os.Exit(1)
+			}
+		}(lis)
+	}
+
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort > 0 {
+		lis, err := net.Listen("tcp", cfg.GRPCAddr())
+		if err != nil {
+			slog.Error("Failed to listen for gRPC", "error", err)
 			os.Exit(1)
 		}
+		opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(replica.UnaryInterceptor)}
+		if tlsCfg != nil {
+			// API keys travel as metadata, so they get the same protection
+			// as over HTTPS
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+		}
+		grpcServer = grpcserver.New(db, authService, dl, hooksManager).NewGRPCServer(opts...)
+		go func() {
+			slog.Info("gRPC server listening", "addr", lis.Addr().String(), "tls", tlsCfg != nil)
+			if err := grpcServer.Serve(lis); err != nil {
+				slog.Error("gRPC server error", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	replica.Start()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if _, err := reloader.Reload(); err != nil {
+				slog.Error("Failed to reload configuration", "error", err)
+			}
+		}
 	}()
 
 	<-ctx.Done()
 	slog.Info("Shutting down...")
+	signal.Stop(hup)
+	replica.Stop()
+
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -145,5 +429,46 @@ func main() {
 		slog.Error("Shutdown error", "error", err)
 	}
 
+	reporter.Stop()
 	sched.Stop()
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownDrain)*time.Second)
+	defer cancelDrain()
+	if len(dl.ActiveDownloads()) > 0 {
+		slog.Info("Waiting for active downloads", "deadline", time.Duration(cfg.ShutdownDrain)*time.Second)
+	}
+	if interrupted := dl.Drain(drainCtx); interrupted > 0 {
+		slog.Info("Checkpointed active downloads for the next start", "count", interrupted)
+	}
+	hooksManager.Stop()
+}
+
+// runOnce performs a single sync and download pass and returns the process
+// exit code: 0 on success, 1 if the run was aborted, 2 if any sync or
+// download failed
+func runOnce(sched *scheduler.Scheduler, hooksManager *hooks.Manager) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	result, err := sched.RunOnce(ctx)
+	hooksManager.FlushDigests()
+	hooksManager.Wait()
+	if err != nil {
+		slog.Error("Run failed", "error", err)
+		return 1
+	}
+
+	slog.Info("Run completed",
+		"products", result.Products,
+		"failedSyncs", result.FailedSyncs,
+		"newFiles", result.NewFiles,
+		"downloaded", result.Downloaded,
+		"failedDownloads", result.FailedDownloads,
+		"deferred", result.Deferred,
+		"skipped", result.Skipped,
+	)
+	if !result.OK() {
+		return 2
+	}
+	return 0
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// runMigrate implements the "migrate" command. Starting the server applies
+// pending migrations; "migrate status" lists the applied and pending ones
+// without changing the database and "migrate down" rolls back the latest,
+// e.g. before downgrading.
+func runMigrate(args []string) {
+	var action string
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+	if action != "status" && action != "down" {
+		fmt.Fprintln(os.Stderr, "usage: bulk-file-loader migrate status | down [-steps n]")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	steps := fs.Int("steps", 1, "Number of migrations to roll back")
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		slog.Error("Failed to open database", "error", err)
+		os.Exit(1)
+	}
+
+	if action == "status" {
+		applied, err := db.AppliedMigrations()
+		if err != nil {
+			slog.Error("Failed to list migrations", "error", err)
+			os.Exit(1)
+		}
+		pending, err := db.PendingMigrations()
+		if err != nil {
+			slog.Error("Failed to list migrations", "error", err)
+			os.Exit(1)
+		}
+		for _, id := range applied {
+			fmt.Println(id)
+		}
+		for _, id := range pending {
+			fmt.Println(id, "(pending)")
+		}
+		fmt.Printf("%d migrations applied, %d pending\n", len(applied), len(pending))
+		return
+	}
+
+	reverted, err := db.RollbackMigrations(*steps)
+	for _, id := range reverted {
+		fmt.Println("Rolled back", id)
+	}
+	if err != nil {
+		slog.Error("Failed to roll back migrations", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+)
+
+// runRelocate implements the "relocate" command, which points the data
+// directory, or only the downloads, to a new path and rewrites the stored
+// download paths. The server must be stopped.
+func runRelocate(args []string) {
+	fs := flag.NewFlagSet("relocate", flag.ExitOnError)
+	downloads := fs.Bool("downloads", false, "Relocate only the downloads directory")
+	move := fs.Bool("move", false, "Move the files; otherwise they must already be copied")
+	force := fs.Bool("force", false, "Rewrite the paths even if downloaded files are missing")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: bulk-file-loader relocate [-downloads] [-move] [-force] <new path>")
+		os.Exit(2)
+	}
+	target, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		slog.Error("Invalid path", "error", err)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	key, source := "BULK_LOADER_DATA_DIR", cfg.DataDir
+	if *downloads {
+		key, source = "BULK_LOADER_DOWNLOADS_DIR", cfg.DownloadsPath()
+	}
+	if *move {
+		if err := moveDir(source, target); err != nil {
+			slog.Error("Failed to move directory", "from", source, "to", target, "error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Moved %s to %s\n", source, target)
+	}
+
+	// The SQLite database moves with the data directory
+	if !*downloads {
+		cfg.DataDir = target
+		if cfg.DBDriver == "sqlite" {
+			if _, err := os.Stat(cfg.DatabasePath()); err != nil {
+				slog.Error("Database not found in the new data directory; copy the directory first or use -move",
+					"path", cfg.DatabasePath())
+				os.Exit(1)
+			}
+		}
+	}
+	db, err := database.New(cfg)
+	if err != nil {
+		slog.Error("Failed to initialize database", "error", err)
+		os.Exit(1)
+	}
+
+	result, err := db.RelocateDownloads(source, target, *force)
+	if errors.Is(err, database.ErrRelocateMissing) {
+		for _, path := range result.Missing {
+			fmt.Println("Missing", path)
+		}
+		slog.Error("Downloaded files missing at the new location; nothing was changed, use -force to relocate anyway",
+			"missing", len(result.Missing))
+		os.Exit(1)
+	}
+	if err != nil {
+		slog.Error("Failed to rewrite download paths", "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Rewrote %d download paths", result.Updated)
+	if len(result.Missing) > 0 {
+		fmt.Printf(", %d files missing", len(result.Missing))
+	}
+	fmt.Println()
+
+	if file := os.Getenv("BULK_LOADER_CONFIG_FILE"); file != "" {
+		if err := config.SetFileValue(file, key, target); err != nil {
+			slog.Error("Failed to update config file", "error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Set %s=%s in %s\n", key, target, file)
+	}
+	if os.Getenv(key) != "" || os.Getenv("BULK_LOADER_CONFIG_FILE") == "" {
+		fmt.Printf("Set %s=%s in the environment before starting the server\n", key, target)
+	}
+}
+
+// rename is replaced in tests to simulate a move across filesystems
+var rename = os.Rename
+
+// moveDir moves a directory, copying it when the target is on another
+// filesystem. Modification times are kept, so reconciliation doesn't take
+// copied files as modified. Symlinks such as the latest links are recreated,
+// and hard-linked files from deduplication are linked again instead of being
+// copied once per link.
+func moveDir(source, target string) error {
+	if entries, err := os.ReadDir(target); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s is not empty", target)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	os.Remove(target)
+	err := rename(source, target)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	copied := map[[2]uint64]string{}
+	err = filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(target, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(dest, info.Mode().Perm())
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			// Absolute links into the moved directory follow it
+			if filepath.IsAbs(link) {
+				if r, err := filepath.Rel(source, link); err == nil && filepath.IsLocal(r) {
+					link = filepath.Join(target, r)
+				}
+			}
+			return os.Symlink(link, dest)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		id, linked := fileID(info)
+		if first, ok := copied[id]; linked && ok {
+			return os.Link(first, dest)
+		}
+		if linked {
+			copied[id] = dest
+		}
+		if err := copyFile(path, dest, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(dest, info.ModTime(), info.ModTime())
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(source)
+}
+
+func copyFile(source, target string, perm os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import "os"
+
+// fileID is not supported here, so hard-linked files are copied one by one
+func fileID(info os.FileInfo) ([2]uint64, bool) {
+	return [2]uint64{}, false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestMoveDirAcrossFilesystems(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks and hard links need a Unix filesystem")
+	}
+	orig := rename
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	defer func() { rename = orig }()
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "downloads")
+	target := filepath.Join(dir, "moved", "downloads")
+	files := filepath.Join(source, "product", "files")
+	latest := filepath.Join(source, "product", "latest")
+	for _, d := range []string{files, latest} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(files, "a.zip"), []byte("PK"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(files, "a.zip"), filepath.Join(files, "b.zip")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../files/a.zip", filepath.Join(latest, "a.zip")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(files, "b.zip"), filepath.Join(latest, "b.zip")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveDir(source, target); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Errorf("source still exists: %v", err)
+	}
+	movedFiles := filepath.Join(target, "product", "files")
+	movedLatest := filepath.Join(target, "product", "latest")
+	if link, err := os.Readlink(filepath.Join(movedLatest, "a.zip")); err != nil || link != "../files/a.zip" {
+		t.Errorf("relative symlink = %q, %v; want ../files/a.zip", link, err)
+	}
+	if link, err := os.Readlink(filepath.Join(movedLatest, "b.zip")); err != nil || link != filepath.Join(movedFiles, "b.zip") {
+		t.Errorf("absolute symlink = %q, %v; want it to point into the target", link, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(movedLatest, "a.zip")); err != nil || string(data) != "PK" {
+		t.Errorf("content through symlink = %q, %v", data, err)
+	}
+	a, err := os.Stat(filepath.Join(movedFiles, "a.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.Stat(filepath.Join(movedFiles, "b.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(a, b) {
+		t.Error("hard-linked files were copied separately")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/patent-dev/bulk-file-loader/config"
+	"github.com/patent-dev/bulk-file-loader/internal/database"
+	"github.com/patent-dev/bulk-file-loader/internal/synthetic"
+)
+
+// runSeed implements the "seed" command, which fills the configured database
+// with synthetic data for load and performance testing
+func runSeed(args []string) {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	opts := synthetic.Options{}
+	fs.IntVar(&opts.Sources, "sources", 2, "Number of synthetic sources")
+	fs.IntVar(&opts.ProductsPerSource, "products", 10, "Products per source")
+	fs.IntVar(&opts.DeliveriesPerProduct, "deliveries", 10, "Deliveries per product")
+	fs.IntVar(&opts.FilesPerDelivery, "files", 20, "Files per delivery")
+	fs.BoolVar(&opts.WithDownloads, "downloads", false, "Add fake download entries")
+	fs.Int64Var(&opts.Seed, "seed", time.Now().UnixNano(), "Random seed for reproducible data")
+	remove := fs.Bool("remove", false, "Remove previously generated synthetic data and exit")
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	db, err := database.New(cfg)
+	if err != nil {
+		slog.Error("Failed to initialize database", "error", err)
+		os.Exit(1)
+	}
+
+	if *remove {
+		if err := synthetic.Remove(db); err != nil {
+			slog.Error("Failed to remove synthetic data", "error", err)
+			os.Exit(1)
+		}
+		fmt.Println("Synthetic data removed")
+		return
+	}
+
+	start := time.Now()
+	result, err := synthetic.Generate(db, cfg.DownloadsPath(), opts)
+	if err != nil {
+		slog.Error("Failed to generate synthetic data", "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Created %d sources, %d products, %d deliveries, %d files, %d download entries in %s\n",
+		result.Sources, result.Products, result.Deliveries, result.Files, result.DownloadEntries,
+		time.Since(start).Round(time.Millisecond))
+}
@@ -4,6 +4,9 @@ import { ref } from 'vue'
 export const useAuthStore = defineStore('auth', () => {
   const configured = ref(false)
   const authenticated = ref(false)
+  const oidc = ref(false)
+  const loginDisabled = ref(false)
+  const readOnly = ref(false)
 
   async function checkStatus() {
     try {
@@ -12,6 +15,9 @@ export const useAuthStore = defineStore('auth', () => {
         const data = await response.json()
         configured.value = data.configured
         authenticated.value = data.authenticated
+        oidc.value = data.oidc
+        loginDisabled.value = data.loginDisabled
+        readOnly.value = data.readOnly
       }
     } catch (error) {
       console.error('Failed to check auth status:', error)
@@ -69,6 +75,9 @@ export const useAuthStore = defineStore('auth', () => {
   return {
     configured,
     authenticated,
+    oidc,
+    loginDisabled,
+    readOnly,
     checkStatus,
     setup,
     login,
@@ -1,8 +1,28 @@
-import { defineConfig } from 'vite'
+import { readFileSync } from 'node:fs'
+import { defineConfig, type Plugin } from 'vite'
 import vue from '@vitejs/plugin-vue'
 
+const pkg = JSON.parse(readFileSync(new URL('./package.json', import.meta.url), 'utf-8'))
+
+// Writes build-info.json so the server can detect a UI built for a different version
+function buildInfo(): Plugin {
+  return {
+    name: 'build-info',
+    generateBundle() {
+      this.emitFile({
+        type: 'asset',
+        fileName: 'build-info.json',
+        source: JSON.stringify({
+          version: process.env.BULK_LOADER_VERSION || pkg.version,
+          apiVersion: pkg.apiVersion,
+        }),
+      })
+    },
+  }
+}
+
 export default defineConfig({
-  plugins: [vue()],
+  plugins: [vue(), buildInfo()],
   server: {
     allowedHosts: ['bulk.l.t'],
     headers: {